@@ -0,0 +1,123 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit mirrors selected changes of many databases into one audit database.
+//
+// Each mirrored change is wrapped in an Entry that names its origin and its index in the history of
+// the origin. The audit database keeps a cursor per origin in its state, which is advanced by the
+// same change that mirrors an entry. An interrupted fan-in therefore resumes behind the last
+// mirrored change without a separate cursor file.
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/simia-tech/tapedb/v2"
+	"github.com/simia-tech/tapedb/v2/io/file"
+)
+
+// ErrCursorLost is returned if changes of an origin that haven't been mirrored yet have been
+// rebased into its base.
+var ErrCursorLost = errors.New("cursor lost")
+
+type FanIn struct {
+	db       *file.Database[*Base, *State]
+	selectFn func(tapedb.Change) bool
+	clock    tapedb.Clock
+	mutex    sync.Mutex
+}
+
+// NewFanIn returns a fan-in that mirrors changes into the provided audit database.
+func NewFanIn(db *file.Database[*Base, *State], opts ...Option) *FanIn {
+	options := defaultOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return &FanIn{
+		db:       db,
+		selectFn: options.selectFn,
+		clock:    tapedb.ClockOrSystem(options.clock),
+	}
+}
+
+// Cursor returns the index behind the last mirrored change of the provided origin.
+func (fi *FanIn) Cursor(origin string) int64 {
+	state := fi.db.State()
+	state.ReadLocker.Lock()
+	defer state.ReadLocker.Unlock()
+	return state.Cursors[origin]
+}
+
+// ReadEntries passes the entries of the audit database to fn.
+func (fi *FanIn) ReadEntries(fn func(*Entry) error) error {
+	return fi.db.ReadChanges(func(_ int, change tapedb.Change) error {
+		if e, ok := change.(*Entry); ok {
+			return fn(e)
+		}
+		return nil
+	})
+}
+
+// Mirror copies the selected changes of the database at the provided path that have been added
+// since the last call into the audit database. The returned number is the number of mirrored
+// changes. The origin names the database in the entries and must be stable.
+func Mirror[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](fi *FanIn, origin string, f F, path string, opts ...file.OpenOption) (int, error) {
+	fi.mutex.Lock()
+	defer fi.mutex.Unlock()
+
+	meta, err := file.ReadDatabaseMeta(path)
+	if err != nil {
+		return 0, err
+	}
+	rebasedTotal := int64(meta.GetUInt64(file.MetaFieldSpliceRebasedTotal, 0))
+
+	cursor := fi.Cursor(origin)
+	if cursor < rebasedTotal {
+		return 0, fmt.Errorf("origin %s at %d has been spliced at %d: %w", origin, cursor, rebasedTotal, ErrCursorLost)
+	}
+
+	mirrored := 0
+	err = file.ReadChanges[B, S](f, path, opts, func(logIndex int, change tapedb.Change) error {
+		index := rebasedTotal + int64(logIndex)
+		if index < cursor || !fi.selectFn(change) {
+			return nil
+		}
+
+		buffer := bytes.Buffer{}
+		if _, err := change.WriteTo(&buffer); err != nil {
+			return fmt.Errorf("encode change %d: %w", index, err)
+		}
+
+		if err := fi.db.Apply(&Entry{
+			Origin:     origin,
+			Index:      index,
+			Time:       fi.clock.Now().UTC(),
+			ChangeType: change.TypeName(),
+			Change:     buffer.Bytes(),
+		}); err != nil {
+			return fmt.Errorf("apply entry: %w", err)
+		}
+		mirrored++
+		return nil
+	})
+	return mirrored, err
+}
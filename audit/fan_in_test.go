@@ -0,0 +1,174 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2"
+	"github.com/simia-tech/tapedb/v2/audit"
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestFanIn(t *testing.T) {
+	now := time.Date(2021, time.May, 1, 12, 0, 0, 0, time.UTC)
+
+	setupFn := func(t *testing.T, opts ...audit.Option) (string, *audit.FanIn, func()) {
+		path, removeDir := makeTempDir(t)
+
+		for _, tenant := range []string{"one", "two"} {
+			db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), filepath.Join(path, tenant))
+			require.NoError(t, err)
+			require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+			require.NoError(t, db.Apply(&test.ChangeCounterSet{Value: 5}))
+			require.NoError(t, db.Close())
+		}
+
+		db, err := file.CreateDatabase[*audit.Base, *audit.State](audit.NewFactory(), filepath.Join(path, "audit"))
+		require.NoError(t, err)
+
+		return path, audit.NewFanIn(db, append(opts, audit.WithClock(test.NewClock(now)))...), func() {
+			require.NoError(t, db.Close())
+			removeDir()
+		}
+	}
+
+	applyFn := func(t *testing.T, path string, change tapedb.Change) {
+		db, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path)
+		require.NoError(t, err)
+		require.NoError(t, db.Apply(change))
+		require.NoError(t, db.Close())
+	}
+
+	readEntriesFn := func(t *testing.T, fi *audit.FanIn) []*audit.Entry {
+		entries := []*audit.Entry{}
+		require.NoError(t, fi.ReadEntries(func(e *audit.Entry) error {
+			entries = append(entries, e)
+			return nil
+		}))
+		return entries
+	}
+
+	t.Run("Mirror", func(t *testing.T) {
+		path, fi, teardown := setupFn(t)
+		defer teardown()
+
+		n, err := audit.Mirror[*test.Base, *test.State](fi, "one", test.NewFactory(), filepath.Join(path, "one"))
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+		n, err = audit.Mirror[*test.Base, *test.State](fi, "two", test.NewFactory(), filepath.Join(path, "two"))
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+
+		entries := readEntriesFn(t, fi)
+		require.Len(t, entries, 4)
+		assert.Equal(t, "one", entries[0].Origin)
+		assert.Equal(t, int64(0), entries[0].Index)
+		assert.Equal(t, now, entries[0].Time)
+		assert.Equal(t, "counter-inc", entries[0].ChangeType)
+		assert.JSONEq(t, `{"value":1}`, string(entries[0].Change))
+		assert.Equal(t, "two", entries[3].Origin)
+		assert.Equal(t, int64(1), entries[3].Index)
+		assert.Equal(t, "counter-set", entries[3].ChangeType)
+
+		assert.Equal(t, int64(2), fi.Cursor("one"))
+		assert.Equal(t, int64(2), fi.Cursor("two"))
+	})
+
+	t.Run("Resume", func(t *testing.T) {
+		path, fi, teardown := setupFn(t)
+		defer teardown()
+
+		_, err := audit.Mirror[*test.Base, *test.State](fi, "one", test.NewFactory(), filepath.Join(path, "one"))
+		require.NoError(t, err)
+
+		applyFn(t, filepath.Join(path, "one"), &test.ChangeCounterInc{Value: 3})
+
+		n, err := audit.Mirror[*test.Base, *test.State](fi, "one", test.NewFactory(), filepath.Join(path, "one"))
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+
+		entries := readEntriesFn(t, fi)
+		require.Len(t, entries, 3)
+		assert.Equal(t, int64(2), entries[2].Index)
+		assert.Equal(t, int64(3), fi.Cursor("one"))
+	})
+
+	t.Run("ResumeAfterSplice", func(t *testing.T) {
+		path, fi, teardown := setupFn(t)
+		defer teardown()
+
+		_, err := audit.Mirror[*test.Base, *test.State](fi, "one", test.NewFactory(), filepath.Join(path, "one"))
+		require.NoError(t, err)
+
+		_, err = file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), filepath.Join(path, "one"), file.WithRebaseChangeCount(2))
+		require.NoError(t, err)
+		applyFn(t, filepath.Join(path, "one"), &test.ChangeCounterInc{Value: 3})
+
+		n, err := audit.Mirror[*test.Base, *test.State](fi, "one", test.NewFactory(), filepath.Join(path, "one"))
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+
+		entries := readEntriesFn(t, fi)
+		require.Len(t, entries, 3)
+		assert.Equal(t, int64(2), entries[2].Index)
+	})
+
+	t.Run("CursorLost", func(t *testing.T) {
+		path, fi, teardown := setupFn(t)
+		defer teardown()
+
+		_, err := file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), filepath.Join(path, "one"), file.WithRebaseChangeCount(2))
+		require.NoError(t, err)
+
+		_, err = audit.Mirror[*test.Base, *test.State](fi, "one", test.NewFactory(), filepath.Join(path, "one"))
+		assert.ErrorIs(t, err, audit.ErrCursorLost)
+	})
+
+	t.Run("ChangeTypes", func(t *testing.T) {
+		path, fi, teardown := setupFn(t, audit.WithChangeTypes("counter-set"))
+		defer teardown()
+
+		n, err := audit.Mirror[*test.Base, *test.State](fi, "one", test.NewFactory(), filepath.Join(path, "one"))
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+
+		entries := readEntriesFn(t, fi)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "counter-set", entries[0].ChangeType)
+		assert.Equal(t, int64(2), fi.Cursor("one"))
+	})
+}
+
+func TestEntryRoundTrip(t *testing.T) {
+	entry := &audit.Entry{Origin: "one", Index: 3, ChangeType: "counter-inc", Change: []byte(`{"value":1}`)}
+
+	buffer := bytes.Buffer{}
+	_, err := entry.WriteTo(&buffer)
+	require.NoError(t, err)
+
+	decoded := &audit.Entry{}
+	_, err = decoded.ReadFrom(&buffer)
+	require.NoError(t, err)
+	assert.Equal(t, entry.Origin, decoded.Origin)
+	assert.Equal(t, entry.Change, decoded.Change)
+}
@@ -0,0 +1,35 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit_test
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func makeTempDir(tb testing.TB) (string, func()) {
+	n := [8]byte{}
+	rand.Read(n[:])
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("tapedb-%x", n[:]))
+	require.NoError(tb, os.MkdirAll(path, 0777))
+	return path, func() {
+		require.NoError(tb, os.RemoveAll(path))
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/simia-tech/tapedb/v2"
+)
+
+const ChangeTypeEntry = "tapedb-audit-entry"
+
+// Entry is the change that holds a mirrored change together with its origin. Index is the position
+// of the change in the history of the origin, including the changes that have been rebased into
+// its base.
+type Entry struct {
+	Origin     string    `json:"origin"`
+	Index      int64     `json:"index"`
+	Time       time.Time `json:"time"`
+	ChangeType string    `json:"changeType"`
+	Change     []byte    `json:"change"`
+}
+
+func (e *Entry) TypeName() string {
+	return ChangeTypeEntry
+}
+
+func (e *Entry) ReadFrom(r io.Reader) (int64, error) {
+	return tapedb.ReadJSON(r, e)
+}
+
+func (e *Entry) WriteTo(w io.Writer) (int64, error) {
+	return tapedb.WriteJSON(w, e)
+}
+
+// Base holds the cursors of the origins, so they survive a splice of the audit database.
+type Base struct {
+	Cursors map[string]int64 `json:"cursors,omitempty"`
+}
+
+func NewBase() *Base {
+	return &Base{}
+}
+
+func (b *Base) ReadFrom(r io.Reader) (int64, error) {
+	return tapedb.ReadJSON(r, b)
+}
+
+func (b *Base) WriteTo(w io.Writer) (int64, error) {
+	return tapedb.WriteJSON(w, b)
+}
+
+func (b *Base) Apply(c tapedb.Change) error {
+	if e, ok := c.(*Entry); ok {
+		b.Cursors = advanceCursor(b.Cursors, e)
+	}
+	return nil
+}
+
+// State holds the cursor of each origin, which is the index behind the last mirrored change.
+type State struct {
+	Cursors    map[string]int64
+	ReadLocker sync.Locker
+}
+
+func NewState(b *Base, readLocker sync.Locker) *State {
+	cursors := make(map[string]int64, len(b.Cursors))
+	for origin, cursor := range b.Cursors {
+		cursors[origin] = cursor
+	}
+	return &State{Cursors: cursors, ReadLocker: readLocker}
+}
+
+func (s *State) Apply(c tapedb.Change) error {
+	if e, ok := c.(*Entry); ok {
+		s.Cursors = advanceCursor(s.Cursors, e)
+	}
+	return nil
+}
+
+func advanceCursor(cursors map[string]int64, e *Entry) map[string]int64 {
+	if cursors == nil {
+		cursors = map[string]int64{}
+	}
+	if cursor := e.Index + 1; cursor > cursors[e.Origin] {
+		cursors[e.Origin] = cursor
+	}
+	return cursors
+}
+
+type Factory struct{}
+
+func NewFactory() *Factory {
+	return &Factory{}
+}
+
+func (f *Factory) NewBase() *Base {
+	return NewBase()
+}
+
+func (f *Factory) NewState(base *Base, readLocker sync.Locker) *State {
+	return NewState(base, readLocker)
+}
+
+func (f *Factory) NewChange(typeName string) (tapedb.Change, error) {
+	if typeName == ChangeTypeEntry {
+		return &Entry{}, nil
+	}
+	return nil, fmt.Errorf("change type [%s]: %w", typeName, tapedb.ErrUnknownChangeType)
+}
@@ -0,0 +1,56 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"github.com/simia-tech/tapedb/v2"
+)
+
+type options struct {
+	selectFn func(tapedb.Change) bool
+	clock    tapedb.Clock
+}
+
+var defaultOptions = options{
+	selectFn: func(tapedb.Change) bool { return true },
+}
+
+type Option func(*options)
+
+// WithChangeTypes mirrors only changes of the provided types.
+func WithChangeTypes(values ...string) Option {
+	typeNames := map[string]struct{}{}
+	for _, value := range values {
+		typeNames[value] = struct{}{}
+	}
+	return WithSelectFunc(func(change tapedb.Change) bool {
+		_, ok := typeNames[change.TypeName()]
+		return ok
+	})
+}
+
+// WithSelectFunc mirrors only the changes for which the provided function returns true.
+func WithSelectFunc(value func(tapedb.Change) bool) Option {
+	return func(o *options) {
+		o.selectFn = value
+	}
+}
+
+// WithClock sets the clock that is used for the time of the entries.
+func WithClock(value tapedb.Clock) Option {
+	return func(o *options) {
+		o.clock = value
+	}
+}
@@ -15,12 +15,185 @@
 package tapedb
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
 	"io"
+	"math"
 )
 
+// ErrNotChunkedBase is returned if a base is expected to be chunked, but has been written as one
+// document.
+var ErrNotChunkedBase = NewError(ErrorCodeCorrupt, "base not chunked")
+
 type Base interface {
 	io.ReaderFrom
 	io.WriterTo
 
 	Apply(Change) error
 }
+
+// ChunkedBase is implemented by bases that are too large to be encoded as one document. Instead
+// of WriteTo and ReadFrom, WriteWithCodec and ReadWithCodec use the chunks of the base, which are
+// encoded one by one and framed by their size like log entries. Neither the writer nor the reader
+// has to hold more than one encoded chunk in memory. A base that has been written as one document
+// is still read with ReadFrom, so a model can switch to chunks without a migration.
+type ChunkedBase interface {
+	Base
+
+	// WriteChunks passes the chunks of the base to fn in the order they are read back.
+	WriteChunks(fn func(io.WriterTo) error) error
+	// NewChunk returns an empty chunk that the next chunk is decoded into.
+	NewChunk() io.ReaderFrom
+	// AddChunk adds a decoded chunk to the base.
+	AddChunk(io.ReaderFrom) error
+}
+
+// chunkedBaseMagic starts a chunked base. It can't be mistaken for the start of a JSON document.
+var chunkedBaseMagic = []byte("\x00tapedb-chunked-base\n")
+
+// chunkHeaderSize is the size of the header that holds the size of a chunk. A chunk of size zero
+// ends the base.
+const chunkHeaderSize = 4
+
+// IsChunkedBase returns true if the provided data starts like a chunked base.
+func IsChunkedBase(data []byte) bool {
+	return bytes.HasPrefix(data, chunkedBaseMagic)
+}
+
+// ReadRawBaseChunks passes the encoded chunks of a chunked base to fn without decoding them. A base
+// that has been written as one document results in ErrNotChunkedBase.
+func ReadRawBaseChunks(r io.Reader, fn func([]byte) error) error {
+	br := bufio.NewReader(r)
+	if !peekChunkedBase(br) {
+		return ErrNotChunkedBase
+	}
+	_, err := readChunks(br, func(r io.Reader) error {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		return fn(data)
+	})
+	return err
+}
+
+func writeChunkedBase(w io.Writer, c Codec, base ChunkedBase) (int64, error) {
+	n, err := w.Write(chunkedBaseMagic)
+	total := int64(n)
+	if err != nil {
+		return total, fmt.Errorf("write magic: %w", err)
+	}
+
+	buffer := bytes.Buffer{}
+	writeChunk := func(data []byte) error {
+		header := [chunkHeaderSize]byte{}
+		binary.BigEndian.PutUint32(header[:], uint32(len(data)))
+		n, err := w.Write(header[:])
+		total += int64(n)
+		if err != nil {
+			return err
+		}
+		n, err = w.Write(data)
+		total += int64(n)
+		return err
+	}
+
+	index := 0
+	err = base.WriteChunks(func(chunk io.WriterTo) error {
+		buffer.Reset()
+		if _, err := WriteWithCodec(&buffer, c, chunk); err != nil {
+			return fmt.Errorf("encode chunk %d: %w", index, err)
+		}
+		if buffer.Len() == 0 {
+			return fmt.Errorf("chunk %d is empty", index)
+		}
+		if uint64(buffer.Len()) > math.MaxUint32 {
+			return fmt.Errorf("chunk %d of size %d is too large", index, buffer.Len())
+		}
+		if err := writeChunk(buffer.Bytes()); err != nil {
+			return fmt.Errorf("write chunk %d: %w", index, err)
+		}
+		index++
+		return nil
+	})
+	if err != nil {
+		return total, err
+	}
+
+	if err := writeChunk(nil); err != nil {
+		return total, fmt.Errorf("write end: %w", err)
+	}
+	return total, nil
+}
+
+func readChunkedBase(r io.Reader, c Codec, base ChunkedBase) (int64, error) {
+	br := bufio.NewReader(r)
+	if !peekChunkedBase(br) {
+		// the base has been written as one document
+		if c == nil {
+			return base.ReadFrom(br)
+		}
+		return c.Decode(br, base)
+	}
+
+	index := 0
+	return readChunks(br, func(r io.Reader) error {
+		chunk := base.NewChunk()
+		if _, err := ReadWithCodec(r, c, chunk); err != nil {
+			return fmt.Errorf("decode chunk %d: %w", index, err)
+		}
+		if err := base.AddChunk(chunk); err != nil {
+			return fmt.Errorf("add chunk %d: %w", index, err)
+		}
+		index++
+		return nil
+	})
+}
+
+func peekChunkedBase(br *bufio.Reader) bool {
+	prefix, _ := br.Peek(len(chunkedBaseMagic))
+	return IsChunkedBase(prefix)
+}
+
+// readChunks reads the chunks that follow the magic up to the end chunk. A base that ends before
+// the end chunk is truncated.
+func readChunks(br *bufio.Reader, fn func(io.Reader) error) (int64, error) {
+	n, err := br.Discard(len(chunkedBaseMagic))
+	total := int64(n)
+	if err != nil {
+		return total, err
+	}
+
+	for {
+		header := [chunkHeaderSize]byte{}
+		n, err := io.ReadFull(br, header[:])
+		total += int64(n)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return total, fmt.Errorf("read chunk size: %w", err)
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[:]))
+		if size == 0 {
+			return total, nil
+		}
+
+		lr := &io.LimitedReader{R: br, N: size}
+		err = fn(lr)
+		if err == nil {
+			// decoders might leave trailing bytes like a newline behind
+			_, err = io.Copy(io.Discard, lr)
+		}
+		total += size - lr.N
+		if err != nil {
+			return total, err
+		}
+		if lr.N > 0 {
+			return total, fmt.Errorf("read chunk: %w", io.ErrUnexpectedEOF)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tapedb_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestChunkedBase(t *testing.T) {
+	base := test.NewChunkedBase()
+	base.Value = 7
+	base.IDs = []string{"123"}
+	base.Items = map[string]test.Item{
+		"a": {Name: "A"},
+		"b": {Name: "B", PayloadID: "123"},
+		"c": {Name: "C"},
+	}
+
+	testFn := func(name string, codec tapedb.Codec) {
+		t.Run(name, func(t *testing.T) {
+			buffer := bytes.Buffer{}
+			n, err := tapedb.WriteWithCodec(&buffer, codec, base)
+			require.NoError(t, err)
+			assert.Equal(t, int64(buffer.Len()), n)
+			assert.True(t, tapedb.IsChunkedBase(buffer.Bytes()))
+
+			data := buffer.Bytes()
+			readBase := test.NewChunkedBase()
+			n, err = tapedb.ReadWithCodec(&buffer, codec, readBase)
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(data)), n)
+			assert.Equal(t, base, readBase)
+		})
+	}
+
+	testFn("JSON", nil)
+	testFn("Gob", tapedb.GobCodec{})
+
+	t.Run("Chunks", func(t *testing.T) {
+		buffer := bytes.Buffer{}
+		_, err := tapedb.WriteWithCodec(&buffer, nil, base)
+		require.NoError(t, err)
+
+		chunks := []string{}
+		require.NoError(t, tapedb.ReadRawBaseChunks(&buffer, func(data []byte) error {
+			chunks = append(chunks, string(data))
+			return nil
+		}))
+		assert.Equal(t, []string{
+			"{\"value\":7,\"payloadIDs\":[\"123\"],\"items\":{\"a\":{\"name\":\"A\"},\"b\":{\"name\":\"B\",\"payloadID\":\"123\"}}}\n",
+			"{\"items\":{\"c\":{\"name\":\"C\"}}}\n",
+		}, chunks)
+	})
+
+	t.Run("ReadDocument", func(t *testing.T) {
+		readBase := test.NewChunkedBase()
+		_, err := tapedb.ReadWithCodec(strings.NewReader(`{"value":7,"items":{"a":{"name":"A"}}}`), nil, readBase)
+		require.NoError(t, err)
+		assert.Equal(t, 7, readBase.Value)
+		assert.Equal(t, map[string]test.Item{"a": {Name: "A"}}, readBase.Items)
+
+		err = tapedb.ReadRawBaseChunks(strings.NewReader(`{"value":7}`), func([]byte) error { return nil })
+		assert.ErrorIs(t, err, tapedb.ErrNotChunkedBase)
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		buffer := bytes.Buffer{}
+		_, err := tapedb.WriteWithCodec(&buffer, nil, base)
+		require.NoError(t, err)
+
+		for _, size := range []int{buffer.Len() - 4, buffer.Len() - 10} {
+			_, err = tapedb.ReadWithCodec(bytes.NewReader(buffer.Bytes()[:size]), nil, test.NewChunkedBase())
+			assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+		}
+	})
+}
@@ -0,0 +1,55 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tapedb
+
+import "time"
+
+// Clock is the source of time for all time-dependent features. It can be replaced to control the
+// time in tests and simulations.
+type Clock interface {
+	Now() time.Time
+	Sleep(time.Duration)
+	AfterFunc(time.Duration, func()) Timer
+}
+
+// Timer is returned by Clock.AfterFunc.
+type Timer interface {
+	Stop() bool
+}
+
+// SystemClock is the clock of the operating system.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func (systemClock) AfterFunc(d time.Duration, fn func()) Timer {
+	return time.AfterFunc(d, fn)
+}
+
+// ClockOrSystem returns the provided clock or the system clock if it's nil.
+func ClockOrSystem(c Clock) Clock {
+	if c == nil {
+		return SystemClock
+	}
+	return c
+}
@@ -0,0 +1,119 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/simia-tech/tapedb/v2/generic"
+)
+
+var errInvalidChange = errors.New("invalid change")
+
+// applyChanges appends the provided change or the changes of the provided file to the log. The file
+// holds one JSON object per line in the form {"type": "...", "change": {...}}.
+func applyChanges(path string, key []byte, typeName, change, fromFile string) error {
+	changes := []*generic.Change{}
+	if fromFile != "" {
+		c, err := readChangesFile(fromFile)
+		if err != nil {
+			return err
+		}
+		changes = c
+	} else {
+		c, err := newGenericChange(typeName, json.RawMessage(change))
+		if err != nil {
+			return err
+		}
+		changes = append(changes, c)
+	}
+
+	db, err := openDatabase(path, key)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	for index, c := range changes {
+		if err := db.Apply(c); err != nil {
+			return fmt.Errorf("apply change %d: %w", index, err)
+		}
+	}
+	stdout.printf(applyRecord{Applied: len(changes), LogLen: db.LogLen()},
+		"applied %d changes, the log holds %d changes\n", len(changes), db.LogLen())
+
+	return db.Close()
+}
+
+func readChangesFile(path string) ([]*generic.Change, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	changes := []*generic.Change{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		request := struct {
+			Type   string          `json:"type"`
+			Change json.RawMessage `json:"change"`
+		}{}
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, errInvalidChange)
+		}
+
+		change, err := newGenericChange(request.Type, request.Change)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		changes = append(changes, change)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+
+	return changes, nil
+}
+
+// newGenericChange returns a change that is encoded like the changes of tapedb.WriteJSON.
+func newGenericChange(typeName string, data json.RawMessage) (*generic.Change, error) {
+	if typeName == "" {
+		return nil, fmt.Errorf("missing type: %w", errInvalidChange)
+	}
+
+	buffer := bytes.Buffer{}
+	if err := json.Compact(&buffer, data); err != nil {
+		return nil, fmt.Errorf("change of type %s: %w", typeName, errInvalidChange)
+	}
+	buffer.WriteByte('\n')
+
+	return &generic.Change{Type: typeName, Data: buffer.Bytes()}, nil
+}
+
+type applyRecord struct {
+	Applied int `json:"applied"`
+	LogLen  int `json:"log_len"`
+}
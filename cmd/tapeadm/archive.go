@@ -0,0 +1,159 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/simia-tech/tapedb/v2/io/file"
+)
+
+// exportArchive writes the database into a tar archive. Archives with a .tar.gz or .tgz extension
+// are compressed with gzip.
+func exportArchive(path, output string) error {
+	compressed, err := isCompressedArchive(output)
+	if err != nil {
+		return err
+	}
+
+	partialPath := output + file.DefaultLayout.PartialSuffix
+	f, err := os.OpenFile(partialPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(partialPath)
+
+	w := io.WriteCloser(nopWriteCloser{Writer: f})
+	if compressed {
+		w = gzip.NewWriter(f)
+	}
+	if err := file.ExportArchive(path, w); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(partialPath, output); err != nil {
+		return err
+	}
+	stdout.printf(exportRecord{Path: path, Archive: output}, "exported %s to %s\n", path, output)
+
+	return nil
+}
+
+type exportRecord struct {
+	Path    string `json:"path"`
+	Archive string `json:"archive"`
+}
+
+type importRecord struct {
+	Archive     string `json:"archive"`
+	Path        string `json:"path"`
+	Reencrypted bool   `json:"reencrypted"`
+}
+
+// importArchive extracts the archive into a new database directory. If a target password is
+// provided, the imported database is spliced into one that is encrypted with it, the source
+// password decrypts the archived one. An empty target password writes it unencrypted.
+func importArchive(archivePath, path, sourcePassword string, targetPassword *string) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r, err := decompressArchive(f)
+	if err != nil {
+		return err
+	}
+	if err := file.ImportArchive(r, path); err != nil {
+		return err
+	}
+	if targetPassword == nil {
+		stdout.printf(importRecord{Archive: archivePath, Path: path}, "imported %s to %s\n", archivePath, path)
+		return nil
+	}
+	if !stdout.json {
+		fmt.Printf("imported %s to %s\n", archivePath, path)
+	}
+
+	if _, err := spliceGeneric(path,
+		file.WithSourceKeyFunc(file.DeriveKeyFrom(sourcePassword, file.DefaultCryptSettings)),
+		file.WithTargetKeyFunc(file.DeriveKeyFrom(*targetPassword, file.DefaultCryptSettings))); err != nil {
+		// the database has just been created, so nothing is lost by removing it again
+		os.RemoveAll(path)
+		return fmt.Errorf("re-encrypt: %w", err)
+	}
+	stdout.printf(importRecord{Archive: archivePath, Path: path, Reencrypted: true}, "re-encrypted %s\n", path)
+
+	return nil
+}
+
+// defaultImportPath returns the directory an archive is imported to if none is given, which is the
+// name of the archive without its extension.
+func defaultImportPath(archivePath string) string {
+	name := filepath.Base(archivePath)
+	for _, extension := range []string{".tar.gz", ".tgz", ".tar"} {
+		if strings.HasSuffix(name, extension) {
+			return strings.TrimSuffix(name, extension)
+		}
+	}
+	return name + ".db"
+}
+
+func isCompressedArchive(name string) (bool, error) {
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return true, nil
+	case strings.HasSuffix(name, ".tar"):
+		return false, nil
+	case strings.HasSuffix(name, ".zst"):
+		return false, fmt.Errorf("archive %s: zstd isn't supported, use .tar.gz instead", name)
+	}
+	return false, fmt.Errorf("archive %s: extension must be .tar.gz, .tgz or .tar", name)
+}
+
+// decompressArchive detects gzip compressed archives by their magic bytes, so the extension of the
+// archive doesn't matter.
+func decompressArchive(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		return gzip.NewReader(br)
+	}
+	return br, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
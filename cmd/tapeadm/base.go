@@ -15,36 +15,95 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
-	"path/filepath"
 
+	"github.com/simia-tech/tapedb/v2"
+	"github.com/simia-tech/tapedb/v2/io/compress"
 	"github.com/simia-tech/tapedb/v2/io/crypto"
 	"github.com/simia-tech/tapedb/v2/io/file"
 )
 
 func baseShow(path string, key []byte) error {
-	baseF, err := os.OpenFile(filepath.Join(path, file.FileNameBase), os.O_RDONLY, 0)
-	if err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("open base %s: %w", path, err)
+	meta, err := file.ReadDatabaseMeta(path)
+	if err != nil {
+		return err
+	}
+
+	baseF, err := os.OpenFile(file.DefaultLayout.BasePath(path), os.O_RDONLY, 0)
+	if os.IsNotExist(err) {
+		// the database has not been spliced yet, so its base is empty
+		stdout.record(baseRecord{})
+		return nil
 	}
-	if baseF == nil {
-		return file.ErrMissing
+	if err != nil {
+		return fmt.Errorf("open base %s: %w", path, err)
 	}
 	defer baseF.Close()
 
-	baseR, err := crypto.WrapBlockReader(baseF, key)
+	c, err := crypto.ParseCipher(meta.Get(file.MetaHeaderCipher))
+	if err != nil {
+		return err
+	}
+
+	baseR, err := crypto.WrapBlockReaderWithCipher(baseF, c, key)
 	if err != nil {
 		return fmt.Errorf("new block reader: %w", err)
 	}
+	if compression := meta.Get(file.MetaFieldBaseCompression); compression != "" {
+		if baseR, err = compress.WrapBlockReader(baseR, compression); err != nil {
+			return fmt.Errorf("new block reader: %w", err)
+		}
+	}
 
 	data, err := ioutil.ReadAll(baseR)
 	if err != nil {
 		return fmt.Errorf("read base: %w", err)
 	}
 
-	fmt.Println(string(data))
+	if tapedb.IsChunkedBase(data) {
+		return baseShowChunks(data)
+	}
+
+	record := baseRecord{Base: rawJSON(data)}
+	if record.Base == nil {
+		record.Data = data
+	}
+	stdout.printf(record, "%s\n", data)
 
 	return nil
 }
+
+// baseShowChunks shows the chunks of a chunked base, one per line.
+func baseShowChunks(data []byte) error {
+	record := baseRecord{}
+	lines := [][]byte{}
+	encodedAsJSON := true
+	err := tapedb.ReadRawBaseChunks(bytes.NewReader(data), func(chunk []byte) error {
+		chunk = bytes.TrimSuffix(chunk, []byte("\n"))
+		lines = append(lines, chunk)
+		raw := rawJSON(chunk)
+		encodedAsJSON = encodedAsJSON && raw != nil
+		record.Chunks = append(record.Chunks, raw)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("read base chunks: %w", err)
+	}
+	if !encodedAsJSON {
+		record = baseRecord{Data: data}
+	}
+	stdout.printf(record, "%s\n", bytes.Join(lines, []byte("\n")))
+
+	return nil
+}
+
+// baseRecord is the JSON output of the base. A base that isn't encoded as JSON is written to data.
+type baseRecord struct {
+	Base   json.RawMessage   `json:"base,omitempty"`
+	Chunks []json.RawMessage `json:"chunks,omitempty"`
+	Data   []byte            `json:"data,omitempty"`
+}
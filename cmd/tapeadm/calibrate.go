@@ -0,0 +1,45 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"time"
+
+	"github.com/simia-tech/tapedb/v2/io/file"
+)
+
+// calibrateCryptSettings measures the argon2id key derivation on this machine and prints the crypt
+// settings, whose time makes it take about the target duration.
+func calibrateCryptSettings(target time.Duration, memory uint32, parallelism uint8) error {
+	s, err := file.CryptSettings{Memory: memory, Time: 1, Parallelism: parallelism}.Calibrate(target)
+	if err != nil {
+		return err
+	}
+	stdout.printf(calibrateRecord{
+		Settings:    s.String(),
+		Memory:      s.Memory,
+		Time:        s.Time,
+		Parallelism: s.Parallelism,
+	}, "%s\n", s)
+
+	return nil
+}
+
+type calibrateRecord struct {
+	Settings    string `json:"settings"`
+	Memory      uint32 `json:"memory"`
+	Time        uint32 `json:"time"`
+	Parallelism uint8  `json:"parallelism"`
+}
@@ -0,0 +1,36 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/simia-tech/tapedb/v2/generic"
+	"github.com/simia-tech/tapedb/v2/io/file"
+)
+
+// openDatabase opens the database with the generic model. Databases whose changes are encoded by a
+// codec are rejected, since the generic model only holds the JSON encoding.
+func openDatabase(path string, key []byte, opts ...file.OpenOption) (*file.Database[*generic.Base, *generic.State], error) {
+	meta, err := file.ReadDatabaseMeta(path)
+	if err != nil {
+		return nil, err
+	}
+	if codec := meta.Get(file.MetaFieldCodec); codec != "" {
+		return nil, fmt.Errorf("changes encoded by codec %s are not supported", codec)
+	}
+
+	return file.OpenDatabase[*generic.Base, *generic.State](generic.NewFactory(), path, append([]file.OpenOption{file.WithOpenKey(key)}, opts...)...)
+}
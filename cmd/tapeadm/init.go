@@ -0,0 +1,135 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"strings"
+
+	"github.com/simia-tech/tapedb/v2/generic"
+	"github.com/simia-tech/tapedb/v2/io/file"
+)
+
+const modulePath = "github.com/simia-tech/tapedb/v2"
+
+//go:embed starter/main.go starter/model.go
+var starterFS embed.FS
+
+type initRecord struct {
+	Path    string `json:"path"`
+	Starter bool   `json:"starter"`
+}
+
+// initDatabase creates an empty database in the provided directory. If a password is provided, the
+// database is encrypted with a key that is derived from it.
+func initDatabase(path, password, cryptSettings string) error {
+	s, err := file.ParseCryptSettings(cryptSettings)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return err
+	}
+
+	opts := []file.CreateOption{}
+	if password != "" {
+		opts = append(opts,
+			file.WithCreateKeyFunc(file.DeriveKeyFrom(password, file.DefaultCryptSettings)),
+			file.WithCryptSettings(s))
+	}
+
+	db, err := file.CreateDatabase[*generic.Base, *generic.State](generic.NewFactory(), path, opts...)
+	if err != nil {
+		return err
+	}
+	stdout.printf(initRecord{Path: path}, "created database in %s\n", path)
+
+	return db.Close()
+}
+
+// initStarter writes a runnable starter project with an example model into the provided
+// directory.
+func initStarter(path, module string) error {
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return err
+	}
+
+	goMod := fmt.Sprintf("module %s\n\ngo 1.21\n", module)
+	if version := moduleVersion(); version != "" {
+		goMod += fmt.Sprintf("\nrequire %s %s\n", modulePath, version)
+	}
+	if err := writeNewFile(filepath.Join(path, "go.mod"), []byte(goMod)); err != nil {
+		return err
+	}
+
+	for _, name := range []string{"main.go", "model.go"} {
+		data, err := starterFS.ReadFile("starter/" + name)
+		if err != nil {
+			return err
+		}
+		if err := writeNewFile(filepath.Join(path, name), stripLicenseHeader(data)); err != nil {
+			return err
+		}
+	}
+
+	stdout.printf(initRecord{Path: path, Starter: true},
+		"created starter project in %s, run 'go mod tidy' and 'go run . list' there\n", path)
+	return nil
+}
+
+var pseudoVersionPattern = regexp.MustCompile(`\d{14}-[0-9a-f]{12}$`)
+
+// moduleVersion returns the version of tapedb that tapeadm has been built with or an empty string
+// for development builds, whose pseudo versions can't be required.
+func moduleVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok || info.Main.Path != modulePath {
+		return ""
+	}
+	version := info.Main.Version
+	if !strings.HasPrefix(version, "v") || strings.Contains(version, "+") || pseudoVersionPattern.MatchString(version) {
+		return ""
+	}
+	return version
+}
+
+// writeNewFile fails if the file already exists, so an existing project isn't overwritten.
+func writeNewFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func stripLicenseHeader(data []byte) []byte {
+	content := string(data)
+	if !strings.HasPrefix(content, "// Copyright") {
+		return data
+	}
+	if index := strings.Index(content, "\n\n"); index >= 0 {
+		return []byte(content[index+2:])
+	}
+	return data
+}
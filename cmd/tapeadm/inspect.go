@@ -0,0 +1,152 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	tapeio "github.com/simia-tech/tapedb/v2/io"
+	"github.com/simia-tech/tapedb/v2/io/file"
+)
+
+// logInspect prints the offset, header, type, size and the first bytes of each log entry. Neither
+// a key nor the model is needed, so it can be used to debug framing problems.
+func logInspect(path string, dumpSize int) error {
+	if dumpSize < 0 {
+		return fmt.Errorf("number of dumped bytes must not be negative, got %d", dumpSize)
+	}
+
+	if exists, err := file.Exists(path); err != nil {
+		return err
+	} else if !exists {
+		return file.ErrMissing
+	}
+
+	layout := file.DefaultLayout
+	logPath := layout.LogPath(path)
+	logF, err := os.Open(logPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open log %s: %w", logPath, err)
+	}
+	defer logF.Close()
+
+	r := bufio.NewReader(logF)
+	offset := int64(0)
+	for index := 0; true; index++ {
+		header := make([]byte, layout.LogEntryHeaderSize)
+		n, err := io.ReadFull(r, header)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			stdout.printf(logInspectRecord{Offset: offset, Index: index, Header: hex.EncodeToString(header[:n]), Truncated: true},
+				"%08x  truncated header: % x\n", offset, header[:n])
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		et, value := layout.SplitLogEntryHeader(header)
+		size := int64(value)
+
+		if !stdout.json {
+			fmt.Printf("%08x  entry %d  header %x  type %x (%s)  size %d\n",
+				offset, index, header, uint32(et)>>28, logEntryTypeName(et), size)
+		}
+
+		dump := make([]byte, minInt64(size, int64(dumpSize)))
+		n, err = io.ReadFull(r, dump)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+			return err
+		}
+		printDump(dump[:n])
+
+		skipped, err := io.CopyN(io.Discard, r, size-int64(n))
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		truncated := int64(n)+skipped < size
+		if truncated && !stdout.json {
+			fmt.Printf("%08x  truncated entry: %d of %d bytes\n", offset, int64(n)+skipped, size)
+		}
+		stdout.record(logInspectRecord{
+			Offset:    offset,
+			Index:     index,
+			Header:    hex.EncodeToString(header),
+			Type:      logEntryTypeName(et),
+			Size:      size,
+			Dump:      hex.EncodeToString(dump[:n]),
+			Truncated: truncated,
+		})
+		if truncated {
+			break
+		}
+
+		offset += int64(layout.LogEntryHeaderSize) + size
+	}
+
+	return nil
+}
+
+// logInspectRecord is the JSON output of a log entry. A truncated entry ends the log.
+type logInspectRecord struct {
+	Offset    int64  `json:"offset"`
+	Index     int    `json:"index"`
+	Header    string `json:"header"`
+	Type      string `json:"type,omitempty"`
+	Size      int64  `json:"size"`
+	Dump      string `json:"dump,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+func logEntryTypeName(et tapeio.LogEntryType) string {
+	switch et {
+	case tapeio.LogEntryTypeBinary:
+		return "binary"
+	case tapeio.LogEntryTypeAESGCMEncrypted:
+		return "AES-GCM"
+	case tapeio.LogEntryTypeChaCha20Poly1305Encrypted:
+		return "ChaCha20-Poly1305"
+	case tapeio.LogEntryTypeBinaryCRC32:
+		return "binary with CRC-32C"
+	}
+	return "unknown"
+}
+
+func printDump(data []byte) {
+	if len(data) == 0 || stdout.json {
+		return
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(hex.Dump(data), "\n"), "\n") {
+		fmt.Printf("          %s\n", line)
+	}
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
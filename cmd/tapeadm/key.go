@@ -17,7 +17,6 @@ package main
 import (
 	"fmt"
 	"os"
-	"path/filepath"
 
 	"golang.org/x/crypto/ssh/terminal"
 
@@ -39,7 +38,7 @@ func fetchKey(path string) ([]byte, error) {
 	}
 
 	meta := file.Meta{}
-	metaPath := filepath.Join(path, file.FileNameMeta)
+	metaPath := file.DefaultLayout.MetaPath(path)
 	metaF, err := os.OpenFile(metaPath, os.O_RDONLY, 0)
 	if err == nil {
 		m, err := file.ReadMeta(metaF)
@@ -60,8 +59,13 @@ func fetchKey(path string) ([]byte, error) {
 }
 
 func promptPassword() (string, error) {
-	fmt.Printf("Password: ")
+	return promptPasswordWith("Password: ")
+}
+
+func promptPasswordWith(prompt string) (string, error) {
+	// the prompt is written to stderr, so it doesn't mix with the output of the command
+	fmt.Fprint(os.Stderr, prompt)
 	password, err := terminal.ReadPassword(int(os.Stdin.Fd()))
-	fmt.Println()
+	fmt.Fprintln(os.Stderr)
 	return string(password), err
 }
@@ -16,169 +16,123 @@ package main
 
 import (
 	"bytes"
-	"errors"
+	"encoding/json"
 	"fmt"
-	"io"
-	"os"
-	"path/filepath"
 
 	"github.com/fsnotify/fsnotify"
 
 	tapeio "github.com/simia-tech/tapedb/v2/io"
-	"github.com/simia-tech/tapedb/v2/io/crypto"
 	"github.com/simia-tech/tapedb/v2/io/file"
 )
 
 func logShow(path string, key []byte, follow bool) error {
-	logPath := filepath.Join(path, file.FileNameLog)
-
-	offset, err := logShowFile(logPath, key, 0)
-	if err != nil {
+	if exists, err := file.Exists(path); err != nil {
 		return err
+	} else if !exists {
+		return file.ErrMissing
 	}
 
-	if follow {
-		for {
-			offset, err = logWatchFile(logPath, key, offset)
-			if errors.Is(err, errFileRemove) {
-				fmt.Printf("log has been spliced\n")
-
-				offset, err = logFileOffset(logPath)
-				if err != nil {
-					return err
-				}
-				continue
+	session, err := file.NewTailSession(path,
+		file.WithTailKey(key),
+		file.WithTailSpliceFunc(func(missed int64) {
+			if stdout.json {
+				stdout.record(logSpliceRecord{Spliced: true, Missed: missed})
+				return
 			}
-			if err != nil {
-				return err
+			fmt.Printf("log has been spliced\n")
+			if missed > 0 {
+				fmt.Printf("%d changes have been rebased before they could be shown\n", missed)
 			}
-		}
-	}
-
-	return nil
-}
-
-var errFileRemove = errors.New("file removed")
-
-func logWatchFile(logPath string, key []byte, offset int64) (int64, error) {
-	watcher, err := fsnotify.NewWatcher()
+		}))
 	if err != nil {
-		return 0, err
-	}
-	defer watcher.Close()
-
-	errCh := make(chan error, 1)
-	go func() {
-		for {
-			select {
-			case event, ok := <-watcher.Events:
-				if !ok {
-					errCh <- nil
-					return
-				}
-				if event.Op&fsnotify.Remove == fsnotify.Remove {
-					errCh <- errFileRemove
-					return
-				}
-				if event.Op&fsnotify.Write != fsnotify.Write {
-					continue
-				}
-
-				offset, err = logShowFile(logPath, key, offset)
-				if err != nil {
-					errCh <- err
-					return
-				}
-
-			case err, ok := <-watcher.Errors:
-				if !ok {
-					errCh <- nil
-					return
-				}
-				errCh <- fmt.Errorf("watcher: %w", err)
-				return
-			}
-		}
-	}()
-
-	if err := watcher.Add(logPath); err != nil {
-		return 0, err
+		return err
 	}
 
-	if err := <-errCh; err != nil {
-		return 0, err
+	if _, err := session.Read(logShowEntry); err != nil {
+		return err
 	}
 
-	return offset, nil
-}
-
-func logShowFile(logPath string, key []byte, offset int64) (int64, error) {
-	logF, err := os.OpenFile(logPath, os.O_RDONLY, 0)
-	if err != nil && !os.IsNotExist(err) {
-		return 0, fmt.Errorf("open log %s: %w", logPath, err)
-	}
-	if logF == nil {
-		return 0, file.ErrMissing
+	if !follow {
+		return nil
 	}
-	defer logF.Close()
 
-	_, err = logF.Seek(offset, io.SeekStart)
+	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
-		return 0, err
+		return err
 	}
+	defer watcher.Close()
 
-	logR := tapeio.LogReader(nil)
-	if logF != nil {
-		logR = tapeio.NewLogReader(logF)
+	// the directory is watched, since a splice replaces the log file
+	if err := watcher.Add(path); err != nil {
+		return err
 	}
 
-	logR, err = crypto.WrapLogReader(logR, key)
-	if err != nil {
-		return 0, err
-	}
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+				continue
+			}
 
-	err = tapeio.ReadLogEntries(logR, func(entry tapeio.LogEntry) error {
-		switch entry.Type() {
-		case tapeio.LogEntryTypeBinary:
-			typeName, data, err := readChange(entry)
-			if err != nil {
+			if _, err := session.Read(logShowEntry); err != nil {
 				return err
 			}
 
-			fmt.Print(typeName)
-			fmt.Print(" ")
-			fmt.Print(string(bytes.TrimSuffix(data, []byte("\n"))))
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			return fmt.Errorf("watcher: %w", err)
+		}
+	}
+}
+
+func logShowEntry(entry tapeio.LogEntry) error {
+	switch entry.Type() {
+	case tapeio.LogEntryTypeBinary, tapeio.LogEntryTypeBinaryCRC32:
+		typeName, data, err := readChange(entry)
+		if err != nil {
+			return err
+		}
 
-		case tapeio.LogEntryTypeAESGCMEncrypted:
-			fmt.Printf("encrypted (AES-GCM)")
+		data = bytes.TrimSuffix(data, []byte("\n"))
 
+		record := logEntryRecord{Type: typeName, Change: rawJSON(data)}
+		if record.Change == nil {
+			record.Data = data
 		}
-		fmt.Println()
-		return nil
-	})
-	if err != nil {
-		return 0, err
-	}
+		stdout.printf(record, "%s %s\n", typeName, data)
 
-	offset, err = logF.Seek(0, io.SeekCurrent)
-	if err != nil {
-		return 0, err
-	}
+	case tapeio.LogEntryTypeAESGCMEncrypted:
+		stdout.printf(logEntryRecord{Encrypted: "AES-GCM"}, "encrypted (AES-GCM)\n")
 
-	return offset, nil
-}
+	case tapeio.LogEntryTypeChaCha20Poly1305Encrypted:
+		stdout.printf(logEntryRecord{Encrypted: "ChaCha20-Poly1305"}, "encrypted (ChaCha20-Poly1305)\n")
 
-func logFileOffset(logPath string) (int64, error) {
-	logF, err := os.OpenFile(logPath, os.O_RDONLY, 0)
-	if err != nil && !os.IsNotExist(err) {
-		return 0, fmt.Errorf("open log %s: %w", logPath, err)
-	}
-	if logF == nil {
-		return 0, file.ErrMissing
+	default:
+		stdout.printf(logEntryRecord{}, "\n")
 	}
-	defer logF.Close()
+	return nil
+}
+
+// logEntryRecord is the JSON output of a log entry. Changes that aren't encoded as JSON are written
+// to data. Encrypted entries only name their cipher. Records with a change can be applied again via
+// apply --from-file.
+type logEntryRecord struct {
+	Type      string          `json:"type,omitempty"`
+	Change    json.RawMessage `json:"change,omitempty"`
+	Data      []byte          `json:"data,omitempty"`
+	Encrypted string          `json:"encrypted,omitempty"`
+}
 
-	return logF.Seek(0, io.SeekEnd)
+// logSpliceRecord is the JSON output of a detected splice. Missed counts the changes that have been
+// rebased before they could be shown.
+type logSpliceRecord struct {
+	Spliced bool  `json:"spliced"`
+	Missed  int64 `json:"missed"`
 }
 
 func readChange(entry tapeio.LogEntry) (string, []byte, error) {
@@ -187,22 +141,5 @@ func readChange(entry tapeio.LogEntry) (string, []byte, error) {
 		return "", nil, fmt.Errorf("reader: %w", err)
 	}
 
-	sizeBytes := [1]byte{}
-	if _, err := io.ReadFull(r, sizeBytes[:]); err != nil {
-		return "", nil, fmt.Errorf("read type name size: %w", err)
-	}
-	size := sizeBytes[0]
-
-	typeNameBytes := make([]byte, size)
-	if _, err := io.ReadFull(r, typeNameBytes); err != nil {
-		return "", nil, fmt.Errorf("read type name of size %d: %w", size, err)
-	}
-	typeName := string(typeNameBytes)
-
-	data, err := io.ReadAll(r)
-	if err != nil {
-		return "", nil, fmt.Errorf("read all data: %w", err)
-	}
-
-	return typeName, data, nil
+	return tapeio.ReadRawChange(r)
 }
@@ -16,31 +16,123 @@ package main
 
 import (
 	"log"
+	"strings"
+	"time"
 
 	"github.com/alecthomas/kong"
+
+	"github.com/simia-tech/tapedb/v2/io/file"
 )
 
 var cli struct {
 	Path                  string `type:"existingdir" default:"." help:"Specifies the path of the database"`
 	DeriveKeyFromPassword bool   `short:"p" default:"false" help:"Prompts for a password and derives the encryption key from it"`
+	JSON                  bool   `name:"json" default:"false" help:"Writes the output as one JSON object per line, errors included"`
 	Log                   struct {
 		Show struct {
 			Follow bool `short:"f" help:"Follows the log and shows new entries immediately"`
 		} `cmd:"" help:"Shows the log"`
+		Inspect struct {
+			Bytes int `short:"n" default:"16" help:"Number of bytes that are dumped per entry"`
+		} `cmd:"" help:"Prints the raw framing of each log entry without decoding it"`
 	} `cmd:"" help:"Collection of log commands"`
 	Base struct {
 		Show struct{} `cmd:"" help:"Shows the base"`
 	} `cmd:"" help:"Collection of base commands"`
+	Apply struct {
+		Type     string `arg:"" optional:"" help:"Type name of the change"`
+		Change   string `arg:"" optional:"" help:"JSON encoded change"`
+		FromFile string `type:"existingfile" help:"Reads the changes from a file that holds one {\"type\": ..., \"change\": ...} object per line"`
+	} `cmd:"" help:"Appends changes to the log"`
+	Splice struct {
+		RebaseCount    int  `default:"0" help:"Number of changes that are rebased into the base"`
+		TargetPassword bool `default:"false" help:"Prompts for the password of the spliced database, an empty password writes it unencrypted"`
+		DryRun         bool `default:"false" help:"Computes the sizes of the spliced base and log without writing anything"`
+	} `cmd:"" help:"Rewrites the base and the log, optionally with a new encryption key"`
+	Payload struct {
+		List struct{} `cmd:"" help:"Lists the payloads with their size and content type"`
+		Cat  struct {
+			ID string `arg:"" help:"ID of the payload"`
+		} `cmd:"" help:"Writes the decrypted payload to stdout"`
+		Export struct {
+			Directory string   `arg:"" type:"path" help:"Directory the payloads are written to"`
+			IDs       []string `arg:"" optional:"" help:"IDs of the payloads, defaults to all payloads"`
+		} `cmd:"" help:"Writes the decrypted payloads to a directory"`
+		Import struct {
+			Files []string `arg:"" type:"existingfile" help:"Files that are written as payloads with their names as ids"`
+		} `cmd:"" help:"Writes files as payloads, unreferenced payloads are deleted by the next splice with the model of the database"`
+	} `cmd:"" help:"Collection of payload commands"`
+	Meta struct {
+		Show struct{} `cmd:"" help:"Shows the fields of the meta"`
+		Set  struct {
+			Key   string `arg:"" help:"Key of the field, it's canonicalized like Crypt-Settings"`
+			Value string `arg:"" help:"Value of the field"`
+		} `cmd:"" help:"Sets a field of the meta"`
+		Unset struct {
+			Key string `arg:"" help:"Key of the field"`
+		} `cmd:"" help:"Removes a field from the meta"`
+	} `cmd:"" help:"Collection of meta commands, the database must not be open while its meta is changed"`
+	Passwd struct {
+		CryptSettings string `default:"${crypt_settings}" help:"Settings the new key is derived with, a new salt is generated"`
+	} `cmd:"" help:"Re-encrypts the database with a new password, the database must not be open while its password is changed"`
+	Verify  struct{} `cmd:"" help:"Verifies the log, the base and the payloads and reports the first broken entry"`
+	Stats   struct{} `cmd:"" help:"Shows the size of the log, the base and the payloads and the encryption settings"`
+	Recover struct{} `cmd:"" help:"Completes or rolls back a splice that has been interrupted by a crash, the database must not be open while it's recovered"`
+	Init    struct {
+		Directory     string `arg:"" optional:"" type:"path" help:"Directory of the new database or project, defaults to the path"`
+		Example       bool   `help:"Creates a runnable starter project with an example model instead of a database"`
+		Module        string `default:"example.com/starter" help:"Module path of the starter project"`
+		CryptSettings string `default:"${crypt_settings}" help:"Settings the key is derived from the password with"`
+	} `cmd:"" help:"Creates an empty database or a starter project"`
+	Calibrate struct {
+		Duration    time.Duration `default:"500ms" help:"Target duration of a key derivation"`
+		Memory      uint32        `default:"65536" help:"Memory of the key derivation in KiB"`
+		Parallelism uint8         `default:"4" help:"Number of threads of the key derivation"`
+	} `cmd:"" help:"Measures the key derivation and prints crypt settings for the target duration"`
+	Export struct {
+		Output string `short:"o" required:"" type:"path" help:"Path of the archive, a .tar.gz or .tgz extension compresses it with gzip"`
+	} `cmd:"" help:"Writes the database into a tar archive"`
+	Import struct {
+		Archive        string `arg:"" type:"existingfile" help:"Archive written by the export command"`
+		Directory      string `arg:"" optional:"" type:"path" help:"Directory of the new database, defaults to the name of the archive"`
+		TargetPassword bool   `default:"false" help:"Prompts for the password of the imported database, an empty password writes it unencrypted"`
+	} `cmd:"" help:"Creates a database from a tar archive, optionally encrypted with a new password"`
 }
 
 func main() {
-	ctx := kong.Parse(&cli)
+	ctx := kong.Parse(&cli, kong.Vars{"crypt_settings": file.DefaultCryptSettings})
+	stdout.json = cli.JSON
+
+	if strings.HasPrefix(ctx.Command(), "init") {
+		if err := runInit(); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	if ctx.Command() == "calibrate" {
+		if err := calibrateCryptSettings(cli.Calibrate.Duration, cli.Calibrate.Memory, cli.Calibrate.Parallelism); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	if ctx.Command() == "recover" {
+		if err := recoverDatabase(cli.Path); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	if strings.HasPrefix(ctx.Command(), "import") {
+		if err := runImport(); err != nil {
+			fatal(err)
+		}
+		return
+	}
 
 	key := []byte(nil)
 	if cli.DeriveKeyFromPassword {
 		k, err := fetchKey(cli.Path)
 		if err != nil {
-			log.Fatal(err)
+			fatal(err)
 		}
 		key = k
 	}
@@ -48,13 +140,124 @@ func main() {
 	switch ctx.Command() {
 	case "log show":
 		if err := logShow(cli.Path, key, cli.Log.Show.Follow); err != nil {
-			log.Fatal(err)
+			fatal(err)
+		}
+	case "log inspect":
+		if err := logInspect(cli.Path, cli.Log.Inspect.Bytes); err != nil {
+			fatal(err)
 		}
 	case "base show":
 		if err := baseShow(cli.Path, key); err != nil {
-			log.Fatal(err)
+			fatal(err)
+		}
+	case "apply", "apply <type>", "apply <type> <change>":
+		if err := applyChanges(cli.Path, key, cli.Apply.Type, cli.Apply.Change, cli.Apply.FromFile); err != nil {
+			fatal(err)
+		}
+	case "splice":
+		if err := spliceDatabase(cli.Path, key, cli.Splice.RebaseCount, cli.Splice.TargetPassword, cli.Splice.DryRun); err != nil {
+			fatal(err)
+		}
+	case "payload list":
+		if err := payloadList(cli.Path, key); err != nil {
+			fatal(err)
+		}
+	case "payload cat <id>":
+		if err := payloadCat(cli.Path, key, cli.Payload.Cat.ID); err != nil {
+			fatal(err)
+		}
+	case "payload export <directory>", "payload export <directory> <ids>":
+		if err := payloadExport(cli.Path, key, cli.Payload.Export.Directory, cli.Payload.Export.IDs); err != nil {
+			fatal(err)
+		}
+	case "payload import <files>":
+		if err := payloadImport(cli.Path, key, cli.Payload.Import.Files); err != nil {
+			fatal(err)
+		}
+	case "meta show":
+		if err := metaShow(cli.Path); err != nil {
+			fatal(err)
+		}
+	case "meta set <key> <value>":
+		if err := metaSet(cli.Path, cli.Meta.Set.Key, cli.Meta.Set.Value); err != nil {
+			fatal(err)
+		}
+	case "meta unset <key>":
+		if err := metaUnset(cli.Path, cli.Meta.Unset.Key); err != nil {
+			fatal(err)
+		}
+	case "passwd":
+		if err := changePassword(cli.Path, key, cli.Passwd.CryptSettings); err != nil {
+			fatal(err)
+		}
+	case "verify":
+		if err := verifyDatabase(cli.Path, key); err != nil {
+			fatal(err)
+		}
+	case "stats":
+		if err := showStats(cli.Path, key); err != nil {
+			fatal(err)
+		}
+	case "export":
+		if err := exportArchive(cli.Path, cli.Export.Output); err != nil {
+			fatal(err)
 		}
 	default:
 		log.Fatal(ctx.Command())
 	}
 }
+
+// fatal reports the error and exits. In JSON mode, the error is written to stdout as well, so
+// scripts don't have to parse stderr.
+func fatal(err error) {
+	stdout.record(errorRecord{Error: err.Error()})
+	log.Fatal(err)
+}
+
+func runInit() error {
+	path := cli.Init.Directory
+	if path == "" {
+		path = cli.Path
+	}
+	if cli.Init.Example {
+		return initStarter(path, cli.Init.Module)
+	}
+
+	// the key can't be derived before the database exists, since its crypt settings are stored in
+	// the new meta
+	password := ""
+	if cli.DeriveKeyFromPassword {
+		p, err := promptPassword()
+		if err != nil {
+			return err
+		}
+		password = p
+	}
+	return initDatabase(path, password, cli.Init.CryptSettings)
+}
+
+func runImport() error {
+	path := cli.Import.Directory
+	if path == "" {
+		path = defaultImportPath(cli.Import.Archive)
+	}
+	if !cli.Import.TargetPassword {
+		return importArchive(cli.Import.Archive, path, "", nil)
+	}
+
+	// the passwords are asked for before the import, but the keys can only be derived afterwards,
+	// since the crypt settings are stored in the imported meta
+	sourcePassword := ""
+	if cli.DeriveKeyFromPassword {
+		p, err := promptPassword()
+		if err != nil {
+			return err
+		}
+		sourcePassword = p
+	}
+	targetPassword, err := promptPasswordWith("Target password: ")
+	if err != nil {
+		return err
+	}
+	return importArchive(cli.Import.Archive, path, sourcePassword, &targetPassword)
+}
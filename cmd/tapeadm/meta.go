@@ -0,0 +1,106 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+	"strings"
+
+	"github.com/simia-tech/tapedb/v2/io/file"
+)
+
+var errInvalidMeta = errors.New("invalid meta")
+
+// metaShow prints the fields of the meta in the format of the meta file.
+func metaShow(path string) error {
+	meta, err := file.ReadDatabaseMeta(path)
+	if err != nil {
+		return err
+	}
+
+	meta.Range(func(key, value string) bool {
+		stdout.printf(metaRecord{Key: key, Value: value}, "%s: %s\n", key, value)
+		return true
+	})
+	return nil
+}
+
+// metaSet sets the field of the meta to the provided value and rewrites the meta file atomically.
+// The key is canonicalized like all keys of the meta, so "crypt-settings" sets Crypt-Settings.
+func metaSet(path, key, value string) error {
+	if err := validateMetaKey(key); err != nil {
+		return err
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("value of %s contains a line break: %w", key, errInvalidMeta)
+	}
+	key = textproto.CanonicalMIMEHeaderKey(key)
+
+	meta, err := file.ReadDatabaseMeta(path)
+	if err != nil {
+		return err
+	}
+	meta.Set(key, value)
+	if err := file.WriteMetaFile(file.DefaultLayout.MetaPath(path), meta); err != nil {
+		return err
+	}
+	stdout.printf(metaRecord{Key: key, Value: value}, "set %s: %s\n", key, value)
+
+	return nil
+}
+
+// metaUnset removes the field from the meta and rewrites the meta file atomically.
+func metaUnset(path, key string) error {
+	if err := validateMetaKey(key); err != nil {
+		return err
+	}
+	key = textproto.CanonicalMIMEHeaderKey(key)
+
+	meta, err := file.ReadDatabaseMeta(path)
+	if err != nil {
+		return err
+	}
+	if !meta.Has(key) {
+		return fmt.Errorf("meta field %s: %w", key, file.ErrMissing)
+	}
+	meta.Del(key)
+	if err := file.WriteMetaFile(file.DefaultLayout.MetaPath(path), meta); err != nil {
+		return err
+	}
+	stdout.printf(metaRecord{Key: key}, "unset %s\n", key)
+
+	return nil
+}
+
+type metaRecord struct {
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+}
+
+// validateMetaKey only accepts the characters of a MIME header key, since other keys would
+// corrupt the meta file.
+func validateMetaKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("empty key: %w", errInvalidMeta)
+	}
+	for _, r := range key {
+		if r <= ' ' || r >= 0x7f || r == ':' {
+			return fmt.Errorf("key %q contains %q: %w", key, r, errInvalidMeta)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// output writes the results of the commands. By default, they are written as text. With the global
+// --json flag, each result is written as one JSON object per line instead.
+type output struct {
+	w    io.Writer
+	json bool
+}
+
+var stdout = &output{w: os.Stdout}
+
+// printf writes the record as a JSON line or the formatted text.
+func (o *output) printf(record any, format string, args ...any) {
+	if o.json {
+		o.record(record)
+		return
+	}
+	fmt.Fprintf(o.w, format, args...)
+}
+
+// record writes the record as a JSON line. In text mode, nothing is written.
+func (o *output) record(record any) {
+	if !o.json {
+		return
+	}
+	if err := json.NewEncoder(o.w).Encode(record); err != nil {
+		fmt.Fprintf(os.Stderr, "encode output: %v\n", err)
+	}
+}
+
+// rawJSON returns the data as raw JSON if it's valid. Otherwise, nil is returned, so the data has
+// to be written in another field.
+func rawJSON(data []byte) json.RawMessage {
+	if !json.Valid(data) {
+		return nil
+	}
+	return json.RawMessage(data)
+}
+
+type errorRecord struct {
+	Error string `json:"error"`
+}
@@ -0,0 +1,52 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+
+	"github.com/simia-tech/tapedb/v2/io/file"
+)
+
+// changePassword re-encrypts the database with a key that is derived from a new password. The
+// key of the -p flag decrypts it, without that flag a plain database gets encrypted.
+func changePassword(path string, key []byte, cryptSettings string) error {
+	password, err := promptPasswordWith("New password: ")
+	if err != nil {
+		return err
+	}
+	repeated, err := promptPasswordWith("Repeat new password: ")
+	if err != nil {
+		return err
+	}
+	if password != repeated {
+		return errors.New("passwords don't match")
+	}
+
+	oldKeyFunc := file.KeyFunc(nil)
+	if key != nil {
+		oldKeyFunc = file.StaticKeyFunc(key)
+	}
+	if err := file.ChangePassword(path, oldKeyFunc, password, file.WithPasswordCryptSettings(cryptSettings)); err != nil {
+		return err
+	}
+	stdout.printf(passwdRecord{Path: path}, "changed the password of %s\n", path)
+
+	return nil
+}
+
+type passwdRecord struct {
+	Path string `json:"path"`
+}
@@ -0,0 +1,153 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/simia-tech/tapedb/v2/io/file"
+)
+
+func payloadList(path string, key []byte) error {
+	db, err := openDatabase(path, key, file.WithReadOnly())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ids, err := db.PayloadIDs()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		info, err := db.PayloadInfo(id)
+		if err != nil {
+			return fmt.Errorf("read info of payload %s: %w", id, err)
+		}
+		stdout.printf(payloadRecord{ID: id, Size: info.Size, ContentType: info.ContentType},
+			"%s %d %s\n", id, info.Size, info.ContentType)
+	}
+
+	return nil
+}
+
+func payloadCat(path string, key []byte, id string) error {
+	db, err := openDatabase(path, key, file.WithReadOnly())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	r, err := db.OpenPayload(id)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	_, err = io.Copy(os.Stdout, r)
+	return err
+}
+
+// payloadExport writes the decrypted payloads with the provided ids or all payloads into the target
+// directory. Each payload is written to a file that is named like its id.
+func payloadExport(path string, key []byte, targetPath string, ids []string) error {
+	db, err := openDatabase(path, key, file.WithReadOnly())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if len(ids) == 0 {
+		if ids, err = db.PayloadIDs(); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(targetPath, 0o755); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := exportPayload(db.OpenPayload, filepath.Join(targetPath, id), id); err != nil {
+			return fmt.Errorf("export payload %s: %w", id, err)
+		}
+	}
+	stdout.printf(payloadExportRecord{Exported: len(ids)}, "exported %d payloads\n", len(ids))
+
+	return nil
+}
+
+func exportPayload(openFn func(string) (io.ReadSeekCloser, error), targetPath, id string) error {
+	r, err := openFn(id)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	f, err := os.OpenFile(targetPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// payloadImport writes the provided files as payloads. The id of each payload is the name of its
+// file. Payloads that are not referenced by a change are deleted by the next splice.
+func payloadImport(path string, key []byte, paths []string) error {
+	db, err := openDatabase(path, key)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	for _, p := range paths {
+		if err := importPayload(db.WritePayload, p); err != nil {
+			return fmt.Errorf("import payload %s: %w", p, err)
+		}
+	}
+	stdout.printf(payloadImportRecord{Imported: len(paths)}, "imported %d payloads\n", len(paths))
+
+	return db.Close()
+}
+
+func importPayload(writeFn func(file.Payload) error, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return writeFn(file.NewPayload(filepath.Base(path), f))
+}
+
+type payloadRecord struct {
+	ID          string `json:"id"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type,omitempty"`
+}
+
+type payloadExportRecord struct {
+	Exported int `json:"exported"`
+}
+
+type payloadImportRecord struct {
+	Imported int `json:"imported"`
+}
@@ -0,0 +1,49 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/simia-tech/tapedb/v2/io/file"
+)
+
+type recoverRecord struct {
+	Path         string `json:"path"`
+	Action       string `json:"action"`
+	FilesMoved   int    `json:"files_moved"`
+	FilesRemoved int    `json:"files_removed"`
+}
+
+// recoverDatabase completes or rolls back an interrupted splice. No key is needed, since the files
+// are only moved or removed.
+func recoverDatabase(path string) error {
+	result, err := file.RecoverDatabase(path)
+	if err != nil {
+		return err
+	}
+
+	record := recoverRecord{
+		Path:         path,
+		Action:       result.Action.String(),
+		FilesMoved:   result.FilesMoved,
+		FilesRemoved: result.FilesRemoved,
+	}
+	if result.Action == file.RecoverNone {
+		stdout.printf(record, "nothing to recover in %s\n", path)
+		return nil
+	}
+	stdout.printf(record, "recovery of %s %s: %d files moved, %d files removed\n",
+		path, result.Action, result.FilesMoved, result.FilesRemoved)
+	return nil
+}
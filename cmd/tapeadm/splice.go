@@ -0,0 +1,92 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/simia-tech/tapedb/v2/generic"
+	"github.com/simia-tech/tapedb/v2/io/file"
+)
+
+// spliceDatabase rewrites the base and the log of the database. The changes are only copied, since the
+// generic model can't rebase them, but the target password allows to encrypt a plain database, to decrypt
+// an encrypted one or to change its password. A dry run only reports the sizes the splice would result in.
+func spliceDatabase(path string, key []byte, rebaseCount int, targetPassword, dryRun bool) error {
+	options := []file.SpliceOption{
+		file.WithSourceKey(key),
+		file.WithTargetKey(key),
+		file.WithRebaseChangeCount(rebaseCount),
+	}
+	if targetPassword {
+		password, err := promptPasswordWith("Target password: ")
+		if err != nil {
+			return err
+		}
+		options = append(options, file.WithTargetKeyFunc(file.DeriveKeyFrom(password, file.DefaultCryptSettings)))
+	}
+	if dryRun {
+		options = append(options, file.WithSpliceDryRun())
+	}
+
+	result, err := spliceGeneric(path, options...)
+	if err != nil {
+		return err
+	}
+	verb := "spliced"
+	if dryRun {
+		verb = "would splice"
+	}
+	stdout.printf(spliceRecord{
+		EntriesRead:    result.EntriesRead,
+		EntriesRebased: result.EntriesRebased,
+		EntriesCopied:  result.EntriesCopied,
+		BaseSize:       result.BaseSize,
+		LogSize:        result.LogSize,
+		DryRun:         dryRun,
+	}, "%s %d entries (%d rebased, %d copied), base %d bytes, log %d bytes\n",
+		verb, result.EntriesRead, result.EntriesRebased, result.EntriesCopied, result.BaseSize, result.LogSize)
+
+	return nil
+}
+
+// spliceGeneric splices the database with the generic model. Since that model doesn't know which
+// payloads are referenced, all of them are kept.
+func spliceGeneric(path string, options ...file.SpliceOption) (file.SpliceResult, error) {
+	meta, err := file.ReadDatabaseMeta(path)
+	if err != nil {
+		return file.SpliceResult{}, err
+	}
+	if codec := meta.Get(file.MetaFieldCodec); codec != "" {
+		return file.SpliceResult{}, fmt.Errorf("changes encoded by codec %s can't be spliced", codec)
+	}
+
+	result, err := file.SpliceDatabase[*generic.Base, *generic.State](generic.NewFactory(), path,
+		append(options, file.WithSpliceKeepPayloads())...)
+	if errors.Is(err, generic.ErrNotSupported) {
+		return file.SpliceResult{}, fmt.Errorf("changes can't be rebased without the model of the database: %w", err)
+	}
+	return result, err
+}
+
+type spliceRecord struct {
+	EntriesRead    int   `json:"entries_read"`
+	EntriesRebased int   `json:"entries_rebased"`
+	EntriesCopied  int   `json:"entries_copied"`
+	BaseSize       int64 `json:"base_size"`
+	LogSize        int64 `json:"log_size"`
+	DryRun         bool  `json:"dry_run,omitempty"`
+}
@@ -0,0 +1,134 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command starter is a runnable example of a tapedb model. It keeps a counter and a list of items
+// that can have a file attached. Run it with
+//
+//	go run . add <id> <name> [file]
+//	go run . remove <id>
+//	go run . inc <value>
+//	go run . list
+//	go run . splice
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/simia-tech/tapedb/v2/io/file"
+)
+
+const databasePath = "data"
+
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatal("usage: starter add|remove|inc|list|splice")
+	}
+	if err := run(os.Args[1], os.Args[2:]); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(command string, args []string) error {
+	if command == "splice" {
+		result, err := file.SpliceDatabase[*Base, *State](&Factory{}, databasePath, file.WithRebaseChangeCount(math.MaxInt))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("rebased %d changes, deleted %d payloads\n", result.EntriesRebased, result.PayloadsDeleted)
+		return nil
+	}
+
+	db, err := openOrCreateDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch command {
+	case "add":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: starter add <id> <name> [file]")
+		}
+		change := &ChangeItemAdd{ID: args[0], Name: args[1]}
+		if len(args) < 3 {
+			return db.Apply(change)
+		}
+		f, err := os.Open(args[2])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		change.PayloadID = args[0] + filepath.Ext(args[2])
+		return db.Apply(change, file.NewPayload(change.PayloadID, f))
+
+	case "remove":
+		if len(args) < 1 {
+			return fmt.Errorf("usage: starter remove <id>")
+		}
+		state := db.State()
+		state.ReadLocker.Lock()
+		item := state.Items[args[0]]
+		state.ReadLocker.Unlock()
+		return db.Apply(&ChangeItemRemove{ID: args[0], PayloadID: item.PayloadID})
+
+	case "inc":
+		if len(args) < 1 {
+			return fmt.Errorf("usage: starter inc <value>")
+		}
+		value, err := strconv.Atoi(args[0])
+		if err != nil {
+			return err
+		}
+		return db.Apply(&ChangeCounterInc{Value: value})
+
+	case "list":
+		state := db.State()
+		state.ReadLocker.Lock()
+		defer state.ReadLocker.Unlock()
+
+		fmt.Printf("counter: %d\n", state.Counter)
+		ids := make([]string, 0, len(state.Items))
+		for id := range state.Items {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			item := state.Items[id]
+			fmt.Printf("%s %s %s\n", id, item.Name, item.PayloadID)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown command %s", command)
+}
+
+func openOrCreateDatabase() (*file.Database[*Base, *State], error) {
+	exists, err := file.Exists(databasePath)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		if err := os.MkdirAll(databasePath, 0o755); err != nil {
+			return nil, err
+		}
+		return file.CreateDatabase[*Base, *State](&Factory{}, databasePath)
+	}
+	return file.OpenDatabase[*Base, *State](&Factory{}, databasePath)
+}
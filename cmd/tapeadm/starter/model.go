@@ -0,0 +1,189 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/simia-tech/tapedb/v2"
+)
+
+// Base is the snapshot of the model that is written when the database is spliced.
+type Base struct {
+	tapedb.Payloads
+
+	Counter int             `json:"counter"`
+	Items   map[string]Item `json:"items,omitempty"`
+}
+
+// Item can reference a payload that holds its attachment.
+type Item struct {
+	Name      string `json:"name"`
+	PayloadID string `json:"payloadID,omitempty"`
+}
+
+func (b *Base) ReadFrom(r io.Reader) (int64, error) {
+	return tapedb.ReadJSON(r, b)
+}
+
+func (b *Base) WriteTo(w io.Writer) (int64, error) {
+	return tapedb.WriteJSON(w, b)
+}
+
+func (b *Base) Apply(c tapedb.Change) error {
+	b.ApplyPayloadChange(c)
+	b.Counter, b.Items = apply(c, b.Counter, b.Items)
+	return nil
+}
+
+// State is the in-memory view of the model. Readers have to hold the ReadLocker.
+type State struct {
+	Counter    int
+	Items      map[string]Item
+	ReadLocker sync.Locker
+}
+
+func (s *State) Apply(c tapedb.Change) error {
+	s.Counter, s.Items = apply(c, s.Counter, s.Items)
+	return nil
+}
+
+func apply(c tapedb.Change, counter int, items map[string]Item) (int, map[string]Item) {
+	switch t := c.(type) {
+	case *ChangeCounterInc:
+		counter += t.Value
+	case *ChangeItemAdd:
+		if items == nil {
+			items = map[string]Item{}
+		}
+		items[t.ID] = Item{Name: t.Name, PayloadID: t.PayloadID}
+	case *ChangeItemRemove:
+		delete(items, t.ID)
+	}
+	return counter, items
+}
+
+// Factory creates the base, the state and the changes of the model.
+type Factory struct{}
+
+func (f *Factory) NewBase() *Base {
+	return &Base{}
+}
+
+func (f *Factory) NewState(base *Base, readLocker sync.Locker) *State {
+	items := make(map[string]Item, len(base.Items))
+	for id, item := range base.Items {
+		items[id] = item
+	}
+	return &State{Counter: base.Counter, Items: items, ReadLocker: readLocker}
+}
+
+func (f *Factory) NewChange(typeName string) (tapedb.Change, error) {
+	switch typeName {
+	case "counter-inc":
+		return &ChangeCounterInc{}, nil
+	case "item-add":
+		return &ChangeItemAdd{}, nil
+	case "item-remove":
+		return &ChangeItemRemove{}, nil
+	}
+	if change, ok := tapedb.NewPayloadChange(typeName); ok {
+		return change, nil
+	}
+	return nil, fmt.Errorf("change type [%s]: %w", typeName, tapedb.ErrUnknownChangeType)
+}
+
+type ChangeCounterInc struct {
+	Value int `json:"value"`
+}
+
+func (c *ChangeCounterInc) TypeName() string {
+	return "counter-inc"
+}
+
+func (c *ChangeCounterInc) ReadFrom(r io.Reader) (int64, error) {
+	return tapedb.ReadJSON(r, c)
+}
+
+func (c *ChangeCounterInc) WriteTo(w io.Writer) (int64, error) {
+	return tapedb.WriteJSON(w, c)
+}
+
+// ChangeItemAdd adds an item. Its payload has to be applied together with the change.
+type ChangeItemAdd struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	PayloadID string `json:"payloadID,omitempty"`
+}
+
+func (c *ChangeItemAdd) TypeName() string {
+	return "item-add"
+}
+
+func (c *ChangeItemAdd) ReadFrom(r io.Reader) (int64, error) {
+	return tapedb.ReadJSON(r, c)
+}
+
+func (c *ChangeItemAdd) WriteTo(w io.Writer) (int64, error) {
+	return tapedb.WriteJSON(w, c)
+}
+
+func (c *ChangeItemAdd) PayloadIDs() []string {
+	if c.PayloadID == "" {
+		return []string{}
+	}
+	return []string{c.PayloadID}
+}
+
+func (c *ChangeItemAdd) Validate(s *State) error {
+	if _, ok := s.Items[c.ID]; ok {
+		return fmt.Errorf("item %s already exists", c.ID)
+	}
+	return nil
+}
+
+// ChangeItemRemove removes an item and detaches its payload, so it's deleted by the next splice.
+type ChangeItemRemove struct {
+	ID        string `json:"id"`
+	PayloadID string `json:"payloadID,omitempty"`
+}
+
+func (c *ChangeItemRemove) TypeName() string {
+	return "item-remove"
+}
+
+func (c *ChangeItemRemove) ReadFrom(r io.Reader) (int64, error) {
+	return tapedb.ReadJSON(r, c)
+}
+
+func (c *ChangeItemRemove) WriteTo(w io.Writer) (int64, error) {
+	return tapedb.WriteJSON(w, c)
+}
+
+func (c *ChangeItemRemove) DetachedPayloadIDs() []string {
+	if c.PayloadID == "" {
+		return []string{}
+	}
+	return []string{c.PayloadID}
+}
+
+func (c *ChangeItemRemove) Validate(s *State) error {
+	if _, ok := s.Items[c.ID]; !ok {
+		return fmt.Errorf("item %s doesn't exist", c.ID)
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	tapeio "github.com/simia-tech/tapedb/v2/io"
+	"github.com/simia-tech/tapedb/v2/io/crypto"
+	"github.com/simia-tech/tapedb/v2/io/file"
+)
+
+type stats struct {
+	ID               string
+	FormatVersion    uint64
+	LogLen           int
+	LogSize          int64
+	EncryptedEntries int
+	ChangeTypes      map[string]int
+	BaseSize         int64
+	Payloads         map[string]int64
+	DirectorySize    int64
+	Cipher           crypto.Cipher
+	CryptSettings    string
+	Codec            string
+}
+
+// statsRecord is the JSON output of the stats. The cipher is empty, if the database isn't
+// encrypted.
+type statsRecord struct {
+	ID               string           `json:"id,omitempty"`
+	FormatVersion    uint64           `json:"format_version"`
+	LogLen           int              `json:"log_len"`
+	LogSize          int64            `json:"log_size"`
+	BaseSize         int64            `json:"base_size"`
+	DirectorySize    int64            `json:"directory_size"`
+	EncryptedEntries int              `json:"encrypted_entries"`
+	Cipher           crypto.Cipher    `json:"cipher,omitempty"`
+	CryptSettings    string           `json:"crypt_settings,omitempty"`
+	Codec            string           `json:"codec,omitempty"`
+	ChangeTypes      map[string]int   `json:"change_types"`
+	Payloads         map[string]int64 `json:"payloads"`
+}
+
+func showStats(path string, key []byte) error {
+	s, err := readStats(path, key)
+	if err != nil {
+		return err
+	}
+
+	if stdout.json {
+		record := statsRecord{
+			ID:               s.ID,
+			FormatVersion:    s.FormatVersion,
+			LogLen:           s.LogLen,
+			LogSize:          s.LogSize,
+			BaseSize:         s.BaseSize,
+			DirectorySize:    s.DirectorySize,
+			EncryptedEntries: s.EncryptedEntries,
+			CryptSettings:    s.CryptSettings,
+			Codec:            s.Codec,
+			ChangeTypes:      s.ChangeTypes,
+			Payloads:         s.Payloads,
+		}
+		if s.EncryptedEntries > 0 || s.CryptSettings != "" {
+			record.Cipher = s.Cipher
+		}
+		stdout.record(record)
+		return nil
+	}
+
+	if s.ID != "" {
+		fmt.Printf("id: %s\n", s.ID)
+	}
+	fmt.Printf("format version: %d\n", s.FormatVersion)
+	fmt.Printf("log length: %d\n", s.LogLen)
+	fmt.Printf("log size: %d\n", s.LogSize)
+	fmt.Printf("base size: %d\n", s.BaseSize)
+	fmt.Printf("directory size: %d\n", s.DirectorySize)
+	fmt.Printf("encrypted entries: %d\n", s.EncryptedEntries)
+	if s.EncryptedEntries > 0 || s.CryptSettings != "" {
+		fmt.Printf("encryption: %s\n", s.Cipher)
+	} else {
+		fmt.Printf("encryption: none\n")
+	}
+	if s.CryptSettings != "" {
+		fmt.Printf("crypt settings: %s\n", s.CryptSettings)
+	}
+	if s.Codec != "" {
+		fmt.Printf("codec: %s\n", s.Codec)
+	}
+
+	fmt.Printf("change types:\n")
+	for _, typeName := range sortedKeys(s.ChangeTypes) {
+		fmt.Printf("  %s %d\n", typeName, s.ChangeTypes[typeName])
+	}
+
+	total := int64(0)
+	for _, size := range s.Payloads {
+		total += size
+	}
+	fmt.Printf("payloads: %d (%d bytes)\n", len(s.Payloads), total)
+	for _, id := range sortedKeys(s.Payloads) {
+		fmt.Printf("  %s %d\n", id, s.Payloads[id])
+	}
+
+	return nil
+}
+
+func readStats(path string, key []byte) (stats, error) {
+	meta, err := file.ReadDatabaseMeta(path)
+	if err != nil {
+		return stats{}, err
+	}
+	c, err := crypto.ParseCipher(meta.Get(file.MetaHeaderCipher))
+	if err != nil {
+		return stats{}, err
+	}
+
+	s := stats{
+		ID:            meta.Get(file.MetaFieldDatabaseID),
+		FormatVersion: meta.GetUInt64(file.MetaFieldFormatVersion, 1),
+		ChangeTypes:   map[string]int{},
+		Payloads:      map[string]int64{},
+		Cipher:        c,
+		CryptSettings: meta.Get(file.MetaHeaderCryptSettings),
+		Codec:         meta.Get(file.MetaFieldCodec),
+	}
+
+	if s.LogSize, err = fileSize(file.DefaultLayout.LogPath(path)); err != nil {
+		return stats{}, err
+	}
+	if s.BaseSize, err = fileSize(file.DefaultLayout.BasePath(path)); err != nil {
+		return stats{}, err
+	}
+	if s.DirectorySize, err = directorySize(path); err != nil {
+		return stats{}, err
+	}
+
+	session, err := file.NewTailSession(path, file.WithTailKey(key))
+	if err != nil {
+		return stats{}, err
+	}
+	if s.LogLen, err = session.Read(func(entry tapeio.LogEntry) error {
+		switch entry.Type() {
+		case tapeio.LogEntryTypeAESGCMEncrypted, tapeio.LogEntryTypeChaCha20Poly1305Encrypted:
+			s.EncryptedEntries++
+			return nil
+		}
+
+		typeName, _, err := readChange(entry)
+		if err != nil {
+			return err
+		}
+		s.ChangeTypes[typeName]++
+		return nil
+	}); err != nil {
+		return stats{}, err
+	}
+
+	// the plaintext sizes of the payloads are only available if the database can be opened
+	if s.EncryptedEntries > 0 || s.Codec != "" {
+		return s, nil
+	}
+	db, err := openDatabase(path, key, file.WithReadOnly())
+	if err != nil {
+		return stats{}, err
+	}
+	defer db.Close()
+
+	ids, err := db.PayloadIDs()
+	if err != nil {
+		return stats{}, err
+	}
+	for _, id := range ids {
+		info, err := db.PayloadInfo(id)
+		if err != nil {
+			return stats{}, fmt.Errorf("read info of payload %s: %w", id, err)
+		}
+		s.Payloads[id] = info.Size
+	}
+
+	return s, nil
+}
+
+func fileSize(path string) (int64, error) {
+	stat, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return stat.Size(), nil
+}
+
+func directorySize(path string) (int64, error) {
+	size := int64(0)
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,101 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	tapeio "github.com/simia-tech/tapedb/v2/io"
+	"github.com/simia-tech/tapedb/v2/io/file"
+)
+
+var errInvalidJSON = errors.New("invalid JSON")
+
+// verifyDatabase checks the framing, the checksums and the decryption of the log, the base and the
+// payloads. Afterwards, the JSON of each change is validated and the whole log is replayed against
+// a generic state. The first broken entry is reported with its byte offset.
+func verifyDatabase(path string, key []byte) error {
+	if err := file.VerifyDatabase(path, file.WithVerifyKey(key)); err != nil {
+		return err
+	}
+
+	meta, err := file.ReadDatabaseMeta(path)
+	if err != nil {
+		return err
+	}
+	codec := meta.Get(file.MetaFieldCodec)
+
+	session, err := file.NewTailSession(path, file.WithTailKey(key))
+	if err != nil {
+		return err
+	}
+	index, encrypted := 0, 0
+	if _, err := session.Read(func(entry tapeio.LogEntry) error {
+		defer func() { index++ }()
+
+		switch entry.Type() {
+		case tapeio.LogEntryTypeAESGCMEncrypted, tapeio.LogEntryTypeChaCha20Poly1305Encrypted:
+			encrypted++
+			return nil
+		}
+
+		typeName, data, err := readChange(entry)
+		if err != nil {
+			return &file.CorruptionError{FileName: file.DefaultLayout.Log, Offset: session.Position().Offset, Err: err}
+		}
+		if codec == "" && !json.Valid(data) {
+			return &file.CorruptionError{
+				FileName: file.DefaultLayout.Log,
+				Offset:   session.Position().Offset,
+				Err:      fmt.Errorf("change %d of type %s: %w", index, typeName, errInvalidJSON),
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if encrypted > 0 {
+		stdout.printf(verifyRecord{Verified: index, Encrypted: encrypted},
+			"verified the framing of %d log entries, %d encrypted entries have not been decoded\n", index, encrypted)
+		return nil
+	}
+	if codec != "" {
+		stdout.printf(verifyRecord{Verified: index, Codec: codec},
+			"verified %d log entries, changes encoded by codec %s have not been replayed\n", index, codec)
+		return nil
+	}
+
+	db, err := openDatabase(path, key, file.WithReadOnly())
+	if err != nil {
+		return fmt.Errorf("replay: %w", err)
+	}
+	defer db.Close()
+
+	stdout.printf(verifyRecord{Verified: db.LogLen(), Replayed: true}, "verified %d log entries\n", db.LogLen())
+
+	return nil
+}
+
+// verifyRecord is the JSON output of a successful verification. Encrypted entries and changes
+// encoded by a codec are verified without being replayed.
+type verifyRecord struct {
+	Verified  int    `json:"verified"`
+	Encrypted int    `json:"encrypted,omitempty"`
+	Codec     string `json:"codec,omitempty"`
+	Replayed  bool   `json:"replayed"`
+}
@@ -0,0 +1,143 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tapedb
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// CodecNameGob is the name of the built-in binary codec.
+const CodecNameGob = "gob"
+
+var ErrUnknownCodec = errors.New("unknown codec")
+
+// Codec encodes bases and changes in place of their own WriteTo and ReadFrom methods. The name
+// of the codec is stored with the database, so it can be resolved again when it's opened.
+type Codec interface {
+	Name() string
+	Encode(io.Writer, any) (int64, error)
+	Decode(io.Reader, any) (int64, error)
+}
+
+// CodecFactory is implemented by factories that supply codecs (e.g. CBOR or MessagePack) for
+// their bases and changes. NewCodec returns nil for names the factory doesn't know, in which case
+// the built-in codecs are consulted.
+type CodecFactory interface {
+	NewCodec(string) (Codec, error)
+}
+
+// LookupCodec resolves the codec with the provided name. The empty name results in a nil codec,
+// which means the base and changes encode themselves.
+func LookupCodec(f any, name string) (Codec, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	if cf, ok := f.(CodecFactory); ok {
+		codec, err := cf.NewCodec(name)
+		if err != nil {
+			return nil, fmt.Errorf("codec %q: %w", name, err)
+		}
+		if codec != nil {
+			return codec, nil
+		}
+	}
+
+	switch name {
+	case CodecNameGob:
+		return GobCodec{}, nil
+	}
+	return nil, fmt.Errorf("codec %q: %w", name, ErrUnknownCodec)
+}
+
+// CodecName returns the name of the codec or the empty string for a nil codec.
+func CodecName(c Codec) string {
+	if c == nil {
+		return ""
+	}
+	return c.Name()
+}
+
+// WriteWithCodec writes v using the codec. A nil codec falls back to the WriteTo method of v. A
+// ChunkedBase is written chunk by chunk.
+func WriteWithCodec(w io.Writer, c Codec, v io.WriterTo) (int64, error) {
+	if base, ok := v.(ChunkedBase); ok {
+		return writeChunkedBase(w, c, base)
+	}
+	if c == nil {
+		return v.WriteTo(w)
+	}
+	return c.Encode(w, v)
+}
+
+// ReadWithCodec reads v using the codec. A nil codec falls back to the ReadFrom method of v. A
+// ChunkedBase is read chunk by chunk.
+func ReadWithCodec(r io.Reader, c Codec, v io.ReaderFrom) (int64, error) {
+	if base, ok := v.(ChunkedBase); ok {
+		return readChunkedBase(r, c, base)
+	}
+	if c == nil {
+		return v.ReadFrom(r)
+	}
+	return c.Decode(r, v)
+}
+
+// GobCodec encodes values using encoding/gob. Only exported fields are encoded.
+type GobCodec struct{}
+
+var _ Codec = GobCodec{}
+
+func (GobCodec) Name() string {
+	return CodecNameGob
+}
+
+func (GobCodec) Encode(w io.Writer, v any) (int64, error) {
+	cw := &countWriter{w: w}
+	if err := gob.NewEncoder(cw).Encode(v); err != nil {
+		return cw.count, err
+	}
+	return cw.count, nil
+}
+
+func (GobCodec) Decode(r io.Reader, v any) (int64, error) {
+	cr := &countReader{r: bufio.NewReader(r)}
+	if err := gob.NewDecoder(cr).Decode(v); err != nil {
+		return cr.count, err
+	}
+	return cr.count, nil
+}
+
+type countReader struct {
+	r     *bufio.Reader
+	count int64
+}
+
+func (r *countReader) Read(data []byte) (int, error) {
+	n, err := r.r.Read(data)
+	r.count += int64(n)
+	return n, err
+}
+
+func (r *countReader) ReadByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err == nil {
+		r.count++
+	}
+	return b, err
+}
@@ -0,0 +1,71 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tapedb_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+type codecFactory struct {
+	*test.Factory
+}
+
+func (codecFactory) NewCodec(name string) (tapedb.Codec, error) {
+	if name == "broken" {
+		return nil, errors.New("broken")
+	}
+	return nil, nil
+}
+
+func TestGobCodec(t *testing.T) {
+	codec := tapedb.GobCodec{}
+	buffer := bytes.Buffer{}
+
+	n, err := tapedb.WriteWithCodec(&buffer, codec, &test.ChangeCounterInc{Value: 7})
+	require.NoError(t, err)
+	assert.Equal(t, int64(buffer.Len()), n)
+
+	change := &test.ChangeCounterInc{}
+	_, err = tapedb.ReadWithCodec(&buffer, codec, change)
+	require.NoError(t, err)
+	assert.Equal(t, 7, change.Value)
+	assert.Equal(t, 0, buffer.Len())
+}
+
+func TestLookupCodec(t *testing.T) {
+	f := codecFactory{test.NewFactory()}
+
+	codec, err := tapedb.LookupCodec(f, "")
+	require.NoError(t, err)
+	assert.Nil(t, codec)
+
+	codec, err = tapedb.LookupCodec(f, tapedb.CodecNameGob)
+	require.NoError(t, err)
+	assert.Equal(t, tapedb.CodecNameGob, tapedb.CodecName(codec))
+
+	_, err = tapedb.LookupCodec(f, "broken")
+	assert.EqualError(t, err, `codec "broken": broken`)
+
+	_, err = tapedb.LookupCodec(f, "cbor")
+	assert.ErrorIs(t, err, tapedb.ErrUnknownCodec)
+}
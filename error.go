@@ -0,0 +1,131 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tapedb
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrorCode classifies an error, so it can be mapped to a protocol status without matching each
+// error of each package.
+type ErrorCode string
+
+const (
+	ErrorCodeInternal        ErrorCode = "internal"
+	ErrorCodeMissing         ErrorCode = "missing"
+	ErrorCodeExisting        ErrorCode = "existing"
+	ErrorCodeInvalidKey      ErrorCode = "invalid-key"
+	ErrorCodeReadOnly        ErrorCode = "read-only"
+	ErrorCodeLocked          ErrorCode = "locked"
+	ErrorCodeDiverged        ErrorCode = "diverged"
+	ErrorCodeConflict        ErrorCode = "conflict"
+	ErrorCodeCorrupt         ErrorCode = "corrupt"
+	ErrorCodeInvalidChange   ErrorCode = "invalid-change"
+	ErrorCodePayloadMissing  ErrorCode = "payload-missing"
+	ErrorCodePayloadExisting ErrorCode = "payload-existing"
+	ErrorCodePayloadTooLarge ErrorCode = "payload-too-large"
+	ErrorCodeUnsupported     ErrorCode = "unsupported"
+)
+
+// NoIndex is the index of errors that don't refer to a log entry.
+const NoIndex = -1
+
+// Error holds the code of an error together with the operation and the path of the database it
+// occurred in. Index is the log index of the offending entry or NoIndex.
+type Error struct {
+	Code  ErrorCode
+	Op    string
+	Path  string
+	Index int64
+	Err   error
+}
+
+// NewError returns a new error with the provided code and text. It's meant for sentinel errors.
+func NewError(code ErrorCode, text string) error {
+	return &Error{Code: code, Index: NoIndex, Err: errors.New(text)}
+}
+
+// WrapError returns an error that adds the operation and the path to the provided error. The code
+// and the index are taken from the wrapped error. Errors that already name a path are returned as
+// they are.
+func WrapError(op, path string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if e, ok := err.(*Error); ok && e.Path != "" {
+		return err
+	}
+	return &Error{Code: ErrorCodeOf(err), Op: op, Path: path, Index: ErrorIndexOf(err), Err: err}
+}
+
+// WrapErrorAt returns an error that adds the log index of the offending entry to the provided error.
+func WrapErrorAt(op string, index int64, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Code: ErrorCodeOf(err), Op: op, Index: index, Err: err}
+}
+
+func (e *Error) Error() string {
+	b := strings.Builder{}
+	b.WriteString(e.Op)
+	if e.Path != "" {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(e.Path)
+	}
+	// an index that has been taken from the wrapped error is already part of its message
+	if e.Index != NoIndex && e.Index != ErrorIndexOf(e.Err) {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(&b, "at index %d", e.Index)
+	}
+	if b.Len() == 0 {
+		return e.Err.Error()
+	}
+	b.WriteString(": ")
+	b.WriteString(e.Err.Error())
+	return b.String()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ErrorCodeOf returns the code of the first coded error in the chain of the provided error. Errors
+// without a code are internal.
+func ErrorCodeOf(err error) ErrorCode {
+	e := (*Error)(nil)
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ErrorCodeInternal
+}
+
+// ErrorIndexOf returns the log index of the first error in the chain of the provided error that
+// refers to a log entry.
+func ErrorIndexOf(err error) int64 {
+	for err != nil {
+		if e, ok := err.(*Error); ok && e.Index != NoIndex {
+			return e.Index
+		}
+		err = errors.Unwrap(err)
+	}
+	return NoIndex
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tapedb_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/simia-tech/tapedb/v2"
+)
+
+func TestError(t *testing.T) {
+	errMissing := tapedb.NewError(tapedb.ErrorCodeMissing, "missing")
+
+	t.Run("Sentinel", func(t *testing.T) {
+		assert.Equal(t, "missing", errMissing.Error())
+		assert.Equal(t, tapedb.ErrorCodeMissing, tapedb.ErrorCodeOf(errMissing))
+		assert.Equal(t, int64(tapedb.NoIndex), tapedb.ErrorIndexOf(errMissing))
+	})
+
+	t.Run("Wrap", func(t *testing.T) {
+		err := tapedb.WrapError("open", "/tmp/db", fmt.Errorf("read base: %w", errMissing))
+		assert.Equal(t, "open /tmp/db: read base: missing", err.Error())
+		assert.ErrorIs(t, err, errMissing)
+
+		e := (*tapedb.Error)(nil)
+		if assert.True(t, errors.As(err, &e)) {
+			assert.Equal(t, tapedb.ErrorCodeMissing, e.Code)
+			assert.Equal(t, "open", e.Op)
+			assert.Equal(t, "/tmp/db", e.Path)
+		}
+
+		assert.Same(t, err, tapedb.WrapError("apply", "/tmp/other", err))
+		assert.Nil(t, tapedb.WrapError("open", "/tmp/db", nil))
+	})
+
+	t.Run("WrapAt", func(t *testing.T) {
+		err := tapedb.WrapError("open", "/tmp/db", tapedb.WrapErrorAt("read change", 7, tapedb.ErrUnknownChangeType))
+		assert.Equal(t, "open /tmp/db: read change at index 7: unknown change type", err.Error())
+		assert.Equal(t, tapedb.ErrorCodeInvalidChange, tapedb.ErrorCodeOf(err))
+		assert.Equal(t, int64(7), tapedb.ErrorIndexOf(err))
+	})
+
+	t.Run("Uncoded", func(t *testing.T) {
+		assert.Equal(t, tapedb.ErrorCodeInternal, tapedb.ErrorCodeOf(errors.New("test")))
+		assert.Equal(t, tapedb.ErrorCodeInternal, tapedb.WrapError("open", "/tmp/db", errors.New("test")).(*tapedb.Error).Code)
+	})
+}
@@ -0,0 +1,93 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command tenants is a reference implementation of an encrypted multi-tenant service. Each tenant
+// gets its own database, which is encrypted with a key that is derived from the tenant's password.
+// The databases are kept open in a deck and spliced once their logs grow too long. Run it with
+//
+//	go run . -dir data
+//
+// and use it via
+//
+//	curl -u alice:secret -X POST localhost:8080/signup
+//	curl -u alice:secret -X PUT -H 'Content-Type: text/plain' --data-binary @notes.txt 'localhost:8080/documents/notes?title=Notes'
+//	curl -u alice:secret localhost:8080/documents
+//	curl -u alice:secret localhost:8080/documents/notes
+//	curl -u alice:secret -X DELETE localhost:8080/documents/notes
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/simia-tech/tapedb/v2/io/file"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8080", "address the service listens on")
+	dir := flag.String("dir", "data", "directory of the tenant databases")
+	openLimit := flag.Int("open-limit", 100, "maximum number of open databases")
+	idleTimeout := flag.Duration("idle-timeout", 10*time.Minute, "closes databases that have been idle for the duration")
+	spliceThreshold := flag.Int("splice-threshold", 1000, "splices a database once its log holds the number of changes")
+	keepChanges := flag.Int("keep-changes", 100, "number of changes that are kept in the log by a splice")
+	flag.Parse()
+
+	if err := run(*addr, *dir, *openLimit, *idleTimeout, *spliceThreshold, *keepChanges); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(addr, dir string, openLimit int, idleTimeout time.Duration, spliceThreshold, keepChanges int) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	deck, err := file.NewDeck[*Base, *State, *Factory](openLimit, file.WithDeckIdleTimeout(idleTimeout))
+	if err != nil {
+		return err
+	}
+	defer deck.Close()
+
+	service, err := NewService(deck, dir, WithSplicePolicy(spliceThreshold, keepChanges))
+	if err != nil {
+		return err
+	}
+	defer service.Close()
+
+	s := &http.Server{Addr: addr, Handler: service}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	errCh := make(chan error, 1)
+	go func() {
+		log.Printf("listening on %s", addr)
+		errCh <- s.ListenAndServe()
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	// the databases are closed by the deferred calls, once the running requests are done
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return s.Shutdown(shutdownCtx)
+}
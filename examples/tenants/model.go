@@ -0,0 +1,159 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/simia-tech/tapedb/v2"
+)
+
+// Base is the snapshot of the documents of a tenant that is written when the database is spliced.
+type Base struct {
+	tapedb.Payloads
+
+	Documents map[string]Document `json:"documents,omitempty"`
+}
+
+// Document references the payload that holds its content.
+type Document struct {
+	Title     string `json:"title"`
+	PayloadID string `json:"payloadID"`
+}
+
+func (b *Base) ReadFrom(r io.Reader) (int64, error) {
+	return tapedb.ReadJSON(r, b)
+}
+
+func (b *Base) WriteTo(w io.Writer) (int64, error) {
+	return tapedb.WriteJSON(w, b)
+}
+
+func (b *Base) Apply(c tapedb.Change) error {
+	b.ApplyPayloadChange(c)
+	b.Documents = apply(c, b.Documents)
+	return nil
+}
+
+// State is the in-memory view of the documents. Readers have to hold the ReadLocker.
+type State struct {
+	Documents  map[string]Document
+	ReadLocker sync.Locker
+}
+
+func (s *State) Apply(c tapedb.Change) error {
+	s.Documents = apply(c, s.Documents)
+	return nil
+}
+
+func apply(c tapedb.Change, documents map[string]Document) map[string]Document {
+	switch t := c.(type) {
+	case *ChangeDocumentAdd:
+		if documents == nil {
+			documents = map[string]Document{}
+		}
+		documents[t.ID] = Document{Title: t.Title, PayloadID: t.PayloadID}
+	case *ChangeDocumentRemove:
+		delete(documents, t.ID)
+	}
+	return documents
+}
+
+// Factory creates the base, the state and the changes of the model.
+type Factory struct{}
+
+func (f *Factory) NewBase() *Base {
+	return &Base{}
+}
+
+func (f *Factory) NewState(base *Base, readLocker sync.Locker) *State {
+	documents := make(map[string]Document, len(base.Documents))
+	for id, document := range base.Documents {
+		documents[id] = document
+	}
+	return &State{Documents: documents, ReadLocker: readLocker}
+}
+
+func (f *Factory) NewChange(typeName string) (tapedb.Change, error) {
+	switch typeName {
+	case "document-add":
+		return &ChangeDocumentAdd{}, nil
+	case "document-remove":
+		return &ChangeDocumentRemove{}, nil
+	}
+	return nil, fmt.Errorf("change type [%s]: %w", typeName, tapedb.ErrUnknownChangeType)
+}
+
+// ChangeDocumentAdd adds a document. Its payload has to be applied together with the change.
+type ChangeDocumentAdd struct {
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	PayloadID string `json:"payloadID"`
+}
+
+func (c *ChangeDocumentAdd) TypeName() string {
+	return "document-add"
+}
+
+func (c *ChangeDocumentAdd) ReadFrom(r io.Reader) (int64, error) {
+	return tapedb.ReadJSON(r, c)
+}
+
+func (c *ChangeDocumentAdd) WriteTo(w io.Writer) (int64, error) {
+	return tapedb.WriteJSON(w, c)
+}
+
+func (c *ChangeDocumentAdd) PayloadIDs() []string {
+	return []string{c.PayloadID}
+}
+
+func (c *ChangeDocumentAdd) Validate(s *State) error {
+	if _, ok := s.Documents[c.ID]; ok {
+		return fmt.Errorf("document %s already exists", c.ID)
+	}
+	return nil
+}
+
+// ChangeDocumentRemove removes a document and detaches its payload, so it's deleted by the next
+// splice.
+type ChangeDocumentRemove struct {
+	ID        string `json:"id"`
+	PayloadID string `json:"payloadID"`
+}
+
+func (c *ChangeDocumentRemove) TypeName() string {
+	return "document-remove"
+}
+
+func (c *ChangeDocumentRemove) ReadFrom(r io.Reader) (int64, error) {
+	return tapedb.ReadJSON(r, c)
+}
+
+func (c *ChangeDocumentRemove) WriteTo(w io.Writer) (int64, error) {
+	return tapedb.WriteJSON(w, c)
+}
+
+func (c *ChangeDocumentRemove) DetachedPayloadIDs() []string {
+	return []string{c.PayloadID}
+}
+
+func (c *ChangeDocumentRemove) Validate(s *State) error {
+	if _, ok := s.Documents[c.ID]; !ok {
+		return fmt.Errorf("document %s doesn't exist", c.ID)
+	}
+	return nil
+}
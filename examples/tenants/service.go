@@ -0,0 +1,342 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/simia-tech/tapedb/v2"
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/server"
+)
+
+type serviceOptions struct {
+	cryptSettings   string
+	keyTTL          time.Duration
+	spliceThreshold int
+	keepChanges     int
+}
+
+var defaultServiceOptions = serviceOptions{
+	cryptSettings:   file.DefaultCryptSettings,
+	keyTTL:          5 * time.Minute,
+	spliceThreshold: 1000,
+	keepChanges:     100,
+}
+
+type ServiceOption func(*serviceOptions)
+
+// WithCryptSettings sets the settings of the key derivation for new databases.
+func WithCryptSettings(value string) ServiceOption {
+	return func(o *serviceOptions) {
+		o.cryptSettings = value
+	}
+}
+
+// WithKeyTTL sets how long derived keys are cached.
+func WithKeyTTL(value time.Duration) ServiceOption {
+	return func(o *serviceOptions) {
+		o.keyTTL = value
+	}
+}
+
+// WithSplicePolicy splices the database of a tenant as soon as its log holds the provided number
+// of changes. All changes but the last keepChanges are rebased into the base.
+func WithSplicePolicy(threshold, keepChanges int) ServiceOption {
+	return func(o *serviceOptions) {
+		o.spliceThreshold = threshold
+		o.keepChanges = keepChanges
+	}
+}
+
+// Service is the HTTP API of the example. The tenants authenticate via basic auth. The user name
+// selects the database of the tenant and the password derives its key, so the documents of a
+// tenant can't be read without its password. The service provides the following endpoints.
+//
+//	POST   /signup                    creates the database of the tenant
+//	GET    /documents                 lists the documents
+//	PUT    /documents/{id}?title=...  stores the body as the content of a new document
+//	GET    /documents/{id}            returns the content of the document
+//	DELETE /documents/{id}            removes the document
+type Service struct {
+	deck       *file.Deck[*Base, *State, *Factory]
+	factory    *Factory
+	keyCache   *file.KeyCache
+	pathFn     server.PathFunc
+	middleware *server.Middleware[*Base, *State, *Factory]
+	options    serviceOptions
+	mux        *http.ServeMux
+}
+
+var _ http.Handler = &Service{}
+
+// NewService returns the service for the databases in the provided directory. The deck limits
+// the number of open databases.
+func NewService(deck *file.Deck[*Base, *State, *Factory], path string, opts ...ServiceOption) (*Service, error) {
+	options := defaultServiceOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	keyCache, err := file.NewKeyCache(options.keyTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Service{
+		deck:     deck,
+		factory:  &Factory{},
+		keyCache: keyCache,
+		pathFn:   server.DirectoryPathFunc(path),
+		options:  options,
+		mux:      http.NewServeMux(),
+	}
+	s.middleware = server.NewMiddleware(deck, s.factory, server.BasicAuthTenantFunc(), s.pathFn,
+		server.WithMiddlewareOpenOptionsFunc(s.openOptions))
+
+	s.mux.HandleFunc("/signup", s.signup)
+	s.mux.Handle("/documents", s.middleware.Read(http.HandlerFunc(s.listDocuments)))
+	getDocument := s.middleware.Read(http.HandlerFunc(s.getDocument))
+	putDocument := s.spliceAfter(s.middleware.Write(http.HandlerFunc(s.putDocument)))
+	deleteDocument := s.spliceAfter(s.middleware.Write(http.HandlerFunc(s.deleteDocument)))
+	s.mux.HandleFunc("/documents/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			getDocument.ServeHTTP(w, r)
+		case http.MethodPut:
+			putDocument.ServeHTTP(w, r)
+		case http.MethodDelete:
+			deleteDocument.ServeHTTP(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	return s, nil
+}
+
+// Close removes the cached keys from memory.
+func (s *Service) Close() {
+	s.keyCache.Purge()
+}
+
+func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// keyFunc derives the key of a tenant's database from the password. Each database has its own
+// salt in its meta, so tenants with the same password still get different keys.
+func (s *Service) keyFunc(password string) file.KeyFunc {
+	return s.keyCache.DeriveKeyFrom(password, s.options.cryptSettings)
+}
+
+func (s *Service) openOptions(r *http.Request, _ string) ([]file.OpenOption, error) {
+	_, password, _ := r.BasicAuth()
+	return []file.OpenOption{file.WithOpenKeyFunc(s.keyFunc(password))}, nil
+}
+
+func (s *Service) signup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	tenant, password, ok := r.BasicAuth()
+	if !ok || password == "" {
+		http.Error(w, "tenant and password required", http.StatusBadRequest)
+		return
+	}
+	path, err := s.pathFn(r, tenant)
+	if err != nil {
+		server.WriteError(w, err)
+		return
+	}
+
+	// the payload info keeps the plaintext size and the content type of each document
+	err = s.deck.Create(s.factory, path, file.WithCreateKeyFunc(s.keyFunc(password)), file.WithPayloadInfo())
+	if err != nil {
+		server.WriteError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+type documentResponse struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"contentType,omitempty"`
+}
+
+func (s *Service) listDocuments(w http.ResponseWriter, r *http.Request) {
+	db, _ := server.ReadOnlyDatabaseFromContext[*Base, *State](r.Context())
+
+	state := db.State()
+	state.ReadLocker.Lock()
+	documents := make(map[string]Document, len(state.Documents))
+	for id, document := range state.Documents {
+		documents[id] = document
+	}
+	state.ReadLocker.Unlock()
+
+	response := make([]documentResponse, 0, len(documents))
+	for id, document := range documents {
+		info, err := db.PayloadInfo(document.PayloadID)
+		if err != nil {
+			server.WriteError(w, err)
+			return
+		}
+		response = append(response, documentResponse{
+			ID:          id,
+			Title:       document.Title,
+			Size:        info.Size,
+			ContentType: info.ContentType,
+		})
+	}
+	sort.Slice(response, func(i, j int) bool { return response[i].ID < response[j].ID })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Service) getDocument(w http.ResponseWriter, r *http.Request) {
+	db, _ := server.ReadOnlyDatabaseFromContext[*Base, *State](r.Context())
+
+	document, err := lookupDocument(db, documentID(r))
+	if err != nil {
+		server.WriteError(w, err)
+		return
+	}
+
+	info, err := db.PayloadInfo(document.PayloadID)
+	if err != nil {
+		server.WriteError(w, err)
+		return
+	}
+	f, err := db.OpenPayload(document.PayloadID)
+	if err != nil {
+		server.WriteError(w, err)
+		return
+	}
+	defer f.Close()
+
+	if info.ContentType != "" {
+		w.Header().Set("Content-Type", info.ContentType)
+	}
+	http.ServeContent(w, r, "", time.Time{}, f)
+}
+
+func (s *Service) putDocument(w http.ResponseWriter, r *http.Request) {
+	db, _ := server.DatabaseFromContext[*Base, *State](r.Context())
+
+	id := documentID(r)
+	if id == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	// the payload gets a generated id, since a document id can be reused after a removal, while
+	// the payload of the removed document is kept until the next splice
+	change := &ChangeDocumentAdd{ID: id, Title: r.URL.Query().Get("title"), PayloadID: tapedb.GenerateUUID()}
+	payload := file.NewPayload(change.PayloadID, r.Body).WithContentType(r.Header.Get("Content-Type"))
+	if err := db.Apply(change, payload); err != nil {
+		server.WriteError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Service) deleteDocument(w http.ResponseWriter, r *http.Request) {
+	db, _ := server.DatabaseFromContext[*Base, *State](r.Context())
+
+	id := documentID(r)
+	document, err := lookupDocument(db.AsReadOnly(), id)
+	if err != nil {
+		server.WriteError(w, err)
+		return
+	}
+
+	if err := db.Apply(&ChangeDocumentRemove{ID: id, PayloadID: document.PayloadID}); err != nil {
+		server.WriteError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// spliceAfter splices the tenant's database after a successful write, if its log reached the
+// threshold. The splice has to happen during a request, since the key can only be derived from
+// the tenant's password. The payloads of removed documents are deleted by the splice.
+func (s *Service) spliceAfter(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		if recorder.status >= http.StatusMultipleChoices {
+			return
+		}
+
+		tenant, password, _ := r.BasicAuth()
+		path, err := s.pathFn(r, tenant)
+		if err != nil {
+			return
+		}
+		logLen, err := s.deck.LogLen(path)
+		if err != nil || logLen < s.options.spliceThreshold {
+			return
+		}
+
+		keyFn := s.keyFunc(password)
+		if _, err := s.deck.SpliceContext(r.Context(), s.factory, path,
+			file.WithSourceKeyFunc(keyFn),
+			file.WithTargetKeyFunc(keyFn),
+			file.WithRebaseChangeCount(logLen-s.options.keepChanges)); err != nil {
+			log.Printf("splice database of tenant %s: %v", tenant, err)
+		}
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func lookupDocument(db *file.ReadOnlyDatabase[*Base, *State], id string) (Document, error) {
+	state := db.State()
+	state.ReadLocker.Lock()
+	defer state.ReadLocker.Unlock()
+
+	document, ok := state.Documents[id]
+	if !ok {
+		return Document{}, fmt.Errorf("document %s: %w", id, file.ErrMissing)
+	}
+	return document, nil
+}
+
+func documentID(r *http.Request) string {
+	id := strings.TrimPrefix(r.URL.Path, "/documents/")
+	if strings.Contains(id, "/") {
+		return ""
+	}
+	return id
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2/io/file"
+)
+
+const testCryptSettings = "$argon2id$v=19$m=1024,t=1,p=1$"
+
+func TestService(t *testing.T) {
+	path, removeDir := makeTempDir(t)
+	defer removeDir()
+
+	deck, err := file.NewDeck[*Base, *State, *Factory](1)
+	require.NoError(t, err)
+	defer deck.Close()
+
+	service, err := NewService(deck, path, WithCryptSettings(testCryptSettings), WithSplicePolicy(4, 1))
+	require.NoError(t, err)
+	defer service.Close()
+
+	s := httptest.NewServer(service)
+	defer s.Close()
+
+	status, _ := request(t, http.MethodPost, s.URL+"/signup", "alice", "secret", "")
+	require.Equal(t, http.StatusCreated, status)
+	status, _ = request(t, http.MethodPost, s.URL+"/signup", "bob", "secret", "")
+	require.Equal(t, http.StatusCreated, status)
+
+	t.Run("SignupTwice", func(t *testing.T) {
+		status, _ := request(t, http.MethodPost, s.URL+"/signup", "alice", "other", "")
+		assert.Equal(t, http.StatusConflict, status)
+	})
+
+	t.Run("SignupWithoutPassword", func(t *testing.T) {
+		status, _ := request(t, http.MethodPost, s.URL+"/signup", "carol", "", "")
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+
+	t.Run("PutAndGetDocument", func(t *testing.T) {
+		status, _ := request(t, http.MethodPut, s.URL+"/documents/notes?title=Notes", "alice", "secret", "top secret notes")
+		require.Equal(t, http.StatusCreated, status)
+
+		status, body := request(t, http.MethodGet, s.URL+"/documents/notes", "alice", "secret", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "top secret notes", body)
+
+		status, body = request(t, http.MethodGet, s.URL+"/documents", "alice", "secret", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.JSONEq(t, `[{"id":"notes","title":"Notes","size":16,"contentType":"text/plain"}]`, body)
+	})
+
+	t.Run("Encryption", func(t *testing.T) {
+		err := filepath.Walk(filepath.Join(path, "alice"), func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.NotContains(t, string(data), "top secret", path)
+			return nil
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("WrongPassword", func(t *testing.T) {
+		status, _ := request(t, http.MethodGet, s.URL+"/documents/notes", "alice", "wrong", "")
+		assert.Equal(t, http.StatusForbidden, status)
+	})
+
+	t.Run("TenantIsolation", func(t *testing.T) {
+		status, body := request(t, http.MethodGet, s.URL+"/documents", "bob", "secret", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.JSONEq(t, `[]`, body)
+
+		status, _ = request(t, http.MethodGet, s.URL+"/documents/notes", "bob", "secret", "")
+		assert.Equal(t, http.StatusNotFound, status)
+	})
+
+	t.Run("UnknownTenant", func(t *testing.T) {
+		status, _ := request(t, http.MethodGet, s.URL+"/documents", "dave", "secret", "")
+		assert.Equal(t, http.StatusNotFound, status)
+
+		status, _ = request(t, http.MethodGet, s.URL+"/documents", "..", "secret", "")
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+
+	t.Run("PutExistingDocument", func(t *testing.T) {
+		status, _ := request(t, http.MethodPut, s.URL+"/documents/notes", "alice", "secret", "other")
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+
+	t.Run("SpliceAfterDelete", func(t *testing.T) {
+		status, _ := request(t, http.MethodPut, s.URL+"/documents/draft", "alice", "secret", "draft")
+		require.Equal(t, http.StatusCreated, status)
+
+		status, _ = request(t, http.MethodDelete, s.URL+"/documents/draft", "alice", "secret", "")
+		require.Equal(t, http.StatusNoContent, status)
+		assert.Len(t, payloadFiles(t, filepath.Join(path, "alice")), 2)
+
+		// the fourth change reaches the threshold, so the payload of the draft is deleted
+		status, _ = request(t, http.MethodPut, s.URL+"/documents/draft", "alice", "secret", "new draft")
+		require.Equal(t, http.StatusCreated, status)
+		assert.Len(t, payloadFiles(t, filepath.Join(path, "alice")), 2)
+
+		logLen, err := deck.LogLen(filepath.Join(path, "alice"))
+		require.NoError(t, err)
+		assert.Equal(t, 1, logLen)
+
+		status, body := request(t, http.MethodGet, s.URL+"/documents/draft", "alice", "secret", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "new draft", body)
+
+		status, body = request(t, http.MethodGet, s.URL+"/documents/notes", "alice", "secret", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "top secret notes", body)
+	})
+}
+
+func request(tb testing.TB, method, url, tenant, password, body string) (int, string) {
+	r, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(tb, err)
+	r.SetBasicAuth(tenant, password)
+	if body != "" {
+		r.Header.Set("Content-Type", "text/plain")
+	}
+
+	response, err := http.DefaultClient.Do(r)
+	require.NoError(tb, err)
+	defer response.Body.Close()
+
+	data, err := io.ReadAll(response.Body)
+	require.NoError(tb, err)
+
+	return response.StatusCode, string(data)
+}
+
+func payloadFiles(tb testing.TB, path string) []string {
+	names, err := filepath.Glob(filepath.Join(path, file.FilePrefixPayload+"*"))
+	require.NoError(tb, err)
+	return names
+}
+
+func makeTempDir(tb testing.TB) (string, func()) {
+	n := [8]byte{}
+	rand.Read(n[:])
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("tapedb-%x", n[:]))
+	require.NoError(tb, os.MkdirAll(path, 0777))
+	return path, func() {
+		require.NoError(tb, os.RemoveAll(path))
+	}
+}
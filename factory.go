@@ -15,12 +15,11 @@
 package tapedb
 
 import (
-	"errors"
 	"sync"
 )
 
 var (
-	ErrUnknownChangeType = errors.New("unknown change type")
+	ErrUnknownChangeType = NewError(ErrorCodeInvalidChange, "unknown change type")
 )
 
 type Factory[B Base, S State] interface {
@@ -0,0 +1,104 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package generic provides a schema-less model that keeps the base and the changes in their encoded
+// form. It allows tools to read and extend any database without knowing its model. Since the
+// changes aren't interpreted, the state stays empty and changes can't be rebased into the base.
+package generic
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/simia-tech/tapedb/v2"
+)
+
+var ErrNotSupported = errors.New("not supported by the generic model")
+
+// Base holds the encoded base.
+type Base struct {
+	Data []byte
+}
+
+var _ tapedb.Base = &Base{}
+
+func (b *Base) ReadFrom(r io.Reader) (int64, error) {
+	data, err := io.ReadAll(r)
+	b.Data = data
+	return int64(len(data)), err
+}
+
+func (b *Base) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(b.Data)
+	return int64(n), err
+}
+
+// Apply fails, since the change can't be interpreted.
+func (b *Base) Apply(tapedb.Change) error {
+	return ErrNotSupported
+}
+
+// State ignores all changes.
+type State struct{}
+
+var _ tapedb.State = &State{}
+
+func (s *State) Apply(tapedb.Change) error {
+	return nil
+}
+
+// Change holds the type name and the encoded data of a change.
+type Change struct {
+	Type string
+	Data []byte
+}
+
+var _ tapedb.Change = &Change{}
+
+func (c *Change) TypeName() string {
+	return c.Type
+}
+
+func (c *Change) ReadFrom(r io.Reader) (int64, error) {
+	data, err := io.ReadAll(r)
+	c.Data = data
+	return int64(len(data)), err
+}
+
+func (c *Change) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(c.Data)
+	return int64(n), err
+}
+
+// Factory creates the generic base, state and changes. Every type name is accepted.
+type Factory struct{}
+
+var _ tapedb.Factory[*Base, *State] = &Factory{}
+
+func NewFactory() *Factory {
+	return &Factory{}
+}
+
+func (f *Factory) NewBase() *Base {
+	return &Base{}
+}
+
+func (f *Factory) NewState(*Base, sync.Locker) *State {
+	return &State{}
+}
+
+func (f *Factory) NewChange(typeName string) (tapedb.Change, error) {
+	return &Change{Type: typeName}, nil
+}
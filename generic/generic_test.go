@@ -0,0 +1,47 @@
+package generic_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2"
+	"github.com/simia-tech/tapedb/v2/generic"
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestFactory(t *testing.T) {
+	path, err := os.MkdirTemp("", "tapedb-")
+	require.NoError(t, err)
+	defer os.RemoveAll(path)
+
+	db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path)
+	require.NoError(t, err)
+	require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 2}))
+	require.NoError(t, db.Close())
+
+	genericDB, err := file.OpenDatabase[*generic.Base, *generic.State](generic.NewFactory(), path)
+	require.NoError(t, err)
+
+	changes := []tapedb.Change{}
+	require.NoError(t, genericDB.ReadChanges(func(_ int, change tapedb.Change) error {
+		changes = append(changes, change)
+		return nil
+	}))
+	assert.Equal(t, []tapedb.Change{&generic.Change{Type: "counter-inc", Data: []byte("{\"value\":2}\n")}}, changes)
+
+	require.NoError(t, genericDB.Apply(&generic.Change{Type: "counter-inc", Data: []byte("{\"value\":3}\n")}))
+	require.NoError(t, genericDB.Close())
+
+	_, err = file.SpliceDatabase[*generic.Base, *generic.State](generic.NewFactory(), path, file.WithRebaseChangeCount(1))
+	assert.ErrorIs(t, err, generic.ErrNotSupported)
+
+	db, err = file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	assert.Equal(t, 5, db.State().Counter)
+}
@@ -1,22 +1,28 @@
 module github.com/simia-tech/tapedb/v2
 
-go 1.18
+go 1.21
 
 require (
 	github.com/alecthomas/kong v0.6.0
 	github.com/fsnotify/fsnotify v1.5.4
 	github.com/hashicorp/golang-lru v0.5.4
+	github.com/klauspost/compress v1.17.11
 	github.com/lithammer/shortuuid/v3 v3.0.7
 	github.com/simia-tech/crypt v0.5.1
 	github.com/stretchr/testify v1.7.2
-	golang.org/x/crypto v0.0.0-20220525230936-793ad666bf5e
+	golang.org/x/crypto v0.23.0
+	golang.org/x/sys v0.20.0
+	google.golang.org/grpc v1.65.0
+	google.golang.org/protobuf v1.34.2
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/google/uuid v1.2.0 // indirect
+	github.com/google/uuid v1.6.0 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	golang.org/x/sys v0.0.0-20220412211240-33da011f77ad // indirect
-	golang.org/x/term v0.0.0-20201126162022-7de9c90e9dd1 // indirect
+	golang.org/x/net v0.25.0 // indirect
+	golang.org/x/term v0.20.0 // indirect
+	golang.org/x/text v0.15.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240528184218-531527333157 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
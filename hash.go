@@ -0,0 +1,143 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tapedb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
+	"math"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// Hasher can be implemented by a base or state to provide its own hash for integrity comparisons,
+// e.g. to verify a splice before the files are swapped or to compare a follower with its leader.
+type Hasher interface {
+	Hash() []byte
+}
+
+var lockerType = reflect.TypeOf((*sync.Locker)(nil)).Elem()
+
+// Hash returns the hash of the provided value. If the value implements Hasher, that implementation
+// is used. Otherwise, the hash is calculated by walking the value via reflection. Struct fields that
+// hold a sync.Locker or are tagged with `hash:"-"` are skipped.
+func Hash(v any) []byte {
+	if h, ok := v.(Hasher); ok {
+		return h.Hash()
+	}
+
+	h := sha256.New()
+	hashValue(h, reflect.ValueOf(v), map[uintptr]struct{}{})
+	return h.Sum(nil)
+}
+
+func HashEqual(a, b any) bool {
+	return bytes.Equal(Hash(a), Hash(b))
+}
+
+func hashValue(h hash.Hash, v reflect.Value, visited map[uintptr]struct{}) {
+	if !v.IsValid() {
+		h.Write([]byte{0})
+		return
+	}
+
+	h.Write([]byte{byte(v.Kind())})
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			h.Write([]byte{1})
+		} else {
+			h.Write([]byte{0})
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		hashUint64(h, uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		hashUint64(h, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		hashUint64(h, math.Float64bits(v.Float()))
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		hashUint64(h, math.Float64bits(real(c)))
+		hashUint64(h, math.Float64bits(imag(c)))
+	case reflect.String:
+		hashUint64(h, uint64(v.Len()))
+		h.Write([]byte(v.String()))
+	case reflect.Slice, reflect.Array:
+		hashUint64(h, uint64(v.Len()))
+		for index := 0; index < v.Len(); index++ {
+			hashValue(h, v.Index(index), visited)
+		}
+	case reflect.Map:
+		entries := make([][]byte, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			eh := sha256.New()
+			hashValue(eh, iter.Key(), visited)
+			hashValue(eh, iter.Value(), visited)
+			entries = append(entries, eh.Sum(nil))
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			return bytes.Compare(entries[i], entries[j]) < 0
+		})
+		hashUint64(h, uint64(len(entries)))
+		for _, entry := range entries {
+			h.Write(entry)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for index := 0; index < v.NumField(); index++ {
+			field := t.Field(index)
+			if field.Tag.Get("hash") == "-" || isLocker(field.Type) {
+				continue
+			}
+			h.Write([]byte(field.Name))
+			hashValue(h, v.Field(index), visited)
+		}
+	case reflect.Pointer:
+		if v.IsNil() {
+			h.Write([]byte{0})
+			return
+		}
+		if _, ok := visited[v.Pointer()]; ok {
+			return
+		}
+		visited[v.Pointer()] = struct{}{}
+		hashValue(h, v.Elem(), visited)
+		delete(visited, v.Pointer())
+	case reflect.Interface:
+		if v.IsNil() {
+			h.Write([]byte{0})
+			return
+		}
+		h.Write([]byte(v.Elem().Type().String()))
+		hashValue(h, v.Elem(), visited)
+	}
+}
+
+// isLocker also matches types like sync.Mutex that are held by value and only implement
+// sync.Locker via their pointer.
+func isLocker(t reflect.Type) bool {
+	return t.Implements(lockerType) || reflect.PointerTo(t).Implements(lockerType)
+}
+
+func hashUint64(h hash.Hash, value uint64) {
+	buffer := [8]byte{}
+	binary.BigEndian.PutUint64(buffer[:], value)
+	h.Write(buffer[:])
+}
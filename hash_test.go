@@ -0,0 +1,70 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tapedb_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/simia-tech/tapedb/v2"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+type hashedState struct{}
+
+type mutexState struct {
+	mutex sync.Mutex
+	Value int
+}
+
+func (s *hashedState) Hash() []byte {
+	return []byte("fixed")
+}
+
+func TestHash(t *testing.T) {
+	t.Run("Reflection", func(t *testing.T) {
+		a := test.NewState(&test.Base{Value: 3}, &sync.Mutex{})
+		b := test.NewState(&test.Base{Value: 3}, &sync.RWMutex{})
+		c := test.NewState(&test.Base{Value: 4}, &sync.Mutex{})
+
+		assert.Len(t, tapedb.Hash(a), 32)
+		assert.True(t, tapedb.HashEqual(a, b))
+		assert.False(t, tapedb.HashEqual(a, c))
+	})
+
+	t.Run("Map", func(t *testing.T) {
+		a := map[string]int{"a": 1, "b": 2, "c": 3}
+		b := map[string]int{"c": 3, "b": 2, "a": 1}
+
+		assert.True(t, tapedb.HashEqual(a, b))
+		assert.False(t, tapedb.HashEqual(a, map[string]int{"a": 1}))
+	})
+
+	t.Run("MutexByValue", func(t *testing.T) {
+		a := &mutexState{Value: 1}
+		b := &mutexState{Value: 1}
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+
+		assert.True(t, tapedb.HashEqual(a, b))
+		assert.False(t, tapedb.HashEqual(a, &mutexState{Value: 2}))
+	})
+
+	t.Run("Hasher", func(t *testing.T) {
+		assert.Equal(t, []byte("fixed"), tapedb.Hash(&hashedState{}))
+	})
+}
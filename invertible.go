@@ -0,0 +1,41 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tapedb
+
+import (
+	"fmt"
+)
+
+var ErrNotInvertible = NewError(ErrorCodeInvalidChange, "change not invertible")
+
+// Invertible can be implemented by a change that can be taken back by applying the returned change.
+type Invertible interface {
+	Invert() Change
+}
+
+// InvertChanges returns the inverses of the provided changes in reverse order, so applying them
+// takes the provided changes back. If one of the changes isn't Invertible, ErrNotInvertible is
+// returned.
+func InvertChanges(changes []Change) ([]Change, error) {
+	inverses := make([]Change, 0, len(changes))
+	for index := len(changes) - 1; index >= 0; index-- {
+		i, ok := changes[index].(Invertible)
+		if !ok {
+			return nil, fmt.Errorf("change %s: %w", changes[index].TypeName(), ErrNotInvertible)
+		}
+		inverses = append(inverses, i.Invert())
+	}
+	return inverses, nil
+}
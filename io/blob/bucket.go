@@ -0,0 +1,96 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blob
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// Bucket is the minimal object store interface the blob database is built on. Adapters for S3, GCS
+// or similar stores have to return ErrNotFound for missing keys and a Put has to replace an object
+// atomically. If the reader passed to Put fails, no object must be stored. The keys returned by
+// List may be in any order.
+type Bucket interface {
+	Get(key string) (io.ReadCloser, error)
+	Put(key string, r io.Reader) error
+	Delete(key string) error
+	List(prefix string) ([]string, error)
+}
+
+type MemoryBucket struct {
+	objects map[string][]byte
+	mutex   sync.RWMutex
+}
+
+var _ Bucket = &MemoryBucket{}
+
+func NewMemoryBucket() *MemoryBucket {
+	return &MemoryBucket{
+		objects: map[string][]byte{},
+	}
+}
+
+func (b *MemoryBucket) Get(key string) (io.ReadCloser, error) {
+	b.mutex.RLock()
+	data, ok := b.objects[key]
+	b.mutex.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (b *MemoryBucket) Put(key string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	b.mutex.Lock()
+	b.objects[key] = data
+	b.mutex.Unlock()
+	return nil
+}
+
+func (b *MemoryBucket) Delete(key string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if _, ok := b.objects[key]; !ok {
+		return ErrNotFound
+	}
+	delete(b.objects, key)
+	return nil
+}
+
+func (b *MemoryBucket) List(prefix string) ([]string, error) {
+	b.mutex.RLock()
+	keys := []string{}
+	for key := range b.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	b.mutex.RUnlock()
+
+	sort.Strings(keys)
+	return keys, nil
+}
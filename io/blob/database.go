@@ -0,0 +1,667 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blob
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/simia-tech/tapedb/v2"
+	tapeio "github.com/simia-tech/tapedb/v2/io"
+	"github.com/simia-tech/tapedb/v2/io/crypto"
+	"github.com/simia-tech/tapedb/v2/io/file"
+)
+
+// The objects of a database are stored below a prefix.
+//
+//	<prefix>/meta                    meta header including the current generation
+//	<prefix>/base/<generation>       base, missing until the first splice
+//	<prefix>/log/<generation>/<part> one log entry per part
+//	<prefix>/payload/<id>            payloads
+//
+// A splice writes the base and log of the next generation and switches to it by replacing the
+// meta object.
+const (
+	KeyMeta          = "meta"
+	KeyPrefixBase    = "base/"
+	KeyPrefixLog     = "log/"
+	KeyPrefixPayload = "payload/"
+
+	MetaFieldGeneration = "Generation"
+)
+
+var (
+	ErrMissing    = errors.New("missing")
+	ErrExisting   = errors.New("existing")
+	ErrInvalidKey = errors.New("invalid key")
+
+	// ErrCleanupFailed is returned along with the result of a successful splice if objects of the
+	// previous generation or unreferenced payloads couldn't be deleted.
+	ErrCleanupFailed = errors.New("cleanup failed")
+)
+
+type Database[B tapedb.Base, S tapedb.State] struct {
+	bucket Bucket
+	prefix string
+	meta   file.Meta
+	key    []byte
+	cipher crypto.Cipher
+	db     *tapeio.Database[B, S]
+}
+
+func CreateDatabase[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](
+	f F,
+	bucket Bucket,
+	prefix string,
+	opts ...CreateOption,
+) (*Database[B, S], error) {
+	options := defaultCreateOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	existing, err := bucket.List(objectKey(prefix, ""))
+	if err != nil {
+		return nil, fmt.Errorf("list %s: %w", prefix, err)
+	}
+	if len(existing) > 0 {
+		return nil, fmt.Errorf("create %s: %w", prefix, ErrExisting)
+	}
+
+	meta := file.Meta{}
+	if options.meta != nil {
+		meta = options.meta.Clone()
+	}
+	if options.cipher != "" {
+		meta.Set(file.MetaHeaderCipher, string(options.cipher))
+	}
+	meta.SetUInt64(MetaFieldGeneration, 0)
+
+	c, err := cipherFromMeta(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := deriveKey(options.keyFunc, meta)
+	if err != nil {
+		return nil, fmt.Errorf("derive key: %w", err)
+	}
+
+	if err := putMeta(bucket, prefix, meta); err != nil {
+		return nil, err
+	}
+
+	logW, _, err := newPartLogWriter(bucket, logKeyPrefix(prefix, 0), c, key)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := tapeio.NewDatabase[B, S](f, logW, tapeio.WithApplyFunc(options.applyFunc))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Database[B, S]{
+		bucket: bucket,
+		prefix: prefix,
+		meta:   meta,
+		key:    key,
+		cipher: c,
+		db:     db,
+	}, nil
+}
+
+func OpenDatabase[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](
+	f F,
+	bucket Bucket,
+	prefix string,
+	opts ...OpenOption,
+) (*Database[B, S], error) {
+	options := defaultOpenOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	meta, err := getMeta(bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+	generation := meta.GetUInt64(MetaFieldGeneration, 0)
+
+	c, err := cipherFromMeta(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := deriveKey(options.keyFunc, meta)
+	if err != nil {
+		return nil, fmt.Errorf("derive key: %w", err)
+	}
+
+	baseR, logR, parts, closeFn, err := openGeneration(bucket, prefix, generation, c, key)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFn()
+
+	logW, partW, err := newPartLogWriter(bucket, logKeyPrefix(prefix, generation), c, key)
+	if err != nil {
+		return nil, err
+	}
+	partW.seq = parts
+
+	db, err := tapeio.OpenDatabase[B, S](
+		f, baseR, logR, logW,
+		tapeio.WithApplyFunc(options.applyFunc),
+		tapeio.WithMigrator(options.migrator))
+	if err != nil {
+		if errors.Is(err, crypto.ErrInvalidKey) {
+			return nil, ErrInvalidKey
+		}
+		return nil, err
+	}
+
+	return &Database[B, S]{
+		bucket: bucket,
+		prefix: prefix,
+		meta:   meta,
+		key:    key,
+		cipher: c,
+		db:     db,
+	}, nil
+}
+
+func (db *Database[B, S]) Meta() file.Meta {
+	return db.meta
+}
+
+func (db *Database[B, S]) Base() B {
+	return db.db.Base()
+}
+
+func (db *Database[B, S]) State() S {
+	return db.db.State()
+}
+
+// View calls fn with the state while it's read-locked. See tapeio.Database.View.
+func (db *Database[B, S]) View(fn func(S) error) error {
+	return db.db.View(fn)
+}
+
+func (db *Database[B, S]) LogLen() int {
+	return db.db.LogLen()
+}
+
+// Apply applies the change. Payloads that are referenced by the change have to be written before.
+func (db *Database[B, S]) Apply(change tapedb.Change) error {
+	if c, ok := change.(tapedb.PayloadContainer); ok {
+		for _, id := range c.PayloadIDs() {
+			exists, err := db.payloadExists(id)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				return fmt.Errorf("reference payload with id %s: %w", id, file.ErrPayloadMissing)
+			}
+		}
+	}
+
+	return db.db.Apply(change)
+}
+
+func (db *Database[B, S]) WritePayload(id string, r io.Reader) error {
+	objKey := objectKey(db.prefix, KeyPrefixPayload+id)
+
+	exists, err := db.payloadExists(id)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("create payload with id %s: %w", id, file.ErrPayloadIDAlreadyExists)
+	}
+
+	if len(db.key) == 0 {
+		return db.bucket.Put(objKey, r)
+	}
+
+	buffer := bytes.Buffer{}
+	bw, err := crypto.NewBlockWriterWithCipher(&buffer, db.cipher, db.key, file.NonceFn)
+	if err != nil {
+		return fmt.Errorf("new block writer: %w", err)
+	}
+	if _, err := io.Copy(bw, r); err != nil {
+		return fmt.Errorf("write payload with id %s: %w", id, err)
+	}
+	if err := bw.Close(); err != nil {
+		return err
+	}
+
+	return db.bucket.Put(objKey, &buffer)
+}
+
+func (db *Database[B, S]) OpenPayload(id string) (io.ReadCloser, error) {
+	rc, err := db.bucket.Get(objectKey(db.prefix, KeyPrefixPayload+id))
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, file.ErrPayloadMissing
+		}
+		return nil, err
+	}
+
+	if len(db.key) == 0 {
+		return rc, nil
+	}
+
+	r, err := crypto.NewBlockReaderWithCipher(rc, db.cipher, db.key)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+
+	return tapeio.NewReadCloser(r, rc.Close), nil
+}
+
+func (db *Database[B, S]) DeletePayload(id string) error {
+	if err := db.bucket.Delete(objectKey(db.prefix, KeyPrefixPayload+id)); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return file.ErrPayloadMissing
+		}
+		return err
+	}
+	return nil
+}
+
+func (db *Database[B, S]) Close() error {
+	return db.db.Close()
+}
+
+func (db *Database[B, S]) payloadExists(id string) (bool, error) {
+	objKey := objectKey(db.prefix, KeyPrefixPayload+id)
+
+	keys, err := db.bucket.List(objKey)
+	if err != nil {
+		return false, err
+	}
+	for _, key := range keys {
+		if key == objKey {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func SpliceDatabase[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](
+	f F,
+	bucket Bucket,
+	prefix string,
+	opts ...SpliceOption,
+) (file.SpliceResult, error) {
+	options := defaultSpliceOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	meta, err := getMeta(bucket, prefix)
+	if err != nil {
+		return file.SpliceResult{}, err
+	}
+	generation := meta.GetUInt64(MetaFieldGeneration, 0)
+
+	c, err := cipherFromMeta(meta)
+	if err != nil {
+		return file.SpliceResult{}, err
+	}
+
+	key, err := deriveKey(options.keyFunc, meta)
+	if err != nil {
+		return file.SpliceResult{}, fmt.Errorf("derive key: %w", err)
+	}
+
+	baseR, logR, _, closeFn, err := openGeneration(bucket, prefix, generation, c, key)
+	if err != nil {
+		return file.SpliceResult{}, err
+	}
+	defer closeFn()
+
+	// objects of a failed splice might be left over in the new generation
+	newGeneration := generation + 1
+	if err := deleteGeneration(bucket, prefix, newGeneration); err != nil {
+		return file.SpliceResult{}, err
+	}
+	switched := false
+	defer func() {
+		if !switched {
+			deleteGeneration(bucket, prefix, newGeneration)
+		}
+	}()
+
+	newBaseW := newObjectWriter(bucket, baseKey(prefix, newGeneration))
+	defer newBaseW.Abort()
+	newBaseWC, err := crypto.WrapBlockWriterWithCipher(io.WriteCloser(newBaseW), c, key, file.NonceFn)
+	if err != nil {
+		return file.SpliceResult{}, fmt.Errorf("new block writer: %w", err)
+	}
+
+	newLogW, _, err := newPartLogWriter(bucket, logKeyPrefix(prefix, newGeneration), c, key)
+	if err != nil {
+		return file.SpliceResult{}, err
+	}
+
+	// the payloads referenced by the new base are expected to be the ones of the source base with
+	// the rebased changes replayed on top
+	expectedReferences, err := readBaseReferences[B, S](f, bucket, prefix, generation, c, key)
+	if err != nil {
+		return file.SpliceResult{}, fmt.Errorf("read source base references: %w", err)
+	}
+	rebaseChangeSelectFn := func(change tapedb.Change, logIndex int) (bool, error) {
+		rebase, err := options.rebaseChangeSelectFunc(change, logIndex)
+		if rebase {
+			expectedReferences.Track(change)
+		}
+		return rebase, err
+	}
+
+	references := tapedb.PayloadReferences{}
+	baseOrChangeWrittenFn := func(boc any) error {
+		references.Track(boc)
+		return nil
+	}
+
+	spliceResult, err := tapeio.SpliceDatabase[B, S](
+		f,
+		newBaseWC, newLogW,
+		baseR, logR,
+		rebaseChangeSelectFn, baseOrChangeWrittenFn,
+		tapeio.WithMigrator(options.migrator))
+	if err != nil {
+		if errors.Is(err, crypto.ErrInvalidKey) {
+			return file.SpliceResult{}, ErrInvalidKey
+		}
+		return file.SpliceResult{}, err
+	}
+
+	if err := newBaseWC.Close(); err != nil {
+		return file.SpliceResult{}, err
+	}
+	if err := newBaseW.Close(); err != nil {
+		return file.SpliceResult{}, fmt.Errorf("put base: %w", err)
+	}
+
+	// payloads that the written base doesn't reference anymore would be deleted below
+	newBaseReferences, err := readBaseReferences[B, S](f, bucket, prefix, newGeneration, c, key)
+	if err != nil {
+		return file.SpliceResult{}, fmt.Errorf("read new base references: %w", err)
+	}
+	if ids := expectedReferences.Missing(newBaseReferences); len(ids) > 0 {
+		return file.SpliceResult{}, fmt.Errorf("payloads %s: %w", strings.Join(ids, ", "), file.ErrPayloadReferenceLost)
+	}
+
+	meta.SetUInt64(MetaFieldGeneration, newGeneration)
+	if err := putMeta(bucket, prefix, meta); err != nil {
+		return file.SpliceResult{}, err
+	}
+	switched = true
+
+	result := file.SpliceResult{
+		EntriesRead:    spliceResult.EntriesRead,
+		EntriesRebased: spliceResult.EntriesRebased,
+		EntriesCopied:  spliceResult.EntriesCopied,
+		BaseSize:       spliceResult.BaseSize,
+		LogSize:        spliceResult.LogSize,
+	}
+
+	// the new generation is live at this point, so failures to clean up the old one don't fail the
+	// splice. They only leave unreachable objects behind and are reported with ErrCleanupFailed.
+	cleanupErr := deleteGeneration(bucket, prefix, generation)
+
+	kept, deleted, err := deleteUnreferencedPayloads(bucket, prefix, references)
+	result.PayloadsKept, result.PayloadsDeleted = kept, deleted
+	if cleanupErr == nil {
+		cleanupErr = err
+	}
+	if cleanupErr != nil {
+		return result, fmt.Errorf("%w: %v", ErrCleanupFailed, cleanupErr)
+	}
+
+	return result, nil
+}
+
+// openGeneration returns the base and the concatenated log parts of the provided generation as
+// well as the sequence number of the next log part. The objects are read while the readers are
+// consumed. Missing bases or logs result in nil readers.
+func openGeneration(
+	bucket Bucket,
+	prefix string,
+	generation uint64,
+	c crypto.Cipher,
+	key []byte,
+) (io.Reader, tapeio.LogReader, int64, func(), error) {
+	closers := []io.Closer{}
+	closeFn := func() {
+		for _, closer := range closers {
+			closer.Close()
+		}
+	}
+
+	baseR := io.Reader(nil)
+	if generation > 0 {
+		rc, err := bucket.Get(baseKey(prefix, generation))
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, nil, 0, nil, fmt.Errorf("get base: %w", err)
+		}
+		if rc != nil {
+			closers = append(closers, rc)
+			baseR, err = crypto.WrapBlockReaderWithCipher(rc, c, key)
+			if err != nil {
+				closeFn()
+				return nil, nil, 0, nil, fmt.Errorf("new block reader: %w", err)
+			}
+		}
+	}
+
+	partKeys, err := bucket.List(logKeyPrefix(prefix, generation))
+	if err != nil {
+		closeFn()
+		return nil, nil, 0, nil, fmt.Errorf("list log parts: %w", err)
+	}
+	if len(partKeys) == 0 {
+		return baseR, nil, 0, closeFn, nil
+	}
+	// the part keys are zero-padded, so they sort by sequence number
+	sort.Strings(partKeys)
+
+	lastSeq, err := strconv.ParseInt(path.Base(partKeys[len(partKeys)-1]), 10, 64)
+	if err != nil {
+		closeFn()
+		return nil, nil, 0, nil, fmt.Errorf("parse log part %s: %w", partKeys[len(partKeys)-1], err)
+	}
+
+	partsR := &partsReader{bucket: bucket, keys: partKeys}
+	closers = append(closers, partsR)
+
+	logR, err := crypto.WrapLogReader(tapeio.NewLogReader(partsR), key)
+	if err != nil {
+		closeFn()
+		return nil, nil, 0, nil, fmt.Errorf("new log reader: %w", err)
+	}
+
+	return baseR, logR, lastSeq + 1, closeFn, nil
+}
+
+// readBaseReferences returns the payloads that are referenced by the base of the provided
+// generation.
+func readBaseReferences[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](f F, bucket Bucket, prefix string, generation uint64, c crypto.Cipher, key []byte) (tapedb.PayloadReferences, error) {
+	baseR := io.Reader(nil)
+	if generation > 0 {
+		rc, err := bucket.Get(baseKey(prefix, generation))
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("get base: %w", err)
+		}
+		if rc != nil {
+			defer rc.Close()
+			if baseR, err = crypto.WrapBlockReaderWithCipher(rc, c, key); err != nil {
+				return nil, fmt.Errorf("new block reader: %w", err)
+			}
+		}
+	}
+
+	base, err := tapeio.ReadBase[B, S](f, baseR)
+	if err != nil {
+		return nil, err
+	}
+
+	references := tapedb.PayloadReferences{}
+	references.Track(base)
+	return references, nil
+}
+
+func deleteGeneration(bucket Bucket, prefix string, generation uint64) error {
+	keys, err := bucket.List(logKeyPrefix(prefix, generation))
+	if err != nil {
+		return fmt.Errorf("list log parts: %w", err)
+	}
+	if generation > 0 {
+		keys = append(keys, baseKey(prefix, generation))
+	}
+
+	for _, key := range keys {
+		if err := bucket.Delete(key); err != nil && !errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("delete %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func deleteUnreferencedPayloads(bucket Bucket, prefix string, references tapedb.PayloadReferences) (int, int, error) {
+	payloadPrefix := objectKey(prefix, KeyPrefixPayload)
+	keys, err := bucket.List(payloadPrefix)
+	if err != nil {
+		return 0, 0, fmt.Errorf("list payloads: %w", err)
+	}
+
+	kept, deleted := 0, 0
+	for _, key := range keys {
+		if references.Has(strings.TrimPrefix(key, payloadPrefix)) {
+			kept++
+			continue
+		}
+		if err := bucket.Delete(key); err != nil && !errors.Is(err, ErrNotFound) {
+			return kept, deleted, fmt.Errorf("delete %s: %w", key, err)
+		}
+		deleted++
+	}
+	return kept, deleted, nil
+}
+
+func getMeta(bucket Bucket, prefix string) (file.Meta, error) {
+	rc, err := bucket.Get(objectKey(prefix, KeyMeta))
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, ErrMissing
+		}
+		return nil, fmt.Errorf("get meta: %w", err)
+	}
+	defer rc.Close()
+
+	meta, err := file.ReadMeta(rc)
+	if err != nil {
+		return nil, fmt.Errorf("read meta: %w", err)
+	}
+	return meta, nil
+}
+
+func putMeta(bucket Bucket, prefix string, meta file.Meta) error {
+	buffer := bytes.Buffer{}
+	if err := file.WriteMeta(&buffer, meta); err != nil {
+		return fmt.Errorf("write meta: %w", err)
+	}
+	if err := bucket.Put(objectKey(prefix, KeyMeta), &buffer); err != nil {
+		return fmt.Errorf("put meta: %w", err)
+	}
+	return nil
+}
+
+func getObject(bucket Bucket, key string) ([]byte, error) {
+	rc, err := bucket.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func cipherFromMeta(meta file.Meta) (crypto.Cipher, error) {
+	c, err := crypto.ParseCipher(meta.Get(file.MetaHeaderCipher))
+	if err != nil {
+		return "", fmt.Errorf("parse cipher: %w", err)
+	}
+	return c, nil
+}
+
+func deriveKey(kfn file.KeyFunc, meta file.Meta) ([]byte, error) {
+	if kfn == nil {
+		return nil, nil
+	}
+	return kfn(meta)
+}
+
+func objectKey(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return strings.TrimSuffix(prefix, "/") + "/" + name
+}
+
+func baseKey(prefix string, generation uint64) string {
+	return objectKey(prefix, fmt.Sprintf("%s%010d", KeyPrefixBase, generation))
+}
+
+func logKeyPrefix(prefix string, generation uint64) string {
+	return objectKey(prefix, fmt.Sprintf("%s%010d/", KeyPrefixLog, generation))
+}
+
+func partKey(logPrefix string, seq int64) string {
+	return fmt.Sprintf("%s%020d", logPrefix, seq)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,256 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blob_test
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2/io/blob"
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestCreateDatabase(t *testing.T) {
+	t.Run("CreateMissing", func(t *testing.T) {
+		bucket := blob.NewMemoryBucket()
+
+		db, err := blob.CreateDatabase[*test.Base, *test.State](test.NewFactory(), bucket, "db")
+		require.NoError(t, err)
+		defer db.Close()
+
+		assert.Equal(t, 0, db.LogLen())
+
+		keys, err := bucket.List("db/")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"db/meta"}, keys)
+	})
+
+	t.Run("ErrorOnExisting", func(t *testing.T) {
+		bucket := blob.NewMemoryBucket()
+		require.NoError(t, bucket.Put("db/meta", strings.NewReader("")))
+
+		db, err := blob.CreateDatabase[*test.Base, *test.State](test.NewFactory(), bucket, "db")
+		require.Nil(t, db)
+		assert.ErrorIs(t, err, blob.ErrExisting)
+	})
+}
+
+func TestOpenDatabase(t *testing.T) {
+	t.Run("Reopen", func(t *testing.T) {
+		bucket := blob.NewMemoryBucket()
+		createDatabase(t, bucket)
+
+		db, err := blob.OpenDatabase[*test.Base, *test.State](test.NewFactory(), bucket, "db")
+		require.NoError(t, err)
+		defer db.Close()
+
+		assert.Equal(t, 2, db.LogLen())
+		assert.Equal(t, 21, db.State().Counter)
+
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+
+		keys, err := bucket.List("db/log/")
+		require.NoError(t, err)
+		assert.Len(t, keys, 3)
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		db, err := blob.OpenDatabase[*test.Base, *test.State](test.NewFactory(), blob.NewMemoryBucket(), "db")
+		require.Nil(t, db)
+		assert.ErrorIs(t, err, blob.ErrMissing)
+	})
+
+	t.Run("Encrypted", func(t *testing.T) {
+		bucket := blob.NewMemoryBucket()
+		createDatabase(t, bucket, blob.WithCreateKey(testKey))
+
+		db, err := blob.OpenDatabase[*test.Base, *test.State](test.NewFactory(), bucket, "db", blob.WithOpenKey(testKey))
+		require.NoError(t, err)
+		defer db.Close()
+
+		assert.Equal(t, 21, db.State().Counter)
+
+		payloadR, err := db.OpenPayload("one")
+		require.NoError(t, err)
+		defer payloadR.Close()
+		data, err := io.ReadAll(payloadR)
+		require.NoError(t, err)
+		assert.Equal(t, "payload", string(data))
+	})
+
+	t.Run("InvalidKey", func(t *testing.T) {
+		bucket := blob.NewMemoryBucket()
+		createDatabase(t, bucket, blob.WithCreateKey(testKey))
+
+		db, err := blob.OpenDatabase[*test.Base, *test.State](test.NewFactory(), bucket, "db",
+			blob.WithOpenKey([]byte("fedcba9876543210fedcba9876543210")))
+		require.Nil(t, db)
+		assert.ErrorIs(t, err, blob.ErrInvalidKey)
+	})
+}
+
+func TestSpliceDatabase(t *testing.T) {
+	bucket := blob.NewMemoryBucket()
+	createDatabase(t, bucket, blob.WithCreateKey(testKey))
+
+	db, err := blob.OpenDatabase[*test.Base, *test.State](test.NewFactory(), bucket, "db", blob.WithOpenKey(testKey))
+	require.NoError(t, err)
+	require.NoError(t, db.WritePayload("two", strings.NewReader("unreferenced")))
+	require.NoError(t, db.Close())
+
+	result, err := blob.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), bucket, "db",
+		blob.WithSpliceKey(testKey))
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.EntriesRead)
+	assert.Equal(t, 0, result.EntriesRebased)
+	assert.Equal(t, 2, result.EntriesCopied)
+	assert.Equal(t, 1, result.PayloadsKept)
+	assert.Equal(t, 1, result.PayloadsDeleted)
+
+	keys, err := bucket.List("db/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"db/base/0000000001",
+		"db/log/0000000001/00000000000000000000",
+		"db/log/0000000001/00000000000000000001",
+		"db/meta",
+		"db/payload/one",
+	}, keys)
+
+	db, err = blob.OpenDatabase[*test.Base, *test.State](test.NewFactory(), bucket, "db", blob.WithOpenKey(testKey))
+	require.NoError(t, err)
+	defer db.Close()
+
+	assert.Equal(t, 2, db.LogLen())
+	assert.Equal(t, 21, db.State().Counter)
+
+	require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+	assert.Equal(t, 22, db.State().Counter)
+
+	keys, err = bucket.List("db/log/0000000001/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"db/log/0000000001/00000000000000000000",
+		"db/log/0000000001/00000000000000000001",
+		"db/log/0000000001/00000000000000000002",
+	}, keys)
+}
+
+func TestSpliceDatabaseUnsortedList(t *testing.T) {
+	bucket := &reversedBucket{MemoryBucket: blob.NewMemoryBucket()}
+	createDatabase(t, bucket)
+
+	_, err := blob.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), bucket, "db",
+		blob.WithRebaseChangeCount(1))
+	require.NoError(t, err)
+
+	db, err := blob.OpenDatabase[*test.Base, *test.State](test.NewFactory(), bucket, "db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+	require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 2}))
+	require.NoError(t, db.Close())
+
+	db, err = blob.OpenDatabase[*test.Base, *test.State](test.NewFactory(), bucket, "db")
+	require.NoError(t, err)
+	assert.Equal(t, 3, db.LogLen())
+	assert.Equal(t, 24, db.State().Counter)
+}
+
+func TestSpliceDatabaseCleanupFailed(t *testing.T) {
+	bucket := &failingDeleteBucket{MemoryBucket: blob.NewMemoryBucket()}
+	createDatabase(t, bucket)
+	bucket.fail = true
+
+	result, err := blob.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), bucket, "db",
+		blob.WithRebaseChangeCount(1))
+	assert.ErrorIs(t, err, blob.ErrCleanupFailed)
+	assert.Equal(t, 1, result.EntriesRebased)
+
+	db, err := blob.OpenDatabase[*test.Base, *test.State](test.NewFactory(), bucket, "db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	assert.Equal(t, 1, db.LogLen())
+	assert.Equal(t, 21, db.State().Counter)
+}
+
+func TestSpliceDatabaseLostPayloadReference(t *testing.T) {
+	bucket := blob.NewMemoryBucket()
+
+	db, err := blob.CreateDatabase[*test.PlainBase, *test.State](test.NewPlainFactory(), bucket, "db")
+	require.NoError(t, err)
+	require.NoError(t, db.WritePayload("one", strings.NewReader("payload")))
+	require.NoError(t, db.Apply(&test.ChangeAttachPayload{PayloadID: "one"}))
+	require.NoError(t, db.Close())
+
+	_, err = blob.SpliceDatabase[*test.PlainBase, *test.State](test.NewPlainFactory(), bucket, "db",
+		blob.WithRebaseChangeCount(1))
+	assert.ErrorIs(t, err, file.ErrPayloadReferenceLost)
+
+	keys, err := bucket.List("db/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"db/log/0000000000/00000000000000000000",
+		"db/meta",
+		"db/payload/one",
+	}, keys)
+}
+
+type reversedBucket struct {
+	*blob.MemoryBucket
+}
+
+func (b *reversedBucket) List(prefix string) ([]string, error) {
+	keys, err := b.MemoryBucket.List(prefix)
+	sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+	return keys, err
+}
+
+type failingDeleteBucket struct {
+	*blob.MemoryBucket
+	fail bool
+}
+
+func (b *failingDeleteBucket) Delete(key string) error {
+	if b.fail && strings.HasPrefix(key, "db/log/0000000000/") {
+		return errors.New("delete failed")
+	}
+	return b.MemoryBucket.Delete(key)
+}
+
+func createDatabase(tb testing.TB, bucket blob.Bucket, opts ...blob.CreateOption) {
+	db, err := blob.CreateDatabase[*test.Base, *test.State](test.NewFactory(), bucket, "db", opts...)
+	require.NoError(tb, err)
+	defer db.Close()
+
+	require.NoError(tb, db.WritePayload("one", strings.NewReader("payload")))
+	require.NoError(tb, db.Apply(&test.ChangeAttachPayload{PayloadID: "one"}))
+	require.NoError(tb, db.Apply(&test.ChangeCounterInc{Value: 21}))
+
+	_, err = db.OpenPayload("one")
+	require.NoError(tb, err)
+	assert.ErrorIs(tb, db.WritePayload("one", strings.NewReader("")), file.ErrPayloadIDAlreadyExists)
+}
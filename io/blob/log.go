@@ -0,0 +1,161 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blob
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	tapeio "github.com/simia-tech/tapedb/v2/io"
+	"github.com/simia-tech/tapedb/v2/io/crypto"
+	"github.com/simia-tech/tapedb/v2/io/file"
+)
+
+// partLogWriter stores every log entry as a separate object, since object stores can't append.
+type partLogWriter struct {
+	bucket Bucket
+	prefix string
+	seq    int64
+}
+
+func newPartLogWriter(bucket Bucket, prefix string, c crypto.Cipher, key []byte) (tapeio.LogWriter, *partLogWriter, error) {
+	w := &partLogWriter{
+		bucket: bucket,
+		prefix: prefix,
+	}
+
+	logW, err := crypto.WrapLogWriterWithCipher(w, c, key, file.NonceFn)
+	if err != nil {
+		return nil, nil, fmt.Errorf("new log writer: %w", err)
+	}
+
+	return logW, w, nil
+}
+
+func (w *partLogWriter) WriteEntry(et tapeio.LogEntryType, data []byte) (int64, error) {
+	buffer := bytes.Buffer{}
+	n, err := tapeio.NewLogWriter(&buffer).WriteEntry(et, data)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := w.bucket.Put(partKey(w.prefix, w.seq), &buffer); err != nil {
+		return 0, fmt.Errorf("put log part: %w", err)
+	}
+	w.seq++
+
+	return n, nil
+}
+
+// partsReader reads the log parts one after another, so the log isn't held in memory. It can only
+// seek forward from the current position, which is all the log reader needs to skip entries.
+type partsReader struct {
+	bucket   Bucket
+	keys     []string
+	current  io.ReadCloser
+	position int64
+}
+
+func (r *partsReader) Read(data []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.keys) == 0 {
+				return 0, io.EOF
+			}
+			rc, err := r.bucket.Get(r.keys[0])
+			if err != nil {
+				return 0, fmt.Errorf("get log part %s: %w", r.keys[0], err)
+			}
+			r.current, r.keys = rc, r.keys[1:]
+		}
+
+		n, err := r.current.Read(data)
+		r.position += int64(n)
+		if errors.Is(err, io.EOF) {
+			r.current.Close()
+			r.current = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (r *partsReader) Seek(offset int64, whence int) (int64, error) {
+	if whence != io.SeekCurrent || offset < 0 {
+		return r.position, fmt.Errorf("seek to %d from %d: %w", offset, whence, errors.ErrUnsupported)
+	}
+	if _, err := io.CopyN(io.Discard, r, offset); err != nil {
+		return r.position, err
+	}
+	return r.position, nil
+}
+
+func (r *partsReader) Close() error {
+	if r.current == nil {
+		return nil
+	}
+	return r.current.Close()
+}
+
+// objectWriter streams the written data into an object. The object is stored once the writer is
+// closed and dropped if the writer is aborted.
+type objectWriter struct {
+	pw    *io.PipeWriter
+	done  chan error
+	err   error
+	once  sync.Once
+	mutex sync.Mutex
+}
+
+func newObjectWriter(bucket Bucket, key string) *objectWriter {
+	pr, pw := io.Pipe()
+	w := &objectWriter{pw: pw, done: make(chan error, 1)}
+	go func() {
+		err := bucket.Put(key, pr)
+		pr.CloseWithError(err)
+		w.done <- err
+	}()
+	return w
+}
+
+func (w *objectWriter) Write(data []byte) (int, error) {
+	return w.pw.Write(data)
+}
+
+// Close finishes the object and returns the error of the put.
+func (w *objectWriter) Close() error {
+	return w.finish(nil)
+}
+
+// Abort makes the put fail, unless the writer is already closed.
+func (w *objectWriter) Abort() {
+	w.finish(errObjectAborted)
+}
+
+var errObjectAborted = errors.New("object aborted")
+
+func (w *objectWriter) finish(err error) error {
+	w.once.Do(func() {
+		w.pw.CloseWithError(err)
+		w.err = <-w.done
+	})
+	return w.err
+}
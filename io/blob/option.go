@@ -0,0 +1,131 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blob
+
+import (
+	"github.com/simia-tech/tapedb/v2"
+	tapeio "github.com/simia-tech/tapedb/v2/io"
+	"github.com/simia-tech/tapedb/v2/io/crypto"
+	"github.com/simia-tech/tapedb/v2/io/file"
+)
+
+type createOptions struct {
+	meta      file.Meta
+	keyFunc   file.KeyFunc
+	cipher    crypto.Cipher
+	applyFunc tapeio.ApplyFunc
+}
+
+var defaultCreateOptions = createOptions{}
+
+type CreateOption func(*createOptions)
+
+func WithMeta(value file.Meta) CreateOption {
+	return func(o *createOptions) {
+		o.meta = value
+	}
+}
+
+func WithCreateKey(value []byte) CreateOption {
+	return WithCreateKeyFunc(file.StaticKeyFunc(value))
+}
+
+func WithCreateKeyFunc(value file.KeyFunc) CreateOption {
+	return func(o *createOptions) {
+		o.keyFunc = value
+	}
+}
+
+func WithCipher(value crypto.Cipher) CreateOption {
+	return func(o *createOptions) {
+		o.cipher = value
+	}
+}
+
+func WithCreateApplyFunc(value tapeio.ApplyFunc) CreateOption {
+	return func(o *createOptions) {
+		o.applyFunc = value
+	}
+}
+
+type openOptions struct {
+	keyFunc   file.KeyFunc
+	applyFunc tapeio.ApplyFunc
+	migrator  tapedb.ChangeMigrator
+}
+
+var defaultOpenOptions = openOptions{}
+
+type OpenOption func(*openOptions)
+
+func WithOpenKey(value []byte) OpenOption {
+	return WithOpenKeyFunc(file.StaticKeyFunc(value))
+}
+
+func WithOpenKeyFunc(value file.KeyFunc) OpenOption {
+	return func(o *openOptions) {
+		o.keyFunc = value
+	}
+}
+
+func WithOpenApplyFunc(value tapeio.ApplyFunc) OpenOption {
+	return func(o *openOptions) {
+		o.applyFunc = value
+	}
+}
+
+func WithOpenMigrations(values ...tapedb.ChangeMigrator) OpenOption {
+	return func(o *openOptions) {
+		o.migrator = tapedb.Migrations(values)
+	}
+}
+
+type spliceOptions struct {
+	keyFunc                file.KeyFunc
+	rebaseChangeSelectFunc file.RebaseChangeSelectFunc
+	migrator               tapedb.ChangeMigrator
+}
+
+var defaultSpliceOptions = spliceOptions{
+	rebaseChangeSelectFunc: file.StaticRebaseChangeSelectFunc(false),
+}
+
+type SpliceOption func(*spliceOptions)
+
+func WithSpliceKey(value []byte) SpliceOption {
+	return WithSpliceKeyFunc(file.StaticKeyFunc(value))
+}
+
+func WithSpliceKeyFunc(value file.KeyFunc) SpliceOption {
+	return func(o *spliceOptions) {
+		o.keyFunc = value
+	}
+}
+
+func WithRebaseChangeCount(value int) SpliceOption {
+	return WithRebaseChangeSelectFunc(file.CountRebaseChangeSelectFunc(value))
+}
+
+func WithRebaseChangeSelectFunc(value file.RebaseChangeSelectFunc) SpliceOption {
+	return func(o *spliceOptions) {
+		o.rebaseChangeSelectFunc = value
+	}
+}
+
+func WithSpliceMigrations(values ...tapedb.ChangeMigrator) SpliceOption {
+	return func(o *spliceOptions) {
+		o.migrator = tapedb.Migrations(values)
+	}
+}
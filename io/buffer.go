@@ -17,6 +17,7 @@ package io
 import (
 	"errors"
 	"io"
+	"math"
 )
 
 type Buffer struct {
@@ -42,12 +43,9 @@ func NewBufferString(data string) *Buffer {
 	return NewBuffer([]byte(data))
 }
 
+// Write appends a copy of the data, since writers like bufio.Writer reuse the passed slice.
 func (b *Buffer) Write(data []byte) (int, error) {
-	if b.data == nil {
-		b.data = data
-	} else {
-		b.data = append(b.data, data...)
-	}
+	b.data = append(b.data, data...)
 	return len(data), nil
 }
 
@@ -71,23 +69,26 @@ func (b *Buffer) Read(data []byte) (int, error) {
 }
 
 func (b *Buffer) Seek(offset int64, whence int) (int64, error) {
-	newReadIndex := b.readIndex
-
+	base := int64(b.readIndex)
 	switch whence {
 	case io.SeekStart:
-		newReadIndex = int(offset)
-	case io.SeekCurrent:
-		newReadIndex += int(offset)
+		base = 0
 	case io.SeekEnd:
-		newReadIndex = len(b.data) + int(offset)
+		base = int64(len(b.data))
 	}
 
-	if newReadIndex < 0 {
+	// the index is calculated in 64 bit and checked against the int range afterwards, so neither
+	// the addition nor the conversion can wrap around on 32-bit platforms
+	if offset > 0 && base > math.MaxInt64-offset {
+		return 0, ErrOutOfRange
+	}
+	newReadIndex := base + offset
+	if newReadIndex < 0 || newReadIndex > math.MaxInt {
 		return 0, ErrOutOfRange
 	}
-	b.readIndex = newReadIndex
+	b.readIndex = int(newReadIndex)
 
-	return int64(newReadIndex), nil
+	return newReadIndex, nil
 }
 
 func (b *Buffer) Bytes() []byte {
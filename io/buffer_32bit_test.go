@@ -0,0 +1,34 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build 386 || arm || mips || mipsle
+
+package io_test
+
+import (
+	"io"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	tapeio "github.com/simia-tech/tapedb/v2/io"
+)
+
+func TestBufferSeek32Bit(t *testing.T) {
+	b := tapeio.NewBufferString("test")
+
+	_, err := b.Seek(math.MaxInt32+1, io.SeekStart)
+	assert.ErrorIs(t, err, tapeio.ErrOutOfRange)
+}
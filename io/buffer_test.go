@@ -0,0 +1,64 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package io_test
+
+import (
+	"io"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	tapeio "github.com/simia-tech/tapedb/v2/io"
+)
+
+func TestBufferSeek(t *testing.T) {
+	t.Run("Start", func(t *testing.T) {
+		b := tapeio.NewBufferString("test")
+
+		offset, err := b.Seek(2, io.SeekStart)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), offset)
+
+		data, err := io.ReadAll(b)
+		require.NoError(t, err)
+		assert.Equal(t, "st", string(data))
+	})
+
+	t.Run("End", func(t *testing.T) {
+		b := tapeio.NewBufferString("test")
+
+		offset, err := b.Seek(-1, io.SeekEnd)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), offset)
+	})
+
+	t.Run("Negative", func(t *testing.T) {
+		b := tapeio.NewBufferString("test")
+
+		_, err := b.Seek(-5, io.SeekEnd)
+		assert.ErrorIs(t, err, tapeio.ErrOutOfRange)
+	})
+
+	t.Run("Overflow", func(t *testing.T) {
+		b := tapeio.NewBufferString("test")
+		_, err := b.Seek(1, io.SeekStart)
+		require.NoError(t, err)
+
+		_, err = b.Seek(math.MaxInt64, io.SeekCurrent)
+		assert.ErrorIs(t, err, tapeio.ErrOutOfRange)
+	})
+}
@@ -0,0 +1,74 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package io
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	tapedb "github.com/simia-tech/tapedb/v2"
+)
+
+var ErrChecksumMismatch = tapedb.NewError(tapedb.ErrorCodeCorrupt, "checksum mismatch")
+
+var crc32Table = crc32.MakeTable(crc32.Castagnoli)
+
+// ChecksumLogWriter appends a CRC-32C checksum to each binary entry. The entries are written with
+// the type LogEntryTypeBinaryCRC32 and are verified by the log reader.
+type ChecksumLogWriter[W LogWriter] struct {
+	w W
+}
+
+var _ LogWriter = &ChecksumLogWriter[LogWriter]{}
+
+func NewChecksumLogWriter[W LogWriter](w W) *ChecksumLogWriter[W] {
+	return &ChecksumLogWriter[W]{w: w}
+}
+
+func (w *ChecksumLogWriter[W]) WriteEntry(et LogEntryType, data []byte) (int64, error) {
+	if et != LogEntryTypeBinary {
+		return w.w.WriteEntry(et, data)
+	}
+
+	entry := make([]byte, len(data)+crc32.Size)
+	copy(entry, data)
+	binary.BigEndian.PutUint32(entry[len(data):], crc32.Checksum(data, crc32Table))
+
+	return w.w.WriteEntry(LogEntryTypeBinaryCRC32, entry)
+}
+
+func (w *ChecksumLogWriter[W]) Flush() error {
+	return FlushLogWriter(w.w)
+}
+
+func readChecksummedEntry(r io.Reader) (io.Reader, error) {
+	entry, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read all: %w", err)
+	}
+	if len(entry) < crc32.Size {
+		return nil, fmt.Errorf("entry of size %d is too short: %w", len(entry), ErrChecksumMismatch)
+	}
+
+	data, checksum := entry[:len(entry)-crc32.Size], entry[len(entry)-crc32.Size:]
+	if crc32.Checksum(data, crc32Table) != binary.BigEndian.Uint32(checksum) {
+		return nil, ErrChecksumMismatch
+	}
+
+	return bytes.NewReader(data), nil
+}
@@ -0,0 +1,62 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package io_test
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	tapeio "github.com/simia-tech/tapedb/v2/io"
+)
+
+func TestChecksumLogWriter(t *testing.T) {
+	t.Run("Write", func(t *testing.T) {
+		logBuffer := tapeio.LogBuffer{}
+		w := tapeio.NewChecksumLogWriter(&logBuffer)
+
+		n, err := w.WriteEntry(tapeio.LogEntryTypeBinary, []byte("test"))
+		require.NoError(t, err)
+		assert.Equal(t, int64(12), n)
+		assert.Equal(t, "300000087465737486a072c0", logBuffer.HexString())
+	})
+
+	t.Run("Read", func(t *testing.T) {
+		logBuffer := tapeio.NewLogBufferString("\x30\x00\x00\x08test\x86\xa0\x72\xc0")
+
+		entry, err := logBuffer.ReadEntry()
+		require.NoError(t, err)
+		assert.Equal(t, tapeio.LogEntryTypeBinaryCRC32, entry.Type())
+
+		r, err := entry.Reader()
+		require.NoError(t, err)
+
+		data, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, "test", string(data))
+	})
+
+	t.Run("ReadCorrupt", func(t *testing.T) {
+		logBuffer := tapeio.NewLogBufferString("\x30\x00\x00\x08tent\x86\xa0\x72\xc0")
+
+		entry, err := logBuffer.ReadEntry()
+		require.NoError(t, err)
+
+		_, err = entry.Reader()
+		assert.ErrorIs(t, err, tapeio.ErrChecksumMismatch)
+	})
+}
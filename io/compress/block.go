@@ -0,0 +1,111 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compress
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Algorithms that compress content that is written as a whole.
+const (
+	AlgorithmGzip = "gzip"
+	AlgorithmZstd = "zstd"
+)
+
+var ErrUnknownAlgorithm = errors.New("unknown algorithm")
+
+// BlockWriter compresses the written content with gzip or zstd. It's used for content that is
+// written as a whole, like the base.
+type BlockWriter[W io.Writer] struct {
+	w  W
+	cw io.WriteCloser
+}
+
+var _ io.WriteCloser = &BlockWriter[io.Writer]{}
+
+// WrapBlockWriter returns a BlockWriter that closes w together with itself. A nil writer is
+// returned as it is.
+func WrapBlockWriter(w io.WriteCloser, algorithm string) (io.WriteCloser, error) {
+	if w == nil {
+		return w, nil
+	}
+	return NewBlockWriter(w, algorithm)
+}
+
+func NewBlockWriter[W io.Writer](w W, algorithm string) (*BlockWriter[W], error) {
+	switch algorithm {
+	case AlgorithmGzip:
+		gw, _ := gzip.NewWriterLevel(w, gzip.BestCompression) // the level is valid
+		return &BlockWriter[W]{w: w, cw: gw}, nil
+	case AlgorithmZstd:
+		zw, err := zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedBestCompression), zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("new zstd encoder: %w", err)
+		}
+		return &BlockWriter[W]{w: w, cw: zw}, nil
+	default:
+		return nil, fmt.Errorf("algorithm %q: %w", algorithm, ErrUnknownAlgorithm)
+	}
+}
+
+func (w *BlockWriter[W]) Write(data []byte) (int, error) {
+	return w.cw.Write(data)
+}
+
+// Close writes the remaining compressed content and closes the underlying writer if it's an
+// io.Closer.
+func (w *BlockWriter[W]) Close() error {
+	if err := w.cw.Close(); err != nil {
+		return err
+	}
+	if c, ok := any(w.w).(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// WrapBlockReader returns a reader that decompresses the content of r with the provided algorithm.
+// A nil reader is returned as it is.
+func WrapBlockReader(r io.Reader, algorithm string) (io.Reader, error) {
+	if r == nil {
+		return r, nil
+	}
+	return NewBlockReader(r, algorithm)
+}
+
+func NewBlockReader(r io.Reader, algorithm string) (io.Reader, error) {
+	switch algorithm {
+	case AlgorithmGzip:
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("new gzip reader: %w", err)
+		}
+		return gr, nil
+	case AlgorithmZstd:
+		// a single goroutine decodes synchronously, so the decoder doesn't need to be closed
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("new zstd reader: %w", err)
+		}
+		return zr, nil
+	default:
+		return nil, fmt.Errorf("algorithm %q: %w", algorithm, ErrUnknownAlgorithm)
+	}
+}
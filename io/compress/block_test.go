@@ -0,0 +1,71 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compress_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2/io/compress"
+)
+
+func TestBlock(t *testing.T) {
+	testFn := func(algorithm string) func(*testing.T) {
+		return func(t *testing.T) {
+			content := strings.Repeat(`{"value":1}`, 100)
+
+			buffer := bytes.Buffer{}
+			w, err := compress.NewBlockWriter(&buffer, algorithm)
+			require.NoError(t, err)
+			_, err = io.WriteString(w, content)
+			require.NoError(t, err)
+			require.NoError(t, w.Close())
+
+			assert.Less(t, buffer.Len(), len(content))
+
+			r, err := compress.NewBlockReader(&buffer, algorithm)
+			require.NoError(t, err)
+			data, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, content, string(data))
+		}
+	}
+
+	t.Run("Gzip", testFn(compress.AlgorithmGzip))
+	t.Run("Zstd", testFn(compress.AlgorithmZstd))
+}
+
+func TestBlockUnknownAlgorithm(t *testing.T) {
+	_, err := compress.NewBlockWriter(&bytes.Buffer{}, "lz4")
+	assert.ErrorIs(t, err, compress.ErrUnknownAlgorithm)
+
+	_, err = compress.NewBlockReader(&bytes.Buffer{}, "lz4")
+	assert.ErrorIs(t, err, compress.ErrUnknownAlgorithm)
+}
+
+func TestWrapBlockNil(t *testing.T) {
+	w, err := compress.WrapBlockWriter(nil, compress.AlgorithmGzip)
+	require.NoError(t, err)
+	assert.Nil(t, w)
+
+	r, err := compress.WrapBlockReader(nil, compress.AlgorithmGzip)
+	require.NoError(t, err)
+	assert.Nil(t, r)
+}
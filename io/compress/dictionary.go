@@ -0,0 +1,126 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compress
+
+import (
+	"sort"
+)
+
+// MaxDictionarySize is the maximal size of a dictionary. It matches the maximal size that the
+// zstd reference implementation trains by default.
+const MaxDictionarySize = 112 << 10
+
+// DefaultDictionarySize is the size of a trained dictionary if no size is requested.
+const DefaultDictionarySize = 16 << 10
+
+// gramSize is the length of the substrings that are counted during training. It's a bit larger
+// than the minimal zstd match, so only matches that actually pay off are counted.
+const gramSize = 8
+
+// Train returns a dictionary of at most the provided size that holds the content that is shared
+// by most of the provided samples. A size of zero or below selects the DefaultDictionarySize. The
+// result is empty if the samples don't share anything.
+func Train(samples [][]byte, size int) []byte {
+	if size <= 0 {
+		size = DefaultDictionarySize
+	}
+	if size > MaxDictionarySize {
+		size = MaxDictionarySize
+	}
+
+	// count the number of samples each substring appears in
+	frequencies := map[string]int{}
+	for _, sample := range samples {
+		for gram := range grams(sample) {
+			frequencies[gram]++
+		}
+	}
+
+	candidates := uniqueSamples(samples)
+
+	for index := range candidates {
+		candidates[index].score = score(candidates[index].data, frequencies, nil)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+
+	// pick the best samples as long as they contribute shared substrings that aren't covered yet
+	covered := map[string]struct{}{}
+	selected := [][]byte{}
+	total := 0
+	for _, candidate := range candidates {
+		if total+len(candidate.data) > size {
+			continue
+		}
+		if score(candidate.data, frequencies, covered) == 0 {
+			continue
+		}
+		for gram := range grams(candidate.data) {
+			covered[gram] = struct{}{}
+		}
+		selected = append(selected, candidate.data)
+		total += len(candidate.data)
+	}
+
+	// the best samples go last, since zstd encodes close matches a bit shorter
+	dictionary := make([]byte, 0, total)
+	for index := len(selected) - 1; index >= 0; index-- {
+		dictionary = append(dictionary, selected[index]...)
+	}
+	return dictionary
+}
+
+type candidate struct {
+	data  []byte
+	score float64
+}
+
+func uniqueSamples(samples [][]byte) []candidate {
+	seen := map[string]struct{}{}
+	candidates := []candidate{}
+	for _, sample := range samples {
+		if len(sample) < gramSize {
+			continue
+		}
+		if _, ok := seen[string(sample)]; ok {
+			continue
+		}
+		seen[string(sample)] = struct{}{}
+		candidates = append(candidates, candidate{data: sample})
+	}
+	return candidates
+}
+
+func grams(data []byte) map[string]struct{} {
+	result := map[string]struct{}{}
+	for index := 0; index+gramSize <= len(data); index++ {
+		result[string(data[index:index+gramSize])] = struct{}{}
+	}
+	return result
+}
+
+// score returns the number of other samples that share the substrings of the provided data per
+// byte. Substrings in covered are skipped.
+func score(data []byte, frequencies map[string]int, covered map[string]struct{}) float64 {
+	sum := 0
+	for gram := range grams(data) {
+		if _, ok := covered[gram]; ok {
+			continue
+		}
+		sum += frequencies[gram] - 1
+	}
+	return float64(sum) / float64(len(data))
+}
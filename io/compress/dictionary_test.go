@@ -0,0 +1,56 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compress_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	tapeio "github.com/simia-tech/tapedb/v2/io"
+	"github.com/simia-tech/tapedb/v2/io/compress"
+)
+
+func TestTrain(t *testing.T) {
+	samples := [][]byte{}
+	for index := 0; index < 200; index++ {
+		samples = append(samples, []byte(fmt.Sprintf(
+			`{"accountId":"account-%d","operation":"transfer","amount":%d,"currency":"EUR"}`, index%7, index)))
+	}
+
+	dictionary := compress.Train(samples, 1024)
+	assert.NotEmpty(t, dictionary)
+	assert.LessOrEqual(t, len(dictionary), 1024)
+
+	compressedSize := func(dictionary []byte) int {
+		logBuffer := tapeio.LogBuffer{}
+		w, err := compress.NewLogWriter(&logBuffer, dictionary)
+		require.NoError(t, err)
+		for _, sample := range samples {
+			_, err := w.WriteEntry(tapeio.LogEntryTypeBinary, sample)
+			require.NoError(t, err)
+		}
+		return len(logBuffer.String())
+	}
+
+	assert.Less(t, compressedSize(dictionary), compressedSize(nil)*2/3)
+}
+
+func TestTrainWithoutSharedContent(t *testing.T) {
+	assert.Empty(t, compress.Train([][]byte{[]byte("abcdefghij"), []byte("klmnopqrst")}, 0))
+	assert.Empty(t, compress.Train(nil, 0))
+}
@@ -0,0 +1,234 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package compress provides log readers and writers that compress the entries of a log.
+//
+// Entries are compressed with zstd. A raw dictionary that has been trained on samples of the
+// entries improves the ratio of small, repetitive entries a lot. Each compressed entry holds a
+// zstd frame without its magic number, which names the dictionary it has been compressed with, so
+// a log can be read with any set of dictionaries that contains the used ones.
+//
+// Content that is written as a whole, like the base, is compressed with gzip or zstd by a
+// BlockWriter.
+package compress
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+
+	tapeio "github.com/simia-tech/tapedb/v2/io"
+)
+
+const (
+	formatZstd byte = 0x02
+
+	// frameMagic is the magic number in front of each zstd frame. It's the same for all entries, so
+	// it's not written.
+	frameMagic = "\x28\xb5\x2f\xfd"
+)
+
+var (
+	ErrUnknownFormat      = errors.New("unknown format")
+	ErrUnknownDictionary  = errors.New("unknown dictionary")
+	ErrDictionaryTooLarge = errors.New("dictionary too large")
+)
+
+var crc32Table = crc32.MakeTable(crc32.Castagnoli)
+
+// maxEntrySize limits the size of a decompressed entry, so a crafted entry can't exhaust the
+// memory.
+var maxEntrySize = tapeio.MaxLogEntrySize
+
+// DictionaryID returns the id that identifies the provided dictionary in a compressed entry. The
+// empty dictionary has the id 0.
+func DictionaryID(dictionary []byte) uint32 {
+	if len(dictionary) == 0 {
+		return 0
+	}
+	return crc32.Checksum(dictionary, crc32Table)
+}
+
+// LogWriter compresses each binary entry and writes it with the type LogEntryTypeCompressed.
+type LogWriter[W tapeio.LogWriter] struct {
+	w       W
+	encoder *zstd.Encoder
+}
+
+var _ tapeio.LogWriter = &LogWriter[tapeio.LogWriter]{}
+
+func WrapLogWriter(w tapeio.LogWriter, dictionary []byte) (tapeio.LogWriter, error) {
+	if w == nil {
+		return w, nil
+	}
+	return NewLogWriter(w, dictionary)
+}
+
+func NewLogWriter[W tapeio.LogWriter](w W, dictionary []byte) (*LogWriter[W], error) {
+	if len(dictionary) > MaxDictionarySize {
+		return nil, fmt.Errorf("dictionary of size %d: %w", len(dictionary), ErrDictionaryTooLarge)
+	}
+	encoder, err := zstd.NewWriter(nil, encoderOptions(dictionary)...)
+	if err != nil {
+		return nil, fmt.Errorf("new zstd encoder: %w", err)
+	}
+	return &LogWriter[W]{w: w, encoder: encoder}, nil
+}
+
+func (w *LogWriter[W]) WriteEntry(et tapeio.LogEntryType, data []byte) (int64, error) {
+	if et != tapeio.LogEntryTypeBinary {
+		return w.w.WriteEntry(et, data)
+	}
+
+	frame := w.encoder.EncodeAll(data, nil)
+	frame[len(frameMagic)-1] = formatZstd
+
+	return w.w.WriteEntry(tapeio.LogEntryTypeCompressed, frame[len(frameMagic)-1:])
+}
+
+func (w *LogWriter[W]) Flush() error {
+	return tapeio.FlushLogWriter(w.w)
+}
+
+// LogReader decompresses the compressed entries of the underlying log reader. All other entries are
+// passed through.
+type LogReader[R tapeio.LogReader] struct {
+	r            R
+	dictionaries map[uint32][]byte
+}
+
+var _ tapeio.LogReader = &LogReader[tapeio.LogReader]{}
+
+func WrapLogReader(r tapeio.LogReader, dictionaries ...[]byte) tapeio.LogReader {
+	if r == nil {
+		return r
+	}
+	return NewLogReader(r, dictionaries...)
+}
+
+func NewLogReader[R tapeio.LogReader](r R, dictionaries ...[]byte) *LogReader[R] {
+	m := make(map[uint32][]byte, len(dictionaries)+1)
+	m[0] = nil
+	for _, dictionary := range dictionaries {
+		m[DictionaryID(dictionary)] = dictionary
+	}
+	return &LogReader[R]{r: r, dictionaries: m}
+}
+
+// Offset returns the byte offset of the underlying reader if it tracks offsets.
+func (r *LogReader[R]) Offset() int64 {
+	offset, _ := tapeio.LogOffset(r.r)
+	return offset
+}
+
+func (r *LogReader[R]) ReadEntry() (tapeio.LogEntry, error) {
+	entry, err := r.r.ReadEntry()
+	if err != nil || entry.Type() != tapeio.LogEntryTypeCompressed {
+		return entry, err
+	}
+
+	return &logEntry[R]{r: r, entry: entry}, nil
+}
+
+type logEntry[R tapeio.LogReader] struct {
+	r     *LogReader[R]
+	entry tapeio.LogEntry
+}
+
+var _ tapeio.LogEntry = &logEntry[tapeio.LogReader]{}
+
+func (e *logEntry[R]) Type() tapeio.LogEntryType {
+	return tapeio.LogEntryTypeBinary
+}
+
+func (e *logEntry[R]) Reader() (io.Reader, error) {
+	r, err := e.entry.Reader()
+	if err != nil {
+		return nil, fmt.Errorf("reader: %w", err)
+	}
+
+	data, err := readAllLimited(r)
+	if err != nil {
+		return nil, fmt.Errorf("read all: %w", err)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("entry is empty")
+	}
+	if data[0] != formatZstd {
+		return nil, fmt.Errorf("format %d: %w", data[0], ErrUnknownFormat)
+	}
+	frame := append([]byte(frameMagic), data[1:]...)
+
+	header := zstd.Header{}
+	if err := header.Decode(frame); err != nil {
+		return nil, fmt.Errorf("decode frame header: %w", err)
+	}
+	dictionary, ok := e.r.dictionaries[header.DictionaryID]
+	if !ok {
+		return nil, fmt.Errorf("dictionary %08x: %w", header.DictionaryID, ErrUnknownDictionary)
+	}
+
+	zr, err := zstd.NewReader(bytes.NewReader(frame), decoderOptions(header.DictionaryID, dictionary)...)
+	if err != nil {
+		return nil, fmt.Errorf("new zstd decoder: %w", err)
+	}
+	defer zr.Close()
+
+	plainText, err := readAllLimited(zr)
+	if err != nil {
+		return nil, fmt.Errorf("decompress: %w", err)
+	}
+
+	return bytes.NewReader(plainText), nil
+}
+
+// readAllLimited reads r until EOF, but fails with ErrLogEntryTooLarge as soon as more than
+// maxEntrySize bytes are read.
+func readAllLimited(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, int64(maxEntrySize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxEntrySize {
+		return nil, fmt.Errorf("more than %d bytes: %w", maxEntrySize, tapeio.ErrLogEntryTooLarge)
+	}
+	return data, nil
+}
+
+func encoderOptions(dictionary []byte) []zstd.EOption {
+	options := []zstd.EOption{
+		zstd.WithEncoderLevel(zstd.SpeedBestCompression),
+		zstd.WithEncoderConcurrency(1),
+		zstd.WithEncoderCRC(false),
+	}
+	if len(dictionary) > 0 {
+		options = append(options, zstd.WithEncoderDictRaw(DictionaryID(dictionary), dictionary))
+	}
+	return options
+}
+
+func decoderOptions(dictionaryID uint32, dictionary []byte) []zstd.DOption {
+	options := []zstd.DOption{
+		zstd.WithDecoderConcurrency(1),
+		zstd.WithDecoderMaxWindow(uint64(tapeio.MaxLogEntrySize)),
+	}
+	if len(dictionary) > 0 {
+		options = append(options, zstd.WithDecoderDictRaw(dictionaryID, dictionary))
+	}
+	return options
+}
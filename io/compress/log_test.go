@@ -0,0 +1,128 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compress_test
+
+import (
+	"io"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	tapeio "github.com/simia-tech/tapedb/v2/io"
+	"github.com/simia-tech/tapedb/v2/io/compress"
+)
+
+var testDictionary = []byte(`{"value":`)
+
+func TestLogWriter(t *testing.T) {
+	logBuffer := tapeio.LogBuffer{}
+
+	w, err := compress.NewLogWriter(&logBuffer, testDictionary)
+	require.NoError(t, err)
+
+	_, err = w.WriteEntry(tapeio.LogEntryTypeBinary, []byte(`{"value":1}`))
+	require.NoError(t, err)
+
+	entry, err := logBuffer.ReadEntry()
+	require.NoError(t, err)
+	assert.Equal(t, tapeio.LogEntryTypeCompressed, entry.Type())
+
+	reader, err := entry.Reader()
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, byte(0x02), data[0])
+
+	header := zstd.Header{}
+	require.NoError(t, header.Decode(append([]byte("\x28\xb5\x2f\xfd"), data[1:]...)))
+	assert.Equal(t, compress.DictionaryID(testDictionary), header.DictionaryID)
+}
+
+func TestLogWriterDictionaryTooLarge(t *testing.T) {
+	_, err := compress.NewLogWriter(&tapeio.LogBuffer{}, make([]byte, compress.MaxDictionarySize+1))
+	assert.ErrorIs(t, err, compress.ErrDictionaryTooLarge)
+}
+
+func TestLogReader(t *testing.T) {
+	otherDictionary := []byte(`{"other":`)
+
+	testFn := func(writeDictionary []byte, readDictionaries [][]byte, expectErr error) func(*testing.T) {
+		return func(t *testing.T) {
+			logBuffer := tapeio.LogBuffer{}
+
+			w, err := compress.NewLogWriter(&logBuffer, writeDictionary)
+			require.NoError(t, err)
+			_, err = w.WriteEntry(tapeio.LogEntryTypeBinary, []byte(`{"value":1}`))
+			require.NoError(t, err)
+
+			r := compress.NewLogReader(&logBuffer, readDictionaries...)
+
+			entry, err := r.ReadEntry()
+			require.NoError(t, err)
+			assert.Equal(t, tapeio.LogEntryTypeBinary, entry.Type())
+
+			reader, err := entry.Reader()
+			if expectErr != nil {
+				assert.ErrorIs(t, err, expectErr)
+				return
+			}
+			require.NoError(t, err)
+
+			data, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			assert.Equal(t, `{"value":1}`, string(data))
+		}
+	}
+
+	t.Run("WithoutDictionary", testFn(nil, nil, nil))
+	t.Run("Dictionary", testFn(testDictionary, [][]byte{testDictionary}, nil))
+	t.Run("OneOfManyDictionaries", testFn(testDictionary, [][]byte{otherDictionary, testDictionary}, nil))
+	t.Run("UnknownDictionary", testFn(testDictionary, [][]byte{otherDictionary}, compress.ErrUnknownDictionary))
+}
+
+func TestLogReaderEntryTooLarge(t *testing.T) {
+	logBuffer := tapeio.LogBuffer{}
+
+	w, err := compress.NewLogWriter(&logBuffer, nil)
+	require.NoError(t, err)
+	_, err = w.WriteEntry(tapeio.LogEntryTypeBinary, make([]byte, 1024))
+	require.NoError(t, err)
+
+	defer compress.SetMaxEntrySize(1023)()
+
+	entry, err := compress.NewLogReader(&logBuffer).ReadEntry()
+	require.NoError(t, err)
+
+	_, err = entry.Reader()
+	assert.ErrorIs(t, err, tapeio.ErrLogEntryTooLarge)
+}
+
+func TestLogReaderPassThrough(t *testing.T) {
+	logBuffer := tapeio.LogBuffer{}
+	_, err := logBuffer.WriteEntry(tapeio.LogEntryTypeBinary, []byte("test"))
+	require.NoError(t, err)
+
+	entry, err := compress.NewLogReader(&logBuffer).ReadEntry()
+	require.NoError(t, err)
+
+	reader, err := entry.Reader()
+	require.NoError(t, err)
+
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "test", string(data))
+}
@@ -16,7 +16,6 @@ package crypto
 
 import (
 	"bytes"
-	"crypto/aes"
 	"crypto/cipher"
 	"crypto/sha256"
 	"encoding/binary"
@@ -24,11 +23,14 @@ import (
 	"fmt"
 	"io"
 	"strings"
+
+	tapedb "github.com/simia-tech/tapedb/v2"
+	tapeio "github.com/simia-tech/tapedb/v2/io"
 )
 
 const BlockSize = 4096
 
-var ErrInvalidKey = errors.New("invalid key")
+var ErrInvalidKey = tapedb.NewError(tapedb.ErrorCodeInvalidKey, "invalid key")
 
 type BlockWriter[W io.Writer] struct {
 	w            W
@@ -39,21 +41,24 @@ type BlockWriter[W io.Writer] struct {
 }
 
 func WrapBlockWriter(w io.WriteCloser, key []byte, nonceFn NonceFunc) (io.WriteCloser, error) {
+	return WrapBlockWriterWithCipher(w, DefaultCipher, key, nonceFn)
+}
+
+func WrapBlockWriterWithCipher(w io.WriteCloser, c Cipher, key []byte, nonceFn NonceFunc) (io.WriteCloser, error) {
 	if w == nil || len(key) == 0 {
 		return w, nil
 	}
-	return NewBlockWriter(w, key, nonceFn)
+	return NewBlockWriterWithCipher(w, c, key, nonceFn)
 }
 
 func NewBlockWriter[W io.Writer](w W, key []byte, nonceFn NonceFunc) (*BlockWriter[W], error) {
-	c, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, fmt.Errorf("new aes cipher: %w", err)
-	}
+	return NewBlockWriterWithCipher(w, DefaultCipher, key, nonceFn)
+}
 
-	gcm, err := cipher.NewGCM(c)
+func NewBlockWriterWithCipher[W io.Writer](w W, c Cipher, key []byte, nonceFn NonceFunc) (*BlockWriter[W], error) {
+	gcm, err := c.NewAEAD(key)
 	if err != nil {
-		return nil, fmt.Errorf("new gcm: %w", err)
+		return nil, err
 	}
 
 	return &BlockWriter[W]{
@@ -76,7 +81,7 @@ func (w *BlockWriter[W]) Write(data []byte) (int, error) {
 		return n, err
 	}
 
-	if w.buffer.Len() >= BlockSize {
+	for w.buffer.Len() >= BlockSize {
 		plainText, rest := w.buffer.Bytes()[:BlockSize], w.buffer.Bytes()[BlockSize:]
 
 		cipherText := w.gcm.Seal(nil, w.nonce, plainText, nil)
@@ -129,29 +134,35 @@ func (w *BlockWriter[W]) advanceNonce() {
 }
 
 type BlockReader[R io.Reader] struct {
-	r         R
-	gcm       cipher.AEAD
-	nonce     []byte
-	nonceRead bool
-	buffer    io.Reader
+	r          R
+	gcm        cipher.AEAD
+	firstNonce []byte
+	nonce      []byte
+	nonceRead  bool
+	offset     int64
+	position   int64
+	buffer     *bytes.Reader
 }
 
 func WrapBlockReader(r io.Reader, key []byte) (io.Reader, error) {
+	return WrapBlockReaderWithCipher(r, DefaultCipher, key)
+}
+
+func WrapBlockReaderWithCipher(r io.Reader, c Cipher, key []byte) (io.Reader, error) {
 	if r == nil || len(key) == 0 {
 		return r, nil
 	}
-	return NewBlockReader(r, key)
+	return NewBlockReaderWithCipher(r, c, key)
 }
 
 func NewBlockReader[R io.Reader](r R, key []byte) (*BlockReader[R], error) {
-	c, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, fmt.Errorf("new aes cipher: %w", err)
-	}
+	return NewBlockReaderWithCipher(r, DefaultCipher, key)
+}
 
-	gcm, err := cipher.NewGCM(c)
+func NewBlockReaderWithCipher[R io.Reader](r R, c Cipher, key []byte) (*BlockReader[R], error) {
+	gcm, err := c.NewAEAD(key)
 	if err != nil {
-		return nil, fmt.Errorf("new gcm: %w", err)
+		return nil, err
 	}
 
 	return &BlockReader[R]{
@@ -163,30 +174,129 @@ func NewBlockReader[R io.Reader](r R, key []byte) (*BlockReader[R], error) {
 }
 
 func (r *BlockReader[R]) Read(data []byte) (int, error) {
-	if !r.nonceRead {
-		n := make([]byte, r.gcm.NonceSize())
-		if _, err := io.ReadFull(r.r, n); err != nil {
-			return 0, fmt.Errorf("read nonce: %w", err)
+	if err := r.readNonce(); err != nil {
+		return 0, err
+	}
+
+	for r.buffer.Len() == 0 {
+		plainText, err := r.readBlock()
+		if err != nil {
+			return 0, err
 		}
-		r.nonce = n
-		r.nonceRead = true
+		r.buffer = bytes.NewReader(plainText)
 	}
 
-	br, err := r.readBlock()
-	if err == nil {
-		r.buffer = io.MultiReader(r.buffer, br)
-	} else {
-		if !errors.Is(err, io.EOF) {
+	n, err := r.buffer.Read(data)
+	r.position += int64(n)
+	return n, err
+}
+
+// Seek sets the position of the plain text. The underlying reader must implement io.Seeker. Only
+// the block that contains the new position is read and decrypted.
+func (r *BlockReader[R]) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := any(r.r).(io.Seeker)
+	if !ok {
+		return 0, tapeio.ErrNotSeekable
+	}
+
+	if err := r.readNonce(); err != nil && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+
+	position := offset
+	switch whence {
+	case io.SeekCurrent:
+		position += r.position
+	case io.SeekEnd:
+		size, err := r.size(seeker)
+		if err != nil {
 			return 0, err
 		}
+		position += size
+	}
+	if position < 0 {
+		return 0, fmt.Errorf("seek to negative position %d", position)
+	}
+
+	blockIndex := position / BlockSize
+	if _, err := seeker.Seek(r.offset+blockIndex*r.encryptedBlockSize(), io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	r.nonce = r.firstNonce
+	for index := int64(0); index < blockIndex; index++ {
+		r.advanceNonce()
 	}
+	r.buffer = bytes.NewReader([]byte{})
+
+	plainText, err := r.readBlock()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+	r.buffer = bytes.NewReader(plainText)
+	if _, err := r.buffer.Seek(position%BlockSize, io.SeekStart); err != nil {
+		return 0, err
+	}
+	r.position = position
+
+	return position, nil
+}
+
+func (r *BlockReader[R]) readNonce() error {
+	if r.nonceRead {
+		return nil
+	}
+
+	if seeker, ok := any(r.r).(io.Seeker); ok {
+		offset, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		r.offset = offset
+	}
+
+	n := make([]byte, r.gcm.NonceSize())
+	if _, err := io.ReadFull(r.r, n); err != nil {
+		if errors.Is(err, io.EOF) {
+			return io.EOF
+		}
+		return fmt.Errorf("read nonce: %w", err)
+	}
+	r.firstNonce = n
+	r.nonce = n
+	r.nonceRead = true
+	r.offset += int64(len(n))
+
+	return nil
+}
+
+func (r *BlockReader[R]) size(seeker io.Seeker) (int64, error) {
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+
+	cipherTextSize := end - r.offset
+	if cipherTextSize <= 0 {
+		return 0, nil
+	}
+
+	blocks, rest := cipherTextSize/r.encryptedBlockSize(), cipherTextSize%r.encryptedBlockSize()
+	size := blocks * BlockSize
+	if rest > 0 {
+		size += rest - 2 - int64(r.gcm.Overhead())
+	}
+
+	return size, nil
+}
 
-	return r.buffer.Read(data)
+func (r *BlockReader[R]) encryptedBlockSize() int64 {
+	return 2 + BlockSize + int64(r.gcm.Overhead())
 }
 
-func (r *BlockReader[R]) readBlock() (io.Reader, error) {
+func (r *BlockReader[R]) readBlock() ([]byte, error) {
 	size := [2]byte{}
-	if _, err := r.r.Read(size[:]); err != nil {
+	if _, err := io.ReadFull(r.r, size[:]); err != nil {
 		return nil, err
 	}
 	blockSize := binary.LittleEndian.Uint16(size[:])
@@ -205,7 +315,7 @@ func (r *BlockReader[R]) readBlock() (io.Reader, error) {
 	}
 	r.advanceNonce()
 
-	return bytes.NewReader(plainText), nil
+	return plainText, nil
 }
 
 func (r *BlockReader[W]) advanceNonce() {
@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"encoding/base64"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"strings"
 	"testing"
@@ -83,4 +84,49 @@ func TestBlockReader(t *testing.T) {
 
 		assert.Equal(t, strings.Repeat("test", (crypto.BlockSize/4)+2), string(plainText))
 	})
+
+	t.Run("Seek", func(t *testing.T) {
+		plainText := make([]byte, crypto.BlockSize*2+100)
+		for index := range plainText {
+			plainText[index] = byte(index % 251)
+		}
+
+		cipherText := bytes.Buffer{}
+
+		w, err := crypto.NewBlockWriter(&cipherText, testKey, crypto.FixedNonceFn(testNonce))
+		require.NoError(t, err)
+		_, err = w.Write(plainText)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		r, err := crypto.NewBlockReader(bytes.NewReader(cipherText.Bytes()), testKey)
+		require.NoError(t, err)
+
+		size, err := r.Seek(0, io.SeekEnd)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(plainText)), size)
+
+		for _, position := range []int64{0, 10, crypto.BlockSize - 1, crypto.BlockSize, crypto.BlockSize*2 + 50} {
+			p, err := r.Seek(position, io.SeekStart)
+			require.NoError(t, err)
+			assert.Equal(t, position, p)
+
+			data := make([]byte, 20)
+			n, err := io.ReadFull(r, data)
+			if position+20 > int64(len(plainText)) {
+				require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, plainText[position:position+int64(n)], data[:n])
+		}
+
+		p, err := r.Seek(-10, io.SeekCurrent)
+		require.NoError(t, err)
+		assert.Equal(t, int64(crypto.BlockSize*2+60), p)
+
+		rest, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, plainText[p:], rest)
+	})
 }
@@ -0,0 +1,91 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/chacha20poly1305"
+
+	tapeio "github.com/simia-tech/tapedb/v2/io"
+)
+
+type Cipher string
+
+const (
+	CipherAESGCM           Cipher = "aes-gcm"
+	CipherChaCha20Poly1305 Cipher = "chacha20poly1305"
+
+	DefaultCipher = CipherAESGCM
+)
+
+var ErrUnknownCipher = errors.New("unknown cipher")
+
+func ParseCipher(value string) (Cipher, error) {
+	if value == "" {
+		return DefaultCipher, nil
+	}
+
+	c := Cipher(value)
+	switch c {
+	case CipherAESGCM, CipherChaCha20Poly1305:
+		return c, nil
+	}
+	return "", fmt.Errorf("cipher %q: %w", value, ErrUnknownCipher)
+}
+
+func (c Cipher) NewAEAD(key []byte) (cipher.AEAD, error) {
+	switch c {
+	case CipherAESGCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("new aes cipher: %w", err)
+		}
+
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("new gcm: %w", err)
+		}
+
+		return gcm, nil
+	case CipherChaCha20Poly1305:
+		aead, err := chacha20poly1305.New(key)
+		if err != nil {
+			return nil, fmt.Errorf("new chacha20poly1305: %w", err)
+		}
+
+		return aead, nil
+	}
+	return nil, fmt.Errorf("cipher %q: %w", string(c), ErrUnknownCipher)
+}
+
+func (c Cipher) logEntryType() tapeio.LogEntryType {
+	switch c {
+	case CipherChaCha20Poly1305:
+		return tapeio.LogEntryTypeChaCha20Poly1305Encrypted
+	}
+	return tapeio.LogEntryTypeAESGCMEncrypted
+}
+
+func cipherOfLogEntryType(et tapeio.LogEntryType) Cipher {
+	switch et {
+	case tapeio.LogEntryTypeChaCha20Poly1305Encrypted:
+		return CipherChaCha20Poly1305
+	}
+	return CipherAESGCM
+}
@@ -0,0 +1,88 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypto_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	tapeio "github.com/simia-tech/tapedb/v2/io"
+	"github.com/simia-tech/tapedb/v2/io/crypto"
+)
+
+func TestParseCipher(t *testing.T) {
+	c, err := crypto.ParseCipher("")
+	require.NoError(t, err)
+	assert.Equal(t, crypto.CipherAESGCM, c)
+
+	c, err = crypto.ParseCipher("chacha20poly1305")
+	require.NoError(t, err)
+	assert.Equal(t, crypto.CipherChaCha20Poly1305, c)
+
+	_, err = crypto.ParseCipher("rot13")
+	assert.ErrorIs(t, err, crypto.ErrUnknownCipher)
+}
+
+func TestChaCha20Poly1305(t *testing.T) {
+	t.Run("Block", func(t *testing.T) {
+		cipherText := bytes.Buffer{}
+
+		w, err := crypto.NewBlockWriterWithCipher(&cipherText, crypto.CipherChaCha20Poly1305, testKey32, crypto.FixedNonceFn(testNonce))
+		require.NoError(t, err)
+
+		fmt.Fprint(w, strings.Repeat("test", (crypto.BlockSize/4)+2))
+
+		require.NoError(t, w.Close())
+
+		r, err := crypto.NewBlockReaderWithCipher(&cipherText, crypto.CipherChaCha20Poly1305, testKey32)
+		require.NoError(t, err)
+
+		plainText, err := io.ReadAll(r)
+		require.NoError(t, err)
+
+		assert.Equal(t, strings.Repeat("test", (crypto.BlockSize/4)+2), string(plainText))
+	})
+
+	t.Run("Log", func(t *testing.T) {
+		logBuffer := tapeio.LogBuffer{}
+
+		w, err := crypto.NewLogWriterWithCipher(&logBuffer, crypto.CipherChaCha20Poly1305, testKey32, crypto.FixedNonceFn(testNonce))
+		require.NoError(t, err)
+
+		_, err = w.WriteEntry(tapeio.LogEntryTypeBinary, []byte("test"))
+		require.NoError(t, err)
+
+		assert.Equal(t, "20000020", logBuffer.HexString()[:8])
+
+		r, err := crypto.NewLogReader(&logBuffer, testKey32)
+		require.NoError(t, err)
+
+		entry, err := r.ReadEntry()
+		require.NoError(t, err)
+
+		reader, err := entry.Reader()
+		require.NoError(t, err)
+
+		data, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		assert.Equal(t, "test", string(data))
+	})
+}
@@ -16,7 +16,6 @@ package crypto
 
 import (
 	"bytes"
-	"crypto/aes"
 	"crypto/cipher"
 	"fmt"
 	"io"
@@ -26,33 +25,38 @@ import (
 )
 
 type LogWriter[W tapeio.LogWriter] struct {
-	w       W
-	gcm     cipher.AEAD
-	nonceFn NonceFunc
+	w         W
+	gcm       cipher.AEAD
+	entryType tapeio.LogEntryType
+	nonceFn   NonceFunc
 }
 
 func WrapLogWriter(w tapeio.LogWriter, key []byte, nonceFn NonceFunc) (tapeio.LogWriter, error) {
+	return WrapLogWriterWithCipher(w, DefaultCipher, key, nonceFn)
+}
+
+func WrapLogWriterWithCipher(w tapeio.LogWriter, c Cipher, key []byte, nonceFn NonceFunc) (tapeio.LogWriter, error) {
 	if w == nil || len(key) == 0 {
 		return w, nil
 	}
-	return NewLogWriter(w, key, nonceFn)
+	return NewLogWriterWithCipher(w, c, key, nonceFn)
 }
 
 func NewLogWriter[W tapeio.LogWriter](w W, key []byte, nonceFn NonceFunc) (*LogWriter[W], error) {
-	c, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, fmt.Errorf("new aes cipher: %w", err)
-	}
+	return NewLogWriterWithCipher(w, DefaultCipher, key, nonceFn)
+}
 
-	gcm, err := cipher.NewGCM(c)
+func NewLogWriterWithCipher[W tapeio.LogWriter](w W, c Cipher, key []byte, nonceFn NonceFunc) (*LogWriter[W], error) {
+	gcm, err := c.NewAEAD(key)
 	if err != nil {
-		return nil, fmt.Errorf("new gcm: %w", err)
+		return nil, err
 	}
 
 	return &LogWriter[W]{
-		w:       w,
-		gcm:     gcm,
-		nonceFn: nonceFn,
+		w:         w,
+		gcm:       gcm,
+		entryType: c.logEntryType(),
+		nonceFn:   nonceFn,
 	}, nil
 }
 
@@ -61,13 +65,19 @@ func (w *LogWriter[W]) WriteEntry(et tapeio.LogEntryType, plainText []byte) (int
 
 	cipherText := w.gcm.Seal(nil, nonce, plainText, nil)
 
-	return w.w.WriteEntry(tapeio.LogEntryTypeAESGCMEncrypted, append(nonce, cipherText...))
+	return w.w.WriteEntry(w.entryType, append(nonce, cipherText...))
 }
 
+func (w *LogWriter[W]) Flush() error {
+	return tapeio.FlushLogWriter(w.w)
+}
+
+// LogReader decrypts the entries of the underlying log reader. The cipher of each entry is
+// determined by the entry type, so logs with mixed ciphers can be read.
 type LogReader[R tapeio.LogReader] struct {
-	r         R
-	gcm       cipher.AEAD
-	nonceSize int
+	r     R
+	key   []byte
+	aeads map[Cipher]cipher.AEAD
 }
 
 func WrapLogReader(r tapeio.LogReader, key []byte) (tapeio.LogReader, error) {
@@ -78,21 +88,37 @@ func WrapLogReader(r tapeio.LogReader, key []byte) (tapeio.LogReader, error) {
 }
 
 func NewLogReader[R tapeio.LogReader](r R, key []byte) (*LogReader[R], error) {
-	c, err := aes.NewCipher(key)
+	gcm, err := DefaultCipher.NewAEAD(key)
 	if err != nil {
-		return nil, fmt.Errorf("new aes cipher: %w", err)
+		return nil, err
 	}
 
-	gcm, err := cipher.NewGCM(c)
+	return &LogReader[R]{
+		r:     r,
+		key:   key,
+		aeads: map[Cipher]cipher.AEAD{DefaultCipher: gcm},
+	}, nil
+}
+
+func (r *LogReader[R]) aead(et tapeio.LogEntryType) (cipher.AEAD, error) {
+	c := cipherOfLogEntryType(et)
+	if aead, ok := r.aeads[c]; ok {
+		return aead, nil
+	}
+
+	aead, err := c.NewAEAD(r.key)
 	if err != nil {
-		return nil, fmt.Errorf("new gcm: %w", err)
+		return nil, err
 	}
+	r.aeads[c] = aead
 
-	return &LogReader[R]{
-		r:         r,
-		gcm:       gcm,
-		nonceSize: gcm.NonceSize(),
-	}, nil
+	return aead, nil
+}
+
+// Offset returns the byte offset of the underlying reader if it tracks offsets.
+func (r *LogReader[R]) Offset() int64 {
+	offset, _ := tapeio.LogOffset(r.r)
+	return offset
 }
 
 func (r *LogReader[R]) ReadEntry() (tapeio.LogEntry, error) {
@@ -126,9 +152,18 @@ func (e *logEntry[R]) Reader() (io.Reader, error) {
 		return nil, fmt.Errorf("read all: %w", err)
 	}
 
-	nonce, cipherText := data[:e.r.nonceSize], data[e.r.nonceSize:]
+	aead, err := e.r.aead(e.entry.Type())
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := aead.NonceSize()
+	if len(data) < nonceSize {
+		return nil, fmt.Errorf("entry of size %d is too short", len(data))
+	}
+	nonce, cipherText := data[:nonceSize], data[nonceSize:]
 
-	plainText, err := e.r.gcm.Open(nil, nonce, cipherText, nil)
+	plainText, err := aead.Open(nil, nonce, cipherText, nil)
 	if err != nil {
 		if strings.HasSuffix(err.Error(), "message authentication failed") {
 			return nil, ErrInvalidKey
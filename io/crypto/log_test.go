@@ -41,6 +41,26 @@ func TestLogWriter(t *testing.T) {
 		logBuffer.HexString())
 }
 
+func TestLogWriterFlush(t *testing.T) {
+	fw := &flushCountingLogWriter{}
+
+	w, err := crypto.NewLogWriter(fw, testKey, crypto.FixedNonceFn(testNonce))
+	require.NoError(t, err)
+
+	require.NoError(t, tapeio.FlushLogWriter(w))
+	assert.Equal(t, 1, fw.flushes)
+}
+
+type flushCountingLogWriter struct {
+	tapeio.LogBuffer
+	flushes int
+}
+
+func (w *flushCountingLogWriter) Flush() error {
+	w.flushes++
+	return nil
+}
+
 func TestLogReader(t *testing.T) {
 	encrypted, _ := hex.DecodeString("100000200000000000000000000000003db3f4279656006e7709353435b75d10b6d9295a")
 	logR := tapeio.NewLogBuffer(encrypted)
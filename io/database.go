@@ -16,19 +16,61 @@ package io
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"sync"
 
 	tapedb "github.com/simia-tech/tapedb/v2"
 )
 
+var ErrTypeNameTooLong = errors.New("type name too long")
+
+// ErrStateDiverged is returned by Apply once a log entry couldn't be written after its change had
+// been applied to a state that doesn't implement tapedb.Checkpointer. The state has to be rebuilt
+// from the log, either by Rebuild or by reopening the database.
+var ErrStateDiverged = tapedb.NewError(tapedb.ErrorCodeDiverged, "state diverged from log")
+
+// ErrLogLenMismatch is returned by Rebuild if fewer changes have been read than the log of the
+// database holds.
+var ErrLogLenMismatch = tapedb.NewError(tapedb.ErrorCodeCorrupt, "log length mismatch")
+
+var errStopReplay = errors.New("stop replay")
+
 type Database[B tapedb.Base, S tapedb.State] struct {
 	base       B
 	state      S
 	logW       LogWriter
-	logLen     int
+	logLen     int64
+	logOffset  int64
 	stateMutex *sync.RWMutex
+	applyFunc  ApplyFunc
+	clock      tapedb.Clock
+	codec      tapedb.Codec
+	diverged   error
+
+	projections map[string]*projection[B]
+
+	groupCommit bool
+	groupMutex  sync.Mutex
+	pending     []*commitRequest
+	committing  bool
+}
+
+type commitRequest struct {
+	change tapedb.Change
+	inline []InlinePayload
+	n      int64
+	err    error
+	done   chan struct{}
+}
+
+// stagedChange is a change whose log entry has been encoded and that has been applied to the
+// state, but whose log entry hasn't been written yet.
+type stagedChange struct {
+	entry      []byte
+	checkpoint any
 }
 
 func NewDatabase[
@@ -38,17 +80,27 @@ func NewDatabase[
 ](
 	f F,
 	logW LogWriter,
+	opts ...DatabaseOption,
 ) (*Database[B, S], error) {
+	options := defaultDatabaseOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	base := f.NewBase()
 
 	stateMutex := &sync.RWMutex{}
 	state := f.NewState(base, stateMutex.RLocker())
 
 	return &Database[B, S]{
-		base:       base,
-		state:      state,
-		logW:       logW,
-		stateMutex: stateMutex,
+		base:        base,
+		state:       state,
+		logW:        logW,
+		stateMutex:  stateMutex,
+		applyFunc:   options.applyFunc,
+		clock:       tapedb.ClockOrSystem(options.clock),
+		codec:       options.codec,
+		groupCommit: options.groupCommit,
 	}, nil
 }
 
@@ -61,44 +113,75 @@ func OpenDatabase[
 	baseR io.Reader,
 	logR LogReader,
 	logW LogWriter,
+	opts ...DatabaseOption,
 ) (*Database[B, S], error) {
-	base := f.NewBase()
+	base, err := ReadBase[B, S](f, baseR, opts...)
+	if err != nil {
+		return nil, err
+	}
 
-	if baseR != nil {
-		if _, err := base.ReadFrom(baseR); err != nil {
-			return nil, fmt.Errorf("read base: %w", err)
-		}
+	return OpenDatabaseWithBase[B, S](f, base, logR, logW, opts...)
+}
+
+// OpenDatabaseWithBase opens a database on top of an already decoded base.
+func OpenDatabaseWithBase[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](
+	f F,
+	base B,
+	logR LogReader,
+	logW LogWriter,
+	opts ...DatabaseOption,
+) (*Database[B, S], error) {
+	options := defaultDatabaseOptions
+	for _, opt := range opts {
+		opt(&options)
 	}
 
 	stateMutex := &sync.RWMutex{}
 	state := f.NewState(base, stateMutex.RLocker())
+	if cs, ok := any(state).(tapedb.ClockSetter); ok && options.replayClock != nil {
+		cs.SetClock(options.replayClock)
+	}
 
-	logLen := 0
-	err := ReadLogEntries(logR, func(entry LogEntry) error {
-		r, err := entry.Reader()
-		if err != nil {
-			return fmt.Errorf("reader: %w", err)
-		}
+	if options.stopAtIndex == 0 {
+		logR = nil
+	}
 
-		change, err := readChange[B, S, F](f, r)
-		if err != nil {
-			return fmt.Errorf("read change: %w", err)
+	logLen := int64(0)
+	replay := options.governor.start(logR)
+	err := ReadChanges[B, S](f, logR, func(logIndex int, change tapedb.Change) error {
+		if options.replayClock != nil {
+			options.replayClock.Replay(change)
+		}
+		if err := state.Apply(change); err != nil {
+			return tapedb.WrapErrorAt("apply change", int64(logIndex), err)
 		}
-
 		logLen++
-
-		return state.Apply(change)
-	})
-	if err != nil {
+		replay.entryReplayed()
+		if logLen == options.stopAtIndex {
+			return errStopReplay
+		}
+		return nil
+	}, WithMigrator(options.migrator), WithContext(options.ctx), WithInlinePayloadFunc(options.inlinePayloadFunc), WithCodec(options.codec))
+	if err != nil && !errors.Is(err, errStopReplay) {
 		return nil, fmt.Errorf("read log entries: %w", err)
 	}
+	logOffset, _ := LogOffset(logR)
 
 	return &Database[B, S]{
-		base:       base,
-		state:      state,
-		logW:       logW,
-		logLen:     logLen,
-		stateMutex: stateMutex,
+		base:        base,
+		state:       state,
+		logW:        logW,
+		logLen:      logLen,
+		logOffset:   logOffset,
+		stateMutex:  stateMutex,
+		applyFunc:   options.applyFunc,
+		clock:       tapedb.ClockOrSystem(options.clock),
+		codec:       options.codec,
+		groupCommit: options.groupCommit,
 	}, nil
 }
 
@@ -106,79 +189,538 @@ func (db *Database[B, S]) Base() B {
 	return db.base
 }
 
+// State returns the state. Its readers have to hold the read locker that has been passed to the
+// state while they read it, or read it via View.
 func (db *Database[B, S]) State() S {
 	return db.state
 }
 
+// View calls fn with the state while it's read-locked, so several fields of the state can be read
+// consistently without racing concurrent changes. Changes are blocked until fn returns, so fn must
+// neither apply changes nor take the read locker of the state again.
+func (db *Database[B, S]) View(fn func(S) error) error {
+	db.stateMutex.RLock()
+	defer db.stateMutex.RUnlock()
+
+	return fn(db.state)
+}
+
+// StateHash returns the hash of the state. The reflection-based hash is calculated while the state
+// is locked, a Hasher implementation has to take care of that itself.
+func (db *Database[B, S]) StateHash() []byte {
+	if _, ok := any(db.state).(tapedb.Hasher); !ok {
+		db.stateMutex.RLock()
+		defer db.stateMutex.RUnlock()
+	}
+	return tapedb.Hash(db.state)
+}
+
 func (db *Database[B, S]) Apply(c tapedb.Change) error {
+	return db.ApplyInline(c)
+}
+
+// ApplyInline applies the change like Apply and stores the provided payloads in the same log entry.
+func (db *Database[B, S]) ApplyInline(c tapedb.Change, payloads ...InlinePayload) error {
+	start := db.clock.Now()
+
+	n, err := db.apply(c, payloads)
+
+	if db.applyFunc != nil {
+		db.applyFunc(ApplyInfo{
+			TypeName: c.TypeName(),
+			Bytes:    n,
+			Duration: db.clock.Now().Sub(start),
+			Err:      err,
+		})
+	}
+
+	return err
+}
+
+func (db *Database[B, S]) apply(c tapedb.Change, inline []InlinePayload) (int64, error) {
+	if db.groupCommit {
+		return db.applyGrouped(c, inline)
+	}
+
 	db.stateMutex.Lock()
 	defer db.stateMutex.Unlock()
 
-	if err := db.state.Apply(c); err != nil {
-		return err
+	staged, err := db.stage(c, inline)
+	if err != nil {
+		return 0, err
 	}
 
-	if _, err := writeChange(db.logW, c); err != nil {
-		return err
+	n, err := db.logW.WriteEntry(LogEntryTypeBinary, staged.entry)
+	if err != nil {
+		db.rollback(staged, err)
+		return n, err
 	}
 
 	db.logLen++
+	db.logOffset += n
+	db.applyProjections(c)
 
-	return nil
+	return n, nil
+}
+
+// stage validates and encodes the change before it's applied to the state, so nothing is mutated if
+// either fails. The state has to be locked.
+func (db *Database[B, S]) stage(c tapedb.Change, inline []InlinePayload) (stagedChange, error) {
+	if db.diverged != nil {
+		return stagedChange{}, db.diverged
+	}
+	if err := tapedb.ValidateChange(c, db.state); err != nil {
+		return stagedChange{}, err
+	}
+
+	entry, err := encodeChange(c, inline, db.codec)
+	if err != nil {
+		return stagedChange{}, err
+	}
+
+	staged := stagedChange{entry: entry}
+	if cp, ok := any(db.state).(tapedb.Checkpointer); ok {
+		staged.checkpoint = cp.Checkpoint()
+	}
+	if err := db.state.Apply(c); err != nil {
+		return stagedChange{}, err
+	}
+
+	return staged, nil
+}
+
+// rollback takes back the staged change and all changes that have been applied after it. If the
+// state can't be rolled back, the database refuses further changes. The state has to be locked.
+func (db *Database[B, S]) rollback(staged stagedChange, err error) {
+	if cp, ok := any(db.state).(tapedb.Checkpointer); ok {
+		cp.Rollback(staged.checkpoint)
+		return
+	}
+	db.diverged = fmt.Errorf("%v: %w", err, ErrStateDiverged)
+}
+
+// applyGrouped queues the change for the next group commit. The first caller that finds no
+// commit in progress becomes the leader and commits batches until the queue is empty. All
+// other callers wait until their batch got committed.
+func (db *Database[B, S]) applyGrouped(c tapedb.Change, inline []InlinePayload) (int64, error) {
+	req := &commitRequest{change: c, inline: inline, done: make(chan struct{})}
+
+	db.groupMutex.Lock()
+	db.pending = append(db.pending, req)
+	if db.committing {
+		db.groupMutex.Unlock()
+		<-req.done
+		return req.n, req.err
+	}
+	db.committing = true
+
+	for len(db.pending) > 0 {
+		batch := db.pending
+		db.pending = nil
+		db.groupMutex.Unlock()
+
+		db.commit(batch)
+
+		db.groupMutex.Lock()
+	}
+	db.committing = false
+	db.groupMutex.Unlock()
+
+	return req.n, req.err
+}
+
+func (db *Database[B, S]) commit(batch []*commitRequest) {
+	db.stateMutex.Lock()
+	defer db.stateMutex.Unlock()
+
+	written := make([]*commitRequest, 0, len(batch))
+	first := stagedChange{}
+	for _, req := range batch {
+		staged, err := db.stage(req.change, req.inline)
+		if err != nil {
+			req.err = err
+			continue
+		}
+
+		req.n, req.err = db.logW.WriteEntry(LogEntryTypeBinary, staged.entry)
+		if req.err != nil {
+			db.rollback(staged, req.err)
+			continue
+		}
+		if len(written) == 0 {
+			first = staged
+		}
+		written = append(written, req)
+	}
+
+	if len(written) > 0 {
+		if err := FlushLogWriter(db.logW); err != nil {
+			db.rollback(first, err)
+			for _, req := range written {
+				req.err = err
+			}
+		} else {
+			db.logLen += int64(len(written))
+			for _, req := range written {
+				db.logOffset += req.n
+				db.applyProjections(req.change)
+			}
+		}
+	}
+
+	for _, req := range batch {
+		close(req.done)
+	}
+}
+
+// Flush writes buffered log data to the underlying writer.
+func (db *Database[B, S]) Flush() error {
+	db.stateMutex.Lock()
+	defer db.stateMutex.Unlock()
+
+	return FlushLogWriter(db.logW)
 }
 
 func (db *Database[B, S]) Close() error {
+	return db.Flush()
+}
+
+// Rebase replaces the base and the log writer after the log has been spliced. The state is kept,
+// since the new base and log lead to the same state. The log length and offset describe the new
+// log. The old log writer has to be flushed and no change must be applied concurrently.
+func (db *Database[B, S]) Rebase(base B, logW LogWriter, logLen, logOffset int64) {
+	db.stateMutex.Lock()
+	defer db.stateMutex.Unlock()
+
+	db.base = base
+	db.logW = logW
+	db.logLen = logLen
+	db.logOffset = logOffset
+}
+
+// Rebuild derives the state and the projections again from the base and the changes that are
+// passed by readChanges, e.g. after the projection logic of the state has been changed or the state
+// got corrupted. The log is flushed before readChanges is called, which has to pass all changes of
+// the log. Changes are blocked until the state is rebuilt. If the changes can't be read or applied,
+// the old state is kept. Otherwise, a database whose state diverged from the log accepts changes
+// again. State and Projection have to be called again to get the rebuilt ones.
+func (db *Database[B, S]) Rebuild(
+	f tapedb.Factory[B, S],
+	readChanges func(func(int, tapedb.Change) error) error,
+	opts ...DatabaseOption,
+) error {
+	options := defaultDatabaseOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	db.stateMutex.Lock()
+	defer db.stateMutex.Unlock()
+
+	state := f.NewState(db.base, db.stateMutex.RLocker())
+	if cs, ok := any(state).(tapedb.ClockSetter); ok && options.replayClock != nil {
+		cs.SetClock(options.replayClock)
+	}
+	projections := make(map[string]*projection[B], len(db.projections))
+	for name, p := range db.projections {
+		projections[name] = &projection[B]{newFn: p.newFn, state: p.newFn(db.base, db.stateMutex.RLocker())}
+	}
+
+	err := db.replay(readChanges, func(logIndex int, change tapedb.Change) error {
+		if options.replayClock != nil {
+			options.replayClock.Replay(change)
+		}
+		if err := state.Apply(change); err != nil {
+			return tapedb.WrapErrorAt("apply change", int64(logIndex), err)
+		}
+		for _, p := range projections {
+			p.apply(change)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	db.state = state
+	db.projections = projections
+	db.diverged = nil
+
 	return nil
 }
 
 func (db *Database[B, S]) LogLen() int {
+	return int(db.LogLen64())
+}
+
+func (db *Database[B, S]) LogLen64() int64 {
+	db.stateMutex.RLock()
+	defer db.stateMutex.RUnlock()
 	return db.logLen
 }
 
-func writeChange[W LogWriter](w W, c tapedb.Change) (int64, error) {
+// LogOffset returns the size of the log in bytes. It can be used as starting point to read new
+// entries from the log.
+func (db *Database[B, S]) LogOffset() int64 {
+	db.stateMutex.RLock()
+	defer db.stateMutex.RUnlock()
+	return db.logOffset
+}
+
+func ReadChanges[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](
+	f F,
+	logR LogReader,
+	fn func(int, tapedb.Change) error,
+	opts ...DatabaseOption,
+) error {
+	options := defaultDatabaseOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	logIndex := 0
+	return ReadLogEntries(logR, func(entry LogEntry) error {
+		if err := options.ctx.Err(); err != nil {
+			return err
+		}
+
+		r, err := entry.Reader()
+		if err != nil {
+			return tapedb.WrapErrorAt("read entry", int64(logIndex), err)
+		}
+
+		change, inline, err := readChange[B, S, F](f, r, options.migrator, options.codec)
+		if err != nil {
+			return tapedb.WrapErrorAt("read change", int64(logIndex), err)
+		}
+		if len(inline) > 0 && options.inlinePayloadFunc != nil {
+			if err := options.inlinePayloadFunc(logIndex, inline); err != nil {
+				return err
+			}
+		}
+
+		if err := fn(logIndex, change); err != nil {
+			return err
+		}
+		logIndex++
+
+		return nil
+	})
+}
+
+// CopyChanges writes the changes of the log reader to the log writer like SpliceDatabase copies the
+// changes that aren't rebased. writtenFn is called with each written change. The number of copied
+// entries and their size is returned.
+func CopyChanges[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](
+	f F,
+	logW LogWriter,
+	logR LogReader,
+	writtenFn func(tapedb.Change) error,
+	opts ...DatabaseOption,
+) (int, int64, error) {
+	options := defaultDatabaseOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	copied, size := 0, int64(0)
+	err := ReadLogEntries(logR, func(entry LogEntry) error {
+		if err := options.ctx.Err(); err != nil {
+			return err
+		}
+
+		r, err := entry.Reader()
+		if err != nil {
+			return err
+		}
+
+		change, inline, err := readChange[B, S, F](f, r, options.migrator, options.codec)
+		if err != nil {
+			return err
+		}
+
+		n, err := writeChange(logW, change, inline, options.codec)
+		if err != nil {
+			return fmt.Errorf("write change: %w", err)
+		}
+		copied++
+		size += n
+
+		return writtenFn(change)
+	})
+	if err != nil {
+		return copied, size, fmt.Errorf("read log entries: %w", err)
+	}
+	return copied, size, nil
+}
+
+func writeChange[W LogWriter](w W, c tapedb.Change, inline []InlinePayload, codec tapedb.Codec) (int64, error) {
+	entry, err := encodeChange(c, inline, codec)
+	if err != nil {
+		return 0, err
+	}
+	return w.WriteEntry(LogEntryTypeBinary, entry)
+}
+
+func encodeChange(c tapedb.Change, inline []InlinePayload, codec tapedb.Codec) ([]byte, error) {
 	typeName := c.TypeName()
+	if typeName == "" {
+		return nil, ErrEmptyTypeName
+	}
+	if len(typeName) > math.MaxUint8 {
+		return nil, fmt.Errorf("type name %q: %w", typeName, ErrTypeNameTooLong)
+	}
 
 	buffer := bytes.Buffer{}
+	writeInlinePayloads(&buffer, inline)
 	buffer.WriteByte(byte(len(typeName)))
 	buffer.WriteString(typeName)
 
-	if _, err := c.WriteTo(&buffer); err != nil {
-		return 0, err
+	if _, err := tapedb.WriteWithCodec(&buffer, codec, c); err != nil {
+		return nil, err
 	}
 
-	return w.WriteEntry(LogEntryTypeBinary, buffer.Bytes())
+	return buffer.Bytes(), nil
 }
 
-func readChange[
+// ReadBase returns a new base that is read from r. A nil reader results in an empty base.
+func ReadBase[
 	B tapedb.Base,
 	S tapedb.State,
 	F tapedb.Factory[B, S],
 ](
 	f F,
 	r io.Reader,
+	opts ...DatabaseOption,
+) (B, error) {
+	options := defaultDatabaseOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	base := f.NewBase()
+	if r != nil {
+		if _, err := tapedb.ReadWithCodec(r, options.codec, base); err != nil {
+			return base, fmt.Errorf("read base: %w", err)
+		}
+	}
+	return base, nil
+}
+
+func ReadChange[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](
+	f F,
+	r io.Reader,
+	opts ...DatabaseOption,
 ) (tapedb.Change, error) {
-	sizeBytes := [1]byte{}
-	if _, err := io.ReadFull(r, sizeBytes[:]); err != nil {
-		return nil, fmt.Errorf("read type name size: %w", err)
+	options := defaultDatabaseOptions
+	for _, opt := range opts {
+		opt(&options)
 	}
-	size := sizeBytes[0]
 
-	typeNameBytes := make([]byte, size)
-	if _, err := io.ReadFull(r, typeNameBytes); err != nil {
-		return nil, fmt.Errorf("read type name of size %d: %w", size, err)
+	change, _, err := readChange[B, S, F](f, r, nil, options.codec)
+	return change, err
+}
+
+func readChange[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](
+	f F,
+	r io.Reader,
+	m tapedb.ChangeMigrator,
+	codec tapedb.Codec,
+) (tapedb.Change, []InlinePayload, error) {
+	typeName, inline, err := readTypeName(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if m != nil {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read change data: %w", err)
+		}
+		storedTypeName := typeName
+		typeName, data, err = m.MigrateChange(typeName, data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("migrate change %q: %w", storedTypeName, err)
+		}
+		r = bytes.NewReader(data)
 	}
-	typeName := string(typeNameBytes)
 
 	change, err := f.NewChange(typeName)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	if _, err := change.ReadFrom(r); err != nil {
-		return nil, err
+	if _, err := tapedb.ReadWithCodec(r, codec, change); err != nil {
+		return nil, nil, err
+	}
+
+	return change, inline, nil
+}
+
+// ReadRawChange reads the type name and the encoded data of a change without decoding it.
+func ReadRawChange(r io.Reader) (string, []byte, error) {
+	typeName, _, err := readTypeName(r)
+	if err != nil {
+		return "", nil, err
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", nil, fmt.Errorf("read change data: %w", err)
 	}
 
-	return change, nil
+	return typeName, data, nil
+}
+
+// readTypeName reads the type name of a change and the inline payloads that might precede it.
+func readTypeName(r io.Reader) (string, []InlinePayload, error) {
+	sizeBytes := [1]byte{}
+	if _, err := io.ReadFull(r, sizeBytes[:]); err != nil {
+		return "", nil, fmt.Errorf("read type name size: %w", err)
+	}
+
+	inline := []InlinePayload(nil)
+	if sizeBytes[0] == inlineMarker {
+		var err error
+		if inline, err = readInlinePayloads(r); err != nil {
+			return "", nil, err
+		}
+		if _, err := io.ReadFull(r, sizeBytes[:]); err != nil {
+			return "", nil, fmt.Errorf("read type name size: %w", err)
+		}
+	}
+	size := sizeBytes[0]
+
+	typeNameBytes := make([]byte, size)
+	if _, err := io.ReadFull(r, typeNameBytes); err != nil {
+		return "", nil, fmt.Errorf("read type name of size %d: %w", size, err)
+	}
+
+	return string(typeNameBytes), inline, nil
+}
+
+type SpliceResult struct {
+	EntriesRead    int
+	EntriesRebased int
+	EntriesCopied  int
+	BaseSize       int64
+	LogSize        int64
 }
 
 func SpliceDatabase[
@@ -193,28 +735,39 @@ func SpliceDatabase[
 	logR LogReader,
 	rebaseChangeSelectFn func(tapedb.Change, int) (bool, error),
 	baseOrChangeWrittenFn func(any) error,
-) error {
-	base := f.NewBase()
-	if baseR != nil {
-		if _, err := base.ReadFrom(baseR); err != nil {
-			return fmt.Errorf("read base: %w", err)
-		}
+	opts ...DatabaseOption,
+) (SpliceResult, error) {
+	options := defaultDatabaseOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	result := SpliceResult{}
+
+	base, err := ReadBase[B, S](f, baseR, WithCodec(options.codec))
+	if err != nil {
+		return result, err
 	}
 
 	logIndex := 0
 	rebase := true
 	baseWritten := false
 
-	err := ReadLogEntries(logR, func(entry LogEntry) error {
+	err = ReadLogEntries(logR, func(entry LogEntry) error {
+		if err := options.ctx.Err(); err != nil {
+			return err
+		}
+
 		r, err := entry.Reader()
 		if err != nil {
 			return err
 		}
 
-		change, err := readChange[B, S, F](f, r)
+		change, inline, err := readChange[B, S, F](f, r, options.migrator, options.codec)
 		if err != nil {
 			return err
 		}
+		result.EntriesRead++
 
 		switch {
 		case rebase:
@@ -227,14 +780,23 @@ func SpliceDatabase[
 				if err := base.Apply(change); err != nil {
 					return fmt.Errorf("apply change to base: %w", err)
 				}
+				// the inline payloads of rebased changes have to be stored elsewhere
+				if len(inline) > 0 && options.inlinePayloadFunc != nil {
+					if err := options.inlinePayloadFunc(logIndex, inline); err != nil {
+						return err
+					}
+				}
+				result.EntriesRebased++
 				break
 			}
 
 			fallthrough
 		case !baseWritten:
-			if _, err := base.WriteTo(baseW); err != nil {
+			n, err := tapedb.WriteWithCodec(baseW, options.codec, base)
+			if err != nil {
 				return fmt.Errorf("write base: %w", err)
 			}
+			result.BaseSize = n
 			if err := baseOrChangeWrittenFn(base); err != nil {
 				return err
 			}
@@ -242,29 +804,38 @@ func SpliceDatabase[
 
 			fallthrough
 		default:
-			if _, err := writeChange(logW, change); err != nil {
+			n, err := writeChange(logW, change, inline, options.codec)
+			if err != nil {
 				return fmt.Errorf("write change: %w", err)
 			}
+			result.EntriesCopied++
+			result.LogSize += n
 			if err := baseOrChangeWrittenFn(change); err != nil {
 				return err
 			}
 		}
 		logIndex++
 
+		if options.spliceProgressFunc != nil {
+			options.spliceProgressFunc(result)
+		}
+
 		return nil
 	})
 	if err != nil {
-		return fmt.Errorf("read log entries: %w", err)
+		return result, fmt.Errorf("read log entries: %w", err)
 	}
 
 	if !baseWritten {
-		if _, err := base.WriteTo(baseW); err != nil {
-			return fmt.Errorf("write base: %w", err)
+		n, err := tapedb.WriteWithCodec(baseW, options.codec, base)
+		if err != nil {
+			return result, fmt.Errorf("write base: %w", err)
 		}
+		result.BaseSize = n
 		if err := baseOrChangeWrittenFn(base); err != nil {
-			return err
+			return result, err
 		}
 	}
 
-	return nil
+	return result, nil
 }
@@ -16,8 +16,12 @@ package io_test
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -41,6 +45,39 @@ func TestIO(t *testing.T) {
 		assert.Equal(t, "\x00\x00\x00\x18\x0bcounter-inc{\"value\":1}\n", logBuffer.String())
 	})
 
+	t.Run("NewDatabaseWithApplyFunc", func(t *testing.T) {
+		logBuffer := io.LogBuffer{}
+		infos := []io.ApplyInfo{}
+
+		db, err := io.NewDatabase[*test.Base, *test.State](
+			test.NewFactory(),
+			&logBuffer,
+			io.WithApplyFunc(func(info io.ApplyInfo) {
+				infos = append(infos, info)
+			}))
+		require.NoError(t, err)
+
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+
+		require.Len(t, infos, 1)
+		assert.Equal(t, "counter-inc", infos[0].TypeName)
+		assert.Equal(t, int64(28), infos[0].Bytes)
+		assert.NoError(t, infos[0].Err)
+	})
+
+	t.Run("TypeNameTooLong", func(t *testing.T) {
+		logBuffer := io.LogBuffer{}
+
+		db, err := io.NewDatabase[*test.Base, *test.State](
+			test.NewFactory(),
+			&logBuffer)
+		require.NoError(t, err)
+
+		err = db.Apply(&longTypeNameChange{})
+		assert.ErrorIs(t, err, io.ErrTypeNameTooLong)
+		assert.Equal(t, "", logBuffer.String())
+	})
+
 	t.Run("OpenDatabase", func(t *testing.T) {
 		base := "{\"value\":20}\n"
 		log := io.NewLogBufferString("\x00\x00\x00\x18\x0bcounter-inc{\"value\":2}\n\x00\x00\x00\x18\x0bcounter-inc{\"value\":1}\n")
@@ -54,8 +91,10 @@ func TestIO(t *testing.T) {
 		require.NoError(t, err)
 
 		assert.Equal(t, 23, db.State().Counter)
+		assert.Equal(t, int64(56), db.LogOffset())
 
 		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 3}))
+		assert.Equal(t, int64(84), db.LogOffset())
 
 		assert.Equal(t, "\x00\x00\x00\x18\x0bcounter-inc{\"value\":3}\n", logBuffer.String())
 	})
@@ -66,7 +105,7 @@ func TestIO(t *testing.T) {
 		newBase := bytes.Buffer{}
 		newLog := io.LogBuffer{}
 
-		err := io.SpliceDatabase[*test.Base, *test.State](
+		result, err := io.SpliceDatabase[*test.Base, *test.State](
 			test.NewFactory(),
 			&newBase, &newLog,
 			strings.NewReader(base), log,
@@ -76,8 +115,259 @@ func TestIO(t *testing.T) {
 				return nil
 			})
 		require.NoError(t, err)
+		assert.Equal(t, io.SpliceResult{
+			EntriesRead:    2,
+			EntriesRebased: 1,
+			EntriesCopied:  1,
+			BaseSize:       13,
+			LogSize:        28,
+		}, result)
 
 		assert.Equal(t, "{\"value\":22}\n", newBase.String())
 		assert.Equal(t, "\x00\x00\x00\x18\x0bcounter-inc{\"value\":1}\n", newLog.String())
 	})
+
+	t.Run("SpliceDatabaseProgress", func(t *testing.T) {
+		base := "{\"value\":20}\n"
+		log := io.NewLogBufferString("\x00\x00\x00\x18\x0bcounter-inc{\"value\":2}\n\x00\x00\x00\x18\x0bcounter-inc{\"value\":1}\n")
+
+		progress := []io.SpliceResult{}
+		_, err := io.SpliceDatabase[*test.Base, *test.State](
+			test.NewFactory(),
+			&bytes.Buffer{}, &io.LogBuffer{},
+			strings.NewReader(base), log,
+			func(_ tapedb.Change, logIndex int) (bool, error) {
+				return logIndex < 1, nil
+			}, func(_ any) error {
+				return nil
+			},
+			io.WithSpliceProgressFunc(func(result io.SpliceResult) {
+				progress = append(progress, result)
+			}))
+		require.NoError(t, err)
+		assert.Equal(t, []io.SpliceResult{
+			{EntriesRead: 1, EntriesRebased: 1},
+			{EntriesRead: 2, EntriesRebased: 1, EntriesCopied: 1, BaseSize: 13, LogSize: 28},
+		}, progress)
+	})
+
+	t.Run("CopyChanges", func(t *testing.T) {
+		log := io.NewLogBufferString("\x00\x00\x00\x18\x0bcounter-inc{\"value\":2}\n\x00\x00\x00\x18\x0bcounter-inc{\"value\":1}\n")
+		newLog := io.LogBuffer{}
+
+		written := []tapedb.Change{}
+		copied, size, err := io.CopyChanges[*test.Base, *test.State](
+			test.NewFactory(),
+			&newLog, log,
+			func(change tapedb.Change) error {
+				written = append(written, change)
+				return nil
+			})
+		require.NoError(t, err)
+		assert.Equal(t, 2, copied)
+		assert.Equal(t, int64(56), size)
+		assert.Len(t, written, 2)
+		assert.Equal(t, log.String(), newLog.String())
+	})
+
+	t.Run("Rebase", func(t *testing.T) {
+		base := "{\"value\":20}\n"
+		log := io.NewLogBufferString("\x00\x00\x00\x18\x0bcounter-inc{\"value\":2}\n")
+		logBuffer := io.LogBuffer{}
+
+		db, err := io.OpenDatabase[*test.Base, *test.State](
+			test.NewFactory(),
+			strings.NewReader(base),
+			log,
+			&logBuffer)
+		require.NoError(t, err)
+
+		newLogBuffer := io.LogBuffer{}
+		db.Rebase(&test.Base{Value: 22}, &newLogBuffer, 0, 0)
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+
+		assert.Equal(t, 22, db.Base().Value)
+		assert.Equal(t, 23, db.State().Counter)
+		assert.Equal(t, 1, db.LogLen())
+		assert.Equal(t, int64(28), db.LogOffset())
+		assert.Equal(t, "", logBuffer.String())
+		assert.Equal(t, "\x00\x00\x00\x18\x0bcounter-inc{\"value\":1}\n", newLogBuffer.String())
+	})
+
+	t.Run("View", func(t *testing.T) {
+		db, err := io.NewDatabase[*test.Base, *test.State](test.NewFactory(), &io.LogBuffer{})
+		require.NoError(t, err)
+
+		wg := sync.WaitGroup{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := 0; index < 100; index++ {
+				assert.NoError(t, db.Apply(&test.ChangeItemAdd{ID: fmt.Sprintf("%d", index)}))
+				assert.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+			}
+		}()
+
+		for index := 0; index < 100; index++ {
+			require.NoError(t, db.View(func(state *test.State) error {
+				// both changes of an iteration are applied one by one
+				assert.LessOrEqual(t, state.Counter, len(state.Items))
+				assert.GreaterOrEqual(t, state.Counter, len(state.Items)-1)
+				return nil
+			}))
+		}
+		wg.Wait()
+
+		errTest := errors.New("test")
+		assert.ErrorIs(t, db.View(func(*test.State) error {
+			return errTest
+		}), errTest)
+	})
+
+	t.Run("Rebuild", func(t *testing.T) {
+		logBuffer := io.LogBuffer{}
+		db, err := io.NewDatabase[*test.Base, *test.State](test.NewFactory(), &logBuffer)
+		require.NoError(t, err)
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 2}))
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 3}))
+
+		readChanges := func(fn func(int, tapedb.Change) error) error {
+			return io.ReadChanges[*test.Base, *test.State](test.NewFactory(), io.NewLogBufferString(logBuffer.String()), fn)
+		}
+
+		db.State().Counter = 42
+		require.NoError(t, db.Rebuild(test.NewFactory(), readChanges))
+		assert.Equal(t, 5, db.State().Counter)
+
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+		assert.Equal(t, 6, db.State().Counter)
+		assert.Equal(t, 3, db.LogLen())
+	})
+
+	t.Run("RebuildIncomplete", func(t *testing.T) {
+		logBuffer := io.LogBuffer{}
+		db, err := io.NewDatabase[*test.Base, *test.State](test.NewFactory(), &logBuffer)
+		require.NoError(t, err)
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 2}))
+
+		state := db.State()
+		err = db.Rebuild(test.NewFactory(), func(func(int, tapedb.Change) error) error {
+			return nil
+		})
+		assert.ErrorIs(t, err, io.ErrLogLenMismatch)
+		assert.Same(t, state, db.State())
+
+		errTest := errors.New("test")
+		err = db.Rebuild(test.NewFactory(), func(func(int, tapedb.Change) error) error {
+			return errTest
+		})
+		assert.ErrorIs(t, err, errTest)
+		assert.Same(t, state, db.State())
+	})
+
+	t.Run("GroupCommit", func(t *testing.T) {
+		logW := &blockingFlushLogWriter{flushing: make(chan struct{}), release: make(chan struct{})}
+
+		db, err := io.NewDatabase[*test.Base, *test.State](
+			test.NewFactory(),
+			logW,
+			io.WithGroupCommit())
+		require.NoError(t, err)
+
+		wg := sync.WaitGroup{}
+		apply := func() {
+			defer wg.Done()
+			assert.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+		}
+
+		wg.Add(1)
+		go apply()
+		<-logW.flushing
+
+		wg.Add(9)
+		for index := 0; index < 9; index++ {
+			go apply()
+		}
+		time.Sleep(50 * time.Millisecond)
+		close(logW.release)
+		wg.Wait()
+
+		assert.Equal(t, 10, db.State().Counter)
+		assert.Equal(t, 10, db.LogLen())
+		assert.Equal(t, 2, logW.flushes)
+	})
+}
+
+type blockingFlushLogWriter struct {
+	io.LogBuffer
+	flushes  int
+	flushing chan struct{}
+	release  chan struct{}
+}
+
+func (w *blockingFlushLogWriter) Flush() error {
+	w.flushes++
+	if w.flushes == 1 {
+		close(w.flushing)
+		<-w.release
+	}
+	return nil
+}
+
+type longTypeNameChange struct {
+	test.ChangeCounterInc
+}
+
+func (c *longTypeNameChange) TypeName() string {
+	return strings.Repeat("x", 256)
+}
+
+func TestInlinePayloads(t *testing.T) {
+	logBuffer := io.LogBuffer{}
+
+	db, err := io.NewDatabase[*test.Base, *test.State](test.NewFactory(), &logBuffer)
+	require.NoError(t, err)
+	require.NoError(t, db.ApplyInline(
+		&test.ChangeAttachPayload{PayloadID: "123"},
+		io.InlinePayload{ID: "123", Data: []byte("test")}))
+	require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+
+	logR := io.NewLogBufferString(logBuffer.String())
+	payloads := map[int][]io.InlinePayload{}
+	changes := []tapedb.Change{}
+	require.NoError(t, io.ReadChanges[*test.Base, *test.State](test.NewFactory(), logR, func(_ int, change tapedb.Change) error {
+		changes = append(changes, change)
+		return nil
+	}, io.WithInlinePayloadFunc(func(logIndex int, inline []io.InlinePayload) error {
+		payloads[logIndex] = inline
+		return nil
+	})))
+
+	assert.Equal(t, []tapedb.Change{&test.ChangeAttachPayload{PayloadID: "123"}, &test.ChangeCounterInc{Value: 1}}, changes)
+	assert.Equal(t, map[int][]io.InlinePayload{0: {{ID: "123", Data: []byte("test")}}}, payloads)
+
+	logR = io.NewLogBufferString(logBuffer.String())
+	entry, err := logR.ReadEntry()
+	require.NoError(t, err)
+	r, err := entry.Reader()
+	require.NoError(t, err)
+	typeName, data, err := io.ReadRawChange(r)
+	require.NoError(t, err)
+	assert.Equal(t, "attach-payload", typeName)
+	assert.JSONEq(t, `{"payloadID":"123"}`, string(data))
+}
+
+func TestInvalidChange(t *testing.T) {
+	logBuffer := io.LogBuffer{}
+
+	db, err := io.NewDatabase[*test.Base, *test.State](test.NewFactory(), &logBuffer)
+	require.NoError(t, err)
+	require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+
+	err = db.Apply(&test.ChangeCounterDec{Value: 2})
+	require.ErrorIs(t, err, tapedb.ErrInvalidChange)
+	assert.Equal(t, tapedb.ErrorCodeInvalidChange, tapedb.ErrorCodeOf(err))
+
+	assert.Equal(t, 1, db.State().Counter)
+	assert.Equal(t, 1, db.LogLen())
 }
@@ -0,0 +1,51 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fault
+
+import (
+	"github.com/simia-tech/tapedb/v2"
+)
+
+// Database wraps another database and injects faults into Apply. The change is not passed to the
+// wrapped database if a fault is triggered.
+type Database[B tapedb.Base, S tapedb.State] struct {
+	db tapedb.Database[B, S]
+	i  *Injector
+}
+
+var _ tapedb.Database[tapedb.Base, tapedb.State] = &Database[tapedb.Base, tapedb.State]{}
+
+func NewDatabase[B tapedb.Base, S tapedb.State](db tapedb.Database[B, S], i *Injector) *Database[B, S] {
+	return &Database[B, S]{db: db, i: i}
+}
+
+func (db *Database[B, S]) Base() B {
+	return db.db.Base()
+}
+
+func (db *Database[B, S]) State() S {
+	return db.db.State()
+}
+
+func (db *Database[B, S]) Apply(c tapedb.Change) error {
+	if f, ok := db.i.inject(OpApply); ok {
+		return f.Err
+	}
+	return db.db.Apply(c)
+}
+
+func (db *Database[B, S]) Close() error {
+	return db.db.Close()
+}
@@ -0,0 +1,141 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fault_test
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2"
+	tapeio "github.com/simia-tech/tapedb/v2/io"
+	"github.com/simia-tech/tapedb/v2/io/fault"
+	"github.com/simia-tech/tapedb/v2/memory"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestWriter(t *testing.T) {
+	t.Run("PartialWrite", func(t *testing.T) {
+		buffer := bytes.Buffer{}
+		w := fault.NewWriter(&buffer, fault.NewInjector(fault.Fault{
+			Op:           fault.OpWrite,
+			After:        1,
+			Times:        1,
+			Err:          fault.ErrInjected,
+			PartialWrite: 2,
+		}))
+
+		n, err := w.Write([]byte("abc"))
+		require.NoError(t, err)
+		assert.Equal(t, 3, n)
+
+		n, err = w.Write([]byte("def"))
+		assert.ErrorIs(t, err, fault.ErrInjected)
+		assert.Equal(t, 2, n)
+
+		n, err = w.Write([]byte("ghi"))
+		require.NoError(t, err)
+		assert.Equal(t, 3, n)
+
+		assert.Equal(t, "abcdeghi", buffer.String())
+	})
+
+	t.Run("Latency", func(t *testing.T) {
+		start := time.Now()
+		clock := test.NewClock(start)
+		i := fault.NewInjector(fault.Fault{Op: fault.OpWrite, Latency: time.Second})
+		i.SetClock(clock)
+
+		buffer := bytes.Buffer{}
+		_, err := fault.NewWriter(&buffer, i).Write([]byte("abc"))
+		require.NoError(t, err)
+		assert.Equal(t, "abc", buffer.String())
+		assert.Equal(t, time.Second, clock.Now().Sub(start))
+	})
+}
+
+func TestReader(t *testing.T) {
+	r := fault.NewReader(strings.NewReader("abc"), fault.NewInjector(fault.Fault{Op: fault.OpRead, Err: fault.ErrInjected}))
+
+	_, err := r.Read(make([]byte, 3))
+	assert.ErrorIs(t, err, fault.ErrInjected)
+}
+
+func TestLogWriter(t *testing.T) {
+	i := fault.NewInjector(fault.Fault{Op: fault.OpWriteEntry, After: 1, Times: 1, Err: fault.ErrInjected})
+	logBuffer := tapeio.LogBuffer{}
+
+	db, err := tapeio.NewDatabase[*test.Base, *test.State](test.NewFactory(), fault.NewLogWriter(&logBuffer, i))
+	require.NoError(t, err)
+
+	require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+	assert.ErrorIs(t, db.Apply(&test.ChangeCounterInc{Value: 2}), fault.ErrInjected)
+	require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 3}))
+
+	assert.Equal(t, 2, db.LogLen())
+	assert.Equal(t, 3, i.Count(fault.OpWriteEntry))
+	assert.Equal(t, 4, db.State().Counter)
+}
+
+func TestLogWriterDiverged(t *testing.T) {
+	i := fault.NewInjector(fault.Fault{Op: fault.OpWriteEntry, After: 1, Times: 1, Err: fault.ErrInjected})
+	logBuffer := tapeio.LogBuffer{}
+
+	db, err := tapeio.NewDatabase[*test.Base, *uncheckedState](uncheckedFactory{test.NewFactory()}, fault.NewLogWriter(&logBuffer, i))
+	require.NoError(t, err)
+
+	require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+	assert.ErrorIs(t, db.Apply(&test.ChangeCounterInc{Value: 2}), fault.ErrInjected)
+	assert.ErrorIs(t, db.Apply(&test.ChangeCounterInc{Value: 3}), tapeio.ErrStateDiverged)
+
+	assert.Equal(t, 1, db.LogLen())
+	assert.Equal(t, 2, i.Count(fault.OpWriteEntry))
+}
+
+func TestDatabase(t *testing.T) {
+	mdb, err := memory.NewDatabase[*test.Base, *test.State](test.NewFactory())
+	require.NoError(t, err)
+
+	db := fault.NewDatabase(mdb, fault.NewInjector(fault.Fault{Op: fault.OpApply, Times: 1, Err: fault.ErrInjected}))
+
+	assert.ErrorIs(t, db.Apply(&test.ChangeCounterInc{Value: 1}), fault.ErrInjected)
+	require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 2}))
+	assert.Equal(t, 2, db.State().Counter)
+}
+
+// uncheckedState is a state that can't be rolled back.
+type uncheckedState struct {
+	counter int
+}
+
+func (s *uncheckedState) Apply(c tapedb.Change) error {
+	if inc, ok := c.(*test.ChangeCounterInc); ok {
+		s.counter += inc.Value
+	}
+	return nil
+}
+
+type uncheckedFactory struct {
+	*test.Factory
+}
+
+func (f uncheckedFactory) NewState(*test.Base, sync.Locker) *uncheckedState {
+	return &uncheckedState{}
+}
@@ -0,0 +1,123 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fault
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/simia-tech/tapedb/v2"
+)
+
+var ErrInjected = errors.New("injected fault")
+
+type Op string
+
+const (
+	OpRead       Op = "read"
+	OpWrite      Op = "write"
+	OpReadEntry  Op = "read-entry"
+	OpWriteEntry Op = "write-entry"
+	OpApply      Op = "apply"
+)
+
+// Fault describes a failure that is injected into an operation. The fault triggers after the
+// operation succeeded After times and then triggers Times times (or forever if Times is zero).
+// Latency is added to each triggered call. If Err is nil, only the latency is injected. For write
+// operations, PartialWrite bytes are passed to the wrapped writer before the error is returned.
+type Fault struct {
+	Op           Op
+	After        int
+	Times        int
+	Latency      time.Duration
+	Err          error
+	PartialWrite int
+}
+
+// Injector decides deterministically which calls fail. It's safe for concurrent use.
+type Injector struct {
+	faults []*faultState
+	counts map[Op]int
+	clock  tapedb.Clock
+	mutex  sync.Mutex
+}
+
+type faultState struct {
+	Fault
+	triggered int
+}
+
+func NewInjector(faults ...Fault) *Injector {
+	i := &Injector{
+		counts: map[Op]int{},
+		clock:  tapedb.ClockOrSystem(nil),
+	}
+	for _, f := range faults {
+		i.Add(f)
+	}
+	return i
+}
+
+func (i *Injector) Add(f Fault) {
+	i.mutex.Lock()
+	i.faults = append(i.faults, &faultState{Fault: f})
+	i.mutex.Unlock()
+}
+
+func (i *Injector) Reset() {
+	i.mutex.Lock()
+	i.faults = nil
+	i.counts = map[Op]int{}
+	i.mutex.Unlock()
+}
+
+// SetClock replaces the clock whose Sleep is used to inject latency.
+func (i *Injector) SetClock(c tapedb.Clock) {
+	i.mutex.Lock()
+	i.clock = tapedb.ClockOrSystem(c)
+	i.mutex.Unlock()
+}
+
+// Count returns the number of calls of the provided operation.
+func (i *Injector) Count(op Op) int {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.counts[op]
+}
+
+func (i *Injector) inject(op Op) (Fault, bool) {
+	i.mutex.Lock()
+
+	count := i.counts[op]
+	i.counts[op] = count + 1
+
+	for _, f := range i.faults {
+		if f.Op != op || count < f.After || (f.Times > 0 && f.triggered >= f.Times) {
+			continue
+		}
+		f.triggered++
+		clock := i.clock
+		i.mutex.Unlock()
+
+		if f.Latency > 0 {
+			clock.Sleep(f.Latency)
+		}
+		return f.Fault, f.Err != nil
+	}
+
+	i.mutex.Unlock()
+	return Fault{}, false
+}
@@ -0,0 +1,62 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fault
+
+import (
+	"io"
+)
+
+type Reader[R io.Reader] struct {
+	r R
+	i *Injector
+}
+
+func NewReader[R io.Reader](r R, i *Injector) *Reader[R] {
+	return &Reader[R]{r: r, i: i}
+}
+
+func (r *Reader[R]) Read(data []byte) (int, error) {
+	if f, ok := r.i.inject(OpRead); ok {
+		return 0, f.Err
+	}
+	return r.r.Read(data)
+}
+
+type Writer[W io.Writer] struct {
+	w W
+	i *Injector
+}
+
+func NewWriter[W io.Writer](w W, i *Injector) *Writer[W] {
+	return &Writer[W]{w: w, i: i}
+}
+
+func (w *Writer[W]) Write(data []byte) (int, error) {
+	if f, ok := w.i.inject(OpWrite); ok {
+		if f.PartialWrite <= 0 {
+			return 0, f.Err
+		}
+		partial := data
+		if f.PartialWrite < len(partial) {
+			partial = partial[:f.PartialWrite]
+		}
+		n, err := w.w.Write(partial)
+		if err != nil {
+			return n, err
+		}
+		return n, f.Err
+	}
+	return w.w.Write(data)
+}
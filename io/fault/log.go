@@ -0,0 +1,66 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fault
+
+import (
+	tapeio "github.com/simia-tech/tapedb/v2/io"
+)
+
+type LogReader[R tapeio.LogReader] struct {
+	r R
+	i *Injector
+}
+
+var _ tapeio.LogReader = &LogReader[tapeio.LogReader]{}
+
+func NewLogReader[R tapeio.LogReader](r R, i *Injector) *LogReader[R] {
+	return &LogReader[R]{r: r, i: i}
+}
+
+func (r *LogReader[R]) ReadEntry() (tapeio.LogEntry, error) {
+	if f, ok := r.i.inject(OpReadEntry); ok {
+		return nil, f.Err
+	}
+	return r.r.ReadEntry()
+}
+
+func (r *LogReader[R]) Offset() int64 {
+	offset, _ := tapeio.LogOffset(r.r)
+	return offset
+}
+
+// LogWriter injects faults into the entry writes. Partial writes can't be simulated on this level,
+// since entries are written as a whole. Wrap the underlying io.Writer with a Writer instead.
+type LogWriter[W tapeio.LogWriter] struct {
+	w W
+	i *Injector
+}
+
+var _ tapeio.LogWriter = &LogWriter[tapeio.LogWriter]{}
+
+func NewLogWriter[W tapeio.LogWriter](w W, i *Injector) *LogWriter[W] {
+	return &LogWriter[W]{w: w, i: i}
+}
+
+func (w *LogWriter[W]) WriteEntry(et tapeio.LogEntryType, data []byte) (int64, error) {
+	if f, ok := w.i.inject(OpWriteEntry); ok {
+		return 0, f.Err
+	}
+	return w.w.WriteEntry(et, data)
+}
+
+func (w *LogWriter[W]) Flush() error {
+	return tapeio.FlushLogWriter(w.w)
+}
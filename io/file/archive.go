@@ -0,0 +1,173 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/simia-tech/tapedb/v2"
+)
+
+var ErrInvalidArchive = errors.New("invalid archive")
+
+// ExportArchive writes the meta, the base, the log and the payload files of the database at the
+// provided path into a tar archive. The files are written as they are, so an encrypted database
+// stays encrypted. The database must not be written while it's exported, an open one has to be
+// quiesced first.
+func ExportArchive(path string, w io.Writer) error {
+	if err := mustExist(path); err != nil {
+		return tapedb.WrapError("export archive", path, err)
+	}
+
+	layout := DefaultLayout
+	payloadNames, err := layout.readPayloadFileNames(path)
+	if err != nil {
+		return tapedb.WrapError("export archive", path, err)
+	}
+
+	tw := tar.NewWriter(w)
+	for _, name := range append([]string{layout.Meta, layout.Base, layout.Log}, payloadNames...) {
+		if err := writeArchiveFile(tw, path, name); err != nil {
+			return tapedb.WrapError("export archive", path, fmt.Errorf("write %s: %w", name, err))
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return tapedb.WrapError("export archive", path, err)
+	}
+	return nil
+}
+
+func writeArchiveFile(tw *tar.Writer, path, name string) error {
+	f, err := os.Open(filepath.Join(path, name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+
+	// a file that grows while it's exported is cut at the size of the header
+	_, err = io.CopyN(tw, f, header.Size)
+	return err
+}
+
+// ImportArchive extracts a tar archive that has been written by ExportArchive into the new
+// directory at targetPath. The archive is extracted next to the target path and moved into place
+// once it's complete, so an aborted import leaves nothing behind at the target path. Entries that
+// aren't files of a database are rejected with ErrInvalidArchive.
+func ImportArchive(r io.Reader, targetPath string) error {
+	if _, err := os.Stat(targetPath); err == nil {
+		return tapedb.WrapError("import archive", targetPath, fmt.Errorf("target %s: %w", targetPath, ErrExisting))
+	} else if !os.IsNotExist(err) {
+		return tapedb.WrapError("import archive", targetPath, err)
+	}
+
+	tempPath := targetPath + ".import"
+	if err := os.RemoveAll(tempPath); err != nil {
+		return tapedb.WrapError("import archive", targetPath, err)
+	}
+	if err := os.MkdirAll(tempPath, 0755); err != nil {
+		return tapedb.WrapError("import archive", targetPath, fmt.Errorf("make directory: %w", err))
+	}
+	done := false
+	defer func() {
+		if !done {
+			os.RemoveAll(tempPath)
+		}
+	}()
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return tapedb.WrapError("import archive", targetPath, fmt.Errorf("%w: %v", ErrInvalidArchive, err))
+		}
+		if err := readArchiveFile(tr, header, tempPath); err != nil {
+			return tapedb.WrapError("import archive", targetPath, fmt.Errorf("read %s: %w", header.Name, err))
+		}
+	}
+
+	if err := mustExist(tempPath); err != nil {
+		return tapedb.WrapError("import archive", targetPath, fmt.Errorf("%w: no base or log", ErrInvalidArchive))
+	}
+	if err := syncDir(tempPath); err != nil {
+		return tapedb.WrapError("import archive", targetPath, err)
+	}
+	if err := os.Rename(tempPath, targetPath); err != nil {
+		return tapedb.WrapError("import archive", targetPath, err)
+	}
+	done = true
+	return nil
+}
+
+func readArchiveFile(tr *tar.Reader, header *tar.Header, path string) error {
+	if header.Typeflag != tar.TypeReg || !DefaultLayout.isArchiveFileName(header.Name) {
+		return ErrInvalidArchive
+	}
+
+	f, err := os.OpenFile(filepath.Join(path, header.Name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, header.FileInfo().Mode().Perm())
+	if err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("%w: duplicate entry", ErrInvalidArchive)
+		}
+		return err
+	}
+	if _, err := io.Copy(f, tr); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// isArchiveFileName returns true if the provided name is the one of a file that ExportArchive
+// writes. Since these names never contain a separator, entries can't escape the target directory.
+func (l Layout) isArchiveFileName(name string) bool {
+	if strings.ContainsAny(name, `/\`) || strings.HasSuffix(name, l.PartialSuffix) {
+		return false
+	}
+	switch name {
+	case l.Meta, l.Base, l.Log:
+		return true
+	}
+	_, ok := l.PayloadIDOfFileName(name)
+	return ok
+}
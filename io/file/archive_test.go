@@ -0,0 +1,85 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestArchive(t *testing.T) {
+	t.Run("ExportAndImport", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), filepath.Join(path, "source"),
+			file.WithCreateKey(testKey), file.WithPayloadChunkSize(2))
+		require.NoError(t, err)
+		require.NoError(t, db.Apply(&test.ChangeAttachPayload{PayloadID: "a"}, file.NewPayload("a", strings.NewReader("one"))))
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 2}))
+		require.NoError(t, db.Close())
+
+		buffer := bytes.Buffer{}
+		require.NoError(t, file.ExportArchive(filepath.Join(path, "source"), &buffer))
+		require.NoError(t, file.ImportArchive(&buffer, filepath.Join(path, "target")))
+		assert.NoDirExists(t, filepath.Join(path, "target.import"))
+
+		db, err = file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), filepath.Join(path, "target"),
+			file.WithOpenKey(testKey))
+		require.NoError(t, err)
+		defer db.Close()
+		assert.Equal(t, 2, db.State().Counter)
+
+		r, err := db.OpenPayload("a")
+		require.NoError(t, err)
+		defer r.Close()
+		data, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, "one", string(data))
+	})
+
+	t.Run("ExistingTarget", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		err := file.ImportArchive(&bytes.Buffer{}, path)
+		assert.ErrorIs(t, err, file.ErrExisting)
+	})
+
+	t.Run("InvalidEntry", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		buffer := bytes.Buffer{}
+		tw := tar.NewWriter(&buffer)
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: "../log", Mode: 0644, Size: 0}))
+		require.NoError(t, tw.Close())
+
+		err := file.ImportArchive(&buffer, filepath.Join(path, "target"))
+		assert.ErrorIs(t, err, file.ErrInvalidArchive)
+		assert.NoDirExists(t, filepath.Join(path, "target"))
+		assert.NoDirExists(t, filepath.Join(path, "target.import"))
+	})
+}
@@ -0,0 +1,89 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"fmt"
+	"sync"
+)
+
+const MetaFieldBackupTime = "Backup-Time"
+
+// Quiesce prepares the database for a filesystem snapshot. It blocks further appends, flushes and
+// syncs the log and writes the log length and size together with the backup time into the meta as
+// a consistency marker. The returned function releases the database again and has to be called
+// once the snapshot has been taken.
+func (db *Database[B, S]) Quiesce() (func(), error) {
+	if db.readOnly {
+		return func() {}, nil
+	}
+
+	db.quiesceMutex.Lock()
+	release := onceFunc(db.quiesceMutex.Unlock)
+
+	if err := db.Sync(); err != nil {
+		release()
+		return nil, fmt.Errorf("sync log: %w", err)
+	}
+
+	err := db.updateMetaFile(true, func(meta Meta, logLen, logSize uint64) bool {
+		meta.SetTime(MetaFieldBackupTime, db.clock.Now())
+		meta.SetUInt64(MetaFieldLogLen, logLen)
+		meta.SetUInt64(MetaFieldLogSize, logSize)
+		return true
+	})
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("write meta: %w", err)
+	}
+
+	return release, nil
+}
+
+// QuiesceAll quiesces all open databases of the deck and blocks opening or creating databases
+// until the returned function is called. Closed databases are consistent on disk already.
+func (d *Deck[B, S, F]) QuiesceAll() (func(), error) {
+	d.databasesMutex.Lock()
+
+	releases := []func(){}
+	release := onceFunc(func() {
+		for _, release := range releases {
+			release()
+		}
+		d.databasesMutex.Unlock()
+	})
+
+	for _, key := range d.databases.Keys() {
+		value, ok := d.databases.Peek(key)
+		if !ok {
+			continue
+		}
+		r, err := value.(*entry[B, S]).db.Quiesce()
+		if err != nil {
+			release()
+			return nil, fmt.Errorf("quiesce %s: %w", key, err)
+		}
+		releases = append(releases, r)
+	}
+
+	return release, nil
+}
+
+func onceFunc(fn func()) func() {
+	once := sync.Once{}
+	return func() {
+		once.Do(fn)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestDatabaseQuiesce(t *testing.T) {
+	path, removeDir := makeTempDir(t)
+	defer removeDir()
+
+	clock := test.NewClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path,
+		file.WithCreateClock(clock), file.WithCreateGroupCommit())
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+
+	release, err := db.Quiesce()
+	require.NoError(t, err)
+
+	meta, err := file.ReadMetaFile(filepath.Join(path, file.FileNameMeta))
+	require.NoError(t, err)
+	assert.Equal(t, "2021-01-01T00:00:00Z", meta.Get(file.MetaFieldBackupTime))
+	assert.Equal(t, uint64(1), meta.GetUInt64(file.MetaFieldLogLen, 0))
+	assert.Equal(t, "\x00\x00\x00\x18\x0bcounter-inc{\"value\":1}\n", readFile(t, filepath.Join(path, file.FileNameLog)))
+
+	applied := make(chan error)
+	go func() {
+		applied <- db.Apply(&test.ChangeCounterInc{Value: 2})
+	}()
+
+	select {
+	case <-applied:
+		t.Fatal("apply should be blocked")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release()
+	release()
+	require.NoError(t, <-applied)
+	assert.Equal(t, 2, db.LogLen())
+}
+
+func TestDeckQuiesceAll(t *testing.T) {
+	path, removeDir := makeTempDir(t)
+	defer removeDir()
+
+	deck, err := file.NewDeck[*test.Base, *test.State, *test.Factory](2)
+	require.NoError(t, err)
+	defer deck.Close()
+
+	require.NoError(t, deck.Create(test.NewFactory(), path))
+	require.NoError(t, deck.WithOpen(test.NewFactory(), path, nil, func(db *file.Database[*test.Base, *test.State]) error {
+		return db.Apply(&test.ChangeCounterInc{Value: 1})
+	}))
+
+	release, err := deck.QuiesceAll()
+	require.NoError(t, err)
+
+	meta, err := file.ReadMetaFile(filepath.Join(path, file.FileNameMeta))
+	require.NoError(t, err)
+	assert.True(t, meta.Has(file.MetaFieldBackupTime))
+	assert.Equal(t, uint64(1), meta.GetUInt64(file.MetaFieldLogLen, 0))
+
+	release()
+
+	logLen, err := deck.LogLen(path)
+	require.NoError(t, err)
+	assert.Equal(t, 1, logLen)
+}
@@ -0,0 +1,160 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru"
+
+	tapedb "github.com/simia-tech/tapedb/v2"
+	tapeio "github.com/simia-tech/tapedb/v2/io"
+)
+
+// BaseCache holds bases keyed by the path, identity, size and modification time of the base file
+// and the key. Databases that are opened with an unchanged base file skip reading and decrypting
+// the base. By default, the decrypted base is cached and decoded for each database, so the
+// databases don't share any base. With WithSharedBases, the decoded base is cached and shared
+// between the databases, which then must not modify it.
+type BaseCache struct {
+	bases  *lru.Cache
+	paths  map[string]string
+	shared bool
+	mutex  sync.Mutex
+}
+
+type baseCacheOptions struct {
+	shared bool
+}
+
+type BaseCacheOption func(*baseCacheOptions)
+
+// WithSharedBases caches the decoded bases and hands the same base to all databases that are
+// opened with an unchanged base file.
+func WithSharedBases() BaseCacheOption {
+	return func(o *baseCacheOptions) {
+		o.shared = true
+	}
+}
+
+func NewBaseCache(size int, opts ...BaseCacheOption) (*BaseCache, error) {
+	options := baseCacheOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	bases, err := lru.New(size)
+	if err != nil {
+		return nil, err
+	}
+	return &BaseCache{
+		bases:  bases,
+		paths:  map[string]string{},
+		shared: options.shared,
+	}, nil
+}
+
+func (c *BaseCache) Len() int {
+	return c.bases.Len()
+}
+
+// Invalidate removes the base of the database at the provided path.
+func (c *BaseCache) Invalidate(path string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if id, ok := c.paths[path]; ok {
+		c.bases.Remove(id)
+		delete(c.paths, path)
+	}
+}
+
+func (c *BaseCache) get(id string) (any, bool) {
+	return c.bases.Get(id)
+}
+
+func (c *BaseCache) add(path, id string, value any) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if previous, ok := c.paths[path]; ok && previous != id {
+		c.bases.Remove(previous)
+	}
+	c.paths[path] = id
+	c.bases.Add(id, value)
+}
+
+// baseFileID identifies the content of the base file by its path, identity, size and modification
+// time, so it doesn't have to be read. A splice replaces the file and changes its identity. The key
+// is part of the id, so a wrong key doesn't hit the cached base.
+func baseFileID(path string, f *os.File, key []byte) (string, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	keySum := sha256.Sum256(key)
+	return fmt.Sprintf("%s:%s:%d:%d:%s",
+		path, fileIdentity(stat), stat.Size(), stat.ModTime().UnixNano(), hex.EncodeToString(keySum[:])), nil
+}
+
+// readCachedBase returns the base with the provided id from the cache or reads and caches it.
+func readCachedBase[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](
+	f F,
+	cache *BaseCache,
+	path, id string,
+	baseR io.Reader,
+	opts ...tapeio.DatabaseOption,
+) (B, error) {
+	var base B
+	ok := false
+	if value, found := cache.get(id); found {
+		switch v := value.(type) {
+		case B:
+			base, ok = v, true
+		case []byte:
+			var err error
+			if base, err = tapeio.ReadBase[B, S](f, bytes.NewReader(v), opts...); err != nil {
+				return base, err
+			}
+			ok = true
+		}
+	}
+	if !ok {
+		data, err := io.ReadAll(baseR)
+		if err != nil {
+			return base, fmt.Errorf("read base: %w", err)
+		}
+		if base, err = tapeio.ReadBase[B, S](f, bytes.NewReader(data), opts...); err != nil {
+			return base, err
+		}
+		if cache.shared {
+			cache.add(path, id, base)
+		} else {
+			cache.add(path, id, data)
+		}
+	}
+
+	return base, nil
+}
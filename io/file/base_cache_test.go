@@ -0,0 +1,140 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestBaseCache(t *testing.T) {
+	setup := func(t *testing.T) (string, func()) {
+		path, removeDir := makeTempDir(t)
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithCreateKey(testKey))
+		require.NoError(t, err)
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 2}))
+		require.NoError(t, db.Close())
+
+		_, err = file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithSourceKey(testKey), file.WithTargetKey(testKey), file.WithRebaseChangeCount(1))
+		require.NoError(t, err)
+
+		return path, removeDir
+	}
+
+	t.Run("Open", func(t *testing.T) {
+		path, removeDir := setup(t)
+		defer removeDir()
+
+		cache, err := file.NewBaseCache(10)
+		require.NoError(t, err)
+
+		dbOne, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithOpenKey(testKey), file.WithOpenBaseCache(cache))
+		require.NoError(t, err)
+		require.NoError(t, dbOne.Close())
+
+		dbTwo, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithOpenKey(testKey), file.WithOpenBaseCache(cache))
+		require.NoError(t, err)
+		require.NoError(t, dbTwo.Close())
+
+		assert.Equal(t, 1, cache.Len())
+		assert.NotSame(t, dbOne.Base(), dbTwo.Base())
+		assert.Equal(t, dbOne.Base(), dbTwo.Base())
+		assert.Equal(t, 2, dbTwo.State().Counter)
+
+		_, err = file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithOpenKey(testInvalidKey), file.WithOpenBaseCache(cache))
+		assert.ErrorIs(t, err, file.ErrInvalidKey)
+	})
+
+	t.Run("SharedBases", func(t *testing.T) {
+		path, removeDir := setup(t)
+		defer removeDir()
+
+		cache, err := file.NewBaseCache(10, file.WithSharedBases())
+		require.NoError(t, err)
+
+		dbOne, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithOpenKey(testKey), file.WithOpenBaseCache(cache))
+		require.NoError(t, err)
+		require.NoError(t, dbOne.Close())
+
+		dbTwo, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithOpenKey(testKey), file.WithOpenBaseCache(cache))
+		require.NoError(t, err)
+		require.NoError(t, dbTwo.Close())
+
+		assert.Equal(t, 1, cache.Len())
+		assert.Same(t, dbOne.Base(), dbTwo.Base())
+	})
+
+	t.Run("ChangedBaseFile", func(t *testing.T) {
+		path, removeDir := setup(t)
+		defer removeDir()
+
+		cache, err := file.NewBaseCache(10)
+		require.NoError(t, err)
+
+		db, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithOpenKey(testKey), file.WithOpenBaseCache(cache))
+		require.NoError(t, err)
+		require.NoError(t, db.Close())
+
+		// the base is replaced without the cache being invalidated
+		require.NoError(t, file.ResetDatabase(path, &test.Base{Value: 7}, file.WithResetKey(testKey)))
+
+		db, err = file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithOpenKey(testKey), file.WithOpenBaseCache(cache))
+		require.NoError(t, err)
+		require.NoError(t, db.Close())
+		assert.Equal(t, 7, db.Base().Value)
+	})
+
+	t.Run("InvalidateOnDeckSplice", func(t *testing.T) {
+		path, removeDir := setup(t)
+		defer removeDir()
+
+		cache, err := file.NewBaseCache(10)
+		require.NoError(t, err)
+
+		deck, err := file.NewDeck[*test.Base, *test.State, *test.Factory](2, file.WithDeckBaseCache(cache))
+		require.NoError(t, err)
+		defer deck.Close()
+
+		opts := []file.OpenOption{file.WithOpenKey(testKey)}
+		require.NoError(t, deck.WithOpen(test.NewFactory(), path, opts, func(db *file.Database[*test.Base, *test.State]) error {
+			return db.Apply(&test.ChangeCounterInc{Value: 3})
+		}))
+		assert.Equal(t, 1, cache.Len())
+
+		_, err = deck.Splice(test.NewFactory(), path,
+			file.WithSourceKey(testKey), file.WithTargetKey(testKey), file.WithRebaseChangeCount(1))
+		require.NoError(t, err)
+		assert.Equal(t, 0, cache.Len())
+
+		require.NoError(t, deck.WithOpen(test.NewFactory(), path, opts, func(db *file.Database[*test.Base, *test.State]) error {
+			assert.Equal(t, 5, db.Base().Value)
+			return nil
+		}))
+	})
+}
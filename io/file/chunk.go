@@ -0,0 +1,535 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+
+	tapeio "github.com/simia-tech/tapedb/v2/io"
+	"github.com/simia-tech/tapedb/v2/io/crypto"
+)
+
+var ErrPayloadChunkMismatch = errors.New("payload chunk mismatch")
+
+// payloadManifest lists the chunks of a payload that is stored in multiple files. Each chunk has
+// the chunk size, only the last one might be smaller.
+type payloadManifest struct {
+	Size      int64
+	ChunkSize int64
+	Chunks    [][]byte
+}
+
+func (pm payloadManifest) meta() Meta {
+	meta := Meta{}
+	meta.SetUInt64(PayloadManifestFieldSize, uint64(pm.Size))
+	meta.SetUInt64(PayloadManifestFieldChunkSize, uint64(pm.ChunkSize))
+	for _, sum := range pm.Chunks {
+		textproto.MIMEHeader(meta).Add(PayloadManifestFieldChunkSHA256, hex.EncodeToString(sum))
+	}
+	return meta
+}
+
+func payloadManifestFromMeta(meta Meta) (payloadManifest, error) {
+	pm := payloadManifest{
+		Size:      int64(meta.GetUInt64(PayloadManifestFieldSize, 0)),
+		ChunkSize: int64(meta.GetUInt64(PayloadManifestFieldChunkSize, 0)),
+	}
+	if pm.ChunkSize <= 0 {
+		return payloadManifest{}, fmt.Errorf("invalid chunk size %q", meta.Get(PayloadManifestFieldChunkSize))
+	}
+	for _, value := range textproto.MIMEHeader(meta).Values(PayloadManifestFieldChunkSHA256) {
+		sum, err := hex.DecodeString(value)
+		if err != nil || len(sum) != sha256.Size {
+			return payloadManifest{}, fmt.Errorf("invalid chunk checksum %q", value)
+		}
+		pm.Chunks = append(pm.Chunks, sum)
+	}
+	if count := int64(len(pm.Chunks)); pm.Size > count*pm.ChunkSize || pm.Size <= (count-1)*pm.ChunkSize {
+		return payloadManifest{}, fmt.Errorf("size %d doesn't match %d chunks", pm.Size, count)
+	}
+	return pm, nil
+}
+
+// chunkSize returns the size of the chunk with the provided index.
+func (pm payloadManifest) chunkSize(index int) int64 {
+	if size := pm.Size - int64(index)*pm.ChunkSize; size < pm.ChunkSize {
+		return size
+	}
+	return pm.ChunkSize
+}
+
+func (l Layout) payloadPartialManifestPath(path, id string) string {
+	return l.PayloadManifestPath(path, id) + l.PartialSuffix
+}
+
+// payloadExists returns true if the payload with the provided id is stored in a single file or in
+// chunks.
+func (l Layout) payloadExists(path, id string) (bool, error) {
+	for _, name := range []string{l.PayloadPrefix + id, l.PayloadManifestPrefix + id} {
+		_, err := os.Stat(filepath.Join(path, name))
+		if err == nil {
+			return true, nil
+		}
+		if !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// removePayload removes the file or the manifest and the chunks of the payload with the provided
+// id. The chunks of an interrupted write are removed as well. If nothing is found, an error that
+// satisfies os.IsNotExist is returned.
+func (l Layout) removePayload(path, id string) error {
+	err := os.Remove(l.PayloadPath(path, id))
+	if os.IsNotExist(err) {
+		if err = os.Remove(l.PayloadManifestPath(path, id)); os.IsNotExist(err) {
+			err = os.Remove(l.payloadPartialManifestPath(path, id))
+		}
+		if err == nil {
+			err = l.removePayloadChunks(path, id, 0)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return l.removePayloadInfo(path, id)
+}
+
+// removePayloadChunks removes the chunks of the payload with the provided id, starting at the
+// provided index. Since the chunks are numbered consecutively, it stops at the first missing one.
+func (l Layout) removePayloadChunks(path, id string, index int) error {
+	for ; ; index++ {
+		if err := os.Remove(l.PayloadChunkPath(path, id, index)); err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// copyPayloadFiles copies the file or the manifest and the chunks of the payload with the provided id.
+func (l Layout) copyPayloadFiles(sourcePath, targetPath, id string) error {
+	if err := copyFileIfExists(l.PayloadPath(sourcePath, id), l.PayloadPath(targetPath, id)); err != nil {
+		return err
+	}
+	if err := copyFileIfExists(l.PayloadManifestPath(sourcePath, id), l.PayloadManifestPath(targetPath, id)); err != nil {
+		return err
+	}
+	for index := 0; ; index++ {
+		sourceChunkPath := l.PayloadChunkPath(sourcePath, id, index)
+		if _, err := os.Stat(sourceChunkPath); os.IsNotExist(err) {
+			return nil
+		}
+		if err := copyFileIfExists(sourceChunkPath, l.PayloadChunkPath(targetPath, id, index)); err != nil {
+			return err
+		}
+	}
+}
+
+// readPayloadManifestFile reads the manifest at the provided path and decrypts it if a key is
+// provided.
+func readPayloadManifestFile(path string, c crypto.Cipher, key []byte) (payloadManifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return payloadManifest{}, err
+	}
+	defer f.Close()
+
+	r := io.Reader(f)
+	if len(key) > 0 {
+		if r, err = crypto.NewBlockReaderWithCipher(f, c, key); err != nil {
+			return payloadManifest{}, err
+		}
+	}
+
+	meta, err := ReadMeta(r)
+	if err != nil {
+		return payloadManifest{}, err
+	}
+	return payloadManifestFromMeta(meta)
+}
+
+func writePayloadManifestFile(path string, pm payloadManifest, fileMode os.FileMode, c crypto.Cipher, key []byte) error {
+	buffer := bytes.Buffer{}
+	if _, err := pm.meta().WriteTo(&buffer); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fileMode)
+	if err != nil {
+		return err
+	}
+	if err := writeBlocks(f, buffer.Bytes(), c, key); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// payloadManifest returns the manifest of the payload with the provided id. False is returned if
+// the database doesn't store payloads in chunks or the payload is stored in a single file.
+func (db *Database[B, S]) payloadManifest(id string) (payloadManifest, bool, error) {
+	if db.chunkSize <= 0 {
+		return payloadManifest{}, false, nil
+	}
+
+	pm := payloadManifest{}
+	err := db.retryPolicy.Do(func() (err error) {
+		pm, err = readPayloadManifestFile(db.layout.PayloadManifestPath(db.path, id), db.cipher, db.key)
+		return
+	})
+	if err != nil {
+		if os.IsNotExist(err) {
+			return payloadManifest{}, false, nil
+		}
+		return payloadManifest{}, false, fmt.Errorf("read payload manifest with id %s: %w", id, err)
+	}
+	return pm, true, nil
+}
+
+// writePayloadChunks stores the payload in chunks of the chunk size of the database. After each
+// chunk, a partial manifest is written, so a write that has been interrupted can be resumed by
+// writing the same payload again. The chunks that have been stored already are only compared with
+// the content, a mismatch discards them and fails with ErrPayloadChunkMismatch. A payload that
+// fits into a single chunk is stored in a single file.
+func (db *Database[B, S]) writePayloadChunks(payload Payload) (stagedPayload, error) {
+	exists, err := db.layout.payloadExists(db.path, payload.id)
+	if err != nil {
+		return stagedPayload{}, err
+	}
+	if exists {
+		return stagedPayload{}, fmt.Errorf("create payload with id %s: %w", payload.id, ErrPayloadIDAlreadyExists)
+	}
+
+	partialPath := db.layout.payloadPartialManifestPath(db.path, payload.id)
+	// a partial manifest that can't be read is ignored and its chunks are overwritten
+	partial, _ := readPayloadManifestFile(partialPath, db.cipher, db.key)
+
+	cw := &chunkWriter{
+		layout:    db.layout,
+		path:      db.path,
+		id:        payload.id,
+		fileMode:  db.fileMode,
+		cipher:    db.cipher,
+		key:       db.key,
+		chunkSize: db.chunkSize,
+		resume:    partial.Chunks,
+	}
+	discardFn := func() {
+		os.Remove(partialPath)
+		db.layout.removePayloadChunks(db.path, payload.id, 0)
+	}
+
+	pw := newPayloadWriter(cw, payload, db.maxPayloadSize)
+	if _, err := io.Copy(pw, payload.r); err != nil {
+		cw.abort()
+		if errors.Is(err, ErrPayloadTooLarge) || errors.Is(err, ErrPayloadChunkMismatch) {
+			discardFn()
+		}
+		return stagedPayload{}, fmt.Errorf("write payload with id %s: %w", payload.id, err)
+	}
+	if err := cw.Close(); err != nil {
+		if errors.Is(err, ErrPayloadChunkMismatch) {
+			discardFn()
+		}
+		return stagedPayload{}, fmt.Errorf("write payload with id %s: %w", payload.id, err)
+	}
+	if err := pw.verify(); err != nil {
+		discardFn()
+		return stagedPayload{}, fmt.Errorf("write payload with id %s: %w", payload.id, err)
+	}
+
+	// chunks of a partial write with a longer content
+	if err := db.layout.removePayloadChunks(db.path, payload.id, len(cw.chunks)); err != nil {
+		return stagedPayload{}, err
+	}
+
+	switch len(cw.chunks) {
+	case 0:
+		if err := os.Remove(partialPath); err != nil && !os.IsNotExist(err) {
+			return stagedPayload{}, err
+		}
+		return db.writePayloadFile(NewPayload(payload.id, bytes.NewReader(nil)))
+	case 1:
+		if err := os.Remove(partialPath); err != nil && !os.IsNotExist(err) {
+			return stagedPayload{}, err
+		}
+		chunkPath := db.layout.PayloadChunkPath(db.path, payload.id, 0)
+		return stagedPayload{
+			payloadWriter: pw,
+			commitFn: func() error {
+				return os.Rename(chunkPath, db.payloadPath(payload.id))
+			},
+			discardFn: func() {
+				os.Remove(chunkPath)
+			},
+		}, nil
+	default:
+		pm := payloadManifest{Size: pw.written, ChunkSize: db.chunkSize, Chunks: cw.chunks}
+		if err := writePayloadManifestFile(partialPath, pm, db.fileMode, db.cipher, db.key); err != nil {
+			return stagedPayload{}, fmt.Errorf("write payload manifest with id %s: %w", payload.id, err)
+		}
+		return stagedPayload{
+			payloadWriter: pw,
+			commitFn: func() error {
+				return os.Rename(partialPath, db.layout.PayloadManifestPath(db.path, payload.id))
+			},
+			discardFn: discardFn,
+		}, nil
+	}
+}
+
+// chunkWriter splits the written content into chunk files. The chunks listed in resume are
+// already stored, so the content is only compared with their checksums.
+type chunkWriter struct {
+	layout    Layout
+	path      string
+	id        string
+	fileMode  os.FileMode
+	cipher    crypto.Cipher
+	key       []byte
+	chunkSize int64
+	resume    [][]byte
+	chunks    [][]byte
+
+	open    bool
+	f       *os.File
+	w       io.Writer
+	bw      io.WriteCloser
+	written int64
+	hash    hash.Hash
+}
+
+func (w *chunkWriter) Write(data []byte) (int, error) {
+	total := 0
+	for len(data) > 0 {
+		if !w.open {
+			if err := w.begin(); err != nil {
+				return total, err
+			}
+		}
+
+		n := int64(len(data))
+		if remaining := w.chunkSize - w.written; n > remaining {
+			n = remaining
+		}
+		if w.w != nil {
+			if _, err := w.w.Write(data[:n]); err != nil {
+				return total, err
+			}
+		}
+		w.hash.Write(data[:n])
+		w.written += n
+		total += int(n)
+		data = data[n:]
+
+		if w.written == w.chunkSize {
+			if err := w.finish(true); err != nil {
+				return total, err
+			}
+		}
+	}
+	return total, nil
+}
+
+// Close finishes the last chunk.
+func (w *chunkWriter) Close() error {
+	if !w.open {
+		return nil
+	}
+	return w.finish(false)
+}
+
+func (w *chunkWriter) begin() error {
+	w.open, w.written, w.hash = true, 0, sha256.New()
+	if len(w.chunks) < len(w.resume) {
+		return nil
+	}
+
+	f, err := os.OpenFile(w.layout.PayloadChunkPath(w.path, w.id, len(w.chunks)), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, w.fileMode)
+	if err != nil {
+		return err
+	}
+	w.f, w.w = f, f
+	if len(w.key) > 0 {
+		bw, err := crypto.NewBlockWriterWithCipher(f, w.cipher, w.key, NonceFn)
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("new block writer: %w", err)
+		}
+		w.w, w.bw = bw, bw
+	}
+	return nil
+}
+
+func (w *chunkWriter) finish(full bool) error {
+	w.open = false
+	sum := w.hash.Sum(nil)
+
+	if w.f == nil {
+		if !full || !bytes.Equal(sum, w.resume[len(w.chunks)]) {
+			return ErrPayloadChunkMismatch
+		}
+		w.chunks = append(w.chunks, sum)
+		return nil
+	}
+
+	err := w.closeFile()
+	if err != nil {
+		return err
+	}
+	w.chunks = append(w.chunks, sum)
+
+	if !full {
+		return nil
+	}
+	pm := payloadManifest{Size: int64(len(w.chunks)) * w.chunkSize, ChunkSize: w.chunkSize, Chunks: w.chunks}
+	return writePayloadManifestFile(w.layout.payloadPartialManifestPath(w.path, w.id), pm, w.fileMode, w.cipher, w.key)
+}
+
+func (w *chunkWriter) closeFile() error {
+	f, bw := w.f, w.bw
+	w.f, w.w, w.bw = nil, nil, nil
+	if bw != nil {
+		if err := bw.Close(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// abort removes the chunk that has been written partially.
+func (w *chunkWriter) abort() {
+	if w.f == nil {
+		return
+	}
+	w.closeFile()
+	os.Remove(w.layout.PayloadChunkPath(w.path, w.id, len(w.chunks)))
+}
+
+// chunkedPayloadReader reads the chunks of a payload in sequence. Only one chunk is open at a time.
+type chunkedPayloadReader struct {
+	manifest payloadManifest
+	openFn   func(int) (io.ReadSeekCloser, error)
+	offset   int64
+	index    int
+	current  io.ReadSeekCloser
+}
+
+var _ io.ReadSeekCloser = &chunkedPayloadReader{}
+
+func (r *chunkedPayloadReader) Read(data []byte) (int, error) {
+	if r.offset >= r.manifest.Size {
+		return 0, io.EOF
+	}
+
+	index := int(r.offset / r.manifest.ChunkSize)
+	if r.current != nil && r.index != index {
+		r.current.Close()
+		r.current = nil
+	}
+	if r.current == nil {
+		current, err := r.openFn(index)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := current.Seek(r.offset-int64(index)*r.manifest.ChunkSize, io.SeekStart); err != nil {
+			current.Close()
+			return 0, err
+		}
+		r.current, r.index = current, index
+	}
+
+	n, err := r.current.Read(data)
+	r.offset += int64(n)
+	if errors.Is(err, io.EOF) {
+		if r.offset < int64(index)*r.manifest.ChunkSize+r.manifest.chunkSize(index) {
+			return n, io.ErrUnexpectedEOF
+		}
+		if n == 0 {
+			return r.Read(data)
+		}
+		err = nil
+	}
+	return n, err
+}
+
+func (r *chunkedPayloadReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.manifest.Size
+	}
+	if offset < 0 {
+		return r.offset, fmt.Errorf("seek to negative offset %d", offset)
+	}
+	r.offset = offset
+
+	if r.current != nil && r.index == int(offset/r.manifest.ChunkSize) {
+		if _, err := r.current.Seek(offset-int64(r.index)*r.manifest.ChunkSize, io.SeekStart); err != nil {
+			return r.offset, err
+		}
+	} else if r.current != nil {
+		r.current.Close()
+		r.current = nil
+	}
+	return r.offset, nil
+}
+
+func (r *chunkedPayloadReader) Close() error {
+	if r.current == nil {
+		return nil
+	}
+	err := r.current.Close()
+	r.current = nil
+	return err
+}
+
+// openPayloadFile opens the file at the provided path and decrypts it if the database has a key.
+func (db *Database[B, S]) openPayloadFile(path string) (io.ReadSeekCloser, error) {
+	f := (*os.File)(nil)
+	err := db.retryPolicy.Do(func() (err error) {
+		f, err = os.Open(path)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(db.key) == 0 {
+		return f, nil
+	}
+
+	r, err := crypto.NewBlockReaderWithCipher(f, db.cipher, db.key)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return tapeio.NewReadCloser(r, f.Close), nil
+}
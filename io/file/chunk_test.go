@@ -0,0 +1,188 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file_test
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestChunkedPayloads(t *testing.T) {
+	content := "0123456789abcdefghijklmnopqrstuvwxyz"
+
+	setupFn := func(t *testing.T, opts ...file.CreateOption) (string, *file.Database[*test.Base, *test.State], func()) {
+		path, removeDir := makeTempDir(t)
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			append(opts, file.WithPayloadChunkSize(16))...)
+		require.NoError(t, err)
+
+		return path, db, func() {
+			db.Close()
+			removeDir()
+		}
+	}
+
+	readPayloadFn := func(t *testing.T, db *file.Database[*test.Base, *test.State], id string) string {
+		r, err := db.OpenPayload(id)
+		require.NoError(t, err)
+		defer r.Close()
+		data, err := io.ReadAll(r)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	t.Run("Apply", func(t *testing.T) {
+		for _, key := range [][]byte{nil, testKey} {
+			path, db, tearDown := setupFn(t, file.WithCreateKey(key))
+			defer tearDown()
+
+			require.NoError(t, db.Apply(
+				&test.ChangeAttachPayload{PayloadID: "123"},
+				file.NewPayload("123", strings.NewReader(content))))
+
+			assert.FileExists(t, filepath.Join(path, file.FilePrefixPayloadManifest+"123"))
+			assert.FileExists(t, filepath.Join(path, file.FilePrefixPayloadChunk+"123-000002"))
+			assert.NoFileExists(t, filepath.Join(path, file.FilePrefixPayload+"123"))
+			assert.Equal(t, content, readPayloadFn(t, db, "123"))
+
+			stat, err := db.StatPayload("123")
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(content)), stat.Size())
+
+			require.NoError(t, file.VerifyDatabase(path, file.WithVerifyKey(key)))
+		}
+	})
+
+	t.Run("SingleChunk", func(t *testing.T) {
+		path, db, tearDown := setupFn(t)
+		defer tearDown()
+
+		require.NoError(t, db.WritePayload(file.NewPayload("123", strings.NewReader("small"))))
+
+		assert.FileExists(t, filepath.Join(path, file.FilePrefixPayload+"123"))
+		assert.NoFileExists(t, filepath.Join(path, file.FilePrefixPayloadChunk+"123-000000"))
+		assert.Equal(t, "small", readPayloadFn(t, db, "123"))
+	})
+
+	t.Run("Seek", func(t *testing.T) {
+		_, db, tearDown := setupFn(t, file.WithCreateKey(testKey))
+		defer tearDown()
+
+		require.NoError(t, db.WritePayload(file.NewPayload("123", strings.NewReader(content))))
+
+		r, err := db.OpenPayload("123")
+		require.NoError(t, err)
+		defer r.Close()
+
+		buffer := make([]byte, 4)
+		_, err = r.Seek(14, io.SeekStart)
+		require.NoError(t, err)
+		_, err = io.ReadFull(r, buffer)
+		require.NoError(t, err)
+		assert.Equal(t, "efgh", string(buffer))
+
+		_, err = r.Seek(-4, io.SeekEnd)
+		require.NoError(t, err)
+		data, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, "wxyz", string(data))
+	})
+
+	t.Run("Resume", func(t *testing.T) {
+		path, db, tearDown := setupFn(t, file.WithCreateKey(testKey))
+		defer tearDown()
+
+		err := db.WritePayload(file.NewPayload("123", &failingReader{r: strings.NewReader(content), n: 20}))
+		require.Error(t, err)
+		assert.FileExists(t, filepath.Join(path, file.FilePrefixPayloadManifest+"123"+file.FileSuffixPartial))
+		firstChunk := readFile(t, filepath.Join(path, file.FilePrefixPayloadChunk+"123-000000"))
+
+		require.NoError(t, db.WritePayload(file.NewPayload("123", strings.NewReader(content))))
+
+		assert.Equal(t, firstChunk, readFile(t, filepath.Join(path, file.FilePrefixPayloadChunk+"123-000000")))
+		assert.NoFileExists(t, filepath.Join(path, file.FilePrefixPayloadManifest+"123"+file.FileSuffixPartial))
+		assert.Equal(t, content, readPayloadFn(t, db, "123"))
+	})
+
+	t.Run("ResumeMismatch", func(t *testing.T) {
+		path, db, tearDown := setupFn(t)
+		defer tearDown()
+
+		err := db.WritePayload(file.NewPayload("123", &failingReader{r: strings.NewReader(content), n: 20}))
+		require.Error(t, err)
+
+		err = db.WritePayload(file.NewPayload("123", strings.NewReader(strings.ToUpper(content))))
+		assert.ErrorIs(t, err, file.ErrPayloadChunkMismatch)
+		assert.NoFileExists(t, filepath.Join(path, file.FilePrefixPayloadChunk+"123-000000"))
+
+		require.NoError(t, db.WritePayload(file.NewPayload("123", strings.NewReader(strings.ToUpper(content)))))
+		assert.Equal(t, strings.ToUpper(content), readPayloadFn(t, db, "123"))
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		path, db, tearDown := setupFn(t)
+		defer tearDown()
+
+		require.NoError(t, db.WritePayload(file.NewPayload("123", strings.NewReader(content))))
+		require.NoError(t, db.DeletePayload("123"))
+
+		assert.NoFileExists(t, filepath.Join(path, file.FilePrefixPayloadManifest+"123"))
+		assert.NoFileExists(t, filepath.Join(path, file.FilePrefixPayloadChunk+"123-000000"))
+		_, err := db.OpenPayload("123")
+		assert.ErrorIs(t, err, file.ErrPayloadMissing)
+	})
+
+	t.Run("VerifyCorruptChunk", func(t *testing.T) {
+		path, db, tearDown := setupFn(t)
+		defer tearDown()
+
+		require.NoError(t, db.WritePayload(file.NewPayload("123", strings.NewReader(content))))
+		makeFile(t, filepath.Join(path, file.FilePrefixPayloadChunk+"123-000001"), "ghijklmnopqrstuV")
+
+		err := file.VerifyDatabase(path)
+		corruptionErr := (*file.CorruptionError)(nil)
+		require.ErrorAs(t, err, &corruptionErr)
+		assert.Equal(t, file.FilePrefixPayloadChunk+"123-000001", corruptionErr.FileName)
+		assert.ErrorIs(t, err, file.ErrPayloadChecksumMismatch)
+	})
+}
+
+// failingReader fails after n bytes.
+type failingReader struct {
+	r io.Reader
+	n int
+}
+
+func (r *failingReader) Read(data []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, errors.New("read failed")
+	}
+	if len(data) > r.n {
+		data = data[:r.n]
+	}
+	n, err := r.r.Read(data)
+	r.n -= n
+	return n, err
+}
@@ -0,0 +1,65 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2"
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestCodec(t *testing.T) {
+	path, removeDir := makeTempDir(t)
+	defer removeDir()
+
+	db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithCodec(tapedb.CodecNameGob))
+	require.NoError(t, err)
+	require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 2}))
+	require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 3}))
+	require.NoError(t, db.Close())
+
+	_, err = file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithRebaseChangeCount(1), file.WithSpliceVerify())
+	require.NoError(t, err)
+
+	db, err = file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	assert.Equal(t, tapedb.CodecNameGob, db.Meta().Get(file.MetaFieldCodec))
+	assert.Equal(t, tapedb.CodecNameGob, tapedb.CodecName(db.Codec()))
+	assert.Equal(t, 2, db.Base().Value)
+	assert.Equal(t, 5, db.State().Counter)
+	assert.Equal(t, 1, db.LogLen())
+
+	changes := []tapedb.Change{}
+	require.NoError(t, db.ReadChanges(func(_ int, change tapedb.Change) error {
+		changes = append(changes, change)
+		return nil
+	}))
+	assert.Equal(t, []tapedb.Change{&test.ChangeCounterInc{Value: 3}}, changes)
+
+	t.Run("UnknownCodec", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		_, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithCodec("cbor"))
+		assert.ErrorIs(t, err, tapedb.ErrUnknownCodec)
+	})
+}
@@ -0,0 +1,57 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/simia-tech/tapedb/v2"
+)
+
+// CompareDatabases opens the databases at the provided paths read-only and reports whether the
+// hashes of their states are equal. It can be used to check a replica or a restored backup against
+// the original.
+func CompareDatabases[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](f F, pathA, pathB string, optsA, optsB []OpenOption) (bool, error) {
+	hashA, err := stateHash[B, S](f, pathA, optsA)
+	if err != nil {
+		return false, fmt.Errorf("open %s: %w", pathA, err)
+	}
+
+	hashB, err := stateHash[B, S](f, pathB, optsB)
+	if err != nil {
+		return false, fmt.Errorf("open %s: %w", pathB, err)
+	}
+
+	return bytes.Equal(hashA, hashB), nil
+}
+
+func stateHash[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](f F, path string, opts []OpenOption) ([]byte, error) {
+	db, err := OpenDatabase[B, S](f, path, append(opts, WithReadOnly())...)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return db.StateHash(), nil
+}
@@ -0,0 +1,57 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestCompareDatabases(t *testing.T) {
+	path, removeDir := makeTempDir(t)
+	defer removeDir()
+
+	create := func(name string, values ...int) string {
+		dbPath := filepath.Join(path, name)
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), dbPath)
+		require.NoError(t, err)
+		for _, value := range values {
+			require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: value}))
+		}
+		require.NoError(t, db.Close())
+		return dbPath
+	}
+
+	pathA := create("a", 2, 3)
+	pathB := create("b", 5)
+	pathC := create("c", 4)
+
+	equal, err := file.CompareDatabases[*test.Base, *test.State](test.NewFactory(), pathA, pathB, nil, nil)
+	require.NoError(t, err)
+	assert.True(t, equal)
+
+	equal, err = file.CompareDatabases[*test.Base, *test.State](test.NewFactory(), pathA, pathC, nil, nil)
+	require.NoError(t, err)
+	assert.False(t, equal)
+
+	_, err = file.CompareDatabases[*test.Base, *test.State](test.NewFactory(), pathA, filepath.Join(path, "d"), nil, nil)
+	assert.ErrorIs(t, err, file.ErrMissing)
+}
@@ -0,0 +1,170 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+
+	tapeio "github.com/simia-tech/tapedb/v2/io"
+	"github.com/simia-tech/tapedb/v2/io/compress"
+	"github.com/simia-tech/tapedb/v2/io/crypto"
+)
+
+// maxSampleFactor limits the samples that are read for training to the given multiple of the
+// dictionary size.
+const maxSampleFactor = 64
+
+var errStopSampling = errors.New("stop sampling")
+
+// LogDictionaries returns the dictionaries that the entries of the log might be compressed with.
+func LogDictionaries(meta Meta) [][]byte {
+	dictionaries := [][]byte{}
+	for _, field := range []string{MetaFieldLogDictionary, MetaFieldLogDictionaryPrevious} {
+		if dictionary := meta.GetBytes(field, nil); len(dictionary) > 0 {
+			dictionaries = append(dictionaries, dictionary)
+		}
+	}
+	return dictionaries
+}
+
+// TrainLogDictionary returns a dictionary of the provided size that has been trained on the entries
+// of the log of the database at the provided path. It can be used to create databases with similar
+// changes. A size of zero selects the default size.
+func TrainLogDictionary(path string, size int, opts ...OpenOption) ([]byte, error) {
+	options := defaultOpenOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	meta, err := options.layout.readDatabaseMeta(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := options.keyFunc.deriveKey(meta)
+	if err != nil {
+		return nil, fmt.Errorf("derive key: %w", err)
+	}
+
+	samples, err := readLogSamples(options.layout.LogPath(path), key, LogDictionaries(meta), size)
+	if err != nil {
+		if errors.Is(err, crypto.ErrInvalidKey) {
+			return nil, ErrInvalidKey
+		}
+		return nil, err
+	}
+
+	return compress.Train(samples, size), nil
+}
+
+// wrapBaseReader decrypts the base if a key is provided and decompresses it if it has been written
+// with a compression.
+func wrapBaseReader(r io.Reader, c crypto.Cipher, key []byte, compression string) (io.Reader, error) {
+	r, err := crypto.WrapBlockReaderWithCipher(r, c, key)
+	if err != nil || compression == "" {
+		return r, err
+	}
+	return compress.WrapBlockReader(r, compression)
+}
+
+// wrapBaseWriter compresses the base with the provided compression before it's encrypted, since
+// encrypted content doesn't compress anymore.
+func wrapBaseWriter(w io.WriteCloser, c crypto.Cipher, key []byte, compression string) (io.WriteCloser, error) {
+	w, err := crypto.WrapBlockWriterWithCipher(w, c, key, NonceFn)
+	if err != nil || compression == "" {
+		return w, err
+	}
+	return compress.WrapBlockWriter(w, compression)
+}
+
+func setBaseCompression(meta Meta, compression string) {
+	if compression != "" {
+		meta.Set(MetaFieldBaseCompression, compression)
+	} else {
+		textproto.MIMEHeader(meta).Del(MetaFieldBaseCompression)
+	}
+}
+
+func setLogCompression(meta Meta, dictionary []byte) {
+	meta.Set(MetaFieldLogCompression, LogCompressionZstd)
+	if len(dictionary) > 0 {
+		meta.SetBytes(MetaFieldLogDictionary, dictionary)
+	} else {
+		textproto.MIMEHeader(meta).Del(MetaFieldLogDictionary)
+	}
+}
+
+// wrapCompressLogWriter compresses the entries of unencrypted logs if requested by the meta. The
+// entries of encrypted logs wouldn't compress anymore.
+func wrapCompressLogWriter(w tapeio.LogWriter, meta Meta, key []byte) (tapeio.LogWriter, error) {
+	if w == nil || len(key) > 0 || meta.Get(MetaFieldLogCompression) != LogCompressionZstd {
+		return w, nil
+	}
+	return compress.WrapLogWriter(w, meta.GetBytes(MetaFieldLogDictionary, nil))
+}
+
+func wrapLogReader(r tapeio.LogReader, key []byte, dictionaries [][]byte) (tapeio.LogReader, error) {
+	r, err := crypto.WrapLogReader(r, key)
+	if err != nil {
+		return nil, err
+	}
+	return compress.WrapLogReader(r, dictionaries...), nil
+}
+
+// readLogSamples returns the plain entries of the log at the provided path until their total size
+// reaches a multiple of the dictionary size.
+func readLogSamples(path string, key []byte, dictionaries [][]byte, size int) ([][]byte, error) {
+	if size <= 0 {
+		size = compress.DefaultDictionarySize
+	}
+
+	f, _, err := mayOpenReadOnlyFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if f == nil {
+		return nil, nil
+	}
+	defer f.Close()
+
+	logR, err := wrapLogReader(tapeio.NewLogReader(f), key, dictionaries)
+	if err != nil {
+		return nil, fmt.Errorf("new log reader: %w", err)
+	}
+
+	samples, total := [][]byte{}, 0
+	err = tapeio.ReadLogEntries(logR, func(entry tapeio.LogEntry) error {
+		r, err := entry.Reader()
+		if err != nil {
+			return err
+		}
+		sample, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		samples = append(samples, sample)
+		if total += len(sample); total >= maxSampleFactor*size {
+			return errStopSampling
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopSampling) {
+		return nil, err
+	}
+	return samples, nil
+}
@@ -0,0 +1,229 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2/io/compress"
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestLogCompression(t *testing.T) {
+	setupFn := func(t *testing.T, opts ...file.CreateOption) (string, func()) {
+		path, removeDir := makeTempDir(t)
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path, opts...)
+		require.NoError(t, err)
+		for index := 0; index < 100; index++ {
+			require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: index}))
+		}
+		require.NoError(t, db.Close())
+
+		return path, removeDir
+	}
+
+	logSizeFn := func(t *testing.T, path string) int64 {
+		stat, err := os.Stat(filepath.Join(path, file.FileNameLog))
+		require.NoError(t, err)
+		return stat.Size()
+	}
+
+	openFn := func(t *testing.T, path string) *file.Database[*test.Base, *test.State] {
+		db, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path)
+		require.NoError(t, err)
+		return db
+	}
+
+	t.Run("Create", func(t *testing.T) {
+		plainPath, removePlainDir := setupFn(t)
+		defer removePlainDir()
+
+		dictionary, err := file.TrainLogDictionary(plainPath, 0)
+		require.NoError(t, err)
+		require.NotEmpty(t, dictionary)
+
+		path, removeDir := setupFn(t, file.WithLogCompression(dictionary))
+		defer removeDir()
+
+		assert.Less(t, logSizeFn(t, path), logSizeFn(t, plainPath))
+
+		db := openFn(t, path)
+		defer db.Close()
+
+		assert.Equal(t, file.LogCompressionZstd, db.Meta().Get(file.MetaFieldLogCompression))
+		assert.Equal(t, dictionary, db.Meta().GetBytes(file.MetaFieldLogDictionary, nil))
+		assert.Equal(t, 4950, db.State().Counter)
+		assert.Equal(t, 100, db.LogLen())
+	})
+
+	t.Run("SpliceTraining", func(t *testing.T) {
+		path, removeDir := setupFn(t)
+		defer removeDir()
+
+		plainLogSize := logSizeFn(t, path)
+
+		_, err := file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithSpliceLogDictionaryTraining(0), file.WithSpliceVerify())
+		require.NoError(t, err)
+
+		assert.Less(t, logSizeFn(t, path), plainLogSize)
+
+		db := openFn(t, path)
+		dictionary := db.Meta().GetBytes(file.MetaFieldLogDictionary, nil)
+		assert.NotEmpty(t, dictionary)
+		assert.False(t, db.Meta().Has(file.MetaFieldLogDictionaryPrevious))
+		assert.Equal(t, 4950, db.State().Counter)
+		require.NoError(t, db.Apply(&test.ChangeCounterSet{Value: 7}))
+		require.NoError(t, db.Close())
+
+		// a re-trained dictionary replaces the previous one
+		_, err = file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithSpliceLogDictionaryTraining(64), file.WithSpliceVerify())
+		require.NoError(t, err)
+
+		db = openFn(t, path)
+		defer db.Close()
+
+		assert.NotEqual(t, dictionary, db.Meta().GetBytes(file.MetaFieldLogDictionary, nil))
+		assert.Equal(t, 7, db.State().Counter)
+		assert.Equal(t, 101, db.LogLen())
+	})
+
+	t.Run("PreviousDictionary", func(t *testing.T) {
+		path, removeDir := setupFn(t, file.WithLogCompression([]byte(`counter-inc{"value":1}`)))
+		defer removeDir()
+
+		// the meta is written before the swap, so the source log has to stay readable
+		meta, err := file.ReadDatabaseMeta(path)
+		require.NoError(t, err)
+		meta.SetBytes(file.MetaFieldLogDictionaryPrevious, meta.GetBytes(file.MetaFieldLogDictionary, nil))
+		meta.SetBytes(file.MetaFieldLogDictionary, []byte(`counter-set{"value":1}`))
+		require.NoError(t, file.WriteMetaFile(filepath.Join(path, file.FileNameMeta), meta))
+
+		db := openFn(t, path)
+		defer db.Close()
+
+		assert.Equal(t, 4950, db.State().Counter)
+	})
+}
+
+func TestBaseCompression(t *testing.T) {
+	setupFn := func(t *testing.T, opts ...file.CreateOption) (string, func()) {
+		path, removeDir := makeTempDir(t)
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path, opts...)
+		require.NoError(t, err)
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 2}))
+		require.NoError(t, db.Close())
+
+		return path, removeDir
+	}
+
+	isGzipFn := func(t *testing.T, path string) bool {
+		data, err := os.ReadFile(filepath.Join(path, file.FileNameBase))
+		require.NoError(t, err)
+		return len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b
+	}
+
+	isZstdFn := func(t *testing.T, path string) bool {
+		data, err := os.ReadFile(filepath.Join(path, file.FileNameBase))
+		require.NoError(t, err)
+		return bytes.HasPrefix(data, []byte{0x28, 0xb5, 0x2f, 0xfd})
+	}
+
+	counterFn := func(t *testing.T, path string, opts ...file.OpenOption) int {
+		db, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path, opts...)
+		require.NoError(t, err)
+		defer db.Close()
+		return db.State().Counter
+	}
+
+	t.Run("Create", func(t *testing.T) {
+		path, removeDir := setupFn(t, file.WithBaseCompression(file.BaseCompressionGzip))
+		defer removeDir()
+
+		_, err := file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithRebaseChangeCount(1))
+		require.NoError(t, err)
+
+		assert.True(t, isGzipFn(t, path))
+		assert.Equal(t, 3, counterFn(t, path))
+	})
+
+	t.Run("CreateEncrypted", func(t *testing.T) {
+		path, removeDir := setupFn(t, file.WithCreateKey(testKey), file.WithBaseCompression(file.BaseCompressionGzip))
+		defer removeDir()
+
+		_, err := file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithSourceKey(testKey), file.WithTargetKey(testKey), file.WithRebaseChangeCount(1), file.WithSpliceVerify())
+		require.NoError(t, err)
+
+		assert.Equal(t, 3, counterFn(t, path, file.WithOpenKey(testKey)))
+	})
+
+	t.Run("Splice", func(t *testing.T) {
+		path, removeDir := setupFn(t)
+		defer removeDir()
+
+		_, err := file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithRebaseChangeCount(1), file.WithSpliceBaseCompression(file.BaseCompressionGzip))
+		require.NoError(t, err)
+
+		meta, err := file.ReadDatabaseMeta(path)
+		require.NoError(t, err)
+		assert.Equal(t, file.BaseCompressionGzip, meta.Get(file.MetaFieldBaseCompression))
+		assert.True(t, isGzipFn(t, path))
+		assert.Equal(t, 3, counterFn(t, path))
+
+		_, err = file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithRebaseChangeCount(1), file.WithSpliceBaseCompression(file.BaseCompressionZstd))
+		require.NoError(t, err)
+
+		meta, err = file.ReadDatabaseMeta(path)
+		require.NoError(t, err)
+		assert.Equal(t, file.BaseCompressionZstd, meta.Get(file.MetaFieldBaseCompression))
+		assert.True(t, isZstdFn(t, path))
+		assert.Equal(t, 3, counterFn(t, path))
+
+		_, err = file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithRebaseChangeCount(1), file.WithSpliceBaseCompression(""))
+		require.NoError(t, err)
+
+		meta, err = file.ReadDatabaseMeta(path)
+		require.NoError(t, err)
+		assert.False(t, meta.Has(file.MetaFieldBaseCompression))
+		assert.False(t, isGzipFn(t, path))
+		assert.False(t, isZstdFn(t, path))
+		assert.Equal(t, 3, counterFn(t, path))
+	})
+
+	t.Run("UnknownCompression", func(t *testing.T) {
+		path, removeDir := setupFn(t)
+		defer removeDir()
+
+		_, err := file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithRebaseChangeCount(1), file.WithSpliceBaseCompression("lz4"))
+		assert.ErrorIs(t, err, compress.ErrUnknownAlgorithm)
+		assert.Equal(t, 3, counterFn(t, path))
+	})
+}
@@ -0,0 +1,214 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file_test
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+const (
+	concurrencyWorkers    = 8
+	concurrencyIterations = 50
+)
+
+func TestDatabaseConcurrency(t *testing.T) {
+	path, removeDir := makeTempDir(t)
+	defer removeDir()
+
+	db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithCreateKey(testKey))
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.Apply(
+		&test.ChangeAttachPayload{PayloadID: "shared"},
+		file.NewPayload("shared", strings.NewReader("test content"))))
+
+	wg := sync.WaitGroup{}
+	for worker := 0; worker < concurrencyWorkers; worker++ {
+		wg.Add(3)
+
+		go func() {
+			defer wg.Done()
+			for index := 0; index < concurrencyIterations; index++ {
+				assert.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+			}
+		}()
+
+		go func() {
+			defer wg.Done()
+			for index := 0; index < concurrencyIterations; index++ {
+				state := db.State()
+				state.ReadLocker.Lock()
+				_ = state.Counter
+				state.ReadLocker.Unlock()
+				assert.NoError(t, db.View(func(state *test.State) error {
+					_ = state.Counter
+					_ = len(state.Items)
+					return nil
+				}))
+				_ = db.LogLen64()
+			}
+		}()
+
+		go func(worker int) {
+			defer wg.Done()
+			for index := 0; index < concurrencyIterations; index++ {
+				r, err := db.OpenPayload("shared")
+				if !assert.NoError(t, err) {
+					return
+				}
+				content, err := io.ReadAll(r)
+				assert.NoError(t, err)
+				assert.Equal(t, "test content", string(content))
+				assert.NoError(t, r.Close())
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	assert.Equal(t, concurrencyWorkers*concurrencyIterations, db.State().Counter)
+	assert.Equal(t, 1+concurrencyWorkers*concurrencyIterations, db.LogLen())
+}
+
+func TestDeckConcurrency(t *testing.T) {
+	path, removeDir := makeTempDir(t)
+	defer removeDir()
+
+	testFactory := test.NewFactory()
+
+	// the deck holds fewer databases than used, so they get evicted under load
+	deck, err := file.NewDeck[*test.Base, *test.State, *test.Factory](2)
+	require.NoError(t, err)
+	defer deck.Close()
+
+	paths := []string{}
+	for index := 0; index < 4; index++ {
+		p := filepath.Join(path, fmt.Sprintf("db-%d", index))
+		require.NoError(t, deck.Create(testFactory, p))
+		paths = append(paths, p)
+	}
+
+	wg := sync.WaitGroup{}
+	for worker := 0; worker < concurrencyWorkers; worker++ {
+		wg.Add(3)
+
+		go func(worker int) {
+			defer wg.Done()
+			for index := 0; index < concurrencyIterations; index++ {
+				p := paths[(worker+index)%len(paths)]
+				assert.NoError(t, deck.WithOpen(testFactory, p, nil, func(db *file.Database[*test.Base, *test.State]) error {
+					return db.Apply(&test.ChangeCounterInc{Value: 1})
+				}))
+			}
+		}(worker)
+
+		go func(worker int) {
+			defer wg.Done()
+			for index := 0; index < concurrencyIterations; index++ {
+				p := paths[(worker+index)%len(paths)]
+				assert.NoError(t, deck.WithOpenRead(testFactory, p, nil, func(db *file.ReadOnlyDatabase[*test.Base, *test.State]) error {
+					state := db.State()
+					state.ReadLocker.Lock()
+					_ = state.Counter
+					state.ReadLocker.Unlock()
+					return nil
+				}))
+				_, err := deck.LogLen64(p)
+				assert.NoError(t, err)
+				meta, err := deck.Meta(p)
+				assert.NoError(t, err)
+				_ = meta.Get(file.MetaFieldLogLen)
+			}
+		}(worker)
+
+		go func(worker int) {
+			defer wg.Done()
+			for index := 0; index < concurrencyIterations/10; index++ {
+				p := paths[(worker+index)%len(paths)]
+				_, err := deck.Splice(testFactory, p)
+				assert.NoError(t, err)
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	total := 0
+	for _, p := range paths {
+		require.NoError(t, deck.WithOpenRead(testFactory, p, nil, func(db *file.ReadOnlyDatabase[*test.Base, *test.State]) error {
+			total += db.State().Counter
+			return nil
+		}))
+	}
+	assert.Equal(t, concurrencyWorkers*concurrencyIterations, total)
+}
+
+func TestDatabaseOpenPayloadWhileWriting(t *testing.T) {
+	for name, opts := range map[string][]file.CreateOption{
+		"Plain":     nil,
+		"Encrypted": {file.WithCreateKey(testKey)},
+		"Chunked":   {file.WithPayloadChunkSize(4)},
+		"WithInfo":  {file.WithPayloadInfo()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			path, removeDir := makeTempDir(t)
+			defer removeDir()
+
+			db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path, opts...)
+			require.NoError(t, err)
+			defer db.Close()
+
+			pr, pw := io.Pipe()
+			done := make(chan error)
+			go func() {
+				done <- db.WritePayload(file.NewPayload("123", pr))
+			}()
+
+			_, err = pw.Write([]byte("test "))
+			require.NoError(t, err)
+
+			_, err = db.OpenPayload("123")
+			assert.ErrorIs(t, err, file.ErrPayloadMissing)
+			_, err = db.PayloadInfo("123")
+			assert.ErrorIs(t, err, file.ErrPayloadMissing)
+			ids, err := db.PayloadIDs()
+			require.NoError(t, err)
+			assert.Empty(t, ids)
+			assert.ErrorIs(t, db.WritePayload(file.NewPayload("123", strings.NewReader("other"))), file.ErrPayloadUploadInProgress)
+
+			_, err = pw.Write([]byte("content"))
+			require.NoError(t, err)
+			require.NoError(t, pw.Close())
+			require.NoError(t, <-done)
+
+			r, err := db.OpenPayload("123")
+			require.NoError(t, err)
+			defer r.Close()
+			content, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, "test content", string(content))
+		})
+	}
+}
@@ -21,6 +21,14 @@ const (
 	FileNameNewMeta = "meta.new"
 	FileNameNewBase = "base.new"
 	FileNameNewLog  = "log.new"
+	FileNameLock    = "lock"
+	FileNameJournal = "splice.journal"
 
-	FilePrefixPayload = "payload-"
+	FilePrefixPayload         = "payload-"
+	FilePrefixPayloadInfo     = "info-"
+	FilePrefixPayloadManifest = "manifest-"
+	FilePrefixPayloadChunk    = "chunk-"
+	FilePrefixUpload          = "upload-"
+	FileSuffixBackup          = ".old"
+	FileSuffixPartial         = ".partial"
 )
@@ -0,0 +1,84 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/simia-tech/tapedb/v2"
+)
+
+// ErrCopyMismatch is returned if a written file doesn't match the bytes that have been written to
+// it, e.g. because it got truncated.
+var ErrCopyMismatch = tapedb.NewError(tapedb.ErrorCodeCorrupt, "copy mismatch")
+
+// copyFileVerified copies the source file to a new file at the target path. The number of copied
+// bytes has to match the size of the source and the target is read back and compared to the hash of
+// the copied bytes, so a truncated copy is caught before anything relies on it.
+func copyFileVerified(sourceF *os.File, targetPath string, fileMode os.FileMode) error {
+	stat, err := sourceF.Stat()
+	if err != nil {
+		return err
+	}
+
+	targetF, err := createNewWriteOnlyFile(targetPath, fileMode)
+	if err != nil {
+		return err
+	}
+	defer targetF.Close()
+
+	targetWC := newChecksumWriteCloser(targetF)
+	if _, err := io.Copy(targetWC, sourceF); err != nil {
+		return err
+	}
+	if targetWC.Size() != stat.Size() {
+		return fmt.Errorf("copied %d of %d bytes to %s: %w", targetWC.Size(), stat.Size(), targetPath, ErrCopyMismatch)
+	}
+	if err := targetF.Sync(); err != nil {
+		return err
+	}
+	if err := targetF.Close(); err != nil {
+		return err
+	}
+
+	return verifyFile(targetPath, targetWC.Size(), targetWC.Sum())
+}
+
+// verifyFile reads the file at the provided path back and compares its size and SHA-256 sum with the
+// provided ones.
+func verifyFile(path string, size int64, sum []byte) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	n, err := io.Copy(hash, f)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", path, err)
+	}
+	if n != size {
+		return fmt.Errorf("file %s has %d bytes, expected %d: %w", path, n, size, ErrCopyMismatch)
+	}
+	if !bytes.Equal(hash.Sum(nil), sum) {
+		return fmt.Errorf("file %s: %w", path, ErrCopyMismatch)
+	}
+	return nil
+}
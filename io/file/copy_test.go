@@ -0,0 +1,61 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestSpliceTruncatedCopy(t *testing.T) {
+	path, removeDir := makeTempDir(t)
+	defer removeDir()
+
+	db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path)
+	require.NoError(t, err)
+	require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 2}))
+	require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 3}))
+	require.NoError(t, db.Close())
+
+	// the written bytes of the new base go elsewhere, so the file at its path stays empty
+	defer file.SetCreateFile(func(path string, mode os.FileMode) (*os.File, error) {
+		if filepath.Base(path) == file.FileNameNewBase {
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+			if err != nil {
+				return nil, err
+			}
+			f.Close()
+			path += ".lost"
+		}
+		return os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	})()
+
+	_, err = file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithRebaseChangeCount(1))
+	assert.ErrorIs(t, err, file.ErrCopyMismatch)
+
+	db, err = file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	assert.Equal(t, 5, db.State().Counter)
+	assert.Equal(t, 2, db.LogLen())
+}
@@ -0,0 +1,119 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/simia-tech/crypt"
+	"golang.org/x/crypto/argon2"
+)
+
+var ErrInvalidCryptSettings = errors.New("invalid crypt settings")
+
+const (
+	cryptSettingsCode = "argon2id"
+
+	calibrateMaxTime = 256
+)
+
+// CryptSettings are the argon2id parameters the key of a database is derived from its password
+// with. The encoded form is a crypt settings string without salt, like DefaultCryptSettings.
+type CryptSettings struct {
+	// Memory is the amount of memory in KiB.
+	Memory uint32
+	// Time is the number of passes over the memory.
+	Time uint32
+	// Parallelism is the number of threads.
+	Parallelism uint8
+}
+
+// ParseCryptSettings parses argon2id crypt settings. A salt in the settings is ignored.
+func ParseCryptSettings(value string) (CryptSettings, error) {
+	code, parameter, _, _, err := crypt.DecodeSettings(value)
+	if err != nil {
+		return CryptSettings{}, fmt.Errorf("%w: %v", ErrInvalidCryptSettings, err)
+	}
+	if code != cryptSettingsCode {
+		return CryptSettings{}, fmt.Errorf("%w: unsupported algorithm %s", ErrInvalidCryptSettings, code)
+	}
+
+	s := CryptSettings{
+		Memory:      uint32(parameter.GetInt("m", 0)),
+		Time:        uint32(parameter.GetInt("t", 0)),
+		Parallelism: uint8(parameter.GetInt("p", 0)),
+	}
+	if err := s.Validate(); err != nil {
+		return CryptSettings{}, err
+	}
+	return s, nil
+}
+
+// Validate returns ErrInvalidCryptSettings, if argon2id can't be run with the settings.
+func (s CryptSettings) Validate() error {
+	if s.Time < 1 {
+		return fmt.Errorf("%w: time must be at least 1", ErrInvalidCryptSettings)
+	}
+	if s.Parallelism < 1 {
+		return fmt.Errorf("%w: parallelism must be at least 1", ErrInvalidCryptSettings)
+	}
+	if s.Memory < 8*uint32(s.Parallelism) {
+		return fmt.Errorf("%w: memory must be at least %d KiB for a parallelism of %d",
+			ErrInvalidCryptSettings, 8*uint32(s.Parallelism), s.Parallelism)
+	}
+	return nil
+}
+
+// String returns the encoded settings without salt, so a new salt is generated for each database.
+func (s CryptSettings) String() string {
+	return fmt.Sprintf("$%s$v=19$m=%d,t=%d,p=%d$", cryptSettingsCode, s.Memory, s.Time, s.Parallelism)
+}
+
+// Calibrate returns a copy of the settings with a time, that makes a key derivation on this machine
+// take about the target duration, but not less. The memory and the parallelism are kept. The time
+// is capped at 256.
+func (s CryptSettings) Calibrate(target time.Duration) (CryptSettings, error) {
+	if err := s.Validate(); err != nil {
+		return CryptSettings{}, err
+	}
+
+	password := []byte("calibrate")
+	salt := make([]byte, 16)
+	measure := func(t uint32) time.Duration {
+		start := time.Now()
+		argon2.IDKey(password, salt, t, s.Memory, s.Parallelism, 32)
+		return time.Since(start)
+	}
+
+	// the duration grows about linearly with the time, so each step estimates the time of the
+	// target from the last measurement
+	s.Time = 1
+	for duration := measure(s.Time); duration < target && s.Time < calibrateMaxTime; duration = measure(s.Time) {
+		next := uint32(int64(s.Time) * int64(target) / int64(max(duration, 1)))
+		s.Time = min(max(next, s.Time+1), calibrateMaxTime)
+	}
+	return s, nil
+}
+
+// CalibrateCryptSettings calibrates the time of the default crypt settings to the target duration.
+func CalibrateCryptSettings(target time.Duration) (CryptSettings, error) {
+	s, err := ParseCryptSettings(DefaultCryptSettings)
+	if err != nil {
+		return CryptSettings{}, err
+	}
+	return s.Calibrate(target)
+}
@@ -0,0 +1,113 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestCryptSettings(t *testing.T) {
+	t.Run("Parse", func(t *testing.T) {
+		s, err := file.ParseCryptSettings(file.DefaultCryptSettings)
+		require.NoError(t, err)
+		assert.Equal(t, file.CryptSettings{Memory: 65536, Time: 2, Parallelism: 4}, s)
+		assert.Equal(t, file.DefaultCryptSettings, s.String())
+
+		s, err = file.ParseCryptSettings(testCryptSettings + "c2FsdHNhbHQ")
+		require.NoError(t, err)
+		assert.Equal(t, testCryptSettings, s.String())
+
+		_, err = file.ParseCryptSettings("$argon2i$v=19$m=1024,t=1,p=1$")
+		assert.ErrorIs(t, err, file.ErrInvalidCryptSettings)
+		_, err = file.ParseCryptSettings("$argon2id$v=19$m=1024,p=1$")
+		assert.ErrorIs(t, err, file.ErrInvalidCryptSettings)
+	})
+
+	t.Run("Validate", func(t *testing.T) {
+		assert.NoError(t, file.CryptSettings{Memory: 8, Time: 1, Parallelism: 1}.Validate())
+		assert.ErrorIs(t, file.CryptSettings{Memory: 1024, Time: 0, Parallelism: 1}.Validate(), file.ErrInvalidCryptSettings)
+		assert.ErrorIs(t, file.CryptSettings{Memory: 1024, Time: 1, Parallelism: 0}.Validate(), file.ErrInvalidCryptSettings)
+		assert.ErrorIs(t, file.CryptSettings{Memory: 16, Time: 1, Parallelism: 4}.Validate(), file.ErrInvalidCryptSettings)
+	})
+
+	t.Run("Calibrate", func(t *testing.T) {
+		s := file.CryptSettings{Memory: 1024, Time: 1, Parallelism: 1}
+
+		calibrated, err := s.Calibrate(20 * time.Millisecond)
+		require.NoError(t, err)
+		assert.Greater(t, calibrated.Time, uint32(1))
+		assert.Equal(t, s.Memory, calibrated.Memory)
+		assert.Equal(t, s.Parallelism, calibrated.Parallelism)
+
+		_, err = file.CryptSettings{}.Calibrate(time.Millisecond)
+		assert.ErrorIs(t, err, file.ErrInvalidCryptSettings)
+	})
+
+	t.Run("Create", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		s := file.CryptSettings{Memory: 2048, Time: 1, Parallelism: 2}
+		keyFunc := file.DeriveKeyFrom("test", file.DefaultCryptSettings)
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithCreateKeyFunc(keyFunc), file.WithCryptSettings(s))
+		require.NoError(t, err)
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 21}))
+		require.NoError(t, db.Close())
+
+		meta, err := file.ReadDatabaseMeta(path)
+		require.NoError(t, err)
+		cs := meta.Get(file.MetaHeaderCryptSettings)
+		assert.True(t, strings.HasPrefix(cs, s.String()))
+		assert.Greater(t, len(cs), len(s.String()))
+
+		db, err = file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithOpenKeyFunc(keyFunc))
+		require.NoError(t, err)
+		defer db.Close()
+		assert.Equal(t, 21, db.State().Counter)
+	})
+
+	t.Run("CreateWithStaticKey", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithCreateKey(testKey), file.WithCryptSettings(file.CryptSettings{Memory: 2048, Time: 1, Parallelism: 2}))
+		require.NoError(t, err)
+		require.NoError(t, db.Close())
+
+		meta, err := file.ReadDatabaseMeta(path)
+		require.NoError(t, err)
+		assert.False(t, meta.Has(file.MetaHeaderCryptSettings))
+	})
+
+	t.Run("CreateWithInvalidSettings", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		_, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithCreateKeyFunc(file.DeriveKeyFrom("test", file.DefaultCryptSettings)), file.WithCryptSettings(file.CryptSettings{}))
+		assert.ErrorIs(t, err, file.ErrInvalidCryptSettings)
+	})
+}
@@ -15,38 +15,125 @@
 package file
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	tapedb "github.com/simia-tech/tapedb/v2"
 	tapeio "github.com/simia-tech/tapedb/v2/io"
+	"github.com/simia-tech/tapedb/v2/io/compress"
 	"github.com/simia-tech/tapedb/v2/io/crypto"
 )
 
 const (
-	MetaFieldNonce = "Nonce"
+	MetaFieldNonce   = "Nonce"
+	MetaFieldLogLen  = "Log-Len"
+	MetaFieldLogSize = "Log-Size"
+
+	MetaFieldCreated      = "Created"
+	MetaFieldLastModified = "Last-Modified"
+
+	MetaFieldDatabaseID    = "Database-Id"
+	MetaFieldFormatVersion = "Format-Version"
+
+	// FormatVersion is the version of the file format that is written. Databases without a
+	// Format-Version field have version 1.
+	FormatVersion = 1
+
+	MetaFieldLogChecksum = "Log-Checksum"
+	MetaFieldBaseSHA256  = "Base-Sha256"
+	LogChecksumCRC32C    = "crc32c"
+
+	MetaFieldLogCompression        = "Log-Compression"
+	MetaFieldLogDictionary         = "Log-Dictionary"
+	MetaFieldLogDictionaryPrevious = "Log-Dictionary-Previous"
+	LogCompressionZstd             = "zstd"
+
+	MetaFieldBaseCompression = "Base-Compression"
+	BaseCompressionGzip      = compress.AlgorithmGzip
+	BaseCompressionZstd      = compress.AlgorithmZstd
+
+	MetaFieldCodec = "Codec"
+
+	MetaFieldPayloadInlineSize  = "Payload-Inline-Size"
+	MetaFieldPayloadInfo        = "Payload-Info"
+	MetaFieldPayloadChunkSize   = "Payload-Chunk-Size"
+	PayloadInfoSidecar          = "sidecar"
+	PayloadInfoFieldSize        = "Size"
+	PayloadInfoFieldContentType = "Content-Type"
+	PayloadInfoFieldSHA256      = "Sha256"
+	PayloadInfoFieldCreatedAt   = "Created-At"
+
+	PayloadManifestFieldSize        = "Size"
+	PayloadManifestFieldChunkSize   = "Chunk-Size"
+	PayloadManifestFieldChunkSHA256 = "Chunk-Sha256"
+
+	MetaFieldSpliceTime           = "Splice-Time"
+	MetaFieldSpliceDuration       = "Splice-Duration"
+	MetaFieldSpliceRebasedChanges = "Splice-Rebased-Changes"
+	MetaFieldSpliceBaseSize       = "Splice-Base-Size"
+	MetaFieldSpliceLogSize        = "Splice-Log-Size"
+	MetaFieldSpliceGeneration     = "Splice-Generation"
+	MetaFieldSpliceRebasedTotal   = "Splice-Rebased-Total"
 )
 
 var (
-	ErrMissing    = errors.New("missing")
-	ErrExisting   = errors.New("existing")
-	ErrInvalidKey = errors.New("invalid key")
+	ErrMissing    = tapedb.NewError(tapedb.ErrorCodeMissing, "missing")
+	ErrExisting   = tapedb.NewError(tapedb.ErrorCodeExisting, "existing")
+	ErrInvalidKey = tapedb.NewError(tapedb.ErrorCodeInvalidKey, "invalid key")
+	ErrReadOnly   = tapedb.NewError(tapedb.ErrorCodeReadOnly, "read only")
+	ErrDiverged   = tapedb.NewError(tapedb.ErrorCodeDiverged, "diverged")
+
+	ErrUnsupportedFormatVersion = tapedb.NewError(tapedb.ErrorCodeUnsupported, "unsupported format version")
 )
 
 var NonceFn crypto.NonceFunc = crypto.RandomNonceFn()
 
 type Database[B tapedb.Base, S tapedb.State] struct {
-	path       string
-	fileMode   fs.FileMode
-	meta       Meta
-	key        []byte
-	db         *tapeio.Database[B, S]
-	logCloseFn func() error
+	path               string
+	fileMode           fs.FileMode
+	meta               Meta
+	key                []byte
+	cipher             crypto.Cipher
+	readOnly           bool
+	maxPayloadSize     int64
+	retryPolicy        tapeio.RetryPolicy
+	db                 *tapeio.Database[B, S]
+	logCloseFn         func() error
+	logSyncW           *syncLogWriter
+	clock              tapedb.Clock
+	readChangesFn      func(func(int, tapedb.Change) error) error
+	quiesceMutex       sync.RWMutex
+	uploadsMutex       sync.Mutex
+	uploads            map[string]struct{}
+	observer           Observer
+	inlineSize         int64
+	inlineMutex        sync.RWMutex
+	inlinePayloads     inlinePayloads
+	chunkSize          int64
+	codec              tapedb.Codec
+	payloadWritesMutex sync.Mutex
+	payloadWrites      map[string]struct{}
+	mirror             *PayloadMirror
+	mirrorWG           sync.WaitGroup
+	layout             Layout
+	timestamps         bool
+	lastModified       atomic.Int64
+	formatVersion      int
+	lock               *fileLock
+	migrator           tapedb.ChangeMigrator
+	spliceMutex        sync.Mutex
 }
 
 func CreateDatabase[
@@ -63,55 +150,171 @@ func CreateDatabase[
 		opt(&options)
 	}
 
-	if err := os.MkdirAll(path, options.directoryMode); err != nil {
+	db, err := createDatabase[B, S](f, path, options)
+	return db, tapedb.WrapError("create", path, err)
+}
+
+func createDatabase[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](
+	f F,
+	path string,
+	options createOptions,
+) (_ *Database[B, S], err error) {
+	if err := options.layout.Validate(); err != nil {
+		return nil, err
+	}
+	if options.cryptSettings != nil {
+		if err := options.cryptSettings.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	err = options.retryPolicy.Do(func() error {
+		return os.MkdirAll(path, options.directoryMode)
+	})
+	if err != nil {
 		return nil, fmt.Errorf("make directory: %w", err)
 	}
 
+	// an existing database would be locked by its writer, but that's reported as existing
+	if exists, err := options.layout.exists(path); err != nil {
+		return nil, err
+	} else if exists {
+		return nil, ErrExisting
+	}
+
+	lock, err := options.layout.lock(path, options.lock.resolve(false), options.fileMode)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			lock.unlock()
+		}
+	}()
+
 	meta := options.metaFunc()
+	if options.cipher != "" {
+		meta.Set(MetaHeaderCipher, string(options.cipher))
+	}
+	if options.logChecksum {
+		meta.Set(MetaFieldLogChecksum, LogChecksumCRC32C)
+	}
+	if options.payloadInfo {
+		meta.Set(MetaFieldPayloadInfo, PayloadInfoSidecar)
+	}
+	if options.inlinePayloadSize > 0 {
+		meta.SetUInt64(MetaFieldPayloadInlineSize, uint64(options.inlinePayloadSize))
+	}
+	if options.payloadChunkSize > 0 {
+		meta.SetUInt64(MetaFieldPayloadChunkSize, uint64(options.payloadChunkSize))
+	}
+	if options.logCompression {
+		setLogCompression(meta, options.logDictionary)
+	}
+	if options.baseCompression != "" {
+		setBaseCompression(meta, options.baseCompression)
+	}
+	if options.codec != "" {
+		meta.Set(MetaFieldCodec, options.codec)
+	}
+	if options.timestamps {
+		meta.SetTime(MetaFieldCreated, tapedb.ClockOrSystem(options.clock).Now())
+	}
+	if !meta.Has(MetaFieldDatabaseID) {
+		meta.Set(MetaFieldDatabaseID, tapedb.GenerateUUID())
+	}
+	meta.SetUInt64(MetaFieldFormatVersion, FormatVersion)
+
+	c, err := cipherFromMeta(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	codec, err := tapedb.LookupCodec(f, meta.Get(MetaFieldCodec))
+	if err != nil {
+		return nil, err
+	}
+
+	cryptSettings := ""
+	if options.cryptSettings != nil && options.keyFunc != nil && !meta.Has(MetaHeaderCryptSettings) {
+		cryptSettings = options.cryptSettings.String()
+		meta.Set(MetaHeaderCryptSettings, cryptSettings)
+	}
 
 	key, err := options.keyFunc.deriveKey(meta)
 	if err != nil {
 		return nil, fmt.Errorf("derive key: %w", err)
 	}
 
+	// a key func that doesn't derive the key from a password leaves the settings without salt
+	if cryptSettings != "" && meta.Get(MetaHeaderCryptSettings) == cryptSettings {
+		meta.Del(MetaHeaderCryptSettings)
+	}
+
 	if len(meta) > 0 {
-		metaPath := filepath.Join(path, FileNameMeta)
+		metaPath := options.layout.MetaPath(path)
 		metaF, err := createNewWriteOnlyFile(metaPath, options.fileMode)
 		if err != nil {
 			return nil, fmt.Errorf("create meta %s: %w", metaPath, err)
 		}
 
-		if _, err := meta.WriteTo(metaF); err != nil {
+		_, err = meta.WriteTo(metaF)
+		metaF.Close()
+		if err != nil {
 			return nil, err
 		}
 	}
 
-	logPath := filepath.Join(path, FileNameLog)
-	logF, err := createNewWriteOnlyFile(logPath, options.fileMode)
+	logPath := options.layout.LogPath(path)
+	logF, err := createNewLogFile(logPath, options.fileMode)
 	if err != nil {
 		return nil, fmt.Errorf("create log %s: %w", logPath, err)
 	}
-	logW := tapeio.LogWriter(tapeio.NewLogWriter(logF))
+	logSyncW := newSyncLogWriter(logF, options.syncPolicy, options.groupCommit, options.clock)
+	logW, err := wrapCompressLogWriter(wrapChecksumLogWriter(logSyncW, meta, key), meta, key)
+	if err != nil {
+		return nil, fmt.Errorf("new log writer: %w", err)
+	}
 
-	logW, err = crypto.WrapLogWriter(logW, key, NonceFn)
+	logW, err = crypto.WrapLogWriterWithCipher(logW, c, key, NonceFn)
 	if err != nil {
 		return nil, fmt.Errorf("new log writer: %w", err)
 	}
 
 	logCloseFn := logF.Close
 
-	db, err := tapeio.NewDatabase[B, S](f, logW)
+	db, err := tapeio.NewDatabase[B, S](f, logW, databaseOptions(options.applyFunc, options.groupCommit, nil, options.clock, codec)...)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Database[B, S]{
-		path:       path,
-		fileMode:   options.fileMode,
-		meta:       meta,
-		key:        key,
-		db:         db,
-		logCloseFn: logCloseFn,
+		path:           path,
+		fileMode:       options.fileMode,
+		meta:           meta,
+		key:            key,
+		cipher:         c,
+		maxPayloadSize: options.maxPayloadSize,
+		retryPolicy:    options.retryPolicy,
+		db:             db,
+		logCloseFn:     logCloseFn,
+		logSyncW:       logSyncW,
+		clock:          tapedb.ClockOrSystem(options.clock),
+		readChangesFn:  readChangesFunc[B, S](f, options.layout.LogPath(path), key, LogDictionaries(meta), nil, codec),
+		observer:       ObserverOrNop(options.observer),
+		mirror:         options.mirror,
+		layout:         options.layout,
+		inlineSize:     int64(meta.GetUInt64(MetaFieldPayloadInlineSize, 0)),
+		inlinePayloads: inlinePayloads{},
+		chunkSize:      int64(meta.GetUInt64(MetaFieldPayloadChunkSize, 0)),
+		codec:          codec,
+		timestamps:     options.timestamps,
+		formatVersion:  FormatVersion,
+		lock:           lock,
 	}, nil
 }
 
@@ -129,10 +332,90 @@ func OpenDatabase[
 		opt(&options)
 	}
 
+	if options.timeout > 0 {
+		ctx, cancel := context.WithTimeout(options.ctx, options.timeout)
+		defer cancel()
+		options.ctx = ctx
+	}
+
+	clock := tapedb.ClockOrSystem(options.clock)
+	start := clock.Now()
+	diagnostics := OpenDiagnostics{Path: path}
+	db, err := openDatabase[B, S](f, path, options, &diagnostics)
+	if err != nil && options.timeout > 0 && errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("open timeout of %s exceeded: %w", options.timeout, err)
+	}
+	err = tapedb.WrapError("open", path, err)
+	duration := clock.Now().Sub(start)
+	ObserverOrNop(options.observer).OnOpen(OpenEvent{Path: path, Duration: duration, Err: err})
+	if options.diagnosticsFunc != nil {
+		diagnostics.Duration = duration
+		diagnostics.Err = err
+		options.diagnosticsFunc(diagnostics)
+	}
+	return db, err
+}
+
+// OpenDatabaseContext opens the database like OpenDatabase, but stops reading the base and
+// replaying the log as soon as the provided context is done.
+func OpenDatabaseContext[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](
+	ctx context.Context,
+	f F,
+	path string,
+	opts ...OpenOption,
+) (*Database[B, S], error) {
+	return OpenDatabase[B, S](f, path, append(opts, withOpenContext(ctx))...)
+}
+
+func openDatabase[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](
+	f F,
+	path string,
+	options openOptions,
+	diagnostics *OpenDiagnostics,
+) (_ *Database[B, S], err error) {
+	if err := options.layout.Validate(); err != nil {
+		return nil, err
+	}
+	if err := options.layout.mustExist(path); err != nil {
+		return nil, err
+	}
+
+	lock, err := options.layout.lock(path, options.lock.resolve(options.readOnly), 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			lock.unlock()
+		}
+	}()
+
+	recoverResult, err := options.layout.recoverLocked(path, options.lock.resolve(options.readOnly))
+	if err != nil {
+		return nil, fmt.Errorf("recover: %w", err)
+	}
+	diagnostics.Recovery = recoverResult.Action
+
+	clock := tapedb.ClockOrSystem(options.clock)
+	phaseStart := clock.Now()
+
 	meta := Meta{}
-	metaPath := filepath.Join(path, FileNameMeta)
-	metaF, err := os.OpenFile(metaPath, os.O_RDONLY, 0)
+	metaPath := options.layout.MetaPath(path)
+	metaF := (*os.File)(nil)
+	err = options.retryPolicy.Do(func() (err error) {
+		metaF, err = os.OpenFile(metaPath, os.O_RDONLY, 0)
+		return
+	})
 	if err == nil {
+		defer metaF.Close()
 		m, err := ReadMeta(metaF)
 		if err != nil {
 			return nil, fmt.Errorf("read meta: %w", err)
@@ -141,75 +424,197 @@ func OpenDatabase[
 	} else if !os.IsNotExist(err) {
 		return nil, fmt.Errorf("open meta %s: %w", metaPath, err)
 	}
+	formatVersion, err := formatVersionFromMeta(meta)
+	if err != nil {
+		return nil, err
+	}
 
-	basePath := filepath.Join(path, FileNameBase)
-	baseF, _, err := mayOpenReadOnlyFile(basePath)
+	basePath := options.layout.BasePath(path)
+	baseF := (*os.File)(nil)
+	baseFileMode := fs.FileMode(0644)
+	err = options.retryPolicy.Do(func() (err error) {
+		baseF, baseFileMode, err = mayOpenReadOnlyFile(basePath)
+		return
+	})
 	if err != nil {
 		return nil, fmt.Errorf("open base %s: %w", basePath, err)
 	}
 	baseR := io.Reader(nil)
 	if baseF != nil {
+		defer baseF.Close()
 		baseR = baseF
 	}
 
-	logPath := filepath.Join(path, FileNameLog)
-	logF, err := os.OpenFile(logPath, os.O_RDWR|os.O_SYNC, 0644)
+	logPath := options.layout.LogPath(path)
+	logFlag := os.O_RDWR
+	if options.readOnly {
+		logFlag = os.O_RDONLY
+	}
+	logF := (*os.File)(nil)
+	err = options.retryPolicy.Do(func() (err error) {
+		logF, err = os.OpenFile(logPath, logFlag, 0644)
+		return
+	})
 	if err != nil && !os.IsNotExist(err) {
 		return nil, fmt.Errorf("open log %s: %w", logPath, err)
 	}
+	// the log file is handed over to the database, unless the open fails
+	defer func() {
+		if err != nil && logF != nil {
+			logF.Close()
+		}
+	}()
 	if baseF == nil && logF == nil {
 		return nil, ErrMissing
 	}
-	fileMode := fs.FileMode(0644)
-	if stat, err := logF.Stat(); err == nil {
-		fileMode = stat.Mode()
+	if logF == nil && !options.readOnly {
+		// a database that only consists of a base gets an empty log, so changes can be applied
+		err = options.retryPolicy.Do(func() (err error) {
+			logF, err = os.OpenFile(logPath, os.O_CREATE|os.O_RDWR, baseFileMode)
+			return
+		})
+		if err != nil {
+			return nil, fmt.Errorf("create log %s: %w", logPath, err)
+		}
+	}
+	fileMode := baseFileMode
+	if logF != nil {
+		if stat, err := logF.Stat(); err == nil {
+			fileMode = stat.Mode()
+		}
 	}
 	logR := tapeio.LogReader(nil)
 	logW := tapeio.LogWriter(nil)
+	logSyncW := (*syncLogWriter)(nil)
 	if logF != nil {
 		logR = tapeio.NewLogReader(logF)
-		logW = tapeio.NewLogWriter(logF)
+		if !options.readOnly {
+			logSyncW = newSyncLogWriter(logF, options.syncPolicy, options.groupCommit, options.clock)
+			logW = logSyncW
+		}
 	}
-	logCloseFn := logF.Close
+	logCloseFn := func() error { return nil }
+	if logF != nil {
+		logCloseFn = logF.Close
+	}
+
+	c, err := cipherFromMeta(meta)
+	if err != nil {
+		return nil, err
+	}
+	diagnostics.MetaRead = clock.Now().Sub(phaseStart)
 
+	phaseStart = clock.Now()
 	key, err := options.keyFunc.deriveKey(meta)
 	if err != nil {
 		return nil, fmt.Errorf("derive key: %w", err)
 	}
+	diagnostics.KeyDerivation = clock.Now().Sub(phaseStart)
+
+	codec, err := tapedb.LookupCodec(f, meta.Get(MetaFieldCodec))
+	if err != nil {
+		return nil, err
+	}
+
+	baseID := ""
+	if options.baseCache != nil && baseF != nil {
+		if baseID, err = baseFileID(basePath, baseF, key); err != nil {
+			return nil, fmt.Errorf("stat base %s: %w", basePath, err)
+		}
+	}
 
-	baseR, err = crypto.WrapBlockReader(baseR, key)
+	baseR, err = wrapBaseReader(baseR, c, key, meta.Get(MetaFieldBaseCompression))
 	if err != nil {
 		return nil, fmt.Errorf("new block reader: %w", err)
 	}
+	baseR = tapeio.NewContextReader(options.ctx, baseR)
 
-	logR, err = crypto.WrapLogReader(logR, key)
+	logR, err = wrapLogReader(logR, key, LogDictionaries(meta))
 	if err != nil {
 		return nil, fmt.Errorf("new log reader: %w", err)
 	}
 
-	logW, err = crypto.WrapLogWriter(logW, key, NonceFn)
+	if logW, err = wrapCompressLogWriter(wrapChecksumLogWriter(logW, meta, key), meta, key); err != nil {
+		return nil, fmt.Errorf("new line writer: %w", err)
+	}
+	logW, err = crypto.WrapLogWriterWithCipher(logW, c, key, NonceFn)
 	if err != nil {
 		return nil, fmt.Errorf("new line writer: %w", err)
 	}
 
-	db, err := tapeio.OpenDatabase[B, S](f, baseR, logR, logW)
+	inline := inlinePayloads{}
+	dbOpts := append(
+		databaseOptions(options.applyFunc, options.groupCommit, options.migrator, options.clock, codec),
+		tapeio.WithReplayGovernor(options.replayGovernor),
+		tapeio.WithContext(options.ctx),
+		tapeio.WithStopAtIndex(options.stopAtIndex),
+		tapeio.WithReplayClock(options.replayClock),
+		tapeio.WithInlinePayloadFunc(inline.addFunc()))
+	phaseStart = clock.Now()
+	var base B
+	if baseID != "" {
+		base, err = readCachedBase[B, S](f, options.baseCache, path, baseID, baseR, dbOpts...)
+	} else {
+		base, err = tapeio.ReadBase[B, S](f, baseR, dbOpts...)
+	}
+	diagnostics.BaseDecode = clock.Now().Sub(phaseStart)
+	if err != nil {
+		if errors.Is(err, crypto.ErrInvalidKey) {
+			return nil, ErrInvalidKey
+		}
+		return nil, err
+	}
+
+	phaseStart = clock.Now()
+	db, err := tapeio.OpenDatabaseWithBase[B, S](f, base, logR, logW, dbOpts...)
+	diagnostics.LogReplay = clock.Now().Sub(phaseStart)
 	if err != nil {
 		if errors.Is(err, crypto.ErrInvalidKey) {
 			return nil, ErrInvalidKey
 		}
 		return nil, err
 	}
+	diagnostics.LogLen = db.LogLen64()
+	diagnostics.LogSize = db.LogOffset()
 
 	return &Database[B, S]{
-		path:       path,
-		fileMode:   fileMode,
-		meta:       meta,
-		key:        key,
-		db:         db,
-		logCloseFn: logCloseFn,
+		path:           path,
+		fileMode:       fileMode,
+		meta:           meta,
+		key:            key,
+		cipher:         c,
+		readOnly:       options.readOnly,
+		maxPayloadSize: options.maxPayloadSize,
+		retryPolicy:    options.retryPolicy,
+		db:             db,
+		logCloseFn:     logCloseFn,
+		logSyncW:       logSyncW,
+		clock:          tapedb.ClockOrSystem(options.clock),
+		readChangesFn:  readChangesFunc[B, S](f, options.layout.LogPath(path), key, LogDictionaries(meta), options.migrator, codec),
+		observer:       ObserverOrNop(options.observer),
+		mirror:         options.mirror,
+		layout:         options.layout,
+		inlineSize:     int64(meta.GetUInt64(MetaFieldPayloadInlineSize, 0)),
+		inlinePayloads: inline,
+		chunkSize:      int64(meta.GetUInt64(MetaFieldPayloadChunkSize, 0)),
+		codec:          codec,
+		timestamps:     options.timestamps,
+		formatVersion:  formatVersion,
+		lock:           lock,
+		migrator:       options.migrator,
 	}, nil
 }
 
+// OpenDatabaseAt opens a read-only snapshot of the database at the provided path that contains
+// only the first logIndex changes of the log.
+func OpenDatabaseAt[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](f F, path string, logIndex int64, opts ...OpenOption) (*Database[B, S], error) {
+	return OpenDatabase[B, S](f, path, append(opts, WithStopAtIndex(logIndex))...)
+}
+
 func (db *Database[B, S]) Base() B {
 	return db.db.Base()
 }
@@ -218,257 +623,1347 @@ func (db *Database[B, S]) State() S {
 	return db.db.State()
 }
 
+// View calls fn with the state while it's read-locked. See tapeio.Database.View.
+func (db *Database[B, S]) View(fn func(S) error) error {
+	return db.db.View(fn)
+}
+
+func (db *Database[B, S]) StateHash() []byte {
+	return db.db.StateHash()
+}
+
 func (db *Database[B, S]) Close() error {
-	if err := db.logCloseFn(); err != nil {
+	// a running splice has to swap in its files first
+	db.spliceMutex.Lock()
+	defer db.spliceMutex.Unlock()
+
+	db.quiesceMutex.RLock()
+	defer db.quiesceMutex.RUnlock()
+
+	// pending copies to the payload mirror would fail once the payloads are gone
+	db.mirrorWG.Wait()
+
+	err := db.db.Close()
+	if err == nil && db.logSyncW != nil {
+		err = db.logSyncW.Close()
+	}
+	if err == nil && !db.readOnly {
+		err = db.writeLogLen()
+	}
+	// the log file is closed in any case, so a failed close doesn't leak it
+	if cErr := db.logCloseFn(); err == nil {
+		err = cErr
+	}
+	if uErr := db.lock.unlock(); err == nil {
+		err = uErr
+	}
+	return err
+}
+
+// Sync flushes buffered log entries and commits them to the storage.
+func (db *Database[B, S]) Sync() error {
+	if db.logSyncW == nil {
+		return nil
+	}
+	if err := db.db.Flush(); err != nil {
+		return err
+	}
+	return db.logSyncW.Sync()
+}
+
+// writeLogLen stores the log length and size in the meta file, if they changed, together with the
+// time of the last apply. A database without a meta file doesn't get one.
+func (db *Database[B, S]) writeLogLen() error {
+	lastModified := db.lastModified.Load()
+	return db.updateMetaFile(false, func(meta Meta, logLen, logSize uint64) bool {
+		if meta.Has(MetaFieldLogLen) &&
+			meta.GetUInt64(MetaFieldLogLen, 0) == logLen &&
+			meta.GetUInt64(MetaFieldLogSize, 0) == logSize &&
+			lastModified == 0 {
+			return false
+		}
+		meta.SetUInt64(MetaFieldLogLen, logLen)
+		meta.SetUInt64(MetaFieldLogSize, logSize)
+		if lastModified != 0 {
+			meta.SetTime(MetaFieldLastModified, time.Unix(0, lastModified))
+		}
+		return true
+	})
+}
+
+// updateMetaFile reads the meta file, passes it to fn together with the current log length and
+// size and writes it back if fn returns true. Since the meta is read from the file, changes made
+// by other writers since the database was opened are kept. If the meta file is missing, it's only
+// created if create is true.
+func (db *Database[B, S]) updateMetaFile(create bool, fn func(Meta, uint64, uint64) bool) error {
+	stat, err := os.Stat(db.layout.LogPath(db.path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	metaPath := db.layout.MetaPath(db.path)
+	meta, err := ReadMetaFile(metaPath)
+	if os.IsNotExist(err) {
+		if !create {
+			return nil
+		}
+		meta = db.meta.Clone()
+	} else if err != nil {
+		return err
+	}
+
+	if !fn(meta, uint64(db.LogLen64()), uint64(stat.Size())) {
+		return nil
+	}
+
+	if err := WriteMetaFile(metaPath, meta); err != nil {
 		return err
 	}
+	// the meta is replaced, since the current one might be read concurrently
+	db.meta = meta
+
 	return nil
 }
 
+// Meta returns the meta of the database. The Last-Modified field is the time of the last apply,
+// even though it's only written to the meta file on close.
 func (db *Database[B, S]) Meta() Meta {
-	return db.meta
+	lastModified := db.lastModified.Load()
+	if lastModified == 0 {
+		return db.meta
+	}
+	meta := db.meta.Clone()
+	meta.SetTime(MetaFieldLastModified, time.Unix(0, lastModified))
+	return meta
 }
 
 func (db *Database[B, S]) SetMeta(meta Meta) error {
-	if err := WriteMetaFile(filepath.Join(db.path, FileNameMeta), meta); err != nil {
+	if db.readOnly {
+		return ErrReadOnly
+	}
+
+	// a running splice would overwrite the meta file with its own copy
+	db.spliceMutex.Lock()
+	defer db.spliceMutex.Unlock()
+
+	db.quiesceMutex.RLock()
+	defer db.quiesceMutex.RUnlock()
+	err := db.retryPolicy.Do(func() error {
+		return WriteMetaFile(db.layout.MetaPath(db.path), meta)
+	})
+	if err != nil {
 		return err
 	}
 	db.meta = meta
 	return nil
 }
 
+// ID returns the unique ID of the database that is generated on creation. Databases that have been
+// created before the ID was introduced return an empty string.
+func (db *Database[B, S]) ID() string {
+	return db.meta.Get(MetaFieldDatabaseID)
+}
+
+// FormatVersion returns the version of the file format of the database.
+func (db *Database[B, S]) FormatVersion() int {
+	return db.formatVersion
+}
+
 func (db *Database[B, S]) Key() []byte {
 	return db.key
 }
 
+// Codec returns the codec of the base and the changes or nil if they encode themselves.
+func (db *Database[B, S]) Codec() tapedb.Codec {
+	return db.codec
+}
+
 func (db *Database[B, S]) LogLen() int {
 	return db.db.LogLen()
 }
 
-func (db *Database[B, S]) Apply(change tapedb.Change, payloads ...Payload) error {
-	for _, payload := range payloads {
-		f, err := os.OpenFile(db.payloadPath(payload.id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, db.fileMode)
-		if err != nil {
-			if os.IsExist(err) {
-				return fmt.Errorf("create payload with id %s: %w", payload.id, ErrPayloadIDAlreadyExists)
-			}
-			return err
-		}
+func (db *Database[B, S]) LogLen64() int64 {
+	return db.db.LogLen64()
+}
 
-		if len(db.key) == 0 {
-			if _, err := io.Copy(f, payload.r); err != nil {
-				return err
-			}
-		} else {
-			wc, err := crypto.NewBlockWriter(f, db.key, NonceFn)
-			if err != nil {
-				return fmt.Errorf("new block writer: %w", err)
-			}
+// LogOffset returns the size of the log file in bytes.
+func (db *Database[B, S]) LogOffset() int64 {
+	return db.db.LogOffset()
+}
 
-			if _, err := io.Copy(wc, payload.r); err != nil {
-				return err
-			}
+func (db *Database[B, S]) ReadOnly() bool {
+	return db.readOnly
+}
 
-			if err := wc.Close(); err != nil {
-				return err
-			}
-		}
+func (db *Database[B, S]) Apply(change tapedb.Change, payloads ...Payload) error {
+	return db.ApplyContext(context.Background(), change, payloads...)
+}
 
-		if err := f.Close(); err != nil {
-			return err
-		}
+// ApplyContext applies the change like Apply. The copying of the payloads is canceled as soon as
+// the provided context is done and the change isn't applied then.
+func (db *Database[B, S]) ApplyContext(ctx context.Context, change tapedb.Change, payloads ...Payload) error {
+	start := db.clock.Now()
+	err := ctx.Err()
+	if err == nil {
+		err = db.apply(change, withPayloadsContext(ctx, payloads))
 	}
-
-	return db.db.Apply(change)
+	err = tapedb.WrapError("apply", db.path, err)
+	db.observer.OnApply(ApplyEvent{
+		Path:       db.path,
+		ChangeType: change.TypeName(),
+		Duration:   db.clock.Now().Sub(start),
+		Err:        err,
+	})
+	return err
 }
 
-func (db *Database[B, S]) OpenPayload(id string) (io.ReadCloser, error) {
-	path := db.payloadPath(id)
+func (db *Database[B, S]) apply(change tapedb.Change, payloads []Payload) error {
+	if db.readOnly {
+		return ErrReadOnly
+	}
+
+	db.quiesceMutex.RLock()
+	defer db.quiesceMutex.RUnlock()
+
+	if err := db.validatePayloadReferences(change, payloads); err != nil {
+		return err
+	}
 
-	f, err := os.Open(path)
+	inline, payloads, err := db.splitInlinePayloads(payloads)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, ErrPayloadMissing
+		return err
+	}
+
+	written := make([]string, 0, len(payloads))
+	for _, payload := range payloads {
+		if err := db.writePayload(payload); err != nil {
+			db.removePayloads(written)
+			return err
 		}
-		return nil, err
+		written = append(written, payload.id)
 	}
 
-	if len(db.key) == 0 {
-		return f, nil
+	if err := db.db.ApplyInline(change, inline...); err != nil {
+		// the change has been rejected, so the payloads written for it would remain unreferenced.
+		db.removePayloads(written)
+		return err
 	}
 
-	r, err := crypto.NewBlockReader(f, db.key)
-	if err != nil {
-		return nil, err
+	db.inlineMutex.Lock()
+	db.inlinePayloads.add(inline)
+	db.inlineMutex.Unlock()
+
+	if db.timestamps {
+		db.lastModified.Store(db.clock.Now().UnixNano())
 	}
 
-	return tapeio.NewReadCloser(r, f.Close), nil
+	return nil
 }
 
-func (db *Database[B, S]) StatPayload(id string) (fs.FileInfo, error) {
-	path := db.payloadPath(id)
+func (db *Database[B, S]) removePayloads(ids []string) {
+	for _, id := range ids {
+		db.layout.removePayload(db.path, id)
+		db.unmirrorPayload(id)
+	}
+}
 
-	stat, err := os.Stat(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, ErrPayloadMissing
+// validatePayloadReferences ensures that each payload referenced by the change either exists or is
+// supplied together with it.
+func (db *Database[B, S]) validatePayloadReferences(change tapedb.Change, payloads []Payload) error {
+	c, ok := change.(PayloadContainer)
+	if !ok {
+		return nil
+	}
+
+	for _, id := range c.PayloadIDs() {
+		if payloadsContain(payloads, id) {
+			continue
+		}
+		if _, ok := db.inlinePayload(id); ok {
+			continue
+		}
+		exists, err := db.layout.payloadExists(db.path, id)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("reference payload with id %s: %w", id, ErrPayloadMissing)
 		}
-		return nil, err
 	}
 
-	return stat, nil
+	return nil
 }
 
-func (db *Database[B, S]) payloadPath(id string) string {
-	return filepath.Join(db.path, FilePrefixPayload+id)
+func (db *Database[B, S]) WritePayload(payload Payload) error {
+	return db.WritePayloadContext(context.Background(), payload)
 }
 
-func SpliceDatabase[
-	B tapedb.Base,
-	S tapedb.State,
-	F tapedb.Factory[B, S],
-](f F, path string, opts ...SpliceOption) error {
-	options := defaultSpliceOptions
-	for _, opt := range opts {
-		opt(&options)
+// WritePayloadContext writes the payload like WritePayload, but cancels the copying as soon as the
+// provided context is done.
+func (db *Database[B, S]) WritePayloadContext(ctx context.Context, payload Payload) error {
+	if db.readOnly {
+		return tapedb.WrapError("write payload", db.path, ErrReadOnly)
 	}
-
-	meta := Meta{}
-	// metaFileMode := fs.FileMode(0644)
-	metaPath := filepath.Join(path, FileNameMeta)
-	if f, err := os.OpenFile(metaPath, os.O_RDONLY, 0); err == nil {
-		// if stat, err := f.Stat(); err == nil {
-		// 	metaFileMode = stat.Mode()
-		// }
-		m, err := ReadMeta(f)
-		if err != nil {
-			return fmt.Errorf("read meta: %w", err)
-		}
-		meta = m
-	} else if err != nil && !os.IsNotExist(err) {
+	if err := ctx.Err(); err != nil {
 		return err
 	}
+	payload.r = tapeio.NewContextReader(ctx, payload.r)
 
-	basePath := filepath.Join(path, FileNameBase)
-	baseF, baseFileMode, err := mayOpenReadOnlyFile(basePath)
+	db.quiesceMutex.RLock()
+	defer db.quiesceMutex.RUnlock()
+	return db.writePayload(payload)
+}
+
+// writePayload stages the payload and its info and commits them afterwards, so readers either see
+// the complete payload or none at all.
+func (db *Database[B, S]) writePayload(payload Payload) error {
+	if !db.acquirePayloadWrite(payload.id) {
+		return fmt.Errorf("write payload with id %s: %w", payload.id, ErrPayloadUploadInProgress)
+	}
+	defer db.releasePayloadWrite(payload.id)
+
+	write := db.writePayloadFile
+	if db.chunkSize > 0 {
+		write = db.writePayloadChunks
+	}
+
+	staged, err := write(payload)
 	if err != nil {
 		return err
 	}
-	baseR := io.Reader(nil)
+
+	if db.hasPayloadInfo() || payload.hasMeta {
+		info := PayloadInfo{PayloadMeta: payload.meta, ID: payload.id, Size: staged.written}
+		info.SHA256 = staged.hash.Sum(nil)
+		if info.CreatedAt.IsZero() {
+			info.CreatedAt = db.clock.Now()
+		}
+		if err := db.writePayloadInfo(info); err != nil {
+			staged.discardFn()
+			return fmt.Errorf("write payload info with id %s: %w", payload.id, err)
+		}
+	}
+
+	if err := staged.commitFn(); err != nil {
+		staged.discardFn()
+		db.layout.removePayloadInfo(db.path, payload.id)
+		return fmt.Errorf("commit payload with id %s: %w", payload.id, err)
+	}
+
+	if err := db.mirrorPayload(payload.id); err != nil {
+		db.layout.removePayload(db.path, payload.id)
+		db.layout.removePayloadInfo(db.path, payload.id)
+		return err
+	}
+
+	return nil
+}
+
+// writePayloadFile writes the payload into a partial file that is renamed by the commit function.
+func (db *Database[B, S]) writePayloadFile(payload Payload) (stagedPayload, error) {
+	exists, err := db.layout.payloadExists(db.path, payload.id)
+	if err != nil {
+		return stagedPayload{}, err
+	}
+	if exists {
+		return stagedPayload{}, fmt.Errorf("create payload with id %s: %w", payload.id, ErrPayloadIDAlreadyExists)
+	}
+
+	path := db.payloadPath(payload.id)
+	partialPath := path + db.layout.PartialSuffix
+
+	// a partial file is left by an interrupted write and is overwritten
+	f, err := os.OpenFile(partialPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, db.fileMode)
+	if err != nil {
+		return stagedPayload{}, err
+	}
+
+	pw, err := db.copyPayload(f, payload)
+	if err != nil {
+		f.Close()
+		os.Remove(partialPath)
+		return stagedPayload{}, fmt.Errorf("write payload with id %s: %w", payload.id, err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(partialPath)
+		return stagedPayload{}, err
+	}
+
+	return stagedPayload{
+		payloadWriter: pw,
+		commitFn: func() error {
+			return os.Rename(partialPath, path)
+		},
+		discardFn: func() {
+			os.Remove(partialPath)
+		},
+	}, nil
+}
+
+func (db *Database[B, S]) acquirePayloadWrite(id string) bool {
+	db.payloadWritesMutex.Lock()
+	defer db.payloadWritesMutex.Unlock()
+	if _, ok := db.payloadWrites[id]; ok {
+		return false
+	}
+	if db.payloadWrites == nil {
+		db.payloadWrites = map[string]struct{}{}
+	}
+	db.payloadWrites[id] = struct{}{}
+	return true
+}
+
+func (db *Database[B, S]) releasePayloadWrite(id string) {
+	db.payloadWritesMutex.Lock()
+	defer db.payloadWritesMutex.Unlock()
+	delete(db.payloadWrites, id)
+}
+
+func (db *Database[B, S]) copyPayload(w io.Writer, payload Payload) (*payloadWriter, error) {
+	wc := io.WriteCloser(nil)
+	if len(db.key) > 0 {
+		bw, err := crypto.NewBlockWriterWithCipher(w, db.cipher, db.key, NonceFn)
+		if err != nil {
+			return nil, fmt.Errorf("new block writer: %w", err)
+		}
+		w, wc = bw, bw
+	}
+
+	pw := newPayloadWriter(w, payload, db.maxPayloadSize)
+	if _, err := io.Copy(pw, payload.r); err != nil {
+		return nil, err
+	}
+
+	if wc != nil {
+		if err := wc.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	return pw, pw.verify()
+}
+
+func (db *Database[B, S]) hasPayloadInfo() bool {
+	return db.meta.Get(MetaFieldPayloadInfo) == PayloadInfoSidecar
+}
+
+// writePayloadInfo stores the info in a sidecar file. Like the payload, it's encrypted if the
+// database has a key.
+func (db *Database[B, S]) writePayloadInfo(info PayloadInfo) error {
+	buffer := bytes.Buffer{}
+	if _, err := info.meta().WriteTo(&buffer); err != nil {
+		return err
+	}
+
+	path := db.payloadInfoPath(info.ID)
+	partialPath := path + db.layout.PartialSuffix
+	f, err := os.OpenFile(partialPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, db.fileMode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.copyPayload(f, NewPayload(info.ID, &buffer)); err != nil {
+		f.Close()
+		os.Remove(partialPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(partialPath)
+		return err
+	}
+
+	return os.Rename(partialPath, path)
+}
+
+// OpenPayload opens the payload with the provided id. A payload that is still being written isn't
+// visible until it's complete, so it's reported as missing until then.
+func (db *Database[B, S]) OpenPayload(id string) (io.ReadSeekCloser, error) {
+	if data, ok := db.inlinePayload(id); ok {
+		return nopReadSeekCloser{ReadSeeker: bytes.NewReader(data)}, nil
+	}
+
+	manifest, chunked, err := db.payloadManifest(id)
+	if err != nil {
+		return nil, err
+	}
+	if chunked {
+		return &chunkedPayloadReader{manifest: manifest, openFn: func(index int) (io.ReadSeekCloser, error) {
+			return db.openPayloadFile(db.layout.PayloadChunkPath(db.path, id, index))
+		}}, nil
+	}
+
+	path := db.payloadPath(id)
+	r, err := db.openPayloadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, tapedb.WrapError("open payload", path, ErrPayloadMissing)
+		}
+		return nil, err
+	}
+	return r, nil
+}
+
+func (db *Database[B, S]) StatPayload(id string) (fs.FileInfo, error) {
+	if data, ok := db.inlinePayload(id); ok {
+		return inlineFileInfo{name: db.layout.PayloadPrefix + id, size: int64(len(data))}, nil
+	}
+
+	path := db.payloadPath(id)
+	manifest, chunked, err := db.payloadManifest(id)
+	if err != nil {
+		return nil, err
+	}
+	if chunked {
+		path = db.layout.PayloadManifestPath(db.path, id)
+	}
+
+	stat := fs.FileInfo(nil)
+	err = db.retryPolicy.Do(func() (err error) {
+		stat, err = os.Stat(path)
+		return
+	})
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, tapedb.WrapError("stat payload", path, ErrPayloadMissing)
+		}
+		return nil, err
+	}
+
+	if chunked {
+		return payloadFileInfo{FileInfo: stat, name: db.layout.PayloadPrefix + id, size: manifest.Size}, nil
+	}
+	if !db.hasPayloadInfo() {
+		return stat, nil
+	}
+
+	info, err := db.readPayloadInfo(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return payloadFileInfo{FileInfo: stat, size: info.Size}, nil
+}
+
+// PayloadInfo returns the plaintext size and the meta of the payload with the provided id.
+// Databases that have been created without WithPayloadInfo only report the size on disk and the
+// meta of payloads that have been written with one.
+func (db *Database[B, S]) PayloadInfo(id string) (PayloadInfo, error) {
+	if data, ok := db.inlinePayload(id); ok {
+		return inlinePayloadInfo(id, data), nil
+	}
+	if db.hasPayloadInfo() {
+		return db.readPayloadInfo(id)
+	}
+
+	stat, err := db.StatPayload(id)
+	if err != nil {
+		return PayloadInfo{}, err
+	}
+
+	info, err := db.readPayloadInfo(id)
+	if err != nil && !errors.Is(err, ErrPayloadMissing) {
+		return PayloadInfo{}, err
+	}
+	return PayloadInfo{PayloadMeta: info.PayloadMeta, ID: id, Size: stat.Size()}, nil
+}
+
+// PayloadMeta returns the meta of the payload with the provided id.
+func (db *Database[B, S]) PayloadMeta(id string) (PayloadMeta, error) {
+	info, err := db.PayloadInfo(id)
+	if err != nil {
+		return PayloadMeta{}, err
+	}
+	return info.PayloadMeta, nil
+}
+
+func (db *Database[B, S]) readPayloadInfo(id string) (PayloadInfo, error) {
+	f := (*os.File)(nil)
+	err := db.retryPolicy.Do(func() (err error) {
+		f, err = os.Open(db.payloadInfoPath(id))
+		return
+	})
+	if err != nil {
+		if os.IsNotExist(err) {
+			return PayloadInfo{}, ErrPayloadMissing
+		}
+		return PayloadInfo{}, err
+	}
+	defer f.Close()
+
+	r := io.Reader(f)
+	if len(db.key) > 0 {
+		if r, err = crypto.NewBlockReaderWithCipher(f, db.cipher, db.key); err != nil {
+			return PayloadInfo{}, err
+		}
+	}
+
+	meta, err := ReadMeta(r)
+	if err != nil {
+		return PayloadInfo{}, fmt.Errorf("read payload info with id %s: %w", id, err)
+	}
+
+	return payloadInfoFromMeta(id, meta), nil
+}
+
+func (db *Database[B, S]) ReadChanges(fn func(int, tapedb.Change) error) error {
+	return db.readChangesFn(fn)
+}
+
+func (db *Database[B, S]) DeletePayload(id string) error {
+	if db.readOnly {
+		return tapedb.WrapError("delete payload", db.path, ErrReadOnly)
+	}
+
+	if _, ok := db.inlinePayload(id); ok {
+		return tapedb.WrapError("delete payload", db.path, ErrPayloadInline)
+	}
+
+	db.quiesceMutex.RLock()
+	defer db.quiesceMutex.RUnlock()
+
+	if err := db.layout.removePayload(db.path, id); err != nil {
+		if os.IsNotExist(err) {
+			return tapedb.WrapError("delete payload", db.payloadPath(id), ErrPayloadMissing)
+		}
+		return err
+	}
+
+	return db.unmirrorPayload(id)
+}
+
+func (db *Database[B, S]) UnreferencedPayloads() ([]string, error) {
+	references := tapedb.PayloadReferences{}
+	references.Track(db.Base())
+
+	err := db.ReadChanges(func(_ int, change tapedb.Change) error {
+		references.Track(change)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read changes: %w", err)
+	}
+
+	ids, err := db.layout.readPayloadIDs(db.path)
+	if err != nil {
+		return nil, err
+	}
+
+	unreferencedIDs := []string{}
+	for _, id := range ids {
+		if !references.Has(id) {
+			unreferencedIDs = append(unreferencedIDs, id)
+		}
+	}
+
+	return unreferencedIDs, nil
+}
+
+// PayloadIDs returns the sorted ids of all payloads of the database, including the ones that are
+// stored inline in the log.
+func (db *Database[B, S]) PayloadIDs() ([]string, error) {
+	ids, err := db.layout.readPayloadIDs(db.path)
+	if err != nil {
+		return nil, err
+	}
+
+	db.inlineMutex.RLock()
+	for id := range db.inlinePayloads {
+		ids = append(ids, id)
+	}
+	db.inlineMutex.RUnlock()
+
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (db *Database[B, S]) payloadPath(id string) string {
+	return db.layout.PayloadPath(db.path, id)
+}
+
+func (db *Database[B, S]) payloadInfoPath(id string) string {
+	return db.layout.PayloadInfoPath(db.path, id)
+}
+
+func (l Layout) removePayloadInfo(path, id string) error {
+	if err := os.Remove(l.PayloadInfoPath(path, id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// wrapChecksumLogWriter adds checksums to the entries of unencrypted logs if requested by the meta.
+// Encrypted entries are already authenticated.
+func wrapChecksumLogWriter(w tapeio.LogWriter, meta Meta, key []byte) tapeio.LogWriter {
+	if w == nil || len(key) > 0 || meta.Get(MetaFieldLogChecksum) != LogChecksumCRC32C {
+		return w
+	}
+	return tapeio.NewChecksumLogWriter(w)
+}
+
+// formatVersionFromMeta returns the format version of the database, or ErrUnsupportedFormatVersion
+// if it has been written by a newer version of this package.
+func formatVersionFromMeta(meta Meta) (int, error) {
+	value := meta.Get(MetaFieldFormatVersion)
+	if value == "" {
+		return 1, nil
+	}
+	version, err := strconv.Atoi(value)
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("format version %q: %w", value, ErrUnsupportedFormatVersion)
+	}
+	if version > FormatVersion {
+		return 0, fmt.Errorf("format version %d is newer than %d: %w", version, FormatVersion, ErrUnsupportedFormatVersion)
+	}
+	return version, nil
+}
+
+func cipherFromMeta(meta Meta) (crypto.Cipher, error) {
+	c, err := crypto.ParseCipher(meta.Get(MetaHeaderCipher))
+	if err != nil {
+		return "", fmt.Errorf("parse cipher: %w", err)
+	}
+	return c, nil
+}
+
+func readChangesFunc[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](f F, logPath string, key []byte, dictionaries [][]byte, m tapedb.ChangeMigrator, codec tapedb.Codec) func(func(int, tapedb.Change) error) error {
+	return func(fn func(int, tapedb.Change) error) error {
+		logF, _, err := mayOpenReadOnlyFile(logPath)
+		if err != nil {
+			return err
+		}
+		if logF == nil {
+			return nil
+		}
+		defer logF.Close()
+
+		logR, err := wrapLogReader(tapeio.NewLogReader(logF), key, dictionaries)
+		if err != nil {
+			return fmt.Errorf("new log reader: %w", err)
+		}
+
+		return tapeio.ReadChanges[B, S](f, logR, fn, tapeio.WithMigrator(m), tapeio.WithCodec(codec))
+	}
+}
+
+// ReadChanges decodes the changes in the log of the database at the provided path and passes them
+// to fn without building a state. The key and migrations are taken from the provided options.
+func ReadChanges[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](f F, path string, opts []OpenOption, fn func(int, tapedb.Change) error) error {
+	options := defaultOpenOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	meta, err := options.layout.readDatabaseMeta(path)
+	if err != nil {
+		return err
+	}
+
+	key, err := options.keyFunc.deriveKey(meta)
+	if err != nil {
+		return fmt.Errorf("derive key: %w", err)
+	}
+
+	codec, err := tapedb.LookupCodec(f, meta.Get(MetaFieldCodec))
+	if err != nil {
+		return tapedb.WrapError("read changes", path, err)
+	}
+
+	err = readChangesFunc[B, S](f, options.layout.LogPath(path), key, LogDictionaries(meta), options.migrator, codec)(fn)
+	if errors.Is(err, crypto.ErrInvalidKey) {
+		err = ErrInvalidKey
+	}
+	return tapedb.WrapError("read changes", path, err)
+}
+
+type SpliceResult struct {
+	EntriesRead     int
+	EntriesRebased  int
+	EntriesCopied   int
+	PayloadsKept    int
+	PayloadsDeleted int
+	BaseSize        int64
+	LogSize         int64
+	Duration        time.Duration
+}
+
+// SpliceProgress is reported after each entry of the log that has been rebased or copied during a
+// splice. The written bytes include the base and the log, but not the data that is still buffered.
+type SpliceProgress struct {
+	EntriesRead    int
+	EntriesRebased int
+	EntriesCopied  int
+	BytesRead      int64
+	BytesWritten   int64
+}
+
+func SpliceDatabase[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](f F, path string, opts ...SpliceOption) (SpliceResult, error) {
+	options := defaultSpliceOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	clock := tapedb.ClockOrSystem(options.clock)
+	start := clock.Now()
+	result, err := spliceDatabase[B, S](f, path, options, clock, start, nil)
+	err = tapedb.WrapError("splice", path, err)
+	ObserverOrNop(options.observer).OnSplice(SpliceEvent{
+		Path:     path,
+		Result:   result,
+		Duration: clock.Now().Sub(start),
+		Err:      err,
+	})
+	return result, err
+}
+
+// SpliceDatabaseContext splices the database like SpliceDatabase, but aborts as soon as the
+// provided context is done. The original base and log are kept in that case.
+func SpliceDatabaseContext[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](ctx context.Context, f F, path string, opts ...SpliceOption) (SpliceResult, error) {
+	return SpliceDatabase[B, S](f, path, append(opts, withSpliceContext(ctx))...)
+}
+
+func spliceDatabase[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](f F, path string, options spliceOptions, clock tapedb.Clock, start time.Time, live *liveSplice[B]) (SpliceResult, error) {
+
+	layout := options.layout
+	if err := layout.Validate(); err != nil {
+		return SpliceResult{}, err
+	}
+
+	// an open database holds the lock already
+	if live == nil {
+		// a dry run only reads, so it's not locked by default like a read-only open
+		lockMode := options.lock.resolve(options.dryRun)
+		lock, err := layout.lock(path, lockMode, 0644)
+		if err != nil {
+			return SpliceResult{}, err
+		}
+		defer lock.unlock()
+
+		if _, err := layout.recoverLocked(path, lockMode); err != nil {
+			return SpliceResult{}, fmt.Errorf("recover: %w", err)
+		}
+	}
+
+	// splicing a directory without a database creates an empty one
+	meta, err := layout.readMetaFileOrEmpty(path)
+	if err != nil {
+		return SpliceResult{}, err
+	}
+	if _, err := formatVersionFromMeta(meta); err != nil {
+		return SpliceResult{}, err
+	}
+
+	basePath := layout.BasePath(path)
+	baseF, baseFileMode, err := mayOpenReadOnlyFile(basePath)
+	if err != nil {
+		return SpliceResult{}, err
+	}
+	baseR := io.Reader(nil)
 	if baseF != nil {
 		baseR = baseF
 	}
 
-	logPath := filepath.Join(path, FileNameLog)
+	logPath := layout.LogPath(path)
 	logF, logFileMode, err := mayOpenReadOnlyFile(logPath)
 	if err != nil {
-		return err
+		return SpliceResult{}, err
 	}
 	logR := tapeio.LogReader(nil)
 	if logF != nil {
-		logR = tapeio.NewLogReader(logF)
+		if live != nil {
+			// the entries that are appended meanwhile are copied by the catch-up
+			logR = tapeio.NewLogReader(io.NewSectionReader(logF, 0, live.logSize))
+		} else {
+			logR = tapeio.NewLogReader(logF)
+		}
 	}
 
-	sourceKey, err := options.sourceKeyFunc.deriveKey(meta)
+	c, err := cipherFromMeta(meta)
 	if err != nil {
-		return fmt.Errorf("derive source key: %w", err)
+		return SpliceResult{}, err
 	}
 
-	baseR, err = crypto.WrapBlockReader(baseR, sourceKey)
+	sourceKey, err := options.sourceKeyFunc.deriveKey(meta)
 	if err != nil {
-		return fmt.Errorf("new block reader: %w", err)
+		return SpliceResult{}, fmt.Errorf("derive source key: %w", err)
 	}
 
-	logR, err = crypto.WrapLogReader(logR, sourceKey)
+	codec, err := tapedb.LookupCodec(f, meta.Get(MetaFieldCodec))
 	if err != nil {
-		return fmt.Errorf("new log reader: %w", err)
+		return SpliceResult{}, err
 	}
 
-	newBasePath := filepath.Join(path, FileNameNewBase)
-	newBaseF, err := createNewWriteOnlyFile(newBasePath, baseFileMode)
+	baseR, err = wrapBaseReader(baseR, c, sourceKey, meta.Get(MetaFieldBaseCompression))
 	if err != nil {
-		return fmt.Errorf("create base %s: %w", newBasePath, ErrExisting)
+		return SpliceResult{}, fmt.Errorf("new block reader: %w", err)
 	}
-	newBaseWC := io.WriteCloser(newBaseF)
+	baseR = tapeio.NewContextReader(options.ctx, baseR)
 
-	newLogPath := filepath.Join(path, FileNameNewLog)
-	newLogF, err := createNewWriteOnlyFile(newLogPath, logFileMode)
+	sourceMeta := meta.Clone()
+	sourceDictionaries := LogDictionaries(meta)
+	sourceLogR := logR
+	logR, err = wrapLogReader(logR, sourceKey, sourceDictionaries)
 	if err != nil {
-		return fmt.Errorf("create log %s: %w", newLogPath, ErrExisting)
+		return SpliceResult{}, fmt.Errorf("new log reader: %w", err)
+	}
+
+	if baseF != nil {
+		defer baseF.Close()
+	}
+	if logF != nil {
+		defer logF.Close()
 	}
-	newLogW := tapeio.LogWriter(tapeio.NewLogWriter(newLogF))
+
+	// a dry run only measures the new base and log
+	newBasePath := filepath.Join(path, layout.NewBase)
+	newLogPath := filepath.Join(path, layout.NewLog)
+	newBaseF, newLogF := io.WriteCloser(discardWriteCloser{}), io.WriteCloser(discardWriteCloser{})
+	if !options.dryRun {
+		if newBaseF, err = createFile(newBasePath, baseFileMode); err != nil {
+			return SpliceResult{}, fmt.Errorf("create base %s: %w", newBasePath, ErrExisting)
+		}
+		if newLogF, err = createFile(newLogPath, logFileMode); err != nil {
+			newBaseF.Close()
+			os.Remove(newBasePath)
+			return SpliceResult{}, fmt.Errorf("create log %s: %w", newLogPath, ErrExisting)
+		}
+	}
+	newBaseChecksumWC := newChecksumWriteCloser(newBaseF)
+	newBaseWC := io.WriteCloser(newBaseChecksumWC)
+
+	newLogChecksumWC := newChecksumWriteCloser(newLogF)
+	newLogW := tapeio.LogWriter(tapeio.NewLogWriter(newLogChecksumWC))
+
+	newMetaPath := filepath.Join(path, layout.NewMeta)
+	swapped := false
+	reencryptedPaths := []string{}
+	defer func() {
+		if swapped || options.dryRun {
+			return
+		}
+		// the original base and log are untouched at this point, so only the new files have to go
+		newBaseF.Close()
+		newLogF.Close()
+		os.Remove(newBasePath)
+		os.Remove(newLogPath)
+		os.Remove(newMetaPath)
+		for _, reencryptedPath := range reencryptedPaths {
+			os.Remove(reencryptedPath)
+		}
+	}()
 
 	targetKey, err := options.targetKeyFunc.deriveKey(meta)
 	if err != nil {
-		return fmt.Errorf("derive target key: %w", err)
+		return SpliceResult{}, fmt.Errorf("derive target key: %w", err)
+	}
+
+	// the payload files are encrypted with the source key, so they have to follow a key change. They
+	// are listed before the splice writes the inline payloads of rebased changes with the target key.
+	reencryptNames := []string{}
+	if !bytes.Equal(sourceKey, targetKey) {
+		if reencryptNames, err = layout.readPayloadFileNames(path); err != nil {
+			return SpliceResult{}, err
+		}
+	}
+
+	if options.setBaseCompression {
+		setBaseCompression(meta, options.baseCompression)
+	}
+	newBaseWC, err = wrapBaseWriter(newBaseWC, c, targetKey, meta.Get(MetaFieldBaseCompression))
+	if err != nil {
+		return SpliceResult{}, fmt.Errorf("new block writer: %w", err)
+	}
+
+	if options.trainLogDictionary {
+		samples, err := readLogSamples(logPath, sourceKey, sourceDictionaries, options.logDictionarySize)
+		if err != nil {
+			return SpliceResult{}, fmt.Errorf("read samples: %w", err)
+		}
+		setLogCompression(meta, compress.Train(samples, options.logDictionarySize))
+	} else if options.logCompression {
+		setLogCompression(meta, options.logDictionary)
+	}
+	if !bytes.Equal(sourceMeta.GetBytes(MetaFieldLogDictionary, nil), meta.GetBytes(MetaFieldLogDictionary, nil)) {
+		// entries of the source log stay readable until the new log is swapped in
+		meta.SetBytes(MetaFieldLogDictionaryPrevious, sourceMeta.GetBytes(MetaFieldLogDictionary, nil))
 	}
 
-	newBaseWC, err = crypto.WrapBlockWriter(newBaseWC, targetKey, NonceFn)
+	if newLogW, err = wrapCompressLogWriter(wrapChecksumLogWriter(newLogW, meta, targetKey), meta, targetKey); err != nil {
+		return SpliceResult{}, fmt.Errorf("new log writer: %w", err)
+	}
+	newLogW, err = crypto.WrapLogWriterWithCipher(newLogW, c, targetKey, NonceFn)
 	if err != nil {
-		return fmt.Errorf("new block writer: %w", err)
+		return SpliceResult{}, fmt.Errorf("new log writer: %w", err)
 	}
 
-	newLogW, err = crypto.WrapLogWriter(newLogW, targetKey, NonceFn)
+	// the payloads referenced by the new base are expected to be the ones of the source base with
+	// the rebased changes replayed on top
+	expectedReferences, err := readBaseReferences[B, S](f, basePath, c, sourceKey, sourceMeta.Get(MetaFieldBaseCompression), codec)
 	if err != nil {
-		return fmt.Errorf("new log writer: %w", err)
+		return SpliceResult{}, fmt.Errorf("read source base references: %w", err)
+	}
+	rebaseChangeSelectFn := func(change tapedb.Change, logIndex int) (bool, error) {
+		rebase, err := options.rebaseChangeSelectFunc(change, logIndex)
+		if rebase {
+			expectedReferences.Track(change)
+		}
+		return rebase, err
 	}
 
-	payloadIDs := []string{}
+	references := tapedb.PayloadReferences{}
+	newBase := *new(B)
 	baseOrChangeWrittenFn := func(boc any) error {
-		if c, ok := boc.(PayloadContainer); ok {
-			payloadIDs = append(payloadIDs, c.PayloadIDs()...)
+		references.Track(boc)
+		if base, ok := boc.(B); ok {
+			newBase = base
+		}
+		return nil
+	}
+
+	// the inline payloads of rebased changes would be gone with their log entries
+	inlinePayloadFn := func(_ int, payloads []tapeio.InlinePayload) error {
+		if options.dryRun {
+			return nil
+		}
+		for _, payload := range payloads {
+			if err := writeInlinePayloadFile(layout.PayloadPath(path, payload.ID), payload, logFileMode, c, targetKey); err != nil {
+				return fmt.Errorf("write inline payload with id %s: %w", payload.ID, err)
+			}
 		}
 		return nil
 	}
 
-	err = tapeio.SpliceDatabase[B, S](
+	progressFn := func(r tapeio.SpliceResult) {
+		if options.progressFunc == nil {
+			return
+		}
+		bytesRead, _ := tapeio.LogOffset(sourceLogR)
+		options.progressFunc(SpliceProgress{
+			EntriesRead:    r.EntriesRead,
+			EntriesRebased: r.EntriesRebased,
+			EntriesCopied:  r.EntriesCopied,
+			BytesRead:      bytesRead,
+			BytesWritten:   newBaseChecksumWC.Size() + newLogChecksumWC.Size(),
+		})
+	}
+
+	spliceResult, err := tapeio.SpliceDatabase[B, S](
 		f,
 		newBaseWC, newLogW,
 		baseR, logR,
-		options.rebaseChangeSelectFunc, baseOrChangeWrittenFn)
+		rebaseChangeSelectFn, baseOrChangeWrittenFn,
+		tapeio.WithMigrator(options.migrator),
+		tapeio.WithContext(options.ctx),
+		tapeio.WithInlinePayloadFunc(inlinePayloadFn),
+		tapeio.WithSpliceProgressFunc(progressFn),
+		tapeio.WithCodec(codec))
 	if err != nil {
-		return err
+		return SpliceResult{}, err
 	}
 
-	if baseF != nil {
-		if err := baseF.Close(); err != nil {
-			return err
+	if live != nil {
+		copied, size, err := live.catchUp(newLogW, references, sourceKey, sourceDictionaries)
+		if err != nil {
+			return SpliceResult{}, fmt.Errorf("catch up: %w", err)
 		}
+		spliceResult.EntriesRead += copied
+		spliceResult.EntriesCopied += copied
+		spliceResult.LogSize += size
 	}
+
 	if err := newBaseWC.Close(); err != nil {
-		return err
+		return SpliceResult{}, err
+	}
+	if err := tapeio.FlushLogWriter(newLogW); err != nil {
+		return SpliceResult{}, err
 	}
 	newBaseF.Close() // ignore the error since the file might be already closed
+	newLogF.Close()  // ignore the error since the file might be already closed
+
+	if options.dryRun {
+		return dryRunSpliceResult(layout, path, spliceResult, references, options.keepPayloads,
+			newBaseChecksumWC.Size(), newLogChecksumWC.Size(), clock.Now().Sub(start))
+	}
+
+	// a truncated base or log has to be caught before it replaces the original one
+	if err := verifyFile(newBasePath, newBaseChecksumWC.Size(), newBaseChecksumWC.Sum()); err != nil {
+		return SpliceResult{}, err
+	}
+	if err := verifyFile(newLogPath, newLogChecksumWC.Size(), newLogChecksumWC.Sum()); err != nil {
+		return SpliceResult{}, err
+	}
 
+	// payloads that the written base doesn't reference anymore would be deleted below
+	newBaseReferences, err := readBaseReferences[B, S](f, newBasePath, c, targetKey, meta.Get(MetaFieldBaseCompression), codec)
+	if err != nil {
+		return SpliceResult{}, fmt.Errorf("read new base references: %w", err)
+	}
+	if ids := expectedReferences.Missing(newBaseReferences); len(ids) > 0 {
+		return SpliceResult{}, fmt.Errorf("payloads %s: %w", strings.Join(ids, ", "), ErrPayloadReferenceLost)
+	}
+
+	if options.verify {
+		sourceHash, err := replayStateHash[B, S](f, basePath, logPath, c, sourceKey, sourceMeta.Get(MetaFieldBaseCompression), sourceDictionaries, options.migrator, codec)
+		if err != nil {
+			return SpliceResult{}, fmt.Errorf("replay source: %w", err)
+		}
+		targetHash, err := replayStateHash[B, S](f, newBasePath, newLogPath, c, targetKey, meta.Get(MetaFieldBaseCompression), LogDictionaries(meta), nil, codec)
+		if err != nil {
+			return SpliceResult{}, fmt.Errorf("replay target: %w", err)
+		}
+		if !bytes.Equal(sourceHash, targetHash) {
+			return SpliceResult{}, fmt.Errorf("verify splice: %w", ErrDiverged)
+		}
+	}
+
+	if baseF != nil {
+		if err := baseF.Close(); err != nil {
+			return SpliceResult{}, err
+		}
+	}
 	if logF != nil {
 		if err := logF.Close(); err != nil {
-			return err
+			return SpliceResult{}, err
 		}
 	}
-	newLogF.Close() // ignore the error since the file might be already closed
 
-	if err := deleteUnreferencedPayloads(path, payloadIDs); err != nil {
-		return err
+	newPaths := []string{newBasePath, newLogPath}
+	paths := []string{basePath, logPath}
+	for _, name := range reencryptNames {
+		payloadPath := filepath.Join(path, name)
+		reencryptedPath, err := reencryptBlockFile(payloadPath, payloadPath+layout.PartialSuffix, c, sourceKey, targetKey)
+		if err != nil {
+			if errors.Is(err, crypto.ErrInvalidKey) {
+				err = ErrInvalidKey
+			}
+			return SpliceResult{}, fmt.Errorf("re-encrypt payload file %s: %w", name, err)
+		}
+		reencryptedPaths = append(reencryptedPaths, reencryptedPath)
+		newPaths, paths = append(newPaths, reencryptedPath), append(paths, payloadPath)
 	}
 
-	if err := os.Remove(basePath); err != nil && !os.IsNotExist(err) {
-		return err
+	// the meta is swapped in together with the new base and log, so it always describes them
+	meta.SetBytes(MetaFieldBaseSHA256, newBaseChecksumWC.Sum())
+	meta.SetUInt64(MetaFieldLogLen, uint64(spliceResult.EntriesCopied))
+	meta.SetUInt64(MetaFieldLogSize, uint64(newLogChecksumWC.Size()))
+	metaPath := layout.MetaPath(path)
+	if err := WriteMetaFile(newMetaPath, meta); err != nil {
+		return SpliceResult{}, fmt.Errorf("write meta: %w", err)
 	}
-	if err := os.Rename(newBasePath, basePath); err != nil {
-		return err
+	newPaths, paths = append(newPaths, newMetaPath), append(paths, metaPath)
+
+	if live != nil {
+		if err := live.prepare(newLogPath, meta); err != nil {
+			return SpliceResult{}, fmt.Errorf("prepare log: %w", err)
+		}
 	}
 
-	if err := os.Remove(logPath); err != nil && !os.IsNotExist(err) {
-		return err
+	if err := layout.replaceFiles(path, newPaths, paths); err != nil {
+		swapped = errors.Is(err, ErrInterrupted)
+		return SpliceResult{}, fmt.Errorf("replace base and log: %w", err)
 	}
-	if err := os.Rename(newLogPath, logPath); err != nil {
-		return err
+	swapped = true
+
+	if live != nil {
+		live.swap(newBase, int64(spliceResult.EntriesCopied), newLogChecksumWC.Size(), meta.Clone())
 	}
 
-	return nil
+	// payloads are deleted after the swap, since the old log might still reference them
+	keptPayloads, deletedPayloads := 0, 0
+	if options.keepPayloads {
+		ids, err := layout.readPayloadIDs(path)
+		if err != nil {
+			return SpliceResult{}, err
+		}
+		keptPayloads = len(ids)
+	} else {
+		keptPayloads, deletedPayloads, err = layout.deleteUnreferencedPayloads(path, references)
+		if err != nil {
+			return SpliceResult{}, fmt.Errorf("delete unreferenced payloads: %w", err)
+		}
+	}
+
+	result := SpliceResult{
+		EntriesRead:     spliceResult.EntriesRead,
+		EntriesRebased:  spliceResult.EntriesRebased,
+		EntriesCopied:   spliceResult.EntriesCopied,
+		PayloadsKept:    keptPayloads,
+		PayloadsDeleted: deletedPayloads,
+	}
+	if stat, err := os.Stat(basePath); err == nil {
+		result.BaseSize = stat.Size()
+	}
+	if stat, err := os.Stat(logPath); err == nil {
+		result.LogSize = stat.Size()
+	}
+	result.Duration = clock.Now().Sub(start)
+
+	if options.timestamps {
+		meta.SetTime(MetaFieldLastModified, start.Add(result.Duration))
+	}
+	if err := writeSpliceStats(metaPath, meta, start, result); err != nil {
+		return result, fmt.Errorf("write splice stats: %w", err)
+	}
+
+	return result, nil
+}
+
+// dryRunSpliceResult returns the result of a splice that hasn't written anything. The payloads are
+// counted like they would be deleted.
+func dryRunSpliceResult(
+	layout Layout,
+	path string,
+	spliceResult tapeio.SpliceResult,
+	references tapedb.PayloadReferences,
+	keepPayloads bool,
+	baseSize, logSize int64,
+	duration time.Duration,
+) (SpliceResult, error) {
+	ids, err := layout.readPayloadIDs(path)
+	if err != nil {
+		return SpliceResult{}, err
+	}
+
+	kept := 0
+	for _, id := range ids {
+		if keepPayloads || references.Has(id) {
+			kept++
+		}
+	}
+
+	return SpliceResult{
+		EntriesRead:     spliceResult.EntriesRead,
+		EntriesRebased:  spliceResult.EntriesRebased,
+		EntriesCopied:   spliceResult.EntriesCopied,
+		PayloadsKept:    kept,
+		PayloadsDeleted: len(ids) - kept,
+		BaseSize:        baseSize,
+		LogSize:         logSize,
+		Duration:        duration,
+	}, nil
+}
+
+// readBaseReferences returns the payloads that are referenced by the base at the provided path.
+func readBaseReferences[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](f F, path string, c crypto.Cipher, key []byte, compression string, codec tapedb.Codec) (tapedb.PayloadReferences, error) {
+	baseF, _, err := mayOpenReadOnlyFile(path)
+	if err != nil {
+		return nil, err
+	}
+	baseR := io.Reader(nil)
+	if baseF != nil {
+		defer baseF.Close()
+		baseR = baseF
+	}
+
+	if baseR, err = wrapBaseReader(baseR, c, key, compression); err != nil {
+		return nil, fmt.Errorf("new block reader: %w", err)
+	}
+
+	base, err := tapeio.ReadBase[B, S](f, baseR, tapeio.WithCodec(codec))
+	if err != nil {
+		return nil, err
+	}
+
+	references := tapedb.PayloadReferences{}
+	references.Track(base)
+	return references, nil
+}
+
+// replayStateHash replays the base and log at the provided paths and returns the hash of the
+// resulting state.
+func replayStateHash[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](f F, basePath, logPath string, c crypto.Cipher, key []byte, compression string, dictionaries [][]byte, migrator tapedb.ChangeMigrator, codec tapedb.Codec) ([]byte, error) {
+	baseF, _, err := mayOpenReadOnlyFile(basePath)
+	if err != nil {
+		return nil, err
+	}
+	baseR := io.Reader(nil)
+	if baseF != nil {
+		defer baseF.Close()
+		baseR = baseF
+	}
+
+	logF, _, err := mayOpenReadOnlyFile(logPath)
+	if err != nil {
+		return nil, err
+	}
+	logR := tapeio.LogReader(nil)
+	if logF != nil {
+		defer logF.Close()
+		logR = tapeio.NewLogReader(logF)
+	}
+
+	if baseR, err = wrapBaseReader(baseR, c, key, compression); err != nil {
+		return nil, fmt.Errorf("new block reader: %w", err)
+	}
+	if logR, err = wrapLogReader(logR, key, dictionaries); err != nil {
+		return nil, fmt.Errorf("new log reader: %w", err)
+	}
+
+	db, err := tapeio.OpenDatabase[B, S](f, baseR, logR, nil, tapeio.WithMigrator(migrator), tapeio.WithCodec(codec))
+	if err != nil {
+		return nil, err
+	}
+
+	return db.StateHash(), nil
+}
+
+func writeSpliceStats(metaPath string, meta Meta, start time.Time, result SpliceResult) error {
+	meta.SetTime(MetaFieldSpliceTime, start)
+	meta.Set(MetaFieldSpliceDuration, result.Duration.String())
+	meta.SetUInt64(MetaFieldSpliceRebasedChanges, uint64(result.EntriesRebased))
+	meta.SetUInt64(MetaFieldSpliceGeneration, meta.GetUInt64(MetaFieldSpliceGeneration, 0)+1)
+	meta.SetUInt64(MetaFieldSpliceRebasedTotal, meta.GetUInt64(MetaFieldSpliceRebasedTotal, 0)+uint64(result.EntriesRebased))
+	meta.SetUInt64(MetaFieldSpliceBaseSize, uint64(result.BaseSize))
+	meta.SetUInt64(MetaFieldSpliceLogSize, uint64(result.LogSize))
+	meta.SetUInt64(MetaFieldLogLen, uint64(result.EntriesCopied))
+	meta.SetUInt64(MetaFieldLogSize, uint64(result.LogSize))
+	meta.Del(MetaFieldLogDictionaryPrevious)
+
+	return WriteMetaFile(metaPath, meta)
 }
 
 func ReadLogLen(path string) (int, error) {
+	logLen, err := ReadLogLen64(path)
+	return int(logLen), err
+}
+
+// ReadLogLen64 returns the number of entries in the log at the provided path. If the meta file next
+// to the log holds a log length for the current log size, the log doesn't have to be scanned.
+func ReadLogLen64(path string) (int64, error) {
+	return readLogLen64(path, DefaultLayout.MetaPath(filepath.Dir(path)))
+}
+
+func readLogLen64(path, metaPath string) (int64, error) {
 	f, _, err := mayOpenReadOnlyFile(path)
 	if err != nil {
 		return 0, err
@@ -478,38 +1973,77 @@ func ReadLogLen(path string) (int, error) {
 	}
 	defer f.Close()
 
-	return tapeio.ReadLogLen(tapeio.NewLogReader(f))
+	if meta, err := ReadMetaFile(metaPath); err == nil && meta.Has(MetaFieldLogLen) {
+		if stat, err := f.Stat(); err == nil && meta.GetUInt64(MetaFieldLogSize, 0) == uint64(stat.Size()) {
+			return int64(meta.GetUInt64(MetaFieldLogLen, 0)), nil
+		}
+	}
+
+	return tapeio.ReadLogLen64(tapeio.NewLogReader(f))
 }
 
-func deleteUnreferencedPayloads(path string, ids []string) error {
+func (l Layout) deleteUnreferencedPayloads(path string, references tapedb.PayloadReferences) (int, int, error) {
+	ids, err := l.readPayloadIDs(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	kept, deleted := 0, 0
+	for _, id := range ids {
+		if references.Has(id) {
+			kept++
+			continue
+		}
+		if err := l.removePayload(path, id); err != nil {
+			return kept, deleted, err
+		}
+		deleted++
+	}
+
+	return kept, deleted, nil
+}
+
+func (l Layout) readPayloadIDs(path string) ([]string, error) {
 	entries, err := os.ReadDir(path)
 	if err != nil {
-		return fmt.Errorf("read directory: %w", err)
+		return nil, fmt.Errorf("read directory: %w", err)
 	}
 
+	ids := []string{}
 	for _, entry := range entries {
 		if entry.IsDir() {
 			continue
 		}
 
-		if name := entry.Name(); strings.HasPrefix(name, FilePrefixPayload) {
-			id := strings.TrimPrefix(name, FilePrefixPayload)
-			if !stringsContain(ids, id) {
-				if err := os.Remove(filepath.Join(path, entry.Name())); err != nil {
-					return err
-				}
-			}
+		name := entry.Name()
+		if strings.HasSuffix(name, l.PartialSuffix) {
+			continue
+		}
+		if strings.HasPrefix(name, l.PayloadPrefix) {
+			ids = append(ids, strings.TrimPrefix(name, l.PayloadPrefix))
+		} else if strings.HasPrefix(name, l.PayloadManifestPrefix) {
+			ids = append(ids, strings.TrimPrefix(name, l.PayloadManifestPrefix))
 		}
 	}
 
-	return nil
+	return ids, nil
 }
 
-func stringsContain(values []string, value string) bool {
-	for _, v := range values {
-		if v == value {
-			return true
-		}
+func databaseOptions(
+	applyFunc tapeio.ApplyFunc,
+	groupCommit bool,
+	migrator tapedb.ChangeMigrator,
+	clock tapedb.Clock,
+	codec tapedb.Codec,
+) []tapeio.DatabaseOption {
+	opts := []tapeio.DatabaseOption{
+		tapeio.WithApplyFunc(applyFunc),
+		tapeio.WithMigrator(migrator),
+		tapeio.WithClock(clock),
+		tapeio.WithCodec(codec),
+	}
+	if groupCommit {
+		opts = append(opts, tapeio.WithGroupCommit())
 	}
-	return false
+	return opts
 }
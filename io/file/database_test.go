@@ -16,14 +16,22 @@ package file_test
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
 	"io"
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/simia-tech/tapedb/v2"
+	"github.com/simia-tech/tapedb/v2/generic"
+	tapeio "github.com/simia-tech/tapedb/v2/io"
 	"github.com/simia-tech/tapedb/v2/io/crypto"
 	"github.com/simia-tech/tapedb/v2/io/file"
 	"github.com/simia-tech/tapedb/v2/test"
@@ -64,6 +72,37 @@ func TestCreateDatabase(t *testing.T) {
 		require.NoError(t,
 			db.Apply(&test.ChangeCounterInc{Value: 21}))
 	})
+
+	t.Run("EncryptedWithChaCha20Poly1305", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithCreateKey(testKey32), file.WithCipher(crypto.CipherChaCha20Poly1305))
+		require.NoError(t, err)
+
+		require.NoError(t,
+			db.Apply(
+				&test.ChangeAttachPayload{PayloadID: "123"},
+				file.NewPayload("123", strings.NewReader("test content"))))
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 21}))
+		require.NoError(t, db.Close())
+
+		db, err = file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithOpenKey(testKey32))
+		require.NoError(t, err)
+		defer db.Close()
+
+		assert.Equal(t, "chacha20poly1305", db.Meta().Get(file.MetaHeaderCipher))
+		assert.Equal(t, 21, db.State().Counter)
+
+		f, err := db.OpenPayload("123")
+		require.NoError(t, err)
+		defer f.Close()
+
+		content, err := io.ReadAll(f)
+		require.NoError(t, err)
+		assert.Equal(t, "test content", string(content))
+	})
 }
 
 func TestOpenDatabase(t *testing.T) {
@@ -74,6 +113,25 @@ func TestOpenDatabase(t *testing.T) {
 		db, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path)
 		require.Nil(t, db)
 		assert.ErrorIs(t, err, file.ErrMissing)
+
+		e := (*tapedb.Error)(nil)
+		require.ErrorAs(t, err, &e)
+		assert.Equal(t, tapedb.ErrorCodeMissing, e.Code)
+		assert.Equal(t, "open", e.Op)
+		assert.Equal(t, path, e.Path)
+	})
+
+	t.Run("UnknownChangeType", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		makeFile(t, filepath.Join(path, file.FileNameLog),
+			"\x00\x00\x00\x18\x0bcounter-inc{\"value\":1}\n\x00\x00\x00\x19\x0ccounter-plus{\"value\":2}\n")
+
+		_, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path)
+		assert.ErrorIs(t, err, tapedb.ErrUnknownChangeType)
+		assert.Equal(t, tapedb.ErrorCodeInvalidChange, tapedb.ErrorCodeOf(err))
+		assert.Equal(t, int64(1), tapedb.ErrorIndexOf(err))
 	})
 
 	t.Run("WithBase", func(t *testing.T) {
@@ -106,6 +164,23 @@ func TestOpenDatabase(t *testing.T) {
 		assert.Equal(t, 6, db.State().Counter)
 	})
 
+	t.Run("WithMigrations", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		makeFile(t, filepath.Join(path, file.FileNameLog), "\x00\x00\x00\x19\x0ccounter-plus{\"value\":2}\n")
+
+		_, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path)
+		require.Error(t, err)
+
+		db, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithOpenMigrations(tapedb.RenameChangeType("counter-plus", "counter-inc")))
+		require.NoError(t, err)
+		defer db.Close()
+
+		assert.Equal(t, 2, db.State().Counter)
+	})
+
 	t.Run("WithEncryptedLog", func(t *testing.T) {
 		path, removeDir := makeTempDir(t)
 		defer removeDir()
@@ -123,6 +198,100 @@ func TestOpenDatabase(t *testing.T) {
 		assert.Equal(t, 1, db.LogLen())
 		assert.Equal(t, 21, db.State().Counter)
 	})
+
+	t.Run("FailureClosesLog", func(t *testing.T) {
+		if _, err := os.Stat("/proc/self/fd"); err != nil {
+			t.Skip("open files can't be counted")
+		}
+		openFileCount := func(t *testing.T) int {
+			entries, err := os.ReadDir("/proc/self/fd")
+			require.NoError(t, err)
+			return len(entries)
+		}
+
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		makeFileBase64(t, filepath.Join(path, file.FileNameLog),
+			"EAAANQAAAAAAAAAAAAAAAEK16Cb378P+zuAUCxujxvzV2E4MDljzRVpqg0Xg5O3gChdsGaHUeOdn")
+
+		count := openFileCount(t)
+		_, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithOpenKey(testInvalidKey))
+		assert.ErrorIs(t, err, file.ErrInvalidKey)
+		assert.Equal(t, count, openFileCount(t))
+	})
+}
+
+func TestOpenDatabaseReadOnly(t *testing.T) {
+	path, removeDir := makeTempDir(t)
+	defer removeDir()
+
+	makeFile(t, filepath.Join(path, file.FileNameBase), `{"value":3}`)
+	makeFile(t, filepath.Join(path, file.FileNameLog), "\x00\x00\x00\x18\x0bcounter-inc{\"value\":1}\n")
+
+	db, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithReadOnly())
+	require.NoError(t, err)
+	defer db.Close()
+
+	assert.True(t, db.ReadOnly())
+	assert.Equal(t, 4, db.State().Counter)
+
+	assert.ErrorIs(t, db.Apply(&test.ChangeCounterInc{Value: 2}), file.ErrReadOnly)
+	assert.ErrorIs(t, db.SetMeta(file.Meta{}), file.ErrReadOnly)
+
+	assert.Equal(t, "\x00\x00\x00\x18\x0bcounter-inc{\"value\":1}\n", readFile(t, filepath.Join(path, file.FileNameLog)))
+}
+
+func TestOpenDatabaseAt(t *testing.T) {
+	path, removeDir := makeTempDir(t)
+	defer removeDir()
+
+	makeFile(t, filepath.Join(path, file.FileNameBase), `{"value":3}`)
+	makeFile(t, filepath.Join(path, file.FileNameLog),
+		"\x00\x00\x00\x18\x0bcounter-inc{\"value\":1}\n\x00\x00\x00\x18\x0bcounter-inc{\"value\":2}\n\x00\x00\x00\x18\x0bcounter-inc{\"value\":4}\n")
+
+	for logIndex, expectCounter := range map[int64]int{0: 3, 1: 4, 2: 6, 3: 10, 10: 10} {
+		db, err := file.OpenDatabaseAt[*test.Base, *test.State](test.NewFactory(), path, logIndex)
+		require.NoError(t, err)
+
+		assert.True(t, db.ReadOnly())
+		assert.Equal(t, expectCounter, db.State().Counter, "log index %d", logIndex)
+		assert.ErrorIs(t, db.Apply(&test.ChangeCounterInc{Value: 2}), file.ErrReadOnly)
+		require.NoError(t, db.Close())
+	}
+}
+
+func TestReadChanges(t *testing.T) {
+	path, removeDir := makeTempDir(t)
+	defer removeDir()
+
+	db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithCreateKey(testKey))
+	require.NoError(t, err)
+	require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+	require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 2}))
+	require.NoError(t, db.Close())
+
+	t.Run("ValidKey", func(t *testing.T) {
+		changes := []tapedb.Change{}
+		err := file.ReadChanges[*test.Base, *test.State](test.NewFactory(), path,
+			[]file.OpenOption{file.WithOpenKey(testKey)},
+			func(index int, change tapedb.Change) error {
+				assert.Equal(t, len(changes), index)
+				changes = append(changes, change)
+				return nil
+			})
+		require.NoError(t, err)
+		assert.Equal(t, []tapedb.Change{&test.ChangeCounterInc{Value: 1}, &test.ChangeCounterInc{Value: 2}}, changes)
+	})
+
+	t.Run("InvalidKey", func(t *testing.T) {
+		err := file.ReadChanges[*test.Base, *test.State](test.NewFactory(), path,
+			[]file.OpenOption{file.WithOpenKey(testInvalidKey)},
+			func(int, tapedb.Change) error {
+				return nil
+			})
+		assert.ErrorIs(t, err, file.ErrInvalidKey)
+	})
 }
 
 func TestDatabaseApply(t *testing.T) {
@@ -194,6 +363,87 @@ func TestDatabaseApply(t *testing.T) {
 				"test content",
 				readFile(t, filepath.Join(path, file.FilePrefixPayload+"123")))
 		})
+
+		t.Run("WithReferenceToMissingPayload", func(t *testing.T) {
+			path, removeDir := makeTempDir(t)
+			defer removeDir()
+
+			db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path)
+			require.NoError(t, err)
+			defer db.Close()
+
+			assert.ErrorIs(t,
+				db.Apply(&tapedb.AttachPayload{IDs: []string{"123", "456"}},
+					file.NewPayload("123", strings.NewReader("test content"))),
+				file.ErrPayloadMissing)
+			assert.Equal(t, 0, db.LogLen())
+			assert.NoFileExists(t, filepath.Join(path, file.FilePrefixPayload+"123"))
+
+			require.NoError(t,
+				db.Apply(&test.ChangeAttachPayload{PayloadID: "123"},
+					file.NewPayload("123", strings.NewReader("test content"))))
+			require.NoError(t,
+				db.Apply(&tapedb.AttachPayload{IDs: []string{"123"}}))
+		})
+	})
+
+	t.Run("PayloadLimits", func(t *testing.T) {
+		t.Run("TooLarge", func(t *testing.T) {
+			path, removeDir := makeTempDir(t)
+			defer removeDir()
+
+			db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithCreateMaxPayloadSize(4))
+			require.NoError(t, err)
+			defer db.Close()
+
+			assert.ErrorIs(t,
+				db.Apply(
+					&test.ChangeAttachPayload{PayloadID: "123"},
+					file.NewPayload("123", strings.NewReader("test content"))),
+				file.ErrPayloadTooLarge)
+
+			assert.NoFileExists(t, filepath.Join(path, file.FilePrefixPayload+"123"))
+			assert.Equal(t, 0, db.LogLen())
+		})
+
+		t.Run("ChecksumMismatch", func(t *testing.T) {
+			path, removeDir := makeTempDir(t)
+			defer removeDir()
+
+			db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path)
+			require.NoError(t, err)
+			defer db.Close()
+
+			assert.ErrorIs(t,
+				db.Apply(
+					&test.ChangeAttachPayload{PayloadID: "123"},
+					file.NewPayload("123", strings.NewReader("test content")).WithChecksum([]byte("invalid"))),
+				file.ErrPayloadChecksumMismatch)
+
+			assert.NoFileExists(t, filepath.Join(path, file.FilePrefixPayload+"123"))
+		})
+
+		t.Run("Progress", func(t *testing.T) {
+			path, removeDir := makeTempDir(t)
+			defer removeDir()
+
+			db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path)
+			require.NoError(t, err)
+			defer db.Close()
+
+			sum := sha256.Sum256([]byte("test content"))
+			written := int64(0)
+			require.NoError(t,
+				db.Apply(
+					&test.ChangeAttachPayload{PayloadID: "123"},
+					file.NewPayload("123", strings.NewReader("test content")).
+						WithChecksum(sum[:]).
+						WithProgressFunc(func(_ string, n int64) {
+							written = n
+						})))
+
+			assert.Equal(t, int64(12), written)
+		})
 	})
 
 	t.Run("Encrypted", func(t *testing.T) {
@@ -290,6 +540,13 @@ func TestDatabaseOpenPayload(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, "test content", string(content))
 
+		_, err = f.Seek(5, io.SeekStart)
+		require.NoError(t, err)
+
+		content, err = io.ReadAll(f)
+		require.NoError(t, err)
+		assert.Equal(t, "content", string(content))
+
 		require.NoError(t, f.Close())
 	})
 }
@@ -332,6 +589,470 @@ func TestDatabaseStatPayload(t *testing.T) {
 		assert.Equal(t, "payload-123", stat.Name())
 		assert.Equal(t, int64(42), stat.Size())
 	})
+
+	t.Run("EncryptedWithPayloadInfo", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithCreateKey(testKey), file.WithPayloadInfo())
+		require.NoError(t, err)
+		defer db.Close()
+
+		require.NoError(t,
+			db.Apply(
+				&test.ChangeAttachPayload{PayloadID: "123"},
+				file.NewPayload("123", strings.NewReader("test content")).WithContentType("text/plain")))
+
+		stat, err := db.StatPayload("123")
+		require.NoError(t, err)
+		assert.Equal(t, "payload-123", stat.Name())
+		assert.Equal(t, int64(12), stat.Size())
+
+		info, err := db.PayloadInfo("123")
+		require.NoError(t, err)
+		assert.Equal(t, "123", info.ID)
+		assert.Equal(t, int64(12), info.Size)
+		assert.Equal(t, "text/plain", info.ContentType)
+		assert.NotContains(t, readFile(t, filepath.Join(path, file.FilePrefixPayloadInfo+"123")), "text/plain")
+
+		require.NoError(t, db.DeletePayload("123"))
+		_, err = os.Stat(filepath.Join(path, file.FilePrefixPayloadInfo+"123"))
+		assert.True(t, os.IsNotExist(err))
+
+		_, err = db.PayloadInfo("123")
+		assert.ErrorIs(t, err, file.ErrPayloadMissing)
+	})
+}
+
+func TestDatabasePayloadMeta(t *testing.T) {
+	path, removeDir := makeTempDir(t)
+	defer removeDir()
+
+	clock := test.NewClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path,
+		file.WithCreateKey(testKey), file.WithCreateClock(clock))
+	require.NoError(t, err)
+	defer db.Close()
+
+	checksum := sha256.Sum256([]byte("test content"))
+	require.NoError(t,
+		db.Apply(
+			&tapedb.AttachPayload{IDs: []string{"123", "456"}},
+			file.NewPayloadWithMeta("123", strings.NewReader("test content"), file.PayloadMeta{
+				ContentType: "text/plain",
+				SHA256:      checksum[:],
+			}),
+			file.NewPayload("456", strings.NewReader("test content"))))
+
+	meta, err := db.PayloadMeta("123")
+	require.NoError(t, err)
+	assert.Equal(t, file.PayloadMeta{
+		ContentType: "text/plain",
+		SHA256:      checksum[:],
+		CreatedAt:   clock.Now(),
+	}, meta)
+
+	meta, err = db.PayloadMeta("456")
+	require.NoError(t, err)
+	assert.Equal(t, file.PayloadMeta{}, meta)
+
+	_, err = db.PayloadMeta("789")
+	assert.ErrorIs(t, err, file.ErrPayloadMissing)
+
+	assert.ErrorIs(t,
+		db.WritePayload(file.NewPayloadWithMeta("789", strings.NewReader("other content"), file.PayloadMeta{
+			SHA256: checksum[:],
+		})),
+		file.ErrPayloadChecksumMismatch)
+}
+
+func TestReadLogLen64(t *testing.T) {
+	path, removeDir := makeTempDir(t)
+	defer removeDir()
+
+	db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path,
+		file.WithMeta(file.Meta{"Name": []string{"test"}}))
+	require.NoError(t, err)
+	require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+	require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 2}))
+	assert.Equal(t, int64(2), db.LogLen64())
+	require.NoError(t, db.Close())
+	assert.NoFileExists(t, filepath.Join(path, file.FileNameNewMeta))
+
+	meta, err := file.ReadMetaFile(filepath.Join(path, file.FileNameMeta))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), meta.GetUInt64(file.MetaFieldLogLen, 0))
+	assert.Equal(t, "test", meta.Get("Name"))
+
+	logLen, err := file.ReadLogLen64(filepath.Join(path, file.FileNameLog))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), logLen)
+
+	makeFile(t, filepath.Join(path, file.FileNameLog),
+		readFile(t, filepath.Join(path, file.FileNameLog))+"\x00\x00\x00\x18\x0bcounter-inc{\"value\":3}\n")
+
+	logLen, err = file.ReadLogLen64(filepath.Join(path, file.FileNameLog))
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), logLen)
+}
+
+func TestDatabaseTimestamps(t *testing.T) {
+	created := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("ApplyAndSplice", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+		clock := test.NewClock(created)
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithCreateClock(clock))
+		require.NoError(t, err)
+		assert.Equal(t, created, db.Meta().GetTime(file.MetaFieldCreated, time.Time{}))
+		assert.False(t, db.Meta().Has(file.MetaFieldLastModified))
+
+		clock.Add(time.Hour)
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+		assert.Equal(t, created.Add(time.Hour), db.Meta().GetTime(file.MetaFieldLastModified, time.Time{}))
+		require.NoError(t, db.Close())
+
+		meta, err := file.ReadDatabaseMeta(path)
+		require.NoError(t, err)
+		assert.Equal(t, created, meta.GetTime(file.MetaFieldCreated, time.Time{}))
+		assert.Equal(t, created.Add(time.Hour), meta.GetTime(file.MetaFieldLastModified, time.Time{}))
+
+		clock.Add(time.Hour)
+		_, err = file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithSpliceClock(clock))
+		require.NoError(t, err)
+
+		meta, err = file.ReadDatabaseMeta(path)
+		require.NoError(t, err)
+		assert.Equal(t, created, meta.GetTime(file.MetaFieldCreated, time.Time{}))
+		assert.Equal(t, created.Add(2*time.Hour), meta.GetTime(file.MetaFieldLastModified, time.Time{}))
+
+		// a reopened database without applies keeps the last modification time
+		clock.Add(time.Hour)
+		db, err = file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithOpenClock(clock))
+		require.NoError(t, err)
+		require.NoError(t, db.Close())
+
+		meta, err = file.ReadDatabaseMeta(path)
+		require.NoError(t, err)
+		assert.Equal(t, created.Add(2*time.Hour), meta.GetTime(file.MetaFieldLastModified, time.Time{}))
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithMeta(file.Meta{"Test": []string{"Value"}}), file.WithCreateTimestamps(false))
+		require.NoError(t, err)
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+		require.NoError(t, db.Close())
+
+		db, err = file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithOpenTimestamps(false))
+		require.NoError(t, err)
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+		require.NoError(t, db.Close())
+
+		_, err = file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithSpliceTimestamps(false))
+		require.NoError(t, err)
+
+		meta, err := file.ReadDatabaseMeta(path)
+		require.NoError(t, err)
+		assert.False(t, meta.Has(file.MetaFieldCreated))
+		assert.False(t, meta.Has(file.MetaFieldLastModified))
+	})
+}
+
+func TestDatabaseFormat(t *testing.T) {
+	create := func(t *testing.T) string {
+		path, removeDir := makeTempDir(t)
+		t.Cleanup(removeDir)
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path)
+		require.NoError(t, err)
+		require.NoError(t, db.Close())
+		return path
+	}
+	updateMeta := func(t *testing.T, path string, fn func(file.Meta)) {
+		meta, err := file.ReadDatabaseMeta(path)
+		require.NoError(t, err)
+		fn(meta)
+		require.NoError(t, file.WriteMetaFile(filepath.Join(path, file.FileNameMeta), meta))
+	}
+
+	t.Run("ID", func(t *testing.T) {
+		path := create(t)
+		otherPath := create(t)
+
+		db, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path)
+		require.NoError(t, err)
+		defer db.Close()
+		otherDB, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), otherPath)
+		require.NoError(t, err)
+		defer otherDB.Close()
+
+		assert.NotEmpty(t, db.ID())
+		assert.NotEqual(t, db.ID(), otherDB.ID())
+		assert.Equal(t, file.FormatVersion, db.FormatVersion())
+	})
+
+	t.Run("IDFromMeta", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithMeta(file.Meta{file.MetaFieldDatabaseID: []string{"test"}}))
+		require.NoError(t, err)
+		defer db.Close()
+		assert.Equal(t, "test", db.ID())
+	})
+
+	t.Run("WithoutVersion", func(t *testing.T) {
+		path := create(t)
+		updateMeta(t, path, func(meta file.Meta) {
+			meta.Del(file.MetaFieldDatabaseID)
+			meta.Del(file.MetaFieldFormatVersion)
+		})
+
+		db, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path)
+		require.NoError(t, err)
+		defer db.Close()
+		assert.Empty(t, db.ID())
+		assert.Equal(t, 1, db.FormatVersion())
+	})
+
+	t.Run("NewerVersion", func(t *testing.T) {
+		path := create(t)
+		updateMeta(t, path, func(meta file.Meta) {
+			meta.SetUInt64(file.MetaFieldFormatVersion, file.FormatVersion+1)
+		})
+
+		_, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path)
+		assert.ErrorIs(t, err, file.ErrUnsupportedFormatVersion)
+		assert.Equal(t, tapedb.ErrorCodeUnsupported, tapedb.ErrorCodeOf(err))
+		_, err = file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path)
+		assert.ErrorIs(t, err, file.ErrUnsupportedFormatVersion)
+		assert.ErrorIs(t, file.VerifyDatabase(path), file.ErrUnsupportedFormatVersion)
+	})
+
+	t.Run("InvalidVersion", func(t *testing.T) {
+		path := create(t)
+		updateMeta(t, path, func(meta file.Meta) {
+			meta.Set(file.MetaFieldFormatVersion, "one")
+		})
+
+		_, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path)
+		assert.ErrorIs(t, err, file.ErrUnsupportedFormatVersion)
+	})
+}
+
+func TestDatabaseCloseMeta(t *testing.T) {
+	t.Run("WithoutMeta", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path)
+		require.NoError(t, err)
+		require.NoError(t, os.Remove(filepath.Join(path, file.FileNameMeta)))
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+		require.NoError(t, db.Close())
+
+		assert.NoFileExists(t, filepath.Join(path, file.FileNameMeta))
+	})
+
+	t.Run("KeepsConcurrentChanges", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithMeta(file.Meta{"Name": []string{"test"}}))
+		require.NoError(t, err)
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+
+		require.NoError(t, file.WriteMetaFile(filepath.Join(path, file.FileNameMeta), file.Meta{"Name": []string{"other"}}))
+		require.NoError(t, db.Close())
+
+		meta, err := file.ReadMetaFile(filepath.Join(path, file.FileNameMeta))
+		require.NoError(t, err)
+		assert.Equal(t, "other", meta.Get("Name"))
+		assert.Equal(t, uint64(1), meta.GetUInt64(file.MetaFieldLogLen, 0))
+	})
+
+	t.Run("Unchanged", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithMeta(file.Meta{"Name": []string{"test"}}))
+		require.NoError(t, err)
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+		require.NoError(t, db.Close())
+
+		metaPath := filepath.Join(path, file.FileNameMeta)
+		modTime := time.Unix(1000, 0)
+		require.NoError(t, os.Chtimes(metaPath, modTime, modTime))
+
+		db, err = file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path)
+		require.NoError(t, err)
+		require.NoError(t, db.Close())
+
+		stat, err := os.Stat(metaPath)
+		require.NoError(t, err)
+		assert.Equal(t, modTime, stat.ModTime())
+	})
+}
+
+func TestDatabaseDeletePayload(t *testing.T) {
+	path, removeDir := makeTempDir(t)
+	defer removeDir()
+
+	db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithCreateKey(testKey))
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t,
+		db.Apply(
+			&test.ChangeAttachPayload{PayloadID: "123"},
+			file.NewPayload("123", strings.NewReader("test content"))))
+	makeFile(t, filepath.Join(path, file.FilePrefixPayload+"456"), "test content")
+
+	ids, err := db.UnreferencedPayloads()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"456"}, ids)
+
+	require.NoError(t, db.DeletePayload("456"))
+	assert.NoFileExists(t, filepath.Join(path, file.FilePrefixPayload+"456"))
+	assert.ErrorIs(t, db.DeletePayload("456"), file.ErrPayloadMissing)
+
+	ids, err = db.UnreferencedPayloads()
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+}
+
+func TestDatabasePayloadIDs(t *testing.T) {
+	path, removeDir := makeTempDir(t)
+	defer removeDir()
+
+	db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithInlinePayloadSize(4))
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.Apply(&tapedb.AttachPayload{IDs: []string{"456", "123"}},
+		file.NewPayload("456", strings.NewReader("one")),
+		file.NewPayload("123", strings.NewReader("test content"))))
+
+	ids, err := db.PayloadIDs()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"123", "456"}, ids)
+	assert.NoFileExists(t, filepath.Join(path, file.FilePrefixPayload+"456"))
+}
+
+func TestDatabaseItems(t *testing.T) {
+	path, removeDir := makeTempDir(t)
+	defer removeDir()
+
+	db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path)
+	require.NoError(t, err)
+	require.NoError(t, db.Apply(&test.ChangeItemAdd{ID: "a", Name: "Apple", PayloadID: "123"},
+		file.NewPayload("123", strings.NewReader("picture"))))
+	require.NoError(t, db.Apply(&test.ChangeItemAdd{ID: "b", Name: "Banana"}))
+	assert.ErrorIs(t, db.Apply(&test.ChangeItemAdd{ID: "b", Name: "Berry"}), tapedb.ErrInvalidChange)
+	require.NoError(t, db.Apply(&test.ChangeItemRemove{ID: "a", PayloadID: "123"}))
+	assert.Equal(t, map[string]test.Item{"b": {Name: "Banana"}}, db.State().Items)
+	require.NoError(t, db.Close())
+
+	result, err := file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithRebaseChangeCount(3))
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.PayloadsDeleted)
+
+	assert.Equal(t, "{\"value\":0,\"items\":{\"b\":{\"name\":\"Banana\"}}}\n", readFile(t, filepath.Join(path, file.FileNameBase)))
+}
+
+func TestDatabaseDetachPayload(t *testing.T) {
+	path, removeDir := makeTempDir(t)
+	defer removeDir()
+
+	db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path)
+	require.NoError(t, err)
+	require.NoError(t, db.Apply(&tapedb.AttachPayload{IDs: []string{"123", "456"}},
+		file.NewPayload("123", strings.NewReader("one")),
+		file.NewPayload("456", strings.NewReader("two"))))
+	require.NoError(t, db.Apply(&tapedb.DetachPayload{IDs: []string{"123"}}))
+
+	ids, err := db.UnreferencedPayloads()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"123"}, ids)
+	require.NoError(t, db.Close())
+
+	result, err := file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithRebaseChangeCount(1))
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.PayloadsKept)
+	assert.Equal(t, 1, result.PayloadsDeleted)
+
+	assert.Equal(t, "{\"payloadIDs\":[\"123\",\"456\"],\"value\":0}\n", readFile(t, filepath.Join(path, file.FileNameBase)))
+}
+
+func TestDatabaseSpliceLostPayloadReference(t *testing.T) {
+	path, removeDir := makeTempDir(t)
+	defer removeDir()
+
+	db, err := file.CreateDatabase[*test.PlainBase, *test.State](test.NewPlainFactory(), path)
+	require.NoError(t, err)
+	require.NoError(t, db.Apply(&tapedb.AttachPayload{IDs: []string{"123"}},
+		file.NewPayload("123", strings.NewReader("test content"))))
+	require.NoError(t, db.Close())
+
+	_, err = file.SpliceDatabase[*test.PlainBase, *test.State](test.NewPlainFactory(), path, file.WithRebaseChangeCount(1))
+	assert.ErrorIs(t, err, file.ErrPayloadReferenceLost)
+
+	assert.Equal(t, "test content", readFile(t, filepath.Join(path, file.FilePrefixPayload+"123")))
+	assert.NoFileExists(t, filepath.Join(path, file.FileNameNewBase))
+	assert.NoFileExists(t, filepath.Join(path, file.FileNameNewLog))
+
+	_, err = file.SpliceDatabase[*test.PlainBase, *test.State](test.NewPlainFactory(), path)
+	assert.NoError(t, err)
+}
+
+func TestDatabaseSpliceChunkedBase(t *testing.T) {
+	path, removeDir := makeTempDir(t)
+	defer removeDir()
+
+	// the base is written as one document before the model switched to chunks
+	makeFile(t, filepath.Join(path, file.FileNameBase), `{"value":21,"items":{"a":{"name":"A"}}}`)
+	makeFile(t, filepath.Join(path, file.FileNameLog), "")
+
+	db, err := file.OpenDatabase[*test.ChunkedBase, *test.State](test.NewChunkedFactory(), path)
+	require.NoError(t, err)
+	require.NoError(t, db.Apply(&test.ChangeItemAdd{ID: "b", Name: "B"}))
+	require.NoError(t, db.Apply(&test.ChangeItemAdd{ID: "c", Name: "C"}))
+	require.NoError(t, db.Close())
+
+	result, err := file.SpliceDatabase[*test.ChunkedBase, *test.State](
+		test.NewChunkedFactory(), path, file.WithRebaseChangeCount(2), file.WithSpliceVerify())
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.EntriesRebased)
+
+	chunks := []string{}
+	baseF, err := os.Open(filepath.Join(path, file.FileNameBase))
+	require.NoError(t, err)
+	defer baseF.Close()
+	require.NoError(t, tapedb.ReadRawBaseChunks(baseF, func(data []byte) error {
+		chunks = append(chunks, string(data))
+		return nil
+	}))
+	assert.Equal(t, []string{
+		"{\"value\":21,\"items\":{\"a\":{\"name\":\"A\"},\"b\":{\"name\":\"B\"}}}\n",
+		"{\"items\":{\"c\":{\"name\":\"C\"}}}\n",
+	}, chunks)
+
+	db, err = file.OpenDatabase[*test.ChunkedBase, *test.State](test.NewChunkedFactory(), path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	assert.Equal(t, 21, db.State().Counter)
+	assert.Equal(t, map[string]test.Item{"a": {Name: "A"}, "b": {Name: "B"}, "c": {Name: "C"}}, db.State().Items)
 }
 
 func TestDatabaseSplice(t *testing.T) {
@@ -340,8 +1061,8 @@ func TestDatabaseSplice(t *testing.T) {
 			path, removeDir := makeTempDir(t)
 			defer removeDir()
 
-			require.NoError(t,
-				file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path))
+			_, err := file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path)
+			require.NoError(t, err)
 
 			assert.Equal(t, "{\"value\":0}\n", readFile(t, filepath.Join(path, file.FileNameBase)))
 			assert.Equal(t, "", readFile(t, filepath.Join(path, file.FileNameLog)))
@@ -354,13 +1075,27 @@ func TestDatabaseSplice(t *testing.T) {
 			makeFile(t, filepath.Join(path, file.FileNameBase), `{"value":21}`)
 			makeFile(t, filepath.Join(path, file.FileNameLog), "\x00\x00\x00\x18\x0bcounter-inc{\"value\":2}\n")
 
-			require.NoError(t,
-				file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path))
+			_, err := file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path)
+			require.NoError(t, err)
 
 			assert.Equal(t, "{\"value\":21}\n", readFile(t, filepath.Join(path, file.FileNameBase)))
 			assert.Equal(t, "\x00\x00\x00\x18\x0bcounter-inc{\"value\":2}\n", readFile(t, filepath.Join(path, file.FileNameLog)))
 		})
 
+		t.Run("WithMigrations", func(t *testing.T) {
+			path, removeDir := makeTempDir(t)
+			defer removeDir()
+
+			makeFile(t, filepath.Join(path, file.FileNameBase), `{"value":21}`)
+			makeFile(t, filepath.Join(path, file.FileNameLog), "\x00\x00\x00\x19\x0ccounter-plus{\"value\":2}\n")
+
+			_, err := file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path,
+				file.WithSpliceMigrations(tapedb.RenameChangeType("counter-plus", "counter-inc")))
+			require.NoError(t, err)
+
+			assert.Equal(t, "\x00\x00\x00\x18\x0bcounter-inc{\"value\":2}\n", readFile(t, filepath.Join(path, file.FileNameLog)))
+		})
+
 		t.Run("WithPayloads", func(t *testing.T) {
 			path, removeDir := makeTempDir(t)
 			defer removeDir()
@@ -370,13 +1105,33 @@ func TestDatabaseSplice(t *testing.T) {
 			makeFile(t, filepath.Join(path, file.FilePrefixPayload+"123"), "test content")
 			makeFile(t, filepath.Join(path, file.FilePrefixPayload+"456"), "test content")
 
-			require.NoError(t,
-				file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path))
+			result, err := file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path)
+			require.NoError(t, err)
+			assert.Equal(t, 1, result.PayloadsKept)
+			assert.Equal(t, 1, result.PayloadsDeleted)
 
 			assert.NoFileExists(t, filepath.Join(path, file.FilePrefixPayload+"123"))
 			assert.FileExists(t, filepath.Join(path, file.FilePrefixPayload+"456"))
 		})
 
+		t.Run("WithKeptPayloads", func(t *testing.T) {
+			path, removeDir := makeTempDir(t)
+			defer removeDir()
+
+			makeFile(t, filepath.Join(path, file.FileNameBase), `{"value":21}`)
+			makeFile(t, filepath.Join(path, file.FileNameLog), "\x00\x00\x00#\x0eattach-payload{\"payloadID\":\"456\"}\n")
+			makeFile(t, filepath.Join(path, file.FilePrefixPayload+"123"), "test content")
+			makeFile(t, filepath.Join(path, file.FilePrefixPayload+"456"), "test content")
+
+			result, err := file.SpliceDatabase[*generic.Base, *generic.State](generic.NewFactory(), path, file.WithSpliceKeepPayloads())
+			require.NoError(t, err)
+			assert.Equal(t, 2, result.PayloadsKept)
+			assert.Equal(t, 0, result.PayloadsDeleted)
+
+			assert.FileExists(t, filepath.Join(path, file.FilePrefixPayload+"123"))
+			assert.FileExists(t, filepath.Join(path, file.FilePrefixPayload+"456"))
+		})
+
 		t.Run("WithRebaseLogEntries", func(t *testing.T) {
 			path, removeDir := makeTempDir(t)
 			defer removeDir()
@@ -385,14 +1140,119 @@ func TestDatabaseSplice(t *testing.T) {
 			makeFile(t, filepath.Join(path, file.FileNameLog),
 				"\x00\x00\x00\x18\x0bcounter-inc{\"value\":7}\n\x00\x00\x00\x18\x0bcounter-inc{\"value\":2}\n")
 
-			require.NoError(t,
-				file.SpliceDatabase[*test.Base, *test.State](
-					test.NewFactory(), path, file.WithRebaseChangeCount(1)))
+			clock := test.NewClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+			result, err := file.SpliceDatabase[*test.Base, *test.State](
+				test.NewFactory(), path, file.WithRebaseChangeCount(1), file.WithSpliceClock(clock))
+			require.NoError(t, err)
+			assert.Equal(t, 2, result.EntriesRead)
+			assert.Equal(t, 1, result.EntriesRebased)
+			assert.Equal(t, 1, result.EntriesCopied)
+			assert.Equal(t, int64(13), result.BaseSize)
+			assert.Equal(t, int64(28), result.LogSize)
 
 			assert.Equal(t, "{\"value\":28}\n", readFile(t, filepath.Join(path, file.FileNameBase)))
 			assert.Equal(t,
 				"\x00\x00\x00\x18\x0bcounter-inc{\"value\":2}\n",
 				readFile(t, filepath.Join(path, file.FileNameLog)))
+
+			meta, err := file.ReadMetaFile(filepath.Join(path, file.FileNameMeta))
+			require.NoError(t, err)
+			assert.Equal(t, "2021-01-01T00:00:00Z", meta.Get(file.MetaFieldSpliceTime))
+			assert.Equal(t, "0s", meta.Get(file.MetaFieldSpliceDuration))
+			assert.Equal(t, uint64(1), meta.GetUInt64(file.MetaFieldSpliceRebasedChanges, 0))
+			assert.Equal(t, uint64(13), meta.GetUInt64(file.MetaFieldSpliceBaseSize, 0))
+			assert.Equal(t, uint64(28), meta.GetUInt64(file.MetaFieldSpliceLogSize, 0))
+			assert.Equal(t, uint64(1), meta.GetUInt64(file.MetaFieldLogLen, 0))
+		})
+
+		t.Run("WithVerify", func(t *testing.T) {
+			path, removeDir := makeTempDir(t)
+			defer removeDir()
+
+			makeFile(t, filepath.Join(path, file.FileNameBase), `{"value":21}`)
+			makeFile(t, filepath.Join(path, file.FileNameLog),
+				"\x00\x00\x00\x18\x0bcounter-inc{\"value\":7}\n\x00\x00\x00\x18\x0bcounter-inc{\"value\":2}\n")
+
+			_, err := file.SpliceDatabase[*test.Base, *test.State](
+				test.NewFactory(), path, file.WithRebaseChangeCount(1), file.WithSpliceVerify())
+			require.NoError(t, err)
+
+			assert.Equal(t, "{\"value\":28}\n", readFile(t, filepath.Join(path, file.FileNameBase)))
+		})
+
+		t.Run("WithVerifyDiverged", func(t *testing.T) {
+			path, removeDir := makeTempDir(t)
+			defer removeDir()
+
+			// the base ignores counter-set changes, so rebasing them changes the state
+			makeFile(t, filepath.Join(path, file.FileNameBase), `{"value":21}`)
+			makeFile(t, filepath.Join(path, file.FileNameLog), "\x00\x00\x00\x18\x0bcounter-set{\"value\":7}\n")
+
+			_, err := file.SpliceDatabase[*test.Base, *test.State](
+				test.NewFactory(), path, file.WithRebaseChangeCount(1), file.WithSpliceVerify())
+			assert.ErrorIs(t, err, file.ErrDiverged)
+
+			assert.Equal(t, `{"value":21}`, readFile(t, filepath.Join(path, file.FileNameBase)))
+			assert.NoFileExists(t, filepath.Join(path, file.FileNameNewBase))
+		})
+
+		t.Run("WithProgress", func(t *testing.T) {
+			path, removeDir := makeTempDir(t)
+			defer removeDir()
+
+			makeFile(t, filepath.Join(path, file.FileNameBase), `{"value":21}`)
+			makeFile(t, filepath.Join(path, file.FileNameLog),
+				"\x00\x00\x00\x18\x0bcounter-inc{\"value\":7}\n\x00\x00\x00\x18\x0bcounter-inc{\"value\":2}\n")
+
+			progress := []file.SpliceProgress{}
+			_, err := file.SpliceDatabase[*test.Base, *test.State](
+				test.NewFactory(), path, file.WithRebaseChangeCount(1), file.WithSpliceProgress(func(p file.SpliceProgress) {
+					progress = append(progress, p)
+				}))
+			require.NoError(t, err)
+
+			require.Len(t, progress, 2)
+			assert.Equal(t, file.SpliceProgress{EntriesRead: 1, EntriesRebased: 1, BytesRead: 28}, progress[0])
+			assert.Equal(t, 2, progress[1].EntriesRead)
+			assert.Equal(t, 1, progress[1].EntriesCopied)
+			assert.Equal(t, int64(56), progress[1].BytesRead)
+		})
+
+		t.Run("WithDryRun", func(t *testing.T) {
+			path, removeDir := makeTempDir(t)
+			defer removeDir()
+
+			makeFile(t, filepath.Join(path, file.FileNameBase), `{"value":21}`)
+			makeFile(t, filepath.Join(path, file.FileNameLog),
+				"\x00\x00\x00#\x0eattach-payload{\"payloadID\":\"456\"}\n\x00\x00\x00\x18\x0bcounter-inc{\"value\":2}\n")
+			makeFile(t, filepath.Join(path, file.FilePrefixPayload+"123"), "test content")
+			makeFile(t, filepath.Join(path, file.FilePrefixPayload+"456"), "test content")
+
+			result, err := file.SpliceDatabase[*test.Base, *test.State](
+				test.NewFactory(), path, file.WithRebaseChangeCount(1), file.WithSpliceDryRun())
+			require.NoError(t, err)
+			assert.Equal(t, 2, result.EntriesRead)
+			assert.Equal(t, 1, result.EntriesRebased)
+			assert.Equal(t, 1, result.EntriesCopied)
+			assert.Equal(t, 1, result.PayloadsKept)
+			assert.Equal(t, 1, result.PayloadsDeleted)
+			assert.Equal(t, int64(34), result.BaseSize)
+			assert.Equal(t, int64(28), result.LogSize)
+
+			assert.Equal(t, `{"value":21}`, readFile(t, filepath.Join(path, file.FileNameBase)))
+			assert.Equal(t,
+				"\x00\x00\x00#\x0eattach-payload{\"payloadID\":\"456\"}\n\x00\x00\x00\x18\x0bcounter-inc{\"value\":2}\n",
+				readFile(t, filepath.Join(path, file.FileNameLog)))
+			assert.FileExists(t, filepath.Join(path, file.FilePrefixPayload+"123"))
+			assert.NoFileExists(t, filepath.Join(path, file.FileNameNewBase))
+			assert.NoFileExists(t, filepath.Join(path, file.FileNameNewLog))
+			assert.NoFileExists(t, filepath.Join(path, file.FileNameMeta))
+
+			spliceResult, err := file.SpliceDatabase[*test.Base, *test.State](
+				test.NewFactory(), path, file.WithRebaseChangeCount(1))
+			require.NoError(t, err)
+			spliceResult.Duration, result.Duration = 0, 0
+			assert.Equal(t, spliceResult, result)
 		})
 	})
 
@@ -403,8 +1263,8 @@ func TestDatabaseSplice(t *testing.T) {
 			path, removeDir := makeTempDir(t)
 			defer removeDir()
 
-			require.NoError(t,
-				file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithTargetKey(testKey)))
+			_, err := file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithTargetKey(testKey))
+			require.NoError(t, err)
 
 			assert.Equal(t,
 				"AAAAAAAAAAAAAAAAHAAy9PEy9e7Drtm5B2Ih+wBioy9nEqoVlbSJnZT3",
@@ -419,8 +1279,8 @@ func TestDatabaseSplice(t *testing.T) {
 			makeFile(t, filepath.Join(path, file.FileNameBase), `{"value":21}`)
 			makeFile(t, filepath.Join(path, file.FileNameLog), "\x00\x00\x00\x18\x0bcounter-inc{\"value\":2}\n")
 
-			require.NoError(t,
-				file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithTargetKey(testKey)))
+			_, err := file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithTargetKey(testKey))
+			require.NoError(t, err)
 
 			assert.Equal(t,
 				"AAAAAAAAAAAAAAAAHQAy9PEy9e7Drtm7SxVq+PKr/ubvzKL1RyiHE+zmiQ",
@@ -443,8 +1303,8 @@ func TestDatabaseSplice(t *testing.T) {
 			makeFileBase64(t, filepath.Join(path, file.FileNameLog),
 				"EAAANAAAAAAAAAAAAAAAAEK16Cb378P+zuAUCxujxvzV2E4MDli/MpzG8dh/UYqsEnrWaFYZLyk")
 
-			require.NoError(t,
-				file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithSourceKey(testKey)))
+			_, err := file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithSourceKey(testKey))
+			require.NoError(t, err)
 
 			assert.Equal(t, "{\"value\":21}\n", readFile(t, filepath.Join(path, file.FileNameBase)))
 			assert.Equal(t, "\x00\x00\x00\x18\x0bcounter-inc{\"value\":2}\n", readFile(t, filepath.Join(path, file.FileNameLog)))
@@ -463,11 +1323,11 @@ func TestDatabaseSplice(t *testing.T) {
 			makeFileBase64(t, filepath.Join(path, file.FileNameLog),
 				"EAAANAAAAAAAAAAAAAAAAEK16Cb378P+zuAUCxujxvzV2E4MDli/MpzG8dh/UYqsEnrWaFYZLyk")
 
-			require.NoError(t,
-				file.SpliceDatabase[*test.Base, *test.State](
-					test.NewFactory(),
-					path,
-					file.WithSourceKey(testKey), file.WithTargetKey(testKey)))
+			_, err := file.SpliceDatabase[*test.Base, *test.State](
+				test.NewFactory(),
+				path,
+				file.WithSourceKey(testKey), file.WithTargetKey(testKey))
+			require.NoError(t, err)
 
 			assert.Equal(t,
 				"AAAAAAAAAAAAAAAAHQAy9PEy9e7Drtm7SxVq+PKr/ubvzKL1RyiHE+zmiQ",
@@ -476,5 +1336,268 @@ func TestDatabaseSplice(t *testing.T) {
 				"EAAANAAAAAAAAAAAAAAAAEK16Cb378P+zuAUCxujxvzV2E4MDli/MpzG8dh/UYqsEnrWaFYZLyk",
 				readFileBase64(t, filepath.Join(path, file.FileNameLog)))
 		})
+
+		t.Run("WithPayloadsAndNewKey", func(t *testing.T) {
+			path, removeDir := makeTempDir(t)
+			defer removeDir()
+
+			db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path,
+				file.WithCreateKeyFunc(file.DeriveKeyFrom("old", testCryptSettings)))
+			require.NoError(t, err)
+			require.NoError(t, db.Apply(
+				&test.ChangeItemAdd{ID: "a", Name: "Apple", PayloadID: "p"},
+				file.NewPayload("p", strings.NewReader("payload"))))
+			require.NoError(t, db.Close())
+
+			_, err = file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path,
+				file.WithSourceKeyFunc(file.DeriveKeyFrom("old", testCryptSettings)),
+				file.WithTargetKeyFunc(file.DeriveKeyFrom("new", testCryptSettings)))
+			require.NoError(t, err)
+
+			db, err = file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path,
+				file.WithOpenKeyFunc(file.DeriveKeyFrom("new", testCryptSettings)))
+			require.NoError(t, err)
+			defer db.Close()
+
+			r, err := db.OpenPayload("p")
+			require.NoError(t, err)
+			defer r.Close()
+			data, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, "payload", string(data))
+			assert.NoFileExists(t, filepath.Join(path, file.FilePrefixPayload+"p"+file.FileSuffixPartial))
+		})
 	})
+
+	t.Run("Rollback", func(t *testing.T) {
+		setup := func(t *testing.T) (string, func()) {
+			path, removeDir := makeTempDir(t)
+			makeFile(t, filepath.Join(path, file.FileNameBase), `{"value":21}`)
+			makeFile(t, filepath.Join(path, file.FileNameLog),
+				"\x00\x00\x00\x18\x0bcounter-inc{\"value\":7}\n\x00\x00\x00\x18\x0bcounter-inc{\"value\":2}\n")
+			return path, removeDir
+		}
+
+		assertUntouched := func(t *testing.T, path string) {
+			assert.Equal(t, `{"value":21}`, readFile(t, filepath.Join(path, file.FileNameBase)))
+			assert.Equal(t,
+				"\x00\x00\x00\x18\x0bcounter-inc{\"value\":7}\n\x00\x00\x00\x18\x0bcounter-inc{\"value\":2}\n",
+				readFile(t, filepath.Join(path, file.FileNameLog)))
+			assert.NoFileExists(t, filepath.Join(path, file.FileNameNewBase))
+			assert.NoFileExists(t, filepath.Join(path, file.FileNameNewLog))
+			assert.NoFileExists(t, filepath.Join(path, file.FileNameBase+file.FileSuffixBackup))
+			assert.NoFileExists(t, filepath.Join(path, file.FileNameLog+file.FileSuffixBackup))
+		}
+
+		t.Run("FailingSelect", func(t *testing.T) {
+			path, removeDir := setup(t)
+			defer removeDir()
+
+			errTest := errors.New("test")
+			_, err := file.SpliceDatabase[*test.Base, *test.State](
+				test.NewFactory(), path,
+				file.WithRebaseChangeSelectFunc(func(_ tapedb.Change, logIndex int) (bool, error) {
+					if logIndex == 1 {
+						return false, errTest
+					}
+					return true, nil
+				}))
+			require.ErrorIs(t, err, errTest)
+
+			assertUntouched(t, path)
+		})
+
+		t.Run("FailingWriter", func(t *testing.T) {
+			path, removeDir := setup(t)
+			defer removeDir()
+
+			defer file.SetCreateFile(func(path string, _ os.FileMode) (*os.File, error) {
+				if err := os.WriteFile(path, nil, 0644); err != nil {
+					return nil, err
+				}
+				return os.Open(path) // writes to a read-only file fail
+			})()
+
+			_, err := file.SpliceDatabase[*test.Base, *test.State](
+				test.NewFactory(), path, file.WithRebaseChangeCount(1))
+			require.Error(t, err)
+
+			assertUntouched(t, path)
+		})
+
+		t.Run("FailingRenameKeepsPayloads", func(t *testing.T) {
+			path, removeDir := makeTempDir(t)
+			defer removeDir()
+
+			makeFile(t, filepath.Join(path, file.FileNameBase), `{"value":21}`)
+			makeFile(t, filepath.Join(path, file.FileNameLog), "\x00\x00\x00#\x0eattach-payload{\"payloadID\":\"456\"}\n")
+			makeFile(t, filepath.Join(path, file.FilePrefixPayload+"123"), "test content")
+			makeFile(t, filepath.Join(path, file.FilePrefixPayload+"456"), "test content")
+
+			errTest := errors.New("test")
+			defer file.SetRenameFile(func(oldPath, newPath string) error {
+				if filepath.Base(oldPath) == file.FileNameNewBase {
+					return errTest
+				}
+				return os.Rename(oldPath, newPath)
+			})()
+
+			_, err := file.SpliceDatabase[*test.Base, *test.State](
+				test.NewFactory(), path, file.WithRebaseChangeCount(1))
+			require.ErrorIs(t, err, errTest)
+
+			assert.Equal(t, "\x00\x00\x00#\x0eattach-payload{\"payloadID\":\"456\"}\n", readFile(t, filepath.Join(path, file.FileNameLog)))
+			assert.FileExists(t, filepath.Join(path, file.FilePrefixPayload+"123"))
+			assert.FileExists(t, filepath.Join(path, file.FilePrefixPayload+"456"))
+		})
+
+		t.Run("FailingRename", func(t *testing.T) {
+			path, removeDir := setup(t)
+			defer removeDir()
+
+			errTest := errors.New("test")
+			restore := file.SetRenameFile(func(oldPath, newPath string) error {
+				if filepath.Base(oldPath) == file.FileNameNewLog {
+					return errTest
+				}
+				return os.Rename(oldPath, newPath)
+			})
+			defer restore()
+
+			_, err := file.SpliceDatabase[*test.Base, *test.State](
+				test.NewFactory(), path, file.WithRebaseChangeCount(1))
+			require.ErrorIs(t, err, errTest)
+
+			assertUntouched(t, path)
+
+			restore()
+			_, err = file.SpliceDatabase[*test.Base, *test.State](
+				test.NewFactory(), path, file.WithRebaseChangeCount(1))
+			require.NoError(t, err)
+			assert.Equal(t, "{\"value\":28}\n", readFile(t, filepath.Join(path, file.FileNameBase)))
+		})
+	})
+}
+
+func TestDatabaseContext(t *testing.T) {
+	setupFn := func(t *testing.T) (string, func()) {
+		path, removeDir := makeTempDir(t)
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path)
+		require.NoError(t, err)
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 2}))
+		require.NoError(t, db.Close())
+
+		return path, removeDir
+	}
+
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	t.Run("Open", func(t *testing.T) {
+		path, removeDir := setupFn(t)
+		defer removeDir()
+
+		_, err := file.OpenDatabaseContext[*test.Base, *test.State](canceledCtx, test.NewFactory(), path)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("Apply", func(t *testing.T) {
+		path, removeDir := setupFn(t)
+		defer removeDir()
+
+		db, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path)
+		require.NoError(t, err)
+		defer db.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		err = db.ApplyContext(ctx, &test.ChangeAttachPayload{PayloadID: "123"},
+			file.NewPayload("123", &cancelingReader{r: strings.NewReader("test content"), cancel: cancel}))
+		assert.ErrorIs(t, err, context.Canceled)
+
+		assert.Equal(t, 2, db.LogLen())
+		assert.NoFileExists(t, filepath.Join(path, file.FilePrefixPayload+"123"))
+	})
+
+	t.Run("Splice", func(t *testing.T) {
+		path, removeDir := setupFn(t)
+		defer removeDir()
+
+		log := readFile(t, filepath.Join(path, file.FileNameLog))
+
+		_, err := file.SpliceDatabaseContext[*test.Base, *test.State](canceledCtx, test.NewFactory(), path,
+			file.WithRebaseChangeCount(1))
+		assert.ErrorIs(t, err, context.Canceled)
+
+		assert.Equal(t, log, readFile(t, filepath.Join(path, file.FileNameLog)))
+		assert.NoFileExists(t, filepath.Join(path, file.FileNameNewLog))
+	})
+}
+
+// cancelingReader cancels the context after the first read.
+type cancelingReader struct {
+	r      io.Reader
+	cancel func()
+}
+
+func (r *cancelingReader) Read(data []byte) (int, error) {
+	n, err := r.r.Read(data[:1])
+	r.cancel()
+	return n, err
+}
+
+func TestOpenDiagnostics(t *testing.T) {
+	path, removeDir := makeTempDir(t)
+	defer removeDir()
+
+	db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path)
+	require.NoError(t, err)
+	require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+	require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 2}))
+	require.NoError(t, db.Close())
+
+	t.Run("Phases", func(t *testing.T) {
+		diagnostics := []file.OpenDiagnostics{}
+		db, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithOpenDiagnosticsFunc(func(d file.OpenDiagnostics) { diagnostics = append(diagnostics, d) }))
+		require.NoError(t, err)
+		defer db.Close()
+
+		require.Len(t, diagnostics, 1)
+		assert.Equal(t, path, diagnostics[0].Path)
+		assert.Equal(t, int64(2), diagnostics[0].LogLen)
+		assert.Equal(t, db.LogOffset(), diagnostics[0].LogSize)
+		assert.NoError(t, diagnostics[0].Err)
+		assert.GreaterOrEqual(t, diagnostics[0].Duration, diagnostics[0].LogReplay)
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		diagnostics := file.OpenDiagnostics{}
+		_, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithOpenTimeout(time.Millisecond),
+			file.WithOpenReplayGovernor(tapeio.ReplayGovernor{ProgressFunc: func(tapeio.ReplayProgress) {
+				time.Sleep(10 * time.Millisecond)
+			}}),
+			file.WithOpenDiagnosticsFunc(func(d file.OpenDiagnostics) { diagnostics = d }))
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.ErrorIs(t, diagnostics.Err, context.DeadlineExceeded)
+		assert.Zero(t, diagnostics.LogLen)
+	})
+}
+
+func TestInvalidChange(t *testing.T) {
+	path, removeDir := makeTempDir(t)
+	defer removeDir()
+
+	db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = db.Apply(&test.ChangeCounterDec{Value: 1}, file.NewPayload("123", strings.NewReader("test content")))
+	assert.ErrorIs(t, err, tapedb.ErrInvalidChange)
+
+	assert.Equal(t, 0, db.LogLen())
+	assert.Equal(t, 0, db.State().Counter)
+	assert.NoFileExists(t, filepath.Join(path, file.FilePrefixPayload+"123"))
 }
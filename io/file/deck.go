@@ -16,9 +16,13 @@ package file
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"math"
 	"os"
-	"path/filepath"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	lru "github.com/hashicorp/golang-lru"
 
@@ -32,40 +36,72 @@ type Deck[
 ] struct {
 	databases      *lru.Cache
 	databasesMutex sync.RWMutex
+	pins           map[string]int
+	limit          int
+	options        deckOptions
+	clock          tapedb.Clock
+	reapTimer      tapedb.Timer
+	closed         bool
 }
 
 func NewDeck[
 	B tapedb.Base,
 	S tapedb.State,
 	F tapedb.Factory[B, S],
-](openDatabaseLimit int) (*Deck[B, S, F], error) {
-	databases, err := lru.New(openDatabaseLimit)
+](openDatabaseLimit int, opts ...DeckOption) (*Deck[B, S, F], error) {
+	options := defaultDeckOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if openDatabaseLimit <= 0 {
+		return nil, errors.New("must provide a positive size")
+	}
+
+	// the limit is enforced by add, since databases that are in use can't be evicted
+	databases, err := lru.New(math.MaxInt32)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Deck[B, S, F]{
+	d := &Deck[B, S, F]{
 		databases: databases,
-	}, nil
+		pins:      map[string]int{},
+		limit:     openDatabaseLimit,
+		options:   options,
+		clock:     tapedb.ClockOrSystem(options.clock),
+	}
+	if options.idleTimeout > 0 {
+		d.scheduleReap()
+	}
+
+	return d, nil
 }
 
 func (d *Deck[B, S, F]) Close() error {
 	d.databasesMutex.Lock()
 	defer d.databasesMutex.Unlock()
 
+	d.closed = true
+	if d.reapTimer != nil {
+		d.reapTimer.Stop()
+	}
+
+	// all databases are closed, even if one of them fails
+	err := error(nil)
 	for _, value, ok := d.databases.RemoveOldest(); ok; _, value, ok = d.databases.RemoveOldest() {
 		entry := value.(*entry[B, S])
 
 		entry.dbMutex.Lock()
-		err := entry.db.Close()
+		cErr := entry.db.Close()
 		entry.dbMutex.Unlock()
 
-		if err != nil {
-			return err
+		if err == nil {
+			err = cErr
 		}
 	}
 
-	return nil
+	return err
 }
 
 func (d *Deck[B, S, F]) Len() int {
@@ -75,16 +111,51 @@ func (d *Deck[B, S, F]) Len() int {
 	return l
 }
 
+// Pin prevents the database at the provided path from being evicted until Unpin is called as many
+// times as Pin. The database can be pinned before it is opened. Pinned databases are still closed
+// by Delete, Splice and Close.
+func (d *Deck[B, S, F]) Pin(path string) {
+	d.databasesMutex.Lock()
+	d.pins[path]++
+	d.databasesMutex.Unlock()
+}
+
+func (d *Deck[B, S, F]) Unpin(path string) {
+	d.databasesMutex.Lock()
+	defer d.databasesMutex.Unlock()
+
+	if d.pins[path] <= 1 {
+		delete(d.pins, path)
+		return
+	}
+	d.pins[path]--
+}
+
+func (d *Deck[B, S, F]) Pinned(path string) bool {
+	d.databasesMutex.RLock()
+	defer d.databasesMutex.RUnlock()
+	return d.pins[path] > 0
+}
+
 func (d *Deck[B, S, F]) Create(f F, path string, opts ...CreateOption) error {
 	d.databasesMutex.Lock()
 	defer d.databasesMutex.Unlock()
 
+	opts = append([]CreateOption{
+		WithCreateRetryPolicy(d.options.retryPolicy),
+		WithCreateObserver(d.options.observer),
+		WithCreateLayout(d.options.layout),
+	}, opts...)
+
 	db, err := CreateDatabase[B, S](f, path, opts...)
 	if err != nil {
 		return err
 	}
 
-	d.databases.Add(path, &entry[B, S]{db: db})
+	if err := d.add(path, &entry[B, S]{db: db}); err != nil {
+		db.Close()
+		return err
+	}
 
 	return nil
 }
@@ -100,6 +171,7 @@ func (d *Deck[B, S, F]) Delete(path string) error {
 		err := entry.db.Close()
 		entry.dbMutex.Unlock()
 
+		d.databases.Remove(path)
 		if err != nil {
 			return err
 		}
@@ -109,7 +181,9 @@ func (d *Deck[B, S, F]) Delete(path string) error {
 		return err
 	}
 
-	d.databases.Remove(path)
+	if d.options.baseCache != nil {
+		d.options.baseCache.Invalidate(path)
+	}
 
 	return nil
 }
@@ -125,7 +199,7 @@ func (d *Deck[B, S, F]) Meta(path string) (Meta, error) {
 
 	d.databasesMutex.RUnlock()
 
-	return ReadMetaFile(filepath.Join(path, FileNameMeta))
+	return d.options.layout.readDatabaseMeta(path)
 }
 
 func (d *Deck[B, S, F]) SetMeta(path string, meta Meta) error {
@@ -138,67 +212,205 @@ func (d *Deck[B, S, F]) SetMeta(path string, meta Meta) error {
 		}
 	}
 
-	return WriteMetaFile(filepath.Join(path, FileNameMeta), meta)
+	return WriteMetaFile(d.options.layout.MetaPath(path), meta)
 }
 
 func (d *Deck[B, S, F]) LogLen(path string) (int, error) {
+	logLen, err := d.LogLen64(path)
+	return int(logLen), err
+}
+
+func (d *Deck[B, S, F]) LogLen64(path string) (int64, error) {
 	d.databasesMutex.RLock()
 
 	if value, ok := d.databases.Get(path); ok {
-		logLen := value.(*entry[B, S]).db.LogLen()
+		logLen := value.(*entry[B, S]).db.LogLen64()
 		d.databasesMutex.RUnlock()
 		return logLen, nil
 	}
 
 	d.databasesMutex.RUnlock()
 
-	return ReadLogLen(filepath.Join(path, FileNameLog))
+	layout := d.options.layout
+	if err := layout.mustExist(path); err != nil {
+		return 0, err
+	}
+
+	return readLogLen64(layout.LogPath(path), layout.MetaPath(path))
 }
 
 func (d *Deck[B, S, F]) Open(f F, path string, opts []OpenOption) (*Database[B, S], func(), error) {
+	return d.OpenContext(context.Background(), f, path, opts)
+}
+
+// OpenContext opens the database like Open, but stops the replay of the log as soon as the provided
+// context is done.
+func (d *Deck[B, S, F]) OpenContext(ctx context.Context, f F, path string, opts []OpenOption) (*Database[B, S], func(), error) {
+	entry, err := d.open(ctx, f, path, nil, opts, func(e *entry[B, S]) {
+		e.dbMutex.Lock()
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return entry.db, func() {
+		entry.touch(d.clock)
+		entry.dbMutex.Unlock()
+	}, nil
+}
+
+func (d *Deck[B, S, F]) WithOpen(f F, path string, opts []OpenOption, fn func(*Database[B, S]) error) error {
+	db, unlockFn, err := d.Open(f, path, opts)
+	if err != nil {
+		return err
+	}
+	defer unlockFn()
+
+	return fn(db)
+}
+
+// OpenOrCreate opens the database at the provided path for writing or creates it, if it doesn't
+// exist. The open options have to derive the same key as the create options.
+func (d *Deck[B, S, F]) OpenOrCreate(f F, path string, createOpts []CreateOption, openOpts []OpenOption) (*Database[B, S], func(), error) {
+	if createOpts == nil {
+		createOpts = []CreateOption{}
+	}
+	entry, err := d.open(context.Background(), f, path, createOpts, openOpts, func(e *entry[B, S]) {
+		e.dbMutex.Lock()
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return entry.db, func() {
+		entry.touch(d.clock)
+		entry.dbMutex.Unlock()
+	}, nil
+}
+
+func (d *Deck[B, S, F]) WithOpenOrCreate(f F, path string, createOpts []CreateOption, openOpts []OpenOption, fn func(*Database[B, S]) error) error {
+	db, unlockFn, err := d.OpenOrCreate(f, path, createOpts, openOpts)
+	if err != nil {
+		return err
+	}
+	defer unlockFn()
+
+	return fn(db)
+}
+
+// Exists returns true if the database at the provided path is open in the deck or exists on disk.
+func (d *Deck[B, S, F]) Exists(path string) (bool, error) {
+	d.databasesMutex.RLock()
+	defer d.databasesMutex.RUnlock()
+
+	if d.databases.Contains(path) {
+		return true, nil
+	}
+	return d.options.layout.exists(path)
+}
+
+// OpenRead opens the database at the provided path for reading. The database is shared with other
+// readers, so only a read-only view of it is returned.
+func (d *Deck[B, S, F]) OpenRead(f F, path string, opts []OpenOption) (*ReadOnlyDatabase[B, S], func(), error) {
+	return d.OpenReadContext(context.Background(), f, path, opts)
+}
+
+// OpenReadContext opens the database like OpenRead, but stops the replay of the log as soon as the
+// provided context is done.
+func (d *Deck[B, S, F]) OpenReadContext(ctx context.Context, f F, path string, opts []OpenOption) (*ReadOnlyDatabase[B, S], func(), error) {
+	entry, err := d.open(ctx, f, path, nil, opts, func(e *entry[B, S]) {
+		e.dbMutex.RLock()
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return entry.db.AsReadOnly(), func() {
+		entry.touch(d.clock)
+		entry.dbMutex.RUnlock()
+	}, nil
+}
+
+func (d *Deck[B, S, F]) WithOpenRead(f F, path string, opts []OpenOption, fn func(*ReadOnlyDatabase[B, S]) error) error {
+	db, unlockFn, err := d.OpenRead(f, path, opts)
+	if err != nil {
+		return err
+	}
+	defer unlockFn()
+
+	return fn(db)
+}
+
+// open returns the locked entry of the database at the provided path. If create options are
+// provided, a missing database is created.
+func (d *Deck[B, S, F]) open(ctx context.Context, f F, path string, createOpts []CreateOption, opts []OpenOption, lockFn func(*entry[B, S])) (*entry[B, S], error) {
 	d.databasesMutex.Lock()
 
 	value, ok := d.databases.Get(path)
-	if !ok {
-		db, err := OpenDatabase[B, S](f, path, opts...)
+	if ok {
+		ObserverOrNop(d.options.observer).OnOpen(OpenEvent{Path: path, Cached: true})
+	} else {
+		db, err := d.openOrCreateDatabase(ctx, f, path, createOpts, opts)
 		if err != nil {
 			d.databasesMutex.Unlock()
-			return nil, nil, err
+			return nil, err
 		}
 		value = &entry[B, S]{db: db}
-		d.databases.Add(path, value)
+		if err := d.add(path, value.(*entry[B, S])); err != nil {
+			d.databasesMutex.Unlock()
+			db.Close()
+			return nil, err
+		}
 	}
 	entry := value.(*entry[B, S])
+	entry.touch(d.clock)
 
 	key, err := deriveKey(opts, entry.db.Meta())
 	if err != nil {
 		d.databasesMutex.Unlock()
-		return nil, nil, err
+		return nil, err
 	}
 	if !bytes.Equal(entry.db.Key(), key) {
 		d.databasesMutex.Unlock()
-		return nil, nil, ErrInvalidKey
+		return nil, ErrInvalidKey
 	}
-	entry.dbMutex.Lock()
+	lockFn(entry)
 
 	d.databasesMutex.Unlock()
 
-	return entry.db, func() {
-		entry.dbMutex.Unlock()
-	}, nil
+	return entry, nil
 }
 
-func (d *Deck[B, S, F]) WithOpen(f F, path string, opts []OpenOption, fn func(*Database[B, S]) error) error {
-	db, unlockFn, err := d.Open(f, path, opts)
-	if err != nil {
-		return err
+func (d *Deck[B, S, F]) openOrCreateDatabase(ctx context.Context, f F, path string, createOpts []CreateOption, opts []OpenOption) (*Database[B, S], error) {
+	if createOpts != nil {
+		exists, err := d.options.layout.exists(path)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return CreateDatabase[B, S](f, path, append([]CreateOption{
+				WithCreateRetryPolicy(d.options.retryPolicy),
+				WithCreateObserver(d.options.observer),
+				WithCreateLayout(d.options.layout),
+			}, createOpts...)...)
+		}
 	}
-	defer unlockFn()
 
-	return fn(db)
+	return OpenDatabaseContext[B, S](ctx, f, path, append([]OpenOption{
+		WithOpenRetryPolicy(d.options.retryPolicy),
+		WithOpenBaseCache(d.options.baseCache),
+		WithOpenObserver(d.options.observer),
+		WithOpenLayout(d.options.layout),
+	}, opts...)...)
 }
 
-func (d *Deck[B, S, F]) Splice(f F, path string, opts ...SpliceOption) error {
+func (d *Deck[B, S, F]) Splice(f F, path string, opts ...SpliceOption) (SpliceResult, error) {
+	return d.SpliceContext(context.Background(), f, path, opts...)
+}
+
+// SpliceContext splices the database like Splice, but aborts as soon as the provided context is
+// done.
+func (d *Deck[B, S, F]) SpliceContext(ctx context.Context, f F, path string, opts ...SpliceOption) (SpliceResult, error) {
 	d.databasesMutex.Lock()
 	defer d.databasesMutex.Unlock()
 
@@ -209,23 +421,155 @@ func (d *Deck[B, S, F]) Splice(f F, path string, opts ...SpliceOption) error {
 		err := e.db.Close()
 		e.dbMutex.Unlock()
 
+		d.databases.Remove(path)
 		if err != nil {
-			return err
+			return SpliceResult{}, err
 		}
+	}
+	if d.options.baseCache != nil {
+		d.options.baseCache.Invalidate(path)
+	}
 
-		d.databases.Remove(path)
+	return SpliceDatabaseContext[B, S](ctx, f, path, append([]SpliceOption{
+		WithSpliceObserver(d.options.observer),
+		WithSpliceLayout(d.options.layout),
+	}, opts...)...)
+}
+
+// SpliceOnline splices the database at the provided path like Splice, but doesn't close it, if
+// it's open in the deck. It's spliced in place instead and stays pinned until the splice is done,
+// see Database.SpliceInPlace. A database that isn't open or that is open read-only is spliced like
+// by Splice.
+func (d *Deck[B, S, F]) SpliceOnline(f F, path string, opts ...SpliceOption) (SpliceResult, error) {
+	d.databasesMutex.Lock()
+	value, ok := d.databases.Get(path)
+	if !ok || value.(*entry[B, S]).db.ReadOnly() {
+		d.databasesMutex.Unlock()
+		return d.Splice(f, path, opts...)
+	}
+	d.pins[path]++
+	d.databasesMutex.Unlock()
+	defer d.Unpin(path)
+
+	result, err := value.(*entry[B, S]).db.SpliceInPlace(f, append([]SpliceOption{
+		WithSpliceObserver(d.options.observer),
+	}, opts...)...)
+	if d.options.baseCache != nil {
+		d.options.baseCache.Invalidate(path)
 	}
+	return result, err
+}
 
-	if err := SpliceDatabase[B, S](f, path, opts...); err != nil {
+// add inserts the entry. If the limit is reached, the least recently used databases are closed
+// first, so no evicted database can be in use while the path is opened again. Databases that are
+// in use or pinned are skipped, since their users might wait for the deck. The limit is exceeded
+// until they are released.
+func (d *Deck[B, S, F]) add(path string, e *entry[B, S]) error {
+	if err := d.evict(d.limit - 1); err != nil {
 		return err
 	}
 
+	e.touch(d.clock)
+	d.databases.Add(path, e)
+
+	return nil
+}
+
+// evict closes and removes the least recently used databases that aren't in use until the deck
+// holds at most the provided number of databases.
+func (d *Deck[B, S, F]) evict(limit int) error {
+	for _, key := range d.databases.Keys() {
+		if d.databases.Len() <= limit {
+			return nil
+		}
+
+		path := key.(string)
+		if d.pins[path] > 0 {
+			continue
+		}
+		value, ok := d.databases.Peek(key)
+		if !ok {
+			continue
+		}
+		victim := value.(*entry[B, S])
+		if !victim.dbMutex.TryLock() {
+			continue
+		}
+		if d.options.evictFunc != nil {
+			d.options.evictFunc(path)
+		}
+		err := victim.db.Close()
+		victim.dbMutex.Unlock()
+
+		// the database releases its files even if closing fails, so it's removed in any case
+		d.databases.Remove(key)
+		ObserverOrNop(d.options.observer).OnEvict(EvictEvent{Path: path, Err: err})
+
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// scheduleReap runs reapIdle after half of the idle timeout, so an idle database is closed at the
+// latest one and a half idle timeouts after its last use.
+func (d *Deck[B, S, F]) scheduleReap() {
+	d.reapTimer = d.clock.AfterFunc(d.options.idleTimeout/2, d.reapIdle)
+}
+
+// reapIdle closes and removes the databases that haven't been used for the idle timeout. Databases
+// that are in use or pinned are skipped like in evict.
+func (d *Deck[B, S, F]) reapIdle() {
+	d.databasesMutex.Lock()
+	defer d.databasesMutex.Unlock()
+
+	if d.closed {
+		return
+	}
+	defer d.scheduleReap()
+
+	now := d.clock.Now()
+	for _, key := range d.databases.Keys() {
+		path := key.(string)
+		if d.pins[path] > 0 {
+			continue
+		}
+		value, ok := d.databases.Peek(key)
+		if !ok {
+			continue
+		}
+		victim := value.(*entry[B, S])
+		idle := now.Sub(victim.lastUsed())
+		if idle < d.options.idleTimeout {
+			continue
+		}
+		if !victim.dbMutex.TryLock() {
+			continue
+		}
+		if d.options.evictFunc != nil {
+			d.options.evictFunc(path)
+		}
+		err := victim.db.Close()
+		victim.dbMutex.Unlock()
+
+		d.databases.Remove(key)
+		ObserverOrNop(d.options.observer).OnEvict(EvictEvent{Path: path, Idle: idle, Err: err})
+	}
+}
+
 type entry[B tapedb.Base, S tapedb.State] struct {
-	db      *Database[B, S]
-	dbMutex sync.Mutex
+	db        *Database[B, S]
+	dbMutex   sync.RWMutex
+	usedNanos atomic.Int64
+}
+
+func (e *entry[B, S]) touch(clock tapedb.Clock) {
+	e.usedNanos.Store(clock.Now().UnixNano())
+}
+
+func (e *entry[B, S]) lastUsed() time.Time {
+	return time.Unix(0, e.usedNanos.Load())
 }
 
 func deriveKey(opts []OpenOption, meta Meta) ([]byte, error) {
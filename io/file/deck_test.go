@@ -15,7 +15,10 @@
 package file_test
 
 import (
+	"bytes"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -78,7 +81,8 @@ func TestDeck(t *testing.T) {
 
 		meta, err := deck.Meta(path)
 		require.NoError(t, err)
-		assert.Equal(t, file.Meta{"Test": []string{"Value"}}, meta)
+		assert.Equal(t, "Value", meta.Get("Test"))
+		assert.True(t, meta.Has(file.MetaFieldCreated))
 	})
 
 	t.Run("LogLen", func(t *testing.T) {
@@ -131,6 +135,68 @@ func TestDeck(t *testing.T) {
 		assert.ErrorIs(t, err, file.ErrInvalidKey)
 	})
 
+	t.Run("WithOpenNested", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		testFactory := test.NewFactory()
+		deck, err := file.NewDeck[*test.Base, *test.State, *test.Factory](1)
+		require.NoError(t, err)
+		defer deck.Close()
+
+		pathA, pathB, pathC := filepath.Join(path, "a"), filepath.Join(path, "b"), filepath.Join(path, "c")
+		require.NoError(t, deck.Create(testFactory, pathA))
+		require.NoError(t, deck.Create(testFactory, pathB))
+		require.NoError(t, deck.Create(testFactory, pathC))
+
+		// a is in use while b is opened, so it can't be evicted
+		require.NoError(t, deck.WithOpen(testFactory, pathA, nil, func(dbA *file.Database[*test.Base, *test.State]) error {
+			return deck.WithOpen(testFactory, pathB, nil, func(dbB *file.Database[*test.Base, *test.State]) error {
+				assert.Equal(t, 2, deck.Len())
+				require.NoError(t, dbB.Apply(&test.ChangeCounterInc{Value: 1}))
+				return dbA.Apply(&test.ChangeCounterInc{Value: 1})
+			})
+		}))
+
+		require.NoError(t, deck.WithOpenRead(testFactory, pathC, nil, func(*file.ReadOnlyDatabase[*test.Base, *test.State]) error {
+			return nil
+		}))
+		assert.Equal(t, 1, deck.Len())
+
+		require.NoError(t, deck.WithOpenRead(testFactory, pathA, nil, func(db *file.ReadOnlyDatabase[*test.Base, *test.State]) error {
+			assert.Equal(t, 1, db.State().Counter)
+			return nil
+		}))
+	})
+
+	t.Run("WithOpenRead", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		deck, err := file.NewDeck[*test.Base, *test.State, *test.Factory](2)
+		require.NoError(t, err)
+		defer deck.Close()
+
+		testFactory := test.NewFactory()
+
+		require.NoError(t, deck.Create(testFactory, path))
+		require.NoError(t, deck.WithOpen(testFactory, path, []file.OpenOption{}, func(db *file.Database[*test.Base, *test.State]) error {
+			return db.Apply(&test.ChangeCounterInc{Value: 12})
+		}))
+
+		db, unlockFn, err := deck.OpenRead(testFactory, path, []file.OpenOption{})
+		require.NoError(t, err)
+		defer unlockFn()
+
+		counter := 0
+		require.NoError(t, deck.WithOpenRead(testFactory, path, []file.OpenOption{}, func(db *file.ReadOnlyDatabase[*test.Base, *test.State]) error {
+			counter = db.State().Counter
+			return nil
+		}))
+		assert.Equal(t, 12, counter)
+		assert.Equal(t, 12, db.State().Counter)
+	})
+
 	t.Run("Splice", func(t *testing.T) {
 		path, removeDir := makeTempDir(t)
 		defer removeDir()
@@ -149,8 +215,9 @@ func TestDeck(t *testing.T) {
 			return db.Apply(&test.ChangeCounterInc{Value: 21})
 		}))
 
-		require.NoError(t,
-			deck.Splice(testFactory, path, file.WithSourceKey(testKey), file.WithRebaseChangeCount(1)))
+		result, err := deck.Splice(testFactory, path, file.WithSourceKey(testKey), file.WithRebaseChangeCount(1))
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.EntriesRebased)
 
 		logLen := 0
 		require.NoError(t, deck.WithOpen(testFactory, path, []file.OpenOption{}, func(db *file.Database[*test.Base, *test.State]) error {
@@ -159,4 +226,173 @@ func TestDeck(t *testing.T) {
 		}))
 		assert.Equal(t, 0, logLen)
 	})
+	t.Run("SpliceOnline", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		deck, err := file.NewDeck[*test.Base, *test.State, *test.Factory](2)
+		require.NoError(t, err)
+		defer deck.Close()
+
+		testFactory := test.NewFactory()
+		openOpts := []file.OpenOption{file.WithOpenKey(testKey)}
+
+		require.NoError(t, deck.Create(testFactory, path, file.WithCreateKey(testKey)))
+		opened := (*file.Database[*test.Base, *test.State])(nil)
+		require.NoError(t, deck.WithOpen(testFactory, path, openOpts, func(db *file.Database[*test.Base, *test.State]) error {
+			opened = db
+			return db.Apply(&test.ChangeCounterInc{Value: 21})
+		}))
+
+		result, err := deck.SpliceOnline(testFactory, path, file.WithRebaseChangeCount(1))
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.EntriesRebased)
+		assert.False(t, deck.Pinned(path))
+
+		require.NoError(t, deck.WithOpen(testFactory, path, openOpts, func(db *file.Database[*test.Base, *test.State]) error {
+			assert.Same(t, opened, db)
+			assert.Equal(t, 0, db.LogLen())
+			assert.Equal(t, 21, db.Base().Value)
+			return db.Apply(&test.ChangeCounterInc{Value: 1})
+		}))
+	})
+
+	t.Run("Observer", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		metrics := file.NewMetrics()
+		deck, err := file.NewDeck[*test.Base, *test.State, *test.Factory](1, file.WithDeckObserver(metrics))
+		require.NoError(t, err)
+		defer deck.Close()
+
+		testFactory := test.NewFactory()
+
+		require.NoError(t, deck.Create(testFactory, filepath.Join(path, "a")))
+		for i := 0; i < 2; i++ {
+			require.NoError(t, deck.WithOpen(testFactory, filepath.Join(path, "a"), nil, func(db *file.Database[*test.Base, *test.State]) error {
+				return db.Apply(&test.ChangeCounterInc{Value: 1})
+			}))
+		}
+		require.NoError(t, deck.Create(testFactory, filepath.Join(path, "b")))
+		_, err = deck.Splice(testFactory, filepath.Join(path, "b"))
+		require.NoError(t, err)
+
+		snapshot := metrics.Snapshot()
+		assert.Equal(t, int64(2), snapshot.Opens)
+		assert.Equal(t, int64(2), snapshot.OpenHits)
+		assert.Equal(t, 1.0, snapshot.HitRate())
+		assert.Equal(t, int64(2), snapshot.Applies)
+		assert.Equal(t, int64(1), snapshot.Splices)
+		assert.Equal(t, int64(1), snapshot.Evictions)
+
+		buffer := bytes.Buffer{}
+		require.NoError(t, metrics.WritePrometheus(&buffer))
+		assert.Contains(t, buffer.String(), "# TYPE tapedb_applies_total counter\ntapedb_applies_total 2\n")
+	})
+	t.Run("IdleTimeout", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		clock := test.NewClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+		metrics := file.NewMetrics()
+		deck, err := file.NewDeck[*test.Base, *test.State, *test.Factory](10,
+			file.WithDeckIdleTimeout(time.Minute), file.WithDeckClock(clock), file.WithDeckObserver(metrics))
+		require.NoError(t, err)
+		defer deck.Close()
+
+		testFactory := test.NewFactory()
+
+		require.NoError(t, deck.Create(testFactory, filepath.Join(path, "a")))
+		require.NoError(t, deck.Create(testFactory, filepath.Join(path, "b")))
+
+		clock.Add(30 * time.Second)
+		assert.Equal(t, 2, deck.Len())
+
+		require.NoError(t, deck.WithOpenRead(testFactory, filepath.Join(path, "a"), nil, func(*file.ReadOnlyDatabase[*test.Base, *test.State]) error {
+			return nil
+		}))
+
+		clock.Add(30 * time.Second)
+		assert.Equal(t, 1, deck.Len())
+
+		// a database that is in use isn't closed
+		_, releaseFn, err := deck.Open(testFactory, filepath.Join(path, "a"), nil)
+		require.NoError(t, err)
+		clock.Add(time.Minute)
+		assert.Equal(t, 1, deck.Len())
+		releaseFn()
+
+		clock.Add(30 * time.Second)
+		assert.Equal(t, 1, deck.Len())
+		clock.Add(30 * time.Second)
+		assert.Equal(t, 0, deck.Len())
+
+		snapshot := metrics.Snapshot()
+		assert.Equal(t, int64(2), snapshot.Evictions)
+		assert.Equal(t, int64(2), snapshot.Reaps)
+		assert.Equal(t, 2*time.Minute, snapshot.ReapIdle)
+	})
+	t.Run("Pin", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		evicted := []string{}
+		deck, err := file.NewDeck[*test.Base, *test.State, *test.Factory](1, file.WithDeckEvictFunc(func(path string) {
+			evicted = append(evicted, filepath.Base(path))
+		}))
+		require.NoError(t, err)
+		defer deck.Close()
+
+		testFactory := test.NewFactory()
+
+		deck.Pin(filepath.Join(path, "a"))
+		assert.True(t, deck.Pinned(filepath.Join(path, "a")))
+		require.NoError(t, deck.Create(testFactory, filepath.Join(path, "a")))
+		require.NoError(t, deck.Create(testFactory, filepath.Join(path, "b")))
+		assert.Equal(t, 2, deck.Len())
+		assert.Empty(t, evicted)
+
+		deck.Unpin(filepath.Join(path, "a"))
+		assert.False(t, deck.Pinned(filepath.Join(path, "a")))
+		require.NoError(t, deck.Create(testFactory, filepath.Join(path, "c")))
+		assert.Equal(t, 1, deck.Len())
+		assert.Equal(t, []string{"a", "b"}, evicted)
+	})
+	t.Run("OpenOrCreate", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		deck, err := file.NewDeck[*test.Base, *test.State, *test.Factory](1)
+		require.NoError(t, err)
+		defer deck.Close()
+
+		testFactory := test.NewFactory()
+		dbPath := filepath.Join(path, "a")
+
+		exists, err := deck.Exists(dbPath)
+		require.NoError(t, err)
+		assert.False(t, exists)
+
+		createOpts := []file.CreateOption{file.WithCreateKey(testKey)}
+		openOpts := []file.OpenOption{file.WithOpenKey(testKey)}
+		for i := 0; i < 2; i++ {
+			require.NoError(t, deck.WithOpenOrCreate(testFactory, dbPath, createOpts, openOpts, func(db *file.Database[*test.Base, *test.State]) error {
+				return db.Apply(&test.ChangeCounterInc{Value: 1})
+			}))
+		}
+
+		exists, err = deck.Exists(dbPath)
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		require.NoError(t, deck.Create(testFactory, filepath.Join(path, "b")))
+		require.NoError(t, deck.WithOpenOrCreate(testFactory, dbPath, createOpts, openOpts, func(db *file.Database[*test.Base, *test.State]) error {
+			assert.Equal(t, 2, db.State().Counter)
+			return nil
+		}))
+
+		_, _, err = deck.Open(testFactory, filepath.Join(path, "c"), nil)
+		assert.ErrorIs(t, err, file.ErrMissing)
+	})
 }
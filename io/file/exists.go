@@ -0,0 +1,87 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Exists returns true if the directory at the provided path holds a database.
+//
+// A database exists as soon as its base, its log or the journal of an interrupted splice exists. Any of the other files may be missing:
+// a missing meta is read as an empty meta, a missing base as the base returned by the factory, a
+// missing log as a log without entries and a missing payload as ErrPayloadMissing. Functions that
+// take the path of a database only fail with ErrMissing if the database doesn't exist at all.
+func Exists(path string) (bool, error) {
+	return DefaultLayout.exists(path)
+}
+
+func (l Layout) exists(path string) (bool, error) {
+	for _, name := range []string{l.Base, l.Log, l.Journal} {
+		_, err := os.Stat(filepath.Join(path, name))
+		if err == nil {
+			return true, nil
+		}
+		if !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// ReadDatabaseMeta returns the meta of the database at the provided path. If the database has no
+// meta file, an empty meta is returned.
+func ReadDatabaseMeta(path string) (Meta, error) {
+	return DefaultLayout.readDatabaseMeta(path)
+}
+
+func (l Layout) readDatabaseMeta(path string) (Meta, error) {
+	if err := l.mustExist(path); err != nil {
+		return nil, err
+	}
+	return l.readMetaFileOrEmpty(path)
+}
+
+func readMetaFileOrEmpty(path string) (Meta, error) {
+	return DefaultLayout.readMetaFileOrEmpty(path)
+}
+
+func (l Layout) readMetaFileOrEmpty(path string) (Meta, error) {
+	meta, err := ReadMetaFile(l.MetaPath(path))
+	if os.IsNotExist(err) {
+		return Meta{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read meta: %w", err)
+	}
+	return meta, nil
+}
+
+func mustExist(path string) error {
+	return DefaultLayout.mustExist(path)
+}
+
+func (l Layout) mustExist(path string) error {
+	exists, err := l.exists(path)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrMissing
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2"
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestEmptyDatabase(t *testing.T) {
+	t.Run("Missing", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		exists, err := file.Exists(path)
+		require.NoError(t, err)
+		assert.False(t, exists)
+
+		_, err = file.ReadDatabaseMeta(path)
+		assert.ErrorIs(t, err, file.ErrMissing)
+
+		_, err = file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path)
+		assert.ErrorIs(t, err, file.ErrMissing)
+
+		err = file.ReadChanges[*test.Base, *test.State](test.NewFactory(), path, nil, func(int, tapedb.Change) error { return nil })
+		assert.ErrorIs(t, err, file.ErrMissing)
+
+		assert.ErrorIs(t, file.VerifyDatabase(path), file.ErrMissing)
+
+		deck, err := file.NewDeck[*test.Base, *test.State, *test.Factory](2)
+		require.NoError(t, err)
+		defer deck.Close()
+
+		_, err = deck.Meta(path)
+		assert.ErrorIs(t, err, file.ErrMissing)
+
+		_, err = deck.LogLen(path)
+		assert.ErrorIs(t, err, file.ErrMissing)
+	})
+
+	t.Run("LogOnly", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path)
+		require.NoError(t, err)
+		require.NoError(t, db.Close())
+		require.NoError(t, os.Remove(filepath.Join(path, file.FileNameMeta)))
+
+		exists, err := file.Exists(path)
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		meta, err := file.ReadDatabaseMeta(path)
+		require.NoError(t, err)
+		assert.Empty(t, meta)
+
+		_, err = db.OpenPayload("123")
+		assert.ErrorIs(t, err, file.ErrPayloadMissing)
+
+		assert.NoError(t, file.VerifyDatabase(path))
+
+		deck, err := file.NewDeck[*test.Base, *test.State, *test.Factory](2)
+		require.NoError(t, err)
+		defer deck.Close()
+
+		meta, err = deck.Meta(path)
+		require.NoError(t, err)
+		assert.Empty(t, meta)
+
+		logLen, err := deck.LogLen(path)
+		require.NoError(t, err)
+		assert.Equal(t, 0, logLen)
+	})
+
+	t.Run("BaseOnly", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		makeFile(t, filepath.Join(path, file.FileNameBase), `{"value":21}`)
+
+		exists, err := file.Exists(path)
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		db, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithReadOnly())
+		require.NoError(t, err)
+		assert.Equal(t, 0, db.LogLen())
+		assert.Equal(t, 21, db.State().Counter)
+		require.NoError(t, db.Close())
+
+		db, err = file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path)
+		require.NoError(t, err)
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+		require.NoError(t, db.Close())
+
+		logLen, err := file.ReadLogLen(filepath.Join(path, file.FileNameLog))
+		require.NoError(t, err)
+		assert.Equal(t, 1, logLen)
+	})
+}
@@ -0,0 +1,31 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build unix
+
+package file
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// fileIdentity returns the device and inode of the file.
+func fileIdentity(stat os.FileInfo) string {
+	if sys, ok := stat.Sys().(*syscall.Stat_t); ok {
+		return fmt.Sprintf("%d-%d", uint64(sys.Dev), uint64(sys.Ino))
+	}
+	return ""
+}
@@ -0,0 +1,57 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	tapedb "github.com/simia-tech/tapedb/v2"
+)
+
+// Handle binds the type parameters of a model to its factory, so they don't have to be repeated
+// for each call.
+type Handle[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+] struct {
+	f F
+}
+
+func New[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](f F) *Handle[B, S, F] {
+	return &Handle[B, S, F]{f: f}
+}
+
+func (h *Handle[B, S, F]) Factory() F {
+	return h.f
+}
+
+func (h *Handle[B, S, F]) CreateFile(path string, opts ...CreateOption) (*Database[B, S], error) {
+	return CreateDatabase[B, S](h.f, path, opts...)
+}
+
+func (h *Handle[B, S, F]) OpenFile(path string, opts ...OpenOption) (*Database[B, S], error) {
+	return OpenDatabase[B, S](h.f, path, opts...)
+}
+
+func (h *Handle[B, S, F]) Splice(path string, opts ...SpliceOption) (SpliceResult, error) {
+	return SpliceDatabase[B, S](h.f, path, opts...)
+}
+
+func (h *Handle[B, S, F]) NewDeck(openDatabaseLimit int, opts ...DeckOption) (*Deck[B, S, F], error) {
+	return NewDeck[B, S, F](openDatabaseLimit, opts...)
+}
@@ -0,0 +1,49 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestHandle(t *testing.T) {
+	path, removeDir := makeTempDir(t)
+	defer removeDir()
+
+	h := file.New[*test.Base, *test.State](test.NewFactory())
+
+	db, err := h.CreateFile(path)
+	require.NoError(t, err)
+	require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 2}))
+	require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 3}))
+	require.NoError(t, db.Close())
+
+	result, err := h.Splice(path, file.WithRebaseChangeCount(1))
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.EntriesRebased)
+
+	db, err = h.OpenFile(path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	assert.Equal(t, 2, db.Base().Value)
+	assert.Equal(t, 5, db.State().Counter)
+}
@@ -0,0 +1,180 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+
+	tapeio "github.com/simia-tech/tapedb/v2/io"
+	"github.com/simia-tech/tapedb/v2/io/crypto"
+)
+
+// inlinePayloads holds the payloads that are stored in the log entries of the changes that
+// reference them.
+type inlinePayloads map[string][]byte
+
+func (ip inlinePayloads) add(payloads []tapeio.InlinePayload) {
+	for _, payload := range payloads {
+		ip[payload.ID] = payload.Data
+	}
+}
+
+func (ip inlinePayloads) addFunc() func(int, []tapeio.InlinePayload) error {
+	return func(_ int, payloads []tapeio.InlinePayload) error {
+		ip.add(payloads)
+		return nil
+	}
+}
+
+func (db *Database[B, S]) inlinePayload(id string) ([]byte, bool) {
+	db.inlineMutex.RLock()
+	defer db.inlineMutex.RUnlock()
+	data, ok := db.inlinePayloads[id]
+	return data, ok
+}
+
+// splitInlinePayloads reads the payloads that don't exceed the inline size of the database and
+// returns them separately. Payloads with a meta are always stored in a file, so their meta can be
+// stored next to them.
+func (db *Database[B, S]) splitInlinePayloads(payloads []Payload) ([]tapeio.InlinePayload, []Payload, error) {
+	if db.inlineSize <= 0 {
+		return nil, payloads, nil
+	}
+
+	inline, files := []tapeio.InlinePayload{}, []Payload{}
+	for _, payload := range payloads {
+		if payload.hasMeta {
+			files = append(files, payload)
+			continue
+		}
+
+		data, err := io.ReadAll(io.LimitReader(payload.r, db.inlineSize+1))
+		if err != nil {
+			return nil, nil, fmt.Errorf("read payload with id %s: %w", payload.id, err)
+		}
+		if int64(len(data)) > db.inlineSize {
+			payload.r = io.MultiReader(bytes.NewReader(data), payload.r)
+			files = append(files, payload)
+			continue
+		}
+
+		pw := newPayloadWriter(io.Discard, payload, db.maxPayloadSize)
+		if _, err := pw.Write(data); err != nil {
+			return nil, nil, fmt.Errorf("write payload with id %s: %w", payload.id, err)
+		}
+		if err := pw.verify(); err != nil {
+			return nil, nil, fmt.Errorf("write payload with id %s: %w", payload.id, err)
+		}
+
+		if _, ok := db.inlinePayload(payload.id); ok {
+			return nil, nil, fmt.Errorf("create payload with id %s: %w", payload.id, ErrPayloadIDAlreadyExists)
+		}
+		if exists, err := db.layout.payloadExists(db.path, payload.id); err != nil {
+			return nil, nil, err
+		} else if exists {
+			return nil, nil, fmt.Errorf("create payload with id %s: %w", payload.id, ErrPayloadIDAlreadyExists)
+		}
+
+		inline = append(inline, tapeio.InlinePayload{ID: payload.id, Data: data})
+	}
+
+	return inline, files, nil
+}
+
+// writeInlinePayloadFile stores an inline payload in the file at the provided path. It's used for
+// the inline payloads of changes that are rebased, since their log entries are gone after the
+// splice. Existing files are kept.
+func writeInlinePayloadFile(payloadPath string, payload tapeio.InlinePayload, fileMode os.FileMode, c crypto.Cipher, key []byte) error {
+	f, err := os.OpenFile(payloadPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, fileMode)
+	if err != nil {
+		if os.IsExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	if err := writeBlocks(f, payload.Data, c, key); err != nil {
+		f.Close()
+		os.Remove(payloadPath)
+		return err
+	}
+	return f.Close()
+}
+
+func writeBlocks(w io.Writer, data []byte, c crypto.Cipher, key []byte) error {
+	if len(key) == 0 {
+		_, err := w.Write(data)
+		return err
+	}
+
+	bw, err := crypto.NewBlockWriterWithCipher(w, c, key, NonceFn)
+	if err != nil {
+		return fmt.Errorf("new block writer: %w", err)
+	}
+	if _, err := bw.Write(data); err != nil {
+		return err
+	}
+	return bw.Close()
+}
+
+type inlineFileInfo struct {
+	name string
+	size int64
+}
+
+var _ fs.FileInfo = inlineFileInfo{}
+
+func (fi inlineFileInfo) Name() string {
+	return fi.name
+}
+
+func (fi inlineFileInfo) Size() int64 {
+	return fi.size
+}
+
+func (fi inlineFileInfo) Mode() fs.FileMode {
+	return 0
+}
+
+func (fi inlineFileInfo) ModTime() time.Time {
+	return time.Time{}
+}
+
+func (fi inlineFileInfo) IsDir() bool {
+	return false
+}
+
+func (fi inlineFileInfo) Sys() any {
+	return nil
+}
+
+func inlinePayloadInfo(id string, data []byte) PayloadInfo {
+	sum := sha256.Sum256(data)
+	return PayloadInfo{PayloadMeta: PayloadMeta{SHA256: sum[:]}, ID: id, Size: int64(len(data))}
+}
+
+type nopReadSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopReadSeekCloser) Close() error {
+	return nil
+}
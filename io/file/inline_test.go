@@ -0,0 +1,147 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2"
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestInlinePayloads(t *testing.T) {
+	setupFn := func(t *testing.T, opts ...file.CreateOption) (string, func()) {
+		path, removeDir := makeTempDir(t)
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			append(opts, file.WithInlinePayloadSize(16))...)
+		require.NoError(t, err)
+		require.NoError(t, db.Apply(
+			&test.ChangeAttachPayload{PayloadID: "small"},
+			file.NewPayload("small", strings.NewReader("tiny content"))))
+		require.NoError(t, db.Apply(
+			&test.ChangeAttachPayload{PayloadID: "large"},
+			file.NewPayload("large", strings.NewReader("content that exceeds the inline size"))))
+		require.NoError(t, db.Close())
+
+		return path, removeDir
+	}
+
+	openFn := func(t *testing.T, path string, opts ...file.OpenOption) *file.Database[*test.Base, *test.State] {
+		db, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path, opts...)
+		require.NoError(t, err)
+		return db
+	}
+
+	readPayloadFn := func(t *testing.T, db *file.Database[*test.Base, *test.State], id string) string {
+		r, err := db.OpenPayload(id)
+		require.NoError(t, err)
+		defer r.Close()
+		data, err := io.ReadAll(r)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	t.Run("Apply", func(t *testing.T) {
+		path, removeDir := setupFn(t)
+		defer removeDir()
+
+		assert.NoFileExists(t, filepath.Join(path, file.FilePrefixPayload+"small"))
+		assert.FileExists(t, filepath.Join(path, file.FilePrefixPayload+"large"))
+
+		db := openFn(t, path)
+		defer db.Close()
+
+		assert.Equal(t, "tiny content", readPayloadFn(t, db, "small"))
+		assert.Equal(t, "content that exceeds the inline size", readPayloadFn(t, db, "large"))
+
+		stat, err := db.StatPayload("small")
+		require.NoError(t, err)
+		assert.Equal(t, int64(12), stat.Size())
+
+		info, err := db.PayloadInfo("small")
+		require.NoError(t, err)
+		assert.Equal(t, int64(12), info.Size)
+
+		err = db.DeletePayload("small")
+		assert.ErrorIs(t, err, file.ErrPayloadInline)
+		assert.Equal(t, tapedb.ErrorCodeConflict, tapedb.ErrorCodeOf(err))
+	})
+
+	t.Run("ApplyExisting", func(t *testing.T) {
+		path, removeDir := setupFn(t)
+		defer removeDir()
+
+		db := openFn(t, path)
+		defer db.Close()
+
+		err := db.Apply(
+			&test.ChangeAttachPayload{PayloadID: "small"},
+			file.NewPayload("small", strings.NewReader("other")))
+		assert.ErrorIs(t, err, file.ErrPayloadIDAlreadyExists)
+	})
+
+	t.Run("ReferenceInline", func(t *testing.T) {
+		path, removeDir := setupFn(t)
+		defer removeDir()
+
+		db := openFn(t, path)
+		defer db.Close()
+
+		require.NoError(t, db.Apply(&test.ChangeAttachPayload{PayloadID: "small"}))
+	})
+
+	t.Run("SpliceCopy", func(t *testing.T) {
+		path, removeDir := setupFn(t)
+		defer removeDir()
+
+		_, err := file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path)
+		require.NoError(t, err)
+
+		assert.NoFileExists(t, filepath.Join(path, file.FilePrefixPayload+"small"))
+
+		db := openFn(t, path)
+		defer db.Close()
+
+		assert.Equal(t, "tiny content", readPayloadFn(t, db, "small"))
+	})
+
+	t.Run("SpliceRebase", func(t *testing.T) {
+		path, removeDir := setupFn(t, file.WithCreateKey(testKey))
+		defer removeDir()
+
+		_, err := file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithSourceKey(testKey), file.WithTargetKey(testKey), file.WithRebaseChangeCount(2))
+		require.NoError(t, err)
+
+		data, err := os.ReadFile(filepath.Join(path, file.FilePrefixPayload+"small"))
+		require.NoError(t, err)
+		assert.NotContains(t, string(data), "tiny content")
+
+		db := openFn(t, path, file.WithOpenKey(testKey))
+		defer db.Close()
+
+		assert.Equal(t, 0, db.LogLen())
+		assert.Equal(t, "tiny content", readPayloadFn(t, db, "small"))
+	})
+}
@@ -22,7 +22,9 @@ import (
 
 const (
 	MetaHeaderCryptSettings = "Crypt-Settings"
+	MetaHeaderCipher        = "Cipher"
 
+	// DefaultCryptSettings are the encoded CryptSettings{Memory: 65536, Time: 2, Parallelism: 4}.
 	DefaultCryptSettings = "$argon2id$v=19$m=65536,t=2,p=4$"
 )
 
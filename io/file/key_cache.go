@@ -0,0 +1,195 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	tapedb "github.com/simia-tech/tapedb/v2"
+)
+
+// KeyCache holds password-derived keys for a limited time, so the expensive key derivation doesn't
+// have to be repeated on each open. The entries are indexed by a keyed hash of the password and
+// the crypt settings. Keys of providers like a keyring or a KMS can be cached as well. Expired and
+// purged keys are overwritten in memory.
+type KeyCache struct {
+	ttl     time.Duration
+	clock   tapedb.Clock
+	secret  []byte
+	entries map[string]*keyCacheEntry
+	mutex   sync.Mutex
+}
+
+type keyCacheEntry struct {
+	key     []byte
+	expires time.Time
+}
+
+type KeyCacheOption func(*KeyCache)
+
+func WithKeyCacheClock(value tapedb.Clock) KeyCacheOption {
+	return func(c *KeyCache) {
+		c.clock = value
+	}
+}
+
+func NewKeyCache(ttl time.Duration, opts ...KeyCacheOption) (*KeyCache, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	c := &KeyCache{
+		ttl:     ttl,
+		secret:  secret,
+		entries: map[string]*keyCacheEntry{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.clock = tapedb.ClockOrSystem(c.clock)
+	return c, nil
+}
+
+// DeriveKeyFrom works like the package function DeriveKeyFrom, but looks up the derived key in the
+// cache first.
+func (c *KeyCache) DeriveKeyFrom(password, defaultCryptSettings string) KeyFunc {
+	deriveFn := DeriveKeyFrom(password, defaultCryptSettings)
+	return func(meta Meta) ([]byte, error) {
+		if password == "" {
+			return nil, nil
+		}
+
+		if cs := meta.Get(MetaHeaderCryptSettings); cs != "" {
+			if key, ok := c.get(c.id(keyCacheKindPassword, password, cs)); ok {
+				return key, nil
+			}
+		}
+
+		key, err := deriveFn(meta)
+		if err != nil {
+			return nil, err
+		}
+		c.add(c.id(keyCacheKindPassword, password, meta.Get(MetaHeaderCryptSettings)), key)
+
+		return key, nil
+	}
+}
+
+// Cached returns a key func that looks up the key in the cache before it calls the provided one.
+// The keys are indexed by the Key-Id and Wrapped-Key fields of the meta, so a key func like
+// KeyFromKeyring or KeyFromKMS has to store its key ID there. Without a key ID, the key isn't
+// cached.
+func (c *KeyCache) Cached(keyFn KeyFunc) KeyFunc {
+	return func(meta Meta) ([]byte, error) {
+		if keyID := meta.Get(MetaFieldKeyID); keyID != "" {
+			if key, ok := c.get(c.id(keyCacheKindProvider, keyID, meta.Get(MetaFieldWrappedKey))); ok {
+				return key, nil
+			}
+		}
+
+		key, err := keyFn(meta)
+		if err != nil {
+			return nil, err
+		}
+		if keyID := meta.Get(MetaFieldKeyID); keyID != "" {
+			c.add(c.id(keyCacheKindProvider, keyID, meta.Get(MetaFieldWrappedKey)), key)
+		}
+
+		return key, nil
+	}
+}
+
+func (c *KeyCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.removeExpired(c.clock.Now())
+	return len(c.entries)
+}
+
+// Purge removes all keys from the cache.
+func (c *KeyCache) Purge() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for id, entry := range c.entries {
+		wipe(entry.key)
+		delete(c.entries, id)
+	}
+}
+
+const (
+	keyCacheKindPassword byte = iota
+	keyCacheKindProvider
+)
+
+func (c *KeyCache) id(kind byte, values ...string) string {
+	h := hmac.New(sha256.New, c.secret)
+	h.Write([]byte{kind})
+	for _, value := range values {
+		h.Write([]byte(value))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *KeyCache) get(id string) ([]byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.removeExpired(c.clock.Now())
+
+	entry, ok := c.entries[id]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte{}, entry.key...), true
+}
+
+func (c *KeyCache) add(id string, key []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.clock.Now()
+	c.removeExpired(now)
+
+	if entry, ok := c.entries[id]; ok {
+		wipe(entry.key)
+	}
+	c.entries[id] = &keyCacheEntry{
+		key:     append([]byte{}, key...),
+		expires: now.Add(c.ttl),
+	}
+}
+
+func (c *KeyCache) removeExpired(now time.Time) {
+	for id, entry := range c.entries {
+		if now.After(entry.expires) {
+			wipe(entry.key)
+			delete(c.entries, id)
+		}
+	}
+}
+
+func wipe(b []byte) {
+	for index := range b {
+		b[index] = 0
+	}
+}
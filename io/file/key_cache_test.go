@@ -0,0 +1,84 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+const testCryptSettings = "$argon2id$v=19$m=1024,t=1,p=1$"
+
+func TestKeyCache(t *testing.T) {
+	t.Run("Deck", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		cache, err := file.NewKeyCache(time.Minute)
+		require.NoError(t, err)
+
+		deck, err := file.NewDeck[*test.Base, *test.State, *test.Factory](2)
+		require.NoError(t, err)
+		defer deck.Close()
+
+		require.NoError(t, deck.Create(test.NewFactory(), path,
+			file.WithCreateKeyFunc(cache.DeriveKeyFrom("secret", testCryptSettings))))
+		assert.Equal(t, 1, cache.Len())
+
+		opts := []file.OpenOption{file.WithOpenKeyFunc(cache.DeriveKeyFrom("secret", testCryptSettings))}
+		for index := 0; index < 2; index++ {
+			require.NoError(t, deck.WithOpen(test.NewFactory(), path, opts, func(db *file.Database[*test.Base, *test.State]) error {
+				return db.Apply(&test.ChangeCounterInc{Value: 1})
+			}))
+		}
+		assert.Equal(t, 1, cache.Len())
+
+		err = deck.WithOpen(test.NewFactory(), path,
+			[]file.OpenOption{file.WithOpenKeyFunc(cache.DeriveKeyFrom("wrong", testCryptSettings))},
+			func(db *file.Database[*test.Base, *test.State]) error {
+				return nil
+			})
+		assert.ErrorIs(t, err, file.ErrInvalidKey)
+		assert.Equal(t, 2, cache.Len())
+
+		cache.Purge()
+		assert.Equal(t, 0, cache.Len())
+	})
+
+	t.Run("Expire", func(t *testing.T) {
+		clock := test.NewClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+		cache, err := file.NewKeyCache(time.Minute, file.WithKeyCacheClock(clock))
+		require.NoError(t, err)
+
+		meta := file.Meta{}
+		keyFn := cache.DeriveKeyFrom("secret", testCryptSettings)
+		key, err := keyFn(meta)
+		require.NoError(t, err)
+		assert.Equal(t, 1, cache.Len())
+
+		clock.Add(2 * time.Minute)
+		assert.Equal(t, 0, cache.Len())
+
+		derivedKey, err := keyFn(meta)
+		require.NoError(t, err)
+		assert.Equal(t, key, derivedKey)
+	})
+}
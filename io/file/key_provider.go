@@ -0,0 +1,134 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/simia-tech/tapedb/v2"
+)
+
+const (
+	// MetaFieldKeyID holds the ID of the key in a keyring or of the master key in a KMS.
+	MetaFieldKeyID = "Key-Id"
+	// MetaFieldWrappedKey holds the base64-encoded data key, that is encrypted by the KMS.
+	MetaFieldWrappedKey = "Wrapped-Key"
+)
+
+var ErrKeyNotFound = tapedb.NewError(tapedb.ErrorCodeInvalidKey, "key not found")
+
+// Keyring provides keys by their ID.
+type Keyring interface {
+	// Key returns the key with the provided ID or ErrKeyNotFound.
+	Key(id string) ([]byte, error)
+}
+
+// KMS is a key management service that encrypts data keys with a master key, which never leaves
+// the service.
+type KMS interface {
+	// GenerateDataKey returns a new data key in plain and encrypted by the master key with the
+	// provided ID.
+	GenerateDataKey(ctx context.Context, keyID string) ([]byte, []byte, error)
+	// Decrypt returns the plain data key of the provided wrapped one.
+	Decrypt(ctx context.Context, keyID string, wrappedKey []byte) ([]byte, error)
+}
+
+// KeyFromEnv returns a key func that reads the key from the environment variable with the provided
+// name. The key has to be hex or base64 encoded.
+func KeyFromEnv(name string) KeyFunc {
+	return func(_ Meta) ([]byte, error) {
+		value, ok := os.LookupEnv(name)
+		if !ok || value == "" {
+			return nil, fmt.Errorf("environment variable %s: %w", name, ErrKeyNotFound)
+		}
+		key, err := decodeKey(value)
+		if err != nil {
+			return nil, fmt.Errorf("environment variable %s: %w", name, err)
+		}
+		return key, nil
+	}
+}
+
+// KeyFromKeyring returns a key func that looks up the key in the provided keyring. The ID of the key
+// is taken from the meta. If the meta doesn't have one yet, the default ID is used and stored in the
+// meta, so the database keeps using its key, even if the default ID changes later.
+func KeyFromKeyring(keyring Keyring, defaultID string) KeyFunc {
+	return func(meta Meta) ([]byte, error) {
+		id := meta.Get(MetaFieldKeyID)
+		if id == "" {
+			id = defaultID
+		}
+
+		key, err := keyring.Key(id)
+		if err != nil {
+			return nil, fmt.Errorf("keyring key %s: %w", id, err)
+		}
+
+		meta.Set(MetaFieldKeyID, id)
+
+		return key, nil
+	}
+}
+
+// KeyFromKMS returns a key func that uses envelope encryption. The first call on a new database
+// generates a data key under the master key with the provided ID and stores it wrapped in the meta
+// together with the master key ID. Later calls let the KMS unwrap the stored data key, so the master
+// key ID from the meta takes precedence. The context is passed to each KMS request.
+func KeyFromKMS(ctx context.Context, kms KMS, keyID string) KeyFunc {
+	return func(meta Meta) ([]byte, error) {
+		if wrapped := meta.Get(MetaFieldWrappedKey); wrapped != "" {
+			wrappedKey, err := base64.StdEncoding.DecodeString(wrapped)
+			if err != nil {
+				return nil, fmt.Errorf("decode wrapped key: %w", err)
+			}
+			id := meta.Get(MetaFieldKeyID)
+			if id == "" {
+				id = keyID
+			}
+			key, err := kms.Decrypt(ctx, id, wrappedKey)
+			if err != nil {
+				return nil, fmt.Errorf("kms decrypt with key %s: %w", id, err)
+			}
+			return key, nil
+		}
+
+		key, wrappedKey, err := kms.GenerateDataKey(ctx, keyID)
+		if err != nil {
+			return nil, fmt.Errorf("kms generate data key with key %s: %w", keyID, err)
+		}
+
+		meta.Set(MetaFieldKeyID, keyID)
+		meta.Set(MetaFieldWrappedKey, base64.StdEncoding.EncodeToString(wrappedKey))
+
+		return key, nil
+	}
+}
+
+func decodeKey(value string) ([]byte, error) {
+	value = strings.TrimSpace(value)
+	if key, err := hex.DecodeString(value); err == nil {
+		return key, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("key is neither hex nor base64 encoded: %w", ErrInvalidKey)
+	}
+	return key, nil
+}
@@ -0,0 +1,163 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestKeyProvider(t *testing.T) {
+	createAndOpen := func(t *testing.T, createKeyFn, openKeyFn file.KeyFunc) (string, error) {
+		path, removeDir := makeTempDir(t)
+		t.Cleanup(removeDir)
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithCreateKeyFunc(createKeyFn))
+		require.NoError(t, err)
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 21}))
+		require.NoError(t, db.Close())
+
+		db, err = file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithOpenKeyFunc(openKeyFn))
+		if err != nil {
+			return path, err
+		}
+		defer db.Close()
+		assert.Equal(t, 21, db.State().Counter)
+		return path, nil
+	}
+
+	t.Run("Env", func(t *testing.T) {
+		t.Setenv("TAPEDB_TEST_KEY", hex.EncodeToString(testKey))
+		_, err := createAndOpen(t, file.KeyFromEnv("TAPEDB_TEST_KEY"), file.KeyFromEnv("TAPEDB_TEST_KEY"))
+		require.NoError(t, err)
+
+		t.Setenv("TAPEDB_TEST_KEY", base64.StdEncoding.EncodeToString(testKey))
+		key, err := file.KeyFromEnv("TAPEDB_TEST_KEY")(file.Meta{})
+		require.NoError(t, err)
+		assert.Equal(t, testKey, key)
+
+		t.Setenv("TAPEDB_TEST_KEY", "not a key")
+		_, err = file.KeyFromEnv("TAPEDB_TEST_KEY")(file.Meta{})
+		assert.ErrorIs(t, err, file.ErrInvalidKey)
+
+		_, err = file.KeyFromEnv("TAPEDB_TEST_MISSING_KEY")(file.Meta{})
+		assert.ErrorIs(t, err, file.ErrKeyNotFound)
+	})
+
+	t.Run("Keyring", func(t *testing.T) {
+		keyring := testKeyring{"one": testKey, "two": []byte("0123456789abcdef0123456789abcdef")}
+
+		path, err := createAndOpen(t, file.KeyFromKeyring(keyring, "one"), file.KeyFromKeyring(keyring, "two"))
+		require.NoError(t, err)
+
+		meta, err := file.ReadDatabaseMeta(path)
+		require.NoError(t, err)
+		assert.Equal(t, "one", meta.Get(file.MetaFieldKeyID))
+
+		_, err = file.KeyFromKeyring(keyring, "three")(file.Meta{})
+		assert.ErrorIs(t, err, file.ErrKeyNotFound)
+	})
+
+	t.Run("KMS", func(t *testing.T) {
+		kms := &testKMS{masterKeys: map[string][]byte{"master": testKey}}
+
+		path, err := createAndOpen(t, file.KeyFromKMS(context.Background(), kms, "master"),
+			file.KeyFromKMS(context.Background(), kms, "other"))
+		require.NoError(t, err)
+		assert.Equal(t, 1, kms.generated)
+		assert.Equal(t, 1, kms.decrypted)
+
+		meta, err := file.ReadDatabaseMeta(path)
+		require.NoError(t, err)
+		assert.Equal(t, "master", meta.Get(file.MetaFieldKeyID))
+		assert.NotEmpty(t, meta.Get(file.MetaFieldWrappedKey))
+
+		meta.Set(file.MetaFieldKeyID, "unknown")
+		_, err = file.KeyFromKMS(context.Background(), kms, "master")(meta)
+		assert.ErrorIs(t, err, file.ErrKeyNotFound)
+	})
+
+	t.Run("Cached", func(t *testing.T) {
+		cache, err := file.NewKeyCache(time.Minute)
+		require.NoError(t, err)
+		kms := &testKMS{masterKeys: map[string][]byte{"master": testKey}}
+		keyFn := cache.Cached(file.KeyFromKMS(context.Background(), kms, "master"))
+
+		path, err := createAndOpen(t, keyFn, keyFn)
+		require.NoError(t, err)
+		assert.Equal(t, 1, cache.Len())
+
+		db, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithOpenKeyFunc(keyFn))
+		require.NoError(t, err)
+		require.NoError(t, db.Close())
+
+		assert.Equal(t, 1, kms.generated)
+		assert.Equal(t, 0, kms.decrypted)
+
+		key, err := cache.Cached(file.KeyFromEnv("TAPEDB_TEST_MISSING_KEY"))(file.Meta{})
+		assert.ErrorIs(t, err, file.ErrKeyNotFound)
+		assert.Nil(t, key)
+	})
+}
+
+type testKeyring map[string][]byte
+
+func (k testKeyring) Key(id string) ([]byte, error) {
+	key, ok := k[id]
+	if !ok {
+		return nil, file.ErrKeyNotFound
+	}
+	return key, nil
+}
+
+// testKMS wraps the data keys by xor-ing them with the master key.
+type testKMS struct {
+	masterKeys map[string][]byte
+	generated  int
+	decrypted  int
+}
+
+func (k *testKMS) GenerateDataKey(_ context.Context, keyID string) ([]byte, []byte, error) {
+	k.generated++
+	key := []byte("data key of 32 bytes for testing")
+	wrappedKey, err := k.xor(keyID, key)
+	return key, wrappedKey, err
+}
+
+func (k *testKMS) Decrypt(_ context.Context, keyID string, wrappedKey []byte) ([]byte, error) {
+	k.decrypted++
+	return k.xor(keyID, wrappedKey)
+}
+
+func (k *testKMS) xor(keyID string, data []byte) ([]byte, error) {
+	masterKey, ok := k.masterKeys[keyID]
+	if !ok {
+		return nil, file.ErrKeyNotFound
+	}
+	result := make([]byte, len(data))
+	for index := range data {
+		result[index] = data[index] ^ masterKey[index%len(masterKey)]
+	}
+	return result, nil
+}
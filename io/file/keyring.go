@@ -0,0 +1,51 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// OSKeyring is a keyring that is backed by the keyring of the operating system. The keys are stored
+// hex encoded as generic passwords of the service, with the key ID as account. On macOS, the
+// keychain is accessed via the security tool, on other unix systems the secret service via
+// secret-tool.
+type OSKeyring struct {
+	service string
+}
+
+var _ Keyring = &OSKeyring{}
+
+func NewOSKeyring(service string) *OSKeyring {
+	return &OSKeyring{service: service}
+}
+
+func (k *OSKeyring) Key(id string) ([]byte, error) {
+	value, err := osKeyringLookup(k.service, id)
+	if err != nil {
+		return nil, err
+	}
+	key, err := decodeKey(value)
+	if err != nil {
+		return nil, fmt.Errorf("key %s of service %s: %w", id, k.service, err)
+	}
+	return key, nil
+}
+
+// SetKey stores the key with the provided ID. An existing key is replaced.
+func (k *OSKeyring) SetKey(id string, key []byte) error {
+	return osKeyringStore(k.service, id, hex.EncodeToString(key))
+}
@@ -0,0 +1,49 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// securityErrItemNotFound is the exit code of the security tool, if the keychain doesn't contain the item.
+const securityErrItemNotFound = 44
+
+func osKeyringLookup(service, id string) (string, error) {
+	stderr := bytes.Buffer{}
+	cmd := exec.Command("security", "find-generic-password", "-s", service, "-a", id, "-w")
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if exitErr := (*exec.ExitError)(nil); errors.As(err, &exitErr) && exitErr.ExitCode() == securityErrItemNotFound {
+		return "", ErrKeyNotFound
+	} else if err != nil {
+		return "", fmt.Errorf("security: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// osKeyringStore stores the value via the command line. Other processes of the user may see it in
+// the process list for a moment.
+func osKeyringStore(service, id, value string) error {
+	output, err := exec.Command("security", "add-generic-password", "-U", "-s", service, "-a", id, "-w", value).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("security: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
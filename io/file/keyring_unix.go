@@ -0,0 +1,49 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build unix && !darwin
+
+package file
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+func osKeyringLookup(service, id string) (string, error) {
+	stderr := bytes.Buffer{}
+	cmd := exec.Command("secret-tool", "lookup", "service", service, "account", id)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		// secret-tool exits with an empty output and stderr, if the item doesn't exist
+		if exitErr := (*exec.ExitError)(nil); errors.As(err, &exitErr) && stderr.Len() == 0 && len(output) == 0 {
+			return "", ErrKeyNotFound
+		}
+		return "", fmt.Errorf("secret-tool: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+func osKeyringStore(service, id, value string) error {
+	cmd := exec.Command("secret-tool", "store", "--label", service+" "+id, "service", service, "account", id)
+	cmd.Stdin = strings.NewReader(value)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("secret-tool: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	tapeio "github.com/simia-tech/tapedb/v2/io"
+)
+
+var ErrUnsupportedLayout = errors.New("unsupported layout")
+
+// Layout describes how a database is stored in its directory: the names of its files and the
+// framing of its log entries. Databases, splices and decks use DefaultLayout unless another one is
+// provided via WithCreateLayout, WithOpenLayout, WithSpliceLayout or WithDeckLayout.
+type Layout struct {
+	Meta    string
+	Base    string
+	Log     string
+	NewMeta string
+	NewBase string
+	NewLog  string
+	Lock    string
+	Journal string
+
+	PayloadPrefix         string
+	PayloadInfoPrefix     string
+	PayloadManifestPrefix string
+	PayloadChunkPrefix    string
+	UploadPrefix          string
+	BackupSuffix          string
+	PartialSuffix         string
+
+	// LogEntryHeaderSize and LogEntryTypeMask describe the header in front of each log entry. Only
+	// the framing of the io package is supported so far.
+	LogEntryHeaderSize int
+	LogEntryTypeMask   tapeio.LogEntryType
+}
+
+// DefaultLayout is the layout that is made of the FileName*, FilePrefix* and FileSuffix* constants.
+var DefaultLayout = Layout{
+	Meta:    FileNameMeta,
+	Base:    FileNameBase,
+	Log:     FileNameLog,
+	NewMeta: FileNameNewMeta,
+	NewBase: FileNameNewBase,
+	NewLog:  FileNameNewLog,
+	Lock:    FileNameLock,
+	Journal: FileNameJournal,
+
+	PayloadPrefix:         FilePrefixPayload,
+	PayloadInfoPrefix:     FilePrefixPayloadInfo,
+	PayloadManifestPrefix: FilePrefixPayloadManifest,
+	PayloadChunkPrefix:    FilePrefixPayloadChunk,
+	UploadPrefix:          FilePrefixUpload,
+	BackupSuffix:          FileSuffixBackup,
+	PartialSuffix:         FileSuffixPartial,
+
+	LogEntryHeaderSize: tapeio.LogEntryHeaderSize,
+	LogEntryTypeMask:   tapeio.LogEntryTypeMask,
+}
+
+// Validate returns ErrUnsupportedLayout if a name is missing, two files would share a name or the
+// framing differs from the one of the io package.
+func (l Layout) Validate() error {
+	names := []struct{ what, name string }{
+		{"meta", l.Meta}, {"base", l.Base}, {"log", l.Log},
+		{"new meta", l.NewMeta}, {"new base", l.NewBase}, {"new log", l.NewLog}, {"lock", l.Lock},
+		{"journal", l.Journal},
+		{"payload prefix", l.PayloadPrefix}, {"payload info prefix", l.PayloadInfoPrefix},
+		{"payload manifest prefix", l.PayloadManifestPrefix}, {"payload chunk prefix", l.PayloadChunkPrefix},
+		{"upload prefix", l.UploadPrefix}, {"backup suffix", l.BackupSuffix}, {"partial suffix", l.PartialSuffix},
+	}
+	owners := map[string]string{}
+	for _, n := range names {
+		if n.name == "" || strings.ContainsAny(n.name, `/\`) {
+			return fmt.Errorf("%w: invalid %s %q", ErrUnsupportedLayout, n.what, n.name)
+		}
+		if owner, ok := owners[n.name]; ok {
+			return fmt.Errorf("%w: %s and %s are both %q", ErrUnsupportedLayout, owner, n.what, n.name)
+		}
+		owners[n.name] = n.what
+	}
+
+	if l.LogEntryHeaderSize != tapeio.LogEntryHeaderSize || l.LogEntryTypeMask != tapeio.LogEntryTypeMask {
+		return fmt.Errorf("%w: log entry framing", ErrUnsupportedLayout)
+	}
+	return nil
+}
+
+func (l Layout) LockPath(path string) string {
+	return filepath.Join(path, l.Lock)
+}
+
+func (l Layout) JournalPath(path string) string {
+	return filepath.Join(path, l.Journal)
+}
+
+func (l Layout) MetaPath(path string) string {
+	return filepath.Join(path, l.Meta)
+}
+
+func (l Layout) BasePath(path string) string {
+	return filepath.Join(path, l.Base)
+}
+
+func (l Layout) LogPath(path string) string {
+	return filepath.Join(path, l.Log)
+}
+
+func (l Layout) PayloadPath(path, id string) string {
+	return filepath.Join(path, l.PayloadPrefix+id)
+}
+
+func (l Layout) PayloadInfoPath(path, id string) string {
+	return filepath.Join(path, l.PayloadInfoPrefix+id)
+}
+
+func (l Layout) PayloadManifestPath(path, id string) string {
+	return filepath.Join(path, l.PayloadManifestPrefix+id)
+}
+
+func (l Layout) PayloadChunkPath(path, id string, index int) string {
+	return filepath.Join(path, fmt.Sprintf("%s%s-%06d", l.PayloadChunkPrefix, id, index))
+}
+
+// PayloadIDOfFileName returns the id of the payload that is stored in the file with the provided
+// name.
+func (l Layout) PayloadIDOfFileName(name string) (string, bool) {
+	for _, prefix := range []string{l.PayloadPrefix, l.PayloadManifestPrefix, l.PayloadInfoPrefix} {
+		if strings.HasPrefix(name, prefix) {
+			return strings.TrimPrefix(name, prefix), true
+		}
+	}
+	if strings.HasPrefix(name, l.PayloadChunkPrefix) {
+		id := strings.TrimPrefix(name, l.PayloadChunkPrefix)
+		if index := strings.LastIndex(id, "-"); index > 0 {
+			return id[:index], true
+		}
+	}
+	return "", false
+}
+
+// SplitLogEntryHeader returns the entry type and the size that are encoded in the provided log
+// entry header.
+func (l Layout) SplitLogEntryHeader(header []byte) (tapeio.LogEntryType, uint32) {
+	value := binary.BigEndian.Uint32(header[:l.LogEntryHeaderSize])
+	return tapeio.LogEntryType(value & uint32(l.LogEntryTypeMask)), value & uint32(^l.LogEntryTypeMask)
+}
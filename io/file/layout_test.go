@@ -0,0 +1,101 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file_test
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestLayout(t *testing.T) {
+	layout := file.DefaultLayout
+	layout.Log = "journal"
+	layout.NewLog = "journal.new"
+	layout.PayloadPrefix = "blob-"
+
+	t.Run("Validate", func(t *testing.T) {
+		require.NoError(t, file.DefaultLayout.Validate())
+		require.NoError(t, layout.Validate())
+
+		missing := layout
+		missing.Base = ""
+		assert.ErrorIs(t, missing.Validate(), file.ErrUnsupportedLayout)
+
+		nested := layout
+		nested.Meta = "sub/meta"
+		assert.ErrorIs(t, nested.Validate(), file.ErrUnsupportedLayout)
+
+		duplicate := layout
+		duplicate.NewBase = duplicate.Base
+		assert.ErrorIs(t, duplicate.Validate(), file.ErrUnsupportedLayout)
+
+		framing := layout
+		framing.LogEntryHeaderSize = 8
+		assert.ErrorIs(t, framing.Validate(), file.ErrUnsupportedLayout)
+	})
+
+	t.Run("CreateOpenSplice", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithCreateKey(testKey), file.WithCreateLayout(layout))
+		require.NoError(t, err)
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 21}))
+		require.NoError(t, db.Apply(&test.ChangeAttachPayload{PayloadID: "123"},
+			file.NewPayload("123", strings.NewReader("test content"))))
+		require.NoError(t, db.Close())
+
+		assert.FileExists(t, filepath.Join(path, "journal"))
+		assert.FileExists(t, filepath.Join(path, "blob-123"))
+		assert.NoFileExists(t, filepath.Join(path, file.FileNameLog))
+
+		_, err = file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithSourceKey(testKey), file.WithTargetKey(testKey), file.WithSpliceLayout(layout))
+		require.NoError(t, err)
+
+		db, err = file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithOpenKey(testKey), file.WithOpenLayout(layout))
+		require.NoError(t, err)
+		defer db.Close()
+
+		assert.Equal(t, 21, db.State().Counter)
+		f, err := db.OpenPayload("123")
+		require.NoError(t, err)
+		defer f.Close()
+		content, err := io.ReadAll(f)
+		require.NoError(t, err)
+		assert.Equal(t, "test content", string(content))
+	})
+
+	t.Run("InvalidLayout", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		invalid := layout
+		invalid.Meta = ""
+		_, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithCreateLayout(invalid))
+		assert.ErrorIs(t, err, file.ErrUnsupportedLayout)
+	})
+}
@@ -0,0 +1,103 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/simia-tech/tapedb/v2"
+)
+
+// ErrLocked is returned if the database is locked by another process or by another open database
+// of the same process.
+var ErrLocked = tapedb.NewError(tapedb.ErrorCodeLocked, "locked")
+
+// LockMode specifies the advisory lock that is held on the lock file of a database while it's open
+// or spliced. The lock is never waited for, a conflicting lock fails with ErrLocked. Since the
+// locks are advisory, only processes that use this package respect them.
+type LockMode int
+
+const (
+	// LockDefault locks exclusively, if the database is written, and doesn't lock a database that
+	// is opened read-only.
+	LockDefault LockMode = iota
+	// LockNone doesn't lock the database.
+	LockNone
+	// LockShared allows other shared locks, but no exclusive one. It keeps writers out while the
+	// database is read.
+	LockShared
+	// LockExclusive allows no other lock.
+	LockExclusive
+)
+
+func (m LockMode) resolve(readOnly bool) LockMode {
+	if m != LockDefault {
+		return m
+	}
+	if readOnly {
+		return LockNone
+	}
+	return LockExclusive
+}
+
+func (m LockMode) String() string {
+	switch m {
+	case LockDefault:
+		return "default"
+	case LockNone:
+		return "none"
+	case LockShared:
+		return "shared"
+	case LockExclusive:
+		return "exclusive"
+	}
+	return fmt.Sprintf("LockMode(%d)", int(m))
+}
+
+type fileLock struct {
+	f *os.File
+}
+
+// lock acquires the lock of the database at the provided path. The lock file is created if needed
+// and is never removed, since another process might wait to lock it.
+func (l Layout) lock(path string, mode LockMode, fileMode fs.FileMode) (*fileLock, error) {
+	if mode == LockNone || mode == LockDefault {
+		return nil, nil
+	}
+
+	lockPath := l.LockPath(path)
+	f, err := os.OpenFile(lockPath, os.O_RDONLY|os.O_CREATE, fileMode)
+	if err != nil {
+		return nil, fmt.Errorf("open lock %s: %w", lockPath, err)
+	}
+	if err := lockFile(f, mode == LockExclusive); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("lock %s: %w", lockPath, err)
+	}
+	return &fileLock{f: f}, nil
+}
+
+// unlock releases the lock. It can be called on a nil or an already released lock.
+func (fl *fileLock) unlock() error {
+	if fl == nil || fl.f == nil {
+		return nil
+	}
+	// closing the file releases the lock as well
+	err := fl.f.Close()
+	fl.f = nil
+	return err
+}
@@ -0,0 +1,114 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2"
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestLock(t *testing.T) {
+	open := func(path string, opts ...file.OpenOption) (*file.Database[*test.Base, *test.State], error) {
+		return file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path, opts...)
+	}
+
+	t.Run("Exclusive", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path)
+		require.NoError(t, err)
+
+		_, err = open(path)
+		assert.ErrorIs(t, err, file.ErrLocked)
+		assert.Equal(t, tapedb.ErrorCodeLocked, tapedb.ErrorCodeOf(err))
+		_, err = open(path, file.WithReadOnly(), file.WithOpenLock(file.LockShared))
+		assert.ErrorIs(t, err, file.ErrLocked)
+		_, err = file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path)
+		assert.ErrorIs(t, err, file.ErrLocked)
+		assert.ErrorIs(t, file.ResetDatabase(path, test.NewBase()), file.ErrLocked)
+		assert.ErrorIs(t, file.ChangePassword(path, nil, "test", file.WithPasswordCryptSettings(testCryptSettings)), file.ErrLocked)
+
+		reader, err := open(path, file.WithReadOnly())
+		require.NoError(t, err)
+		require.NoError(t, reader.Close())
+
+		require.NoError(t, db.Close())
+
+		db, err = open(path)
+		require.NoError(t, err)
+		require.NoError(t, db.Close())
+	})
+
+	t.Run("Shared", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path)
+		require.NoError(t, err)
+		require.NoError(t, db.Close())
+
+		reader, err := open(path, file.WithReadOnly(), file.WithOpenLock(file.LockShared))
+		require.NoError(t, err)
+		defer reader.Close()
+		otherReader, err := open(path, file.WithReadOnly(), file.WithOpenLock(file.LockShared))
+		require.NoError(t, err)
+		defer otherReader.Close()
+
+		_, err = open(path)
+		assert.ErrorIs(t, err, file.ErrLocked)
+		_, err = file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path)
+		assert.ErrorIs(t, err, file.ErrLocked)
+	})
+
+	t.Run("None", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithCreateLock(file.LockNone))
+		require.NoError(t, err)
+		defer db.Close()
+
+		otherDB, err := open(path)
+		require.NoError(t, err)
+		defer otherDB.Close()
+
+		_, err = open(path, file.WithOpenLock(file.LockNone))
+		assert.NoError(t, err)
+	})
+
+	t.Run("FailedOpen", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithCreateKey(testKey))
+		require.NoError(t, err)
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+		require.NoError(t, db.Close())
+
+		_, err = open(path, file.WithOpenKey(make([]byte, len(testKey))))
+		assert.ErrorIs(t, err, file.ErrInvalidKey)
+
+		db, err = open(path, file.WithOpenKey(testKey))
+		require.NoError(t, err)
+		require.NoError(t, db.Close())
+	})
+}
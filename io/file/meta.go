@@ -19,10 +19,13 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/textproto"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
+	"time"
 )
 
 type Meta textproto.MIMEHeader
@@ -51,14 +54,41 @@ func ReadMeta(r io.Reader) (Meta, error) {
 	return Meta(mimeHeader), nil
 }
 
+// WriteMetaFile replaces the meta file atomically. The meta is written and synced to a new file
+// next to the target, which is then renamed over the target, so a crash leaves either the old or
+// the new meta behind.
 func WriteMetaFile(path string, meta Meta) error {
-	f, err := os.Create(path)
+	mode := fs.FileMode(0644)
+	if stat, err := os.Stat(path); err == nil {
+		mode = stat.Mode()
+	}
+
+	newPath := path + ".new"
+	f, err := os.OpenFile(newPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
+	if err := WriteMeta(f, meta); err != nil {
+		f.Close()
+		os.Remove(newPath)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(newPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(newPath)
+		return err
+	}
+
+	if err := renameFile(newPath, path); err != nil {
+		os.Remove(newPath)
+		return err
+	}
 
-	return WriteMeta(f, meta)
+	return syncDir(filepath.Dir(path))
 }
 
 func WriteMeta(w io.Writer, meta Meta) error {
@@ -66,6 +96,14 @@ func WriteMeta(w io.Writer, meta Meta) error {
 	return err
 }
 
+func (m Meta) Clone() Meta {
+	clone := make(Meta, len(m))
+	for key, values := range m {
+		clone[key] = append([]string(nil), values...)
+	}
+	return clone
+}
+
 func (m Meta) SetBytes(key string, value []byte) {
 	m.Set(key, hex.EncodeToString(value))
 }
@@ -74,10 +112,23 @@ func (m Meta) SetUInt64(key string, value uint64) {
 	m.Set(key, strconv.FormatUint(value, 10))
 }
 
+// SetTime sets the time in RFC3339 format in UTC.
+func (m Meta) SetTime(key string, value time.Time) {
+	m.Set(key, value.UTC().Format(time.RFC3339))
+}
+
+func (m Meta) SetBool(key string, value bool) {
+	m.Set(key, strconv.FormatBool(value))
+}
+
 func (m Meta) Set(key, value string) {
 	textproto.MIMEHeader(m).Set(key, value)
 }
 
+func (m Meta) Del(key string) {
+	textproto.MIMEHeader(m).Del(key)
+}
+
 func (m Meta) GetBytes(key string, defaultValue []byte) []byte {
 	if value := m.Get(key); value != "" {
 		if v, err := hex.DecodeString(value); err == nil {
@@ -96,6 +147,25 @@ func (m Meta) GetUInt64(key string, defaultValue uint64) uint64 {
 	return defaultValue
 }
 
+// GetTime parses the value in RFC3339 format. A missing or malformed value returns the default.
+func (m Meta) GetTime(key string, defaultValue time.Time) time.Time {
+	if value := m.Get(key); value != "" {
+		if v, err := time.Parse(time.RFC3339, value); err == nil {
+			return v
+		}
+	}
+	return defaultValue
+}
+
+func (m Meta) GetBool(key string, defaultValue bool) bool {
+	if value := m.Get(key); value != "" {
+		if v, err := strconv.ParseBool(value); err == nil {
+			return v
+		}
+	}
+	return defaultValue
+}
+
 func (m Meta) Get(key string) string {
 	return textproto.MIMEHeader(m).Get(key)
 }
@@ -105,10 +175,10 @@ func (m Meta) Has(key string) bool {
 	return ok
 }
 
-func (m Meta) WriteTo(w io.Writer) (int64, error) {
-	total := int64(0)
-
-	keys := []string{}
+// Range calls the provided function for each value in the order of the keys, until it returns
+// false.
+func (m Meta) Range(fn func(key, value string) bool) {
+	keys := make([]string, 0, len(m))
 	for key := range m {
 		keys = append(keys, key)
 	}
@@ -116,13 +186,26 @@ func (m Meta) WriteTo(w io.Writer) (int64, error) {
 
 	for _, key := range keys {
 		for _, value := range m[key] {
-			n, err := fmt.Fprintf(w, "%s: %s\n", key, value)
-			if err != nil {
-				return total, err
+			if !fn(key, value) {
+				return
 			}
-			total += int64(n)
 		}
 	}
+}
+
+func (m Meta) WriteTo(w io.Writer) (int64, error) {
+	total := int64(0)
+
+	err := error(nil)
+	m.Range(func(key, value string) bool {
+		n := 0
+		n, err = fmt.Fprintf(w, "%s: %s\n", key, value)
+		total += int64(n)
+		return err == nil
+	})
+	if err != nil {
+		return total, err
+	}
 
 	n, err := fmt.Fprintln(w)
 	if err != nil {
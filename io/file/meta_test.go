@@ -0,0 +1,109 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2/io/file"
+)
+
+func TestMeta(t *testing.T) {
+	t.Run("Time", func(t *testing.T) {
+		meta := file.Meta{}
+		meta.SetTime("Time", time.Date(2021, 1, 2, 3, 4, 5, 6, time.FixedZone("CET", 3600)))
+		assert.Equal(t, "2021-01-02T02:04:05Z", meta.Get("Time"))
+		assert.Equal(t, time.Date(2021, 1, 2, 2, 4, 5, 0, time.UTC), meta.GetTime("Time", time.Time{}))
+
+		defaultTime := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+		assert.Equal(t, defaultTime, meta.GetTime("Missing", defaultTime))
+		meta.Set("Malformed", "yesterday")
+		assert.Equal(t, defaultTime, meta.GetTime("Malformed", defaultTime))
+	})
+
+	t.Run("Bool", func(t *testing.T) {
+		meta := file.Meta{}
+		meta.SetBool("Flag", true)
+		assert.Equal(t, "true", meta.Get("Flag"))
+		assert.True(t, meta.GetBool("Flag", false))
+
+		assert.True(t, meta.GetBool("Missing", true))
+		meta.Set("Malformed", "maybe")
+		assert.False(t, meta.GetBool("Malformed", false))
+	})
+
+	t.Run("Del", func(t *testing.T) {
+		meta := file.Meta{}
+		meta.Set("Name", "one")
+		meta.Del("name")
+		assert.False(t, meta.Has("Name"))
+	})
+
+	t.Run("Clone", func(t *testing.T) {
+		meta := file.Meta{}
+		meta.Set("Name", "one")
+		clone := meta.Clone()
+		clone.Set("Name", "two")
+		assert.Equal(t, "one", meta.Get("Name"))
+	})
+
+	t.Run("Range", func(t *testing.T) {
+		meta := file.Meta{"B": []string{"two", "three"}, "A": []string{"one"}, "C": []string{"four"}}
+
+		values := []string{}
+		meta.Range(func(key, value string) bool {
+			values = append(values, key+"="+value)
+			return key != "B"
+		})
+		assert.Equal(t, []string{"A=one", "B=two"}, values)
+	})
+}
+
+func TestWriteMetaFile(t *testing.T) {
+	t.Run("Replace", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		metaPath := filepath.Join(path, file.FileNameMeta)
+		require.NoError(t, file.WriteMetaFile(metaPath, file.Meta{"Name": []string{"one"}}))
+		require.NoError(t, file.WriteMetaFile(metaPath, file.Meta{"Name": []string{"two"}}))
+
+		assert.Equal(t, "Name: two\n\n", readFile(t, metaPath))
+		assert.NoFileExists(t, filepath.Join(path, file.FileNameNewMeta))
+	})
+
+	t.Run("FailingRename", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		metaPath := filepath.Join(path, file.FileNameMeta)
+		require.NoError(t, file.WriteMetaFile(metaPath, file.Meta{"Name": []string{"one"}}))
+
+		errRename := errors.New("rename failed")
+		defer file.SetRenameFile(func(string, string) error { return errRename })()
+
+		err := file.WriteMetaFile(metaPath, file.Meta{"Name": []string{"two"}})
+		assert.ErrorIs(t, err, errRename)
+
+		assert.Equal(t, "Name: one\n\n", readFile(t, metaPath))
+		assert.NoFileExists(t, filepath.Join(path, file.FileNameNewMeta))
+	})
+}
@@ -0,0 +1,167 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics is an Observer that counts the operations on databases and decks. It can be exposed in
+// the Prometheus text format via WritePrometheus or by serving it as a http.Handler.
+type Metrics struct {
+	opens          atomic.Int64
+	openHits       atomic.Int64
+	openErrors     atomic.Int64
+	openNanos      atomic.Int64
+	applies        atomic.Int64
+	applyErrors    atomic.Int64
+	applyNanos     atomic.Int64
+	splices        atomic.Int64
+	spliceErrors   atomic.Int64
+	spliceNanos    atomic.Int64
+	evictions      atomic.Int64
+	evictionErrors atomic.Int64
+	reaps          atomic.Int64
+	reapNanos      atomic.Int64
+}
+
+var _ Observer = &Metrics{}
+
+// MetricsSnapshot holds the values of Metrics at a point in time.
+type MetricsSnapshot struct {
+	Opens          int64
+	OpenHits       int64
+	OpenErrors     int64
+	OpenDuration   time.Duration
+	Applies        int64
+	ApplyErrors    int64
+	ApplyDuration  time.Duration
+	Splices        int64
+	SpliceErrors   int64
+	SpliceDuration time.Duration
+	Evictions      int64
+	EvictionErrors int64
+	Reaps          int64
+	ReapIdle       time.Duration
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{}
+}
+
+func (m *Metrics) OnOpen(e OpenEvent) {
+	m.opens.Add(1)
+	if e.Cached {
+		m.openHits.Add(1)
+	}
+	if e.Err != nil {
+		m.openErrors.Add(1)
+	}
+	m.openNanos.Add(int64(e.Duration))
+}
+
+func (m *Metrics) OnApply(e ApplyEvent) {
+	m.applies.Add(1)
+	if e.Err != nil {
+		m.applyErrors.Add(1)
+	}
+	m.applyNanos.Add(int64(e.Duration))
+}
+
+func (m *Metrics) OnSplice(e SpliceEvent) {
+	m.splices.Add(1)
+	if e.Err != nil {
+		m.spliceErrors.Add(1)
+	}
+	m.spliceNanos.Add(int64(e.Duration))
+}
+
+func (m *Metrics) OnEvict(e EvictEvent) {
+	m.evictions.Add(1)
+	if e.Err != nil {
+		m.evictionErrors.Add(1)
+	}
+	if e.Idle > 0 {
+		m.reaps.Add(1)
+		m.reapNanos.Add(int64(e.Idle))
+	}
+}
+
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	return MetricsSnapshot{
+		Opens:          m.opens.Load(),
+		OpenHits:       m.openHits.Load(),
+		OpenErrors:     m.openErrors.Load(),
+		OpenDuration:   time.Duration(m.openNanos.Load()),
+		Applies:        m.applies.Load(),
+		ApplyErrors:    m.applyErrors.Load(),
+		ApplyDuration:  time.Duration(m.applyNanos.Load()),
+		Splices:        m.splices.Load(),
+		SpliceErrors:   m.spliceErrors.Load(),
+		SpliceDuration: time.Duration(m.spliceNanos.Load()),
+		Evictions:      m.evictions.Load(),
+		EvictionErrors: m.evictionErrors.Load(),
+		Reaps:          m.reaps.Load(),
+		ReapIdle:       time.Duration(m.reapNanos.Load()),
+	}
+}
+
+// HitRate returns the share of opens that have been served by a deck from an open database.
+func (s MetricsSnapshot) HitRate() float64 {
+	if s.Opens == 0 {
+		return 0
+	}
+	return float64(s.OpenHits) / float64(s.Opens)
+}
+
+// WritePrometheus writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	s := m.Snapshot()
+	for _, metric := range []struct {
+		name  string
+		help  string
+		value any
+	}{
+		{"tapedb_opens_total", "Number of database opens.", s.Opens},
+		{"tapedb_open_hits_total", "Number of opens served from an open database.", s.OpenHits},
+		{"tapedb_open_errors_total", "Number of failed database opens.", s.OpenErrors},
+		{"tapedb_open_seconds_total", "Time spent opening databases.", s.OpenDuration.Seconds()},
+		{"tapedb_applies_total", "Number of applied changes.", s.Applies},
+		{"tapedb_apply_errors_total", "Number of failed applies.", s.ApplyErrors},
+		{"tapedb_apply_seconds_total", "Time spent applying changes.", s.ApplyDuration.Seconds()},
+		{"tapedb_splices_total", "Number of database splices.", s.Splices},
+		{"tapedb_splice_errors_total", "Number of failed splices.", s.SpliceErrors},
+		{"tapedb_splice_seconds_total", "Time spent splicing databases.", s.SpliceDuration.Seconds()},
+		{"tapedb_evictions_total", "Number of databases closed by a deck to stay within its limit or because they have been idle.", s.Evictions},
+		{"tapedb_eviction_errors_total", "Number of evictions that failed to close the database.", s.EvictionErrors},
+		{"tapedb_reaps_total", "Number of evictions of databases that have been idle.", s.Reaps},
+		{"tapedb_reap_idle_seconds_total", "Idle time of the reaped databases.", s.ReapIdle.Seconds()},
+	} {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %v\n",
+			metric.name, metric.help, metric.name, metric.name, metric.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.WritePrometheus(w)
+}
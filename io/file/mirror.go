@@ -0,0 +1,321 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/simia-tech/tapedb/v2"
+)
+
+// MirrorBackend stores the copies of the payload files. Its methods match blob.Bucket, so any
+// bucket can be used as a mirror. Put has to replace an object atomically.
+type MirrorBackend interface {
+	Get(key string) (io.ReadCloser, error)
+	Put(key string, r io.Reader) error
+	Delete(key string) error
+	List(prefix string) ([]string, error)
+}
+
+// PayloadMirror copies the files of each written payload to a backend and deletes them there if
+// the payload is deleted. The files are copied as they are stored, so encrypted payloads stay
+// encrypted in the backend.
+type PayloadMirror struct {
+	backend   MirrorBackend
+	prefix    string
+	async     bool
+	errorFunc func(id string, err error)
+}
+
+type payloadMirrorOptions struct {
+	prefix    string
+	async     bool
+	errorFunc func(id string, err error)
+}
+
+type PayloadMirrorOption func(*payloadMirrorOptions)
+
+// WithMirrorPrefix prepends the provided prefix to the keys of the files in the backend, so
+// multiple databases can share a backend.
+func WithMirrorPrefix(value string) PayloadMirrorOption {
+	return func(o *payloadMirrorOptions) {
+		o.prefix = value
+	}
+}
+
+// WithMirrorAsync copies the payload files in the background, so a write doesn't wait for the
+// backend. Failed copies are reported to the provided function and can be healed by
+// RepairPayloadMirror. Closing the database waits for the pending copies.
+func WithMirrorAsync(errorFunc func(id string, err error)) PayloadMirrorOption {
+	return func(o *payloadMirrorOptions) {
+		o.async = true
+		o.errorFunc = errorFunc
+	}
+}
+
+// NewPayloadMirror returns a mirror to the provided backend. By default, the payload files are
+// copied synchronously and a write fails if its files can't be copied.
+func NewPayloadMirror(backend MirrorBackend, opts ...PayloadMirrorOption) *PayloadMirror {
+	options := payloadMirrorOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return &PayloadMirror{
+		backend:   backend,
+		prefix:    options.prefix,
+		async:     options.async,
+		errorFunc: options.errorFunc,
+	}
+}
+
+// MirrorRepairResult counts the files that have been healed by RepairPayloadMirror.
+type MirrorRepairResult struct {
+	Uploaded int
+	Restored int
+	Deleted  int
+}
+
+// mirrorPayload copies the files of the payload with the provided id to the mirror.
+func (db *Database[B, S]) mirrorPayload(id string) error {
+	if db.mirror == nil {
+		return nil
+	}
+
+	copyFn := func() error {
+		names, err := db.layout.payloadFileNames(db.path, id)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if err := db.mirror.upload(db.path, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if !db.mirror.async {
+		if err := copyFn(); err != nil {
+			return fmt.Errorf("mirror payload with id %s: %w", id, err)
+		}
+		return nil
+	}
+
+	db.mirrorWG.Add(1)
+	go func() {
+		defer db.mirrorWG.Done()
+		if err := copyFn(); err != nil && db.mirror.errorFunc != nil {
+			db.mirror.errorFunc(id, err)
+		}
+	}()
+	return nil
+}
+
+// unmirrorPayload deletes the copies of the payload with the provided id from the mirror.
+func (db *Database[B, S]) unmirrorPayload(id string) error {
+	if db.mirror == nil {
+		return nil
+	}
+	// a pending copy would otherwise recreate the deleted files
+	db.mirrorWG.Wait()
+
+	keys, err := db.mirror.list()
+	if err != nil {
+		return err
+	}
+	for _, name := range keys {
+		if fileID, ok := db.layout.PayloadIDOfFileName(name); ok && fileID == id {
+			if err := db.mirror.backend.Delete(db.mirror.prefix + name); err != nil {
+				return fmt.Errorf("delete mirrored file %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// RepairPayloadMirror compares the payload files of the database with the ones in the mirror.
+// Missing copies are uploaded and payloads that are referenced by the base or the log, but only
+// exist in the mirror, are restored. Copies of payloads that are neither stored locally nor
+// referenced are deleted from the mirror.
+func (db *Database[B, S]) RepairPayloadMirror() (MirrorRepairResult, error) {
+	if db.mirror == nil {
+		return MirrorRepairResult{}, nil
+	}
+	db.mirrorWG.Wait()
+
+	references := tapedb.PayloadReferences{}
+	references.Track(db.Base())
+	if err := db.ReadChanges(func(_ int, change tapedb.Change) error {
+		references.Track(change)
+		return nil
+	}); err != nil {
+		return MirrorRepairResult{}, fmt.Errorf("read changes: %w", err)
+	}
+
+	localNames, err := db.layout.readPayloadFileNames(db.path)
+	if err != nil {
+		return MirrorRepairResult{}, err
+	}
+	local := map[string]bool{}
+	for _, name := range localNames {
+		local[name] = true
+	}
+
+	mirroredNames, err := db.mirror.list()
+	if err != nil {
+		return MirrorRepairResult{}, err
+	}
+	mirrored := map[string]bool{}
+	for _, name := range mirroredNames {
+		mirrored[name] = true
+	}
+
+	result := MirrorRepairResult{}
+	for _, name := range localNames {
+		if mirrored[name] {
+			continue
+		}
+		if err := db.mirror.upload(db.path, name); err != nil {
+			return result, err
+		}
+		result.Uploaded++
+	}
+
+	for _, name := range mirroredNames {
+		if local[name] {
+			continue
+		}
+		id, ok := db.layout.PayloadIDOfFileName(name)
+		if !ok {
+			continue
+		}
+		if !references.Has(id) {
+			if err := db.mirror.backend.Delete(db.mirror.prefix + name); err != nil {
+				return result, fmt.Errorf("delete mirrored file %s: %w", name, err)
+			}
+			result.Deleted++
+			continue
+		}
+		if db.readOnly {
+			return result, tapedb.WrapError("restore payload", db.path, ErrReadOnly)
+		}
+		if err := db.mirror.download(db.path, name, db.layout.PartialSuffix, db.fileMode); err != nil {
+			return result, err
+		}
+		result.Restored++
+	}
+
+	return result, nil
+}
+
+func (m *PayloadMirror) upload(path, name string) error {
+	f, err := os.Open(filepath.Join(path, name))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := m.backend.Put(m.prefix+name, f); err != nil {
+		return fmt.Errorf("upload %s: %w", name, err)
+	}
+	return nil
+}
+
+// download writes the mirrored file into a partial file that is renamed afterwards, so readers
+// never see an incomplete payload.
+func (m *PayloadMirror) download(path, name, partialSuffix string, fileMode os.FileMode) error {
+	r, err := m.backend.Get(m.prefix + name)
+	if err != nil {
+		return fmt.Errorf("download %s: %w", name, err)
+	}
+	defer r.Close()
+
+	targetPath := filepath.Join(path, name)
+	partialPath := targetPath + partialSuffix
+	f, err := os.OpenFile(partialPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fileMode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(partialPath)
+		return fmt.Errorf("download %s: %w", name, err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(partialPath)
+		return err
+	}
+	return os.Rename(partialPath, targetPath)
+}
+
+// list returns the names of the mirrored files without the prefix.
+func (m *PayloadMirror) list() ([]string, error) {
+	keys, err := m.backend.List(m.prefix)
+	if err != nil {
+		return nil, fmt.Errorf("list mirrored files: %w", err)
+	}
+	names := make([]string, 0, len(keys))
+	for _, key := range keys {
+		names = append(names, strings.TrimPrefix(key, m.prefix))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// payloadFileNames returns the names of the files that store the payload with the provided id.
+func (l Layout) payloadFileNames(path, id string) ([]string, error) {
+	names := []string{}
+	for _, name := range []string{l.PayloadPrefix + id, l.PayloadManifestPrefix + id, l.PayloadInfoPrefix + id} {
+		if _, err := os.Stat(filepath.Join(path, name)); err == nil {
+			names = append(names, name)
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	for index := 0; ; index++ {
+		chunkPath := l.PayloadChunkPath(path, id, index)
+		if _, err := os.Stat(chunkPath); os.IsNotExist(err) {
+			return names, nil
+		} else if err != nil {
+			return nil, err
+		}
+		names = append(names, filepath.Base(chunkPath))
+	}
+}
+
+// readPayloadFileNames returns the names of all committed payload files of the database.
+func (l Layout) readPayloadFileNames(path string) ([]string, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("read directory: %w", err)
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasSuffix(entry.Name(), l.PartialSuffix) {
+			continue
+		}
+		if _, ok := l.PayloadIDOfFileName(entry.Name()); ok {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,157 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2"
+	"github.com/simia-tech/tapedb/v2/io/blob"
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+var errTestPut = errors.New("test put")
+
+type failingBucket struct {
+	*blob.MemoryBucket
+}
+
+func (failingBucket) Put(string, io.Reader) error {
+	return errTestPut
+}
+
+func TestPayloadMirror(t *testing.T) {
+	t.Run("Sync", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		bucket := blob.NewMemoryBucket()
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithCreateKey(testKey),
+			file.WithCreatePayloadMirror(file.NewPayloadMirror(bucket, file.WithMirrorPrefix("db/"))))
+		require.NoError(t, err)
+		defer db.Close()
+
+		require.NoError(t, db.Apply(&test.ChangeAttachPayload{PayloadID: "123"},
+			file.NewPayload("123", strings.NewReader("test content"))))
+
+		keys, err := bucket.List("db/")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"db/payload-123"}, keys)
+		assert.Equal(t, readFile(t, filepath.Join(path, file.FilePrefixPayload+"123")), readBucket(t, bucket, "db/payload-123"))
+
+		require.NoError(t, db.DeletePayload("123"))
+		keys, err = bucket.List("db/")
+		require.NoError(t, err)
+		assert.Empty(t, keys)
+	})
+
+	t.Run("SyncFailure", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithPayloadInfo(),
+			file.WithCreatePayloadMirror(file.NewPayloadMirror(failingBucket{blob.NewMemoryBucket()})))
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Apply(&test.ChangeAttachPayload{PayloadID: "123"},
+			file.NewPayload("123", strings.NewReader("test content")))
+		assert.ErrorIs(t, err, errTestPut)
+		assert.NoFileExists(t, filepath.Join(path, file.FilePrefixPayload+"123"))
+		assert.NoFileExists(t, file.DefaultLayout.PayloadInfoPath(path, "123"))
+		assert.Equal(t, 0, db.LogLen())
+	})
+
+	t.Run("Async", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		mutex := sync.Mutex{}
+		failedIDs := []string{}
+		errorFn := func(id string, err error) {
+			mutex.Lock()
+			failedIDs = append(failedIDs, id)
+			mutex.Unlock()
+		}
+
+		bucket := blob.NewMemoryBucket()
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithPayloadChunkSize(4),
+			file.WithCreatePayloadMirror(file.NewPayloadMirror(bucket, file.WithMirrorAsync(errorFn))))
+		require.NoError(t, err)
+
+		require.NoError(t, db.Apply(&test.ChangeAttachPayload{PayloadID: "123"},
+			file.NewPayload("123", strings.NewReader("test content"))))
+		require.NoError(t, db.Close())
+
+		keys, err := bucket.List("")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"chunk-123-000000", "chunk-123-000001", "chunk-123-000002", "manifest-123"}, keys)
+		assert.Empty(t, failedIDs)
+	})
+
+	t.Run("Repair", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		bucket := blob.NewMemoryBucket()
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithCreatePayloadMirror(file.NewPayloadMirror(bucket)))
+		require.NoError(t, err)
+		defer db.Close()
+
+		require.NoError(t, db.Apply(&tapedb.AttachPayload{IDs: []string{"123", "456"}},
+			file.NewPayload("123", strings.NewReader("one")),
+			file.NewPayload("456", strings.NewReader("two"))))
+		require.NoError(t, os.Remove(filepath.Join(path, file.FilePrefixPayload+"123")))
+		require.NoError(t, bucket.Delete("payload-456"))
+		require.NoError(t, bucket.Put("payload-789", strings.NewReader("orphan")))
+
+		result, err := db.RepairPayloadMirror()
+		require.NoError(t, err)
+		assert.Equal(t, file.MirrorRepairResult{Uploaded: 1, Restored: 1, Deleted: 1}, result)
+
+		r, err := db.OpenPayload("123")
+		require.NoError(t, err)
+		defer r.Close()
+		content, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, "one", string(content))
+		keys, err := bucket.List("")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"payload-123", "payload-456"}, keys)
+	})
+}
+
+func readBucket(tb testing.TB, bucket blob.Bucket, key string) string {
+	r, err := bucket.Get(key)
+	require.NoError(tb, err)
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	require.NoError(tb, err)
+	return string(data)
+}
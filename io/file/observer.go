@@ -0,0 +1,93 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"time"
+)
+
+// Observer is notified about the operations on databases and decks, so they can be monitored.
+// The methods are called synchronously and should return quickly.
+type Observer interface {
+	OnOpen(OpenEvent)
+	OnApply(ApplyEvent)
+	OnSplice(SpliceEvent)
+	OnEvict(EvictEvent)
+}
+
+// OpenEvent describes the opening of a database. Cached is true if a deck returned a database that
+// has already been open.
+type OpenEvent struct {
+	Path     string
+	Cached   bool
+	Duration time.Duration
+	Err      error
+}
+
+// OpenDiagnostics breaks the opening of a database down into its phases, so a slow open can be
+// pinned to the key derivation, the decoding of the base or the replay of the log. Phases that
+// haven't been reached due to an error are zero. Recovery tells how an interrupted splice has been
+// recovered before the database has been opened.
+type OpenDiagnostics struct {
+	Path          string
+	Recovery      RecoverAction
+	MetaRead      time.Duration
+	KeyDerivation time.Duration
+	BaseDecode    time.Duration
+	LogReplay     time.Duration
+	LogLen        int64
+	LogSize       int64
+	Duration      time.Duration
+	Err           error
+}
+
+// ApplyEvent describes the application of a change including the writing of its payloads.
+type ApplyEvent struct {
+	Path       string
+	ChangeType string
+	Duration   time.Duration
+	Err        error
+}
+
+type SpliceEvent struct {
+	Path     string
+	Result   SpliceResult
+	Duration time.Duration
+	Err      error
+}
+
+// EvictEvent describes a database that has been closed by a deck to stay within its limit. If the
+// database has been closed because it was idle, Idle holds the time since its last use.
+type EvictEvent struct {
+	Path string
+	Idle time.Duration
+	Err  error
+}
+
+// NopObserver ignores all events. It can be embedded to implement only some of the methods.
+type NopObserver struct{}
+
+func (NopObserver) OnOpen(OpenEvent)     {}
+func (NopObserver) OnApply(ApplyEvent)   {}
+func (NopObserver) OnSplice(SpliceEvent) {}
+func (NopObserver) OnEvict(EvictEvent)   {}
+
+// ObserverOrNop returns the provided observer or a NopObserver if it's nil.
+func ObserverOrNop(o Observer) Observer {
+	if o == nil {
+		return NopObserver{}
+	}
+	return o
+}
@@ -15,9 +15,13 @@
 package file
 
 import (
+	"context"
 	"io/fs"
+	"time"
 
 	"github.com/simia-tech/tapedb/v2"
+	tapeio "github.com/simia-tech/tapedb/v2/io"
+	"github.com/simia-tech/tapedb/v2/io/crypto"
 )
 
 type KeyFunc func(Meta) ([]byte, error)
@@ -36,16 +40,39 @@ func StaticKeyFunc(value []byte) KeyFunc {
 }
 
 type createOptions struct {
-	directoryMode fs.FileMode
-	fileMode      fs.FileMode
-	metaFunc      func() Meta
-	keyFunc       KeyFunc
+	directoryMode     fs.FileMode
+	fileMode          fs.FileMode
+	metaFunc          func() Meta
+	keyFunc           KeyFunc
+	cryptSettings     *CryptSettings
+	cipher            crypto.Cipher
+	applyFunc         tapeio.ApplyFunc
+	maxPayloadSize    int64
+	retryPolicy       tapeio.RetryPolicy
+	logChecksum       bool
+	logCompression    bool
+	logDictionary     []byte
+	baseCompression   string
+	payloadInfo       bool
+	inlinePayloadSize int64
+	payloadChunkSize  int64
+	codec             string
+	syncPolicy        SyncPolicy
+	groupCommit       bool
+	clock             tapedb.Clock
+	timestamps        bool
+	lock              LockMode
+	observer          Observer
+	mirror            *PayloadMirror
+	layout            Layout
 }
 
 var defaultCreateOptions = createOptions{
 	directoryMode: 0755,
 	fileMode:      0644,
 	metaFunc:      func() Meta { return Meta{} },
+	layout:        DefaultLayout,
+	timestamps:    true,
 }
 
 type CreateOption func(*createOptions)
@@ -78,11 +105,187 @@ func WithCreateKeyFunc(value KeyFunc) CreateOption {
 	}
 }
 
+// WithCryptSettings sets the settings a password-based key func like DeriveKeyFrom derives the key
+// of the new database with, instead of its default settings.
+func WithCryptSettings(value CryptSettings) CreateOption {
+	return func(o *createOptions) {
+		o.cryptSettings = &value
+	}
+}
+
+// WithCreateLock sets the lock that is held on the new database until it's closed. By default, it's
+// locked exclusively.
+func WithCreateLock(value LockMode) CreateOption {
+	return func(o *createOptions) {
+		o.lock = value
+	}
+}
+
+func WithCipher(value crypto.Cipher) CreateOption {
+	return func(o *createOptions) {
+		o.cipher = value
+	}
+}
+
+func WithCreateApplyFunc(value tapeio.ApplyFunc) CreateOption {
+	return func(o *createOptions) {
+		o.applyFunc = value
+	}
+}
+
+func WithCreateMaxPayloadSize(value int64) CreateOption {
+	return func(o *createOptions) {
+		o.maxPayloadSize = value
+	}
+}
+
+// WithLogChecksum adds a checksum to each entry of an unencrypted log.
+func WithLogChecksum() CreateOption {
+	return func(o *createOptions) {
+		o.logChecksum = true
+	}
+}
+
+// WithLogCompression compresses each entry of an unencrypted log with zstd and the provided
+// dictionary. A dictionary that has been trained by TrainLogDictionary improves the ratio of small
+// entries a lot. The dictionary is stored in the meta. Compressed entries aren't covered by the log
+// checksum.
+func WithLogCompression(dictionary []byte) CreateOption {
+	return func(o *createOptions) {
+		o.logCompression = true
+		o.logDictionary = dictionary
+	}
+}
+
+// WithBaseCompression compresses the base with the provided compression, BaseCompressionGzip or
+// BaseCompressionZstd, whenever it's written by a splice. Unlike the log compression, it's applied
+// before the encryption and works for encrypted databases as well.
+func WithBaseCompression(compression string) CreateOption {
+	return func(o *createOptions) {
+		o.baseCompression = compression
+	}
+}
+
+// WithCodec encodes the base and the changes with the codec of the provided name instead of their own
+// WriteTo and ReadFrom methods. The name is resolved by the factory, if it implements
+// tapedb.CodecFactory, or by the built-in codecs.
+func WithCodec(name string) CreateOption {
+	return func(o *createOptions) {
+		o.codec = name
+	}
+}
+
+// WithInlinePayloadSize stores payloads up to the provided size in the log entry of the change that
+// references them instead of a separate file. Payloads with a meta are always stored in a file.
+// Inline payloads can't be deleted, they're moved into a file once their change is rebased.
+func WithInlinePayloadSize(value int64) CreateOption {
+	return func(o *createOptions) {
+		o.inlinePayloadSize = value
+	}
+}
+
+// WithPayloadChunkSize stores payloads that exceed the provided size in multiple chunk files of
+// that size and a manifest that lists them. An interrupted write of such a payload can be resumed
+// by writing the same payload again, only the missing chunks are stored then.
+func WithPayloadChunkSize(value int64) CreateOption {
+	return func(o *createOptions) {
+		o.payloadChunkSize = value
+	}
+}
+
+// WithPayloadInfo stores the plaintext size and the content type of each payload next to it, so
+// StatPayload reports the logical size of encrypted payloads.
+func WithPayloadInfo() CreateOption {
+	return func(o *createOptions) {
+		o.payloadInfo = true
+	}
+}
+
+func WithCreateRetryPolicy(value tapeio.RetryPolicy) CreateOption {
+	return func(o *createOptions) {
+		o.retryPolicy = value
+	}
+}
+
+func WithCreateSyncPolicy(value SyncPolicy) CreateOption {
+	return func(o *createOptions) {
+		o.syncPolicy = value
+	}
+}
+
+func WithCreateClock(value tapedb.Clock) CreateOption {
+	return func(o *createOptions) {
+		o.clock = value
+	}
+}
+
+// WithCreateTimestamps sets whether the creation time is stored in the Created field of the meta
+// and the time of the last apply in the Last-Modified field. It's enabled by default.
+func WithCreateTimestamps(value bool) CreateOption {
+	return func(o *createOptions) {
+		o.timestamps = value
+	}
+}
+
+// WithCreateObserver reports the applies on the database to the provided observer.
+func WithCreateObserver(value Observer) CreateOption {
+	return func(o *createOptions) {
+		o.observer = value
+	}
+}
+
+// WithCreatePayloadMirror copies the files of each written payload to the provided mirror.
+func WithCreatePayloadMirror(value *PayloadMirror) CreateOption {
+	return func(o *createOptions) {
+		o.mirror = value
+	}
+}
+
+// WithCreateLayout stores the database in the provided layout instead of the default one.
+func WithCreateLayout(value Layout) CreateOption {
+	return func(o *createOptions) {
+		o.layout = value
+	}
+}
+
+// WithCreateGroupCommit batches concurrently applied changes into a single log write and sync.
+func WithCreateGroupCommit() CreateOption {
+	return func(o *createOptions) {
+		o.groupCommit = true
+	}
+}
+
 type openOptions struct {
-	keyFunc KeyFunc
+	keyFunc        KeyFunc
+	applyFunc      tapeio.ApplyFunc
+	readOnly       bool
+	maxPayloadSize int64
+	retryPolicy    tapeio.RetryPolicy
+	syncPolicy     SyncPolicy
+	groupCommit    bool
+	migrator       tapedb.ChangeMigrator
+	replayGovernor tapeio.ReplayGovernor
+	baseCache      *BaseCache
+	stopAtIndex    int64
+	replayClock    *tapedb.ReplayClock
+	clock          tapedb.Clock
+	timestamps     bool
+	lock           LockMode
+	observer       Observer
+	mirror         *PayloadMirror
+	layout         Layout
+	ctx            context.Context
+
+	timeout         time.Duration
+	diagnosticsFunc func(OpenDiagnostics)
 }
 
-var defaultOpenOptions = openOptions{}
+var defaultOpenOptions = openOptions{
+	stopAtIndex: -1,
+	layout:      DefaultLayout,
+	ctx:         context.Background(),
+	timestamps:  true,
+}
 
 type OpenOption func(*openOptions)
 
@@ -96,14 +299,249 @@ func WithOpenKeyFunc(value KeyFunc) OpenOption {
 	}
 }
 
+func WithOpenApplyFunc(value tapeio.ApplyFunc) OpenOption {
+	return func(o *openOptions) {
+		o.applyFunc = value
+	}
+}
+
+func WithReadOnly() OpenOption {
+	return func(o *openOptions) {
+		o.readOnly = true
+	}
+}
+
+// WithOpenLock sets the lock that is held on the database until it's closed. By default, a database
+// is locked exclusively, unless it's opened read-only. A shared lock requires write access to the
+// directory, if the lock file doesn't exist yet.
+func WithOpenLock(value LockMode) OpenOption {
+	return func(o *openOptions) {
+		o.lock = value
+	}
+}
+
+func WithOpenMaxPayloadSize(value int64) OpenOption {
+	return func(o *openOptions) {
+		o.maxPayloadSize = value
+	}
+}
+
+func WithOpenRetryPolicy(value tapeio.RetryPolicy) OpenOption {
+	return func(o *openOptions) {
+		o.retryPolicy = value
+	}
+}
+
+func WithOpenSyncPolicy(value SyncPolicy) OpenOption {
+	return func(o *openOptions) {
+		o.syncPolicy = value
+	}
+}
+
+func WithOpenClock(value tapedb.Clock) OpenOption {
+	return func(o *openOptions) {
+		o.clock = value
+	}
+}
+
+// WithOpenTimestamps sets whether the time of the last apply is stored in the Last-Modified field
+// of the meta. It's enabled by default.
+func WithOpenTimestamps(value bool) OpenOption {
+	return func(o *openOptions) {
+		o.timestamps = value
+	}
+}
+
+// WithOpenObserver reports the opening of the database and the applies on it to the provided
+// observer.
+func WithOpenObserver(value Observer) OpenOption {
+	return func(o *openOptions) {
+		o.observer = value
+	}
+}
+
+// WithOpenPayloadMirror copies the files of each written payload to the provided mirror.
+func WithOpenPayloadMirror(value *PayloadMirror) OpenOption {
+	return func(o *openOptions) {
+		o.mirror = value
+	}
+}
+
+// WithOpenLayout reads the database in the provided layout instead of the default one.
+func WithOpenLayout(value Layout) OpenOption {
+	return func(o *openOptions) {
+		o.layout = value
+	}
+}
+
+// WithOpenGroupCommit batches concurrently applied changes into a single log write and sync.
+func WithOpenGroupCommit() OpenOption {
+	return func(o *openOptions) {
+		o.groupCommit = true
+	}
+}
+
+// WithOpenReplayGovernor throttles the replay of the log and reports the progress.
+func WithOpenReplayGovernor(value tapeio.ReplayGovernor) OpenOption {
+	return func(o *openOptions) {
+		o.replayGovernor = value
+	}
+}
+
+// WithStopAtIndex replays only the provided number of changes. The database is opened read-only.
+func WithStopAtIndex(value int64) OpenOption {
+	return func(o *openOptions) {
+		o.stopAtIndex = value
+		o.readOnly = true
+	}
+}
+
+// WithOpenReplayClock replays the log with the provided clock, so a state that implements
+// tapedb.ClockSetter sees the timestamp of each replayed change as the current time. Since the state
+// keeps the clock, the database is opened read-only.
+func WithOpenReplayClock(value *tapedb.ReplayClock) OpenOption {
+	return func(o *openOptions) {
+		o.replayClock = value
+		o.readOnly = true
+	}
+}
+
+// WithOpenBaseCache looks up the decoded base in the provided cache before it is read.
+func WithOpenBaseCache(value *BaseCache) OpenOption {
+	return func(o *openOptions) {
+		o.baseCache = value
+	}
+}
+
+// WithOpenMigrations upgrades the encoding of the changes in the log when they are read.
+func WithOpenMigrations(values ...tapedb.ChangeMigrator) OpenOption {
+	return func(o *openOptions) {
+		o.migrator = tapedb.Migrations(values)
+	}
+}
+
+// WithOpenTimeout aborts the opening of the database if it takes longer than the provided duration.
+// The returned error wraps context.DeadlineExceeded.
+func WithOpenTimeout(value time.Duration) OpenOption {
+	return func(o *openOptions) {
+		o.timeout = value
+	}
+}
+
+// WithOpenDiagnosticsFunc passes the timings of the phases of the open to the provided function.
+// It's called after each open, whether it succeeded or not.
+func WithOpenDiagnosticsFunc(value func(OpenDiagnostics)) OpenOption {
+	return func(o *openOptions) {
+		o.diagnosticsFunc = value
+	}
+}
+
+func withOpenContext(ctx context.Context) OpenOption {
+	return func(o *openOptions) {
+		o.ctx = ctx
+	}
+}
+
+type deckOptions struct {
+	retryPolicy tapeio.RetryPolicy
+	baseCache   *BaseCache
+	observer    Observer
+	evictFunc   func(string)
+	idleTimeout time.Duration
+	clock       tapedb.Clock
+	layout      Layout
+}
+
+var defaultDeckOptions = deckOptions{
+	layout: DefaultLayout,
+}
+
+type DeckOption func(*deckOptions)
+
+// WithDeckRetryPolicy sets the retry policy for all databases that are created or opened via the
+// deck. A policy that is passed as create or open option takes precedence.
+func WithDeckRetryPolicy(value tapeio.RetryPolicy) DeckOption {
+	return func(o *deckOptions) {
+		o.retryPolicy = value
+	}
+}
+
+// WithDeckBaseCache sets the base cache for all databases that are opened via the deck. The cached
+// base of a database is invalidated if it's spliced or deleted via the deck.
+func WithDeckBaseCache(value *BaseCache) DeckOption {
+	return func(o *deckOptions) {
+		o.baseCache = value
+	}
+}
+
+// WithDeckObserver reports the operations of the deck and of all databases that are created,
+// opened or spliced via the deck to the provided observer.
+func WithDeckObserver(value Observer) DeckOption {
+	return func(o *deckOptions) {
+		o.observer = value
+	}
+}
+
+// WithDeckEvictFunc calls the provided function with the path of each database that is evicted by
+// the deck, either to stay within its limit or because it has been idle. The function is called
+// before the database is closed and must not use the deck.
+func WithDeckEvictFunc(value func(path string)) DeckOption {
+	return func(o *deckOptions) {
+		o.evictFunc = value
+	}
+}
+
+// WithDeckIdleTimeout closes the databases that haven't been used for the provided duration, even
+// if the deck is below its limit. The deck checks for idle databases every half of the duration.
+// Databases that are in use or pinned are kept open.
+func WithDeckIdleTimeout(value time.Duration) DeckOption {
+	return func(o *deckOptions) {
+		o.idleTimeout = value
+	}
+}
+
+// WithDeckClock sets the clock that measures the idle time of the databases.
+func WithDeckClock(value tapedb.Clock) DeckOption {
+	return func(o *deckOptions) {
+		o.clock = value
+	}
+}
+
+// WithDeckLayout sets the layout of all databases that are created, opened or spliced via the deck.
+func WithDeckLayout(value Layout) DeckOption {
+	return func(o *deckOptions) {
+		o.layout = value
+	}
+}
+
 type spliceOptions struct {
 	sourceKeyFunc          KeyFunc
 	targetKeyFunc          KeyFunc
 	rebaseChangeSelectFunc RebaseChangeSelectFunc
+	migrator               tapedb.ChangeMigrator
+	clock                  tapedb.Clock
+	timestamps             bool
+	lock                   LockMode
+	verify                 bool
+	observer               Observer
+	progressFunc           func(SpliceProgress)
+	dryRun                 bool
+	ctx                    context.Context
+	logCompression         bool
+	logDictionary          []byte
+	trainLogDictionary     bool
+	logDictionarySize      int
+	setBaseCompression     bool
+	baseCompression        string
+	keepPayloads           bool
+	layout                 Layout
 }
 
 var defaultSpliceOptions = spliceOptions{
 	rebaseChangeSelectFunc: StaticRebaseChangeSelectFunc(false),
+	layout:                 DefaultLayout,
+	ctx:                    context.Background(),
+	timestamps:             true,
 }
 
 type SpliceOption func(*spliceOptions)
@@ -138,6 +576,117 @@ func WithRebaseChangeSelectFunc(value RebaseChangeSelectFunc) SpliceOption {
 	}
 }
 
+// WithSpliceMigrations upgrades the encoding of the changes in the log when they are read. The
+// spliced base and log are written in the new encoding.
+func WithSpliceMigrations(values ...tapedb.ChangeMigrator) SpliceOption {
+	return func(o *spliceOptions) {
+		o.migrator = tapedb.Migrations(values)
+	}
+}
+
+// WithSpliceClock sets the clock that is used for the splice time and duration in the meta.
+func WithSpliceClock(value tapedb.Clock) SpliceOption {
+	return func(o *spliceOptions) {
+		o.clock = value
+	}
+}
+
+// WithSpliceTimestamps sets whether the end of the splice is stored in the Last-Modified field of
+// the meta. It's enabled by default.
+func WithSpliceTimestamps(value bool) SpliceOption {
+	return func(o *spliceOptions) {
+		o.timestamps = value
+	}
+}
+
+// WithSpliceLock sets the lock that is held on the database during the splice. By default, it's
+// locked exclusively.
+func WithSpliceLock(value LockMode) SpliceOption {
+	return func(o *spliceOptions) {
+		o.lock = value
+	}
+}
+
+// WithSpliceVerify replays the old and the new base and log before they are swapped and aborts the
+// splice with ErrDiverged if the hashes of the resulting states differ.
+func WithSpliceVerify() SpliceOption {
+	return func(o *spliceOptions) {
+		o.verify = true
+	}
+}
+
+// WithSpliceBaseCompression sets the compression of the spliced base. An empty compression
+// disables it. By default, the setting of the database is kept.
+func WithSpliceBaseCompression(compression string) SpliceOption {
+	return func(o *spliceOptions) {
+		o.setBaseCompression = true
+		o.baseCompression = compression
+	}
+}
+
+// WithSpliceLogCompression compresses the entries of the spliced log with the provided dictionary.
+func WithSpliceLogCompression(dictionary []byte) SpliceOption {
+	return func(o *spliceOptions) {
+		o.logCompression = true
+		o.logDictionary = dictionary
+	}
+}
+
+// WithSpliceLogDictionaryTraining trains a dictionary of the provided size on the entries of the log
+// and compresses the entries of the spliced log with it. A size of zero selects the default size.
+func WithSpliceLogDictionaryTraining(size int) SpliceOption {
+	return func(o *spliceOptions) {
+		o.trainLogDictionary = true
+		o.logDictionarySize = size
+	}
+}
+
+// WithSpliceKeepPayloads keeps the payloads that aren't referenced by the spliced base or log. It's
+// meant for models that can't report their payload references, like the generic one.
+func WithSpliceKeepPayloads() SpliceOption {
+	return func(o *spliceOptions) {
+		o.keepPayloads = true
+	}
+}
+
+// WithSpliceLayout splices the database in the provided layout instead of the default one.
+func WithSpliceLayout(value Layout) SpliceOption {
+	return func(o *spliceOptions) {
+		o.layout = value
+	}
+}
+
+// WithSpliceObserver reports the splice to the provided observer.
+func WithSpliceObserver(value Observer) SpliceOption {
+	return func(o *spliceOptions) {
+		o.observer = value
+	}
+}
+
+// WithSpliceProgress passes the progress of the splice to the provided function after each entry
+// of the log. It's called from the splicing goroutine, so it should return quickly.
+func WithSpliceProgress(fn func(SpliceProgress)) SpliceOption {
+	return func(o *spliceOptions) {
+		o.progressFunc = fn
+	}
+}
+
+// WithSpliceDryRun reads the base and the log and computes the result of the splice without
+// writing anything. The returned sizes are the ones of the new base and log and the payloads that
+// would be deleted are counted as deleted. Since nothing is written, the database isn't locked by
+// default and WithSpliceVerify is ignored.
+func WithSpliceDryRun() SpliceOption {
+	return func(o *spliceOptions) {
+		o.dryRun = true
+	}
+}
+
+func withSpliceContext(ctx context.Context) SpliceOption {
+	return func(o *spliceOptions) {
+		o.ctx = ctx
+	}
+}
+
 type RebaseChangeSelectFunc func(tapedb.Change, int) (bool, error)
 
 func CountRebaseChangeSelectFunc(count int) RebaseChangeSelectFunc {
@@ -151,3 +700,31 @@ func StaticRebaseChangeSelectFunc(value bool) RebaseChangeSelectFunc {
 		return value, nil
 	}
 }
+
+// TimeRebaseChangeSelectFunc selects the changes that carry a timestamp (see tapedb.Timestamped)
+// older than the provided duration. The cutoff is taken when the function is created. Since only a
+// prefix of the log can be rebased, the first change that is younger or has no timestamp ends the
+// rebase.
+func TimeRebaseChangeSelectFunc(olderThan time.Duration) RebaseChangeSelectFunc {
+	cutoff := time.Now().Add(-olderThan)
+	return func(change tapedb.Change, _ int) (bool, error) {
+		timestamped, ok := change.(tapedb.Timestamped)
+		if !ok {
+			return false, nil
+		}
+		return timestamped.Timestamp().Before(cutoff), nil
+	}
+}
+
+// TypeRebaseChangeSelectFunc selects the changes of the provided types. Since only a prefix of the
+// log can be rebased, the first change of another type ends the rebase.
+func TypeRebaseChangeSelectFunc(typeNames ...string) RebaseChangeSelectFunc {
+	set := make(map[string]struct{}, len(typeNames))
+	for _, typeName := range typeNames {
+		set[typeName] = struct{}{}
+	}
+	return func(change tapedb.Change, _ int) (bool, error) {
+		_, ok := set[change.TypeName()]
+		return ok, nil
+	}
+}
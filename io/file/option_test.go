@@ -0,0 +1,80 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2"
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestTimeRebaseChangeSelectFunc(t *testing.T) {
+	selectFn := file.TimeRebaseChangeSelectFunc(time.Hour)
+
+	testFn := func(name string, change tapedb.Change, expectSelected bool) {
+		t.Run(name, func(t *testing.T) {
+			selected, err := selectFn(change, 0)
+			require.NoError(t, err)
+			assert.Equal(t, expectSelected, selected)
+		})
+	}
+
+	testFn("Old", &leaseChange{At: time.Now().Add(-2 * time.Hour)}, true)
+	testFn("Young", &leaseChange{At: time.Now().Add(-time.Minute)}, false)
+	testFn("NoTimestamp", &test.ChangeCounterInc{Value: 1}, false)
+}
+
+func TestTypeRebaseChangeSelectFunc(t *testing.T) {
+	t.Run("Select", func(t *testing.T) {
+		selectFn := file.TypeRebaseChangeSelectFunc("counter-inc")
+
+		selected, err := selectFn(&test.ChangeCounterInc{Value: 1}, 0)
+		require.NoError(t, err)
+		assert.True(t, selected)
+
+		selected, err = selectFn(&test.ChangeAttachPayload{PayloadID: "123"}, 1)
+		require.NoError(t, err)
+		assert.False(t, selected)
+	})
+
+	t.Run("Splice", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		makeFile(t, filepath.Join(path, file.FileNameBase), `{"value":21}`)
+		makeFile(t, filepath.Join(path, file.FileNameLog),
+			"\x00\x00\x00\x18\x0bcounter-inc{\"value\":7}\n"+
+				"\x00\x00\x00#\x0eattach-payload{\"payloadID\":\"123\"}\n"+
+				"\x00\x00\x00\x18\x0bcounter-inc{\"value\":2}\n")
+		makeFile(t, filepath.Join(path, file.FilePrefixPayload+"123"), "test content")
+
+		result, err := file.SpliceDatabase[*test.Base, *test.State](
+			test.NewFactory(), path, file.WithRebaseChangeSelectFunc(file.TypeRebaseChangeSelectFunc("counter-inc")))
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.EntriesRebased)
+
+		assert.Equal(t, "{\"value\":28}\n", readFile(t, filepath.Join(path, file.FileNameBase)))
+		assert.Equal(t,
+			"\x00\x00\x00#\x0eattach-payload{\"payloadID\":\"123\"}\n\x00\x00\x00\x18\x0bcounter-inc{\"value\":2}\n",
+			readFile(t, filepath.Join(path, file.FileNameLog)))
+	})
+}
@@ -1,10 +1,19 @@
 package file
 
 import (
+	"crypto/sha256"
+	"hash"
+	"io"
 	"io/fs"
 	"os"
 )
 
+// file system operations used while splicing are held in variables, so tests can inject faults.
+var (
+	createFile = createNewWriteOnlyFile
+	renameFile = os.Rename
+)
+
 func createNewWriteOnlyFile(path string, mode os.FileMode) (*os.File, error) {
 	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_SYNC, mode)
 	if os.IsExist(err) {
@@ -13,6 +22,14 @@ func createNewWriteOnlyFile(path string, mode os.FileMode) (*os.File, error) {
 	return f, err
 }
 
+func createNewLogFile(path string, mode os.FileMode) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if os.IsExist(err) {
+		return nil, ErrExisting
+	}
+	return f, err
+}
+
 func mayOpenReadOnlyFile(path string) (*os.File, fs.FileMode, error) {
 	f, err := os.OpenFile(path, os.O_RDONLY, 0)
 	if os.IsNotExist(err) {
@@ -28,3 +45,41 @@ func mayOpenReadOnlyFile(path string) (*os.File, fs.FileMode, error) {
 	}
 	return f, stat.Mode(), nil
 }
+
+// checksumWriteCloser computes the SHA256 of everything that is written to the underlying writer.
+type checksumWriteCloser struct {
+	io.WriteCloser
+	hash hash.Hash
+	size int64
+}
+
+func newChecksumWriteCloser(wc io.WriteCloser) *checksumWriteCloser {
+	return &checksumWriteCloser{WriteCloser: wc, hash: sha256.New()}
+}
+
+func (w *checksumWriteCloser) Write(data []byte) (int, error) {
+	n, err := w.WriteCloser.Write(data)
+	w.hash.Write(data[:n])
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *checksumWriteCloser) Sum() []byte {
+	return w.hash.Sum(nil)
+}
+
+// Size returns the number of bytes that have been written.
+func (w *checksumWriteCloser) Size() int64 {
+	return w.size
+}
+
+// discardWriteCloser drops everything that is written to it.
+type discardWriteCloser struct{}
+
+func (discardWriteCloser) Write(data []byte) (int, error) {
+	return len(data), nil
+}
+
+func (discardWriteCloser) Close() error {
+	return nil
+}
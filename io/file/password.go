@@ -0,0 +1,277 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/simia-tech/crypt"
+
+	tapeio "github.com/simia-tech/tapedb/v2/io"
+	"github.com/simia-tech/tapedb/v2/io/crypto"
+)
+
+var ErrEmptyPassword = errors.New("empty password")
+
+type passwordOptions struct {
+	cryptSettings string
+	layout        Layout
+}
+
+var defaultPasswordOptions = passwordOptions{
+	cryptSettings: DefaultCryptSettings,
+	layout:        DefaultLayout,
+}
+
+type PasswordOption func(*passwordOptions)
+
+// WithPasswordCryptSettings sets the settings the new key is derived with. The settings must not
+// contain a salt, since each password change generates a new one.
+func WithPasswordCryptSettings(value string) PasswordOption {
+	return func(o *passwordOptions) {
+		o.cryptSettings = value
+	}
+}
+
+// WithPasswordLayout sets the layout of the database.
+func WithPasswordLayout(value Layout) PasswordOption {
+	return func(o *passwordOptions) {
+		o.layout = value
+	}
+}
+
+// ChangePassword re-encrypts the database at the provided path with a key that is derived from the
+// new password. Unlike a splice with a new target key, the key is derived with fresh crypt settings
+// and a new salt, which replace the Crypt-Settings of the meta. An unencrypted database is
+// encrypted with the new key.
+//
+// The base, the log, the payloads with their infos and chunks and the pending uploads are
+// re-encrypted without decoding the changes, so no model is needed. The new files replace the old
+// ones together with the meta, so a failed change leaves the database untouched. Copies of the
+// payloads in a mirror keep the old encryption. The database must not be open while its password
+// is changed, otherwise ErrLocked is returned.
+func ChangePassword(path string, oldKeyFunc KeyFunc, newPassword string, opts ...PasswordOption) error {
+	options := defaultPasswordOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	layout := options.layout
+	if err := layout.Validate(); err != nil {
+		return err
+	}
+	if newPassword == "" {
+		return ErrEmptyPassword
+	}
+	if _, _, salt, _, err := crypt.DecodeSettings(options.cryptSettings); err != nil {
+		return fmt.Errorf("decode crypt settings: %w", err)
+	} else if salt != "" {
+		return fmt.Errorf("crypt settings %s must not contain a salt", options.cryptSettings)
+	}
+
+	if err := layout.mustExist(path); err != nil {
+		return err
+	}
+
+	lock, err := layout.lock(path, LockExclusive, 0644)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	if _, err := layout.recover(path); err != nil {
+		return fmt.Errorf("recover: %w", err)
+	}
+
+	meta, err := layout.readMetaFileOrEmpty(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := formatVersionFromMeta(meta); err != nil {
+		return err
+	}
+	c, err := cipherFromMeta(meta)
+	if err != nil {
+		return err
+	}
+
+	oldKey, err := oldKeyFunc.deriveKey(meta.Clone())
+	if err != nil {
+		return fmt.Errorf("derive old key: %w", err)
+	}
+
+	// the new key is derived from the default settings, which makes the key derivation generate a
+	// new salt
+	newMeta := meta.Clone()
+	newMeta.Del(MetaHeaderCryptSettings)
+	newKey, err := DeriveKeyFrom(newPassword, options.cryptSettings)(newMeta)
+	if err != nil {
+		return fmt.Errorf("derive new key: %w", err)
+	}
+	dictionaries := LogDictionaries(meta)
+
+	newPaths, paths := []string{}, []string{}
+	defer func() {
+		for _, newPath := range newPaths {
+			os.Remove(newPath)
+		}
+	}()
+	reencrypt := func(name string, fn func(string, string) (string, error)) error {
+		filePath := filepath.Join(path, name)
+		if _, err := os.Stat(filePath); os.IsNotExist(err) {
+			return nil
+		}
+		newPath, err := fn(filePath, filePath+layout.PartialSuffix)
+		if err != nil {
+			if errors.Is(err, crypto.ErrInvalidKey) {
+				err = ErrInvalidKey
+			}
+			return fmt.Errorf("re-encrypt %s: %w", name, err)
+		}
+		newPaths, paths = append(newPaths, newPath), append(paths, filePath)
+		return nil
+	}
+	reencryptBlocks := func(filePath, partialPath string) (string, error) {
+		return reencryptBlockFile(filePath, partialPath, c, oldKey, newKey)
+	}
+
+	if err := reencrypt(layout.Log, func(filePath, partialPath string) (string, error) {
+		return reencryptLogFile(filePath, partialPath, c, oldKey, newKey, dictionaries, false)
+	}); err != nil {
+		return err
+	}
+	if err := reencrypt(layout.Base, reencryptBlocks); err != nil {
+		return err
+	}
+
+	payloadNames, err := layout.readPayloadFileNames(path)
+	if err != nil {
+		return err
+	}
+	for _, name := range payloadNames {
+		if err := reencrypt(name, reencryptBlocks); err != nil {
+			return err
+		}
+	}
+
+	uploadNames, err := layout.readUploadFileNames(path)
+	if err != nil {
+		return err
+	}
+	for _, name := range uploadNames {
+		if err := reencrypt(name, func(filePath, partialPath string) (string, error) {
+			return reencryptLogFile(filePath, partialPath, c, oldKey, newKey, nil, true)
+		}); err != nil {
+			return err
+		}
+	}
+
+	metaPath := layout.MetaPath(path)
+	newMetaPath := filepath.Join(path, layout.NewMeta)
+	if err := WriteMetaFile(newMetaPath, newMeta); err != nil {
+		return fmt.Errorf("write meta: %w", err)
+	}
+	newPaths, paths = append(newPaths, newMetaPath), append(paths, metaPath)
+
+	if err := layout.replaceFiles(path, newPaths, paths); err != nil {
+		if errors.Is(err, ErrInterrupted) {
+			newPaths = nil
+		}
+		return fmt.Errorf("replace files: %w", err)
+	}
+	newPaths = nil
+
+	return syncDir(path)
+}
+
+// reencryptLogFile writes the entries of the log file at the provided path, encrypted with the
+// target key, into the partial file and returns the path of that partial file. The entries of a
+// plain log are decompressed with the provided dictionaries and lose their checksums, since an
+// encrypted log is authenticated by its cipher. If partialTail is set, a partially written last
+// entry is dropped like a resumed upload would do.
+func reencryptLogFile(path, partialPath string, c crypto.Cipher, sourceKey, targetKey []byte, dictionaries [][]byte, partialTail bool) (string, error) {
+	f, fileMode, err := mayOpenReadOnlyFile(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	logR, err := wrapLogReader(tapeio.NewLogReader(f), sourceKey, dictionaries)
+	if err != nil {
+		return "", fmt.Errorf("new log reader: %w", err)
+	}
+
+	pf, err := os.OpenFile(partialPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fileMode.Perm())
+	if err != nil {
+		return "", err
+	}
+	logW := tapeio.LogWriter(tapeio.NewLogWriter(pf))
+	if logW, err = crypto.WrapLogWriterWithCipher(logW, c, targetKey, NonceFn); err != nil {
+		pf.Close()
+		os.Remove(partialPath)
+		return "", fmt.Errorf("new log writer: %w", err)
+	}
+
+	err = tapeio.ReadLogEntries(logR, func(entry tapeio.LogEntry) error {
+		r, err := entry.Reader()
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		_, err = logW.WriteEntry(tapeio.LogEntryTypeBinary, data)
+		return err
+	})
+	if partialTail && errors.Is(err, io.ErrUnexpectedEOF) {
+		err = nil
+	}
+	if err == nil {
+		err = tapeio.FlushLogWriter(logW)
+	}
+	if err == nil {
+		err = pf.Sync()
+	}
+	if cErr := pf.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		os.Remove(partialPath)
+		return "", err
+	}
+	return partialPath, nil
+}
+
+// readUploadFileNames returns the names of the files of the pending uploads.
+func (l Layout) readUploadFileNames(path string) ([]string, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, l.UploadPrefix) && !strings.HasSuffix(name, l.PartialSuffix) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
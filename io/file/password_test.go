@@ -0,0 +1,145 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestChangePassword(t *testing.T) {
+	oldKeyFunc := file.DeriveKeyFrom("old", testCryptSettings)
+	newKeyFunc := file.DeriveKeyFrom("new", testCryptSettings)
+
+	setup := func(t *testing.T, keyFunc file.KeyFunc, opts ...file.CreateOption) string {
+		path, removeDir := makeTempDir(t)
+		t.Cleanup(removeDir)
+
+		if keyFunc != nil {
+			opts = append(opts, file.WithCreateKeyFunc(keyFunc))
+		}
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path, opts...)
+		require.NoError(t, err)
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 21}))
+		require.NoError(t, db.Apply(&test.ChangeAttachPayload{PayloadID: "123"},
+			file.NewPayload("123", strings.NewReader("test content"))))
+
+		upload, err := db.BeginPayload("456")
+		require.NoError(t, err)
+		_, err = io.WriteString(upload, "test ")
+		require.NoError(t, err)
+		require.NoError(t, upload.Close())
+		require.NoError(t, db.Close())
+
+		// a partially written chunk has to be dropped
+		uploadF, err := os.OpenFile(filepath.Join(path, file.FilePrefixUpload+"456"), os.O_APPEND|os.O_WRONLY, 0)
+		require.NoError(t, err)
+		_, err = uploadF.Write([]byte{0x00, 0x00, 0x01})
+		require.NoError(t, err)
+		require.NoError(t, uploadF.Close())
+
+		_, err = file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithSourceKeyFunc(keyFunc), file.WithTargetKeyFunc(keyFunc), file.WithRebaseChangeCount(1))
+		require.NoError(t, err)
+		require.FileExists(t, filepath.Join(path, file.FileNameBase))
+
+		return path
+	}
+
+	assertOpen := func(t *testing.T, path string) {
+		db, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithOpenKeyFunc(newKeyFunc))
+		require.NoError(t, err)
+		defer db.Close()
+
+		assert.Equal(t, 21, db.State().Counter)
+		f, err := db.OpenPayload("123")
+		require.NoError(t, err)
+		defer f.Close()
+		content, err := io.ReadAll(f)
+		require.NoError(t, err)
+		assert.Equal(t, "test content", string(content))
+
+		upload, err := db.BeginPayload("456")
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), upload.Size())
+		_, err = io.WriteString(upload, "content")
+		require.NoError(t, err)
+		require.NoError(t, upload.Commit(&test.ChangeAttachPayload{PayloadID: "456"}))
+	}
+
+	t.Run("Encrypted", func(t *testing.T) {
+		path := setup(t, oldKeyFunc, file.WithPayloadInfo(), file.WithPayloadChunkSize(4))
+		oldMeta, err := file.ReadDatabaseMeta(path)
+		require.NoError(t, err)
+
+		require.NoError(t, file.ChangePassword(path, oldKeyFunc, "new", file.WithPasswordCryptSettings(testCryptSettings)))
+
+		meta, err := file.ReadDatabaseMeta(path)
+		require.NoError(t, err)
+		assert.NotEqual(t, oldMeta.Get(file.MetaHeaderCryptSettings), meta.Get(file.MetaHeaderCryptSettings))
+		assert.True(t, strings.HasPrefix(meta.Get(file.MetaHeaderCryptSettings), testCryptSettings))
+
+		assertOpen(t, path)
+
+		_, err = file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithOpenKeyFunc(oldKeyFunc))
+		assert.ErrorIs(t, err, file.ErrInvalidKey)
+	})
+
+	t.Run("Plain", func(t *testing.T) {
+		path := setup(t, nil, file.WithLogChecksum())
+
+		require.NoError(t, file.ChangePassword(path, nil, "new", file.WithPasswordCryptSettings(testCryptSettings)))
+
+		assertOpen(t, path)
+	})
+
+	t.Run("WrongPassword", func(t *testing.T) {
+		path := setup(t, oldKeyFunc)
+
+		err := file.ChangePassword(path, file.DeriveKeyFrom("wrong", testCryptSettings), "new",
+			file.WithPasswordCryptSettings(testCryptSettings))
+		assert.ErrorIs(t, err, file.ErrInvalidKey)
+
+		db, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithOpenKeyFunc(oldKeyFunc))
+		require.NoError(t, err)
+		defer db.Close()
+		assert.Equal(t, 21, db.State().Counter)
+
+		names, err := filepath.Glob(filepath.Join(path, "*"+file.FileSuffixPartial))
+		require.NoError(t, err)
+		assert.Empty(t, names)
+	})
+
+	t.Run("EmptyPassword", func(t *testing.T) {
+		path := setup(t, nil)
+
+		assert.ErrorIs(t, file.ChangePassword(path, nil, ""), file.ErrEmptyPassword)
+	})
+
+	t.Run("SettingsWithSalt", func(t *testing.T) {
+		path := setup(t, nil)
+
+		assert.Error(t, file.ChangePassword(path, nil, "new", file.WithPasswordCryptSettings(testCryptSettings+"c2FsdHNhbHQ")))
+	})
+}
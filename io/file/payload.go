@@ -15,20 +15,54 @@
 package file
 
 import (
-	"errors"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"hash"
 	"io"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/simia-tech/tapedb/v2"
+	tapeio "github.com/simia-tech/tapedb/v2/io"
+	"github.com/simia-tech/tapedb/v2/io/crypto"
 )
 
 var (
-	ErrPayloadIDAlreadyExists = errors.New("payload id already exists")
-	ErrPayloadMissing         = errors.New("payload missing")
+	ErrPayloadIDAlreadyExists  = tapedb.NewError(tapedb.ErrorCodePayloadExisting, "payload id already exists")
+	ErrPayloadMissing          = tapedb.NewError(tapedb.ErrorCodePayloadMissing, "payload missing")
+	ErrPayloadTooLarge         = tapedb.NewError(tapedb.ErrorCodePayloadTooLarge, "payload too large")
+	ErrPayloadChecksumMismatch = tapedb.NewError(tapedb.ErrorCodeCorrupt, "payload checksum mismatch")
+	ErrPayloadReferenceLost    = tapedb.NewError(tapedb.ErrorCodeDiverged, "payload reference lost")
+	ErrPayloadUploadInProgress = tapedb.NewError(tapedb.ErrorCodeConflict, "payload upload in progress")
+	ErrPayloadInline           = tapedb.NewError(tapedb.ErrorCodeConflict, "payload inline")
 )
 
 type Payload struct {
-	id string
-	r  io.Reader
+	id         string
+	r          io.Reader
+	checksum   []byte
+	meta       PayloadMeta
+	hasMeta    bool
+	progressFn PayloadProgressFunc
+}
+
+func withPayloadsContext(ctx context.Context, payloads []Payload) []Payload {
+	if len(payloads) == 0 || ctx.Done() == nil {
+		return payloads
+	}
+	result := make([]Payload, len(payloads))
+	for index, payload := range payloads {
+		payload.r = tapeio.NewContextReader(ctx, payload.r)
+		result[index] = payload
+	}
+	return result
 }
 
+type PayloadProgressFunc func(id string, written int64)
+
 func NewPayload(id string, r io.Reader) Payload {
 	return Payload{
 		id: id,
@@ -36,10 +70,213 @@ func NewPayload(id string, r io.Reader) Payload {
 	}
 }
 
+// NewPayloadWithMeta returns a payload whose meta is stored next to it. A provided SHA256 is
+// verified like a checksum and a zero CreatedAt is set to the time the payload is written.
+func NewPayloadWithMeta(id string, r io.Reader, meta PayloadMeta) Payload {
+	return Payload{
+		id:       id,
+		r:        r,
+		checksum: meta.SHA256,
+		meta:     meta,
+		hasMeta:  true,
+	}
+}
+
 func (p *Payload) ID() string {
 	return p.id
 }
 
-type PayloadContainer interface {
-	PayloadIDs() []string
+func (p Payload) WithChecksum(sha256Sum []byte) Payload {
+	p.checksum = sha256Sum
+	return p
+}
+
+func (p Payload) WithProgressFunc(fn PayloadProgressFunc) Payload {
+	p.progressFn = fn
+	return p
+}
+
+// WithContentType sets the content type that is stored in the payload meta.
+func (p Payload) WithContentType(value string) Payload {
+	p.meta.ContentType = value
+	p.hasMeta = true
+	return p
+}
+
+type PayloadMeta struct {
+	ContentType string
+	SHA256      []byte
+	CreatedAt   time.Time
+}
+
+// PayloadInfo holds the plaintext size and the meta of a payload.
+type PayloadInfo struct {
+	PayloadMeta
+
+	ID   string
+	Size int64
+}
+
+func (pi PayloadInfo) meta() Meta {
+	meta := Meta{}
+	meta.SetUInt64(PayloadInfoFieldSize, uint64(pi.Size))
+	if pi.ContentType != "" {
+		meta.Set(PayloadInfoFieldContentType, pi.ContentType)
+	}
+	if len(pi.SHA256) > 0 {
+		meta.SetBytes(PayloadInfoFieldSHA256, pi.SHA256)
+	}
+	if !pi.CreatedAt.IsZero() {
+		meta.Set(PayloadInfoFieldCreatedAt, pi.CreatedAt.UTC().Format(time.RFC3339Nano))
+	}
+	return meta
+}
+
+func payloadInfoFromMeta(id string, meta Meta) PayloadInfo {
+	createdAt, _ := time.Parse(time.RFC3339Nano, meta.Get(PayloadInfoFieldCreatedAt))
+	return PayloadInfo{
+		PayloadMeta: PayloadMeta{
+			ContentType: meta.Get(PayloadInfoFieldContentType),
+			SHA256:      meta.GetBytes(PayloadInfoFieldSHA256, nil),
+			CreatedAt:   createdAt,
+		},
+		ID:   id,
+		Size: int64(meta.GetUInt64(PayloadInfoFieldSize, 0)),
+	}
+}
+
+func payloadsContain(payloads []Payload, id string) bool {
+	for _, payload := range payloads {
+		if payload.id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// payloadFileInfo reports the plaintext size of a payload instead of the size on disk. The name
+// is only replaced if it's set.
+type payloadFileInfo struct {
+	fs.FileInfo
+	name string
+	size int64
+}
+
+func (fi payloadFileInfo) Name() string {
+	if fi.name == "" {
+		return fi.FileInfo.Name()
+	}
+	return fi.name
+}
+
+func (fi payloadFileInfo) Size() int64 {
+	return fi.size
+}
+
+type PayloadContainer = tapedb.PayloadContainer
+
+// stagedPayload has been written completely, but is only visible to readers after commitFn has been
+// called. discardFn removes the staged files.
+type stagedPayload struct {
+	*payloadWriter
+
+	commitFn  func() error
+	discardFn func()
+}
+
+type payloadWriter struct {
+	w       io.Writer
+	payload Payload
+	maxSize int64
+	written int64
+	hash    hash.Hash
+}
+
+func newPayloadWriter(w io.Writer, payload Payload, maxSize int64) *payloadWriter {
+	return &payloadWriter{
+		w:       w,
+		payload: payload,
+		maxSize: maxSize,
+		hash:    sha256.New(),
+	}
+}
+
+func (w *payloadWriter) Write(data []byte) (int, error) {
+	if w.maxSize > 0 && w.written+int64(len(data)) > w.maxSize {
+		return 0, ErrPayloadTooLarge
+	}
+
+	n, err := w.w.Write(data)
+	w.hash.Write(data[:n])
+	w.written += int64(n)
+	if err != nil {
+		return n, err
+	}
+
+	if w.payload.progressFn != nil {
+		w.payload.progressFn(w.payload.id, w.written)
+	}
+
+	return n, nil
+}
+
+func (w *payloadWriter) verify() error {
+	if w.payload.checksum != nil && !bytes.Equal(w.hash.Sum(nil), w.payload.checksum) {
+		return ErrPayloadChecksumMismatch
+	}
+	return nil
+}
+
+// reencryptBlockFile writes the content of the block file (a payload or the base) at the provided
+// path, encrypted with the target key, into the partial file and returns the path of that partial
+// file. Empty keys stand for plain files.
+func reencryptBlockFile(path, partialPath string, c crypto.Cipher, sourceKey, targetKey []byte) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	r := io.Reader(f)
+	if len(sourceKey) > 0 {
+		if r, err = crypto.NewBlockReaderWithCipher(f, c, sourceKey); err != nil {
+			return "", fmt.Errorf("new block reader: %w", err)
+		}
+	}
+
+	pf, err := os.OpenFile(partialPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return "", err
+	}
+	if err := copyBlocks(pf, r, c, targetKey); err != nil {
+		pf.Close()
+		os.Remove(partialPath)
+		return "", err
+	}
+	if err := pf.Close(); err != nil {
+		os.Remove(partialPath)
+		return "", err
+	}
+	return partialPath, nil
+}
+
+func copyBlocks(w io.Writer, r io.Reader, c crypto.Cipher, key []byte) error {
+	if len(key) == 0 {
+		_, err := io.Copy(w, r)
+		return err
+	}
+
+	bw, err := crypto.NewBlockWriterWithCipher(w, c, key, NonceFn)
+	if err != nil {
+		return fmt.Errorf("new block writer: %w", err)
+	}
+	if _, err := io.Copy(bw, r); err != nil {
+		return err
+	}
+	return bw.Close()
 }
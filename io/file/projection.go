@@ -0,0 +1,43 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"github.com/simia-tech/tapedb/v2"
+	tapeio "github.com/simia-tech/tapedb/v2/io"
+)
+
+// AddProjection adds a projection that is maintained next to the state, e.g. a counter or a search
+// index. It's built from the base and the log first and gets every change that is applied
+// afterwards. Projections aren't stored, so they have to be added again after the database has
+// been opened.
+func (db *Database[B, S]) AddProjection(name string, newFn tapeio.ProjectionFunc[B]) error {
+	// a running splice swaps the log
+	db.spliceMutex.Lock()
+	defer db.spliceMutex.Unlock()
+
+	return tapedb.WrapError("add projection", db.path, db.db.AddProjection(name, newFn, db.readChangesFn))
+}
+
+// Projection returns the projection with the provided name. If a change couldn't be applied to it,
+// the error of that change is returned and the projection stays out of date until it's rebuilt.
+func (db *Database[B, S]) Projection(name string) (tapedb.State, error) {
+	return db.db.Projection(name)
+}
+
+// RemoveProjection removes the projection with the provided name.
+func (db *Database[B, S]) RemoveProjection(name string) {
+	db.db.RemoveProjection(name)
+}
@@ -0,0 +1,78 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2"
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+// itemNames indexes the items of the test model by their names.
+type itemNames struct {
+	ids map[string]string
+}
+
+func newItemNames(base *test.Base, _ sync.Locker) tapedb.State {
+	p := &itemNames{ids: map[string]string{}}
+	for id, item := range base.Items {
+		p.ids[item.Name] = id
+	}
+	return p
+}
+
+func (p *itemNames) Apply(c tapedb.Change) error {
+	if t, ok := c.(*test.ChangeItemAdd); ok {
+		p.ids[t.Name] = t.ID
+	}
+	return nil
+}
+
+func TestDatabaseProjection(t *testing.T) {
+	path, removeDir := makeTempDir(t)
+	defer removeDir()
+
+	db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path)
+	require.NoError(t, err)
+	require.NoError(t, db.Apply(&test.ChangeItemAdd{ID: "1", Name: "one"}))
+	require.NoError(t, db.Close())
+
+	db, err = file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.AddProjection("names", newItemNames))
+	require.NoError(t, db.Apply(&test.ChangeItemAdd{ID: "2", Name: "two"}))
+
+	_, err = db.SpliceInPlace(test.NewFactory(), file.WithRebaseChangeCount(1))
+	require.NoError(t, err)
+	require.NoError(t, db.Apply(&test.ChangeItemAdd{ID: "3", Name: "three"}))
+
+	p, err := db.Projection("names")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"one": "1", "two": "2", "three": "3"}, p.(*itemNames).ids)
+
+	// the rebased change is part of the base now
+	require.NoError(t, db.Rebuild(test.NewFactory()))
+	p, err = db.Projection("names")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"one": "1", "two": "2", "three": "3"}, p.(*itemNames).ids)
+}
@@ -0,0 +1,110 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"io"
+	"io/fs"
+
+	tapedb "github.com/simia-tech/tapedb/v2"
+)
+
+// ReadOnlyDatabase is a view of a database that only provides the methods that don't modify it. The
+// deck hands it out to readers that share the database under a read lock.
+type ReadOnlyDatabase[B tapedb.Base, S tapedb.State] struct {
+	db *Database[B, S]
+}
+
+// AsReadOnly returns a read-only view of the database.
+func (db *Database[B, S]) AsReadOnly() *ReadOnlyDatabase[B, S] {
+	return &ReadOnlyDatabase[B, S]{db: db}
+}
+
+func (r *ReadOnlyDatabase[B, S]) Base() B {
+	return r.db.Base()
+}
+
+func (r *ReadOnlyDatabase[B, S]) State() S {
+	return r.db.State()
+}
+
+// View calls fn with the state while it's read-locked. See tapeio.Database.View.
+func (r *ReadOnlyDatabase[B, S]) View(fn func(S) error) error {
+	return r.db.View(fn)
+}
+
+func (r *ReadOnlyDatabase[B, S]) StateHash() []byte {
+	return r.db.StateHash()
+}
+
+func (r *ReadOnlyDatabase[B, S]) Meta() Meta {
+	return r.db.Meta()
+}
+
+func (r *ReadOnlyDatabase[B, S]) ID() string {
+	return r.db.ID()
+}
+
+func (r *ReadOnlyDatabase[B, S]) FormatVersion() int {
+	return r.db.FormatVersion()
+}
+
+func (r *ReadOnlyDatabase[B, S]) Codec() tapedb.Codec {
+	return r.db.Codec()
+}
+
+func (r *ReadOnlyDatabase[B, S]) LogLen() int {
+	return r.db.LogLen()
+}
+
+func (r *ReadOnlyDatabase[B, S]) LogLen64() int64 {
+	return r.db.LogLen64()
+}
+
+func (r *ReadOnlyDatabase[B, S]) LogOffset() int64 {
+	return r.db.LogOffset()
+}
+
+func (r *ReadOnlyDatabase[B, S]) ReadChanges(fn func(int, tapedb.Change) error) error {
+	return r.db.ReadChanges(fn)
+}
+
+func (r *ReadOnlyDatabase[B, S]) Projection(name string) (tapedb.State, error) {
+	return r.db.Projection(name)
+}
+
+func (r *ReadOnlyDatabase[B, S]) OpenPayload(id string) (io.ReadSeekCloser, error) {
+	return r.db.OpenPayload(id)
+}
+
+func (r *ReadOnlyDatabase[B, S]) StatPayload(id string) (fs.FileInfo, error) {
+	return r.db.StatPayload(id)
+}
+
+func (r *ReadOnlyDatabase[B, S]) PayloadInfo(id string) (PayloadInfo, error) {
+	return r.db.PayloadInfo(id)
+}
+
+func (r *ReadOnlyDatabase[B, S]) PayloadMeta(id string) (PayloadMeta, error) {
+	return r.db.PayloadMeta(id)
+}
+
+func (r *ReadOnlyDatabase[B, S]) PayloadIDs() ([]string, error) {
+	return r.db.PayloadIDs()
+}
+
+func (r *ReadOnlyDatabase[B, S]) UnreferencedPayloads() ([]string, error) {
+	return r.db.UnreferencedPayloads()
+}
@@ -0,0 +1,29 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import "github.com/simia-tech/tapedb/v2"
+
+// Rebuild derives the state and the projections again from the base and the log without reopening
+// the database, e.g. after the projection logic of the state has been changed or the state got
+// corrupted. Changes are blocked while the log is read. The old state is kept if the log can't be
+// read. Callers have to call State again to get the rebuilt state.
+func (db *Database[B, S]) Rebuild(f tapedb.Factory[B, S]) error {
+	// a running splice swaps the log
+	db.spliceMutex.Lock()
+	defer db.spliceMutex.Unlock()
+
+	return tapedb.WrapError("rebuild", db.path, db.db.Rebuild(f, db.readChangesFn))
+}
@@ -0,0 +1,88 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestDatabaseRebuild(t *testing.T) {
+	setupFn := func(t *testing.T) (string, func()) {
+		path, removeDir := makeTempDir(t)
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path)
+		require.NoError(t, err)
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 10}))
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 5}))
+		require.NoError(t, db.Close())
+
+		return path, removeDir
+	}
+
+	t.Run("Rebuild", func(t *testing.T) {
+		path, removeDir := setupFn(t)
+		defer removeDir()
+
+		db, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path)
+		require.NoError(t, err)
+		defer db.Close()
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+
+		db.State().Counter = 42
+		require.NoError(t, db.Rebuild(test.NewFactory()))
+		assert.Equal(t, 16, db.State().Counter)
+
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+		assert.Equal(t, 17, db.State().Counter)
+		assert.Equal(t, 4, db.LogLen())
+	})
+
+	t.Run("AfterSpliceInPlace", func(t *testing.T) {
+		path, removeDir := setupFn(t)
+		defer removeDir()
+
+		db, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path)
+		require.NoError(t, err)
+		defer db.Close()
+
+		_, err = db.SpliceInPlace(test.NewFactory(), file.WithRebaseChangeCount(1))
+		require.NoError(t, err)
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+
+		db.State().Counter = 42
+		require.NoError(t, db.Rebuild(test.NewFactory()))
+		assert.Equal(t, 16, db.State().Counter)
+		assert.Equal(t, 2, db.LogLen())
+	})
+
+	t.Run("OpenedAtIndex", func(t *testing.T) {
+		path, removeDir := setupFn(t)
+		defer removeDir()
+
+		db, err := file.OpenDatabaseAt[*test.Base, *test.State](test.NewFactory(), path, 1, file.WithReadOnly())
+		require.NoError(t, err)
+		defer db.Close()
+
+		db.State().Counter = 42
+		require.NoError(t, db.Rebuild(test.NewFactory()))
+		assert.Equal(t, 10, db.State().Counter)
+	})
+}
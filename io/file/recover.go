@@ -0,0 +1,320 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/simia-tech/tapedb/v2"
+)
+
+// ErrInterrupted is returned if the journal of an interrupted swap is found, but the database isn't
+// locked exclusively, so it can't be recovered. The swap might also be still running in another
+// process.
+var ErrInterrupted = tapedb.NewError(tapedb.ErrorCodeLocked, "interrupted splice")
+
+const (
+	journalFieldFile    = "File"
+	journalFieldNewFile = "New-File"
+)
+
+// RecoverAction describes how an interrupted splice has been recovered.
+type RecoverAction int
+
+const (
+	// RecoverNone means that no interrupted splice has been found.
+	RecoverNone RecoverAction = iota
+	// RecoverCompleted means that the new files of a journaled swap have been moved in.
+	RecoverCompleted
+	// RecoverRolledBack means that the new files have been removed and the backups, if any, have
+	// been moved back.
+	RecoverRolledBack
+)
+
+func (a RecoverAction) String() string {
+	switch a {
+	case RecoverNone:
+		return "none"
+	case RecoverCompleted:
+		return "completed"
+	case RecoverRolledBack:
+		return "rolled back"
+	}
+	return fmt.Sprintf("RecoverAction(%d)", int(a))
+}
+
+// RecoverResult describes the recovery of a database.
+type RecoverResult struct {
+	Action       RecoverAction
+	FilesMoved   int
+	FilesRemoved int
+}
+
+type recoverOptions struct {
+	layout Layout
+}
+
+var defaultRecoverOptions = recoverOptions{
+	layout: DefaultLayout,
+}
+
+// RecoverOption defines an option for the recovery of a database.
+type RecoverOption func(*recoverOptions)
+
+// WithRecoverLayout sets the layout of the database.
+func WithRecoverLayout(value Layout) RecoverOption {
+	return func(o *recoverOptions) {
+		o.layout = value
+	}
+}
+
+// RecoverDatabase completes or rolls back a splice of the database at the provided path that has
+// been interrupted by a crash.
+//
+// The new files of a splice are swapped in after a journal has been written that lists them. If the
+// journal is found, the swap is completed, since the new files have been written and verified
+// before. Only if new files are lost as well, the backups of the old files are moved back instead.
+// New files that are found without a journal are left over from a splice that crashed before its
+// swap, so they are removed. The database must not be open while it's recovered, otherwise
+// ErrLocked is returned. Opening a database for writing recovers it as well.
+func RecoverDatabase(path string, opts ...RecoverOption) (RecoverResult, error) {
+	options := defaultRecoverOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	layout := options.layout
+	if err := layout.Validate(); err != nil {
+		return RecoverResult{}, err
+	}
+
+	if err := layout.mustExist(path); err != nil {
+		return RecoverResult{}, err
+	}
+
+	lock, err := layout.lock(path, LockExclusive, 0644)
+	if err != nil {
+		return RecoverResult{}, err
+	}
+	defer lock.unlock()
+
+	return layout.recover(path)
+}
+
+// recoverLocked recovers the database at the provided path, if it's locked exclusively with the
+// provided mode. Otherwise, it only fails with ErrInterrupted, if a journal is found.
+func (l Layout) recoverLocked(path string, mode LockMode) (RecoverResult, error) {
+	if mode == LockExclusive {
+		return l.recover(path)
+	}
+	if _, err := os.Stat(l.JournalPath(path)); err == nil {
+		return RecoverResult{}, ErrInterrupted
+	} else if !os.IsNotExist(err) {
+		return RecoverResult{}, err
+	}
+	return RecoverResult{}, nil
+}
+
+func (l Layout) recover(path string) (RecoverResult, error) {
+	journalPath := l.JournalPath(path)
+	journal, err := ReadMetaFile(journalPath)
+	if os.IsNotExist(err) {
+		return l.removeNewFiles(path)
+	}
+	if err != nil {
+		return RecoverResult{}, fmt.Errorf("read journal: %w", err)
+	}
+
+	names, newNames := journal[journalFieldFile], journal[journalFieldNewFile]
+	if len(names) != len(newNames) {
+		return RecoverResult{}, fmt.Errorf("journal lists %d files and %d new files: %w", len(names), len(newNames), ErrCorrupt)
+	}
+	paths, newPaths := make([]string, len(names)), make([]string, len(names))
+	for index := range names {
+		for _, name := range []string{names[index], newNames[index]} {
+			if name == "" || filepath.Base(name) != name {
+				return RecoverResult{}, fmt.Errorf("journal lists file %q: %w", name, ErrCorrupt)
+			}
+		}
+		paths[index] = filepath.Join(path, names[index])
+		newPaths[index] = filepath.Join(path, newNames[index])
+	}
+
+	// a new file is either still in place or has already been moved over its target
+	complete := true
+	for index := range paths {
+		newExists, err := fileExists(newPaths[index])
+		if err != nil {
+			return RecoverResult{}, err
+		}
+		exists, err := fileExists(paths[index])
+		if err != nil {
+			return RecoverResult{}, err
+		}
+		if !newExists && !exists {
+			complete = false
+			break
+		}
+	}
+
+	result := RecoverResult{Action: RecoverCompleted}
+	if complete {
+		for index, newPath := range newPaths {
+			if err := renameFile(newPath, paths[index]); err == nil {
+				result.FilesMoved++
+			} else if !os.IsNotExist(err) {
+				return RecoverResult{}, fmt.Errorf("move %s: %w", newPath, err)
+			}
+		}
+		for _, p := range paths {
+			if removed, err := removeFile(p + l.BackupSuffix); err != nil {
+				return RecoverResult{}, err
+			} else if removed {
+				result.FilesRemoved++
+			}
+		}
+	} else {
+		result.Action = RecoverRolledBack
+		for _, p := range paths {
+			if err := renameFile(p+l.BackupSuffix, p); err == nil {
+				result.FilesMoved++
+			} else if !os.IsNotExist(err) {
+				return RecoverResult{}, fmt.Errorf("move back %s: %w", p, err)
+			}
+		}
+		for _, newPath := range newPaths {
+			if removed, err := removeFile(newPath); err != nil {
+				return RecoverResult{}, err
+			} else if removed {
+				result.FilesRemoved++
+			}
+		}
+	}
+	if err := syncDir(path); err != nil {
+		return RecoverResult{}, err
+	}
+
+	if err := os.Remove(journalPath); err != nil {
+		return RecoverResult{}, fmt.Errorf("remove journal: %w", err)
+	}
+	return result, syncDir(path)
+}
+
+// removeNewFiles removes the new meta, base and log of a splice that crashed before its swap.
+func (l Layout) removeNewFiles(path string) (RecoverResult, error) {
+	result := RecoverResult{}
+	for _, name := range []string{l.NewMeta, l.NewBase, l.NewLog} {
+		removed, err := removeFile(filepath.Join(path, name))
+		if err != nil {
+			return RecoverResult{}, err
+		}
+		if removed {
+			result.Action = RecoverRolledBack
+			result.FilesRemoved++
+		}
+	}
+	return result, nil
+}
+
+// replaceFiles moves each of the new files over the corresponding target in the database directory
+// at the provided path. The targets are moved to backups first. If any step fails, the already
+// moved files are moved back, so the targets are left untouched.
+//
+// The files are listed in a journal before anything is moved, and the journal is removed after the
+// backups. A crash in between leaves the journal behind, so the swap can be completed by recover.
+// If the targets can't be restored after a failure, ErrInterrupted is returned and the new files
+// have to be kept for the recovery.
+func (l Layout) replaceFiles(path string, newPaths, paths []string) error {
+	journalPath := l.JournalPath(path)
+	journal := Meta{}
+	for index, p := range paths {
+		journal[journalFieldFile] = append(journal[journalFieldFile], filepath.Base(p))
+		journal[journalFieldNewFile] = append(journal[journalFieldNewFile], filepath.Base(newPaths[index]))
+	}
+	if err := WriteMetaFile(journalPath, journal); err != nil {
+		return fmt.Errorf("write journal: %w", err)
+	}
+
+	backupPaths := make([]string, len(paths))
+	restore := func(err error, replaced int) error {
+		// if the restore fails, the journal and the new files are kept for the next recovery
+		for index := 0; index < replaced; index++ {
+			if rErr := renameFile(paths[index], newPaths[index]); rErr != nil {
+				return fmt.Errorf("%w: %w (restore failed: %v)", ErrInterrupted, err, rErr)
+			}
+		}
+		for index, backupPath := range backupPaths {
+			if backupPath == "" {
+				continue
+			}
+			if rErr := renameFile(backupPath, paths[index]); rErr != nil {
+				return fmt.Errorf("%w: %w (restore failed: %v)", ErrInterrupted, err, rErr)
+			}
+		}
+		os.Remove(journalPath)
+		return err
+	}
+
+	for index, p := range paths {
+		backupPath := p + l.BackupSuffix
+		if err := renameFile(p, backupPath); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return restore(err, 0)
+		}
+		backupPaths[index] = backupPath
+	}
+
+	for index, newPath := range newPaths {
+		if err := renameFile(newPath, paths[index]); err != nil {
+			return restore(err, index)
+		}
+	}
+	if err := syncDir(path); err != nil {
+		return err
+	}
+
+	for _, backupPath := range backupPaths {
+		if backupPath == "" {
+			continue
+		}
+		if err := os.Remove(backupPath); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Remove(journalPath); err != nil {
+		return fmt.Errorf("remove journal: %w", err)
+	}
+	return syncDir(path)
+}
+
+func fileExists(path string) (bool, error) {
+	_, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func removeFile(path string) (bool, error) {
+	err := os.Remove(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
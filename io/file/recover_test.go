@@ -0,0 +1,197 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestRecoverDatabase(t *testing.T) {
+	setup := func(t *testing.T) (string, func()) {
+		path, removeDir := makeTempDir(t)
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithCreateKey(testKey))
+		require.NoError(t, err)
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 2}))
+		require.NoError(t, db.Close())
+
+		return path, removeDir
+	}
+
+	// crashSplice lets the renames fail from the one of the provided file on, like a crashed
+	// process would stop renaming.
+	crashSplice := func(t *testing.T, path, name string) {
+		errCrash := errors.New("crash")
+		crashed := false
+		defer file.SetRenameFile(func(oldPath, newPath string) error {
+			if filepath.Base(oldPath) == name {
+				crashed = true
+			}
+			if crashed {
+				return errCrash
+			}
+			return os.Rename(oldPath, newPath)
+		})()
+
+		_, err := file.SpliceDatabase[*test.Base, *test.State](
+			test.NewFactory(), path, file.WithRebaseChangeCount(1),
+			file.WithSourceKey(testKey), file.WithTargetKey(testKey))
+		require.ErrorIs(t, err, errCrash)
+		require.ErrorIs(t, err, file.ErrInterrupted)
+		require.FileExists(t, filepath.Join(path, file.FileNameJournal))
+	}
+
+	assertClean := func(t *testing.T, path string) {
+		for _, name := range []string{
+			file.FileNameJournal, file.FileNameNewMeta, file.FileNameNewBase, file.FileNameNewLog,
+			file.FileNameMeta + file.FileSuffixBackup, file.FileNameBase + file.FileSuffixBackup, file.FileNameLog + file.FileSuffixBackup,
+		} {
+			assert.NoFileExists(t, filepath.Join(path, name))
+		}
+		assert.NoError(t, file.VerifyDatabase(path, file.WithVerifyKey(testKey)))
+	}
+
+	t.Run("Complete", func(t *testing.T) {
+		path, removeDir := setup(t)
+		defer removeDir()
+
+		crashSplice(t, path, file.FileNameNewLog)
+
+		result, err := file.RecoverDatabase(path)
+		require.NoError(t, err)
+		assert.Equal(t, file.RecoverCompleted, result.Action)
+		assert.Equal(t, 2, result.FilesMoved)
+		assert.Equal(t, 2, result.FilesRemoved)
+		assertClean(t, path)
+
+		db, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithOpenKey(testKey))
+		require.NoError(t, err)
+		defer db.Close()
+
+		assert.Equal(t, 1, db.Base().Value)
+		assert.Equal(t, 3, db.State().Counter)
+		assert.Equal(t, 1, db.LogLen())
+	})
+
+	t.Run("CompleteOnOpen", func(t *testing.T) {
+		path, removeDir := setup(t)
+		defer removeDir()
+
+		crashSplice(t, path, file.FileNameNewBase)
+
+		diagnostics := file.OpenDiagnostics{}
+		db, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithOpenKey(testKey),
+			file.WithOpenDiagnosticsFunc(func(value file.OpenDiagnostics) { diagnostics = value }))
+		require.NoError(t, err)
+		assert.Equal(t, file.RecoverCompleted, diagnostics.Recovery)
+		assert.Equal(t, 1, db.Base().Value)
+		assert.Equal(t, 3, db.State().Counter)
+		require.NoError(t, db.Close())
+
+		assertClean(t, path)
+	})
+
+	t.Run("RollBack", func(t *testing.T) {
+		path, removeDir := setup(t)
+		defer removeDir()
+
+		crashSplice(t, path, file.FileNameNewBase)
+		require.NoError(t, os.Remove(filepath.Join(path, file.FileNameNewBase)))
+
+		result, err := file.RecoverDatabase(path)
+		require.NoError(t, err)
+		assert.Equal(t, file.RecoverRolledBack, result.Action)
+		assert.Equal(t, 2, result.FilesMoved)
+		assert.Equal(t, 2, result.FilesRemoved)
+		assertClean(t, path)
+
+		db, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithOpenKey(testKey))
+		require.NoError(t, err)
+		defer db.Close()
+
+		assert.Equal(t, 0, db.Base().Value)
+		assert.Equal(t, 3, db.State().Counter)
+		assert.Equal(t, 2, db.LogLen())
+	})
+
+	t.Run("LeftoverNewFiles", func(t *testing.T) {
+		path, removeDir := setup(t)
+		defer removeDir()
+
+		makeFile(t, filepath.Join(path, file.FileNameNewBase), "partial base")
+		makeFile(t, filepath.Join(path, file.FileNameNewLog), "partial log")
+
+		result, err := file.RecoverDatabase(path)
+		require.NoError(t, err)
+		assert.Equal(t, file.RecoverResult{Action: file.RecoverRolledBack, FilesRemoved: 2}, result)
+		assertClean(t, path)
+
+		_, err = file.SpliceDatabase[*test.Base, *test.State](
+			test.NewFactory(), path, file.WithRebaseChangeCount(1),
+			file.WithSourceKey(testKey), file.WithTargetKey(testKey))
+		require.NoError(t, err)
+	})
+
+	t.Run("Nothing", func(t *testing.T) {
+		path, removeDir := setup(t)
+		defer removeDir()
+
+		result, err := file.RecoverDatabase(path)
+		require.NoError(t, err)
+		assert.Equal(t, file.RecoverResult{}, result)
+	})
+
+	t.Run("ReadOnly", func(t *testing.T) {
+		path, removeDir := setup(t)
+		defer removeDir()
+
+		crashSplice(t, path, file.FileNameNewLog)
+
+		_, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithOpenKey(testKey), file.WithReadOnly())
+		assert.ErrorIs(t, err, file.ErrInterrupted)
+	})
+
+	t.Run("Locked", func(t *testing.T) {
+		path, removeDir := setup(t)
+		defer removeDir()
+
+		db, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithOpenKey(testKey))
+		require.NoError(t, err)
+		defer db.Close()
+
+		_, err = file.RecoverDatabase(path)
+		assert.ErrorIs(t, err, file.ErrLocked)
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		_, err := file.RecoverDatabase(path)
+		assert.ErrorIs(t, err, file.ErrMissing)
+	})
+}
@@ -0,0 +1,120 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file_test
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2"
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+type leaseChange struct {
+	ID  string        `json:"id"`
+	At  time.Time     `json:"at"`
+	TTL time.Duration `json:"ttl"`
+}
+
+func (c *leaseChange) TypeName() string {
+	return "lease"
+}
+
+func (c *leaseChange) ReadFrom(r io.Reader) (int64, error) {
+	return tapedb.ReadJSON(r, c)
+}
+
+func (c *leaseChange) WriteTo(w io.Writer) (int64, error) {
+	return tapedb.WriteJSON(w, c)
+}
+
+func (c *leaseChange) Timestamp() time.Time {
+	return c.At
+}
+
+// leaseState expires each lease after its TTL using the clock it has been given.
+type leaseState struct {
+	clock   tapedb.Clock
+	active  map[string]bool
+	expired []string
+}
+
+func (s *leaseState) SetClock(clock tapedb.Clock) {
+	s.clock = clock
+}
+
+func (s *leaseState) Apply(c tapedb.Change) error {
+	if t, ok := c.(*leaseChange); ok {
+		s.active[t.ID] = true
+		tapedb.ClockOrSystem(s.clock).AfterFunc(t.TTL, func() {
+			delete(s.active, t.ID)
+			s.expired = append(s.expired, t.ID)
+		})
+	}
+	return nil
+}
+
+type leaseFactory struct{}
+
+func (leaseFactory) NewBase() *test.Base {
+	return test.NewBase()
+}
+
+func (leaseFactory) NewState(_ *test.Base, _ sync.Locker) *leaseState {
+	return &leaseState{active: map[string]bool{}}
+}
+
+func (leaseFactory) NewChange(typeName string) (tapedb.Change, error) {
+	if typeName == "lease" {
+		return &leaseChange{}, nil
+	}
+	return nil, fmt.Errorf("change type [%s]: %w", typeName, tapedb.ErrUnknownChangeType)
+}
+
+func TestOpenReplayClock(t *testing.T) {
+	path, removeDir := makeTempDir(t)
+	defer removeDir()
+
+	start := time.Date(2021, time.May, 1, 12, 0, 0, 0, time.UTC)
+
+	db, err := file.CreateDatabase[*test.Base, *leaseState](leaseFactory{}, path)
+	require.NoError(t, err)
+	require.NoError(t, db.Apply(&leaseChange{ID: "a", At: start, TTL: time.Hour}))
+	require.NoError(t, db.Apply(&leaseChange{ID: "b", At: start.Add(30 * time.Minute), TTL: 2 * time.Hour}))
+	require.NoError(t, db.Apply(&leaseChange{ID: "c", At: start.Add(90 * time.Minute), TTL: time.Hour}))
+	require.NoError(t, db.Close())
+
+	clock := tapedb.NewReplayClock(start)
+	db, err = file.OpenDatabase[*test.Base, *leaseState](leaseFactory{}, path, file.WithOpenReplayClock(clock))
+	require.NoError(t, err)
+	defer db.Close()
+
+	assert.Equal(t, start.Add(90*time.Minute), clock.Now())
+	assert.Equal(t, []string{"a"}, db.State().expired)
+	assert.Equal(t, map[string]bool{"b": true, "c": true}, db.State().active)
+
+	err = db.Apply(&leaseChange{ID: "d", At: start.Add(2 * time.Hour), TTL: time.Hour})
+	assert.ErrorIs(t, err, file.ErrReadOnly)
+
+	clock.Sleep(time.Hour)
+	assert.Equal(t, []string{"a", "b", "c"}, db.State().expired)
+}
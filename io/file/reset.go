@@ -0,0 +1,200 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/simia-tech/tapedb/v2"
+)
+
+type resetOptions struct {
+	keyFunc      KeyFunc
+	codecFactory tapedb.CodecFactory
+	layout       Layout
+}
+
+var defaultResetOptions = resetOptions{
+	layout: DefaultLayout,
+}
+
+type ResetOption func(*resetOptions)
+
+func WithResetKey(value []byte) ResetOption {
+	return WithResetKeyFunc(StaticKeyFunc(value))
+}
+
+func WithResetKeyFunc(value KeyFunc) ResetOption {
+	return func(o *resetOptions) {
+		o.keyFunc = value
+	}
+}
+
+// WithResetCodecFactory sets the factory that resolves the codec of the database, if it's not one of
+// the built-in codecs.
+func WithResetCodecFactory(value tapedb.CodecFactory) ResetOption {
+	return func(o *resetOptions) {
+		o.codecFactory = value
+	}
+}
+
+// WithResetLayout sets the layout of the database.
+func WithResetLayout(value Layout) ResetOption {
+	return func(o *resetOptions) {
+		o.layout = value
+	}
+}
+
+// ResetDatabase replaces the base of the database at the provided path with the provided one and
+// empties the log. The meta and the payloads are kept, so an encrypted database keeps its cipher.
+// The database must not be open while it's reset, otherwise ErrLocked is returned.
+func ResetDatabase(path string, base tapedb.Base, opts ...ResetOption) error {
+	options := defaultResetOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	layout := options.layout
+	if err := layout.Validate(); err != nil {
+		return err
+	}
+
+	if err := layout.mustExist(path); err != nil {
+		return err
+	}
+
+	lock, err := layout.lock(path, LockExclusive, 0644)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	if _, err := layout.recover(path); err != nil {
+		return fmt.Errorf("recover: %w", err)
+	}
+
+	meta, err := layout.readMetaFileOrEmpty(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := formatVersionFromMeta(meta); err != nil {
+		return err
+	}
+	c, err := cipherFromMeta(meta)
+	if err != nil {
+		return err
+	}
+
+	key, err := options.keyFunc.deriveKey(meta)
+	if err != nil {
+		return fmt.Errorf("derive key: %w", err)
+	}
+
+	codec, err := tapedb.LookupCodec(options.codecFactory, meta.Get(MetaFieldCodec))
+	if err != nil {
+		return err
+	}
+
+	basePath := layout.BasePath(path)
+	baseFileMode, err := fileModeOrDefault(basePath)
+	if err != nil {
+		return err
+	}
+	logPath := layout.LogPath(path)
+	logFileMode, err := fileModeOrDefault(logPath)
+	if err != nil {
+		return err
+	}
+
+	newBasePath := filepath.Join(path, layout.NewBase)
+	newBaseF, err := createFile(newBasePath, baseFileMode)
+	if err != nil {
+		return fmt.Errorf("create base %s: %w", newBasePath, ErrExisting)
+	}
+	newLogPath := filepath.Join(path, layout.NewLog)
+	newLogF, err := createFile(newLogPath, logFileMode)
+	if err != nil {
+		newBaseF.Close()
+		os.Remove(newBasePath)
+		return fmt.Errorf("create log %s: %w", newLogPath, ErrExisting)
+	}
+
+	swapped := false
+	defer func() {
+		if swapped {
+			return
+		}
+		newBaseF.Close()
+		newLogF.Close()
+		os.Remove(newBasePath)
+		os.Remove(newLogPath)
+	}()
+
+	newBaseChecksumWC := newChecksumWriteCloser(newBaseF)
+	newBaseWC, err := wrapBaseWriter(io.WriteCloser(newBaseChecksumWC), c, key, meta.Get(MetaFieldBaseCompression))
+	if err != nil {
+		return fmt.Errorf("new block writer: %w", err)
+	}
+	if _, err := tapedb.WriteWithCodec(newBaseWC, codec, base); err != nil {
+		return fmt.Errorf("write base: %w", err)
+	}
+	if err := newBaseWC.Close(); err != nil {
+		return err
+	}
+	newBaseF.Close() // ignore the error since the file might be already closed
+	if err := newLogF.Close(); err != nil {
+		return err
+	}
+
+	if err := layout.replaceFiles(
+		path,
+		[]string{newBasePath, newLogPath},
+		[]string{basePath, logPath},
+	); err != nil {
+		swapped = errors.Is(err, ErrInterrupted)
+		return fmt.Errorf("replace base and log: %w", err)
+	}
+	swapped = true
+
+	if err := syncDir(path); err != nil {
+		return err
+	}
+
+	meta.SetBytes(MetaFieldBaseSHA256, newBaseChecksumWC.Sum())
+	if meta.Has(MetaFieldLogLen) || meta.Has(MetaFieldLogSize) {
+		meta.SetUInt64(MetaFieldLogLen, 0)
+		meta.SetUInt64(MetaFieldLogSize, 0)
+	}
+	if err := WriteMetaFile(layout.MetaPath(path), meta); err != nil {
+		return fmt.Errorf("write meta: %w", err)
+	}
+
+	return nil
+}
+
+func fileModeOrDefault(path string) (os.FileMode, error) {
+	stat, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return 0644, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return stat.Mode(), nil
+}
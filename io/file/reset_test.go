@@ -0,0 +1,55 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestResetDatabase(t *testing.T) {
+	t.Run("Encrypted", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithCreateKey(testKey))
+		require.NoError(t, err)
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 2}))
+		require.NoError(t, db.Close())
+
+		require.NoError(t, file.ResetDatabase(path, &test.Base{Value: 7}, file.WithResetKey(testKey)))
+
+		db, err = file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithOpenKey(testKey))
+		require.NoError(t, err)
+		defer db.Close()
+
+		assert.Equal(t, 7, db.Base().Value)
+		assert.Equal(t, 7, db.State().Counter)
+		assert.Equal(t, 0, db.LogLen())
+		assert.NoError(t, file.VerifyDatabase(path, file.WithVerifyKey(testKey)))
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		assert.ErrorIs(t, file.ResetDatabase(path, test.NewBase()), file.ErrMissing)
+	})
+}
@@ -0,0 +1,428 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/simia-tech/tapedb/v2"
+	tapeio "github.com/simia-tech/tapedb/v2/io"
+	"github.com/simia-tech/tapedb/v2/io/crypto"
+)
+
+// MetaFieldRestoreTime holds the time of the restore in a restored database.
+const MetaFieldRestoreTime = "Restore-Time"
+
+type restoreOptions struct {
+	keyFunc        KeyFunc
+	logIndex       int64
+	migrator       tapedb.ChangeMigrator
+	clock          tapedb.Clock
+	payloadWorkers int
+	layout         Layout
+}
+
+var defaultRestoreOptions = restoreOptions{
+	logIndex:       -1,
+	payloadWorkers: 4,
+	layout:         DefaultLayout,
+}
+
+type RestoreOption func(*restoreOptions)
+
+func WithRestoreKey(value []byte) RestoreOption {
+	return WithRestoreKeyFunc(StaticKeyFunc(value))
+}
+
+func WithRestoreKeyFunc(value KeyFunc) RestoreOption {
+	return func(o *restoreOptions) {
+		o.keyFunc = value
+	}
+}
+
+// WithRestoreLogIndex restores the database as of the revision that contains the first logIndex
+// changes of the source log. By default, the whole log is restored.
+func WithRestoreLogIndex(value int64) RestoreOption {
+	return func(o *restoreOptions) {
+		o.logIndex = value
+	}
+}
+
+// WithRestoreMigrations upgrades the encoding of the changes when they are read for the
+// verification. The restored log keeps the original encoding.
+func WithRestoreMigrations(values ...tapedb.ChangeMigrator) RestoreOption {
+	return func(o *restoreOptions) {
+		o.migrator = tapedb.Migrations(values)
+	}
+}
+
+// WithRestorePayloadWorkers sets the number of payloads that are copied concurrently. The default
+// is 4.
+func WithRestorePayloadWorkers(value int) RestoreOption {
+	return func(o *restoreOptions) {
+		o.payloadWorkers = value
+	}
+}
+
+func WithRestoreClock(value tapedb.Clock) RestoreOption {
+	return func(o *restoreOptions) {
+		o.clock = value
+	}
+}
+
+// WithRestoreLayout restores a database in the provided layout into the same layout instead of
+// the default one.
+func WithRestoreLayout(value Layout) RestoreOption {
+	return func(o *restoreOptions) {
+		o.layout = value
+	}
+}
+
+type RestoreResult struct {
+	LogLen   int64
+	LogSize  int64
+	Payloads int
+}
+
+// RestoreDatabase reconstructs the database at sourcePath as of a revision into the new directory
+// at targetPath. The source can be a live database, a snapshot that has been taken after Quiesce or
+// the output of a splice. The base and the selected log entries are copied as they are, together
+// with the payloads referenced by the restored revision. The payloads are copied concurrently and
+// each copy is verified against its info sidecar or chunk manifest. Before the target is moved into
+// place, the hash of its state is compared with the one of the source at the same revision.
+func RestoreDatabase[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](f F, sourcePath, targetPath string, opts ...RestoreOption) (RestoreResult, error) {
+	options := defaultRestoreOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	layout := options.layout
+	if err := layout.mustExist(sourcePath); err != nil {
+		return RestoreResult{}, err
+	}
+	if _, err := os.Stat(targetPath); err == nil {
+		return RestoreResult{}, fmt.Errorf("target %s: %w", targetPath, ErrExisting)
+	} else if !os.IsNotExist(err) {
+		return RestoreResult{}, err
+	}
+
+	meta, err := layout.readMetaFileOrEmpty(sourcePath)
+	if err != nil {
+		return RestoreResult{}, err
+	}
+	if _, err := formatVersionFromMeta(meta); err != nil {
+		return RestoreResult{}, err
+	}
+	c, err := cipherFromMeta(meta)
+	if err != nil {
+		return RestoreResult{}, err
+	}
+	key, err := options.keyFunc.deriveKey(meta)
+	if err != nil {
+		return RestoreResult{}, fmt.Errorf("derive key: %w", err)
+	}
+
+	codec, err := tapedb.LookupCodec(f, meta.Get(MetaFieldCodec))
+	if err != nil {
+		return RestoreResult{}, err
+	}
+
+	// the target is assembled next to its final path, so an aborted restore leaves nothing behind
+	// at the target path
+	tempPath := targetPath + ".restore"
+	if err := os.RemoveAll(tempPath); err != nil {
+		return RestoreResult{}, err
+	}
+	if err := os.MkdirAll(tempPath, 0755); err != nil {
+		return RestoreResult{}, fmt.Errorf("make directory: %w", err)
+	}
+	done := false
+	defer func() {
+		if !done {
+			os.RemoveAll(tempPath)
+		}
+	}()
+
+	if err := copyFileIfExists(layout.BasePath(sourcePath), layout.BasePath(tempPath)); err != nil {
+		return RestoreResult{}, fmt.Errorf("copy base: %w", err)
+	}
+
+	result := RestoreResult{}
+	if result.LogLen, result.LogSize, err = copyLogEntries(
+		layout.LogPath(sourcePath), layout.LogPath(tempPath), options.logIndex); err != nil {
+		return RestoreResult{}, fmt.Errorf("copy log: %w", err)
+	}
+	if options.logIndex >= 0 && result.LogLen < options.logIndex {
+		return RestoreResult{}, fmt.Errorf("log index %d exceeds the log length %d: %w", options.logIndex, result.LogLen, ErrMissing)
+	}
+
+	references, err := readBaseReferences[B, S](f, layout.BasePath(tempPath), c, key, meta.Get(MetaFieldBaseCompression), codec)
+	if err != nil {
+		if errors.Is(err, crypto.ErrInvalidKey) {
+			return RestoreResult{}, ErrInvalidKey
+		}
+		return RestoreResult{}, fmt.Errorf("read base references: %w", err)
+	}
+	err = readChangesFunc[B, S](f, layout.LogPath(tempPath), key, LogDictionaries(meta), options.migrator, codec)(func(_ int, change tapedb.Change) error {
+		references.Track(change)
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, crypto.ErrInvalidKey) {
+			return RestoreResult{}, ErrInvalidKey
+		}
+		return RestoreResult{}, fmt.Errorf("read changes: %w", err)
+	}
+	verify := len(key) > 0 || !meta.Has(MetaHeaderCryptSettings)
+	ids := references.IDs()
+	err = forEachConcurrently(ids, options.payloadWorkers, func(id string) error {
+		if err := layout.restorePayload(sourcePath, tempPath, id); err != nil {
+			return err
+		}
+		if !verify {
+			return nil
+		}
+		v := &verifier{layout: layout, cipher: c, key: key}
+		if err := v.verifyPayload(tempPath, id); err != nil {
+			return fmt.Errorf("verify payload %s: %w", id, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return RestoreResult{}, err
+	}
+	result.Payloads = len(ids)
+
+	textproto.MIMEHeader(meta).Del(MetaFieldBackupTime)
+	meta.SetTime(MetaFieldRestoreTime, tapedb.ClockOrSystem(options.clock).Now())
+	meta.SetUInt64(MetaFieldLogLen, uint64(result.LogLen))
+	meta.SetUInt64(MetaFieldLogSize, uint64(result.LogSize))
+	if err := WriteMetaFile(layout.MetaPath(tempPath), meta); err != nil {
+		return RestoreResult{}, fmt.Errorf("write meta: %w", err)
+	}
+
+	openOpts := []OpenOption{WithOpenKeyFunc(options.keyFunc), WithOpenLayout(layout), func(o *openOptions) {
+		o.migrator = options.migrator
+	}}
+	sourceOpts := openOpts
+	if options.logIndex >= 0 {
+		sourceOpts = append(sourceOpts, WithStopAtIndex(options.logIndex))
+	}
+	sourceHash, err := stateHash[B, S](f, sourcePath, sourceOpts)
+	if err != nil {
+		return RestoreResult{}, fmt.Errorf("replay source: %w", err)
+	}
+	targetHash, err := stateHash[B, S](f, tempPath, openOpts)
+	if err != nil {
+		return RestoreResult{}, fmt.Errorf("replay target: %w", err)
+	}
+	if !bytes.Equal(sourceHash, targetHash) {
+		return RestoreResult{}, fmt.Errorf("verify restore: %w", ErrDiverged)
+	}
+
+	if err := syncDir(tempPath); err != nil {
+		return RestoreResult{}, err
+	}
+	if err := os.Rename(tempPath, targetPath); err != nil {
+		return RestoreResult{}, err
+	}
+	done = true
+
+	if err := syncDir(filepath.Dir(targetPath)); err != nil {
+		return RestoreResult{}, err
+	}
+
+	return result, nil
+}
+
+// restorePayload copies the payload with the provided id together with its info sidecar.
+func (l Layout) restorePayload(sourcePath, targetPath, id string) error {
+	if exists, err := l.payloadExists(sourcePath, id); err != nil {
+		return err
+	} else if !exists {
+		return fmt.Errorf("payload %s: %w", id, ErrPayloadMissing)
+	}
+	if err := l.copyPayloadFiles(sourcePath, targetPath, id); err != nil {
+		return fmt.Errorf("copy payload %s: %w", id, err)
+	}
+	if err := copyFileIfExists(
+		l.PayloadInfoPath(sourcePath, id),
+		l.PayloadInfoPath(targetPath, id)); err != nil {
+		return fmt.Errorf("copy payload info %s: %w", id, err)
+	}
+	return nil
+}
+
+// forEachConcurrently calls fn for each of the provided ids using the provided number of workers.
+// After the first error, no further calls are started and the error is returned.
+func forEachConcurrently(ids []string, workers int, fn func(string) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	idC := make(chan string)
+	errMutex := sync.Mutex{}
+	firstErr := error(nil)
+	failed := func() bool {
+		errMutex.Lock()
+		defer errMutex.Unlock()
+		return firstErr != nil
+	}
+
+	wg := sync.WaitGroup{}
+	for index := 0; index < workers; index++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range idC {
+				if err := fn(id); err != nil {
+					errMutex.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					errMutex.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, id := range ids {
+		if failed() {
+			break
+		}
+		idC <- id
+	}
+	close(idC)
+	wg.Wait()
+
+	return firstErr
+}
+
+// LatestSnapshot returns the path of the snapshot with the latest backup time that isn't after the
+// provided time. The backup time is written into the meta by Quiesce. Paths without a backup time
+// are ignored. If no snapshot qualifies, ErrMissing is returned.
+func LatestSnapshot(paths []string, at time.Time) (string, error) {
+	latestPath, latestTime := "", time.Time{}
+	for _, path := range paths {
+		meta, err := ReadDatabaseMeta(path)
+		if err != nil {
+			return "", fmt.Errorf("read meta of %s: %w", path, err)
+		}
+		backupTime := meta.GetTime(MetaFieldBackupTime, time.Time{})
+		if backupTime.IsZero() || backupTime.After(at) {
+			continue
+		}
+		if latestPath == "" || backupTime.After(latestTime) {
+			latestPath, latestTime = path, backupTime
+		}
+	}
+	if latestPath == "" {
+		return "", ErrMissing
+	}
+	return latestPath, nil
+}
+
+// copyLogEntries copies the first limit entries of the log at sourcePath as they are. A negative
+// limit copies all entries. The number of copied entries and their size is returned.
+func copyLogEntries(sourcePath, targetPath string, limit int64) (int64, int64, error) {
+	sourceF, fileMode, err := mayOpenReadOnlyFile(sourcePath)
+	if err != nil {
+		return 0, 0, err
+	}
+	if sourceF == nil {
+		return 0, 0, nil
+	}
+	defer sourceF.Close()
+
+	targetF, err := createNewLogFile(targetPath, fileMode)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer targetF.Close()
+
+	targetWC := newChecksumWriteCloser(targetF)
+	logW := tapeio.NewLogWriter(targetWC)
+	checksumLogW := tapeio.NewChecksumLogWriter(logW)
+
+	count, size := int64(0), int64(0)
+	err = tapeio.ReadLogEntries(tapeio.NewLogReader(sourceF), func(entry tapeio.LogEntry) error {
+		if limit >= 0 && count >= limit {
+			return errStopCopy
+		}
+
+		r, err := entry.Reader()
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+
+		n := int64(0)
+		if entry.Type() == tapeio.LogEntryTypeBinaryCRC32 {
+			n, err = checksumLogW.WriteEntry(tapeio.LogEntryTypeBinary, data)
+		} else {
+			n, err = logW.WriteEntry(entry.Type(), data)
+		}
+		if err != nil {
+			return err
+		}
+		count++
+		size += n
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopCopy) {
+		return 0, 0, err
+	}
+
+	if err := tapeio.FlushLogWriter(logW); err != nil {
+		return 0, 0, err
+	}
+	if err := targetF.Sync(); err != nil {
+		return 0, 0, err
+	}
+	if err := targetF.Close(); err != nil {
+		return 0, 0, err
+	}
+	return count, size, verifyFile(targetPath, targetWC.Size(), targetWC.Sum())
+}
+
+var errStopCopy = errors.New("stop copy")
+
+func copyFileIfExists(sourcePath, targetPath string) error {
+	sourceF, fileMode, err := mayOpenReadOnlyFile(sourcePath)
+	if err != nil {
+		return err
+	}
+	if sourceF == nil {
+		return nil
+	}
+	defer sourceF.Close()
+
+	return copyFileVerified(sourceF, targetPath, fileMode)
+}
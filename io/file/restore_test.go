@@ -0,0 +1,160 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestRestoreDatabase(t *testing.T) {
+	setupFn := func(t *testing.T, opts ...file.CreateOption) (string, func()) {
+		path, removeDir := makeTempDir(t)
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), filepath.Join(path, "source"), opts...)
+		require.NoError(t, err)
+		require.NoError(t, db.Apply(&test.ChangeAttachPayload{PayloadID: "a"}, file.NewPayload("a", strings.NewReader("one"))))
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+		require.NoError(t, db.Apply(&test.ChangeAttachPayload{PayloadID: "b"}, file.NewPayload("b", strings.NewReader("two"))))
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 2}))
+		require.NoError(t, db.Close())
+
+		return path, removeDir
+	}
+
+	t.Run("LogIndex", func(t *testing.T) {
+		path, removeDir := setupFn(t, file.WithCreateKey(testKey))
+		defer removeDir()
+
+		clock := test.NewClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+		result, err := file.RestoreDatabase[*test.Base, *test.State](test.NewFactory(),
+			filepath.Join(path, "source"), filepath.Join(path, "target"),
+			file.WithRestoreKey(testKey), file.WithRestoreLogIndex(2), file.WithRestoreClock(clock))
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), result.LogLen)
+		assert.Equal(t, 1, result.Payloads)
+
+		assert.FileExists(t, filepath.Join(path, "target", file.FilePrefixPayload+"a"))
+		assert.NoFileExists(t, filepath.Join(path, "target", file.FilePrefixPayload+"b"))
+		assert.NoDirExists(t, filepath.Join(path, "target.restore"))
+
+		meta, err := file.ReadDatabaseMeta(filepath.Join(path, "target"))
+		require.NoError(t, err)
+		assert.Equal(t, "2021-01-01T00:00:00Z", meta.Get(file.MetaFieldRestoreTime))
+
+		logLen, err := file.ReadLogLen64(filepath.Join(path, "target", file.FileNameLog))
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), logLen)
+
+		db, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), filepath.Join(path, "target"),
+			file.WithOpenKey(testKey))
+		require.NoError(t, err)
+		defer db.Close()
+		assert.Equal(t, 1, db.State().Counter)
+	})
+
+	t.Run("Full", func(t *testing.T) {
+		path, removeDir := setupFn(t, file.WithLogChecksum())
+		defer removeDir()
+
+		result, err := file.RestoreDatabase[*test.Base, *test.State](test.NewFactory(),
+			filepath.Join(path, "source"), filepath.Join(path, "target"))
+		require.NoError(t, err)
+		assert.Equal(t, int64(4), result.LogLen)
+		assert.Equal(t, 2, result.Payloads)
+
+		assert.Equal(t,
+			readFile(t, filepath.Join(path, "source", file.FileNameLog)),
+			readFile(t, filepath.Join(path, "target", file.FileNameLog)))
+
+		equal, err := file.CompareDatabases[*test.Base, *test.State](test.NewFactory(),
+			filepath.Join(path, "source"), filepath.Join(path, "target"), nil, nil)
+		require.NoError(t, err)
+		assert.True(t, equal)
+	})
+
+	t.Run("CorruptPayload", func(t *testing.T) {
+		path, removeDir := setupFn(t, file.WithPayloadInfo())
+		defer removeDir()
+
+		makeFile(t, filepath.Join(path, "source", file.FilePrefixPayload+"b"), "tw")
+
+		_, err := file.RestoreDatabase[*test.Base, *test.State](test.NewFactory(),
+			filepath.Join(path, "source"), filepath.Join(path, "target"), file.WithRestorePayloadWorkers(2))
+		require.Error(t, err)
+		corruptionErr := (*file.CorruptionError)(nil)
+		require.ErrorAs(t, err, &corruptionErr)
+		assert.Equal(t, file.FilePrefixPayload+"b", corruptionErr.FileName)
+
+		assert.NoDirExists(t, filepath.Join(path, "target"))
+		assert.NoDirExists(t, filepath.Join(path, "target.restore"))
+	})
+
+	t.Run("ExistingTarget", func(t *testing.T) {
+		path, removeDir := setupFn(t)
+		defer removeDir()
+
+		require.NoError(t, os.MkdirAll(filepath.Join(path, "target"), 0755))
+
+		_, err := file.RestoreDatabase[*test.Base, *test.State](test.NewFactory(),
+			filepath.Join(path, "source"), filepath.Join(path, "target"))
+		assert.ErrorIs(t, err, file.ErrExisting)
+	})
+
+	t.Run("LogIndexTooHigh", func(t *testing.T) {
+		path, removeDir := setupFn(t)
+		defer removeDir()
+
+		_, err := file.RestoreDatabase[*test.Base, *test.State](test.NewFactory(),
+			filepath.Join(path, "source"), filepath.Join(path, "target"), file.WithRestoreLogIndex(5))
+		assert.ErrorIs(t, err, file.ErrMissing)
+		assert.NoDirExists(t, filepath.Join(path, "target"))
+		assert.NoDirExists(t, filepath.Join(path, "target.restore"))
+	})
+}
+
+func TestLatestSnapshot(t *testing.T) {
+	path, removeDir := makeTempDir(t)
+	defer removeDir()
+
+	paths := []string{}
+	for _, backupTime := range []string{"2021-01-01T00:00:00Z", "2021-01-03T00:00:00Z", "2021-01-02T00:00:00Z", ""} {
+		snapshotPath := filepath.Join(path, "snapshot-"+backupTime)
+		meta := file.Meta{}
+		if backupTime != "" {
+			meta.Set(file.MetaFieldBackupTime, backupTime)
+		}
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), snapshotPath, file.WithMeta(meta))
+		require.NoError(t, err)
+		require.NoError(t, db.Close())
+		paths = append(paths, snapshotPath)
+	}
+
+	snapshotPath, err := file.LatestSnapshot(paths, time.Date(2021, 1, 2, 12, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, paths[2], snapshotPath)
+
+	_, err = file.LatestSnapshot(paths, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.ErrorIs(t, err, file.ErrMissing)
+}
@@ -0,0 +1,70 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"fmt"
+
+	"github.com/simia-tech/tapedb/v2"
+)
+
+// Revert appends the inverses of the last n changes to the log, so the state is the same as before
+// these changes. Nothing is applied if one of the changes isn't tapedb.Invertible. Changes that are
+// applied while the log is read aren't reverted.
+func (db *Database[B, S]) Revert(n int) error {
+	return tapedb.WrapError("revert", db.path, db.revert(n))
+}
+
+func (db *Database[B, S]) revert(n int) error {
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	if n <= 0 {
+		return nil
+	}
+
+	if err := db.db.Flush(); err != nil {
+		return err
+	}
+
+	logLen := db.LogLen()
+	if n > logLen {
+		return fmt.Errorf("revert %d of %d changes: %w", n, logLen, ErrMissing)
+	}
+
+	start, changes := logLen-n, make([]tapedb.Change, 0, n)
+	err := db.ReadChanges(func(logIndex int, change tapedb.Change) error {
+		if logIndex >= start && logIndex < logLen {
+			changes = append(changes, change)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("read changes: %w", err)
+	}
+
+	inverses, err := tapedb.InvertChanges(changes)
+	if err != nil {
+		return err
+	}
+
+	for _, inverse := range inverses {
+		if err := db.Apply(inverse); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
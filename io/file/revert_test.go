@@ -0,0 +1,71 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2"
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestDatabaseRevert(t *testing.T) {
+	setupFn := func(t *testing.T) (*file.Database[*test.Base, *test.State], func()) {
+		path, removeDir := makeTempDir(t)
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path)
+		require.NoError(t, err)
+		require.NoError(t, db.Apply(&test.ChangeCounterSet{Value: 10}))
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 5}))
+		require.NoError(t, db.Apply(&test.ChangeCounterDec{Value: 2}))
+
+		return db, func() {
+			db.Close()
+			removeDir()
+		}
+	}
+
+	t.Run("Revert", func(t *testing.T) {
+		db, tearDown := setupFn(t)
+		defer tearDown()
+
+		require.NoError(t, db.Revert(2))
+
+		assert.Equal(t, 10, db.State().Counter)
+		assert.Equal(t, 5, db.LogLen())
+	})
+
+	t.Run("NotInvertible", func(t *testing.T) {
+		db, tearDown := setupFn(t)
+		defer tearDown()
+
+		err := db.Revert(3)
+		assert.ErrorIs(t, err, tapedb.ErrNotInvertible)
+
+		assert.Equal(t, 13, db.State().Counter)
+		assert.Equal(t, 3, db.LogLen())
+	})
+
+	t.Run("ExceedingLogLen", func(t *testing.T) {
+		db, tearDown := setupFn(t)
+		defer tearDown()
+
+		assert.ErrorIs(t, db.Revert(4), file.ErrMissing)
+	})
+}
@@ -0,0 +1,213 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/simia-tech/tapedb/v2"
+	tapeio "github.com/simia-tech/tapedb/v2/io"
+	"github.com/simia-tech/tapedb/v2/io/crypto"
+)
+
+// liveSplice connects a splice to the open database whose files are spliced.
+type liveSplice[B tapedb.Base] struct {
+	// logSize is the size of the log when the splice started. The entries up to that size are
+	// spliced in the background.
+	logSize int64
+	// catchUp blocks the database and appends the changes that have been applied since the splice
+	// started to the new log. The payloads referenced by them are tracked as well.
+	catchUp func(logW tapeio.LogWriter, references tapedb.PayloadReferences, key []byte, dictionaries [][]byte) (int, int64, error)
+	// prepare opens the new log for the database before it's swapped in.
+	prepare func(newLogPath string, meta Meta) error
+	// swap hands the new base and log to the database after they've been swapped in.
+	swap func(base B, logLen, logSize int64, meta Meta)
+}
+
+// SpliceInPlace splices the database like SpliceDatabase, but keeps it open. The base and the log
+// are spliced up to the current end of the log in the background, while the state can be read and
+// changes can be applied. Afterwards, the changes that have been applied meanwhile are appended to
+// the new log and the new files are swapped in. Applies are blocked during this catch-up and
+// continue on the new log once the new files are in place.
+//
+// The key of an open database can't be changed, so a target key that differs from the key of the
+// database fails with errors.ErrUnsupported. Payloads that have been written during the splice are
+// kept, even if they aren't referenced yet. Close and SetMeta wait until a running splice is done.
+func (db *Database[B, S]) SpliceInPlace(f tapedb.Factory[B, S], opts ...SpliceOption) (SpliceResult, error) {
+	options := defaultSpliceOptions
+	options.targetKeyFunc = StaticKeyFunc(db.key)
+	options.clock = db.clock
+	options.observer = db.observer
+	options.layout = db.layout
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	clock := tapedb.ClockOrSystem(options.clock)
+	start := clock.Now()
+	result, err := db.spliceInPlace(f, options, clock, start)
+	err = tapedb.WrapError("splice", db.path, err)
+	ObserverOrNop(options.observer).OnSplice(SpliceEvent{
+		Path:     db.path,
+		Result:   result,
+		Duration: clock.Now().Sub(start),
+		Err:      err,
+	})
+	return result, err
+}
+
+func (db *Database[B, S]) spliceInPlace(f tapedb.Factory[B, S], options spliceOptions, clock tapedb.Clock, start time.Time) (SpliceResult, error) {
+	if db.readOnly {
+		return SpliceResult{}, ErrReadOnly
+	}
+
+	targetKey, err := options.targetKeyFunc.deriveKey(db.meta)
+	if err != nil {
+		return SpliceResult{}, fmt.Errorf("derive target key: %w", err)
+	}
+	if !bytes.Equal(targetKey, db.key) {
+		return SpliceResult{}, fmt.Errorf("change the key of an open database: %w", errors.ErrUnsupported)
+	}
+	options.sourceKeyFunc = StaticKeyFunc(db.key)
+	options.targetKeyFunc = StaticKeyFunc(db.key)
+	options.layout = db.layout
+
+	db.spliceMutex.Lock()
+	defer db.spliceMutex.Unlock()
+
+	// the log is synced, so the entries up to the current offset can be read from the file
+	db.quiesceMutex.Lock()
+	err = db.Sync()
+	logSize := db.LogOffset()
+	db.quiesceMutex.Unlock()
+	if err != nil {
+		return SpliceResult{}, fmt.Errorf("sync log: %w", err)
+	}
+
+	payloadIDs, err := db.layout.readPayloadIDs(db.path)
+	if err != nil {
+		return SpliceResult{}, err
+	}
+
+	quiesced := false
+	newLogF, newLogSyncW, newLogW := (*os.File)(nil), (*syncLogWriter)(nil), tapeio.LogWriter(nil)
+	defer func() {
+		if newLogF != nil {
+			newLogF.Close()
+		}
+		if quiesced {
+			db.quiesceMutex.Unlock()
+		}
+	}()
+
+	live := &liveSplice[B]{
+		logSize: logSize,
+		catchUp: func(logW tapeio.LogWriter, references tapedb.PayloadReferences, key []byte, dictionaries [][]byte) (int, int64, error) {
+			db.quiesceMutex.Lock()
+			quiesced = true
+
+			if err := db.Sync(); err != nil {
+				return 0, 0, fmt.Errorf("sync log: %w", err)
+			}
+
+			// payloads that have been written meanwhile might be referenced by the next changes
+			ids, err := db.layout.readPayloadIDs(db.path)
+			if err != nil {
+				return 0, 0, err
+			}
+			existing := tapedb.PayloadReferences{}
+			existing.Add(payloadIDs...)
+			for _, id := range ids {
+				if !existing.Has(id) {
+					references.Add(id)
+				}
+			}
+
+			logF, err := os.Open(db.layout.LogPath(db.path))
+			if err != nil {
+				return 0, 0, err
+			}
+			defer logF.Close()
+
+			logR, err := tapeio.NewLogReaderAt(logF, logSize)
+			if err != nil {
+				return 0, 0, err
+			}
+			wrappedLogR, err := wrapLogReader(logR, key, dictionaries)
+			if err != nil {
+				return 0, 0, fmt.Errorf("new log reader: %w", err)
+			}
+
+			return tapeio.CopyChanges[B, S](f, logW, wrappedLogR, func(change tapedb.Change) error {
+				references.Track(change)
+				return nil
+			}, tapeio.WithMigrator(options.migrator), tapeio.WithCodec(db.codec))
+		},
+		prepare: func(newLogPath string, meta Meta) error {
+			f, err := os.OpenFile(newLogPath, os.O_RDWR, 0)
+			if err != nil {
+				return err
+			}
+			newLogF = f
+			if _, err := f.Seek(0, io.SeekEnd); err != nil {
+				return err
+			}
+
+			newLogSyncW = newSyncLogWriter(f, db.logSyncW.policy, db.logSyncW.deferred, db.logSyncW.clock)
+			logW, err := wrapCompressLogWriter(wrapChecksumLogWriter(newLogSyncW, meta, db.key), meta, db.key)
+			if err != nil {
+				return fmt.Errorf("new log writer: %w", err)
+			}
+			if newLogW, err = crypto.WrapLogWriterWithCipher(logW, db.cipher, db.key, NonceFn); err != nil {
+				return fmt.Errorf("new log writer: %w", err)
+			}
+			return nil
+		},
+		swap: func(base B, logLen, logSize int64, meta Meta) {
+			oldLogSyncW, oldLogCloseFn := db.logSyncW, db.logCloseFn
+
+			db.db.Rebase(base, newLogW, logLen, logSize)
+			db.logSyncW, db.logCloseFn = newLogSyncW, newLogF.Close
+			db.meta = meta
+			db.readChangesFn = readChangesFunc[B, S](f, db.layout.LogPath(db.path), db.key, LogDictionaries(meta), db.migrator, db.codec)
+			newLogF = nil
+
+			// the old log has been synced by the catch-up and is gone already
+			oldLogSyncW.Close()
+			oldLogCloseFn()
+		},
+	}
+
+	result, err := spliceDatabase[B, S](f, db.path, options, clock, start, live)
+	if errors.Is(err, ErrInterrupted) {
+		// the old log might be gone, so further changes must not be written to it. Reopening the
+		// database recovers the splice.
+		db.logCloseFn()
+	}
+	if err != nil {
+		return result, err
+	}
+
+	// the splice stats have been written to the meta file after the swap
+	if meta, err := ReadMetaFile(db.layout.MetaPath(db.path)); err == nil {
+		db.meta = meta
+	}
+	return result, nil
+}
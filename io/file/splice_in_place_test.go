@@ -0,0 +1,201 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file_test
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2"
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestDatabaseSpliceInPlace(t *testing.T) {
+	setup := func(t *testing.T) (string, *file.Database[*test.Base, *test.State], func()) {
+		path, removeDir := makeTempDir(t)
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithCreateKey(testKey))
+		require.NoError(t, err)
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 2}))
+
+		return path, db, func() {
+			db.Close()
+			removeDir()
+		}
+	}
+
+	reopen := func(t *testing.T, path string) *file.Database[*test.Base, *test.State] {
+		require.NoError(t, file.VerifyDatabase(path, file.WithVerifyKey(testKey)))
+		db, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithOpenKey(testKey))
+		require.NoError(t, err)
+		return db
+	}
+
+	t.Run("Open", func(t *testing.T) {
+		path, db, teardown := setup(t)
+		defer teardown()
+
+		result, err := db.SpliceInPlace(test.NewFactory(), file.WithRebaseChangeCount(1))
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.EntriesRebased)
+		assert.Equal(t, 1, result.EntriesCopied)
+
+		assert.Equal(t, 1, db.Base().Value)
+		assert.Equal(t, 3, db.State().Counter)
+		assert.Equal(t, 1, db.LogLen())
+
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 3}))
+		assert.Equal(t, 6, db.State().Counter)
+		require.NoError(t, db.Close())
+
+		db = reopen(t, path)
+		defer db.Close()
+
+		assert.Equal(t, 1, db.Base().Value)
+		assert.Equal(t, 6, db.State().Counter)
+		assert.Equal(t, 2, db.LogLen())
+	})
+
+	t.Run("ApplyDuringSplice", func(t *testing.T) {
+		path, db, teardown := setup(t)
+		defer teardown()
+
+		_, err := db.SpliceInPlace(test.NewFactory(), file.WithRebaseChangeSelectFunc(func(_ tapedb.Change, logIndex int) (bool, error) {
+			if logIndex == 0 {
+				if err := db.Apply(&test.ChangeCounterInc{Value: 10}); err != nil {
+					return false, err
+				}
+				if err := db.Apply(&test.ChangeCounterInc{Value: 20}); err != nil {
+					return false, err
+				}
+			}
+			return logIndex < 1, nil
+		}))
+		require.NoError(t, err)
+
+		assert.Equal(t, 1, db.Base().Value)
+		assert.Equal(t, 33, db.State().Counter)
+		assert.Equal(t, 3, db.LogLen())
+		require.NoError(t, db.Close())
+
+		db = reopen(t, path)
+		defer db.Close()
+
+		assert.Equal(t, 1, db.Base().Value)
+		assert.Equal(t, 33, db.State().Counter)
+		assert.Equal(t, 3, db.LogLen())
+	})
+
+	t.Run("ConcurrentApplies", func(t *testing.T) {
+		path, db, teardown := setup(t)
+		defer teardown()
+
+		wg := sync.WaitGroup{}
+		for index := 0; index < 4; index++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for count := 0; count < 50; count++ {
+					assert.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+				}
+			}()
+		}
+		for index := 0; index < 3; index++ {
+			_, err := db.SpliceInPlace(test.NewFactory(), file.WithRebaseChangeCount(10))
+			require.NoError(t, err)
+		}
+		wg.Wait()
+
+		assert.Equal(t, 203, db.State().Counter)
+		require.NoError(t, db.Close())
+
+		db = reopen(t, path)
+		defer db.Close()
+
+		assert.Equal(t, 203, db.State().Counter)
+	})
+
+	t.Run("PayloadWrittenDuringSplice", func(t *testing.T) {
+		path, db, teardown := setup(t)
+		defer teardown()
+
+		require.NoError(t, db.WritePayload(file.NewPayload("old", strings.NewReader("old content"))))
+
+		_, err := db.SpliceInPlace(test.NewFactory(), file.WithRebaseChangeSelectFunc(func(_ tapedb.Change, logIndex int) (bool, error) {
+			if logIndex == 0 {
+				if err := db.WritePayload(file.NewPayload("new", strings.NewReader("new content"))); err != nil {
+					return false, err
+				}
+			}
+			return true, nil
+		}))
+		require.NoError(t, err)
+
+		assert.NoFileExists(t, filepath.Join(path, file.FilePrefixPayload+"old"))
+		assert.FileExists(t, filepath.Join(path, file.FilePrefixPayload+"new"))
+
+		require.NoError(t, db.Apply(&test.ChangeAttachPayload{PayloadID: "new"}))
+	})
+
+	t.Run("FailingSplice", func(t *testing.T) {
+		path, db, teardown := setup(t)
+		defer teardown()
+
+		errTest := errors.New("test")
+		_, err := db.SpliceInPlace(test.NewFactory(), file.WithRebaseChangeSelectFunc(func(tapedb.Change, int) (bool, error) {
+			return false, errTest
+		}))
+		require.ErrorIs(t, err, errTest)
+
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 3}))
+		assert.Equal(t, 3, db.LogLen())
+		require.NoError(t, db.Close())
+
+		db = reopen(t, path)
+		defer db.Close()
+
+		assert.Equal(t, 6, db.State().Counter)
+	})
+
+	t.Run("KeyChange", func(t *testing.T) {
+		_, db, teardown := setup(t)
+		defer teardown()
+
+		_, err := db.SpliceInPlace(test.NewFactory(), file.WithTargetKey(make([]byte, len(testKey))))
+		assert.ErrorIs(t, err, errors.ErrUnsupported)
+	})
+
+	t.Run("ReadOnly", func(t *testing.T) {
+		path, db, teardown := setup(t)
+		defer teardown()
+		require.NoError(t, db.Close())
+
+		db, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path,
+			file.WithOpenKey(testKey), file.WithReadOnly())
+		require.NoError(t, err)
+		defer db.Close()
+
+		_, err = db.SpliceInPlace(test.NewFactory())
+		assert.ErrorIs(t, err, file.ErrReadOnly)
+	})
+}
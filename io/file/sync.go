@@ -0,0 +1,162 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	tapedb "github.com/simia-tech/tapedb/v2"
+	tapeio "github.com/simia-tech/tapedb/v2/io"
+)
+
+type syncMode int
+
+const (
+	syncModeAlways syncMode = iota
+	syncModeInterval
+	syncModeNever
+)
+
+// SyncPolicy controls when the log file is synced to the storage.
+type SyncPolicy struct {
+	mode     syncMode
+	interval time.Duration
+}
+
+var (
+	// SyncAlways syncs the log after each applied change.
+	SyncAlways = SyncPolicy{mode: syncModeAlways}
+	// SyncNever leaves syncing to the operating system. Database.Sync can be used to sync
+	// explicitly.
+	SyncNever = SyncPolicy{mode: syncModeNever}
+)
+
+// SyncInterval syncs the log at most once per interval. Changes that are applied within the
+// interval before a crash might be lost.
+func SyncInterval(interval time.Duration) SyncPolicy {
+	return SyncPolicy{mode: syncModeInterval, interval: interval}
+}
+
+type syncLogWriter struct {
+	w        tapeio.LogWriter
+	f        *os.File
+	policy   SyncPolicy
+	deferred bool
+	clock    tapedb.Clock
+	timer    tapedb.Timer
+	dirty    bool
+	mutex    sync.Mutex
+}
+
+var _ tapeio.LogWriter = &syncLogWriter{}
+
+// newSyncLogWriter returns a log writer that syncs according to the provided policy. If deferred
+// is true, entries are buffered and the policy is applied on Flush rather than after each entry.
+func newSyncLogWriter(f *os.File, policy SyncPolicy, deferred bool, clock tapedb.Clock) *syncLogWriter {
+	w := &syncLogWriter{
+		f:        f,
+		policy:   policy,
+		deferred: deferred,
+		clock:    tapedb.ClockOrSystem(clock),
+	}
+	if deferred {
+		w.w = tapeio.NewBufferedLogWriter(f)
+	} else {
+		w.w = tapeio.NewLogWriter(f)
+	}
+	return w
+}
+
+func (w *syncLogWriter) WriteEntry(et tapeio.LogEntryType, data []byte) (int64, error) {
+	n, err := w.w.WriteEntry(et, data)
+	if err != nil {
+		return n, err
+	}
+
+	if w.deferred {
+		return n, nil
+	}
+
+	return n, w.applyPolicy()
+}
+
+func (w *syncLogWriter) Flush() error {
+	if err := tapeio.FlushLogWriter(w.w); err != nil {
+		return err
+	}
+
+	if w.deferred {
+		return w.applyPolicy()
+	}
+
+	return nil
+}
+
+func (w *syncLogWriter) applyPolicy() error {
+	switch w.policy.mode {
+	case syncModeAlways:
+		return w.f.Sync()
+	case syncModeInterval:
+		w.mutex.Lock()
+		w.dirty = true
+		if w.timer == nil {
+			w.timer = w.clock.AfterFunc(w.policy.interval, func() {
+				w.Sync()
+			})
+		}
+		w.mutex.Unlock()
+	}
+
+	return nil
+}
+
+func (w *syncLogWriter) Sync() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	w.dirty = false
+
+	return w.f.Sync()
+}
+
+// Close flushes and syncs pending writes. The file itself is not closed.
+func (w *syncLogWriter) Close() error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	w.mutex.Lock()
+	dirty := w.dirty
+	w.mutex.Unlock()
+
+	if dirty {
+		return w.Sync()
+	}
+
+	w.mutex.Lock()
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	w.mutex.Unlock()
+
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestSyncPolicy(t *testing.T) {
+	for name, policy := range map[string]file.SyncPolicy{
+		"Always":   file.SyncAlways,
+		"Interval": file.SyncInterval(time.Millisecond),
+		"Never":    file.SyncNever,
+	} {
+		t.Run(name, func(t *testing.T) {
+			path, removeDir := makeTempDir(t)
+			defer removeDir()
+
+			db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithCreateSyncPolicy(policy))
+			require.NoError(t, err)
+			require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 2}))
+			require.NoError(t, db.Sync())
+			require.NoError(t, db.Close())
+
+			db, err = file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithOpenSyncPolicy(policy))
+			require.NoError(t, err)
+			require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 3}))
+			time.Sleep(2 * time.Millisecond)
+			require.NoError(t, db.Close())
+
+			db, err = file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithReadOnly())
+			require.NoError(t, err)
+			defer db.Close()
+
+			assert.Equal(t, 5, db.State().Counter)
+			assert.NoError(t, db.Sync())
+		})
+	}
+}
+
+func TestGroupCommit(t *testing.T) {
+	path, removeDir := makeTempDir(t)
+	defer removeDir()
+
+	db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithCreateGroupCommit())
+	require.NoError(t, err)
+
+	wg := sync.WaitGroup{}
+	for index := 0; index < 20; index++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+		}()
+	}
+	wg.Wait()
+	require.NoError(t, db.Close())
+
+	db, err = file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithOpenGroupCommit())
+	require.NoError(t, err)
+	require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 2}))
+	require.NoError(t, db.Close())
+
+	db, err = file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithReadOnly())
+	require.NoError(t, err)
+	defer db.Close()
+
+	assert.Equal(t, 22, db.State().Counter)
+	assert.Equal(t, 21, db.LogLen())
+}
@@ -0,0 +1,216 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	tapeio "github.com/simia-tech/tapedb/v2/io"
+)
+
+// TailPosition describes how far a tail session has read a database log. The index counts all
+// changes since the creation of the database including those that have been rebased by splices.
+type TailPosition struct {
+	Generation uint64
+	Index      int64
+	Offset     int64
+}
+
+type tailOptions struct {
+	keyFunc    KeyFunc
+	position   *TailPosition
+	spliceFunc func(int64)
+	layout     Layout
+}
+
+var defaultTailOptions = tailOptions{
+	layout: DefaultLayout,
+}
+
+type TailOption func(*tailOptions)
+
+func WithTailKey(value []byte) TailOption {
+	return WithTailKeyFunc(StaticKeyFunc(value))
+}
+
+func WithTailKeyFunc(value KeyFunc) TailOption {
+	return func(o *tailOptions) {
+		o.keyFunc = value
+	}
+}
+
+// WithTailPosition resumes the session at the provided position.
+func WithTailPosition(value TailPosition) TailOption {
+	return func(o *tailOptions) {
+		o.position = &value
+	}
+}
+
+// WithTailSpliceFunc sets a function that is called if a splice of the database has been detected.
+// The argument is the number of changes that have been rebased without being read by the session.
+func WithTailSpliceFunc(value func(int64)) TailOption {
+	return func(o *tailOptions) {
+		o.spliceFunc = value
+	}
+}
+
+// WithTailLayout sets the layout of the database.
+func WithTailLayout(value Layout) TailOption {
+	return func(o *tailOptions) {
+		o.layout = value
+	}
+}
+
+// TailSession reads the entries that are appended to the log of a database. Splices are detected
+// via the splice generation in the meta, so the session resumes in the new log without emitting
+// entries twice.
+type TailSession struct {
+	path       string
+	keyFunc    KeyFunc
+	spliceFunc func(int64)
+	layout     Layout
+	position   TailPosition
+	logInfo    os.FileInfo
+}
+
+// NewTailSession returns a session that starts at the beginning of the current log of the database
+// at the provided path.
+func NewTailSession(path string, opts ...TailOption) (*TailSession, error) {
+	options := defaultTailOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	s := &TailSession{
+		path:       path,
+		keyFunc:    options.keyFunc,
+		spliceFunc: options.spliceFunc,
+		layout:     options.layout,
+	}
+
+	if options.position != nil {
+		s.position = *options.position
+	} else {
+		meta, err := options.layout.readMetaFileOrEmpty(path)
+		if err != nil {
+			return nil, err
+		}
+		s.position = TailPosition{
+			Generation: meta.GetUInt64(MetaFieldSpliceGeneration, 0),
+			Index:      int64(meta.GetUInt64(MetaFieldSpliceRebasedTotal, 0)),
+		}
+	}
+
+	return s, nil
+}
+
+// Position returns the current position of the session.
+func (s *TailSession) Position() TailPosition {
+	return s.position
+}
+
+// Read calls fn for each complete entry that has been appended to the log since the last read and
+// returns the number of read entries.
+func (s *TailSession) Read(fn func(tapeio.LogEntry) error) (int, error) {
+	meta, err := s.layout.readMetaFileOrEmpty(s.path)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := formatVersionFromMeta(meta); err != nil {
+		return 0, err
+	}
+	generation := meta.GetUInt64(MetaFieldSpliceGeneration, 0)
+	rebasedTotal := int64(meta.GetUInt64(MetaFieldSpliceRebasedTotal, 0))
+
+	logF, _, err := mayOpenReadOnlyFile(s.layout.LogPath(s.path))
+	if err != nil {
+		return 0, err
+	}
+	if logF == nil {
+		return 0, nil
+	}
+	defer logF.Close()
+
+	logInfo, err := logF.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	if s.logInfo != nil && !os.SameFile(s.logInfo, logInfo) && generation == s.position.Generation {
+		// the log has been replaced, but the meta of the splice is not written yet
+		return 0, nil
+	}
+	s.logInfo = logInfo
+
+	skip := int64(0)
+	if generation != s.position.Generation {
+		skip = s.position.Index - rebasedTotal
+		if skip < 0 {
+			if s.spliceFunc != nil {
+				s.spliceFunc(-skip)
+			}
+			s.position.Index = rebasedTotal
+			skip = 0
+		} else if s.spliceFunc != nil {
+			s.spliceFunc(0)
+		}
+		s.position.Generation = generation
+		s.position.Offset = 0
+	}
+
+	key, err := s.keyFunc.deriveKey(meta)
+	if err != nil {
+		return 0, fmt.Errorf("derive key: %w", err)
+	}
+
+	fileR, err := tapeio.NewLogReaderAt(logF, s.position.Offset)
+	if err != nil {
+		return 0, err
+	}
+
+	logR, err := wrapLogReader(fileR, key, LogDictionaries(meta))
+	if err != nil {
+		return 0, fmt.Errorf("new log reader: %w", err)
+	}
+
+	read := 0
+	for {
+		entry, err := logR.ReadEntry()
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return read, nil
+		}
+		if err != nil {
+			return read, fmt.Errorf("read entry: %w", err)
+		}
+		if fileR.Offset() > logInfo.Size() {
+			// the entry is still being written
+			return read, nil
+		}
+
+		if skip > 0 {
+			skip--
+		} else {
+			if err := fn(entry); err != nil {
+				return read, err
+			}
+			s.position.Index++
+			read++
+		}
+		s.position.Offset = fileR.Offset()
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file_test
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	tapeio "github.com/simia-tech/tapedb/v2/io"
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestTailSession(t *testing.T) {
+	readAll := func(t *testing.T, session *file.TailSession) []string {
+		entries := []string{}
+		_, err := session.Read(func(entry tapeio.LogEntry) error {
+			r, err := entry.Reader()
+			if err != nil {
+				return err
+			}
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, string(data[1:]))
+			return nil
+		})
+		require.NoError(t, err)
+		return entries
+	}
+
+	apply := func(t *testing.T, path string, values ...int) {
+		db, err := file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path)
+		require.NoError(t, err)
+		for _, value := range values {
+			require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: value}))
+		}
+		require.NoError(t, db.Close())
+	}
+
+	t.Run("AcrossSplice", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path)
+		require.NoError(t, err)
+		require.NoError(t, db.Close())
+		apply(t, path, 1, 2)
+
+		splices := []int64{}
+		session, err := file.NewTailSession(path, file.WithTailSpliceFunc(func(missed int64) {
+			splices = append(splices, missed)
+		}))
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"counter-inc{\"value\":1}\n", "counter-inc{\"value\":2}\n"}, readAll(t, session))
+
+		apply(t, path, 3)
+		_, err = file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithRebaseChangeCount(2))
+		require.NoError(t, err)
+		apply(t, path, 4)
+
+		assert.Equal(t, []string{"counter-inc{\"value\":3}\n", "counter-inc{\"value\":4}\n"}, readAll(t, session))
+		assert.Equal(t, []int64{0}, splices)
+		assert.Equal(t, file.TailPosition{Generation: 1, Index: 4, Offset: 56}, session.Position())
+
+		assert.Empty(t, readAll(t, session))
+	})
+
+	t.Run("MissedChanges", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path)
+		require.NoError(t, err)
+		require.NoError(t, db.Close())
+		apply(t, path, 1, 2, 3)
+
+		splices := []int64{}
+		session, err := file.NewTailSession(path,
+			file.WithTailPosition(file.TailPosition{Index: 1, Offset: 28}),
+			file.WithTailSpliceFunc(func(missed int64) {
+				splices = append(splices, missed)
+			}))
+		require.NoError(t, err)
+
+		_, err = file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithRebaseChangeCount(2))
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"counter-inc{\"value\":3}\n"}, readAll(t, session))
+		assert.Equal(t, []int64{1}, splices)
+	})
+}
@@ -0,0 +1,307 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/simia-tech/tapedb/v2"
+	tapeio "github.com/simia-tech/tapedb/v2/io"
+	"github.com/simia-tech/tapedb/v2/io/crypto"
+)
+
+const uploadChunkSize = 1 << 20
+
+// PayloadUpload receives the content of a payload in chunks. The received chunks are kept in an
+// upload file, so an upload that has been interrupted can be resumed by calling BeginPayload with
+// the same id again and continue writing at Size.
+type PayloadUpload[B tapedb.Base, S tapedb.State] struct {
+	db       *Database[B, S]
+	id       string
+	f        *os.File
+	logW     tapeio.LogWriter
+	size     int64
+	released bool
+}
+
+// BeginPayload starts or resumes the upload of the payload with the provided id. Only one upload
+// per id can be in progress at a time, a second call returns ErrPayloadUploadInProgress until
+// the first upload is closed, committed or aborted.
+func (db *Database[B, S]) BeginPayload(id string) (*PayloadUpload[B, S], error) {
+	if db.readOnly {
+		return nil, ErrReadOnly
+	}
+	if exists, err := db.layout.payloadExists(db.path, id); err != nil {
+		return nil, err
+	} else if exists {
+		return nil, fmt.Errorf("begin payload with id %s: %w", id, ErrPayloadIDAlreadyExists)
+	}
+
+	if !db.acquireUpload(id) {
+		return nil, fmt.Errorf("begin payload with id %s: %w", id, ErrPayloadUploadInProgress)
+	}
+	upload, err := db.beginPayload(id)
+	if err != nil {
+		db.releaseUpload(id)
+		return nil, err
+	}
+	return upload, nil
+}
+
+func (db *Database[B, S]) beginPayload(id string) (*PayloadUpload[B, S], error) {
+	path := db.uploadPath(id)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, db.fileMode)
+	if err != nil {
+		return nil, fmt.Errorf("open upload %s: %w", path, err)
+	}
+
+	size, offset, err := db.readUpload(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("read upload %s: %w", path, err)
+	}
+
+	// a chunk that has only been written partially is dropped
+	if err := f.Truncate(offset); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	logW, err := db.uploadLogWriter(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &PayloadUpload[B, S]{
+		db:   db,
+		id:   id,
+		f:    f,
+		logW: logW,
+		size: size,
+	}, nil
+}
+
+func (u *PayloadUpload[B, S]) ID() string {
+	return u.id
+}
+
+// Size returns the number of received bytes.
+func (u *PayloadUpload[B, S]) Size() int64 {
+	return u.size
+}
+
+func (u *PayloadUpload[B, S]) Write(data []byte) (int, error) {
+	written := 0
+	for len(data) > 0 {
+		chunk := data
+		if len(chunk) > uploadChunkSize {
+			chunk = chunk[:uploadChunkSize]
+		}
+		if u.db.maxPayloadSize > 0 && u.size+int64(len(chunk)) > u.db.maxPayloadSize {
+			return written, ErrPayloadTooLarge
+		}
+
+		if _, err := u.logW.WriteEntry(tapeio.LogEntryTypeBinary, chunk); err != nil {
+			return written, err
+		}
+		u.size += int64(len(chunk))
+		written += len(chunk)
+		data = data[len(chunk):]
+	}
+	return written, nil
+}
+
+// Sync commits the received chunks to the storage.
+func (u *PayloadUpload[B, S]) Sync() error {
+	return u.f.Sync()
+}
+
+// Close releases the upload file. The upload can be resumed later.
+func (u *PayloadUpload[B, S]) Close() error {
+	defer u.release()
+	if err := u.f.Sync(); err != nil {
+		u.f.Close()
+		return err
+	}
+	return u.f.Close()
+}
+
+// Commit turns the received content into the payload and applies the change that references it.
+// The upload is removed afterwards.
+func (u *PayloadUpload[B, S]) Commit(change tapedb.Change) error {
+	if _, err := u.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	logR, err := crypto.WrapLogReader(tapeio.NewLogReader(u.f), u.db.key)
+	if err != nil {
+		return fmt.Errorf("new log reader: %w", err)
+	}
+
+	if err := u.db.Apply(change, NewPayload(u.id, &chunkReader{logR: logR})); err != nil {
+		return err
+	}
+
+	return u.Abort()
+}
+
+// Abort discards the upload.
+func (u *PayloadUpload[B, S]) Abort() error {
+	defer u.release()
+	u.f.Close()
+	if err := os.Remove(u.db.uploadPath(u.id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (u *PayloadUpload[B, S]) release() {
+	if u.released {
+		return
+	}
+	u.released = true
+	u.db.releaseUpload(u.id)
+}
+
+func (db *Database[B, S]) acquireUpload(id string) bool {
+	db.uploadsMutex.Lock()
+	defer db.uploadsMutex.Unlock()
+	if _, ok := db.uploads[id]; ok {
+		return false
+	}
+	if db.uploads == nil {
+		db.uploads = map[string]struct{}{}
+	}
+	db.uploads[id] = struct{}{}
+	return true
+}
+
+func (db *Database[B, S]) releaseUpload(id string) {
+	db.uploadsMutex.Lock()
+	defer db.uploadsMutex.Unlock()
+	delete(db.uploads, id)
+}
+
+// readUpload returns the size of the received content and the offset behind the last complete
+// chunk.
+func (db *Database[B, S]) readUpload(f *os.File) (int64, int64, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	fileR := tapeio.NewLogReader(f)
+	logR, err := crypto.WrapLogReader(fileR, db.key)
+	if err != nil {
+		return 0, 0, fmt.Errorf("new log reader: %w", err)
+	}
+
+	size, offset := int64(0), int64(0)
+	for {
+		entry, err := logR.ReadEntry()
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return size, offset, nil
+		}
+		if errors.Is(err, crypto.ErrInvalidKey) {
+			return 0, 0, ErrInvalidKey
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if fileR.Offset() > stat.Size() {
+			return size, offset, nil
+		}
+
+		n, err := readChunkSize(entry)
+		if err != nil {
+			// only the last chunk might have been written partially. A damaged chunk in between
+			// would lose the chunks behind it.
+			if fileR.Offset() == stat.Size() {
+				return size, offset, nil
+			}
+			if errors.Is(err, crypto.ErrInvalidKey) && size == 0 {
+				return 0, 0, ErrInvalidKey
+			}
+			return 0, 0, fmt.Errorf("chunk at offset %d: %v: %w", offset, err, ErrCorrupt)
+		}
+
+		size += n
+		offset = fileR.Offset()
+	}
+}
+
+func readChunkSize(entry tapeio.LogEntry) (int64, error) {
+	r, err := entry.Reader()
+	if err != nil {
+		return 0, err
+	}
+	return io.Copy(io.Discard, r)
+}
+
+func (db *Database[B, S]) uploadLogWriter(f *os.File) (tapeio.LogWriter, error) {
+	if len(db.key) == 0 {
+		return tapeio.NewChecksumLogWriter(tapeio.NewLogWriter(f)), nil
+	}
+
+	logW, err := crypto.WrapLogWriterWithCipher(tapeio.NewLogWriter(f), db.cipher, db.key, NonceFn)
+	if err != nil {
+		return nil, fmt.Errorf("new log writer: %w", err)
+	}
+	return logW, nil
+}
+
+func (db *Database[B, S]) uploadPath(id string) string {
+	return filepath.Join(db.path, db.layout.UploadPrefix+id)
+}
+
+// chunkReader reads the content of the chunks in an upload file one after another.
+type chunkReader struct {
+	logR tapeio.LogReader
+	r    io.Reader
+}
+
+func (r *chunkReader) Read(data []byte) (int, error) {
+	for {
+		if r.r == nil {
+			entry, err := r.logR.ReadEntry()
+			if err != nil {
+				return 0, err
+			}
+			if r.r, err = entry.Reader(); err != nil {
+				return 0, err
+			}
+		}
+
+		n, err := r.r.Read(data)
+		if errors.Is(err, io.EOF) {
+			r.r = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestPayloadUpload(t *testing.T) {
+	testFn := func(opts ...file.CreateOption) func(t *testing.T) {
+		return func(t *testing.T) {
+			path, removeDir := makeTempDir(t)
+			defer removeDir()
+
+			db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path, opts...)
+			require.NoError(t, err)
+			defer db.Close()
+
+			upload, err := db.BeginPayload("123")
+			require.NoError(t, err)
+			_, err = io.WriteString(upload, "test ")
+			require.NoError(t, err)
+			require.NoError(t, upload.Close())
+
+			uploadPath := filepath.Join(path, file.FilePrefixUpload+"123")
+			uploadF, err := os.OpenFile(uploadPath, os.O_APPEND|os.O_WRONLY, 0)
+			require.NoError(t, err)
+			_, err = uploadF.Write([]byte{0x00, 0x00, 0x01})
+			require.NoError(t, err)
+			require.NoError(t, uploadF.Close())
+
+			upload, err = db.BeginPayload("123")
+			require.NoError(t, err)
+			assert.Equal(t, int64(5), upload.Size())
+			_, err = io.WriteString(upload, "content")
+			require.NoError(t, err)
+
+			require.NoError(t, upload.Commit(&test.ChangeAttachPayload{PayloadID: "123"}))
+			assert.NoFileExists(t, uploadPath)
+			assert.Equal(t, 1, db.LogLen())
+
+			r, err := db.OpenPayload("123")
+			require.NoError(t, err)
+			defer r.Close()
+			data, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, "test content", string(data))
+
+			_, err = db.BeginPayload("123")
+			assert.ErrorIs(t, err, file.ErrPayloadIDAlreadyExists)
+		}
+	}
+
+	t.Run("Plain", testFn())
+	t.Run("Encrypted", testFn(file.WithCreateKey(testKey)))
+
+	t.Run("Abort", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path)
+		require.NoError(t, err)
+		defer db.Close()
+
+		upload, err := db.BeginPayload("123")
+		require.NoError(t, err)
+		_, err = io.Copy(upload, strings.NewReader("test content"))
+		require.NoError(t, err)
+		require.NoError(t, upload.Abort())
+
+		assert.NoFileExists(t, filepath.Join(path, file.FilePrefixUpload+"123"))
+		_, err = db.OpenPayload("123")
+		assert.ErrorIs(t, err, file.ErrPayloadMissing)
+	})
+	t.Run("CorruptChunk", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path)
+		require.NoError(t, err)
+		defer db.Close()
+
+		upload, err := db.BeginPayload("123")
+		require.NoError(t, err)
+		_, err = io.WriteString(upload, "test ")
+		require.NoError(t, err)
+		_, err = io.WriteString(upload, "content")
+		require.NoError(t, err)
+		require.NoError(t, upload.Close())
+
+		uploadPath := filepath.Join(path, file.FilePrefixUpload+"123")
+		data, err := os.ReadFile(uploadPath)
+		require.NoError(t, err)
+		data[5] ^= 0xff
+		require.NoError(t, os.WriteFile(uploadPath, data, 0o600))
+
+		_, err = db.BeginPayload("123")
+		assert.ErrorIs(t, err, file.ErrCorrupt)
+
+		stat, err := os.Stat(uploadPath)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(data)), stat.Size())
+	})
+
+	t.Run("InProgress", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path)
+		require.NoError(t, err)
+		defer db.Close()
+
+		upload, err := db.BeginPayload("123")
+		require.NoError(t, err)
+
+		_, err = db.BeginPayload("123")
+		assert.ErrorIs(t, err, file.ErrPayloadUploadInProgress)
+
+		require.NoError(t, upload.Close())
+
+		upload, err = db.BeginPayload("123")
+		require.NoError(t, err)
+		require.NoError(t, upload.Abort())
+	})
+}
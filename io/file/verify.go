@@ -0,0 +1,420 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tapedb "github.com/simia-tech/tapedb/v2"
+	tapeio "github.com/simia-tech/tapedb/v2/io"
+	"github.com/simia-tech/tapedb/v2/io/crypto"
+)
+
+var (
+	ErrCorrupt              = tapedb.NewError(tapedb.ErrorCodeCorrupt, "corrupt")
+	ErrBaseChecksumMismatch = tapedb.NewError(tapedb.ErrorCodeCorrupt, "base checksum mismatch")
+)
+
+// CorruptionError reports the file and the offset of the first corrupt entry or block.
+type CorruptionError struct {
+	FileName string
+	Offset   int64
+	Err      error
+}
+
+func (e *CorruptionError) Error() string {
+	return fmt.Sprintf("%s corrupt at offset %d: %v", e.FileName, e.Offset, e.Err)
+}
+
+func (e *CorruptionError) Unwrap() error {
+	return e.Err
+}
+
+func (e *CorruptionError) Is(target error) bool {
+	return target == ErrCorrupt
+}
+
+type verifyOptions struct {
+	keyFunc KeyFunc
+	layout  Layout
+}
+
+var defaultVerifyOptions = verifyOptions{
+	layout: DefaultLayout,
+}
+
+type VerifyOption func(*verifyOptions)
+
+func WithVerifyKey(value []byte) VerifyOption {
+	return WithVerifyKeyFunc(StaticKeyFunc(value))
+}
+
+func WithVerifyKeyFunc(value KeyFunc) VerifyOption {
+	return func(o *verifyOptions) {
+		o.keyFunc = value
+	}
+}
+
+// WithVerifyLayout verifies the database in the provided layout instead of the default one.
+func WithVerifyLayout(value Layout) VerifyOption {
+	return func(o *verifyOptions) {
+		o.layout = value
+	}
+}
+
+// VerifyDatabase scans the log, the base and the payloads of the database at the provided path and
+// returns a CorruptionError for the first corruption that is found. The log framing and the entry
+// checksums are always verified. The base is verified against the checksum in the meta, the
+// payloads against their info sidecars. Encrypted entries, bases and payloads are only decrypted
+// if the key is provided. If nothing can be decrypted with the provided key, ErrInvalidKey is
+// returned.
+func VerifyDatabase(path string, opts ...VerifyOption) error {
+	options := defaultVerifyOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	meta, err := options.layout.readDatabaseMeta(path)
+	if err != nil {
+		return err
+	}
+	if _, err := formatVersionFromMeta(meta); err != nil {
+		return err
+	}
+
+	c, err := cipherFromMeta(meta)
+	if err != nil {
+		return err
+	}
+
+	key, err := options.keyFunc.deriveKey(meta)
+	if err != nil {
+		return fmt.Errorf("derive key: %w", err)
+	}
+
+	v := &verifier{
+		layout:    options.layout,
+		cipher:    c,
+		key:       key,
+		encrypted: meta.Has(MetaHeaderCryptSettings),
+	}
+
+	if err := v.verifyLog(options.layout.LogPath(path)); err != nil {
+		return err
+	}
+
+	if err := v.verifyBase(options.layout.BasePath(path), meta.GetBytes(MetaFieldBaseSHA256, nil)); err != nil {
+		return err
+	}
+
+	if len(v.key) == 0 && v.encrypted {
+		return nil
+	}
+
+	ids, err := options.layout.readPayloadIDs(path)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := v.verifyPayload(path, id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type verifier struct {
+	layout      Layout
+	cipher      crypto.Cipher
+	key         []byte
+	encrypted   bool
+	keyVerified bool
+}
+
+func (v *verifier) verifyLog(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	name := filepath.Base(path)
+	offset := int64(0)
+	header := make([]byte, v.layout.LogEntryHeaderSize)
+	firstAuthFailure := error(nil)
+	for {
+		if _, err := io.ReadFull(f, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return &CorruptionError{FileName: name, Offset: offset, Err: fmt.Errorf("read header: %w", err)}
+		}
+
+		et, size := v.layout.SplitLogEntryHeader(header)
+
+		if remaining := stat.Size() - offset - int64(len(header)); int64(size) > remaining {
+			return &CorruptionError{FileName: name, Offset: offset, Err: fmt.Errorf("entry of size %d exceeds the remaining %d bytes", size, remaining)}
+		}
+
+		data := make([]byte, size)
+		if _, err := io.ReadFull(f, data); err != nil {
+			return &CorruptionError{FileName: name, Offset: offset, Err: fmt.Errorf("read entry of size %d: %w", size, err)}
+		}
+
+		encrypted, err := verifyLogEntry(et, append(header, data...), v.key)
+		if encrypted {
+			v.encrypted = true
+		}
+		switch {
+		case errors.Is(err, crypto.ErrInvalidKey) && !v.keyVerified:
+			// either the key is wrong or the entry is corrupt, which is decided by the next entries
+			if firstAuthFailure == nil {
+				firstAuthFailure = &CorruptionError{FileName: name, Offset: offset, Err: err}
+			}
+		case err != nil:
+			return &CorruptionError{FileName: name, Offset: offset, Err: err}
+		case encrypted && len(v.key) > 0:
+			v.keyVerified = true
+			if firstAuthFailure != nil {
+				return firstAuthFailure
+			}
+		}
+
+		offset += int64(len(header)) + int64(size)
+	}
+
+	if firstAuthFailure != nil {
+		return ErrInvalidKey
+	}
+	return nil
+}
+
+// verifyLogEntry reads the provided entry and returns true if it's encrypted.
+func verifyLogEntry(et tapeio.LogEntryType, entry []byte, key []byte) (bool, error) {
+	logR := tapeio.LogReader(tapeio.NewLogReader(bytes.NewReader(entry)))
+
+	encrypted := false
+	switch et {
+	case tapeio.LogEntryTypeBinary, tapeio.LogEntryTypeBinaryCRC32:
+	case tapeio.LogEntryTypeAESGCMEncrypted, tapeio.LogEntryTypeChaCha20Poly1305Encrypted:
+		encrypted = true
+		if len(key) == 0 {
+			return encrypted, nil
+		}
+		r, err := crypto.NewLogReader(logR, key)
+		if err != nil {
+			return encrypted, err
+		}
+		logR = r
+	default:
+		return encrypted, fmt.Errorf("unknown entry type %x", uint32(et))
+	}
+
+	e, err := logR.ReadEntry()
+	if err != nil {
+		return encrypted, err
+	}
+	r, err := e.Reader()
+	if err != nil {
+		return encrypted, err
+	}
+	_, err = io.Copy(io.Discard, r)
+	return encrypted, err
+}
+
+// verifyBase compares the checksum of the base file with the provided one and decrypts the base if
+// a key is present.
+func (v *verifier) verifyBase(path string, sum []byte) error {
+	fileHash := sha256.New()
+	_, exists, err := v.verifyFile(path, fileHash, io.Discard)
+	if err != nil || !exists {
+		return err
+	}
+
+	if len(sum) > 0 && !bytes.Equal(fileHash.Sum(nil), sum) {
+		return &CorruptionError{FileName: filepath.Base(path), Err: ErrBaseChecksumMismatch}
+	}
+	return nil
+}
+
+// verifyPayload decrypts the payload if a key is present and compares its size and checksum with
+// the ones in the info sidecar.
+func (v *verifier) verifyPayload(path, id string) error {
+	info, hasInfo, err := v.readPayloadInfo(v.layout.PayloadInfoPath(path, id))
+	if err != nil {
+		return err
+	}
+
+	payloadPath := v.layout.PayloadPath(path, id)
+	plainHash := sha256.New()
+	size, exists, err := v.verifyFile(payloadPath, nil, plainHash)
+	if err == nil && !exists {
+		payloadPath = v.layout.PayloadManifestPath(path, id)
+		size, exists, err = v.verifyChunks(path, id, plainHash)
+	}
+	if err != nil || !exists || !hasInfo {
+		return err
+	}
+
+	name := filepath.Base(payloadPath)
+	if size != info.Size {
+		return &CorruptionError{FileName: name, Offset: size, Err: fmt.Errorf("size %d, expected %d", size, info.Size)}
+	}
+	if len(info.SHA256) > 0 && !bytes.Equal(plainHash.Sum(nil), info.SHA256) {
+		return &CorruptionError{FileName: name, Err: ErrPayloadChecksumMismatch}
+	}
+	return nil
+}
+
+// verifyChunks compares each chunk of the payload with the size and the checksum in the manifest and
+// writes the plain content to plainW.
+func (v *verifier) verifyChunks(path, id string, plainW io.Writer) (int64, bool, error) {
+	manifestPath := v.layout.PayloadManifestPath(path, id)
+	manifest, err := readPayloadManifestFile(manifestPath, v.cipher, v.key)
+	if os.IsNotExist(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, true, v.corruption(filepath.Base(manifestPath), 0, err)
+	}
+
+	size := int64(0)
+	for index, sum := range manifest.Chunks {
+		chunkPath := v.layout.PayloadChunkPath(path, id, index)
+		chunkHash := sha256.New()
+		chunkSize, exists, err := v.verifyFile(chunkPath, nil, io.MultiWriter(plainW, chunkHash))
+		if err != nil {
+			return size, true, err
+		}
+		name := filepath.Base(chunkPath)
+		if !exists {
+			return size, true, &CorruptionError{FileName: name, Err: ErrPayloadMissing}
+		}
+		if expected := manifest.chunkSize(index); chunkSize != expected {
+			return size, true, &CorruptionError{FileName: name, Offset: chunkSize, Err: fmt.Errorf("size %d, expected %d", chunkSize, expected)}
+		}
+		if !bytes.Equal(chunkHash.Sum(nil), sum) {
+			return size, true, &CorruptionError{FileName: name, Err: ErrPayloadChecksumMismatch}
+		}
+		size += chunkSize
+	}
+	return size, true, nil
+}
+
+func (v *verifier) readPayloadInfo(path string) (PayloadInfo, bool, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return PayloadInfo{}, false, nil
+	}
+	if err != nil {
+		return PayloadInfo{}, false, err
+	}
+	defer f.Close()
+
+	name := filepath.Base(path)
+	r := io.Reader(f)
+	if len(v.key) > 0 {
+		br, err := crypto.NewBlockReaderWithCipher(f, v.cipher, v.key)
+		if err != nil {
+			return PayloadInfo{}, false, v.corruption(name, 0, err)
+		}
+		r = br
+	}
+
+	meta, err := ReadMeta(r)
+	if err != nil {
+		if len(v.key) == 0 {
+			// the sidecar might be encrypted
+			return PayloadInfo{}, false, nil
+		}
+		return PayloadInfo{}, false, v.corruption(name, 0, err)
+	}
+	id := strings.TrimPrefix(name, v.layout.PayloadInfoPrefix)
+	return payloadInfoFromMeta(id, meta), true, nil
+}
+
+// verifyFile reads the file at the provided path and writes its content to fileW. If a key is
+// present, the file is decrypted and the plain content is written to plainW. The returned size is
+// the one of the plain content.
+func (v *verifier) verifyFile(path string, fileW io.Writer, plainW io.Writer) (int64, bool, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	defer f.Close()
+
+	name := filepath.Base(path)
+	cr := tapeio.NewCountReader(f)
+	r := io.Reader(cr)
+	if fileW != nil {
+		r = io.TeeReader(cr, fileW)
+	}
+	decrypt := len(v.key) > 0
+	if decrypt {
+		br, err := crypto.NewBlockReaderWithCipher(r, v.cipher, v.key)
+		if err != nil {
+			return 0, true, v.corruption(name, 0, err)
+		}
+		r = br
+	}
+
+	buffer := make([]byte, 32*1024)
+	size := int64(0)
+	for {
+		offset := int64(cr.Count())
+		n, err := r.Read(buffer)
+		if n > 0 {
+			plainW.Write(buffer[:n])
+			size += int64(n)
+			if decrypt {
+				v.keyVerified = true
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return size, true, nil
+		}
+		if err != nil {
+			return size, true, v.corruption(name, offset, err)
+		}
+	}
+}
+
+// corruption returns ErrInvalidKey if the authentication failed before anything could be decrypted
+// with the key. Otherwise, a CorruptionError is returned.
+func (v *verifier) corruption(name string, offset int64, err error) error {
+	if errors.Is(err, crypto.ErrInvalidKey) && !v.keyVerified {
+		return ErrInvalidKey
+	}
+	return &CorruptionError{FileName: name, Offset: offset, Err: err}
+}
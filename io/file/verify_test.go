@@ -0,0 +1,168 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestVerifyDatabase(t *testing.T) {
+	corruptByte := func(t *testing.T, path string, offset int64) {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		data[offset] ^= 0xff
+		require.NoError(t, os.WriteFile(path, data, 0644))
+	}
+
+	t.Run("Checksums", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithLogChecksum())
+		require.NoError(t, err)
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 2}))
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 3}))
+		require.NoError(t, db.Close())
+
+		require.NoError(t, file.VerifyDatabase(path))
+
+		db, err = file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path)
+		require.NoError(t, err)
+		assert.Equal(t, 5, db.State().Counter)
+		require.NoError(t, db.Close())
+
+		corruptByte(t, filepath.Join(path, file.FileNameLog), 32+10)
+
+		err = file.VerifyDatabase(path)
+		require.ErrorIs(t, err, file.ErrCorrupt)
+		corruptionErr := &file.CorruptionError{}
+		require.True(t, errors.As(err, &corruptionErr))
+		assert.Equal(t, file.FileNameLog, corruptionErr.FileName)
+		assert.Equal(t, int64(32), corruptionErr.Offset)
+
+		_, err = file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), path)
+		assert.Error(t, err)
+	})
+
+	t.Run("TruncatedLog", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		makeFile(t, filepath.Join(path, file.FileNameLog), "\x00\x00\x00\x18\x0bcounter-inc{\"value\":2}\n\x00\x00\x00\x18\x0bcounter")
+
+		err := file.VerifyDatabase(path)
+		require.ErrorIs(t, err, file.ErrCorrupt)
+		corruptionErr := &file.CorruptionError{}
+		require.True(t, errors.As(err, &corruptionErr))
+		assert.Equal(t, int64(28), corruptionErr.Offset)
+	})
+
+	t.Run("EncryptedPayload", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithCreateKey(testKey))
+		require.NoError(t, err)
+		require.NoError(t, db.Apply(
+			&test.ChangeAttachPayload{PayloadID: "123"},
+			file.NewPayload("123", strings.NewReader("test content"))))
+		require.NoError(t, db.Close())
+
+		require.NoError(t, file.VerifyDatabase(path, file.WithVerifyKey(testKey)))
+
+		corruptByte(t, filepath.Join(path, file.FilePrefixPayload+"123"), 20)
+
+		err = file.VerifyDatabase(path, file.WithVerifyKey(testKey))
+		require.ErrorIs(t, err, file.ErrCorrupt)
+		corruptionErr := &file.CorruptionError{}
+		require.True(t, errors.As(err, &corruptionErr))
+		assert.Equal(t, file.FilePrefixPayload+"123", corruptionErr.FileName)
+	})
+
+	t.Run("OversizedEntry", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		makeFile(t, filepath.Join(path, file.FileNameLog), "\x00\xff\xff\xffcounter")
+
+		err := file.VerifyDatabase(path)
+		require.ErrorIs(t, err, file.ErrCorrupt)
+		assert.Contains(t, err.Error(), "exceeds the remaining 7 bytes")
+	})
+
+	t.Run("WrongKey", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithCreateKey(testKey))
+		require.NoError(t, err)
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 2}))
+		require.NoError(t, db.Close())
+
+		wrongKey := append([]byte{}, testKey...)
+		wrongKey[0] ^= 0xff
+		assert.ErrorIs(t, file.VerifyDatabase(path, file.WithVerifyKey(wrongKey)), file.ErrInvalidKey)
+	})
+
+	t.Run("PlainBase", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path)
+		require.NoError(t, err)
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 2}))
+		require.NoError(t, db.Close())
+
+		_, err = file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithRebaseChangeCount(1))
+		require.NoError(t, err)
+		require.NoError(t, file.VerifyDatabase(path))
+
+		corruptByte(t, filepath.Join(path, file.FileNameBase), 2)
+
+		err = file.VerifyDatabase(path)
+		require.ErrorIs(t, err, file.ErrCorrupt)
+		assert.ErrorIs(t, err, file.ErrBaseChecksumMismatch)
+	})
+
+	t.Run("PlainPayload", func(t *testing.T) {
+		path, removeDir := makeTempDir(t)
+		defer removeDir()
+
+		db, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), path, file.WithPayloadInfo())
+		require.NoError(t, err)
+		require.NoError(t, db.Apply(
+			&test.ChangeAttachPayload{PayloadID: "123"},
+			file.NewPayload("123", strings.NewReader("test content"))))
+		require.NoError(t, db.Close())
+
+		require.NoError(t, file.VerifyDatabase(path))
+
+		corruptByte(t, filepath.Join(path, file.FilePrefixPayload+"123"), 2)
+
+		err = file.VerifyDatabase(path)
+		require.ErrorIs(t, err, file.ErrCorrupt)
+		assert.ErrorIs(t, err, file.ErrPayloadChecksumMismatch)
+	})
+}
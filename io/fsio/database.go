@@ -0,0 +1,256 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsio
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+
+	"github.com/simia-tech/tapedb/v2"
+	tapeio "github.com/simia-tech/tapedb/v2/io"
+	"github.com/simia-tech/tapedb/v2/io/compress"
+	"github.com/simia-tech/tapedb/v2/io/crypto"
+	"github.com/simia-tech/tapedb/v2/io/file"
+)
+
+type Database[B tapedb.Base, S tapedb.State] struct {
+	fsys   fs.FS
+	dir    string
+	meta   file.Meta
+	key    []byte
+	cipher crypto.Cipher
+	db     *tapeio.Database[B, S]
+	inline map[string][]byte
+}
+
+func OpenDatabase[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](
+	f F,
+	fsys fs.FS,
+	dir string,
+	opts ...OpenOption,
+) (*Database[B, S], error) {
+	options := defaultOpenOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	meta := file.Meta{}
+	metaData, err := mayReadFile(fsys, path.Join(dir, file.DefaultLayout.Meta))
+	if err != nil {
+		return nil, fmt.Errorf("read meta: %w", err)
+	}
+	if metaData != nil {
+		if meta, err = file.ReadMeta(bytes.NewReader(metaData)); err != nil {
+			return nil, fmt.Errorf("read meta: %w", err)
+		}
+	}
+
+	baseData, err := mayReadFile(fsys, path.Join(dir, file.DefaultLayout.Base))
+	if err != nil {
+		return nil, fmt.Errorf("read base: %w", err)
+	}
+	logData, err := mayReadFile(fsys, path.Join(dir, file.DefaultLayout.Log))
+	if err != nil {
+		return nil, fmt.Errorf("read log: %w", err)
+	}
+	if baseData == nil && logData == nil {
+		return nil, file.ErrMissing
+	}
+
+	c, err := crypto.ParseCipher(meta.Get(file.MetaHeaderCipher))
+	if err != nil {
+		return nil, fmt.Errorf("parse cipher: %w", err)
+	}
+
+	key := []byte(nil)
+	if options.keyFunc != nil {
+		if key, err = options.keyFunc(meta); err != nil {
+			return nil, fmt.Errorf("derive key: %w", err)
+		}
+	}
+
+	baseR := io.Reader(nil)
+	if baseData != nil {
+		if baseR, err = crypto.WrapBlockReaderWithCipher(bytes.NewReader(baseData), c, key); err != nil {
+			return nil, fmt.Errorf("new block reader: %w", err)
+		}
+		if compression := meta.Get(file.MetaFieldBaseCompression); compression != "" {
+			if baseR, err = compress.WrapBlockReader(baseR, compression); err != nil {
+				return nil, fmt.Errorf("new block reader: %w", err)
+			}
+		}
+	}
+
+	logR := tapeio.LogReader(nil)
+	if logData != nil {
+		if logR, err = crypto.WrapLogReader(tapeio.NewLogReader(bytes.NewReader(logData)), key); err != nil {
+			return nil, fmt.Errorf("new log reader: %w", err)
+		}
+		logR = compress.WrapLogReader(logR, file.LogDictionaries(meta)...)
+	}
+
+	inline := map[string][]byte{}
+	inlinePayloadFn := func(_ int, payloads []tapeio.InlinePayload) error {
+		for _, payload := range payloads {
+			inline[payload.ID] = payload.Data
+		}
+		return nil
+	}
+
+	codec, err := tapedb.LookupCodec(f, meta.Get(file.MetaFieldCodec))
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := tapeio.OpenDatabase[B, S](f, baseR, logR, nil,
+		tapeio.WithMigrator(options.migrator), tapeio.WithInlinePayloadFunc(inlinePayloadFn), tapeio.WithCodec(codec))
+	if err != nil {
+		if errors.Is(err, crypto.ErrInvalidKey) {
+			return nil, file.ErrInvalidKey
+		}
+		return nil, err
+	}
+
+	return &Database[B, S]{
+		fsys:   fsys,
+		dir:    dir,
+		meta:   meta,
+		key:    key,
+		cipher: c,
+		db:     db,
+		inline: inline,
+	}, nil
+}
+
+func (db *Database[B, S]) Meta() file.Meta {
+	return db.meta
+}
+
+func (db *Database[B, S]) Base() B {
+	return db.db.Base()
+}
+
+func (db *Database[B, S]) State() S {
+	return db.db.State()
+}
+
+// View calls fn with the state while it's read-locked. See tapeio.Database.View.
+func (db *Database[B, S]) View(fn func(S) error) error {
+	return db.db.View(fn)
+}
+
+func (db *Database[B, S]) LogLen() int {
+	return db.db.LogLen()
+}
+
+func (db *Database[B, S]) LogLen64() int64 {
+	return db.db.LogLen64()
+}
+
+func (db *Database[B, S]) ReadOnly() bool {
+	return true
+}
+
+func (db *Database[B, S]) Apply(tapedb.Change) error {
+	return file.ErrReadOnly
+}
+
+func (db *Database[B, S]) OpenPayload(id string) (io.ReadCloser, error) {
+	if data, ok := db.inline[id]; ok {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+
+	f, err := db.fsys.Open(path.Join(db.dir, file.DefaultLayout.PayloadPrefix+id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, file.ErrPayloadMissing
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(db.key) == 0 {
+		return f, nil
+	}
+
+	r, err := crypto.NewBlockReaderWithCipher(f, db.cipher, db.key)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return tapeio.NewReadCloser(r, f.Close), nil
+}
+
+func (db *Database[B, S]) Close() error {
+	return db.db.Close()
+}
+
+func ReadLogLen(fsys fs.FS, dir string) (int, error) {
+	logLen, err := ReadLogLen64(fsys, dir)
+	return int(logLen), err
+}
+
+// ReadLogLen64 returns the number of entries in the log of the database in the provided directory.
+// Like file.ReadLogLen64, the log length is taken from the meta if it's stored there for the
+// current log size, so the log doesn't have to be scanned.
+func ReadLogLen64(fsys fs.FS, dir string) (int64, error) {
+	logPath := path.Join(dir, file.DefaultLayout.Log)
+	stat, err := fs.Stat(fsys, logPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	metaData, err := mayReadFile(fsys, path.Join(dir, file.DefaultLayout.Meta))
+	if err != nil {
+		return 0, fmt.Errorf("read meta: %w", err)
+	}
+	if metaData != nil {
+		if meta, err := file.ReadMeta(bytes.NewReader(metaData)); err == nil && meta.Has(file.MetaFieldLogLen) &&
+			meta.GetUInt64(file.MetaFieldLogSize, 0) == uint64(stat.Size()) {
+			return int64(meta.GetUInt64(file.MetaFieldLogLen, 0)), nil
+		}
+	}
+
+	logData, err := fs.ReadFile(fsys, logPath)
+	if err != nil {
+		return 0, fmt.Errorf("read log: %w", err)
+	}
+	return tapeio.ReadLogLen64(tapeio.NewLogReader(bytes.NewReader(logData)))
+}
+
+func mayReadFile(fsys fs.FS, name string) ([]byte, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		data = []byte{}
+	}
+	return data, nil
+}
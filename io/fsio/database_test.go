@@ -0,0 +1,135 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsio_test
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/io/fsio"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestOpenDatabase(t *testing.T) {
+	t.Run("MapFS", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"db/base":        {Data: []byte(`{"value":21}`)},
+			"db/log":         {Data: []byte("\x00\x00\x00\x18\x0bcounter-inc{\"value\":2}\n")},
+			"db/payload-123": {Data: []byte("payload")},
+		}
+
+		db, err := fsio.OpenDatabase[*test.Base, *test.State](test.NewFactory(), fsys, "db")
+		require.NoError(t, err)
+		defer db.Close()
+
+		assert.Equal(t, 1, db.LogLen())
+		assert.Equal(t, 23, db.State().Counter)
+		assert.ErrorIs(t, db.Apply(&test.ChangeCounterInc{Value: 1}), file.ErrReadOnly)
+
+		r, err := db.OpenPayload("123")
+		require.NoError(t, err)
+		defer r.Close()
+		data, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, "payload", string(data))
+
+		_, err = db.OpenPayload("456")
+		assert.ErrorIs(t, err, file.ErrPayloadMissing)
+	})
+
+	t.Run("Encrypted", func(t *testing.T) {
+		dir := t.TempDir()
+
+		fdb, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), dir, file.WithCreateKey(testKey))
+		require.NoError(t, err)
+		require.NoError(t, fdb.Apply(&test.ChangeCounterInc{Value: 21},
+			file.NewPayload("123", strings.NewReader("payload"))))
+		require.NoError(t, fdb.Close())
+
+		db, err := fsio.OpenDatabase[*test.Base, *test.State](test.NewFactory(), os.DirFS(dir), ".",
+			fsio.WithOpenKey(testKey))
+		require.NoError(t, err)
+		defer db.Close()
+
+		assert.Equal(t, 21, db.State().Counter)
+
+		r, err := db.OpenPayload("123")
+		require.NoError(t, err)
+		defer r.Close()
+		data, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, "payload", string(data))
+
+		_, err = fsio.OpenDatabase[*test.Base, *test.State](test.NewFactory(), os.DirFS(dir), ".",
+			fsio.WithOpenKey([]byte("fedcba9876543210fedcba9876543210")))
+		assert.ErrorIs(t, err, file.ErrInvalidKey)
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		_, err := fsio.OpenDatabase[*test.Base, *test.State](test.NewFactory(), fstest.MapFS{}, "db")
+		assert.ErrorIs(t, err, file.ErrMissing)
+	})
+}
+
+func TestReadLogLen64(t *testing.T) {
+	entry := "\x00\x00\x00\x18\x0bcounter-inc{\"value\":2}\n"
+
+	t.Run("Scan", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"db/log": {Data: []byte(entry + entry)},
+		}
+
+		logLen, err := fsio.ReadLogLen64(fsys, "db")
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), logLen)
+	})
+
+	t.Run("Meta", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"db/meta": {Data: []byte("Log-Len: 7\r\nLog-Size: 56\r\n\r\n")},
+			"db/log":  {Data: []byte(entry + entry)},
+		}
+
+		logLen, err := fsio.ReadLogLen64(fsys, "db")
+		require.NoError(t, err)
+		assert.Equal(t, int64(7), logLen)
+	})
+
+	t.Run("OutdatedMeta", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"db/meta": {Data: []byte("Log-Len: 7\r\nLog-Size: 28\r\n\r\n")},
+			"db/log":  {Data: []byte(entry + entry)},
+		}
+
+		logLen, err := fsio.ReadLogLen64(fsys, "db")
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), logLen)
+	})
+
+	t.Run("MissingLog", func(t *testing.T) {
+		logLen, err := fsio.ReadLogLen64(fstest.MapFS{}, "db")
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), logLen)
+	})
+}
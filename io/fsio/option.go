@@ -0,0 +1,45 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsio
+
+import (
+	"github.com/simia-tech/tapedb/v2"
+	"github.com/simia-tech/tapedb/v2/io/file"
+)
+
+type openOptions struct {
+	keyFunc  file.KeyFunc
+	migrator tapedb.ChangeMigrator
+}
+
+var defaultOpenOptions = openOptions{}
+
+type OpenOption func(*openOptions)
+
+func WithOpenKey(value []byte) OpenOption {
+	return WithOpenKeyFunc(file.StaticKeyFunc(value))
+}
+
+func WithOpenKeyFunc(value file.KeyFunc) OpenOption {
+	return func(o *openOptions) {
+		o.keyFunc = value
+	}
+}
+
+func WithOpenMigrations(values ...tapedb.ChangeMigrator) OpenOption {
+	return func(o *openOptions) {
+		o.migrator = tapedb.Migrations(values)
+	}
+}
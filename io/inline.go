@@ -0,0 +1,102 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package io
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// inlineMarker takes the place of the type name size in front of the inline payloads of an entry.
+// Type names can't be empty, so the marker can't be mistaken for one.
+const inlineMarker = 0x00
+
+var ErrEmptyTypeName = errors.New("empty type name")
+
+// InlinePayload is a payload that is stored in the log entry of the change that references it.
+type InlinePayload struct {
+	ID   string
+	Data []byte
+}
+
+func writeInlinePayloads(buffer *bytes.Buffer, payloads []InlinePayload) {
+	if len(payloads) == 0 {
+		return
+	}
+
+	buffer.WriteByte(inlineMarker)
+	buffer.Write(binary.AppendUvarint(nil, uint64(len(payloads))))
+	for _, payload := range payloads {
+		buffer.Write(binary.AppendUvarint(nil, uint64(len(payload.ID))))
+		buffer.WriteString(payload.ID)
+		buffer.Write(binary.AppendUvarint(nil, uint64(len(payload.Data))))
+		buffer.Write(payload.Data)
+	}
+}
+
+func readInlinePayloads(r io.Reader) ([]InlinePayload, error) {
+	br := byteReader{r: r}
+
+	count, err := binary.ReadUvarint(&br)
+	if err != nil {
+		return nil, fmt.Errorf("read inline payload count: %w", err)
+	}
+
+	payloads := []InlinePayload{}
+	for index := uint64(0); index < count; index++ {
+		id, err := readInlineBytes(&br)
+		if err != nil {
+			return nil, fmt.Errorf("read id of inline payload %d: %w", index, err)
+		}
+		data, err := readInlineBytes(&br)
+		if err != nil {
+			return nil, fmt.Errorf("read data of inline payload %d: %w", index, err)
+		}
+		payloads = append(payloads, InlinePayload{ID: string(id), Data: data})
+	}
+
+	return payloads, nil
+}
+
+func readInlineBytes(br *byteReader) ([]byte, error) {
+	size, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	if size > uint64(MaxLogEntrySize) {
+		return nil, fmt.Errorf("size %d: %w", size, ErrLogEntryTooLarge)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(br.r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+type byteReader struct {
+	r io.Reader
+}
+
+func (br *byteReader) ReadByte() (byte, error) {
+	b := [1]byte{}
+	if _, err := io.ReadFull(br.r, b[:]); err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
@@ -26,11 +26,24 @@ import (
 type LogEntryType uint32
 
 const (
-	LogEntryTypeBinary          LogEntryType = 0x00000000
-	LogEntryTypeAESGCMEncrypted LogEntryType = 0x10000000
-	LogEntryTypeMask            LogEntryType = 0xf0000000
+	LogEntryTypeBinary                    LogEntryType = 0x00000000
+	LogEntryTypeAESGCMEncrypted           LogEntryType = 0x10000000
+	LogEntryTypeChaCha20Poly1305Encrypted LogEntryType = 0x20000000
+	LogEntryTypeBinaryCRC32               LogEntryType = 0x30000000
+	LogEntryTypeCompressed                LogEntryType = 0x40000000
+	LogEntryTypeMask                      LogEntryType = 0xf0000000
 )
 
+// LogEntryHeaderSize is the size of the header in front of each log entry. The header holds the
+// entry type and the size of the entry.
+const LogEntryHeaderSize = 4
+
+// MaxLogEntrySize is the maximal size of a log entry. The size is limited by the bits of the entry
+// header that are not used by the entry type.
+const MaxLogEntrySize = int(^LogEntryTypeMask)
+
+var ErrLogEntryTooLarge = errors.New("log entry too large")
+
 type LogEntry interface {
 	Type() LogEntryType
 	Reader() (io.Reader, error)
@@ -48,6 +61,9 @@ func (e *logEntry) Type() LogEntryType {
 }
 
 func (e *logEntry) Reader() (io.Reader, error) {
+	if e.entryType == LogEntryTypeBinaryCRC32 {
+		return readChecksummedEntry(e.reader)
+	}
 	return e.reader, nil
 }
 
@@ -57,8 +73,23 @@ type LogReader interface {
 
 var _ LogReader = &logReader[io.ReadSeeker]{}
 
+// LogOffsetter is implemented by log readers that track the byte offset of the entries.
+type LogOffsetter interface {
+	Offset() int64
+}
+
+// LogOffset returns the byte offset behind the last entry that has been read from the provided
+// reader. If the reader doesn't track offsets, false is returned.
+func LogOffset(r LogReader) (int64, bool) {
+	if o, ok := r.(LogOffsetter); ok {
+		return o.Offset(), true
+	}
+	return 0, false
+}
+
 type logReader[R io.ReadSeeker] struct {
 	r               R
+	offset          int64
 	lastSize        uint32
 	lastCountReader *CountReader[io.Reader]
 }
@@ -67,6 +98,15 @@ func NewLogReader[R io.ReadSeeker](r R) *logReader[R] {
 	return &logReader[R]{r: r}
 }
 
+// NewLogReaderAt returns a log reader that starts reading at the provided offset. The offset must
+// point to the beginning of an entry.
+func NewLogReaderAt[R io.ReadSeeker](r R, offset int64) (*logReader[R], error) {
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return &logReader[R]{r: r, offset: offset}, nil
+}
+
 func (r *logReader[R]) ReadEntry() (LogEntry, error) {
 	if r.lastCountReader != nil {
 		left := int64(r.lastSize) - int64(r.lastCountReader.Count())
@@ -80,6 +120,7 @@ func (r *logReader[R]) ReadEntry() (LogEntry, error) {
 		return nil, err
 	}
 
+	r.offset += LogEntryHeaderSize + int64(size)
 	r.lastSize = size
 	r.lastCountReader = NewCountReader(io.LimitReader(r.r, int64(size)))
 
@@ -89,8 +130,13 @@ func (r *logReader[R]) ReadEntry() (LogEntry, error) {
 	}, nil
 }
 
+// Offset returns the byte offset behind the last entry that has been read.
+func (r *logReader[R]) Offset() int64 {
+	return r.offset
+}
+
 func (r *logReader[R]) readEntryHeader() (LogEntryType, uint32, error) {
-	buffer := [4]byte{}
+	buffer := [LogEntryHeaderSize]byte{}
 	if _, err := io.ReadFull(r.r, buffer[:]); err != nil {
 		return 0, 0, err
 	}
@@ -106,17 +152,41 @@ type LogWriter interface {
 	WriteEntry(LogEntryType, []byte) (int64, error)
 }
 
+// LogFlusher is implemented by log writers that buffer data.
+type LogFlusher interface {
+	Flush() error
+}
+
+// FlushLogWriter flushes the provided log writer if it implements LogFlusher.
+func FlushLogWriter(w LogWriter) error {
+	if f, ok := w.(LogFlusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
 type logWriter[W io.Writer] struct {
-	w *bufio.Writer
+	w         *bufio.Writer
+	autoFlush bool
 }
 
 var _ LogWriter = &logWriter[io.Writer]{}
 
 func NewLogWriter[W io.Writer](w W) *logWriter[W] {
+	return &logWriter[W]{w: bufio.NewWriter(w), autoFlush: true}
+}
+
+// NewBufferedLogWriter returns a log writer that only writes entries to the underlying writer
+// if the buffer is full or Flush is called.
+func NewBufferedLogWriter[W io.Writer](w W) *logWriter[W] {
 	return &logWriter[W]{w: bufio.NewWriter(w)}
 }
 
 func (w *logWriter[W]) WriteEntry(et LogEntryType, data []byte) (int64, error) {
+	if len(data) > MaxLogEntrySize {
+		return 0, fmt.Errorf("entry of size %d: %w", len(data), ErrLogEntryTooLarge)
+	}
+
 	total, err := w.writeEntryHeader(et, uint32(len(data)))
 	if err != nil {
 		return total, err
@@ -128,18 +198,24 @@ func (w *logWriter[W]) WriteEntry(et LogEntryType, data []byte) (int64, error) {
 		return total, err
 	}
 
-	if err := w.w.Flush(); err != nil {
-		return total, err
+	if w.autoFlush {
+		if err := w.w.Flush(); err != nil {
+			return total, err
+		}
 	}
 
 	return total, nil
 }
 
+func (w *logWriter[W]) Flush() error {
+	return w.w.Flush()
+}
+
 func (w *logWriter[W]) writeEntryHeader(et LogEntryType, size uint32) (int64, error) {
 	size &= uint32(^LogEntryTypeMask)
 	size |= uint32(et)
 
-	buffer := [4]byte{}
+	buffer := [LogEntryHeaderSize]byte{}
 	binary.BigEndian.PutUint32(buffer[:], size)
 
 	n, err := w.w.Write(buffer[:])
@@ -151,15 +227,20 @@ func (w *logWriter[W]) writeEntryHeader(et LogEntryType, size uint32) (int64, er
 }
 
 func ReadLogLen(r LogReader) (int, error) {
-	logIndex := 0
+	logLen, err := ReadLogLen64(r)
+	return int(logLen), err
+}
+
+func ReadLogLen64(r LogReader) (int64, error) {
+	logLen := int64(0)
 	err := ReadLogEntries(r, func(_ LogEntry) error {
-		logIndex++
+		logLen++
 		return nil
 	})
 	if err != nil {
 		return 0, err
 	}
-	return logIndex, nil
+	return logLen, nil
 }
 
 func ReadLogEntries(r LogReader, fn func(LogEntry) error) error {
@@ -167,7 +248,7 @@ func ReadLogEntries(r LogReader, fn func(LogEntry) error) error {
 		return nil
 	}
 
-	for index := 0; true; index++ {
+	for index := int64(0); true; index++ {
 		entry, err := r.ReadEntry()
 		if errors.Is(err, io.EOF) {
 			return nil
@@ -182,3 +263,23 @@ func ReadLogEntries(r LogReader, fn func(LogEntry) error) error {
 
 	return nil
 }
+
+// ReadLogEntriesFrom reads the entries of the provided log starting at offset. The returned offset
+// points behind the last entry that has been processed successfully, so it can be used to resume
+// reading later.
+func ReadLogEntriesFrom(r io.ReadSeeker, offset int64, fn func(LogEntry) error) (int64, error) {
+	logR, err := NewLogReaderAt(r, offset)
+	if err != nil {
+		return offset, err
+	}
+
+	err = ReadLogEntries(logR, func(entry LogEntry) error {
+		if err := fn(entry); err != nil {
+			return err
+		}
+		offset = logR.Offset()
+		return nil
+	})
+
+	return offset, err
+}
@@ -51,6 +51,11 @@ func (b *LogBuffer) ReadEntry() (LogEntry, error) {
 	return b.r.ReadEntry()
 }
 
+func (b *LogBuffer) Offset() int64 {
+	offset, _ := LogOffset(b.r)
+	return offset
+}
+
 func (b *LogBuffer) HexString() string {
 	return hex.EncodeToString(b.buffer.Bytes())
 }
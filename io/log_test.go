@@ -43,6 +43,45 @@ func TestLogReader(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, "test", string(data))
 	})
+
+	t.Run("Offset", func(t *testing.T) {
+		buffer, err := hex.DecodeString("000000047465737400000003616263")
+		require.NoError(t, err)
+		r := tapeio.NewLogReader(bytes.NewReader(buffer))
+
+		_, err = r.ReadEntry()
+		require.NoError(t, err)
+		assert.Equal(t, int64(8), r.Offset())
+
+		_, err = r.ReadEntry()
+		require.NoError(t, err)
+		assert.Equal(t, int64(15), r.Offset())
+	})
+}
+
+func TestReadLogEntriesFrom(t *testing.T) {
+	buffer, err := hex.DecodeString("00000004746573740000000361626300000003")
+	require.NoError(t, err)
+
+	data := []string{}
+	offset, err := tapeio.ReadLogEntriesFrom(bytes.NewReader(buffer), 8, func(entry tapeio.LogEntry) error {
+		r, err := entry.Reader()
+		if err != nil {
+			return err
+		}
+		d, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if len(d) < 3 {
+			return io.ErrUnexpectedEOF
+		}
+		data = append(data, string(d))
+		return nil
+	})
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Equal(t, []string{"abc"}, data)
+	assert.Equal(t, int64(15), offset)
 }
 
 func TestLogWriter(t *testing.T) {
@@ -67,4 +106,13 @@ func TestLogWriter(t *testing.T) {
 
 		assert.Equal(t, "1000000474657374", hex.EncodeToString(buffer.Bytes()))
 	})
+
+	t.Run("EntryTooLarge", func(t *testing.T) {
+		buffer := bytes.Buffer{}
+		w := tapeio.NewLogWriter(&buffer)
+
+		_, err := w.WriteEntry(tapeio.LogEntryTypeBinary, make([]byte, tapeio.MaxLogEntrySize+1))
+		assert.ErrorIs(t, err, tapeio.ErrLogEntryTooLarge)
+		assert.Equal(t, 0, buffer.Len())
+	})
 }
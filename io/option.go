@@ -0,0 +1,138 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package io
+
+import (
+	"context"
+	"time"
+
+	tapedb "github.com/simia-tech/tapedb/v2"
+)
+
+type ApplyInfo struct {
+	TypeName string
+	Bytes    int64
+	Duration time.Duration
+	Err      error
+}
+
+type ApplyFunc func(ApplyInfo)
+
+type databaseOptions struct {
+	applyFunc   ApplyFunc
+	groupCommit bool
+	migrator    tapedb.ChangeMigrator
+	governor    ReplayGovernor
+	stopAtIndex int64
+	clock       tapedb.Clock
+	ctx         context.Context
+	codec       tapedb.Codec
+	replayClock *tapedb.ReplayClock
+
+	inlinePayloadFunc  func(int, []InlinePayload) error
+	spliceProgressFunc func(SpliceResult)
+}
+
+var defaultDatabaseOptions = databaseOptions{
+	stopAtIndex: -1,
+	ctx:         context.Background(),
+}
+
+type DatabaseOption func(*databaseOptions)
+
+func WithApplyFunc(value ApplyFunc) DatabaseOption {
+	return func(o *databaseOptions) {
+		o.applyFunc = value
+	}
+}
+
+// WithGroupCommit enables group commits. Changes that are applied concurrently are written to
+// the log as one batch followed by a single flush. Apply returns after the batch got flushed.
+func WithGroupCommit() DatabaseOption {
+	return func(o *databaseOptions) {
+		o.groupCommit = true
+	}
+}
+
+// WithMigrator sets a migrator that upgrades the encoding of changes that are read from the log.
+func WithMigrator(value tapedb.ChangeMigrator) DatabaseOption {
+	return func(o *databaseOptions) {
+		o.migrator = value
+	}
+}
+
+// WithReplayGovernor throttles the replay of the log when the database is opened.
+func WithReplayGovernor(value ReplayGovernor) DatabaseOption {
+	return func(o *databaseOptions) {
+		o.governor = value
+	}
+}
+
+// WithStopAtIndex stops the replay of the log after the provided number of changes. A negative
+// value replays the whole log.
+func WithStopAtIndex(value int64) DatabaseOption {
+	return func(o *databaseOptions) {
+		o.stopAtIndex = value
+	}
+}
+
+// WithClock sets the clock that is used to measure the duration of applies.
+func WithClock(value tapedb.Clock) DatabaseOption {
+	return func(o *databaseOptions) {
+		o.clock = value
+	}
+}
+
+// WithContext cancels the reading of the log as soon as the provided context is done. The context
+// is checked between the log entries.
+func WithContext(ctx context.Context) DatabaseOption {
+	return func(o *databaseOptions) {
+		o.ctx = ctx
+	}
+}
+
+// WithInlinePayloadFunc passes the inline payloads of each entry that is read to the provided
+// function. A splice only passes the inline payloads of the rebased changes, since the copied ones
+// stay inline.
+func WithInlinePayloadFunc(value func(int, []InlinePayload) error) DatabaseOption {
+	return func(o *databaseOptions) {
+		o.inlinePayloadFunc = value
+	}
+}
+
+// WithSpliceProgressFunc passes the intermediate result of a splice to the provided function after
+// each entry of the log has been rebased or copied.
+func WithSpliceProgressFunc(value func(SpliceResult)) DatabaseOption {
+	return func(o *databaseOptions) {
+		o.spliceProgressFunc = value
+	}
+}
+
+// WithCodec sets the codec that encodes the base and the changes. A nil codec lets them encode
+// themselves.
+func WithCodec(value tapedb.Codec) DatabaseOption {
+	return func(o *databaseOptions) {
+		o.codec = value
+	}
+}
+
+// WithReplayClock replays the log with the provided clock. A state that implements
+// tapedb.ClockSetter gets the clock before the replay, which is advanced to the timestamp of each
+// change before it's applied.
+func WithReplayClock(value *tapedb.ReplayClock) DatabaseOption {
+	return func(o *databaseOptions) {
+		o.replayClock = value
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package io
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	tapedb "github.com/simia-tech/tapedb/v2"
+)
+
+var (
+	ErrProjectionExisting = tapedb.NewError(tapedb.ErrorCodeExisting, "projection existing")
+	ErrProjectionMissing  = tapedb.NewError(tapedb.ErrorCodeMissing, "projection missing")
+)
+
+// ProjectionFunc creates a projection on top of the base of a database. Like the state, the
+// projection has to hold the provided locker while it's read.
+type ProjectionFunc[B tapedb.Base] func(base B, readLocker sync.Locker) tapedb.State
+
+// projection is maintained next to the state. A change that can't be applied leaves it out of
+// date, which is reported by Projection until the database is rebuilt.
+type projection[B tapedb.Base] struct {
+	newFn ProjectionFunc[B]
+	state tapedb.State
+	err   error
+}
+
+func (p *projection[B]) apply(c tapedb.Change) {
+	if p.err != nil {
+		return
+	}
+	p.err = p.state.Apply(c)
+}
+
+// AddProjection adds a projection that gets every change next to the state, e.g. a counter or a
+// search index. It's created on top of the base and all changes that are passed by readChanges are
+// applied to it before it's added. Afterwards, it gets each change once its log entry has been
+// written. Changes are blocked while the projection is built.
+func (db *Database[B, S]) AddProjection(
+	name string,
+	newFn ProjectionFunc[B],
+	readChanges func(func(int, tapedb.Change) error) error,
+) error {
+	db.stateMutex.Lock()
+	defer db.stateMutex.Unlock()
+
+	if _, ok := db.projections[name]; ok {
+		return fmt.Errorf("projection %s: %w", name, ErrProjectionExisting)
+	}
+
+	p := &projection[B]{newFn: newFn, state: newFn(db.base, db.stateMutex.RLocker())}
+	err := db.replay(readChanges, func(logIndex int, change tapedb.Change) error {
+		if err := p.state.Apply(change); err != nil {
+			return tapedb.WrapErrorAt("apply change", int64(logIndex), err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if db.projections == nil {
+		db.projections = map[string]*projection[B]{}
+	}
+	db.projections[name] = p
+
+	return nil
+}
+
+// Projection returns the projection with the provided name. If a change couldn't be applied to the
+// projection, the error of that change is returned.
+func (db *Database[B, S]) Projection(name string) (tapedb.State, error) {
+	db.stateMutex.RLock()
+	defer db.stateMutex.RUnlock()
+
+	p, ok := db.projections[name]
+	if !ok {
+		return nil, fmt.Errorf("projection %s: %w", name, ErrProjectionMissing)
+	}
+	if p.err != nil {
+		return nil, fmt.Errorf("projection %s: %w", name, p.err)
+	}
+	return p.state, nil
+}
+
+// RemoveProjection removes the projection with the provided name.
+func (db *Database[B, S]) RemoveProjection(name string) {
+	db.stateMutex.Lock()
+	defer db.stateMutex.Unlock()
+
+	delete(db.projections, name)
+}
+
+// applyProjections passes a change whose log entry has been written to the projections. The state
+// has to be locked.
+func (db *Database[B, S]) applyProjections(c tapedb.Change) {
+	for _, p := range db.projections {
+		p.apply(c)
+	}
+}
+
+// replay passes the changes that are read by readChanges to fn. The log is flushed before and
+// changes beyond the length of the log are skipped, since a database that has been opened at an
+// index doesn't cover the whole log. The state has to be locked.
+func (db *Database[B, S]) replay(
+	readChanges func(func(int, tapedb.Change) error) error,
+	fn func(int, tapedb.Change) error,
+) error {
+	if err := FlushLogWriter(db.logW); err != nil {
+		return fmt.Errorf("flush log: %w", err)
+	}
+
+	logLen := int64(0)
+	err := readChanges(func(logIndex int, change tapedb.Change) error {
+		if logLen == db.logLen {
+			return errStopReplay
+		}
+		if err := fn(logIndex, change); err != nil {
+			return err
+		}
+		logLen++
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopReplay) {
+		return fmt.Errorf("read changes: %w", err)
+	}
+	if logLen != db.logLen {
+		return fmt.Errorf("read %d of %d changes: %w", logLen, db.logLen, ErrLogLenMismatch)
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package io_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2"
+	"github.com/simia-tech/tapedb/v2/io"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+// typeCounter counts the changes per type name. It fails on the type name in failOn.
+type typeCounter struct {
+	counts map[string]int
+	failOn string
+}
+
+func newTypeCounterFn(failOn string) io.ProjectionFunc[*test.Base] {
+	return func(*test.Base, sync.Locker) tapedb.State {
+		return &typeCounter{counts: map[string]int{}, failOn: failOn}
+	}
+}
+
+func (p *typeCounter) Apply(c tapedb.Change) error {
+	if c.TypeName() == p.failOn {
+		return errors.New("test")
+	}
+	p.counts[c.TypeName()]++
+	return nil
+}
+
+func TestProjection(t *testing.T) {
+	setupFn := func(t *testing.T, opts ...io.DatabaseOption) (*io.Database[*test.Base, *test.State], func(func(int, tapedb.Change) error) error) {
+		logBuffer := &io.LogBuffer{}
+		db, err := io.NewDatabase[*test.Base, *test.State](test.NewFactory(), logBuffer, opts...)
+		require.NoError(t, err)
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 2}))
+		require.NoError(t, db.Apply(&test.ChangeCounterMul{Value: 3}))
+
+		return db, func(fn func(int, tapedb.Change) error) error {
+			return io.ReadChanges[*test.Base, *test.State](test.NewFactory(), io.NewLogBufferString(logBuffer.String()), fn)
+		}
+	}
+
+	t.Run("Add", func(t *testing.T) {
+		db, readChanges := setupFn(t)
+
+		require.NoError(t, db.AddProjection("types", newTypeCounterFn(""), readChanges))
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+
+		p, err := db.Projection("types")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]int{"counter-inc": 2, "counter-mul": 1}, p.(*typeCounter).counts)
+		assert.Equal(t, 7, db.State().Counter)
+	})
+
+	t.Run("GroupCommit", func(t *testing.T) {
+		db, readChanges := setupFn(t, io.WithGroupCommit())
+
+		require.NoError(t, db.AddProjection("types", newTypeCounterFn(""), readChanges))
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 1}))
+
+		p, err := db.Projection("types")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]int{"counter-inc": 2, "counter-mul": 1}, p.(*typeCounter).counts)
+	})
+
+	t.Run("Existing", func(t *testing.T) {
+		db, readChanges := setupFn(t)
+
+		require.NoError(t, db.AddProjection("types", newTypeCounterFn(""), readChanges))
+		err := db.AddProjection("types", newTypeCounterFn(""), readChanges)
+		assert.ErrorIs(t, err, io.ErrProjectionExisting)
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		db, readChanges := setupFn(t)
+
+		require.NoError(t, db.AddProjection("types", newTypeCounterFn(""), readChanges))
+		db.RemoveProjection("types")
+
+		_, err := db.Projection("types")
+		assert.ErrorIs(t, err, io.ErrProjectionMissing)
+	})
+
+	t.Run("FailingReplay", func(t *testing.T) {
+		db, readChanges := setupFn(t)
+
+		err := db.AddProjection("types", newTypeCounterFn("counter-mul"), readChanges)
+		assert.Error(t, err)
+
+		_, err = db.Projection("types")
+		assert.ErrorIs(t, err, io.ErrProjectionMissing)
+	})
+
+	t.Run("FailingApply", func(t *testing.T) {
+		db, readChanges := setupFn(t)
+
+		require.NoError(t, db.AddProjection("types", newTypeCounterFn("counter-set"), readChanges))
+		require.NoError(t, db.Apply(&test.ChangeCounterSet{Value: 1}))
+		assert.Equal(t, 1, db.State().Counter)
+
+		_, err := db.Projection("types")
+		assert.EqualError(t, err, "projection types: test")
+	})
+
+	t.Run("Rebuild", func(t *testing.T) {
+		db, readChanges := setupFn(t)
+
+		require.NoError(t, db.AddProjection("types", newTypeCounterFn(""), readChanges))
+		p, err := db.Projection("types")
+		require.NoError(t, err)
+		p.(*typeCounter).counts["counter-inc"] = 42
+
+		require.NoError(t, db.Rebuild(test.NewFactory(), readChanges))
+
+		p, err = db.Projection("types")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]int{"counter-inc": 1, "counter-mul": 1}, p.(*typeCounter).counts)
+	})
+}
@@ -14,7 +14,12 @@
 
 package io
 
-import "io"
+import (
+	"errors"
+	"io"
+)
+
+var ErrNotSeekable = errors.New("not seekable")
 
 type ReadCloser[R io.Reader] struct {
 	r       R
@@ -35,3 +40,11 @@ func (r *ReadCloser[R]) Read(data []byte) (int, error) {
 func (r *ReadCloser[R]) Close() error {
 	return r.closeFn()
 }
+
+func (r *ReadCloser[R]) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := any(r.r).(io.Seeker)
+	if !ok {
+		return 0, ErrNotSeekable
+	}
+	return seeker.Seek(offset, whence)
+}
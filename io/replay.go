@@ -0,0 +1,88 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package io
+
+import (
+	"runtime"
+	"time"
+
+	tapedb "github.com/simia-tech/tapedb/v2"
+)
+
+// ReplayProgress reports how far the replay of a log has proceeded.
+type ReplayProgress struct {
+	Entries int64
+	Bytes   int64
+	Elapsed time.Duration
+}
+
+// ReplayGovernor throttles the replay of a log, so restoring a large database doesn't starve other
+// services on the same host. The zero value doesn't throttle at all. The byte rate can only be
+// limited for log readers that track offsets.
+type ReplayGovernor struct {
+	// BytesPerSecond limits the rate in which the log is read.
+	BytesPerSecond int64
+	// YieldEvery yields the processor after the given number of entries.
+	YieldEvery int
+	// ProgressFunc is called after each replayed entry.
+	ProgressFunc func(ReplayProgress)
+	Clock        tapedb.Clock
+}
+
+type replay struct {
+	governor ReplayGovernor
+	logR     LogReader
+	start    time.Time
+	offset   int64
+	progress ReplayProgress
+}
+
+func (g ReplayGovernor) start(logR LogReader) *replay {
+	g.Clock = tapedb.ClockOrSystem(g.Clock)
+
+	offset, _ := LogOffset(logR)
+
+	return &replay{
+		governor: g,
+		logR:     logR,
+		start:    g.Clock.Now(),
+		offset:   offset,
+	}
+}
+
+func (r *replay) entryReplayed() {
+	r.progress.Entries++
+	if offset, ok := LogOffset(r.logR); ok {
+		r.progress.Bytes += offset - r.offset
+		r.offset = offset
+	}
+	r.progress.Elapsed = r.governor.Clock.Now().Sub(r.start)
+
+	if r.governor.BytesPerSecond > 0 {
+		expected := time.Duration(float64(r.progress.Bytes) / float64(r.governor.BytesPerSecond) * float64(time.Second))
+		if expected > r.progress.Elapsed {
+			r.governor.Clock.Sleep(expected - r.progress.Elapsed)
+			r.progress.Elapsed = r.governor.Clock.Now().Sub(r.start)
+		}
+	}
+
+	if r.governor.YieldEvery > 0 && r.progress.Entries%int64(r.governor.YieldEvery) == 0 {
+		runtime.Gosched()
+	}
+
+	if r.governor.ProgressFunc != nil {
+		r.governor.ProgressFunc(r.progress)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package io_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2/io"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestReplayGovernor(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := test.NewClock(start)
+	progress := []io.ReplayProgress{}
+
+	log := io.NewLogBufferString("\x00\x00\x00\x18\x0bcounter-inc{\"value\":2}\n\x00\x00\x00\x18\x0bcounter-inc{\"value\":1}\n")
+
+	db, err := io.OpenDatabase[*test.Base, *test.State](
+		test.NewFactory(),
+		nil,
+		log,
+		&io.LogBuffer{},
+		io.WithReplayGovernor(io.ReplayGovernor{
+			BytesPerSecond: 28,
+			YieldEvery:     1,
+			ProgressFunc: func(p io.ReplayProgress) {
+				progress = append(progress, p)
+			},
+			Clock: clock,
+		}))
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, db.State().Counter)
+	assert.Equal(t, 2*time.Second, clock.Now().Sub(start))
+	assert.Equal(t, []io.ReplayProgress{
+		{Entries: 1, Bytes: 28, Elapsed: time.Second},
+		{Entries: 2, Bytes: 56, Elapsed: 2 * time.Second},
+	}, progress)
+}
@@ -0,0 +1,100 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package io
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	tapedb "github.com/simia-tech/tapedb/v2"
+)
+
+// RetryPolicy defines how often and in which intervals an operation is retried. The delay starts
+// with InitialDelay and is multiplied by Multiplier after each attempt until MaxDelay is reached.
+type RetryPolicy struct {
+	MaxAttempts   int
+	InitialDelay  time.Duration
+	MaxDelay      time.Duration
+	Multiplier    float64
+	RetryableFunc func(error) bool
+	Clock         tapedb.Clock
+}
+
+// NoRetry runs the operation only once.
+var NoRetry = RetryPolicy{MaxAttempts: 1}
+
+func ExponentialBackoff(maxAttempts int, initialDelay, maxDelay time.Duration) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:   maxAttempts,
+		InitialDelay:  initialDelay,
+		MaxDelay:      maxDelay,
+		Multiplier:    2,
+		RetryableFunc: IsTransient,
+	}
+}
+
+// Do runs fn until it succeeds, returns an error that is not retryable or the maximal number of
+// attempts is reached. The last error is returned.
+func (p RetryPolicy) Do(fn func() error) error {
+	retryableFn := p.RetryableFunc
+	if retryableFn == nil {
+		retryableFn = IsTransient
+	}
+	clock := tapedb.ClockOrSystem(p.Clock)
+
+	delay := p.InitialDelay
+	for attempt := 1; true; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.MaxAttempts || !retryableFn(err) {
+			return err
+		}
+
+		clock.Sleep(delay)
+
+		if p.Multiplier > 1 {
+			delay = time.Duration(float64(delay) * p.Multiplier)
+		}
+		if p.MaxDelay > 0 && delay > p.MaxDelay {
+			delay = p.MaxDelay
+		}
+	}
+
+	return nil
+}
+
+// IsTransient returns true if the error is likely to vanish if the operation is retried.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+
+	// syscall.Errno reports EINTR, EAGAIN, ECONNRESET and the like as temporary
+	temporaryErr := interface{ Temporary() bool }(nil)
+	if errors.As(err, &temporaryErr) && temporaryErr.Temporary() {
+		return true
+	}
+
+	timeoutErr := interface{ Timeout() bool }(nil)
+	if errors.As(err, &timeoutErr) && timeoutErr.Timeout() {
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,86 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package io_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/simia-tech/tapedb/v2/io"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	errTransient := fmt.Errorf("write: %w", syscall.EAGAIN)
+
+	failingFn := func(failures int, err error) (func() error, *int) {
+		calls := 0
+		return func() error {
+			calls++
+			if calls <= failures {
+				return err
+			}
+			return nil
+		}, &calls
+	}
+
+	t.Run("RetryUntilSuccess", func(t *testing.T) {
+		start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+		clock := test.NewClock(start)
+		policy := io.ExponentialBackoff(5, time.Millisecond, 3*time.Millisecond)
+		policy.Clock = clock
+
+		fn, calls := failingFn(3, errTransient)
+		assert.NoError(t, policy.Do(fn))
+		assert.Equal(t, 4, *calls)
+		assert.Equal(t, 6*time.Millisecond, clock.Now().Sub(start))
+	})
+
+	t.Run("MaxAttempts", func(t *testing.T) {
+		policy := io.ExponentialBackoff(2, 0, 0)
+
+		fn, calls := failingFn(3, errTransient)
+		assert.ErrorIs(t, policy.Do(fn), syscall.EAGAIN)
+		assert.Equal(t, 2, *calls)
+	})
+
+	t.Run("NotRetryable", func(t *testing.T) {
+		policy := io.ExponentialBackoff(5, 0, 0)
+
+		fn, calls := failingFn(3, os.ErrNotExist)
+		assert.ErrorIs(t, policy.Do(fn), os.ErrNotExist)
+		assert.Equal(t, 1, *calls)
+	})
+
+	t.Run("NoRetry", func(t *testing.T) {
+		fn, calls := failingFn(3, errTransient)
+		assert.Error(t, io.NoRetry.Do(fn))
+		assert.Equal(t, 1, *calls)
+	})
+}
+
+func TestIsTransient(t *testing.T) {
+	assert.True(t, io.IsTransient(fmt.Errorf("read: %w", syscall.EINTR)))
+	assert.True(t, io.IsTransient(os.ErrDeadlineExceeded))
+	assert.False(t, io.IsTransient(os.ErrNotExist))
+	assert.False(t, io.IsTransient(errors.New("test")))
+	assert.False(t, io.IsTransient(nil))
+}
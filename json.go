@@ -0,0 +1,203 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tapedb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+)
+
+type JSONOptions struct {
+	EscapeHTML            bool
+	Prefix                string
+	Indent                string
+	UseNumber             bool
+	DisallowUnknownFields bool
+
+	// Canonical makes the encoder produce the same bytes for equal values by sorting all object
+	// keys and formatting all numbers in a fixed way. Prefix and Indent are ignored in that mode.
+	Canonical bool
+}
+
+// DefaultJSONOptions returns the options that are used by WriteJSON and ReadJSON. A model that
+// needs other options keeps its own JSONOptions value and calls Encode and Decode on it, so the
+// options of one model don't affect the other databases in the process.
+func DefaultJSONOptions() JSONOptions {
+	return JSONOptions{
+		EscapeHTML: true,
+	}
+}
+
+func CanonicalJSONOptions() JSONOptions {
+	return JSONOptions{
+		EscapeHTML: true,
+		Canonical:  true,
+	}
+}
+
+func (o JSONOptions) Encode(w io.Writer, v any) (int64, error) {
+	if o.Canonical {
+		return o.encodeCanonical(w, v)
+	}
+
+	cw := &countWriter{w: w}
+
+	encoder := json.NewEncoder(cw)
+	encoder.SetEscapeHTML(o.EscapeHTML)
+	encoder.SetIndent(o.Prefix, o.Indent)
+
+	if err := encoder.Encode(v); err != nil {
+		return cw.count, err
+	}
+
+	return cw.count, nil
+}
+
+func (o JSONOptions) Decode(r io.Reader, v any) (int64, error) {
+	decoder := json.NewDecoder(r)
+	if o.UseNumber {
+		decoder.UseNumber()
+	}
+	if o.DisallowUnknownFields {
+		decoder.DisallowUnknownFields()
+	}
+
+	if err := decoder.Decode(v); err != nil {
+		return decoder.InputOffset(), err
+	}
+
+	return decoder.InputOffset(), nil
+}
+
+func (o JSONOptions) encodeCanonical(w io.Writer, v any) (int64, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return 0, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	value := any(nil)
+	if err := decoder.Decode(&value); err != nil {
+		return 0, err
+	}
+
+	buffer := bytes.Buffer{}
+	if err := o.writeCanonical(&buffer, value); err != nil {
+		return 0, err
+	}
+	buffer.WriteByte('\n')
+
+	return buffer.WriteTo(w)
+}
+
+func (o JSONOptions) writeCanonical(buffer *bytes.Buffer, value any) error {
+	switch t := value.(type) {
+	case nil:
+		buffer.WriteString("null")
+	case bool:
+		buffer.WriteString(strconv.FormatBool(t))
+	case json.Number:
+		number, err := canonicalNumber(t)
+		if err != nil {
+			return err
+		}
+		buffer.WriteString(number)
+	case string:
+		encoder := json.NewEncoder(buffer)
+		encoder.SetEscapeHTML(o.EscapeHTML)
+		if err := encoder.Encode(t); err != nil {
+			return err
+		}
+		buffer.Truncate(buffer.Len() - 1)
+	case []any:
+		buffer.WriteByte('[')
+		for index, item := range t {
+			if index > 0 {
+				buffer.WriteByte(',')
+			}
+			if err := o.writeCanonical(buffer, item); err != nil {
+				return err
+			}
+		}
+		buffer.WriteByte(']')
+	case map[string]any:
+		keys := make([]string, 0, len(t))
+		for key := range t {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		buffer.WriteByte('{')
+		for index, key := range keys {
+			if index > 0 {
+				buffer.WriteByte(',')
+			}
+			if err := o.writeCanonical(buffer, key); err != nil {
+				return err
+			}
+			buffer.WriteByte(':')
+			if err := o.writeCanonical(buffer, t[key]); err != nil {
+				return err
+			}
+		}
+		buffer.WriteByte('}')
+	default:
+		return fmt.Errorf("unexpected json value of type %T", value)
+	}
+	return nil
+}
+
+func canonicalNumber(n json.Number) (string, error) {
+	if i, ok := new(big.Int).SetString(string(n), 10); ok {
+		return i.String(), nil
+	}
+
+	f, err := strconv.ParseFloat(string(n), 64)
+	if err != nil {
+		return "", fmt.Errorf("parse number %s: %w", n, err)
+	}
+	if f > -1e15 && f < 1e15 && f == math.Trunc(f) {
+		return strconv.FormatInt(int64(f), 10), nil
+	}
+
+	return strconv.FormatFloat(f, 'e', -1, 64), nil
+}
+
+func WriteJSON(w io.Writer, v any) (int64, error) {
+	return DefaultJSONOptions().Encode(w, v)
+}
+
+func ReadJSON(r io.Reader, v any) (int64, error) {
+	return DefaultJSONOptions().Decode(r, v)
+}
+
+type countWriter struct {
+	w     io.Writer
+	count int64
+}
+
+func (w *countWriter) Write(data []byte) (int, error) {
+	n, err := w.w.Write(data)
+	w.count += int64(n)
+	return n, err
+}
@@ -0,0 +1,89 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tapedb_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2"
+)
+
+func TestJSONOptions(t *testing.T) {
+	value := map[string]any{"url": "https://example.com/?a=1&b=2"}
+
+	t.Run("Default", func(t *testing.T) {
+		buffer := bytes.Buffer{}
+
+		n, err := tapedb.WriteJSON(&buffer, value)
+		require.NoError(t, err)
+		assert.Equal(t, int64(buffer.Len()), n)
+		assert.Equal(t, "{\"url\":\"https://example.com/?a=1\\u0026b=2\"}\n", buffer.String())
+	})
+
+	t.Run("WithoutHTMLEscaping", func(t *testing.T) {
+		buffer := bytes.Buffer{}
+
+		_, err := tapedb.JSONOptions{EscapeHTML: false}.Encode(&buffer, value)
+		require.NoError(t, err)
+		assert.Equal(t, "{\"url\":\"https://example.com/?a=1&b=2\"}\n", buffer.String())
+	})
+
+	t.Run("DefaultIsNotShared", func(t *testing.T) {
+		options := tapedb.DefaultJSONOptions()
+		options.EscapeHTML = false
+
+		buffer := bytes.Buffer{}
+		_, err := tapedb.WriteJSON(&buffer, value)
+		require.NoError(t, err)
+		assert.Equal(t, "{\"url\":\"https://example.com/?a=1\\u0026b=2\"}\n", buffer.String())
+	})
+
+	t.Run("Indent", func(t *testing.T) {
+		buffer := bytes.Buffer{}
+
+		_, err := tapedb.JSONOptions{Indent: "  "}.Encode(&buffer, map[string]int{"value": 1})
+		require.NoError(t, err)
+		assert.Equal(t, "{\n  \"value\": 1\n}\n", buffer.String())
+	})
+
+	t.Run("UseNumber", func(t *testing.T) {
+		v := map[string]any{}
+
+		n, err := tapedb.JSONOptions{UseNumber: true}.Decode(strings.NewReader(`{"value":12345678901234567890}`), &v)
+		require.NoError(t, err)
+		assert.Equal(t, int64(30), n)
+		assert.Equal(t, json.Number("12345678901234567890"), v["value"])
+	})
+
+	t.Run("Canonical", func(t *testing.T) {
+		type change struct {
+			B float64        `json:"b"`
+			A int            `json:"a"`
+			C map[string]any `json:"c"`
+		}
+
+		buffer := bytes.Buffer{}
+
+		_, err := tapedb.CanonicalJSONOptions().Encode(&buffer, change{B: 2.0, A: 1, C: map[string]any{"y": 1.5, "x": []any{1e21, "a"}}})
+		require.NoError(t, err)
+		assert.Equal(t, "{\"a\":1,\"b\":2,\"c\":{\"x\":[1e+21,\"a\"],\"y\":1.5e+00}}\n", buffer.String())
+	})
+}
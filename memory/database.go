@@ -48,6 +48,9 @@ func (db *Database[B, S]) State() S {
 }
 
 func (db *Database[B, S]) Apply(c tapedb.Change) error {
+	if err := tapedb.ValidateChange(c, db.state); err != nil {
+		return err
+	}
 	return db.state.Apply(c)
 }
 
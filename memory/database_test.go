@@ -20,6 +20,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/simia-tech/tapedb/v2"
 	"github.com/simia-tech/tapedb/v2/memory"
 	"github.com/simia-tech/tapedb/v2/test"
 )
@@ -33,4 +34,12 @@ func TestMemory(t *testing.T) {
 
 		assert.Equal(t, 1, db.State().Counter)
 	})
+	t.Run("InvalidChange", func(t *testing.T) {
+		db, err := memory.NewDatabase[*test.Base, *test.State](test.NewFactory())
+		require.NoError(t, err)
+
+		require.ErrorIs(t, db.Apply(&test.ChangeCounterDec{Value: 1}), tapedb.ErrInvalidChange)
+
+		assert.Equal(t, 0, db.State().Counter)
+	})
 }
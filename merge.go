@@ -0,0 +1,209 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tapedb
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+)
+
+var ErrConflict = NewError(ErrorCodeConflict, "conflict")
+
+// ConflictingChange can be implemented by a change to report that it conflicts with another change.
+type ConflictingChange interface {
+	Change
+	ConflictsWith(Change) bool
+}
+
+// ConflictResolver resolves a conflict between change a of the first and change b of the second
+// log. The returned changes are merged instead of b.
+type ConflictResolver interface {
+	Resolve(a, b Change) ([]Change, error)
+}
+
+type ConflictResolverFunc func(a, b Change) ([]Change, error)
+
+func (fn ConflictResolverFunc) Resolve(a, b Change) ([]Change, error) {
+	return fn(a, b)
+}
+
+var (
+	// FailOnConflict fails the merge on the first conflict.
+	FailOnConflict = ConflictResolverFunc(func(a, b Change) ([]Change, error) {
+		return nil, fmt.Errorf("%s and %s: %w", a.TypeName(), b.TypeName(), ErrConflict)
+	})
+	// PreferA drops the conflicting changes of the second log.
+	PreferA = ConflictResolverFunc(func(_, _ Change) ([]Change, error) {
+		return []Change{}, nil
+	})
+	// PreferB keeps the conflicting changes of the second log, so they're applied after the ones
+	// of the first log.
+	PreferB = ConflictResolverFunc(func(_, b Change) ([]Change, error) {
+		return []Change{b}, nil
+	})
+)
+
+// MergeLogs merges the two logs that diverged from the provided base into one log. Changes that both
+// logs start with are taken as common history. The merged log contains the common changes,
+// followed by the remaining changes of logA and the remaining changes of logB.
+//
+// Each remaining change of logB that conflicts with a remaining change of logA is passed to the
+// resolver. If one of the changes implements ConflictingChange, its answer decides. Otherwise the
+// changes conflict if applying them in different order to the common history leads to different
+// state hashes. The merged log is verified by applying it to a state of a copy of the base, so the
+// provided base is left untouched.
+func MergeLogs[
+	B Base,
+	S State,
+	F Factory[B, S],
+](f F, base B, logA, logB []Change, resolver ConflictResolver) ([]Change, error) {
+	common, err := commonPrefixLen(logA, logB)
+	if err != nil {
+		return nil, err
+	}
+
+	ancestor, err := cloneBase[B, S](f, base)
+	if err != nil {
+		return nil, fmt.Errorf("copy base: %w", err)
+	}
+	for index, change := range logA[:common] {
+		if err := ancestor.Apply(change); err != nil {
+			return nil, fmt.Errorf("apply common change %d: %w", index, err)
+		}
+	}
+
+	merged := append([]Change{}, logA...)
+	for indexB, b := range logB[common:] {
+		candidates := []Change{b}
+		for indexA, a := range logA[common:] {
+			next := []Change{}
+			for _, candidate := range candidates {
+				conflict, err := conflicts[B, S](f, ancestor, a, candidate)
+				if err != nil {
+					return nil, fmt.Errorf("compare change %d of log a and %d of log b: %w", common+indexA, common+indexB, err)
+				}
+				if !conflict {
+					next = append(next, candidate)
+					continue
+				}
+
+				resolved, err := resolver.Resolve(a, candidate)
+				if err != nil {
+					return nil, fmt.Errorf("resolve change %d of log a and %d of log b: %w", common+indexA, common+indexB, err)
+				}
+				next = append(next, resolved...)
+			}
+			candidates = next
+		}
+		merged = append(merged, candidates...)
+	}
+
+	if _, err := replayHash[B, S](f, base, merged...); err != nil {
+		return nil, fmt.Errorf("merged: %w", err)
+	}
+
+	return merged, nil
+}
+
+func commonPrefixLen(logA, logB []Change) (int, error) {
+	for index := 0; index < len(logA) && index < len(logB); index++ {
+		equal, err := equalChanges(logA[index], logB[index])
+		if err != nil {
+			return 0, fmt.Errorf("compare change %d: %w", index, err)
+		}
+		if !equal {
+			return index, nil
+		}
+	}
+	if len(logA) < len(logB) {
+		return len(logA), nil
+	}
+	return len(logB), nil
+}
+
+func equalChanges(a, b Change) (bool, error) {
+	if a.TypeName() != b.TypeName() {
+		return false, nil
+	}
+	bufA, bufB := bytes.Buffer{}, bytes.Buffer{}
+	if _, err := a.WriteTo(&bufA); err != nil {
+		return false, err
+	}
+	if _, err := b.WriteTo(&bufB); err != nil {
+		return false, err
+	}
+	return bytes.Equal(bufA.Bytes(), bufB.Bytes()), nil
+}
+
+func conflicts[
+	B Base,
+	S State,
+	F Factory[B, S],
+](f F, ancestor B, a, b Change) (bool, error) {
+	ca, okA := a.(ConflictingChange)
+	cb, okB := b.(ConflictingChange)
+	if okA || okB {
+		return (okA && ca.ConflictsWith(b)) || (okB && cb.ConflictsWith(a)), nil
+	}
+
+	hashAB, err := replayHash[B, S](f, ancestor, a, b)
+	if err != nil {
+		return false, err
+	}
+	hashBA, err := replayHash[B, S](f, ancestor, b, a)
+	if err != nil {
+		return false, err
+	}
+	return !bytes.Equal(hashAB, hashBA), nil
+}
+
+// replayHash applies the changes to a state of a copy of the provided base and returns the hash of
+// the resulting state.
+func replayHash[
+	B Base,
+	S State,
+	F Factory[B, S],
+](f F, base B, changes ...Change) ([]byte, error) {
+	clone, err := cloneBase[B, S](f, base)
+	if err != nil {
+		return nil, fmt.Errorf("copy base: %w", err)
+	}
+
+	stateMutex := &sync.RWMutex{}
+	state := f.NewState(clone, stateMutex.RLocker())
+	for index, change := range changes {
+		if err := state.Apply(change); err != nil {
+			return nil, fmt.Errorf("apply change %d: %w", index, err)
+		}
+	}
+	return Hash(state), nil
+}
+
+func cloneBase[
+	B Base,
+	S State,
+	F Factory[B, S],
+](f F, base B) (B, error) {
+	buf := bytes.Buffer{}
+	if _, err := base.WriteTo(&buf); err != nil {
+		return base, err
+	}
+	clone := f.NewBase()
+	if _, err := clone.ReadFrom(&buf); err != nil {
+		return base, err
+	}
+	return clone, nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tapedb_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestMergeLogs(t *testing.T) {
+	logA := []tapedb.Change{&test.ChangeCounterInc{Value: 1}, &test.ChangeCounterSet{Value: 10}}
+	logB := []tapedb.Change{&test.ChangeCounterInc{Value: 2}, &test.ChangeCounterSet{Value: 20}}
+
+	merge := func(resolver tapedb.ConflictResolver) ([]tapedb.Change, error) {
+		base := test.NewBase()
+		return tapedb.MergeLogs[*test.Base, *test.State](test.NewFactory(), base, logA, logB, resolver)
+	}
+
+	t.Run("WithoutConflicts", func(t *testing.T) {
+		merged, err := tapedb.MergeLogs[*test.Base, *test.State](
+			test.NewFactory(), test.NewBase(),
+			logA[:1], logB[:1], tapedb.FailOnConflict)
+		require.NoError(t, err)
+		assert.Equal(t, []tapedb.Change{logA[0], logB[0]}, merged)
+	})
+
+	t.Run("FailOnConflict", func(t *testing.T) {
+		_, err := merge(tapedb.FailOnConflict)
+		assert.ErrorIs(t, err, tapedb.ErrConflict)
+	})
+
+	t.Run("PreferA", func(t *testing.T) {
+		merged, err := merge(tapedb.PreferA)
+		require.NoError(t, err)
+		assert.Equal(t, []tapedb.Change{logA[0], logA[1], logB[0]}, merged)
+	})
+
+	t.Run("PreferB", func(t *testing.T) {
+		merged, err := merge(tapedb.PreferB)
+		require.NoError(t, err)
+		assert.Equal(t, []tapedb.Change{logA[0], logA[1], logB[0], logB[1]}, merged)
+	})
+
+	t.Run("CustomResolver", func(t *testing.T) {
+		merged, err := merge(tapedb.ConflictResolverFunc(func(a, b tapedb.Change) ([]tapedb.Change, error) {
+			sum := a.(*test.ChangeCounterSet).Value + b.(*test.ChangeCounterSet).Value
+			return []tapedb.Change{&test.ChangeCounterSet{Value: sum}}, nil
+		}))
+		require.NoError(t, err)
+		assert.Equal(t, &test.ChangeCounterSet{Value: 30}, merged[3])
+	})
+
+	t.Run("CommonHistory", func(t *testing.T) {
+		common := &test.ChangeCounterInc{Value: 5}
+		merged, err := tapedb.MergeLogs[*test.Base, *test.State](
+			test.NewFactory(), test.NewBase(),
+			[]tapedb.Change{common, logA[0]}, []tapedb.Change{&test.ChangeCounterInc{Value: 5}, logB[0]},
+			tapedb.FailOnConflict)
+		require.NoError(t, err)
+		assert.Equal(t, []tapedb.Change{common, logA[0], logB[0]}, merged)
+	})
+
+	t.Run("NotCommuting", func(t *testing.T) {
+		mul := &test.ChangeCounterMul{Value: 3}
+		_, err := tapedb.MergeLogs[*test.Base, *test.State](
+			test.NewFactory(), test.NewBase(),
+			logA[:1], []tapedb.Change{mul}, tapedb.FailOnConflict)
+		assert.ErrorIs(t, err, tapedb.ErrConflict)
+
+		merged, err := tapedb.MergeLogs[*test.Base, *test.State](
+			test.NewFactory(), test.NewBase(),
+			[]tapedb.Change{&test.ChangeCounterMul{Value: 2}}, []tapedb.Change{mul}, tapedb.FailOnConflict)
+		require.NoError(t, err)
+		assert.Len(t, merged, 2)
+	})
+
+	t.Run("BaseUntouched", func(t *testing.T) {
+		base := &test.Base{Value: 4}
+		_, err := tapedb.MergeLogs[*test.Base, *test.State](
+			test.NewFactory(), base,
+			[]tapedb.Change{&test.ChangeCounterInc{Value: 1}}, []tapedb.Change{&test.ChangeCounterInc{Value: 1}, logB[0]},
+			tapedb.FailOnConflict)
+		require.NoError(t, err)
+		assert.Equal(t, 4, base.Value)
+	})
+}
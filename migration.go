@@ -0,0 +1,52 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tapedb
+
+// ChangeMigrator upgrades the encoding of a change before it is decoded. It gets the stored type
+// name and data of a change and returns the type name and data that should be decoded instead.
+type ChangeMigrator interface {
+	MigrateChange(typeName string, data []byte) (string, []byte, error)
+}
+
+type ChangeMigratorFunc func(typeName string, data []byte) (string, []byte, error)
+
+func (fn ChangeMigratorFunc) MigrateChange(typeName string, data []byte) (string, []byte, error) {
+	return fn(typeName, data)
+}
+
+// Migrations applies a sequence of migrators in order.
+type Migrations []ChangeMigrator
+
+func (m Migrations) MigrateChange(typeName string, data []byte) (string, []byte, error) {
+	for _, migrator := range m {
+		var err error
+		typeName, data, err = migrator.MigrateChange(typeName, data)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	return typeName, data, nil
+}
+
+// RenameChangeType returns a migrator that decodes changes stored with type name from as changes
+// of type name to.
+func RenameChangeType(from, to string) ChangeMigrator {
+	return ChangeMigratorFunc(func(typeName string, data []byte) (string, []byte, error) {
+		if typeName == from {
+			return to, data, nil
+		}
+		return typeName, data, nil
+	})
+}
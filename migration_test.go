@@ -0,0 +1,62 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tapedb_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2"
+)
+
+func TestMigrations(t *testing.T) {
+	migrations := tapedb.Migrations{
+		tapedb.RenameChangeType("counter-plus", "counter-add"),
+		tapedb.ChangeMigratorFunc(func(typeName string, data []byte) (string, []byte, error) {
+			if typeName != "counter-add" {
+				return typeName, data, nil
+			}
+			return "counter-inc", bytes.ReplaceAll(data, []byte(`"v"`), []byte(`"value"`)), nil
+		}),
+	}
+
+	t.Run("Chain", func(t *testing.T) {
+		typeName, data, err := migrations.MigrateChange("counter-plus", []byte(`{"v":2}`))
+		require.NoError(t, err)
+		assert.Equal(t, "counter-inc", typeName)
+		assert.Equal(t, `{"value":2}`, string(data))
+	})
+
+	t.Run("Untouched", func(t *testing.T) {
+		typeName, data, err := migrations.MigrateChange("counter-set", []byte(`{"value":2}`))
+		require.NoError(t, err)
+		assert.Equal(t, "counter-set", typeName)
+		assert.Equal(t, `{"value":2}`, string(data))
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		errTest := errors.New("test")
+		_, _, err := tapedb.Migrations{
+			tapedb.ChangeMigratorFunc(func(string, []byte) (string, []byte, error) {
+				return "", nil, errTest
+			}),
+		}.MigrateChange("counter-inc", nil)
+		assert.ErrorIs(t, err, errTest)
+	})
+}
@@ -0,0 +1,285 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package outbox applies related changes to several databases, so that either all or none of them
+// end up in the logs, even if the process crashes in between.
+//
+// Before any change is applied, an intent that holds all changes of the transaction together with
+// the log lengths of the databases is written to the outbox directory. The intent is removed once
+// all changes have been applied. Intents that are still present when the outbox is opened again are
+// completed: a change is applied only if the log of its database doesn't hold it at the recorded
+// position yet.
+package outbox
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/simia-tech/tapedb/v2"
+)
+
+const filePrefixIntent = "intent-"
+
+var (
+	ErrUnknownTape = errors.New("unknown tape")
+	ErrDiverged    = errors.New("diverged")
+)
+
+// Outbox coordinates the transactions across the provided tapes. The tapes must not be changed
+// other than via the outbox while transactions are pending and must not be spliced before the
+// pending transactions are recovered.
+type Outbox struct {
+	path  string
+	tapes map[string]Tape
+	mutex sync.Mutex
+}
+
+type intent struct {
+	ID      string        `json:"id"`
+	Entries []intentEntry `json:"entries"`
+}
+
+type intentEntry struct {
+	Tape     string `json:"tape"`
+	LogLen   int64  `json:"logLen"`
+	TypeName string `json:"typeName"`
+	Data     []byte `json:"data"`
+}
+
+// Open opens the outbox in the directory at the provided path and completes the pending
+// transactions.
+func Open(path string, tapes map[string]Tape) (*Outbox, error) {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, fmt.Errorf("make directory: %w", err)
+	}
+
+	o := &Outbox{
+		path:  path,
+		tapes: tapes,
+	}
+	if err := o.Recover(); err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// Apply applies the provided changes to the tapes with the corresponding names. If applying one of
+// the changes fails, the transaction stays pending and is completed by Recover.
+func (o *Outbox) Apply(changes map[string]tapedb.Change) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	names := make([]string, 0, len(changes))
+	for name := range changes {
+		if _, ok := o.tapes[name]; !ok {
+			return fmt.Errorf("tape %s: %w", name, ErrUnknownTape)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	in := intent{ID: tapedb.GenerateUUID()}
+	for _, name := range names {
+		typeName, data, err := encodeChange(changes[name])
+		if err != nil {
+			return fmt.Errorf("encode change for %s: %w", name, err)
+		}
+		in.Entries = append(in.Entries, intentEntry{
+			Tape:     name,
+			LogLen:   o.tapes[name].LogLen64(),
+			TypeName: typeName,
+			Data:     data,
+		})
+	}
+
+	if err := o.writeIntent(in); err != nil {
+		return fmt.Errorf("prepare: %w", err)
+	}
+
+	for _, name := range names {
+		if err := o.tapes[name].Apply(changes[name]); err != nil {
+			return fmt.Errorf("apply change to %s: %w", name, err)
+		}
+	}
+
+	return o.removeIntent(in.ID)
+}
+
+// Pending returns the ids of the transactions that haven't been completed.
+func (o *Outbox) Pending() ([]string, error) {
+	entries, err := os.ReadDir(o.path)
+	if err != nil {
+		return nil, fmt.Errorf("read directory: %w", err)
+	}
+
+	ids := []string{}
+	for _, entry := range entries {
+		if name := entry.Name(); strings.HasPrefix(name, filePrefixIntent) && !strings.HasSuffix(name, ".new") {
+			ids = append(ids, strings.TrimPrefix(name, filePrefixIntent))
+		}
+	}
+	return ids, nil
+}
+
+// Recover completes the pending transactions.
+func (o *Outbox) Recover() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	ids, err := o.Pending()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		in, err := o.readIntent(id)
+		if err != nil {
+			return fmt.Errorf("read intent %s: %w", id, err)
+		}
+		for _, entry := range in.Entries {
+			if err := o.recoverEntry(entry); err != nil {
+				return fmt.Errorf("recover intent %s: %w", id, err)
+			}
+		}
+		if err := o.removeIntent(id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (o *Outbox) recoverEntry(entry intentEntry) error {
+	tape, ok := o.tapes[entry.Tape]
+	if !ok {
+		return fmt.Errorf("tape %s: %w", entry.Tape, ErrUnknownTape)
+	}
+
+	logLen := tape.LogLen64()
+	if logLen > entry.LogLen {
+		applied, err := hasChangeAt(tape, entry)
+		if err != nil {
+			return err
+		}
+		if !applied {
+			return fmt.Errorf("tape %s has other changes at index %d: %w", entry.Tape, entry.LogLen, ErrDiverged)
+		}
+		return nil
+	}
+	if logLen < entry.LogLen {
+		return fmt.Errorf("tape %s is shorter than the recorded length %d: %w", entry.Tape, entry.LogLen, ErrDiverged)
+	}
+
+	change, err := tape.NewChange(entry.TypeName)
+	if err != nil {
+		return err
+	}
+	if _, err := change.ReadFrom(bytes.NewReader(entry.Data)); err != nil {
+		return fmt.Errorf("decode change: %w", err)
+	}
+	if err := tape.Apply(change); err != nil {
+		return fmt.Errorf("apply change to %s: %w", entry.Tape, err)
+	}
+	return nil
+}
+
+var errStop = errors.New("stop")
+
+// hasChangeAt returns true if the tape holds the change of the entry at the recorded log index.
+func hasChangeAt(tape Tape, entry intentEntry) (bool, error) {
+	applied := false
+	err := tape.ReadChanges(func(index int, change tapedb.Change) error {
+		if int64(index) < entry.LogLen {
+			return nil
+		}
+		typeName, data, err := encodeChange(change)
+		if err != nil {
+			return err
+		}
+		applied = typeName == entry.TypeName && bytes.Equal(data, entry.Data)
+		return errStop
+	})
+	if err != nil && !errors.Is(err, errStop) {
+		return false, err
+	}
+	return applied, nil
+}
+
+func (o *Outbox) writeIntent(in intent) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(o.path, filePrefixIntent+in.ID)
+	newPath := path + ".new"
+	f, err := os.OpenFile(newPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(newPath)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(newPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(newPath)
+		return err
+	}
+	if err := os.Rename(newPath, path); err != nil {
+		os.Remove(newPath)
+		return err
+	}
+	return syncDir(o.path)
+}
+
+func (o *Outbox) readIntent(id string) (intent, error) {
+	data, err := os.ReadFile(filepath.Join(o.path, filePrefixIntent+id))
+	if err != nil {
+		return intent{}, err
+	}
+	in := intent{}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return intent{}, err
+	}
+	return in, nil
+}
+
+func (o *Outbox) removeIntent(id string) error {
+	if err := os.Remove(filepath.Join(o.path, filePrefixIntent+id)); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return syncDir(o.path)
+}
+
+func encodeChange(change tapedb.Change) (string, []byte, error) {
+	buffer := bytes.Buffer{}
+	if _, err := change.WriteTo(&buffer); err != nil {
+		return "", nil, err
+	}
+	return change.TypeName(), buffer.Bytes(), nil
+}
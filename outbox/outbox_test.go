@@ -0,0 +1,157 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package outbox_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2"
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/outbox"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestOutbox(t *testing.T) {
+	setupFn := func(t *testing.T) (string, *file.Database[*test.Base, *test.State], *file.Database[*test.Base, *test.State], func()) {
+		path, removeDir := makeTempDir(t)
+
+		tenant, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), filepath.Join(path, "tenant"))
+		require.NoError(t, err)
+		audit, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), filepath.Join(path, "audit"))
+		require.NoError(t, err)
+
+		return path, tenant, audit, func() {
+			require.NoError(t, tenant.Close())
+			require.NoError(t, audit.Close())
+			removeDir()
+		}
+	}
+
+	t.Run("Apply", func(t *testing.T) {
+		path, tenant, audit, teardown := setupFn(t)
+		defer teardown()
+
+		o, err := outbox.Open(filepath.Join(path, "outbox"), map[string]outbox.Tape{
+			"tenant": outbox.FileTape[*test.Base, *test.State](test.NewFactory(), tenant),
+			"audit":  outbox.FileTape[*test.Base, *test.State](test.NewFactory(), audit),
+		})
+		require.NoError(t, err)
+
+		require.NoError(t, o.Apply(map[string]tapedb.Change{
+			"tenant": &test.ChangeCounterInc{Value: 1},
+			"audit":  &test.ChangeCounterInc{Value: 2},
+		}))
+
+		assert.Equal(t, 1, tenant.State().Counter)
+		assert.Equal(t, 2, audit.State().Counter)
+
+		pending, err := o.Pending()
+		require.NoError(t, err)
+		assert.Empty(t, pending)
+	})
+
+	t.Run("Recover", func(t *testing.T) {
+		path, tenant, audit, teardown := setupFn(t)
+		defer teardown()
+
+		o, err := outbox.Open(filepath.Join(path, "outbox"), map[string]outbox.Tape{
+			"tenant": outbox.FileTape[*test.Base, *test.State](test.NewFactory(), tenant),
+			"audit":  &failingTape{Tape: outbox.FileTape[*test.Base, *test.State](test.NewFactory(), audit)},
+		})
+		require.NoError(t, err)
+
+		err = o.Apply(map[string]tapedb.Change{
+			"tenant": &test.ChangeCounterInc{Value: 1},
+			"audit":  &test.ChangeCounterInc{Value: 2},
+		})
+		assert.ErrorIs(t, err, errApplyFailed)
+		assert.Equal(t, 0, audit.State().Counter)
+
+		pending, err := o.Pending()
+		require.NoError(t, err)
+		assert.Len(t, pending, 1)
+
+		o, err = outbox.Open(filepath.Join(path, "outbox"), map[string]outbox.Tape{
+			"tenant": outbox.FileTape[*test.Base, *test.State](test.NewFactory(), tenant),
+			"audit":  outbox.FileTape[*test.Base, *test.State](test.NewFactory(), audit),
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, 1, tenant.LogLen())
+		assert.Equal(t, 1, tenant.State().Counter)
+		assert.Equal(t, 1, audit.LogLen())
+		assert.Equal(t, 2, audit.State().Counter)
+
+		pending, err = o.Pending()
+		require.NoError(t, err)
+		assert.Empty(t, pending)
+	})
+
+	t.Run("Diverged", func(t *testing.T) {
+		path, tenant, audit, teardown := setupFn(t)
+		defer teardown()
+
+		tapes := map[string]outbox.Tape{
+			"tenant": outbox.FileTape[*test.Base, *test.State](test.NewFactory(), tenant),
+			"audit":  &failingTape{Tape: outbox.FileTape[*test.Base, *test.State](test.NewFactory(), audit)},
+		}
+		o, err := outbox.Open(filepath.Join(path, "outbox"), tapes)
+		require.NoError(t, err)
+
+		err = o.Apply(map[string]tapedb.Change{
+			"tenant": &test.ChangeCounterInc{Value: 1},
+			"audit":  &test.ChangeCounterInc{Value: 2},
+		})
+		assert.ErrorIs(t, err, errApplyFailed)
+
+		require.NoError(t, audit.Apply(&test.ChangeCounterInc{Value: 3}))
+
+		_, err = outbox.Open(filepath.Join(path, "outbox"), map[string]outbox.Tape{
+			"tenant": outbox.FileTape[*test.Base, *test.State](test.NewFactory(), tenant),
+			"audit":  outbox.FileTape[*test.Base, *test.State](test.NewFactory(), audit),
+		})
+		assert.ErrorIs(t, err, outbox.ErrDiverged)
+	})
+
+	t.Run("UnknownTape", func(t *testing.T) {
+		path, tenant, _, teardown := setupFn(t)
+		defer teardown()
+
+		o, err := outbox.Open(filepath.Join(path, "outbox"), map[string]outbox.Tape{
+			"tenant": outbox.FileTape[*test.Base, *test.State](test.NewFactory(), tenant),
+		})
+		require.NoError(t, err)
+
+		err = o.Apply(map[string]tapedb.Change{
+			"audit": &test.ChangeCounterInc{Value: 2},
+		})
+		assert.ErrorIs(t, err, outbox.ErrUnknownTape)
+	})
+}
+
+var errApplyFailed = errors.New("apply failed")
+
+type failingTape struct {
+	outbox.Tape
+}
+
+func (t *failingTape) Apply(tapedb.Change) error {
+	return errApplyFailed
+}
@@ -0,0 +1,59 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package outbox
+
+import (
+	"github.com/simia-tech/tapedb/v2"
+	"github.com/simia-tech/tapedb/v2/io/file"
+)
+
+// Tape is a database that takes part in the transactions of an outbox.
+type Tape interface {
+	LogLen64() int64
+	Apply(tapedb.Change) error
+	ReadChanges(func(int, tapedb.Change) error) error
+	NewChange(string) (tapedb.Change, error)
+}
+
+type fileTape[B tapedb.Base, S tapedb.State, F tapedb.Factory[B, S]] struct {
+	f  F
+	db *file.Database[B, S]
+}
+
+// FileTape returns a Tape for the provided database. The factory is used to decode the changes of
+// pending transactions during the recovery.
+func FileTape[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](f F, db *file.Database[B, S]) Tape {
+	return &fileTape[B, S, F]{f: f, db: db}
+}
+
+func (t *fileTape[B, S, F]) LogLen64() int64 {
+	return t.db.LogLen64()
+}
+
+func (t *fileTape[B, S, F]) Apply(change tapedb.Change) error {
+	return t.db.Apply(change)
+}
+
+func (t *fileTape[B, S, F]) ReadChanges(fn func(int, tapedb.Change) error) error {
+	return t.db.ReadChanges(fn)
+}
+
+func (t *fileTape[B, S, F]) NewChange(typeName string) (tapedb.Change, error) {
+	return t.f.NewChange(typeName)
+}
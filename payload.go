@@ -0,0 +1,166 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tapedb
+
+import (
+	"io"
+	"sort"
+)
+
+const (
+	ChangeTypeAttachPayload = "tapedb-attach-payload"
+	ChangeTypeDetachPayload = "tapedb-detach-payload"
+)
+
+// PayloadContainer is implemented by bases and changes that reference payloads. Payloads that are
+// referenced by neither the base nor a change in the log are considered garbage.
+type PayloadContainer interface {
+	PayloadIDs() []string
+}
+
+// PayloadDetacher is implemented by changes that release the reference of earlier changes to
+// payloads.
+type PayloadDetacher interface {
+	DetachedPayloadIDs() []string
+}
+
+// AttachPayload is a standard change that attaches payloads to the model.
+type AttachPayload struct {
+	IDs []string `json:"ids"`
+}
+
+func (c *AttachPayload) TypeName() string {
+	return ChangeTypeAttachPayload
+}
+
+func (c *AttachPayload) ReadFrom(r io.Reader) (int64, error) {
+	return ReadJSON(r, c)
+}
+
+func (c *AttachPayload) WriteTo(w io.Writer) (int64, error) {
+	return WriteJSON(w, c)
+}
+
+func (c *AttachPayload) PayloadIDs() []string {
+	return c.IDs
+}
+
+// DetachPayload is a standard change that detaches payloads from the model.
+type DetachPayload struct {
+	IDs []string `json:"ids"`
+}
+
+func (c *DetachPayload) TypeName() string {
+	return ChangeTypeDetachPayload
+}
+
+func (c *DetachPayload) ReadFrom(r io.Reader) (int64, error) {
+	return ReadJSON(r, c)
+}
+
+func (c *DetachPayload) WriteTo(w io.Writer) (int64, error) {
+	return WriteJSON(w, c)
+}
+
+func (c *DetachPayload) DetachedPayloadIDs() []string {
+	return c.IDs
+}
+
+// NewPayloadChange returns a new AttachPayload or DetachPayload for the provided type name, so
+// factories can delegate to it. The boolean is false for other type names.
+func NewPayloadChange(typeName string) (Change, bool) {
+	switch typeName {
+	case ChangeTypeAttachPayload:
+		return &AttachPayload{}, true
+	case ChangeTypeDetachPayload:
+		return &DetachPayload{}, true
+	}
+	return nil, false
+}
+
+// Payloads keeps track of the attached payloads. Bases can embed it to implement
+// PayloadContainer and pass their changes to ApplyPayloadChange.
+type Payloads struct {
+	IDs []string `json:"payloadIDs,omitempty"`
+}
+
+// ApplyPayloadChange updates the attached payloads and returns true if the change attached or
+// detached payloads.
+func (p *Payloads) ApplyPayloadChange(c Change) bool {
+	references := PayloadReferences{}
+	references.Add(p.IDs...)
+	if !references.Track(c) {
+		return false
+	}
+	p.IDs = references.IDs()
+	return true
+}
+
+func (p *Payloads) PayloadIDs() []string {
+	return p.IDs
+}
+
+// PayloadReferences collects the payload ids that are referenced by a base and a sequence of
+// changes.
+type PayloadReferences map[string]struct{}
+
+func (r PayloadReferences) Add(ids ...string) {
+	for _, id := range ids {
+		r[id] = struct{}{}
+	}
+}
+
+// Track adds the payloads referenced by the provided base or change and removes the detached
+// ones. It returns true if the value is a PayloadContainer or a PayloadDetacher.
+func (r PayloadReferences) Track(baseOrChange any) bool {
+	tracked := false
+	if c, ok := baseOrChange.(PayloadContainer); ok {
+		r.Add(c.PayloadIDs()...)
+		tracked = true
+	}
+	if d, ok := baseOrChange.(PayloadDetacher); ok {
+		for _, id := range d.DetachedPayloadIDs() {
+			delete(r, id)
+		}
+		tracked = true
+	}
+	return tracked
+}
+
+func (r PayloadReferences) Has(id string) bool {
+	_, ok := r[id]
+	return ok
+}
+
+// Missing returns the sorted ids that are referenced by r but not by other.
+func (r PayloadReferences) Missing(other PayloadReferences) []string {
+	ids := []string{}
+	for _, id := range r.IDs() {
+		if !other.Has(id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// IDs returns the sorted referenced ids.
+func (r PayloadReferences) IDs() []string {
+	ids := make([]string, 0, len(r))
+	for id := range r {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
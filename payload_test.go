@@ -0,0 +1,67 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tapedb_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2"
+)
+
+func TestPayloadChanges(t *testing.T) {
+	t.Run("Encoding", func(t *testing.T) {
+		buffer := bytes.Buffer{}
+		_, err := (&tapedb.AttachPayload{IDs: []string{"123"}}).WriteTo(&buffer)
+		require.NoError(t, err)
+		assert.Equal(t, "{\"ids\":[\"123\"]}\n", buffer.String())
+
+		change, ok := tapedb.NewPayloadChange(tapedb.ChangeTypeAttachPayload)
+		require.True(t, ok)
+		_, err = change.ReadFrom(&buffer)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"123"}, change.(tapedb.PayloadContainer).PayloadIDs())
+
+		_, ok = tapedb.NewPayloadChange("counter-inc")
+		assert.False(t, ok)
+	})
+
+	t.Run("Payloads", func(t *testing.T) {
+		payloads := tapedb.Payloads{}
+
+		assert.True(t, payloads.ApplyPayloadChange(&tapedb.AttachPayload{IDs: []string{"456", "123"}}))
+		assert.Equal(t, []string{"123", "456"}, payloads.PayloadIDs())
+
+		assert.True(t, payloads.ApplyPayloadChange(&tapedb.DetachPayload{IDs: []string{"123"}}))
+		assert.Equal(t, []string{"456"}, payloads.PayloadIDs())
+	})
+
+	t.Run("References", func(t *testing.T) {
+		references := tapedb.PayloadReferences{}
+		references.Track(&tapedb.AttachPayload{IDs: []string{"123", "456"}})
+		references.Track(&tapedb.DetachPayload{IDs: []string{"123"}})
+
+		assert.False(t, references.Has("123"))
+		assert.True(t, references.Has("456"))
+		assert.False(t, references.Track("no change"))
+
+		other := tapedb.PayloadReferences{}
+		other.Add("789")
+		assert.Equal(t, []string{"456"}, references.Missing(other))
+	})
+}
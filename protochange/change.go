@@ -0,0 +1,139 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package protochange lets protobuf messages be used as changes. A message is wrapped in a Change,
+// whose type name is the full name of the message and which is encoded by proto marshaling. The
+// Factory adapter creates the changes of the registered message types and leaves all other types to
+// the wrapped factory.
+package protochange
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/simia-tech/tapedb/v2"
+)
+
+// Change wraps a protobuf message.
+type Change struct {
+	Message proto.Message
+}
+
+var _ tapedb.Change = &Change{}
+
+func New(m proto.Message) *Change {
+	return &Change{Message: m}
+}
+
+// TypeName returns the full name of the message, e.g. "shop.v1.OrderPlaced".
+func (c *Change) TypeName() string {
+	return string(c.Message.ProtoReflect().Descriptor().FullName())
+}
+
+// ReadFrom reads the rest of r and unmarshals it into the message.
+func (c *Change) ReadFrom(r io.Reader) (int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return int64(len(data)), err
+	}
+	if err := proto.Unmarshal(data, c.Message); err != nil {
+		return int64(len(data)), fmt.Errorf("unmarshal %s: %w", c.TypeName(), err)
+	}
+	return int64(len(data)), nil
+}
+
+// WriteTo writes the marshaled message. The encoding is deterministic, so equal messages result
+// in equal log entries.
+func (c *Change) WriteTo(w io.Writer) (int64, error) {
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(c.Message)
+	if err != nil {
+		return 0, fmt.Errorf("marshal %s: %w", c.TypeName(), err)
+	}
+	n, err := w.Write(data)
+	return int64(n), err
+}
+
+// Message returns the message of the change, if it's a protobuf change.
+func Message(c tapedb.Change) (proto.Message, bool) {
+	if pc, ok := c.(*Change); ok {
+		return pc.Message, true
+	}
+	return nil, false
+}
+
+// Registry maps the full names of messages to their types.
+type Registry struct {
+	types map[string]protoreflect.MessageType
+	mutex sync.RWMutex
+}
+
+func NewRegistry(messages ...proto.Message) *Registry {
+	r := &Registry{types: map[string]protoreflect.MessageType{}}
+	r.Register(messages...)
+	return r
+}
+
+// Register adds the types of the provided messages.
+func (r *Registry) Register(messages ...proto.Message) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, m := range messages {
+		mt := m.ProtoReflect().Type()
+		r.types[string(mt.Descriptor().FullName())] = mt
+	}
+}
+
+// NewChange returns an empty change of the message type with the provided full name. The returned
+// bool is false if the type isn't registered.
+func (r *Registry) NewChange(typeName string) (*Change, bool) {
+	r.mutex.RLock()
+	mt, ok := r.types[typeName]
+	r.mutex.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return New(mt.New().Interface()), true
+}
+
+// Factory creates protobuf changes for the types of its registry and delegates everything else to
+// the wrapped factory.
+type Factory[B tapedb.Base, S tapedb.State] struct {
+	tapedb.Factory[B, S]
+
+	Registry *Registry
+}
+
+var _ tapedb.Factory[tapedb.Base, tapedb.State] = &Factory[tapedb.Base, tapedb.State]{}
+
+func NewFactory[B tapedb.Base, S tapedb.State](f tapedb.Factory[B, S], messages ...proto.Message) *Factory[B, S] {
+	return &Factory[B, S]{
+		Factory:  f,
+		Registry: NewRegistry(messages...),
+	}
+}
+
+func (f *Factory[B, S]) NewChange(typeName string) (tapedb.Change, error) {
+	if change, ok := f.Registry.NewChange(typeName); ok {
+		return change, nil
+	}
+	if f.Factory == nil {
+		return nil, fmt.Errorf("change type [%s]: %w", typeName, tapedb.ErrUnknownChangeType)
+	}
+	return f.Factory.NewChange(typeName)
+}
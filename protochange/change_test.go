@@ -0,0 +1,54 @@
+package protochange_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/simia-tech/tapedb/v2"
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/protochange"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestFactory(t *testing.T) {
+	path, err := os.MkdirTemp("", "tapedb-")
+	require.NoError(t, err)
+	defer os.RemoveAll(path)
+
+	f := protochange.NewFactory[*test.Base, *test.State](test.NewFactory(), &wrapperspb.StringValue{})
+
+	db, err := file.CreateDatabase[*test.Base, *test.State](f, path)
+	require.NoError(t, err)
+	require.NoError(t, db.Apply(protochange.New(wrapperspb.String("hello"))))
+	require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 2}))
+	require.NoError(t, db.Close())
+
+	db, err = file.OpenDatabase[*test.Base, *test.State](f, path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	assert.Equal(t, 2, db.State().Counter)
+
+	changes := []tapedb.Change{}
+	require.NoError(t, db.ReadChanges(func(_ int, change tapedb.Change) error {
+		changes = append(changes, change)
+		return nil
+	}))
+	require.Len(t, changes, 2)
+
+	assert.Equal(t, "google.protobuf.StringValue", changes[0].TypeName())
+	message, ok := protochange.Message(changes[0])
+	require.True(t, ok)
+	assert.True(t, proto.Equal(wrapperspb.String("hello"), message))
+
+	_, ok = protochange.Message(changes[1])
+	assert.False(t, ok)
+
+	_, err = f.NewChange("google.protobuf.Int64Value")
+	assert.ErrorIs(t, err, tapedb.ErrUnknownChangeType)
+}
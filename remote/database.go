@@ -0,0 +1,367 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/simia-tech/tapedb/v2"
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/remote/remotepb"
+)
+
+var (
+	ErrMissing    = file.ErrMissing
+	ErrExisting   = file.ErrExisting
+	ErrForbidden  = errors.New("forbidden")
+	ErrBadRequest = errors.New("bad request")
+	ErrOutdated   = errors.New("outdated")
+	ErrRemote     = errors.New("remote")
+)
+
+// Database is a client for a database that is exposed by a Server. The base and the state are held
+// locally. A change is applied to the state after the server has appended it to the log. If the
+// log has been changed by another client in the meantime, ErrOutdated is returned and the database
+// has to be opened again.
+type Database[B tapedb.Base, S tapedb.State] struct {
+	client     remotepb.TapeClient
+	name       string
+	options    options
+	newChange  func(string) (tapedb.Change, error)
+	base       B
+	state      S
+	logLen     int64
+	stateMutex *sync.RWMutex
+}
+
+var _ tapedb.Database[tapedb.Base, tapedb.State] = &Database[tapedb.Base, tapedb.State]{}
+
+func CreateDatabase[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](f F, conn grpc.ClientConnInterface, name string, opts ...Option) (*Database[B, S], error) {
+	options := defaultOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	client := remotepb.NewTapeClient(conn)
+	if _, err := client.Create(options.context(), &remotepb.CreateRequest{Name: name}); err != nil {
+		return nil, fmt.Errorf("create database: %w", errorFromStatus(err))
+	}
+
+	return OpenDatabase[B, S](f, conn, name, opts...)
+}
+
+// OpenDatabase reads the base and the log of the remote database in a single call, so a splice on
+// the server can't lead to an inconsistent state.
+func OpenDatabase[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](f F, conn grpc.ClientConnInterface, name string, opts ...Option) (*Database[B, S], error) {
+	options := defaultOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	client := remotepb.NewTapeClient(conn)
+
+	ctx, cancel := context.WithCancel(options.context())
+	defer cancel()
+
+	stream, err := client.Open(ctx, &remotepb.OpenRequest{Name: name})
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", errorFromStatus(err))
+	}
+
+	response, err := stream.Recv()
+	if err != nil {
+		return nil, fmt.Errorf("receive base: %w", errorFromStatus(err))
+	}
+	base := f.NewBase()
+	if _, err := base.ReadFrom(bytes.NewReader(response.GetBase())); err != nil {
+		return nil, fmt.Errorf("read base: %w", err)
+	}
+
+	stateMutex := &sync.RWMutex{}
+	state := f.NewState(base, stateMutex.RLocker())
+
+	logLen := int64(0)
+	for {
+		response, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("receive change: %w", errorFromStatus(err))
+		}
+
+		change, err := readChange(f.NewChange, response.GetEntry())
+		if err != nil {
+			return nil, err
+		}
+		if err := state.Apply(change); err != nil {
+			return nil, err
+		}
+		logLen++
+	}
+
+	return &Database[B, S]{
+		client:     client,
+		name:       name,
+		options:    options,
+		newChange:  f.NewChange,
+		base:       base,
+		state:      state,
+		logLen:     logLen,
+		stateMutex: stateMutex,
+	}, nil
+}
+
+func (db *Database[B, S]) Base() B {
+	return db.base
+}
+
+func (db *Database[B, S]) State() S {
+	return db.state
+}
+
+// View calls fn with the state while it's read-locked, so several fields of the state can be read
+// consistently without racing concurrent changes. fn must neither apply changes nor take the read
+// locker of the state again.
+func (db *Database[B, S]) View(fn func(S) error) error {
+	db.stateMutex.RLock()
+	defer db.stateMutex.RUnlock()
+
+	return fn(db.state)
+}
+
+// Apply sends the change to the server and applies it to the local state once the server has
+// confirmed it.
+func (db *Database[B, S]) Apply(c tapedb.Change) error {
+	buffer := bytes.Buffer{}
+	if _, err := c.WriteTo(&buffer); err != nil {
+		return fmt.Errorf("write change: %w", err)
+	}
+
+	db.stateMutex.Lock()
+	defer db.stateMutex.Unlock()
+
+	response, err := db.client.Apply(db.options.context(), &remotepb.ApplyRequest{
+		Name:           db.name,
+		Type:           c.TypeName(),
+		Change:         buffer.Bytes(),
+		ExpectedLogLen: db.logLen,
+	})
+	if err != nil {
+		return fmt.Errorf("apply change: %w", errorFromStatus(err))
+	}
+
+	if err := db.state.Apply(c); err != nil {
+		return err
+	}
+	db.logLen = response.LogLen
+
+	return nil
+}
+
+func (db *Database[B, S]) Close() error {
+	return nil
+}
+
+func (db *Database[B, S]) LogLen() int {
+	return int(db.LogLen64())
+}
+
+func (db *Database[B, S]) LogLen64() int64 {
+	db.stateMutex.RLock()
+	defer db.stateMutex.RUnlock()
+	return db.logLen
+}
+
+// ReadChanges streams the remote log and calls fn for each change.
+func (db *Database[B, S]) ReadChanges(fn func(int, tapedb.Change) error) error {
+	return db.ReadChangesFrom(0, fn)
+}
+
+// ReadChangesFrom streams the remote log starting at the provided index and calls fn for each
+// change.
+func (db *Database[B, S]) ReadChangesFrom(index int64, fn func(int, tapedb.Change) error) error {
+	ctx, cancel := context.WithCancel(db.options.context())
+	defer cancel()
+
+	stream, err := db.client.StreamLog(ctx, &remotepb.StreamLogRequest{Name: db.name, FromIndex: index})
+	if err != nil {
+		return fmt.Errorf("stream log: %w", errorFromStatus(err))
+	}
+
+	for {
+		entry, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("receive change: %w", errorFromStatus(err))
+		}
+
+		change, err := readChange(db.newChange, entry)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(int(entry.Index), change); err != nil {
+			return err
+		}
+	}
+}
+
+func (db *Database[B, S]) OpenPayload(id string) (io.ReadCloser, error) {
+	ctx, cancel := context.WithCancel(db.options.context())
+
+	stream, err := db.client.GetPayload(ctx, &remotepb.GetPayloadRequest{Name: db.name, Id: id})
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("get payload: %w", errorFromStatus(err))
+	}
+
+	// the first chunk is received here, so a missing payload is reported right away
+	chunk, err := stream.Recv()
+	if err != nil && !errors.Is(err, io.EOF) {
+		cancel()
+		return nil, fmt.Errorf("get payload: %w", errorFromStatus(err))
+	}
+
+	return &payloadReader{
+		chunkReader: chunkReader{data: chunk.GetData(), recv: func() ([]byte, error) {
+			chunk, err := stream.Recv()
+			if err != nil {
+				return nil, errorFromStatus(err)
+			}
+			return chunk.Data, nil
+		}},
+		cancel: cancel,
+	}, nil
+}
+
+func (db *Database[B, S]) WritePayload(id string, r io.Reader) error {
+	ctx, cancel := context.WithCancel(db.options.context())
+	defer cancel()
+
+	stream, err := db.client.PutPayload(ctx)
+	if err != nil {
+		return fmt.Errorf("put payload: %w", errorFromStatus(err))
+	}
+
+	first := true
+	send := func(data []byte) error {
+		request := &remotepb.PutPayloadRequest{Data: data}
+		if first {
+			request.Name, request.Id = db.name, id
+			first = false
+		}
+		return stream.Send(request)
+	}
+
+	for {
+		// a new buffer is used for each chunk, since a sent message must not be modified
+		buffer := make([]byte, payloadChunkSize)
+		n, err := r.Read(buffer)
+		if n > 0 {
+			if err := send(buffer[:n]); err != nil {
+				// the actual error is returned by CloseAndRecv
+				break
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			if first {
+				// the payload is empty, so name and id still have to be sent
+				send(nil)
+			}
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read payload: %w", err)
+		}
+	}
+
+	if _, err := stream.CloseAndRecv(); err != nil {
+		return fmt.Errorf("put payload: %w", errorFromStatus(err))
+	}
+	return nil
+}
+
+type payloadReader struct {
+	chunkReader
+	cancel func()
+}
+
+func (r *payloadReader) Close() error {
+	r.cancel()
+	return nil
+}
+
+func (o options) context() context.Context {
+	return metadata.NewOutgoingContext(context.Background(), o.metadata)
+}
+
+func readChange(newChange func(string) (tapedb.Change, error), entry *remotepb.LogEntry) (tapedb.Change, error) {
+	if entry == nil {
+		return nil, fmt.Errorf("missing log entry: %w", ErrRemote)
+	}
+
+	change, err := newChange(entry.Type)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := change.ReadFrom(bytes.NewReader(entry.Change)); err != nil {
+		return nil, fmt.Errorf("read change %d: %w", entry.Index, err)
+	}
+
+	return change, nil
+}
+
+// errorFromStatus maps the status of a failed call to the errors of this package.
+func errorFromStatus(err error) error {
+	s, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+
+	switch s.Code() {
+	case codes.NotFound:
+		return fmt.Errorf("%s: %w", s.Message(), ErrMissing)
+	case codes.AlreadyExists:
+		return fmt.Errorf("%s: %w", s.Message(), ErrExisting)
+	case codes.PermissionDenied:
+		return fmt.Errorf("%s: %w", s.Message(), ErrForbidden)
+	case codes.InvalidArgument:
+		return fmt.Errorf("%s: %w", s.Message(), ErrBadRequest)
+	case codes.Aborted:
+		return fmt.Errorf("%s: %w", s.Message(), ErrOutdated)
+	}
+	return fmt.Errorf("%s (%s): %w", s.Message(), s.Code(), ErrRemote)
+}
@@ -0,0 +1,214 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote_test
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/simia-tech/tapedb/v2"
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/remote"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestDatabase(t *testing.T) {
+	path, removeDir := makeTempDir(t)
+	defer removeDir()
+
+	deck, err := file.NewDeck[*test.Base, *test.State, *test.Factory](2)
+	require.NoError(t, err)
+	defer deck.Close()
+
+	testFactory := test.NewFactory()
+
+	conn, stop := serve(t, remote.NewServer(deck, testFactory, path))
+	defer stop()
+
+	t.Run("CreateAndOpen", func(t *testing.T) {
+		db, err := remote.CreateDatabase[*test.Base, *test.State](testFactory, conn, "one")
+		require.NoError(t, err)
+
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 3}))
+		require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 4}))
+		assert.Equal(t, 7, db.State().Counter)
+		assert.Equal(t, 2, db.LogLen())
+		require.NoError(t, db.Close())
+
+		db, err = remote.OpenDatabase[*test.Base, *test.State](testFactory, conn, "one")
+		require.NoError(t, err)
+		defer db.Close()
+
+		assert.Equal(t, 7, db.State().Counter)
+		assert.Equal(t, 2, db.LogLen())
+		require.NoError(t, db.View(func(state *test.State) error {
+			assert.Equal(t, 7, state.Counter)
+			return nil
+		}))
+
+		typeNames := []string{}
+		require.NoError(t, db.ReadChanges(func(_ int, change tapedb.Change) error {
+			typeNames = append(typeNames, change.TypeName())
+			return nil
+		}))
+		assert.Equal(t, []string{"counter-inc", "counter-inc"}, typeNames)
+
+		indices := []int{}
+		require.NoError(t, db.ReadChangesFrom(1, func(index int, _ tapedb.Change) error {
+			indices = append(indices, index)
+			return nil
+		}))
+		assert.Equal(t, []int{1}, indices)
+	})
+
+	t.Run("CreateExisting", func(t *testing.T) {
+		_, err := remote.CreateDatabase[*test.Base, *test.State](testFactory, conn, "one")
+		assert.ErrorIs(t, err, remote.ErrExisting)
+	})
+
+	t.Run("CreateInvalidName", func(t *testing.T) {
+		_, err := remote.CreateDatabase[*test.Base, *test.State](testFactory, conn, "../one")
+		assert.ErrorIs(t, err, remote.ErrBadRequest)
+	})
+
+	t.Run("OpenMissing", func(t *testing.T) {
+		_, err := remote.OpenDatabase[*test.Base, *test.State](testFactory, conn, "missing")
+		assert.ErrorIs(t, err, remote.ErrMissing)
+		assert.Equal(t, tapedb.ErrorCodeMissing, tapedb.ErrorCodeOf(err))
+	})
+
+	t.Run("ApplyUnknownChange", func(t *testing.T) {
+		db, err := remote.OpenDatabase[*test.Base, *test.State](testFactory, conn, "one")
+		require.NoError(t, err)
+		defer db.Close()
+
+		assert.ErrorIs(t, db.Apply(&unknownChange{}), remote.ErrBadRequest)
+		assert.Equal(t, 2, db.LogLen())
+	})
+
+	t.Run("ApplyRejected", func(t *testing.T) {
+		db, err := remote.OpenDatabase[*test.Base, *test.State](testFactory, conn, "one")
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Apply(&test.ChangeAttachPayload{PayloadID: "789"})
+		assert.ErrorIs(t, err, remote.ErrMissing)
+		assert.Equal(t, 2, db.LogLen())
+		assert.Equal(t, 7, db.State().Counter)
+	})
+
+	t.Run("ApplyOutdated", func(t *testing.T) {
+		dbA, err := remote.OpenDatabase[*test.Base, *test.State](testFactory, conn, "one")
+		require.NoError(t, err)
+		defer dbA.Close()
+
+		dbB, err := remote.OpenDatabase[*test.Base, *test.State](testFactory, conn, "one")
+		require.NoError(t, err)
+		defer dbB.Close()
+
+		require.NoError(t, dbA.Apply(&test.ChangeCounterInc{Value: 1}))
+
+		assert.ErrorIs(t, dbB.Apply(&test.ChangeCounterInc{Value: 1}), remote.ErrOutdated)
+		assert.Equal(t, 7, dbB.State().Counter)
+	})
+
+	t.Run("Payload", func(t *testing.T) {
+		db, err := remote.OpenDatabase[*test.Base, *test.State](testFactory, conn, "one")
+		require.NoError(t, err)
+		defer db.Close()
+
+		content := strings.Repeat("test content ", 10000)
+		require.NoError(t, db.WritePayload("123", strings.NewReader(content)))
+
+		r, err := db.OpenPayload("123")
+		require.NoError(t, err)
+		defer r.Close()
+
+		data, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, content, string(data))
+
+		_, err = db.OpenPayload("456")
+		assert.ErrorIs(t, err, remote.ErrMissing)
+
+		_, err = db.OpenPayload("../meta")
+		assert.ErrorIs(t, err, remote.ErrBadRequest)
+	})
+
+	t.Run("EmptyPayload", func(t *testing.T) {
+		db, err := remote.OpenDatabase[*test.Base, *test.State](testFactory, conn, "one")
+		require.NoError(t, err)
+		defer db.Close()
+
+		require.NoError(t, db.WritePayload("empty", strings.NewReader("")))
+
+		r, err := db.OpenPayload("empty")
+		require.NoError(t, err)
+		defer r.Close()
+
+		data, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Empty(t, data)
+	})
+}
+
+func TestDatabaseWithKey(t *testing.T) {
+	path, removeDir := makeTempDir(t)
+	defer removeDir()
+
+	deck, err := file.NewDeck[*test.Base, *test.State, *test.Factory](2)
+	require.NoError(t, err)
+	defer deck.Close()
+
+	testFactory := test.NewFactory()
+	require.NoError(t, deck.Create(testFactory, filepath.Join(path, "one"), file.WithCreateKey(testKey)))
+
+	conn, stop := serve(t, remote.NewServer(deck, testFactory, path,
+		remote.WithOpenOptionsFunc(func(ctx context.Context, _ string) ([]file.OpenOption, error) {
+			md, _ := metadata.FromIncomingContext(ctx)
+			if values := md.Get("key"); len(values) > 0 {
+				return []file.OpenOption{file.WithOpenKey([]byte(values[0]))}, nil
+			}
+			return []file.OpenOption{}, nil
+		})))
+	defer stop()
+
+	_, err = remote.OpenDatabase[*test.Base, *test.State](testFactory, conn, "one",
+		remote.WithMetadata("key", "wrong key 123456"))
+	assert.ErrorIs(t, err, remote.ErrForbidden)
+
+	db, err := remote.OpenDatabase[*test.Base, *test.State](testFactory, conn, "one",
+		remote.WithMetadata("key", string(testKey)))
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.Apply(&test.ChangeCounterInc{Value: 3}))
+	assert.Equal(t, 3, db.State().Counter)
+}
+
+type unknownChange struct {
+	test.ChangeCounterInc
+}
+
+func (c *unknownChange) TypeName() string {
+	return "unknown"
+}
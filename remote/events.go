@@ -0,0 +1,145 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"github.com/simia-tech/tapedb/v2"
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/remote/remotepb"
+)
+
+// EventServer implements the Events service for the databases of a deck. It exposes the logs as
+// streams of protobuf Any messages that hold an Envelope with the change.
+type EventServer[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+] struct {
+	remotepb.UnimplementedEventsServer
+
+	server *Server[B, S, F]
+}
+
+var _ remotepb.EventsServer = &EventServer[tapedb.Base, tapedb.State, tapedb.Factory[tapedb.Base, tapedb.State]]{}
+
+func NewEventServer[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](deck *file.Deck[B, S, F], factory F, path string, opts ...ServerOption) *EventServer[B, S, F] {
+	return &EventServer[B, S, F]{
+		server: NewServer(deck, factory, path, opts...),
+	}
+}
+
+func (s *EventServer[B, S, F]) Subscribe(request *remotepb.SubscribeRequest, stream remotepb.Events_SubscribeServer) error {
+	path, opts, err := s.server.open(stream.Context(), request.Name)
+	if err != nil {
+		return err
+	}
+
+	err = s.server.deck.WithOpenRead(s.server.factory, path, opts, func(db *file.ReadOnlyDatabase[B, S]) error {
+		return db.ReadChanges(func(index int, change tapedb.Change) error {
+			if int64(index) < request.FromIndex {
+				return nil
+			}
+			event, err := PackChange(request.Name, int64(index), change)
+			if err != nil {
+				return err
+			}
+			return stream.Send(event)
+		})
+	})
+
+	return statusFromError(err)
+}
+
+func (s *EventServer[B, S, F]) Publish(stream remotepb.Events_PublishServer) error {
+	applied := int64(0)
+	for {
+		event, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(&remotepb.PublishResponse{Applied: applied})
+		}
+		if err != nil {
+			return err
+		}
+
+		database, _, change, err := UnpackChange[B, S](s.server.factory, event)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "event %d: %v", applied, err)
+		}
+
+		path, opts, err := s.server.open(stream.Context(), database)
+		if err != nil {
+			return err
+		}
+		err = s.server.deck.WithOpen(s.server.factory, path, opts, func(db *file.Database[B, S]) error {
+			return db.Apply(change)
+		})
+		if err != nil {
+			return statusFromError(fmt.Errorf("event %d: %w", applied, err))
+		}
+		applied++
+	}
+}
+
+// PackChange wraps the change together with its database and log index in an Envelope and packs it
+// into an Any.
+func PackChange(database string, index int64, change tapedb.Change) (*anypb.Any, error) {
+	buffer := bytes.Buffer{}
+	if _, err := change.WriteTo(&buffer); err != nil {
+		return nil, fmt.Errorf("write change %d: %w", index, err)
+	}
+
+	return anypb.New(&remotepb.Envelope{
+		Database: database,
+		Index:    index,
+		Type:     change.TypeName(),
+		Change:   buffer.Bytes(),
+	})
+}
+
+// UnpackChange returns the database, the log index and the change of the Envelope in the provided
+// Any.
+func UnpackChange[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](f F, event *anypb.Any) (string, int64, tapedb.Change, error) {
+	envelope := &remotepb.Envelope{}
+	if err := event.UnmarshalTo(envelope); err != nil {
+		return "", 0, nil, fmt.Errorf("unpack envelope: %w", err)
+	}
+
+	change, err := f.NewChange(envelope.Type)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	if _, err := change.ReadFrom(bytes.NewReader(envelope.Change)); err != nil {
+		return "", 0, nil, fmt.Errorf("read change %d: %w", envelope.Index, err)
+	}
+
+	return envelope.Database, envelope.Index, change, nil
+}
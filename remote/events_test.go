@@ -0,0 +1,93 @@
+package remote_test
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/remote"
+	"github.com/simia-tech/tapedb/v2/remote/remotepb"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestEvents(t *testing.T) {
+	path, removeDir := makeTempDir(t)
+	defer removeDir()
+
+	deck, err := file.NewDeck[*test.Base, *test.State, *test.Factory](2)
+	require.NoError(t, err)
+	defer deck.Close()
+
+	testFactory := test.NewFactory()
+
+	require.NoError(t, deck.Create(testFactory, filepath.Join(path, "one")))
+	require.NoError(t, deck.WithOpen(testFactory, filepath.Join(path, "one"), nil, func(db *file.Database[*test.Base, *test.State]) error {
+		if err := db.Apply(&test.ChangeCounterInc{Value: 2}); err != nil {
+			return err
+		}
+		return db.Apply(&test.ChangeCounterInc{Value: 3})
+	}))
+	require.NoError(t, deck.Create(testFactory, filepath.Join(path, "two")))
+
+	conn, stop := serveEvents(t, remote.NewEventServer(deck, testFactory, path))
+	defer stop()
+
+	client := remotepb.NewEventsClient(conn)
+
+	t.Run("Subscribe", func(t *testing.T) {
+		stream, err := client.Subscribe(context.Background(), &remotepb.SubscribeRequest{Name: "one", FromIndex: 1})
+		require.NoError(t, err)
+
+		event, err := stream.Recv()
+		require.NoError(t, err)
+
+		database, index, change, err := remote.UnpackChange[*test.Base, *test.State](testFactory, event)
+		require.NoError(t, err)
+		assert.Equal(t, "one", database)
+		assert.Equal(t, int64(1), index)
+		assert.Equal(t, &test.ChangeCounterInc{Value: 3}, change)
+
+		_, err = stream.Recv()
+		assert.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("Publish", func(t *testing.T) {
+		stream, err := client.Publish(context.Background())
+		require.NoError(t, err)
+
+		for _, value := range []int{4, 5} {
+			event, err := remote.PackChange("two", 0, &test.ChangeCounterInc{Value: value})
+			require.NoError(t, err)
+			require.NoError(t, stream.Send(event))
+		}
+
+		response, err := stream.CloseAndRecv()
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), response.Applied)
+
+		require.NoError(t, deck.WithOpenRead(testFactory, filepath.Join(path, "two"), nil, func(db *file.ReadOnlyDatabase[*test.Base, *test.State]) error {
+			assert.Equal(t, 9, db.State().Counter)
+			return nil
+		}))
+	})
+
+	t.Run("PublishInvalidEvent", func(t *testing.T) {
+		stream, err := client.Publish(context.Background())
+		require.NoError(t, err)
+
+		event, err := anypb.New(&remotepb.SubscribeRequest{Name: "two"})
+		require.NoError(t, err)
+		require.NoError(t, stream.Send(event))
+
+		_, err = stream.CloseAndRecv()
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
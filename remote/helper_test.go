@@ -0,0 +1,77 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote_test
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/simia-tech/tapedb/v2/remote/remotepb"
+)
+
+// serve runs the provided service on an in-memory listener and returns a connection to it.
+func serve(tb testing.TB, service remotepb.TapeServer) (*grpc.ClientConn, func()) {
+	return serveWith(tb, func(server *grpc.Server) {
+		remotepb.RegisterTapeServer(server, service)
+	})
+}
+
+func serveEvents(tb testing.TB, service remotepb.EventsServer) (*grpc.ClientConn, func()) {
+	return serveWith(tb, func(server *grpc.Server) {
+		remotepb.RegisterEventsServer(server, service)
+	})
+}
+
+func serveWith(tb testing.TB, register func(*grpc.Server)) (*grpc.ClientConn, func()) {
+	listener := bufconn.Listen(1024 * 1024)
+
+	server := grpc.NewServer()
+	register(server)
+	go server.Serve(listener)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(tb, err)
+
+	return conn, func() {
+		require.NoError(tb, conn.Close())
+		server.Stop()
+	}
+}
+
+func makeTempDir(tb testing.TB) (string, func()) {
+	n := [8]byte{}
+	rand.Read(n[:])
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("tapedb-%x", n[:]))
+	require.NoError(tb, os.MkdirAll(path, 0777))
+	return path, func() {
+		require.NoError(tb, os.RemoveAll(path))
+	}
+}
+
+var testKey = []byte("0123456789abcdef")
@@ -0,0 +1,78 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+
+	"google.golang.org/grpc/metadata"
+
+	"github.com/simia-tech/tapedb/v2/io/file"
+)
+
+type options struct {
+	metadata metadata.MD
+}
+
+var defaultOptions = options{
+	metadata: metadata.MD{},
+}
+
+type Option func(*options)
+
+// WithMetadata adds the key and value to the metadata of each call, e.g. to authenticate the
+// client.
+func WithMetadata(key, value string) Option {
+	return func(o *options) {
+		o.metadata = o.metadata.Copy()
+		o.metadata.Append(key, value)
+	}
+}
+
+type CreateOptionsFunc func(context.Context, string) ([]file.CreateOption, error)
+
+type OpenOptionsFunc func(context.Context, string) ([]file.OpenOption, error)
+
+type serverOptions struct {
+	createOptionsFunc CreateOptionsFunc
+	openOptionsFunc   OpenOptionsFunc
+}
+
+var defaultServerOptions = serverOptions{
+	createOptionsFunc: func(_ context.Context, _ string) ([]file.CreateOption, error) {
+		return []file.CreateOption{}, nil
+	},
+	openOptionsFunc: func(_ context.Context, _ string) ([]file.OpenOption, error) {
+		return []file.OpenOption{}, nil
+	},
+}
+
+type ServerOption func(*serverOptions)
+
+// WithCreateOptionsFunc returns the create options for a database. The incoming metadata of the
+// call can be read from the context.
+func WithCreateOptionsFunc(value CreateOptionsFunc) ServerOption {
+	return func(o *serverOptions) {
+		o.createOptionsFunc = value
+	}
+}
+
+// WithOpenOptionsFunc returns the open options for a database, e.g. the key. The incoming metadata
+// of the call can be read from the context.
+func WithOpenOptionsFunc(value OpenOptionsFunc) ServerOption {
+	return func(o *serverOptions) {
+		o.openOptionsFunc = value
+	}
+}
@@ -0,0 +1,350 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: tape.proto
+
+package remotepb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Tape_Create_FullMethodName     = "/tapedb.remote.v1.Tape/Create"
+	Tape_Open_FullMethodName       = "/tapedb.remote.v1.Tape/Open"
+	Tape_Apply_FullMethodName      = "/tapedb.remote.v1.Tape/Apply"
+	Tape_StreamLog_FullMethodName  = "/tapedb.remote.v1.Tape/StreamLog"
+	Tape_GetPayload_FullMethodName = "/tapedb.remote.v1.Tape/GetPayload"
+	Tape_PutPayload_FullMethodName = "/tapedb.remote.v1.Tape/PutPayload"
+)
+
+// TapeClient is the client API for Tape service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Tape exposes the databases of a deck. Each database is addressed by its directory name. Changes
+// are transferred in the encoding of their WriteTo method together with their type name.
+type TapeClient interface {
+	// Create creates an empty database.
+	Create(ctx context.Context, in *CreateRequest, opts ...grpc.CallOption) (*CreateResponse, error)
+	// Open streams the base followed by all changes of the log. Both are read while the database is
+	// locked, so they form a consistent view.
+	Open(ctx context.Context, in *OpenRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[OpenResponse], error)
+	// Apply appends a change to the log. The change is rejected if the log length doesn't match the
+	// expected one, so a client doesn't apply a change on top of a state it hasn't seen.
+	Apply(ctx context.Context, in *ApplyRequest, opts ...grpc.CallOption) (*ApplyResponse, error)
+	// StreamLog streams the changes of the log starting at the provided index.
+	StreamLog(ctx context.Context, in *StreamLogRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[LogEntry], error)
+	// GetPayload streams the content of a payload.
+	GetPayload(ctx context.Context, in *GetPayloadRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[PayloadChunk], error)
+	// PutPayload stores a payload. The name and id are taken from the first message.
+	PutPayload(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[PutPayloadRequest, PutPayloadResponse], error)
+}
+
+type tapeClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTapeClient(cc grpc.ClientConnInterface) TapeClient {
+	return &tapeClient{cc}
+}
+
+func (c *tapeClient) Create(ctx context.Context, in *CreateRequest, opts ...grpc.CallOption) (*CreateResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CreateResponse)
+	err := c.cc.Invoke(ctx, Tape_Create_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tapeClient) Open(ctx context.Context, in *OpenRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[OpenResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Tape_ServiceDesc.Streams[0], Tape_Open_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[OpenRequest, OpenResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Tape_OpenClient = grpc.ServerStreamingClient[OpenResponse]
+
+func (c *tapeClient) Apply(ctx context.Context, in *ApplyRequest, opts ...grpc.CallOption) (*ApplyResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ApplyResponse)
+	err := c.cc.Invoke(ctx, Tape_Apply_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tapeClient) StreamLog(ctx context.Context, in *StreamLogRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[LogEntry], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Tape_ServiceDesc.Streams[1], Tape_StreamLog_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamLogRequest, LogEntry]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Tape_StreamLogClient = grpc.ServerStreamingClient[LogEntry]
+
+func (c *tapeClient) GetPayload(ctx context.Context, in *GetPayloadRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[PayloadChunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Tape_ServiceDesc.Streams[2], Tape_GetPayload_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[GetPayloadRequest, PayloadChunk]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Tape_GetPayloadClient = grpc.ServerStreamingClient[PayloadChunk]
+
+func (c *tapeClient) PutPayload(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[PutPayloadRequest, PutPayloadResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Tape_ServiceDesc.Streams[3], Tape_PutPayload_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[PutPayloadRequest, PutPayloadResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Tape_PutPayloadClient = grpc.ClientStreamingClient[PutPayloadRequest, PutPayloadResponse]
+
+// TapeServer is the server API for Tape service.
+// All implementations must embed UnimplementedTapeServer
+// for forward compatibility.
+//
+// Tape exposes the databases of a deck. Each database is addressed by its directory name. Changes
+// are transferred in the encoding of their WriteTo method together with their type name.
+type TapeServer interface {
+	// Create creates an empty database.
+	Create(context.Context, *CreateRequest) (*CreateResponse, error)
+	// Open streams the base followed by all changes of the log. Both are read while the database is
+	// locked, so they form a consistent view.
+	Open(*OpenRequest, grpc.ServerStreamingServer[OpenResponse]) error
+	// Apply appends a change to the log. The change is rejected if the log length doesn't match the
+	// expected one, so a client doesn't apply a change on top of a state it hasn't seen.
+	Apply(context.Context, *ApplyRequest) (*ApplyResponse, error)
+	// StreamLog streams the changes of the log starting at the provided index.
+	StreamLog(*StreamLogRequest, grpc.ServerStreamingServer[LogEntry]) error
+	// GetPayload streams the content of a payload.
+	GetPayload(*GetPayloadRequest, grpc.ServerStreamingServer[PayloadChunk]) error
+	// PutPayload stores a payload. The name and id are taken from the first message.
+	PutPayload(grpc.ClientStreamingServer[PutPayloadRequest, PutPayloadResponse]) error
+	mustEmbedUnimplementedTapeServer()
+}
+
+// UnimplementedTapeServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedTapeServer struct{}
+
+func (UnimplementedTapeServer) Create(context.Context, *CreateRequest) (*CreateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Create not implemented")
+}
+func (UnimplementedTapeServer) Open(*OpenRequest, grpc.ServerStreamingServer[OpenResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Open not implemented")
+}
+func (UnimplementedTapeServer) Apply(context.Context, *ApplyRequest) (*ApplyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Apply not implemented")
+}
+func (UnimplementedTapeServer) StreamLog(*StreamLogRequest, grpc.ServerStreamingServer[LogEntry]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamLog not implemented")
+}
+func (UnimplementedTapeServer) GetPayload(*GetPayloadRequest, grpc.ServerStreamingServer[PayloadChunk]) error {
+	return status.Errorf(codes.Unimplemented, "method GetPayload not implemented")
+}
+func (UnimplementedTapeServer) PutPayload(grpc.ClientStreamingServer[PutPayloadRequest, PutPayloadResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method PutPayload not implemented")
+}
+func (UnimplementedTapeServer) mustEmbedUnimplementedTapeServer() {}
+func (UnimplementedTapeServer) testEmbeddedByValue()              {}
+
+// UnsafeTapeServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TapeServer will
+// result in compilation errors.
+type UnsafeTapeServer interface {
+	mustEmbedUnimplementedTapeServer()
+}
+
+func RegisterTapeServer(s grpc.ServiceRegistrar, srv TapeServer) {
+	// If the following call pancis, it indicates UnimplementedTapeServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Tape_ServiceDesc, srv)
+}
+
+func _Tape_Create_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TapeServer).Create(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tape_Create_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TapeServer).Create(ctx, req.(*CreateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tape_Open_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(OpenRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TapeServer).Open(m, &grpc.GenericServerStream[OpenRequest, OpenResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Tape_OpenServer = grpc.ServerStreamingServer[OpenResponse]
+
+func _Tape_Apply_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ApplyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TapeServer).Apply(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tape_Apply_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TapeServer).Apply(ctx, req.(*ApplyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tape_StreamLog_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamLogRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TapeServer).StreamLog(m, &grpc.GenericServerStream[StreamLogRequest, LogEntry]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Tape_StreamLogServer = grpc.ServerStreamingServer[LogEntry]
+
+func _Tape_GetPayload_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetPayloadRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TapeServer).GetPayload(m, &grpc.GenericServerStream[GetPayloadRequest, PayloadChunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Tape_GetPayloadServer = grpc.ServerStreamingServer[PayloadChunk]
+
+func _Tape_PutPayload_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(TapeServer).PutPayload(&grpc.GenericServerStream[PutPayloadRequest, PutPayloadResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Tape_PutPayloadServer = grpc.ClientStreamingServer[PutPayloadRequest, PutPayloadResponse]
+
+// Tape_ServiceDesc is the grpc.ServiceDesc for Tape service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Tape_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "tapedb.remote.v1.Tape",
+	HandlerType: (*TapeServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Create",
+			Handler:    _Tape_Create_Handler,
+		},
+		{
+			MethodName: "Apply",
+			Handler:    _Tape_Apply_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Open",
+			Handler:       _Tape_Open_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "StreamLog",
+			Handler:       _Tape_StreamLog_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "GetPayload",
+			Handler:       _Tape_GetPayload_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "PutPayload",
+			Handler:       _Tape_PutPayload_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "tape.proto",
+}
@@ -0,0 +1,328 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/simia-tech/tapedb/v2"
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/remote/remotepb"
+)
+
+const payloadChunkSize = 32 * 1024
+
+var errOutdated = errors.New("outdated")
+
+// Server implements the Tape service for the databases of a deck. The databases are stored in
+// directories below the provided path.
+type Server[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+] struct {
+	remotepb.UnimplementedTapeServer
+
+	deck    *file.Deck[B, S, F]
+	factory F
+	path    string
+	options serverOptions
+}
+
+var _ remotepb.TapeServer = &Server[tapedb.Base, tapedb.State, tapedb.Factory[tapedb.Base, tapedb.State]]{}
+
+func NewServer[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](deck *file.Deck[B, S, F], factory F, path string, opts ...ServerOption) *Server[B, S, F] {
+	options := defaultServerOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return &Server[B, S, F]{
+		deck:    deck,
+		factory: factory,
+		path:    path,
+		options: options,
+	}
+}
+
+func (s *Server[B, S, F]) Create(ctx context.Context, request *remotepb.CreateRequest) (*remotepb.CreateResponse, error) {
+	path, err := s.databasePath(request.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := s.options.createOptionsFunc(ctx, request.Name)
+	if err != nil {
+		return nil, statusFromError(err)
+	}
+
+	if err := s.deck.Create(s.factory, path, opts...); err != nil {
+		return nil, statusFromError(err)
+	}
+
+	return &remotepb.CreateResponse{}, nil
+}
+
+func (s *Server[B, S, F]) Open(request *remotepb.OpenRequest, stream remotepb.Tape_OpenServer) error {
+	path, opts, err := s.open(stream.Context(), request.Name)
+	if err != nil {
+		return err
+	}
+
+	err = s.deck.WithOpenRead(s.factory, path, opts, func(db *file.ReadOnlyDatabase[B, S]) error {
+		buffer := bytes.Buffer{}
+		if _, err := db.Base().WriteTo(&buffer); err != nil {
+			return fmt.Errorf("write base: %w", err)
+		}
+		if err := stream.Send(&remotepb.OpenResponse{Content: &remotepb.OpenResponse_Base{Base: buffer.Bytes()}}); err != nil {
+			return err
+		}
+
+		return db.ReadChanges(func(index int, change tapedb.Change) error {
+			entry, err := newLogEntry(index, change)
+			if err != nil {
+				return err
+			}
+			return stream.Send(&remotepb.OpenResponse{Content: &remotepb.OpenResponse_Entry{Entry: entry}})
+		})
+	})
+
+	return statusFromError(err)
+}
+
+func (s *Server[B, S, F]) Apply(ctx context.Context, request *remotepb.ApplyRequest) (*remotepb.ApplyResponse, error) {
+	path, opts, err := s.open(ctx, request.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	change, err := s.factory.NewChange(request.Type)
+	if err != nil {
+		return nil, statusFromError(err)
+	}
+	if _, err := change.ReadFrom(bytes.NewReader(request.Change)); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "read change: %v", err)
+	}
+
+	logLen := int64(0)
+	err = s.deck.WithOpen(s.factory, path, opts, func(db *file.Database[B, S]) error {
+		if db.LogLen64() != request.ExpectedLogLen {
+			return fmt.Errorf("log length is %d, expected %d: %w", db.LogLen64(), request.ExpectedLogLen, errOutdated)
+		}
+		if err := db.Apply(change); err != nil {
+			return err
+		}
+		logLen = db.LogLen64()
+		return nil
+	})
+	if err != nil {
+		return nil, statusFromError(err)
+	}
+
+	return &remotepb.ApplyResponse{LogLen: logLen}, nil
+}
+
+func (s *Server[B, S, F]) StreamLog(request *remotepb.StreamLogRequest, stream remotepb.Tape_StreamLogServer) error {
+	path, opts, err := s.open(stream.Context(), request.Name)
+	if err != nil {
+		return err
+	}
+
+	err = s.deck.WithOpenRead(s.factory, path, opts, func(db *file.ReadOnlyDatabase[B, S]) error {
+		return db.ReadChanges(func(index int, change tapedb.Change) error {
+			if int64(index) < request.FromIndex {
+				return nil
+			}
+			entry, err := newLogEntry(index, change)
+			if err != nil {
+				return err
+			}
+			return stream.Send(entry)
+		})
+	})
+
+	return statusFromError(err)
+}
+
+func (s *Server[B, S, F]) GetPayload(request *remotepb.GetPayloadRequest, stream remotepb.Tape_GetPayloadServer) error {
+	if !validName(request.Id) {
+		return status.Error(codes.InvalidArgument, "invalid payload id")
+	}
+	path, opts, err := s.open(stream.Context(), request.Name)
+	if err != nil {
+		return err
+	}
+
+	err = s.deck.WithOpenRead(s.factory, path, opts, func(db *file.ReadOnlyDatabase[B, S]) error {
+		r, err := db.OpenPayload(request.Id)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		for {
+			// a new buffer is used for each chunk, since a sent message must not be modified
+			buffer := make([]byte, payloadChunkSize)
+			n, err := r.Read(buffer)
+			if n > 0 {
+				if err := stream.Send(&remotepb.PayloadChunk{Data: buffer[:n]}); err != nil {
+					return err
+				}
+			}
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	})
+
+	return statusFromError(err)
+}
+
+func (s *Server[B, S, F]) PutPayload(stream remotepb.Tape_PutPayloadServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	if !validName(first.Id) {
+		return status.Error(codes.InvalidArgument, "invalid payload id")
+	}
+	path, opts, err := s.open(stream.Context(), first.Name)
+	if err != nil {
+		return err
+	}
+
+	r := &chunkReader{data: first.Data, recv: func() ([]byte, error) {
+		request, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		return request.Data, nil
+	}}
+	err = s.deck.WithOpen(s.factory, path, opts, func(db *file.Database[B, S]) error {
+		return db.WritePayload(file.NewPayload(first.Id, r))
+	})
+	if err != nil {
+		return statusFromError(err)
+	}
+
+	return stream.SendAndClose(&remotepb.PutPayloadResponse{})
+}
+
+func (s *Server[B, S, F]) open(ctx context.Context, name string) (string, []file.OpenOption, error) {
+	path, err := s.databasePath(name)
+	if err != nil {
+		return "", nil, err
+	}
+
+	opts, err := s.options.openOptionsFunc(ctx, name)
+	if err != nil {
+		return "", nil, statusFromError(err)
+	}
+
+	return path, opts, nil
+}
+
+func (s *Server[B, S, F]) databasePath(name string) (string, error) {
+	if !validName(name) {
+		return "", status.Error(codes.InvalidArgument, "invalid database name")
+	}
+	return filepath.Join(s.path, name), nil
+}
+
+func newLogEntry(index int, change tapedb.Change) (*remotepb.LogEntry, error) {
+	buffer := bytes.Buffer{}
+	if _, err := change.WriteTo(&buffer); err != nil {
+		return nil, fmt.Errorf("write change %d: %w", index, err)
+	}
+	return &remotepb.LogEntry{Index: int64(index), Type: change.TypeName(), Change: buffer.Bytes()}, nil
+}
+
+// chunkReader reads the data of consecutive messages.
+type chunkReader struct {
+	data []byte
+	recv func() ([]byte, error)
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.data) == 0 {
+		data, err := r.recv()
+		if err != nil {
+			return 0, err
+		}
+		r.data = data
+	}
+
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+var codeByErrorCode = map[tapedb.ErrorCode]codes.Code{
+	tapedb.ErrorCodeInvalidChange:   codes.InvalidArgument,
+	tapedb.ErrorCodeMissing:         codes.NotFound,
+	tapedb.ErrorCodePayloadMissing:  codes.NotFound,
+	tapedb.ErrorCodeExisting:        codes.AlreadyExists,
+	tapedb.ErrorCodePayloadExisting: codes.AlreadyExists,
+	tapedb.ErrorCodeInvalidKey:      codes.PermissionDenied,
+	tapedb.ErrorCodePayloadTooLarge: codes.ResourceExhausted,
+	tapedb.ErrorCodeReadOnly:        codes.FailedPrecondition,
+	tapedb.ErrorCodeLocked:          codes.Unavailable,
+	tapedb.ErrorCodeConflict:        codes.FailedPrecondition,
+	tapedb.ErrorCodeUnsupported:     codes.Unimplemented,
+}
+
+// statusFromError converts the error into a gRPC status, so the client can map it back.
+func statusFromError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	code := codes.Internal
+	if c, ok := codeByErrorCode[tapedb.ErrorCodeOf(err)]; ok {
+		code = c
+	}
+	switch {
+	case errors.Is(err, errOutdated):
+		code = codes.Aborted
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	}
+	return status.Error(code, err.Error())
+}
+
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, "/\\")
+}
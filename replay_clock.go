@@ -0,0 +1,123 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tapedb
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Timestamped is implemented by changes that carry the time they have been made at.
+type Timestamped interface {
+	Timestamp() time.Time
+}
+
+// ClockSetter is implemented by states with time-dependent logic (e.g. expirations). The database
+// sets the clock the state has to use instead of the system clock.
+type ClockSetter interface {
+	SetClock(Clock)
+}
+
+// ReplayClock is the clock of a replay. It shows the timestamp of the change that is replayed as
+// the current time, so a state that depends on the time is reconstructed like it was when the
+// changes have been applied. Timers fire as soon as the replay passes their deadline.
+type ReplayClock struct {
+	now    time.Time
+	timers []*replayTimer
+	mutex  sync.Mutex
+}
+
+var _ Clock = &ReplayClock{}
+
+func NewReplayClock(start time.Time) *ReplayClock {
+	return &ReplayClock{now: start}
+}
+
+func (c *ReplayClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// Sleep moves the time forward by the provided duration.
+func (c *ReplayClock) Sleep(d time.Duration) {
+	c.AdvanceTo(c.Now().Add(d))
+}
+
+func (c *ReplayClock) AfterFunc(d time.Duration, fn func()) Timer {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	t := &replayTimer{clock: c, deadline: c.now.Add(d), fn: fn}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// AdvanceTo moves the time forward to the provided time and runs the functions of all timers that
+// expired in the order of their deadlines. The time never moves backwards, so an earlier time is
+// ignored.
+func (c *ReplayClock) AdvanceTo(now time.Time) {
+	c.mutex.Lock()
+	if !now.After(c.now) {
+		c.mutex.Unlock()
+		return
+	}
+	c.now = now
+	expired := []*replayTimer{}
+	pending := []*replayTimer{}
+	for _, t := range c.timers {
+		if t.deadline.After(now) {
+			pending = append(pending, t)
+		} else {
+			expired = append(expired, t)
+		}
+	}
+	c.timers = pending
+	c.mutex.Unlock()
+
+	sort.SliceStable(expired, func(i, j int) bool {
+		return expired[i].deadline.Before(expired[j].deadline)
+	})
+	for _, t := range expired {
+		t.fn()
+	}
+}
+
+// Replay advances the clock to the timestamp of the provided change, if it has one.
+func (c *ReplayClock) Replay(change Change) {
+	if ts, ok := change.(Timestamped); ok {
+		c.AdvanceTo(ts.Timestamp())
+	}
+}
+
+type replayTimer struct {
+	clock    *ReplayClock
+	deadline time.Time
+	fn       func()
+}
+
+func (t *replayTimer) Stop() bool {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+
+	for index, other := range t.clock.timers {
+		if other == t {
+			t.clock.timers = append(t.clock.timers[:index], t.clock.timers[index+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tapedb_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/simia-tech/tapedb/v2"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+type timestampedChange struct {
+	test.ChangeCounterInc
+	at time.Time
+}
+
+func (c *timestampedChange) Timestamp() time.Time {
+	return c.at
+}
+
+func TestReplayClock(t *testing.T) {
+	start := time.Date(2021, time.May, 1, 12, 0, 0, 0, time.UTC)
+	clock := tapedb.NewReplayClock(start)
+
+	fired := []string{}
+	clock.AfterFunc(2*time.Minute, func() { fired = append(fired, "two") })
+	clock.AfterFunc(time.Minute, func() { fired = append(fired, "one") })
+	stopped := clock.AfterFunc(time.Minute, func() { fired = append(fired, "stopped") })
+	assert.True(t, stopped.Stop())
+
+	clock.Replay(&test.ChangeCounterInc{Value: 1})
+	assert.Equal(t, start, clock.Now())
+
+	clock.Replay(&timestampedChange{at: start.Add(3 * time.Minute)})
+	assert.Equal(t, start.Add(3*time.Minute), clock.Now())
+	assert.Equal(t, []string{"one", "two"}, fired)
+
+	clock.AdvanceTo(start)
+	assert.Equal(t, start.Add(3*time.Minute), clock.Now())
+}
@@ -0,0 +1,327 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replication
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/simia-tech/tapedb/v2"
+	tapeio "github.com/simia-tech/tapedb/v2/io"
+	"github.com/simia-tech/tapedb/v2/io/file"
+)
+
+// MetaFieldGeneration holds the splice generation of the leader log that is followed.
+const MetaFieldGeneration = "Replication-Generation"
+
+// MetaFieldIndex holds the number of leader log entries that have been applied to the follower,
+// including the ones that have been rebased into the leader's base.
+const MetaFieldIndex = "Replication-Index"
+
+// MetaFieldOffset holds the byte offset in the leader log behind the last applied entry.
+const MetaFieldOffset = "Replication-Offset"
+
+// MetaFieldLogLen holds the length of the follower's log at the time the position has been
+// written. Entries behind it have been applied, but the position wasn't updated yet.
+const MetaFieldLogLen = "Replication-Log-Len"
+
+// Follower applies the changes of a leader's log to a local database. The position in the leader's
+// log is persisted in the meta of the local database, so the replication resumes after a restart.
+//
+// If the leader is spliced, the follower continues in the new log. If entries have been rebased
+// into the leader's base that the follower hasn't applied yet, the follower's base is replaced by
+// the leader's base and its log is emptied.
+type Follower[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+] struct {
+	f           F
+	path        string
+	source      Source
+	openOptions []file.OpenOption
+	clock       tapedb.Clock
+	db          *file.Database[B, S]
+	position    file.TailPosition
+	skip        int64
+	mutex       sync.Mutex
+}
+
+// OpenFollower opens the database at the provided path as a follower of the provided source.
+func OpenFollower[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](f F, path string, source Source, opts ...FollowerOption) (*Follower[B, S, F], error) {
+	options := defaultFollowerOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	fo := &Follower[B, S, F]{
+		f:           f,
+		path:        path,
+		source:      source,
+		openOptions: options.openOptions,
+		clock:       tapedb.ClockOrSystem(options.clock),
+	}
+	if err := fo.open(); err != nil {
+		return nil, err
+	}
+	return fo, nil
+}
+
+func (fo *Follower[B, S, F]) open() error {
+	db, err := file.OpenDatabase[B, S](fo.f, fo.path, fo.openOptions...)
+	if err != nil {
+		return err
+	}
+	meta := db.Meta()
+
+	fo.db = db
+	fo.position = file.TailPosition{
+		Generation: meta.GetUInt64(MetaFieldGeneration, 0),
+		Index:      int64(meta.GetUInt64(MetaFieldIndex, 0)),
+		Offset:     int64(meta.GetUInt64(MetaFieldOffset, 0)),
+	}
+
+	// the position is written after the entries have been applied, so the entries behind the
+	// persisted log length are skipped in the leader's log rather than applied again
+	logLen := db.LogLen64()
+	persistedLogLen := int64(0)
+	if meta.Has(MetaFieldLogLen) {
+		persistedLogLen = int64(meta.GetUInt64(MetaFieldLogLen, 0))
+	} else if meta.Has(MetaFieldIndex) {
+		persistedLogLen = logLen
+	}
+	fo.skip = 0
+	if logLen > persistedLogLen {
+		fo.skip = logLen - persistedLogLen
+	}
+
+	return nil
+}
+
+// Database returns the follower's database. The database is replaced if the follower re-syncs
+// with the leader's base, so the returned value shouldn't be kept across calls to Poll.
+func (fo *Follower[B, S, F]) Database() *file.Database[B, S] {
+	fo.mutex.Lock()
+	defer fo.mutex.Unlock()
+	return fo.db
+}
+
+func (fo *Follower[B, S, F]) Index() int64 {
+	fo.mutex.Lock()
+	defer fo.mutex.Unlock()
+	return fo.position.Index
+}
+
+// Close closes the follower's database.
+func (fo *Follower[B, S, F]) Close() error {
+	fo.mutex.Lock()
+	defer fo.mutex.Unlock()
+	return fo.db.Close()
+}
+
+// Poll applies all log entries that have been added to the leader since the last poll and returns
+// the number of applied entries. An entry that is still being written by the leader is picked up
+// by the next poll.
+func (fo *Follower[B, S, F]) Poll() (int, error) {
+	fo.mutex.Lock()
+	defer fo.mutex.Unlock()
+
+	applied := 0
+	for {
+		position, err := fo.source.ReadLog(fo.position, func(entry tapeio.LogEntry) error {
+			if fo.skip > 0 {
+				fo.skip--
+				return nil
+			}
+			if err := fo.applyEntry(entry); err != nil {
+				return fmt.Errorf("entry %d: %w", applied, err)
+			}
+			applied++
+			return nil
+		})
+		if errors.Is(err, ErrRebased) {
+			if err := fo.resync(); err != nil {
+				return applied, fmt.Errorf("resync: %w", err)
+			}
+			continue
+		}
+
+		if position != fo.position {
+			fo.position = position
+			if mErr := fo.writePosition(); mErr != nil && err == nil {
+				err = fmt.Errorf("set meta: %w", mErr)
+			}
+		}
+		return applied, err
+	}
+}
+
+// Verify compares the hash of the follower's state with the provided hash of the leader's state,
+// e.g. as returned by the leader's StateHash at the same log index. If they differ,
+// file.ErrDiverged is returned.
+func (fo *Follower[B, S, F]) Verify(leaderHash []byte) error {
+	fo.mutex.Lock()
+	defer fo.mutex.Unlock()
+
+	if !bytes.Equal(fo.db.StateHash(), leaderHash) {
+		return fmt.Errorf("index %d: %w", fo.position.Index, file.ErrDiverged)
+	}
+	return nil
+}
+
+func (fo *Follower[B, S, F]) applyEntry(entry tapeio.LogEntry) error {
+	r, err := entry.Reader()
+	if err != nil {
+		return fmt.Errorf("reader: %w", err)
+	}
+
+	change, err := tapeio.ReadChange[B, S](fo.f, r, tapeio.WithCodec(fo.db.Codec()))
+	if err != nil {
+		return fmt.Errorf("read change: %w", err)
+	}
+
+	if err := fo.apply(change); err != nil {
+		return fmt.Errorf("apply change: %w", err)
+	}
+	return nil
+}
+
+func (fo *Follower[B, S, F]) apply(change tapedb.Change) error {
+	container, ok := change.(file.PayloadContainer)
+	if !ok {
+		return fo.db.Apply(change)
+	}
+
+	payloads, closeFn, err := fo.openMissingPayloads(container)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	return fo.db.Apply(change, payloads...)
+}
+
+func (fo *Follower[B, S, F]) openMissingPayloads(container file.PayloadContainer) ([]file.Payload, func(), error) {
+	payloadSource, ok := fo.source.(PayloadSource)
+	if !ok {
+		return nil, func() {}, nil
+	}
+
+	payloads := []file.Payload{}
+	closers := []func() error{}
+	closeFn := func() {
+		for _, fn := range closers {
+			fn()
+		}
+	}
+	for _, id := range container.PayloadIDs() {
+		if _, err := fo.db.StatPayload(id); err == nil {
+			continue
+		}
+
+		r, err := payloadSource.OpenPayload(id)
+		if err != nil {
+			closeFn()
+			return nil, nil, fmt.Errorf("open payload %s: %w", id, err)
+		}
+		closers = append(closers, r.Close)
+
+		payloads = append(payloads, file.NewPayload(id, r))
+	}
+	return payloads, closeFn, nil
+}
+
+// resync replaces the follower's base with the leader's base and empties the follower's log.
+func (fo *Follower[B, S, F]) resync() error {
+	baseR, position, err := fo.source.OpenBase()
+	if err != nil {
+		return fmt.Errorf("open base: %w", err)
+	}
+	base, err := tapeio.ReadBase[B, S](fo.f, baseR, tapeio.WithCodec(fo.db.Codec()))
+	if baseR != nil {
+		baseR.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	resetOpts := []file.ResetOption{file.WithResetKey(fo.db.Key())}
+	if cf, ok := any(fo.f).(tapedb.CodecFactory); ok {
+		resetOpts = append(resetOpts, file.WithResetCodecFactory(cf))
+	}
+	if err := fo.db.Close(); err != nil {
+		return fmt.Errorf("close: %w", err)
+	}
+	resetErr := file.ResetDatabase(fo.path, base, resetOpts...)
+	if err := fo.open(); err != nil {
+		return fmt.Errorf("open: %w", err)
+	}
+	if resetErr != nil {
+		return fmt.Errorf("reset: %w", resetErr)
+	}
+
+	if container, ok := any(base).(file.PayloadContainer); ok {
+		payloads, closeFn, err := fo.openMissingPayloads(container)
+		if err != nil {
+			return err
+		}
+		defer closeFn()
+		for _, payload := range payloads {
+			if err := fo.db.WritePayload(payload); err != nil {
+				return fmt.Errorf("write payload %s: %w", payload.ID(), err)
+			}
+		}
+	}
+
+	// the position is persisted last, so a crash before re-syncs again
+	fo.position = position
+	fo.skip = 0
+	return fo.writePosition()
+}
+
+func (fo *Follower[B, S, F]) writePosition() error {
+	meta := fo.db.Meta().Clone()
+	meta.SetUInt64(MetaFieldGeneration, fo.position.Generation)
+	meta.SetUInt64(MetaFieldIndex, uint64(fo.position.Index))
+	meta.SetUInt64(MetaFieldOffset, uint64(fo.position.Offset))
+	meta.SetUInt64(MetaFieldLogLen, uint64(fo.db.LogLen64()))
+	return fo.db.SetMeta(meta)
+}
+
+// Run polls the leader in the provided interval until the context is done.
+func (fo *Follower[B, S, F]) Run(ctx context.Context, interval time.Duration) error {
+	for {
+		if _, err := fo.Poll(); err != nil {
+			return err
+		}
+
+		tick := make(chan struct{})
+		timer := fo.clock.AfterFunc(interval, func() { close(tick) })
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-tick:
+		}
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replication_test
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2"
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/replication"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+type follower = replication.Follower[*test.Base, *test.State, *test.Factory]
+
+func TestFollower(t *testing.T) {
+	setup := func(t *testing.T, key []byte) (*file.Database[*test.Base, *test.State], string, string, func()) {
+		path, removeDir := makeTempDir(t)
+
+		leaderPath := filepath.Join(path, "leader")
+		leader, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), leaderPath, file.WithCreateKey(key))
+		require.NoError(t, err)
+
+		followerPath := filepath.Join(path, "follower")
+		follower, err := file.CreateDatabase[*test.Base, *test.State](test.NewFactory(), followerPath, file.WithCreateKey(key))
+		require.NoError(t, err)
+		require.NoError(t, follower.Close())
+
+		return leader, leaderPath, followerPath, removeDir
+	}
+
+	openFollower := func(t *testing.T, followerPath, leaderPath string, key []byte, opts ...replication.FollowerOption) *follower {
+		opts = append(opts, replication.WithOpenOptions(file.WithOpenKey(key)))
+		fo, err := replication.OpenFollower(test.NewFactory(), followerPath, replication.NewFileSource(leaderPath, key), opts...)
+		require.NoError(t, err)
+		return fo
+	}
+
+	splice := func(t *testing.T, leader *file.Database[*test.Base, *test.State], leaderPath string, count int, key []byte) *file.Database[*test.Base, *test.State] {
+		require.NoError(t, leader.Close())
+		_, err := file.SpliceDatabase[*test.Base, *test.State](test.NewFactory(), leaderPath,
+			file.WithRebaseChangeCount(count), file.WithSourceKey(key), file.WithTargetKey(key))
+		require.NoError(t, err)
+		leader, err = file.OpenDatabase[*test.Base, *test.State](test.NewFactory(), leaderPath, file.WithOpenKey(key))
+		require.NoError(t, err)
+		return leader
+	}
+
+	t.Run("Poll", func(t *testing.T) {
+		leader, leaderPath, followerPath, teardown := setup(t, nil)
+		defer teardown()
+		defer func() { require.NoError(t, leader.Close()) }()
+
+		require.NoError(t, leader.Apply(&test.ChangeCounterInc{Value: 2}))
+		require.NoError(t, leader.Apply(&test.ChangeCounterInc{Value: 3}))
+
+		fo := openFollower(t, followerPath, leaderPath, nil)
+
+		applied, err := fo.Poll()
+		require.NoError(t, err)
+		assert.Equal(t, 2, applied)
+		assert.Equal(t, 5, fo.Database().State().Counter)
+
+		require.NoError(t, leader.Apply(&test.ChangeCounterInc{Value: 4}))
+
+		applied, err = fo.Poll()
+		require.NoError(t, err)
+		assert.Equal(t, 1, applied)
+		assert.Equal(t, 9, fo.Database().State().Counter)
+		assert.Equal(t, int64(3), fo.Index())
+		assert.Equal(t, uint64(leader.LogOffset()), fo.Database().Meta().GetUInt64(replication.MetaFieldOffset, 0))
+		assert.NoError(t, fo.Verify(leader.StateHash()))
+		assert.ErrorIs(t, fo.Verify(tapedb.Hash(&test.State{Counter: 8})), file.ErrDiverged)
+		require.NoError(t, fo.Close())
+
+		fo = openFollower(t, followerPath, leaderPath, nil)
+		defer fo.Close()
+
+		applied, err = fo.Poll()
+		require.NoError(t, err)
+		assert.Equal(t, 0, applied)
+		assert.Equal(t, 9, fo.Database().State().Counter)
+		assert.Equal(t, 3, fo.Database().LogLen())
+	})
+
+	t.Run("EncryptedWithPayload", func(t *testing.T) {
+		leader, leaderPath, followerPath, teardown := setup(t, testKey)
+		defer teardown()
+		defer func() { require.NoError(t, leader.Close()) }()
+
+		require.NoError(t, leader.Apply(
+			&test.ChangeAttachPayload{PayloadID: "123"},
+			file.NewPayload("123", strings.NewReader("test content"))))
+
+		fo := openFollower(t, followerPath, leaderPath, testKey)
+		defer fo.Close()
+
+		applied, err := fo.Poll()
+		require.NoError(t, err)
+		assert.Equal(t, 1, applied)
+
+		assertPayload(t, fo.Database(), "123", "test content")
+	})
+
+	t.Run("LeaderSpliced", func(t *testing.T) {
+		leader, leaderPath, followerPath, teardown := setup(t, nil)
+		defer teardown()
+		defer func() { require.NoError(t, leader.Close()) }()
+
+		require.NoError(t, leader.Apply(&test.ChangeCounterInc{Value: 1}))
+		require.NoError(t, leader.Apply(&test.ChangeCounterInc{Value: 2}))
+
+		fo := openFollower(t, followerPath, leaderPath, nil)
+		defer fo.Close()
+
+		applied, err := fo.Poll()
+		require.NoError(t, err)
+		assert.Equal(t, 2, applied)
+
+		require.NoError(t, leader.Apply(&test.ChangeCounterInc{Value: 3}))
+		leader = splice(t, leader, leaderPath, 2, nil)
+		require.NoError(t, leader.Apply(&test.ChangeCounterInc{Value: 4}))
+
+		applied, err = fo.Poll()
+		require.NoError(t, err)
+		assert.Equal(t, 2, applied)
+		assert.Equal(t, 10, fo.Database().State().Counter)
+		assert.Equal(t, 4, fo.Database().LogLen())
+		assert.Equal(t, int64(4), fo.Index())
+		assert.NoError(t, fo.Verify(leader.StateHash()))
+	})
+
+	t.Run("LeaderSplicedBehind", func(t *testing.T) {
+		leader, leaderPath, followerPath, teardown := setup(t, testKey)
+		defer teardown()
+		defer func() { require.NoError(t, leader.Close()) }()
+
+		require.NoError(t, leader.Apply(&test.ChangeCounterInc{Value: 1}))
+
+		fo := openFollower(t, followerPath, leaderPath, testKey)
+		defer fo.Close()
+
+		applied, err := fo.Poll()
+		require.NoError(t, err)
+		assert.Equal(t, 1, applied)
+
+		require.NoError(t, leader.Apply(
+			&test.ChangeAttachPayload{PayloadID: "123"},
+			file.NewPayload("123", strings.NewReader("test content"))))
+		require.NoError(t, leader.Apply(&test.ChangeCounterInc{Value: 2}))
+		leader = splice(t, leader, leaderPath, 3, testKey)
+		require.NoError(t, leader.Apply(&test.ChangeCounterInc{Value: 3}))
+
+		applied, err = fo.Poll()
+		require.NoError(t, err)
+		assert.Equal(t, 1, applied)
+		assert.Equal(t, 3, fo.Database().Base().Value)
+		assert.Equal(t, 6, fo.Database().State().Counter)
+		assert.Equal(t, 1, fo.Database().LogLen())
+		assert.Equal(t, int64(4), fo.Index())
+		assert.NoError(t, fo.Verify(leader.StateHash()))
+		assertPayload(t, fo.Database(), "123", "test content")
+		require.NoError(t, fo.Close())
+
+		fo = openFollower(t, followerPath, leaderPath, testKey)
+		applied, err = fo.Poll()
+		require.NoError(t, err)
+		assert.Equal(t, 0, applied)
+		assert.Equal(t, 6, fo.Database().State().Counter)
+	})
+
+	t.Run("AppliedBeforePositionWritten", func(t *testing.T) {
+		leader, leaderPath, followerPath, teardown := setup(t, nil)
+		defer teardown()
+		defer func() { require.NoError(t, leader.Close()) }()
+
+		require.NoError(t, leader.Apply(&test.ChangeCounterInc{Value: 2}))
+
+		fo := openFollower(t, followerPath, leaderPath, nil)
+		_, err := fo.Poll()
+		require.NoError(t, err)
+
+		// simulates a crash after the apply, but before the position has been written
+		require.NoError(t, leader.Apply(&test.ChangeCounterInc{Value: 3}))
+		require.NoError(t, fo.Database().Apply(&test.ChangeCounterInc{Value: 3}))
+		require.NoError(t, fo.Close())
+
+		require.NoError(t, leader.Apply(&test.ChangeCounterInc{Value: 4}))
+
+		fo = openFollower(t, followerPath, leaderPath, nil)
+		defer fo.Close()
+
+		applied, err := fo.Poll()
+		require.NoError(t, err)
+		assert.Equal(t, 1, applied)
+		assert.Equal(t, 9, fo.Database().State().Counter)
+		assert.Equal(t, int64(3), fo.Index())
+		assert.NoError(t, fo.Verify(leader.StateHash()))
+	})
+
+	t.Run("Run", func(t *testing.T) {
+		leader, leaderPath, followerPath, teardown := setup(t, nil)
+		defer teardown()
+		defer func() { require.NoError(t, leader.Close()) }()
+
+		clock := test.NewClock(time.Now())
+		fo := openFollower(t, followerPath, leaderPath, nil, replication.WithClock(clock))
+		defer fo.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() {
+			done <- fo.Run(ctx, time.Minute)
+		}()
+
+		require.NoError(t, leader.Apply(&test.ChangeCounterInc{Value: 2}))
+		require.Eventually(t, func() bool {
+			clock.Add(time.Minute)
+			return fo.Index() == 1
+		}, time.Second, time.Millisecond)
+
+		cancel()
+		assert.ErrorIs(t, <-done, context.Canceled)
+	})
+}
+
+func assertPayload(tb testing.TB, db *file.Database[*test.Base, *test.State], id, expectContent string) {
+	r, err := db.OpenPayload(id)
+	require.NoError(tb, err)
+	defer r.Close()
+
+	content, err := io.ReadAll(r)
+	require.NoError(tb, err)
+	assert.Equal(tb, expectContent, string(content))
+}
@@ -0,0 +1,43 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replication
+
+import (
+	"github.com/simia-tech/tapedb/v2"
+	"github.com/simia-tech/tapedb/v2/io/file"
+)
+
+type followerOptions struct {
+	openOptions []file.OpenOption
+	clock       tapedb.Clock
+}
+
+var defaultFollowerOptions = followerOptions{}
+
+type FollowerOption func(*followerOptions)
+
+// WithOpenOptions sets the options that are used to open the follower's database.
+func WithOpenOptions(values ...file.OpenOption) FollowerOption {
+	return func(o *followerOptions) {
+		o.openOptions = values
+	}
+}
+
+// WithClock sets the clock that is used by Run to wait between the polls.
+func WithClock(value tapedb.Clock) FollowerOption {
+	return func(o *followerOptions) {
+		o.clock = value
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replication
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	tapeio "github.com/simia-tech/tapedb/v2/io"
+	"github.com/simia-tech/tapedb/v2/io/crypto"
+	"github.com/simia-tech/tapedb/v2/io/file"
+)
+
+// ErrRebased is returned by a Source if entries behind the requested position have been rebased
+// into the leader's base by a splice. The follower has to re-sync from the leader's base.
+var ErrRebased = errors.New("rebased")
+
+// Source provides access to the base and the log of a leader.
+type Source interface {
+	// ReadLog calls fn for each complete log entry behind the provided position and returns the
+	// position behind the last entry for which fn succeeded. If the leader has been spliced and
+	// entries that haven't been read yet were rebased, ErrRebased is returned.
+	ReadLog(file.TailPosition, func(tapeio.LogEntry) error) (file.TailPosition, error)
+
+	// OpenBase returns a reader of the leader's decrypted base and the log position right behind
+	// it. If the leader has no base, the returned reader is nil.
+	OpenBase() (io.ReadCloser, file.TailPosition, error)
+}
+
+// PayloadSource can be implemented by a Source to provide the payloads that are referenced by the
+// leader's changes.
+type PayloadSource interface {
+	OpenPayload(string) (io.ReadCloser, error)
+}
+
+type fileSource struct {
+	path string
+	key  []byte
+}
+
+var (
+	_ Source        = &fileSource{}
+	_ PayloadSource = &fileSource{}
+)
+
+// NewFileSource returns a source that reads the base, the log and the payloads of the leader
+// database at the provided path. The key is needed if the leader is encrypted.
+func NewFileSource(path string, key []byte) Source {
+	return &fileSource{path: path, key: key}
+}
+
+func (s *fileSource) ReadLog(position file.TailPosition, fn func(tapeio.LogEntry) error) (file.TailPosition, error) {
+	missed := int64(0)
+	session, err := file.NewTailSession(s.path,
+		file.WithTailKey(s.key),
+		file.WithTailPosition(position),
+		file.WithTailSpliceFunc(func(value int64) { missed = value }))
+	if err != nil {
+		return position, err
+	}
+
+	if _, err := session.Read(func(entry tapeio.LogEntry) error {
+		if missed > 0 {
+			return ErrRebased
+		}
+		return fn(entry)
+	}); err != nil {
+		return session.Position(), err
+	}
+	if missed > 0 {
+		return session.Position(), ErrRebased
+	}
+	return session.Position(), nil
+}
+
+func (s *fileSource) OpenBase() (io.ReadCloser, file.TailPosition, error) {
+	for {
+		meta, err := s.readMeta()
+		if err != nil {
+			return nil, file.TailPosition{}, err
+		}
+		position := file.TailPosition{
+			Generation: meta.GetUInt64(file.MetaFieldSpliceGeneration, 0),
+			Index:      int64(meta.GetUInt64(file.MetaFieldSpliceRebasedTotal, 0)),
+		}
+
+		f, err := os.Open(file.DefaultLayout.BasePath(s.path))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, file.TailPosition{}, err
+		}
+
+		// a splice might have replaced the base between reading the meta and opening the base
+		check, err := s.readMeta()
+		if err != nil {
+			if f != nil {
+				f.Close()
+			}
+			return nil, file.TailPosition{}, err
+		}
+		if check.GetUInt64(file.MetaFieldSpliceGeneration, 0) != position.Generation {
+			if f != nil {
+				f.Close()
+			}
+			continue
+		}
+
+		if f == nil {
+			return nil, position, nil
+		}
+
+		r, err := s.decrypt(f, meta)
+		if err != nil {
+			return nil, file.TailPosition{}, err
+		}
+		return r, position, nil
+	}
+}
+
+func (s *fileSource) OpenPayload(id string) (io.ReadCloser, error) {
+	f, err := os.Open(file.DefaultLayout.PayloadPath(s.path, id))
+	if os.IsNotExist(err) {
+		return nil, file.ErrPayloadMissing
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(s.key) == 0 {
+		return f, nil
+	}
+
+	meta, err := s.readMeta()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return s.decrypt(f, meta)
+}
+
+func (s *fileSource) readMeta() (file.Meta, error) {
+	meta, err := file.ReadMetaFile(file.DefaultLayout.MetaPath(s.path))
+	if os.IsNotExist(err) {
+		return file.Meta{}, nil
+	}
+	return meta, err
+}
+
+func (s *fileSource) decrypt(f *os.File, meta file.Meta) (io.ReadCloser, error) {
+	if len(s.key) == 0 {
+		return f, nil
+	}
+
+	c, err := crypto.ParseCipher(meta.Get(file.MetaHeaderCipher))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	r, err := crypto.NewBlockReaderWithCipher(f, c, s.key)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return tapeio.NewReadCloser(r, f.Close), nil
+}
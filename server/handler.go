@@ -0,0 +1,267 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/simia-tech/tapedb/v2"
+	"github.com/simia-tech/tapedb/v2/io/file"
+)
+
+// Handler exposes the databases in a directory via HTTP. Each database is addressed by its
+// directory name and provides the following endpoints.
+//
+//	POST /{name}                creates the database
+//	GET  /{name}/state          returns the JSON encoded state
+//	GET  /{name}/base           returns the encoded base
+//	GET  /{name}/log            returns all changes as JSON lines
+//	POST /{name}/changes        applies the change {"type": "...", "change": {...}}
+//	GET  /{name}/payloads/{id}  returns the payload
+//	PUT  /{name}/payloads/{id}  stores a payload
+type Handler[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+] struct {
+	deck    *file.Deck[B, S, F]
+	factory F
+	path    string
+	options handlerOptions
+}
+
+var _ http.Handler = &Handler[tapedb.Base, tapedb.State, tapedb.Factory[tapedb.Base, tapedb.State]]{}
+
+func NewHandler[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](deck *file.Deck[B, S, F], factory F, path string, opts ...Option) *Handler[B, S, F] {
+	options := defaultHandlerOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return &Handler[B, S, F]{
+		deck:    deck,
+		factory: factory,
+		path:    path,
+		options: options,
+	}
+}
+
+func (h *Handler[B, S, F]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if !validName(parts[0]) {
+		http.NotFound(w, r)
+		return
+	}
+	name := parts[0]
+	path := filepath.Join(h.path, name)
+
+	if len(parts) == 1 {
+		if r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		if err := h.create(r, name, path); err != nil {
+			WriteError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	resource := parts[1]
+
+	opts, err := h.options.openOptionsFunc(r, name)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	if len(parts) == 3 && !validName(parts[2]) {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case len(parts) == 2 && resource == "state" && r.Method == http.MethodGet:
+		err = h.deck.WithOpenRead(h.factory, path, opts, func(db *file.ReadOnlyDatabase[B, S]) error {
+			return writeJSON(w, db.State())
+		})
+	case len(parts) == 2 && resource == "base" && r.Method == http.MethodGet:
+		err = h.deck.WithOpenRead(h.factory, path, opts, func(db *file.ReadOnlyDatabase[B, S]) error {
+			buffer := bytes.Buffer{}
+			if _, err := db.Base().WriteTo(&buffer); err != nil {
+				return err
+			}
+			_, err := buffer.WriteTo(w)
+			return err
+		})
+	case len(parts) == 2 && resource == "log" && r.Method == http.MethodGet:
+		err = h.deck.WithOpenRead(h.factory, path, opts, func(db *file.ReadOnlyDatabase[B, S]) error {
+			return h.writeLog(w, db)
+		})
+	case len(parts) == 2 && resource == "changes" && r.Method == http.MethodPost:
+		change := tapedb.Change(nil)
+		if change, err = h.readChange(r.Body); err != nil {
+			break
+		}
+		err = h.deck.WithOpen(h.factory, path, opts, func(db *file.Database[B, S]) error {
+			return db.Apply(change)
+		})
+		if err == nil {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case len(parts) == 3 && resource == "payloads" && r.Method == http.MethodGet:
+		err = h.deck.WithOpenRead(h.factory, path, opts, func(db *file.ReadOnlyDatabase[B, S]) error {
+			f, err := db.OpenPayload(parts[2])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			http.ServeContent(w, r, parts[2], time.Time{}, f)
+			return nil
+		})
+	case len(parts) == 3 && resource == "payloads" && r.Method == http.MethodPut:
+		err = h.deck.WithOpen(h.factory, path, opts, func(db *file.Database[B, S]) error {
+			return db.WritePayload(file.NewPayload(parts[2], r.Body))
+		})
+		if err == nil {
+			w.WriteHeader(http.StatusCreated)
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		WriteError(w, err)
+	}
+}
+
+func (h *Handler[B, S, F]) create(r *http.Request, name, path string) error {
+	opts, err := h.options.createOptionsFunc(r, name)
+	if err != nil {
+		return err
+	}
+	return h.deck.Create(h.factory, path, opts...)
+}
+
+type logLine struct {
+	Index  int             `json:"index"`
+	Type   string          `json:"type"`
+	Change json.RawMessage `json:"change"`
+}
+
+func (h *Handler[B, S, F]) writeLog(w http.ResponseWriter, db *file.ReadOnlyDatabase[B, S]) error {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+
+	encoder := json.NewEncoder(w)
+	return db.ReadChanges(func(index int, change tapedb.Change) error {
+		buffer := bytes.Buffer{}
+		if _, err := change.WriteTo(&buffer); err != nil {
+			return err
+		}
+
+		data := bytes.TrimSpace(buffer.Bytes())
+		if !json.Valid(data) {
+			encoded, err := json.Marshal(buffer.String())
+			if err != nil {
+				return err
+			}
+			data = encoded
+		}
+
+		return encoder.Encode(logLine{Index: index, Type: change.TypeName(), Change: data})
+	})
+}
+
+type changeRequest struct {
+	Type   string          `json:"type"`
+	Change json.RawMessage `json:"change"`
+}
+
+func (h *Handler[B, S, F]) readChange(r io.Reader) (tapedb.Change, error) {
+	request := changeRequest{}
+	if err := json.NewDecoder(r).Decode(&request); err != nil {
+		return nil, fmt.Errorf("decode request: %w", errBadRequest)
+	}
+
+	change, err := h.factory.NewChange(request.Type)
+	if err != nil {
+		return nil, fmt.Errorf("unknown change type %q: %w", request.Type, errBadRequest)
+	}
+
+	data := []byte(request.Change)
+	if len(data) > 0 && data[0] == '"' {
+		text := ""
+		if err := json.Unmarshal(data, &text); err != nil {
+			return nil, fmt.Errorf("decode change: %w", errBadRequest)
+		}
+		data = []byte(text)
+	}
+
+	if _, err := change.ReadFrom(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("read change: %w", errBadRequest)
+	}
+
+	return change, nil
+}
+
+var errBadRequest = errors.New("bad request")
+
+func writeJSON(w http.ResponseWriter, v any) error {
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(v)
+}
+
+var statusByErrorCode = map[tapedb.ErrorCode]int{
+	tapedb.ErrorCodeInvalidChange:   http.StatusBadRequest,
+	tapedb.ErrorCodeMissing:         http.StatusNotFound,
+	tapedb.ErrorCodePayloadMissing:  http.StatusNotFound,
+	tapedb.ErrorCodeInvalidKey:      http.StatusForbidden,
+	tapedb.ErrorCodeExisting:        http.StatusConflict,
+	tapedb.ErrorCodePayloadExisting: http.StatusConflict,
+	tapedb.ErrorCodePayloadTooLarge: http.StatusRequestEntityTooLarge,
+	tapedb.ErrorCodeReadOnly:        http.StatusMethodNotAllowed,
+	tapedb.ErrorCodeLocked:          http.StatusLocked,
+	tapedb.ErrorCodeConflict:        http.StatusConflict,
+	tapedb.ErrorCodeUnsupported:     http.StatusNotImplemented,
+}
+
+// WriteError responds with the status that matches the error code of the provided error, so
+// handlers that are wrapped by the middleware report errors like the handler does.
+func WriteError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, errBadRequest) {
+		status = http.StatusBadRequest
+	} else if s, ok := statusByErrorCode[tapedb.ErrorCodeOf(err)]; ok {
+		status = s
+	}
+	http.Error(w, err.Error(), status)
+}
+
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, "/\\")
+}
@@ -0,0 +1,171 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2"
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/server"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestHandler(t *testing.T) {
+	path, removeDir := makeTempDir(t)
+	defer removeDir()
+
+	deck, err := file.NewDeck[*test.Base, *test.State, *test.Factory](2)
+	require.NoError(t, err)
+	defer deck.Close()
+
+	testFactory := test.NewFactory()
+
+	require.NoError(t, deck.Create(testFactory, filepath.Join(path, "one")))
+
+	s := httptest.NewServer(server.NewHandler(deck, testFactory, path))
+	defer s.Close()
+
+	t.Run("Create", func(t *testing.T) {
+		status, _ := request(t, http.MethodPost, s.URL+"/three", "")
+		assert.Equal(t, http.StatusCreated, status)
+
+		status, _ = request(t, http.MethodPost, s.URL+"/three", "")
+		assert.Equal(t, http.StatusConflict, status)
+	})
+
+	t.Run("PostChange", func(t *testing.T) {
+		status, _ := request(t, http.MethodPost, s.URL+"/one/changes", `{"type":"counter-inc","change":{"value":3}}`)
+		assert.Equal(t, http.StatusNoContent, status)
+
+		status, body := request(t, http.MethodGet, s.URL+"/one/state", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Contains(t, body, `"Counter":3`)
+	})
+
+	t.Run("PostChangeToMissingDatabase", func(t *testing.T) {
+		status, body := request(t, http.MethodPost, s.URL+"/two/changes", `{"type":"counter-inc","change":{"value":3}}`)
+		assert.Equal(t, http.StatusNotFound, status)
+		assert.Contains(t, body, "missing")
+	})
+
+	t.Run("PostChangeWithMissingPayload", func(t *testing.T) {
+		status, body := request(t, http.MethodPost, s.URL+"/one/changes", `{"type":"attach-payload","change":{"payloadID":"789"}}`)
+		assert.Equal(t, http.StatusNotFound, status)
+		assert.Contains(t, body, "payload missing")
+	})
+
+	t.Run("PostUnknownChange", func(t *testing.T) {
+		status, _ := request(t, http.MethodPost, s.URL+"/one/changes", `{"type":"unknown","change":{}}`)
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+
+	t.Run("GetBase", func(t *testing.T) {
+		status, body := request(t, http.MethodGet, s.URL+"/one/base", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "{\"value\":0}\n", body)
+	})
+
+	t.Run("GetLog", func(t *testing.T) {
+		status, body := request(t, http.MethodGet, s.URL+"/one/log", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "{\"index\":0,\"type\":\"counter-inc\",\"change\":{\"value\":3}}\n", body)
+	})
+
+	t.Run("Payload", func(t *testing.T) {
+		status, _ := request(t, http.MethodPut, s.URL+"/one/payloads/123", "test content")
+		assert.Equal(t, http.StatusCreated, status)
+
+		status, body := request(t, http.MethodGet, s.URL+"/one/payloads/123", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "test content", body)
+
+		status, _ = request(t, http.MethodGet, s.URL+"/one/payloads/456", "")
+		assert.Equal(t, http.StatusNotFound, status)
+	})
+
+	t.Run("InvalidPayloadID", func(t *testing.T) {
+		status, _ := request(t, http.MethodGet, s.URL+"/one/payloads/a%5Cb", "")
+		assert.Equal(t, http.StatusNotFound, status)
+	})
+
+	t.Run("MissingDatabase", func(t *testing.T) {
+		status, _ := request(t, http.MethodGet, s.URL+"/two/state", "")
+		assert.Equal(t, http.StatusNotFound, status)
+	})
+}
+
+func TestHandlerReadOnly(t *testing.T) {
+	path, removeDir := makeTempDir(t)
+	defer removeDir()
+
+	deck, err := file.NewDeck[*test.Base, *test.State, *test.Factory](2)
+	require.NoError(t, err)
+	defer deck.Close()
+
+	testFactory := test.NewFactory()
+
+	require.NoError(t, deck.Create(testFactory, filepath.Join(path, "one")))
+	require.NoError(t, deck.Close())
+
+	s := httptest.NewServer(server.NewHandler(deck, testFactory, path,
+		server.WithOpenOptionsFunc(func(_ *http.Request, _ string) ([]file.OpenOption, error) {
+			return []file.OpenOption{file.WithReadOnly()}, nil
+		})))
+	defer s.Close()
+
+	status, body := request(t, http.MethodPost, s.URL+"/one/changes", `{"type":"counter-inc","change":{"value":3}}`)
+	assert.Equal(t, http.StatusMethodNotAllowed, status)
+	assert.Contains(t, body, "read only")
+}
+
+// strictFactory fails with an uncoded error for change types it doesn't know.
+type strictFactory struct {
+	*test.Factory
+}
+
+func (f strictFactory) NewChange(typeName string) (tapedb.Change, error) {
+	if typeName != "counter-inc" {
+		return nil, errors.New("not supported")
+	}
+	return f.Factory.NewChange(typeName)
+}
+
+func TestHandlerUnknownChangeType(t *testing.T) {
+	path, removeDir := makeTempDir(t)
+	defer removeDir()
+
+	deck, err := file.NewDeck[*test.Base, *test.State, strictFactory](2)
+	require.NoError(t, err)
+	defer deck.Close()
+
+	testFactory := strictFactory{Factory: test.NewFactory()}
+
+	require.NoError(t, deck.Create(testFactory, filepath.Join(path, "one")))
+
+	s := httptest.NewServer(server.NewHandler(deck, testFactory, path))
+	defer s.Close()
+
+	status, body := request(t, http.MethodPost, s.URL+"/one/changes", `{"type":"counter-set","change":{"value":3}}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Contains(t, body, `unknown change type "counter-set"`)
+}
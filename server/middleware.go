@@ -0,0 +1,180 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+
+	"github.com/simia-tech/tapedb/v2"
+	"github.com/simia-tech/tapedb/v2/io/file"
+)
+
+// TenantFunc extracts the tenant id from the request.
+type TenantFunc func(*http.Request) (string, error)
+
+// PathFunc resolves the database path of the provided tenant.
+type PathFunc func(*http.Request, string) (string, error)
+
+// HeaderTenantFunc returns a tenant function that reads the tenant id from the provided header.
+func HeaderTenantFunc(name string) TenantFunc {
+	return func(r *http.Request) (string, error) {
+		tenant := r.Header.Get(name)
+		if tenant == "" {
+			return "", fmt.Errorf("missing tenant header %s: %w", name, errBadRequest)
+		}
+		return tenant, nil
+	}
+}
+
+// BasicAuthTenantFunc returns a tenant function that uses the user name of the basic auth
+// credentials as tenant id. The password can be read from the request to derive the key of the
+// tenant's database.
+func BasicAuthTenantFunc() TenantFunc {
+	return func(r *http.Request) (string, error) {
+		tenant, _, ok := r.BasicAuth()
+		if !ok || tenant == "" {
+			return "", fmt.Errorf("missing basic auth: %w", errBadRequest)
+		}
+		return tenant, nil
+	}
+}
+
+// DirectoryPathFunc returns a path function that places the database of each tenant in a
+// sub-directory of the provided path.
+func DirectoryPathFunc(path string) PathFunc {
+	return func(_ *http.Request, tenant string) (string, error) {
+		if !validName(tenant) {
+			return "", fmt.Errorf("invalid tenant %q: %w", tenant, errBadRequest)
+		}
+		return filepath.Join(path, tenant), nil
+	}
+}
+
+// Middleware binds a database of the deck to each request. The tenant of the request determines
+// the database, which is locked for the duration of the request and can be retrieved from the
+// request context via DatabaseFromContext.
+type Middleware[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+] struct {
+	deck     *file.Deck[B, S, F]
+	factory  F
+	tenantFn TenantFunc
+	pathFn   PathFunc
+	options  middlewareOptions
+}
+
+func NewMiddleware[
+	B tapedb.Base,
+	S tapedb.State,
+	F tapedb.Factory[B, S],
+](deck *file.Deck[B, S, F], factory F, tenantFn TenantFunc, pathFn PathFunc, opts ...MiddlewareOption) *Middleware[B, S, F] {
+	options := defaultMiddlewareOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return &Middleware[B, S, F]{
+		deck:     deck,
+		factory:  factory,
+		tenantFn: tenantFn,
+		pathFn:   pathFn,
+		options:  options,
+	}
+}
+
+// Read returns a handler that calls next with the tenant's database opened for reading. The handler
+// can retrieve it via ReadOnlyDatabaseFromContext.
+func (m *Middleware[B, S, F]) Read(next http.Handler) http.Handler {
+	return m.handler(next, func(ctx context.Context, path string, opts []file.OpenOption) (any, func(), error) {
+		return m.deck.OpenReadContext(ctx, m.factory, path, opts)
+	})
+}
+
+// Write returns a handler that calls next with the tenant's database opened for writing.
+func (m *Middleware[B, S, F]) Write(next http.Handler) http.Handler {
+	return m.handler(next, func(ctx context.Context, path string, opts []file.OpenOption) (any, func(), error) {
+		return m.deck.OpenContext(ctx, m.factory, path, opts)
+	})
+}
+
+type openFunc func(context.Context, string, []file.OpenOption) (any, func(), error)
+
+func (m *Middleware[B, S, F]) handler(next http.Handler, open openFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant, err := m.tenantFn(r)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+
+		path, err := m.pathFn(r, tenant)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+
+		opts, err := m.options.openOptionsFunc(r, tenant)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+
+		db, release, err := open(r.Context(), path, opts)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		defer release()
+
+		ctx := context.WithValue(r.Context(), tenantContextKey{}, tenant)
+		ctx = context.WithValue(ctx, databaseContextKey{}, db)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+type tenantContextKey struct{}
+
+type databaseContextKey struct{}
+
+// TenantFromContext returns the tenant id that has been injected by the middleware.
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantContextKey{}).(string)
+	return tenant, ok
+}
+
+// DatabaseFromContext returns the database that has been injected by the Write middleware. The
+// database is only valid until the wrapped handler returns.
+func DatabaseFromContext[B tapedb.Base, S tapedb.State](ctx context.Context) (*file.Database[B, S], bool) {
+	db, ok := ctx.Value(databaseContextKey{}).(*file.Database[B, S])
+	return db, ok
+}
+
+// ReadOnlyDatabaseFromContext returns a read-only view of the database that has been injected by
+// the Read or the Write middleware. The view is only valid until the wrapped handler returns.
+func ReadOnlyDatabaseFromContext[B tapedb.Base, S tapedb.State](ctx context.Context) (*file.ReadOnlyDatabase[B, S], bool) {
+	switch db := ctx.Value(databaseContextKey{}).(type) {
+	case *file.ReadOnlyDatabase[B, S]:
+		return db, true
+	case *file.Database[B, S]:
+		return db.AsReadOnly(), true
+	default:
+		return nil, false
+	}
+}
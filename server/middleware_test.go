@@ -0,0 +1,93 @@
+package server_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/simia-tech/tapedb/v2/io/file"
+	"github.com/simia-tech/tapedb/v2/server"
+	"github.com/simia-tech/tapedb/v2/test"
+)
+
+func TestMiddleware(t *testing.T) {
+	path, removeDir := makeTempDir(t)
+	defer removeDir()
+
+	deck, err := file.NewDeck[*test.Base, *test.State, *test.Factory](2)
+	require.NoError(t, err)
+	defer deck.Close()
+
+	testFactory := test.NewFactory()
+
+	require.NoError(t, deck.Create(testFactory, filepath.Join(path, "one")))
+
+	middleware := server.NewMiddleware(deck, testFactory,
+		server.HeaderTenantFunc("X-Tenant"), server.DirectoryPathFunc(path))
+
+	mux := http.NewServeMux()
+	mux.Handle("/state", middleware.Read(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, ok := server.DatabaseFromContext[*test.Base, *test.State](r.Context())
+		require.False(t, ok)
+		db, ok := server.ReadOnlyDatabaseFromContext[*test.Base, *test.State](r.Context())
+		require.True(t, ok)
+		tenant, _ := server.TenantFromContext(r.Context())
+		fmt.Fprintf(w, "%s:%d", tenant, db.State().Counter)
+	})))
+	mux.Handle("/inc", middleware.Write(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		db, ok := server.DatabaseFromContext[*test.Base, *test.State](r.Context())
+		require.True(t, ok)
+		if err := db.Apply(&test.ChangeCounterInc{Value: 2}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})))
+
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	tenantRequest := func(t *testing.T, method, url, tenant string) (int, string) {
+		r, err := http.NewRequest(method, url, nil)
+		require.NoError(t, err)
+		if tenant != "" {
+			r.Header.Set("X-Tenant", tenant)
+		}
+		response, err := http.DefaultClient.Do(r)
+		require.NoError(t, err)
+		defer response.Body.Close()
+		data, err := io.ReadAll(response.Body)
+		require.NoError(t, err)
+		return response.StatusCode, string(data)
+	}
+
+	t.Run("Write", func(t *testing.T) {
+		status, _ := tenantRequest(t, http.MethodPost, s.URL+"/inc", "one")
+		assert.Equal(t, http.StatusNoContent, status)
+
+		status, body := tenantRequest(t, http.MethodGet, s.URL+"/state", "one")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "one:2", body)
+	})
+
+	t.Run("MissingTenant", func(t *testing.T) {
+		status, _ := tenantRequest(t, http.MethodGet, s.URL+"/state", "")
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+
+	t.Run("InvalidTenant", func(t *testing.T) {
+		status, _ := tenantRequest(t, http.MethodGet, s.URL+"/state", "..")
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+
+	t.Run("UnknownTenant", func(t *testing.T) {
+		status, _ := tenantRequest(t, http.MethodGet, s.URL+"/state", "two")
+		assert.Equal(t, http.StatusNotFound, status)
+	})
+}
@@ -0,0 +1,71 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+
+	"github.com/simia-tech/tapedb/v2/io/file"
+)
+
+type CreateOptionsFunc func(*http.Request, string) ([]file.CreateOption, error)
+
+type OpenOptionsFunc func(*http.Request, string) ([]file.OpenOption, error)
+
+type handlerOptions struct {
+	createOptionsFunc CreateOptionsFunc
+	openOptionsFunc   OpenOptionsFunc
+}
+
+var defaultHandlerOptions = handlerOptions{
+	createOptionsFunc: func(_ *http.Request, _ string) ([]file.CreateOption, error) {
+		return []file.CreateOption{}, nil
+	},
+	openOptionsFunc: func(_ *http.Request, _ string) ([]file.OpenOption, error) {
+		return []file.OpenOption{}, nil
+	},
+}
+
+type Option func(*handlerOptions)
+
+func WithCreateOptionsFunc(value CreateOptionsFunc) Option {
+	return func(o *handlerOptions) {
+		o.createOptionsFunc = value
+	}
+}
+
+func WithOpenOptionsFunc(value OpenOptionsFunc) Option {
+	return func(o *handlerOptions) {
+		o.openOptionsFunc = value
+	}
+}
+
+type middlewareOptions struct {
+	openOptionsFunc OpenOptionsFunc
+}
+
+var defaultMiddlewareOptions = middlewareOptions{
+	openOptionsFunc: defaultHandlerOptions.openOptionsFunc,
+}
+
+type MiddlewareOption func(*middlewareOptions)
+
+// WithMiddlewareOpenOptionsFunc sets the function that returns the open options (e.g. the key) of
+// the tenant's database. The second argument is the tenant id.
+func WithMiddlewareOpenOptionsFunc(value OpenOptionsFunc) MiddlewareOption {
+	return func(o *middlewareOptions) {
+		o.openOptionsFunc = value
+	}
+}
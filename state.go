@@ -17,3 +17,11 @@ package tapedb
 type State interface {
 	Apply(Change) error
 }
+
+// Checkpointer can be implemented by a state to roll back changes whose log entries couldn't be
+// written. Checkpoint is called before a change is applied and Rollback with the returned value if
+// the change has to be taken back.
+type Checkpointer interface {
+	Checkpoint() any
+	Rollback(checkpoint any)
+}
@@ -15,14 +15,24 @@
 package test
 
 import (
-	"encoding/json"
 	"io"
+	"sort"
 
 	"github.com/simia-tech/tapedb/v2"
 )
 
+// Base holds the counter value, the items and the ids of the attached payloads.
 type Base struct {
-	Value int `json:"value"`
+	tapedb.Payloads
+
+	Value int             `json:"value"`
+	Items map[string]Item `json:"items,omitempty"`
+}
+
+// Item is an entry of the example model. It can reference a payload that holds its attachment.
+type Item struct {
+	Name      string `json:"name"`
+	PayloadID string `json:"payloadID,omitempty"`
 }
 
 func NewBase() *Base {
@@ -30,17 +40,128 @@ func NewBase() *Base {
 }
 
 func (b *Base) ReadFrom(r io.Reader) (int64, error) {
-	return 0, json.NewDecoder(r).Decode(b)
+	return tapedb.ReadJSON(r, b)
 }
 
 func (b *Base) WriteTo(w io.Writer) (int64, error) {
-	return 0, json.NewEncoder(w).Encode(b)
+	return tapedb.WriteJSON(w, b)
 }
 
 func (b *Base) Apply(c tapedb.Change) error {
+	// item changes reference payloads as well, so they are applied after their payloads are tracked
+	b.ApplyPayloadChange(c)
+
+	switch t := c.(type) {
+	case *ChangeCounterInc:
+		b.Value += t.Value
+	case *ChangeCounterMul:
+		b.Value *= t.Value
+	case *ChangeItemAdd:
+		if b.Items == nil {
+			b.Items = map[string]Item{}
+		}
+		b.Items[t.ID] = Item{Name: t.Name, PayloadID: t.PayloadID}
+	case *ChangeItemRemove:
+		delete(b.Items, t.ID)
+	}
+	return nil
+}
+
+// PlainBase is a base that doesn't keep track of payloads.
+type PlainBase struct {
+	Value int `json:"value"`
+}
+
+func NewPlainBase() *PlainBase {
+	return &PlainBase{Value: 0}
+}
+
+func (b *PlainBase) ReadFrom(r io.Reader) (int64, error) {
+	return tapedb.ReadJSON(r, b)
+}
+
+func (b *PlainBase) WriteTo(w io.Writer) (int64, error) {
+	return tapedb.WriteJSON(w, b)
+}
+
+func (b *PlainBase) Apply(c tapedb.Change) error {
 	switch t := c.(type) {
 	case *ChangeCounterInc:
 		b.Value += t.Value
+	case *ChangeCounterMul:
+		b.Value *= t.Value
+	}
+	return nil
+}
+
+// ChunkedBase holds the same data as Base, but is written in chunks of at most ChunkSize items.
+type ChunkedBase struct {
+	Base
+
+	ChunkSize int `json:"-"`
+}
+
+var _ tapedb.ChunkedBase = &ChunkedBase{}
+
+// NewChunkedBase returns a base with a small chunk size, so even small bases consist of several
+// chunks.
+func NewChunkedBase() *ChunkedBase {
+	return &ChunkedBase{ChunkSize: 2}
+}
+
+// WriteChunks passes the counter and the payload ids in the first chunk and the items ordered by
+// their ids.
+func (b *ChunkedBase) WriteChunks(fn func(io.WriterTo) error) error {
+	ids := make([]string, 0, len(b.Items))
+	for id := range b.Items {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	chunk := &BaseChunk{Value: b.Value, PayloadIDs: b.IDs}
+	for _, id := range ids {
+		if b.ChunkSize > 0 && len(chunk.Items) == b.ChunkSize {
+			if err := fn(chunk); err != nil {
+				return err
+			}
+			chunk = &BaseChunk{}
+		}
+		if chunk.Items == nil {
+			chunk.Items = map[string]Item{}
+		}
+		chunk.Items[id] = b.Items[id]
+	}
+	return fn(chunk)
+}
+
+func (b *ChunkedBase) NewChunk() io.ReaderFrom {
+	return &BaseChunk{}
+}
+
+func (b *ChunkedBase) AddChunk(c io.ReaderFrom) error {
+	chunk := c.(*BaseChunk)
+	b.Value += chunk.Value
+	b.IDs = append(b.IDs, chunk.PayloadIDs...)
+	for id, item := range chunk.Items {
+		if b.Items == nil {
+			b.Items = map[string]Item{}
+		}
+		b.Items[id] = item
 	}
 	return nil
 }
+
+// BaseChunk is a chunk of a ChunkedBase.
+type BaseChunk struct {
+	Value      int             `json:"value,omitempty"`
+	PayloadIDs []string        `json:"payloadIDs,omitempty"`
+	Items      map[string]Item `json:"items,omitempty"`
+}
+
+func (c *BaseChunk) ReadFrom(r io.Reader) (int64, error) {
+	return tapedb.ReadJSON(r, c)
+}
+
+func (c *BaseChunk) WriteTo(w io.Writer) (int64, error) {
+	return tapedb.WriteJSON(w, c)
+}
@@ -1,8 +1,10 @@
 package test
 
 import (
-	"encoding/json"
+	"fmt"
 	"io"
+
+	"github.com/simia-tech/tapedb/v2"
 )
 
 type ChangeCounterInc struct {
@@ -14,11 +16,81 @@ func (c *ChangeCounterInc) TypeName() string {
 }
 
 func (c *ChangeCounterInc) ReadFrom(r io.Reader) (int64, error) {
-	return 0, json.NewDecoder(r).Decode(c)
+	return tapedb.ReadJSON(r, c)
 }
 
 func (c *ChangeCounterInc) WriteTo(w io.Writer) (int64, error) {
-	return 0, json.NewEncoder(w).Encode(c)
+	return tapedb.WriteJSON(w, c)
+}
+
+func (c *ChangeCounterInc) Invert() tapedb.Change {
+	return &ChangeCounterInc{Value: -c.Value}
+}
+
+type ChangeCounterSet struct {
+	Value int `json:"value"`
+}
+
+func (c *ChangeCounterSet) TypeName() string {
+	return "counter-set"
+}
+
+func (c *ChangeCounterSet) ReadFrom(r io.Reader) (int64, error) {
+	return tapedb.ReadJSON(r, c)
+}
+
+func (c *ChangeCounterSet) WriteTo(w io.Writer) (int64, error) {
+	return tapedb.WriteJSON(w, c)
+}
+
+func (c *ChangeCounterSet) ConflictsWith(other tapedb.Change) bool {
+	_, ok := other.(*ChangeCounterSet)
+	return ok
+}
+
+// ChangeCounterMul multiplies the counter. It doesn't commute with ChangeCounterInc.
+type ChangeCounterMul struct {
+	Value int `json:"value"`
+}
+
+func (c *ChangeCounterMul) TypeName() string {
+	return "counter-mul"
+}
+
+func (c *ChangeCounterMul) ReadFrom(r io.Reader) (int64, error) {
+	return tapedb.ReadJSON(r, c)
+}
+
+func (c *ChangeCounterMul) WriteTo(w io.Writer) (int64, error) {
+	return tapedb.WriteJSON(w, c)
+}
+
+// ChangeCounterDec decreases the counter. It's invalid if the counter would drop below zero.
+type ChangeCounterDec struct {
+	Value int `json:"value"`
+}
+
+func (c *ChangeCounterDec) TypeName() string {
+	return "counter-dec"
+}
+
+func (c *ChangeCounterDec) ReadFrom(r io.Reader) (int64, error) {
+	return tapedb.ReadJSON(r, c)
+}
+
+func (c *ChangeCounterDec) WriteTo(w io.Writer) (int64, error) {
+	return tapedb.WriteJSON(w, c)
+}
+
+func (c *ChangeCounterDec) Invert() tapedb.Change {
+	return &ChangeCounterInc{Value: c.Value}
+}
+
+func (c *ChangeCounterDec) Validate(s *State) error {
+	if s.Counter < c.Value {
+		return fmt.Errorf("counter %d is less than %d", s.Counter, c.Value)
+	}
+	return nil
 }
 
 type ChangeAttachPayload struct {
@@ -30,11 +102,11 @@ func (c *ChangeAttachPayload) TypeName() string {
 }
 
 func (c *ChangeAttachPayload) ReadFrom(r io.Reader) (int64, error) {
-	return 0, json.NewDecoder(r).Decode(c)
+	return tapedb.ReadJSON(r, c)
 }
 
 func (c *ChangeAttachPayload) WriteTo(w io.Writer) (int64, error) {
-	return 0, json.NewEncoder(w).Encode(c)
+	return tapedb.WriteJSON(w, c)
 }
 
 func (c *ChangeAttachPayload) PayloadIDs() []string {
@@ -43,3 +115,70 @@ func (c *ChangeAttachPayload) PayloadIDs() []string {
 	}
 	return []string{c.PayloadID}
 }
+
+// ChangeItemAdd adds an item. The item can reference a payload that has to be applied together
+// with the change.
+type ChangeItemAdd struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	PayloadID string `json:"payloadID,omitempty"`
+}
+
+func (c *ChangeItemAdd) TypeName() string {
+	return "item-add"
+}
+
+func (c *ChangeItemAdd) ReadFrom(r io.Reader) (int64, error) {
+	return tapedb.ReadJSON(r, c)
+}
+
+func (c *ChangeItemAdd) WriteTo(w io.Writer) (int64, error) {
+	return tapedb.WriteJSON(w, c)
+}
+
+func (c *ChangeItemAdd) PayloadIDs() []string {
+	if c.PayloadID == "" {
+		return []string{}
+	}
+	return []string{c.PayloadID}
+}
+
+func (c *ChangeItemAdd) Validate(s *State) error {
+	if _, ok := s.Items[c.ID]; ok {
+		return fmt.Errorf("item %s already exists", c.ID)
+	}
+	return nil
+}
+
+// ChangeItemRemove removes an item and detaches its payload, so the payload is deleted by the next
+// splice.
+type ChangeItemRemove struct {
+	ID        string `json:"id"`
+	PayloadID string `json:"payloadID,omitempty"`
+}
+
+func (c *ChangeItemRemove) TypeName() string {
+	return "item-remove"
+}
+
+func (c *ChangeItemRemove) ReadFrom(r io.Reader) (int64, error) {
+	return tapedb.ReadJSON(r, c)
+}
+
+func (c *ChangeItemRemove) WriteTo(w io.Writer) (int64, error) {
+	return tapedb.WriteJSON(w, c)
+}
+
+func (c *ChangeItemRemove) DetachedPayloadIDs() []string {
+	if c.PayloadID == "" {
+		return []string{}
+	}
+	return []string{c.PayloadID}
+}
+
+func (c *ChangeItemRemove) Validate(s *State) error {
+	if _, ok := s.Items[c.ID]; !ok {
+		return fmt.Errorf("item %s doesn't exist", c.ID)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/simia-tech/tapedb/v2"
+)
+
+// Clock is a manual clock. The time only moves if Add or Sleep is called. Timers fire when the
+// time passes their deadline.
+type Clock struct {
+	now    time.Time
+	timers []*timer
+	mutex  sync.Mutex
+}
+
+var _ tapedb.Clock = &Clock{}
+
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+func (c *Clock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *Clock) Sleep(d time.Duration) {
+	c.Add(d)
+}
+
+func (c *Clock) AfterFunc(d time.Duration, fn func()) tapedb.Timer {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	t := &timer{clock: c, deadline: c.now.Add(d), fn: fn}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Add moves the time forward and runs the functions of all timers that expired.
+func (c *Clock) Add(d time.Duration) {
+	c.mutex.Lock()
+	c.now = c.now.Add(d)
+	expired := []*timer{}
+	pending := []*timer{}
+	for _, t := range c.timers {
+		if t.deadline.After(c.now) {
+			pending = append(pending, t)
+		} else {
+			expired = append(expired, t)
+		}
+	}
+	c.timers = pending
+	c.mutex.Unlock()
+
+	sort.Slice(expired, func(i, j int) bool {
+		return expired[i].deadline.Before(expired[j].deadline)
+	})
+	for _, t := range expired {
+		t.fn()
+	}
+}
+
+type timer struct {
+	clock    *Clock
+	deadline time.Time
+	fn       func()
+}
+
+func (t *timer) Stop() bool {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+
+	for index, other := range t.clock.timers {
+		if other == t {
+			t.clock.timers = append(t.clock.timers[:index], t.clock.timers[index+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -12,6 +12,19 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+// Package test provides a small example model that is used by the tests of tapedb and can serve as
+// a template for new models. The model consists of
+//
+//   - a counter that is changed by ChangeCounterInc, ChangeCounterSet, ChangeCounterMul and
+//     ChangeCounterDec,
+//   - items that are added by ChangeItemAdd and removed by ChangeItemRemove and
+//   - payload attachments, either referenced by an item or by ChangeAttachPayload.
+//
+// Base is the snapshot of the model that is written by a splice, State is the in-memory view that
+// is built from the base and the changes of the log. Factory creates all of them. The changes show
+// the optional interfaces of tapedb: ChangeCounterInc is invertible, ChangeCounterSet conflicts
+// with other sets during a merge and ChangeCounterDec, ChangeItemAdd and ChangeItemRemove validate
+// themselves against the state.
 package test
 
 import (
@@ -39,8 +52,55 @@ func (f *Factory) NewChange(typeName string) (tapedb.Change, error) {
 	switch typeName {
 	case "counter-inc":
 		return &ChangeCounterInc{}, nil
+	case "counter-set":
+		return &ChangeCounterSet{}, nil
+	case "counter-mul":
+		return &ChangeCounterMul{}, nil
+	case "counter-dec":
+		return &ChangeCounterDec{}, nil
 	case "attach-payload":
 		return &ChangeAttachPayload{}, nil
+	case "item-add":
+		return &ChangeItemAdd{}, nil
+	case "item-remove":
+		return &ChangeItemRemove{}, nil
+	}
+	if change, ok := tapedb.NewPayloadChange(typeName); ok {
+		return change, nil
 	}
 	return nil, fmt.Errorf("change type [%s]: %w", typeName, tapedb.ErrUnknownChangeType)
 }
+
+// PlainFactory creates the same changes and states as Factory, but uses PlainBase as the base.
+type PlainFactory struct {
+	Factory
+}
+
+func NewPlainFactory() *PlainFactory {
+	return &PlainFactory{}
+}
+
+func (f *PlainFactory) NewBase() *PlainBase {
+	return NewPlainBase()
+}
+
+func (f *PlainFactory) NewState(base *PlainBase, readLocker sync.Locker) *State {
+	return &State{Counter: base.Value, ReadLocker: readLocker}
+}
+
+// ChunkedFactory creates the same changes and states as Factory, but uses ChunkedBase as the base.
+type ChunkedFactory struct {
+	Factory
+}
+
+func NewChunkedFactory() *ChunkedFactory {
+	return &ChunkedFactory{}
+}
+
+func (f *ChunkedFactory) NewBase() *ChunkedBase {
+	return NewChunkedBase()
+}
+
+func (f *ChunkedFactory) NewState(base *ChunkedBase, readLocker sync.Locker) *State {
+	return NewState(&base.Base, readLocker)
+}
@@ -20,19 +20,61 @@ import (
 	"github.com/simia-tech/tapedb/v2"
 )
 
+// State holds the counter and the items. Its readers have to hold the ReadLocker or read it via
+// the View method of the database.
 type State struct {
 	Counter    int
+	Items      map[string]Item
 	ReadLocker sync.Locker
 }
 
 func NewState(b *Base, rl sync.Locker) *State {
-	return &State{Counter: b.Value, ReadLocker: rl}
+	return &State{Counter: b.Value, Items: copyItems(b.Items), ReadLocker: rl}
 }
 
 func (s *State) Apply(c tapedb.Change) error {
 	switch t := c.(type) {
 	case *ChangeCounterInc:
 		s.Counter += t.Value
+	case *ChangeCounterSet:
+		s.Counter = t.Value
+	case *ChangeCounterMul:
+		s.Counter *= t.Value
+	case *ChangeCounterDec:
+		s.Counter -= t.Value
+	case *ChangeItemAdd:
+		if s.Items == nil {
+			s.Items = map[string]Item{}
+		}
+		s.Items[t.ID] = Item{Name: t.Name, PayloadID: t.PayloadID}
+	case *ChangeItemRemove:
+		delete(s.Items, t.ID)
 	}
 	return nil
 }
+
+type stateCheckpoint struct {
+	counter int
+	items   map[string]Item
+}
+
+func (s *State) Checkpoint() any {
+	return stateCheckpoint{counter: s.Counter, items: copyItems(s.Items)}
+}
+
+func (s *State) Rollback(checkpoint any) {
+	cp := checkpoint.(stateCheckpoint)
+	s.Counter = cp.counter
+	s.Items = cp.items
+}
+
+func copyItems(items map[string]Item) map[string]Item {
+	if items == nil {
+		return nil
+	}
+	result := make(map[string]Item, len(items))
+	for id, item := range items {
+		result[id] = item
+	}
+	return result
+}
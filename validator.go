@@ -0,0 +1,40 @@
+// Copyright 2021 The tapedb authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tapedb
+
+import (
+	"fmt"
+)
+
+var ErrInvalidChange = NewError(ErrorCodeInvalidChange, "invalid change")
+
+// Validator can be implemented by a change that has to be checked against the state before it's
+// applied. The state is locked during the validation, so the validator must not lock it again.
+type Validator[S State] interface {
+	Validate(S) error
+}
+
+// ValidateChange validates the change against the provided state if the change implements
+// Validator. The returned error wraps ErrInvalidChange.
+func ValidateChange[S State](c Change, state S) error {
+	v, ok := c.(Validator[S])
+	if !ok {
+		return nil
+	}
+	if err := v.Validate(state); err != nil {
+		return fmt.Errorf("change %s: %v: %w", c.TypeName(), err, ErrInvalidChange)
+	}
+	return nil
+}